@@ -0,0 +1,46 @@
+package assembly
+
+import (
+	"context"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+)
+
+// Database is the database the locator assembles the components over: the stores of the services,
+// and the schema management, health check and shutdown of the locator itself. PostgresRepository
+// implements it
+type Database interface {
+	service.PredictionStore
+	service.ModelSyncStore
+	service.FeatureFlagStore
+	service.TrainingJobStore
+	service.OutboxStore
+	service.RecommendationStore
+	service.ForecastRecomputeStore
+	service.ReportStore
+	service.ForecastStore
+	service.ForecastActualsStore
+	service.ProductStore
+	service.RetrainStore
+	service.SimulationStore
+	service.BatchPredictionStore
+	service.PromotionStore
+	service.APIUsageStore
+	service.SellerStatsStore
+	service.GoldenOutputStore
+	service.BacktestStore
+	service.AuditStore
+	service.EventStore
+	service.JobExecutionStore
+	service.QueueWeightStore
+	service.StandbyStore
+
+	EnsureSchema() error
+	VerifySchema() error
+	MissingTables(tables ...string) ([]string, error)
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+var _ Database = (*repository.PostgresRepository)(nil)
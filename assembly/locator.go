@@ -1,75 +1,785 @@
 package assembly
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"path/filepath"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/graduate-work-mirea/data-processor-service/config"
 	"github.com/graduate-work-mirea/data-processor-service/controller"
+	"github.com/graduate-work-mirea/data-processor-service/internal/chaos"
+	"github.com/graduate-work-mirea/data-processor-service/internal/evaluation"
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
+	"github.com/graduate-work-mirea/data-processor-service/internal/httpclient"
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+	"github.com/graduate-work-mirea/data-processor-service/internal/rabbitmq"
+	"github.com/graduate-work-mirea/data-processor-service/internal/startup"
 	"github.com/graduate-work-mirea/data-processor-service/repository"
 	"github.com/graduate-work-mirea/data-processor-service/service"
 	"go.uber.org/zap"
 )
 
 type ServiceLocator struct {
-	Config               *config.Config
-	Logger               *zap.SugaredLogger
-	FileRepository       *repository.FileRepository
-	PostgresRepository   *repository.PostgresRepository
-	MLPredictionService  *service.MLPredictionService
-	PredictionController *controller.PredictionAPIController
-	HTTPServer           *http.Server
-	Router               *gin.Engine
+	Config                   *config.Config
+	Logger                   *zap.SugaredLogger
+	Metrics                  *metrics.Registry
+	HTTPMetrics              *metrics.HTTPMetrics
+	FileRepository           *repository.FileRepository
+	PostgresRepository       Database
+	RabbitMQClient           *rabbitmq.Client
+	ArtifactStore            repository.ArtifactStore
+	ResultStore              repository.ResultStore
+	PythonEnvironment        *service.PythonEnvironment
+	InferenceEngine          service.InferenceEngine
+	MLPredictionService      *service.MLPredictionService
+	TrainingJobs             *service.TrainingJobs
+	SimulationService        *service.SimulationService
+	AsyncBatchService        *service.AsyncBatchService
+	ReportService            *service.ReportService
+	RecommendationService    *service.RecommendationService
+	StatusService            *service.StatusService
+	ForecastService          *service.ForecastService
+	Backtester               *service.Backtester
+	ModelSynchronizer        *service.ModelSynchronizer
+	StandbyModel             *service.StandbyModel
+	GoldenSet                *service.GoldenSet
+	DiskMonitor              *service.DiskMonitor
+	Replayer                 *service.Replayer
+	ForecastRecomputer       *service.ForecastRecomputer
+	Lifecycle                *service.Lifecycle
+	Scheduler                *service.Scheduler
+	AuditLog                 *service.AuditLog
+	EventLog                 *service.EventLog
+	Promotions               *service.Promotions
+	FeatureFlags             *service.FeatureFlags
+	QueueWeights             *service.QueueWeights
+	APIUsage                 *service.APIUsage
+	Ingestion                *service.Ingestion
+	IngestionHandlers        service.TopicHandlers
+	ProductCatalog           *service.ProductCatalog
+	ResultFiles              *service.ResultFiles
+	WorkerPool               *service.WorkerPool
+	PredictionController     *controller.PredictionAPIController
+	PredictionV2Controller   *controller.PredictionAPIV2Controller
+	SimulationController     *controller.SimulationAPIController
+	ReportController         *controller.ReportAPIController
+	RecommendationController *controller.RecommendationAPIController
+	ModelController          *controller.ModelAPIController
+	StatusController         *controller.StatusAPIController
+	LifecycleController      *controller.LifecycleAPIController
+	AdminController          *controller.AdminAPIController
+	JobController            *controller.JobAPIController
+	ResultController         *controller.ResultAPIController
+	ForecastController       *controller.ForecastAPIController
+	BacktestController       *controller.BacktestAPIController
+	EventController          *controller.EventAPIController
+	PromotionController      *controller.PromotionAPIController
+	ProductController        *controller.ProductAPIController
+	HTTPServer               *http.Server
+	Router                   *gin.Engine
 }
 
-func NewServiceLocator(cfg *config.Config, logger *zap.SugaredLogger) (*ServiceLocator, error) {
+// pythonEnvProbeTimeout bounds the Python environment check at startup
+const pythonEnvProbeTimeout = 30 * time.Second
+
+// Run modes, selected with RUN_MODE, so that API replicas scale separately from the replicas
+// consuming the ingestion paths and running the background jobs
+const (
+	RunModeAPI    = "api"
+	RunModeWorker = "worker"
+	RunModeAll    = "all"
+)
+
+// NewServiceLocator wires the components of the run mode of the configuration. pythonRequirements
+// is the requirements.txt manifest embedded in the binary, against which the installed Python
+// packages are verified. Options substitute components, such as the database or the inference
+// engine, and change the middleware chain of the HTTP server.
+//
+// Components are wired in phases, each handing its components to the next: storage, services,
+// background jobs and the HTTP server. A worker serves only the probes, metrics and job
+// administration over HTTP, and an API replica neither consumes the ingestion paths nor registers
+// jobs. Every component is given
+// its dependencies by its constructor, and controllers see the services through the interfaces of
+// the controller package.
+func NewServiceLocator(cfg *config.Config, pythonRequirements string, logger *zap.SugaredLogger, opts ...Option) (*ServiceLocator, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	locator := &ServiceLocator{
+		Config:    cfg,
+		Logger:    logger,
+		Metrics:   metrics.NewRegistry(),
+		Lifecycle: service.NewLifecycle(),
+	}
+	if err := locator.initStorage(pythonRequirements, o); err != nil {
+		locator.Close()
+		return nil, err
+	}
+	if err := locator.initServices(o); err != nil {
+		locator.Close()
+		return nil, err
+	}
+	if err := locator.initJobs(); err != nil {
+		locator.Close()
+		return nil, err
+	}
+	locator.initHTTP(o)
+	return locator, nil
+}
+
+// ServesAPI reports whether the replica serves the API
+func (l *ServiceLocator) ServesAPI() bool {
+	return l.Config.RunMode != RunModeWorker
+}
+
+// RunsWorkers reports whether the replica consumes the ingestion paths and runs the background
+// jobs, including the training of missing models at startup
+func (l *ServiceLocator) RunsWorkers() bool {
+	return l.Config.RunMode != RunModeAPI
+}
+
+// initStorage opens the model files, the database, the message broker and the artifact and
+// result stores, and checks the Python environment
+func (l *ServiceLocator) initStorage(pythonRequirements string, o *options) error {
+	cfg, logger := l.Config, l.Logger
+
+	// Artifacts, result files and training datasets share the encryption key
+	var artifactCipher *repository.ArtifactCipher
+	if cfg.ArtifactEncryptionKey != nil {
+		var err error
+		artifactCipher, err = repository.NewArtifactCipher(cfg.ArtifactEncryptionKey)
+		if err != nil {
+			logger.Errorw("Failed to initialize artifact encryption", "error", err)
+			return err
+		}
+	}
+
 	// Initialize repositories
-	fileRepo := repository.NewFileRepository(cfg.ProcessedDataPath, cfg.ModelPath)
+	fileRepo := repository.NewFileRepository(cfg.ProcessedDataPath, cfg.ModelPath, cfg.PythonTerminationGrace, artifactCipher, logger.Named("python"))
+	l.FileRepository = fileRepo
+	if err := fileRepo.CleanStagingDirs(); err != nil {
+		logger.Warnw("Failed to clean up model staging directories", "error", err)
+	}
+
+	// Refuse to train or serve with Python packages that produce incompatible model files
+	if cfg.PythonEnvCheck != service.PythonEnvCheckOff {
+		pythonEnv, err := service.NewPythonEnvironment(fileRepo, pythonRequirements)
+		if err != nil {
+			logger.Errorw("Failed to load Python requirements manifest", "error", err)
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), pythonEnvProbeTimeout)
+		err = pythonEnv.Check(ctx)
+		cancel()
+		if err != nil {
+			if cfg.PythonEnvCheck == service.PythonEnvCheckStrict {
+				logger.Errorw("Python environment check failed", "error", err)
+				return err
+			}
+			logger.Warnw("Python environment check failed", "error", err)
+		}
+		l.PythonEnvironment = pythonEnv
+	}
+
+	// Initialize PostgreSQL repository, unless one was given
+	postgresRepo := o.postgresRepo
+	if postgresRepo == nil {
+		retryPolicy := repository.RetryPolicy{
+			MaxAttempts:    cfg.DBRetryMaxAttempts,
+			InitialBackoff: cfg.DBRetryInitialBackoff,
+			MaxBackoff:     cfg.DBRetryMaxBackoff,
+		}
+		err := startup.WaitFor("postgres", cfg.StartupWaitTimeout, func() error {
+			repo, err := repository.NewPostgresRepository(cfg.GetPostgresConnectionString(), retryPolicy)
+			if err != nil {
+				return err
+			}
+			postgresRepo = repo
+			return nil
+		}, logger)
+		if err != nil {
+			logger.Errorw("Failed to initialize PostgreSQL repository", "error", err)
+			return err
+		}
+	}
+	l.PostgresRepository = postgresRepo
+
+	if err := postgresRepo.EnsureSchema(); err != nil {
+		logger.Errorw("Failed to apply database schema", "error", err)
+		return err
+	}
+	if err := postgresRepo.VerifySchema(); err != nil {
+		logger.Errorw("Database schema check failed", "error", err)
+		return err
+	}
 
-	// Initialize PostgreSQL repository
-	postgresRepo, err := repository.NewPostgresRepository(cfg.GetPostgresConnectionString())
+	// processed_data is owned by the data processor service and may appear after this service starts
+	if missing, err := postgresRepo.MissingTables("processed_data"); err == nil && len(missing) > 0 {
+		logger.Warnw("processed_data table does not exist yet, predictions will use default features")
+	}
+
+	// Initialize RabbitMQ client if a broker is configured and the replica consumes it
+	if cfg.RabbitMQURL != "" && l.RunsWorkers() {
+		var signer *rabbitmq.Signer
+		if cfg.RabbitMQSigningKeys != nil {
+			var err error
+			signer, err = rabbitmq.NewSigner(cfg.RabbitMQProducerID, cfg.RabbitMQSigningKeys, cfg.RabbitMQSignatureMaxAge)
+			if err != nil {
+				logger.Errorw("Failed to initialize RabbitMQ message signing", "error", err)
+				return err
+			}
+		}
+
+		consumerMetrics := rabbitmq.NewConsumerMetrics(l.Metrics)
+		err := startup.WaitFor("rabbitmq", cfg.StartupWaitTimeout, func() error {
+			var err error
+			l.RabbitMQClient, err = rabbitmq.NewClient(cfg.RabbitMQURL, signer, consumerMetrics, cfg.RabbitMQLagInterval, logger)
+			return err
+		}, logger)
+		if err != nil {
+			logger.Errorw("Failed to initialize RabbitMQ client", "error", err)
+			return err
+		}
+	}
+
+	// Initialize shared artifact store if model distribution is enabled
+	if cfg.ArtifactStorePath != "" {
+		fileStore, err := repository.NewFileArtifactStore(cfg.ArtifactStorePath, artifactCipher)
+		if err != nil {
+			logger.Errorw("Failed to initialize artifact store", "error", err)
+			return err
+		}
+		l.ArtifactStore = fileStore
+		logger.Infow("Artifact store initialized", "path", cfg.ArtifactStorePath, "encrypted", artifactCipher != nil)
+	}
+
+	// Initialize the result store if large job outputs are served as files
+	if cfg.ResultStorePath != "" {
+		fileStore, err := repository.NewFileResultStore(cfg.ResultStorePath, artifactCipher)
+		if err != nil {
+			logger.Errorw("Failed to initialize result store", "error", err)
+			return err
+		}
+		l.ResultStore = fileStore
+		logger.Infow("Result store initialized", "path", cfg.ResultStorePath, "encrypted", artifactCipher != nil)
+	}
+	return nil
+}
+
+// initServices creates the inference engine and the services over the storage
+func (l *ServiceLocator) initServices(o *options) error {
+	cfg, logger := l.Config, l.Logger
+	fileRepo, postgresRepo, artifactStore := l.FileRepository, l.PostgresRepository, l.ArtifactStore
+	lifecycle := l.Lifecycle
+
+	// Feature flags gate new behaviours, so they are loaded before the components using them
+	featureFlagDefaults := make(map[string]service.FeatureFlagSetting, len(cfg.FeatureFlags))
+	for name, flag := range cfg.FeatureFlags {
+		featureFlagDefaults[name] = service.FeatureFlagSetting{Enabled: flag.Enabled, Percentage: flag.Percentage}
+	}
+	featureFlags, err := service.NewFeatureFlags(postgresRepo, featureFlagDefaults, cfg.FeatureFlagRefreshInterval, logger)
 	if err != nil {
-		logger.Errorw("Failed to initialize PostgreSQL repository", "error", err)
-		return nil, err
+		logger.Errorw("Invalid feature flag configuration", "error", err)
+		return err
+	}
+	if err := featureFlags.Refresh(); err != nil {
+		logger.Warnw("Failed to load stored feature flags, using the configured defaults", "error", err)
+	}
+	l.FeatureFlags = featureFlags
+
+	// Weights of the ingestion queues, shared by the replicas consuming them
+	queueWeights, err := service.NewQueueWeights(postgresRepo, cfg.RabbitMQQueueWeights, cfg.QueueWeightRefreshInterval, logger)
+	if err != nil {
+		logger.Errorw("Invalid queue weight configuration", "error", err)
+		return err
+	}
+	if err := queueWeights.Refresh(); err != nil {
+		logger.Warnw("Failed to load stored queue weights, using the configured defaults", "error", err)
+	}
+	l.QueueWeights = queueWeights
+
+	// Ingestion paths; both deliver to the same handler
+	if l.RunsWorkers() {
+		var ingestionSources []service.IngestionSource
+		if l.RabbitMQClient != nil && len(cfg.RabbitMQQueueWeights) > 0 {
+			ingestionSources = append(ingestionSources, service.NewRabbitMQIngestion(l.RabbitMQClient, queueWeights, cfg.RabbitMQPrefetch))
+		}
+		if cfg.OutboxEnabled {
+			ingestionSources = append(ingestionSources, service.NewOutboxIngestion(postgresRepo, cfg.OutboxPollInterval, cfg.OutboxBatchSize, cfg.OutboxMaxAttempts, logger))
+		}
+		l.Ingestion = service.NewIngestion(ingestionSources, lifecycle, logger)
+	}
+
+	// Outbound HTTP clients of the integrations share their metrics and circuit breaker settings
+	outboundMetrics := httpclient.NewMetrics(l.Metrics)
+	outboundPolicy := func(timeout time.Duration, maxAttempts int, initialBackoff, maxBackoff time.Duration) httpclient.Policy {
+		return httpclient.Policy{
+			Timeout:          timeout,
+			MaxAttempts:      maxAttempts,
+			InitialBackoff:   initialBackoff,
+			MaxBackoff:       maxBackoff,
+			FailureThreshold: cfg.OutboundCircuitFailures,
+			Cooldown:         cfg.OutboundCircuitCooldown,
+		}
+	}
+	modelServerClient := httpclient.New("model_server",
+		outboundPolicy(cfg.ModelServerTimeout, cfg.ModelServerMaxAttempts, 100*time.Millisecond, time.Second), outboundMetrics, logger)
+
+	// Initialize the inference engine selected in the configuration, unless one was given
+	processMetrics := service.NewProcessMetrics(l.Metrics)
+	// The Python engine is also a replay target when another engine serves predictions
+	var pythonEngine *service.PythonInferenceEngine
+	python := func() *service.PythonInferenceEngine {
+		if pythonEngine == nil {
+			scheduler := service.NewInferenceScheduler(cfg.PythonMaxConcurrency, cfg.InferenceInteractiveSLO, featureFlags, l.Metrics, logger)
+			pythonEngine = service.NewPythonInferenceEngine(fileRepo, processMetrics, scheduler)
+		}
+		return pythonEngine
+	}
+	engine := o.engine
+	if engine == nil {
+		switch cfg.InferenceEngine {
+		case service.InferenceEnginePython:
+			engine = python()
+		case service.InferenceEngineRemote:
+			if cfg.ModelServerURL == "" {
+				err := fmt.Errorf("MODEL_SERVER_URL is required for the %s inference engine", cfg.InferenceEngine)
+				logger.Errorw("Failed to initialize inference engine", "error", err)
+				return err
+			}
+			engine = service.NewRemoteInferenceEngine(cfg.ModelServerURL, cfg.ModelServerToken, modelServerClient)
+		case service.InferenceEngineStub:
+			logger.Warnw("Serving stub predictions, only use the stub engine for load tests", "latency", cfg.StubEngineLatency)
+			engine = service.NewStubInferenceEngine(cfg.StubEngineLatency)
+		default:
+			err := fmt.Errorf("unknown inference engine: %s", cfg.InferenceEngine)
+			logger.Errorw("Failed to initialize inference engine", "error", err)
+			return err
+		}
 	}
+	l.InferenceEngine = engine
 
 	// Initialize services
-	mlService := service.NewMLPredictionService(fileRepo, postgresRepo, logger)
+	staleness := service.StalenessPolicy{
+		MaxAgeDays: cfg.HistoryMaxStalenessDays,
+		Strict:     cfg.HistoryStrictMode,
+	}
+	horizon := service.PredictionHorizon{MaxDays: cfg.PredictionMaxHorizonDays}
+	modelCheck := service.NewModelCheck(fileRepo, cfg.ModelCheckTTL)
+	eventLog := service.NewEventLog(postgresRepo, logger)
+	l.EventLog = eventLog
+	l.Promotions = service.NewPromotions(postgresRepo, logger)
+	productCatalog := service.NewProductCatalog(postgresRepo, logger)
+	l.ProductCatalog = productCatalog
+	l.IngestionHandlers = service.TopicHandlers{
+		service.ProductTopic: productCatalog.HandleMessage,
+	}
+	// External feature providers merged into feature vectors. A prediction does not wait for retries
+	// of a provider, which is only asked once within its timeout
+	var providers []features.Provider
+	for _, provider := range cfg.FeatureProviders {
+		client := httpclient.New("feature_provider_"+provider.Name, outboundPolicy(cfg.FeatureProviderTimeout, 1, 0, 0), outboundMetrics, logger)
+		providers = append(providers, features.NewHTTPProvider(provider.Name, provider.URL, provider.Token, client))
+	}
+	featureProviders := service.NewFeatureProviders(providers, cfg.FeatureProviderCacheTTL, l.Metrics, logger)
+	if len(providers) > 0 {
+		logger.Infow("Feature providers configured", "providers", featureProviders.Names(),
+			"timeout", cfg.FeatureProviderTimeout, "cache_ttl", cfg.FeatureProviderCacheTTL)
+	}
+	// Lag features of new models, counted over calendar or business days with missing days
+	// optionally interpolated
+	lags := service.LagPolicy{
+		Mode:          features.LagMode(cfg.LagMode),
+		Interpolation: features.Interpolation(cfg.HistoryInterpolation),
+	}
+	if cfg.HolidaysFile != "" {
+		// The training script runs in a directory of its own, so it is given an absolute path
+		if lags.HolidaysFile, err = filepath.Abs(cfg.HolidaysFile); err != nil {
+			logger.Errorw("Failed to resolve holiday calendar path", "error", err, "path", cfg.HolidaysFile)
+			return err
+		}
+		holidays, err := features.LoadHolidays(cfg.HolidaysFile)
+		if err != nil {
+			logger.Errorw("Failed to load holiday calendar", "error", err, "path", cfg.HolidaysFile)
+			return err
+		}
+		lags.Holidays = holidays
+		logger.Infow("Holiday calendar loaded", "path", cfg.HolidaysFile, "holidays", len(holidays))
+	}
+	window := service.TrainingWindow{Mode: cfg.TrainingWindow, Days: cfg.TrainingWindowDays}
+	quota := service.TrainingQuota{MaxRows: cfg.TrainingMaxRows, MaxBytes: cfg.TrainingMaxBytes}
+	overfitting := service.OverfittingPolicy{
+		EarlyStoppingRounds: cfg.EarlyStoppingRounds,
+		ThresholdPercent:    cfg.OverfittingThresholdPercent,
+	}
+	encoding := service.CategoryEncoding{
+		UnseenPolicy:        features.UnseenPolicy(cfg.EncoderUnseenPolicy),
+		MinCount:            cfg.EncoderMinCount,
+		PredictUnseenPolicy: features.UnseenPolicy(cfg.PredictionUnseenPolicy),
+	}
+	// Golden set every loaded model version is checked against, to catch numeric drift between the
+	// builds of the replicas
+	var goldenSet *service.GoldenSet
+	if cfg.GoldenSetFile != "" {
+		cases, err := service.LoadGoldenCases(cfg.GoldenSetFile)
+		if err != nil {
+			logger.Errorw("Failed to load golden set", "error", err, "path", cfg.GoldenSetFile)
+			return err
+		}
+		goldenSet, err = service.NewGoldenSet(cases, cfg.GoldenSetTolerance, engine, cfg.InferenceEngine, fileRepo, postgresRepo, eventLog, l.Metrics, logger)
+		if err != nil {
+			logger.Errorw("Failed to initialize golden set", "error", err, "path", cfg.GoldenSetFile)
+			return err
+		}
+		logger.Infow("Golden set loaded", "path", cfg.GoldenSetFile, "cases", len(cases), "tolerance", cfg.GoldenSetTolerance)
+	}
+	l.GoldenSet = goldenSet
+	// Warm standby slot newly trained models are shadow-tested in before promotion
+	shadowPolicy := service.ShadowPolicy{
+		Percent:              cfg.ShadowPercent,
+		MinSamples:           cfg.ShadowMinSamples,
+		MaxErrorPercent:      cfg.ShadowMaxErrorPercent,
+		MaxDivergencePercent: cfg.ShadowMaxDivergencePercent,
+	}
+	standbyModel := service.NewStandbyModel(fileRepo, postgresRepo, artifactStore, engine, modelCheck, shadowPolicy, lifecycle, eventLog, goldenSet, logger)
+	if shadowPolicy.Enabled() && !standbyModel.Enabled() {
+		logger.Warnw("SHADOW_PERCENT is set but the inference engine cannot run standby models, new models are installed directly",
+			"inference_engine", cfg.InferenceEngine)
+	}
+	l.StandbyModel = standbyModel
+	// Disk usage of the service directories, checked before every training run
+	diskMonitor := service.NewDiskMonitor(fileRepo, service.DiskPolicy{
+		MinFreeBytes:      uint64(cfg.DiskMinFreeBytes),
+		StaleAfter:        cfg.DiskLeakAge,
+		ArtifactStorePath: cfg.ArtifactStorePath,
+	}, cfg.DiskCheckInterval, l.Metrics, logger)
+	l.DiskMonitor = diskMonitor
+	mlService := service.NewMLPredictionService(service.MLPredictionDeps{
+		FileRepo:       fileRepo,
+		Store:          postgresRepo,
+		ArtifactStore:  artifactStore,
+		Engine:         engine,
+		ModelCheck:     modelCheck,
+		Providers:      featureProviders,
+		ProcessMetrics: processMetrics,
+		Events:         eventLog,
+		Standby:        standbyModel,
+		Golden:         goldenSet,
+		Disk:           diskMonitor,
 
-	// Initialize controllers
-	predictionController := controller.NewPredictionAPIController(mlService, logger)
+		Staleness:           staleness,
+		Horizon:             horizon,
+		Lags:                lags,
+		Window:              window,
+		Quota:               quota,
+		Overfitting:         overfitting,
+		Encoding:            encoding,
+		Fallback:            service.FallbackChain(cfg.PredictionFallbackChain),
+		Targets:             cfg.PredictionTargets,
+		TrainingLogMaxBytes: cfg.TrainingLogMaxBytes,
+	}, logger)
+	l.MLPredictionService = mlService
+
+	// Catalog-wide jobs share one worker pool so that together they can't starve interactive traffic
+	workerPool := service.NewWorkerPool(cfg.WorkerPoolSize, map[string]int{
+		service.WorkloadSimulation:     cfg.SimulationWorkers,
+		service.WorkloadBatch:          cfg.BatchWorkers,
+		service.WorkloadReconciliation: cfg.ReconciliationWorkers,
+		service.WorkloadBacktest:       cfg.BacktestWorkers,
+	}, featureFlags)
+	l.WorkerPool = workerPool
+
+	// Services behind the API only
+	if l.ServesAPI() {
+		resultFiles := service.NewResultFiles(l.ResultStore, cfg.ResultURLSecret, cfg.ResultURLTTL, cfg.PublicBaseURL)
+		l.ResultFiles = resultFiles
+		l.SimulationService = service.NewSimulationService(mlService, postgresRepo, resultFiles, workerPool, cfg.SimulationMaxScenarios, cfg.SimulationTimeout, lifecycle, logger)
+
+		callbackPolicy := outboundPolicy(cfg.BatchCallbackTimeout, cfg.BatchCallbackMaxAttempts, cfg.BatchCallbackInitialBackoff, cfg.BatchCallbackMaxBackoff)
+		callbackPolicy.NoRedirects = true
+		callbackPolicy.PublicOnly = len(cfg.BatchCallbackAllowedHosts) == 0
+		callbackSender := service.NewCallbackSender(service.CallbackPolicy{
+			Secret:       cfg.BatchCallbackSecret,
+			AllowedHosts: cfg.BatchCallbackAllowedHosts,
+		}, httpclient.New("batch_callback", callbackPolicy, outboundMetrics, logger))
+		l.AsyncBatchService = service.NewAsyncBatchService(mlService, postgresRepo, callbackSender, resultFiles, workerPool, cfg.BatchTimeout,
+			cfg.BatchCallbackMaxInlineBytes, cfg.PublicBaseURL, lifecycle, logger)
+
+		forecastService := service.NewForecastService(postgresRepo, evaluation.MetricSet(cfg.EvaluationMetrics), logger)
+		l.ForecastService = forecastService
+		l.ReportService = service.NewReportService(postgresRepo, forecastService, fileRepo, evaluation.MetricSet(cfg.EvaluationMetrics), logger)
+		l.RecommendationService = service.NewRecommendationService(mlService, postgresRepo, logger)
+
+		// Engine backends recorded predictions can be replayed against before a cutover
+		replayEngines := map[string]service.InferenceEngine{service.InferenceEnginePython: python()}
+		if cfg.ModelServerURL != "" {
+			replayEngines[service.InferenceEngineRemote] = service.NewRemoteInferenceEngine(cfg.ModelServerURL, cfg.ModelServerToken, modelServerClient)
+		}
+		replayEngines[cfg.InferenceEngine] = engine
+		l.Replayer = service.NewReplayer(mlService, replayEngines)
+		l.ForecastRecomputer = service.NewForecastRecomputer(mlService, postgresRepo, logger)
+	}
+
+	l.Backtester = service.NewBacktester(mlService, postgresRepo, workerPool, evaluation.MetricSet(cfg.EvaluationMetrics), service.BacktestConfig{
+		Origins:               cfg.BacktestOrigins,
+		MaxCases:              cfg.BacktestMaxCases,
+		AlertMetric:           cfg.BacktestAlertMetric,
+		AlertThresholdPercent: cfg.BacktestAlertThresholdPercent,
+	}, eventLog, logger)
+	// API replicas queue async training jobs and the workers run them
+	l.TrainingJobs = service.NewTrainingJobs(mlService, postgresRepo, cfg.TrainTimeout, cfg.TrainJobPollInterval, cfg.TrainJobMaxAttempts, lifecycle, logger)
+	l.APIUsage = service.NewAPIUsage(postgresRepo, cfg.APIUsageFlushInterval, cfg.APIUsageRetentionDays, logger)
+	l.AuditLog = service.NewAuditLog(postgresRepo, logger)
+
+	checks := map[string]service.DependencyCheck{
+		"postgres":         postgresRepo.Ping,
+		"inference_engine": engine.Health,
+	}
+	if l.PythonEnvironment != nil {
+		checks["python_env"] = l.PythonEnvironment.Check
+	}
+	if goldenSet != nil {
+		checks[service.CheckGoldenSet] = goldenSet.Check
+	}
+	checks[service.CheckDiskSpace] = diskMonitor.Check
+	if l.RabbitMQClient != nil {
+		rabbitMQClient := l.RabbitMQClient
+		checks["rabbitmq"] = func(ctx context.Context) error {
+			return rabbitMQClient.Healthy()
+		}
+		if cfg.RabbitMQMaxLag > 0 {
+			checks[service.CheckConsumerLag] = func(ctx context.Context) error {
+				return rabbitMQClient.CheckLag(cfg.RabbitMQMaxLag)
+			}
+		}
+	}
+	l.HTTPMetrics = metrics.NewHTTPMetrics(l.Metrics)
+	l.StatusService = service.NewStatusService(mlService, l.HTTPMetrics, cfg.InferenceEngine, checks, diskMonitor, lifecycle)
+
+	if artifactStore != nil {
+		l.ModelSynchronizer = service.NewModelSynchronizer(fileRepo, postgresRepo, artifactStore, engine, modelCheck, standbyModel, goldenSet, eventLog, cfg.ModelSyncInterval, logger)
+	}
+	return nil
+}
+
+// initJobs registers the background jobs on their cron schedules. An API replica registers none,
+// its scheduler only lists the runs recorded by the workers
+func (l *ServiceLocator) initJobs() error {
+	cfg, logger := l.Config, l.Logger
+	postgresRepo, mlService := l.PostgresRepository, l.MLPredictionService
+
+	scheduler := service.NewScheduler(postgresRepo, l.Lifecycle, logger)
+	l.Scheduler = scheduler
+	if !l.RunsWorkers() {
+		return nil
+	}
+
+	forecastActualsUpdater := service.NewForecastActualsUpdater(postgresRepo, l.WorkerPool, evaluation.MetricSet(cfg.EvaluationMetrics), logger)
+	sellerStatsRefresher := service.NewSellerStatsRefresher(postgresRepo, cfg.SellerStatsWindowDays, logger)
+	retrainThresholds := service.RetrainThresholds{
+		MinNewRows:        int64(cfg.RetrainMinNewRows),
+		MinNewRowsPercent: cfg.RetrainMinNewRowsPercent,
+	}
+	retrainTrigger := service.NewRetrainTrigger(mlService, postgresRepo, retrainThresholds, cfg.TrainTimeout, logger)
+
+	jobs := []struct {
+		name     string
+		schedule config.JobSchedule
+		enabled  bool
+		params   any
+		fn       service.JobFunc
+	}{
+		{service.JobRetrain, cfg.RetrainJob, cfg.RetrainJob.Enabled,
+			map[string]string{"timeout": cfg.TrainTimeout.String()},
+			func(ctx context.Context) error {
+				trainCtx, cancel := context.WithTimeout(ctx, cfg.TrainTimeout)
+				defer cancel()
+				_, err := mlService.TrainModels(trainCtx)
+				return err
+			}},
+		{service.JobReconciliation, cfg.ReconciliationJob, cfg.ReconciliationJob.Enabled, nil, forecastActualsUpdater.Update},
+		// The trigger only has work to do once a threshold is configured
+		{service.JobRetrainTrigger, cfg.RetrainTriggerJob, cfg.RetrainTriggerJob.Enabled && retrainThresholds.Enabled(),
+			map[string]any{
+				"min_new_rows":         cfg.RetrainMinNewRows,
+				"min_new_rows_percent": cfg.RetrainMinNewRowsPercent,
+				"timeout":              cfg.TrainTimeout.String(),
+			},
+			retrainTrigger.Check},
+		{service.JobSellerStats, cfg.SellerStatsJob, cfg.SellerStatsJob.Enabled,
+			map[string]int{"window_days": cfg.SellerStatsWindowDays},
+			sellerStatsRefresher.Refresh},
+		{service.JobBacktest, cfg.BacktestJob, cfg.BacktestJob.Enabled,
+			map[string]any{
+				"origins":                 cfg.BacktestOrigins,
+				"max_cases":               cfg.BacktestMaxCases,
+				"alert_metric":            cfg.BacktestAlertMetric,
+				"alert_threshold_percent": cfg.BacktestAlertThresholdPercent,
+			},
+			l.Backtester.Run},
+		{service.JobUsageRollup, cfg.UsageRollupJob, cfg.UsageRollupJob.Enabled,
+			map[string]int{"retention_days": cfg.APIUsageRetentionDays},
+			l.APIUsage.Rollup},
+		{service.JobStandbyPromotion, cfg.StandbyPromotionJob, cfg.StandbyPromotionJob.Enabled,
+			map[string]any{
+				"min_samples":            cfg.ShadowMinSamples,
+				"max_error_percent":      cfg.ShadowMaxErrorPercent,
+				"max_divergence_percent": cfg.ShadowMaxDivergencePercent,
+			},
+			l.StandbyModel.Evaluate},
+	}
+	for _, job := range jobs {
+		if err := scheduler.Register(job.name, job.schedule.Cron, job.enabled, job.params, job.fn); err != nil {
+			logger.Errorw("Failed to register scheduled job", "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// initHTTP creates the HTTP server: the API on API replicas, the probes, metrics and job
+// administration on workers, and the preStop hook on both
+func (l *ServiceLocator) initHTTP(o *options) {
+	cfg := l.Config
 
 	// Initialize Gin router
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
+	if l.ServesAPI() {
+		l.registerAPI(router, o)
+	} else {
+		l.registerWorkerAPI(router, o)
+	}
+	l.LifecycleController = controller.NewLifecycleAPIController(l.Lifecycle, l.AuditLog, cfg.DrainTimeout, cfg.PreStopDelay, l.Logger)
+	l.LifecycleController.RegisterRoutes(router)
+
+	// Create HTTP server; requests still running at the end of the shutdown grace period are
+	// cancelled with the background jobs
+	l.Router = router
+	l.HTTPServer = &http.Server{
+		Addr:              ":" + cfg.ServerPort,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return l.Lifecycle.Context()
+		},
+	}
+}
+
+// registerAPI creates the controllers and registers their routes behind the middleware chain of the
+// options
+func (l *ServiceLocator) registerAPI(router *gin.Engine, o *options) {
+	cfg, logger := l.Config, l.Logger
+
+	slos := make([]metrics.SLO, 0, len(cfg.SLOs))
+	for _, slo := range cfg.SLOs {
+		slos = append(slos, metrics.SLO{
+			Name:               slo.Name,
+			Routes:             slo.Routes,
+			LatencyThreshold:   slo.LatencyThreshold,
+			LatencyTarget:      slo.LatencyTarget / 100,
+			AvailabilityTarget: slo.AvailabilityTarget / 100,
+		})
+	}
+	sloTracker := metrics.NewSLOTracker(l.Metrics, slos)
 
-	// Configure CORS middleware
-	corsConfig := cors.DefaultConfig()
-	corsConfig.AllowOrigins = []string{"http://localhost"}
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
-	router.Use(cors.New(corsConfig))
+	// Initialize controllers
+	deprecations := controller.NewDeprecationTracker(l.Metrics)
+	l.PredictionController = controller.NewPredictionAPIController(l.MLPredictionService, l.TrainingJobs, cfg.PredictTimeout, cfg.TrainTimeout, cfg.APIV1Sunset, deprecations, l.AuditLog, logger)
+	l.PredictionV2Controller = controller.NewPredictionAPIV2Controller(l.MLPredictionService, l.AsyncBatchService, l.FeatureFlags, cfg.PredictTimeout, cfg.BatchMaxItems, logger)
+	l.SimulationController = controller.NewSimulationAPIController(l.SimulationService, logger)
+	l.ReportController = controller.NewReportAPIController(l.ReportService, logger)
+	l.RecommendationController = controller.NewRecommendationAPIController(l.RecommendationService, cfg.PredictTimeout, logger)
+	l.ModelController = controller.NewModelAPIController(l.MLPredictionService, l.StandbyModel, l.GoldenSet, l.ModelSynchronizer, l.AuditLog, logger)
+	l.StatusController = controller.NewStatusAPIController(l.StatusService, logger)
+	l.ForecastController = controller.NewForecastAPIController(l.ForecastService, l.ForecastRecomputer, cfg.BatchTimeout, l.AuditLog, logger)
+	l.BacktestController = controller.NewBacktestAPIController(l.Backtester, logger)
+	l.AdminController = controller.NewAdminAPIController(deprecations, l.Lifecycle, l.Scheduler, l.AuditLog, sloTracker, l.FeatureFlags, l.QueueWeights, l.APIUsage, l.Replayer, logger)
+	l.JobController = controller.NewJobAPIController(l.Scheduler, logger)
+	l.ResultController = controller.NewResultAPIController(l.ResultFiles, logger)
+	l.EventController = controller.NewEventAPIController(l.EventLog, logger)
+	l.PromotionController = controller.NewPromotionAPIController(l.Promotions, logger)
+	l.ProductController = controller.NewProductAPIController(l.ProductCatalog, logger)
+
+	// Configure the middleware chain, in the order documented on options
+	if o.tracing != nil {
+		router.Use(o.tracing)
+	}
+	if o.cors != nil {
+		router.Use(cors.New(*o.cors))
+	}
+	if o.metrics {
+		router.Use(controller.RequestMetrics(l.HTTPMetrics, sloTracker))
+	}
+	if o.usage {
+		router.Use(controller.TrackUsage(l.APIUsage))
+	}
+	if o.auth != nil {
+		router.Use(o.auth)
+	}
+	if o.rateLimit != nil {
+		router.Use(o.rateLimit)
+	}
+	router.Use(o.middlewares...)
 
 	// Register routes
-	predictionController.RegisterRoutes(router)
-
-	// Create HTTP server
-	httpServer := &http.Server{
-		Addr:    ":" + cfg.ServerPort,
-		Handler: router,
-	}
-
-	return &ServiceLocator{
-		Config:               cfg,
-		Logger:               logger,
-		FileRepository:       fileRepo,
-		PostgresRepository:   postgresRepo,
-		MLPredictionService:  mlService,
-		PredictionController: predictionController,
-		HTTPServer:           httpServer,
-		Router:               router,
-	}, nil
+	router.GET("/metrics", gin.WrapH(l.Metrics.Handler()))
+	l.PredictionController.RegisterRoutes(router)
+	l.PredictionV2Controller.RegisterRoutes(router)
+	l.SimulationController.RegisterRoutes(router)
+	l.ReportController.RegisterRoutes(router)
+	l.RecommendationController.RegisterRoutes(router)
+	l.ModelController.RegisterRoutes(router)
+	l.StatusController.RegisterRoutes(router)
+	l.ForecastController.RegisterRoutes(router)
+	l.BacktestController.RegisterRoutes(router)
+	l.AdminController.RegisterRoutes(router)
+	l.JobController.RegisterRoutes(router)
+	l.ResultController.RegisterRoutes(router)
+	l.EventController.RegisterRoutes(router)
+	l.PromotionController.RegisterRoutes(router)
+	l.ProductController.RegisterRoutes(router)
+	if chaos.Enabled {
+		if cfg.ChaosToken != "" {
+			controller.NewChaosAPIController(cfg.ChaosToken, l.AuditLog, logger).RegisterRoutes(router)
+			logger.Warnw("Chaos build: dependency faults can be injected through /api/v1/admin/chaos")
+		} else {
+			logger.Warnw("Chaos build without CHAOS_TOKEN, the fault injection API is disabled")
+		}
+	}
+}
+
+// registerWorkerAPI registers the routes of a worker: the probes and metrics, and behind the
+// authentication of the options the lame-duck mode, the scheduled jobs and their history, since the
+// jobs run on workers only
+func (l *ServiceLocator) registerWorkerAPI(router *gin.Engine, o *options) {
+	logger := l.Logger
+
+	l.StatusController = controller.NewStatusAPIController(l.StatusService, logger)
+	router.GET("/metrics", gin.WrapH(l.Metrics.Handler()))
+	l.StatusController.RegisterRoutes(router)
+
+	var handlers []gin.HandlerFunc
+	if o.auth != nil {
+		handlers = append(handlers, o.auth)
+	}
+	admin := router.Group("/", handlers...)
+	// Workers serve none of the other admin routes, so their dependencies are left out
+	l.AdminController = controller.NewAdminAPIController(nil, l.Lifecycle, l.Scheduler, l.AuditLog, nil, l.FeatureFlags, l.QueueWeights, l.APIUsage, nil, logger)
+	l.AdminController.RegisterJobRoutes(admin)
+	l.JobController = controller.NewJobAPIController(l.Scheduler, logger)
+	l.JobController.RegisterRoutes(admin)
 }
 
 // Close closes all resources
@@ -80,4 +790,9 @@ func (l *ServiceLocator) Close() {
 			l.Logger.Errorw("Error closing PostgreSQL connection", "error", err)
 		}
 	}
+
+	// Close RabbitMQ connection if it exists
+	if l.RabbitMQClient != nil {
+		l.RabbitMQClient.Close()
+	}
 }
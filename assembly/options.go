@@ -0,0 +1,118 @@
+package assembly
+
+import (
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+)
+
+// Option customizes the components and the HTTP server NewServiceLocator assembles
+type Option func(*options)
+
+// options holds the components substituted for the configured ones and the middleware chain of
+// the router. Middleware runs in this order before the routes: tracing, CORS, request metrics,
+// usage tracking, authentication, rate limiting and the custom middleware, so that spans cover the
+// whole request, preflight requests are answered before authentication, and rejected requests are
+// still counted
+type options struct {
+	postgresRepo Database
+	engine       service.InferenceEngine
+
+	tracing     gin.HandlerFunc
+	cors        *cors.Config
+	metrics     bool
+	usage       bool
+	auth        gin.HandlerFunc
+	rateLimit   gin.HandlerFunc
+	middlewares []gin.HandlerFunc
+}
+
+// defaultOptions are the components of the configuration and the chain of the service binary:
+// CORS for http://localhost, request metrics and SLOs, and usage tracking
+func defaultOptions() *options {
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowOrigins = []string{"http://localhost"}
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "X-API-Key"}
+	return &options{
+		cors:    &corsConfig,
+		metrics: true,
+		usage:   true,
+	}
+}
+
+// WithPostgresRepository uses repo instead of connecting to the database of the configuration, e.g.
+// a repository over a test database made with repository.NewPostgresRepositoryFromDB, or a fake
+// implementing Database. The schema is still applied to it, and the locator closes it
+func WithPostgresRepository(repo Database) Option {
+	return func(o *options) {
+		o.postgresRepo = repo
+	}
+}
+
+// WithInferenceEngine serves predictions with engine instead of the one INFERENCE_ENGINE selects,
+// e.g. a fake returning canned predictions
+func WithInferenceEngine(engine service.InferenceEngine) Option {
+	return func(o *options) {
+		o.engine = engine
+	}
+}
+
+// WithCORS replaces the CORS configuration
+func WithCORS(config cors.Config) Option {
+	return func(o *options) {
+		o.cors = &config
+	}
+}
+
+// WithoutCORS serves without CORS headers, e.g. behind a gateway that adds them
+func WithoutCORS() Option {
+	return func(o *options) {
+		o.cors = nil
+	}
+}
+
+// WithMetrics turns the request metrics and SLO tracking on or off. Without them the SLO endpoint
+// and the request figures of the status endpoint stay empty
+func WithMetrics(enabled bool) Option {
+	return func(o *options) {
+		o.metrics = enabled
+	}
+}
+
+// WithUsageTracking turns the API usage analytics on or off
+func WithUsageTracking(enabled bool) Option {
+	return func(o *options) {
+		o.usage = enabled
+	}
+}
+
+// WithTracing runs a tracing middleware first, so that its spans cover the rest of the chain
+func WithTracing(handler gin.HandlerFunc) Option {
+	return func(o *options) {
+		o.tracing = handler
+	}
+}
+
+// WithAuth authenticates every request with handler, which aborts the requests it rejects. It runs
+// on every route, the /ready probe included, so it has to let the probe through
+func WithAuth(handler gin.HandlerFunc) Option {
+	return func(o *options) {
+		o.auth = handler
+	}
+}
+
+// WithRateLimit limits requests with handler, after authentication so that limits can be set per
+// authenticated client
+func WithRateLimit(handler gin.HandlerFunc) Option {
+	return func(o *options) {
+		o.rateLimit = handler
+	}
+}
+
+// WithMiddleware appends middleware to the end of the chain, in order
+func WithMiddleware(handlers ...gin.HandlerFunc) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, handlers...)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/bench"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+)
+
+// benchRequest is the /api/v1/predict body sent when no --body file is given
+var benchRequest = service.PredictionRequest{
+	ProductName:               "Джинсы Lee Rider",
+	Brand:                     "Lee",
+	Category:                  "Одежда",
+	Region:                    "Москва",
+	Seller:                    "АО «Шарапов»",
+	Price:                     7500,
+	OriginalPrice:             7500,
+	StockLevel:                229,
+	CustomerRating:            4.5,
+	ReviewCount:               408,
+	DeliveryDays:              1,
+	DayOfWeek:                 3,
+	Month:                     3,
+	Quarter:                   1,
+	SalesQuantityLag1:         11,
+	PriceLag1:                 9700,
+	SalesQuantityLag3:         10,
+	PriceLag3:                 8590,
+	SalesQuantityLag7:         26,
+	PriceLag7:                 6320,
+	SalesQuantityRollingMean3: 7,
+	PriceRollingMean3:         7543,
+	SalesQuantityRollingMean7: 10.714,
+	PriceRollingMean7:         7396.14,
+}
+
+// runBench implements "ml-service bench": it sends predictions to a running service at a fixed
+// rate, prints the latency distribution and optionally fails when it regressed from a baseline
+// report. It returns the process exit code
+func runBench(args []string) int {
+	port := os.Getenv("SERVER_PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	url := flags.String("url", "http://localhost:"+port+"/api/v1/predict", "endpoint to send requests to")
+	bodyFile := flags.String("body", "", "file with the JSON request body (default: a sample /api/v1/predict request)")
+	rps := flags.Float64("rps", 10, "requests started per second")
+	duration := flags.Duration("duration", 30*time.Second, "how long to send requests for")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of each request")
+	maxInFlight := flags.Int("max-in-flight", 1000, "requests waiting for an answer before new ones are dropped")
+	apiKey := flags.String("api-key", "", "X-API-Key header, which identifies the client to feature flag rollouts")
+	label := flags.String("label", "", "label stored in the report, such as the engine or commit")
+	out := flags.String("out", "", "file to write the JSON report to")
+	baselineFile := flags.String("baseline", "", "report of an earlier run to compare with")
+	maxRegression := flags.Float64("max-regression", 0.1, "allowed latency increase over the baseline as a fraction, and error rate increase in points")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	body, err := json.Marshal(benchRequest)
+	if *bodyFile != "" {
+		body, err = os.ReadFile(*bodyFile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read request body: %v\n", err)
+		return 1
+	}
+
+	var baseline *bench.Report
+	if *baselineFile != "" {
+		baseline, err = readBenchReport(*baselineFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read baseline: %v\n", err)
+			return 1
+		}
+	}
+
+	headers := map[string]string{}
+	if *apiKey != "" {
+		headers["X-API-Key"] = *apiKey
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Sending %g requests per second to %s for %s\n", *rps, *url, *duration)
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *maxInFlight}}
+	report, err := bench.Run(ctx, client, bench.Options{
+		URL:         *url,
+		Method:      http.MethodPost,
+		Body:        body,
+		Headers:     headers,
+		RPS:         *rps,
+		Duration:    *duration,
+		Timeout:     *timeout,
+		MaxInFlight: *maxInFlight,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Load test failed: %v\n", err)
+		return 1
+	}
+	report.Label = *label
+
+	printBenchReport(os.Stdout, report)
+	if *out != "" {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(*out, append(data, '\n'), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+			return 1
+		}
+	}
+
+	if baseline == nil {
+		return 0
+	}
+	regressions := bench.Compare(baseline, report, *maxRegression)
+	if len(regressions) == 0 {
+		fmt.Printf("\nNo regression against %s beyond %g\n", *baselineFile, *maxRegression)
+		return 0
+	}
+	fmt.Printf("\nRegressions against %s:\n", *baselineFile)
+	for _, regression := range regressions {
+		fmt.Printf("  %s\n", regression)
+	}
+	return 1
+}
+
+func readBenchReport(path string) (*bench.Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report bench.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &report, nil
+}
+
+func printBenchReport(w io.Writer, report *bench.Report) {
+	fmt.Fprintf(w, "\nRequests:  %d sent, %d succeeded, %d failed, %d dropped\n",
+		report.Requests, report.Succeeded, report.Failed, report.Dropped)
+	fmt.Fprintf(w, "Rate:      %.1f/s achieved of %g/s\n", report.AchievedRPS, report.TargetRPS)
+	fmt.Fprintf(w, "Statuses: ")
+	statuses := make([]string, 0, len(report.Statuses))
+	for status := range report.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, " %s=%d", status, report.Statuses[status])
+	}
+	fmt.Fprintln(w)
+
+	latency := report.Latency
+	fmt.Fprintf(w, "Latency:   min %.1fms  mean %.1fms  p50 %.1fms  p90 %.1fms  p95 %.1fms  p99 %.1fms  max %.1fms\n",
+		latency.Min, latency.Mean, latency.P50, latency.P90, latency.P95, latency.P99, latency.Max)
+	for _, bucket := range report.Histogram {
+		if bucket.Count > 0 {
+			fmt.Fprintf(w, "  <= %6s ms  %d\n", bucket.LE, bucket.Count)
+		}
+	}
+}
@@ -1,10 +1,15 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/evaluation"
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
 )
 
 type Config struct {
@@ -12,7 +17,9 @@ type Config struct {
 	ModelPath         string
 	ProcessedDataPath string
 	ServerPort        string
-	SchedulerInterval time.Duration
+	// Components run by the replica: api serves HTTP, worker consumes the ingestion paths and runs
+	// the background jobs, all does both
+	RunMode string
 
 	// PostgreSQL configuration
 	PostgresHost     string
@@ -21,6 +28,248 @@ type Config struct {
 	PostgresPassword string
 	PostgresDBName   string
 	PostgresSSLMode  string
+
+	// Retry policy for transient database errors
+	DBRetryMaxAttempts    int
+	DBRetryInitialBackoff time.Duration
+	DBRetryMaxBackoff     time.Duration
+
+	// RabbitMQ configuration (optional, the broker is skipped when empty)
+	RabbitMQURL string
+	// HMAC message signing: the producer name this service signs with, the shared secret of every
+	// producer whose messages are accepted (signing is off when empty), and the age past which a
+	// signature is rejected as a replay (0 accepts any age, since a backlog ages in the queue)
+	RabbitMQProducerID      string
+	RabbitMQSigningKeys     map[string][]byte
+	RabbitMQSignatureMaxAge time.Duration
+	// How often the lag of consumed queues is measured (0 disables the measurement), and the lag above
+	// which the replica is not ready (0 ignores it)
+	RabbitMQLagInterval time.Duration
+	RabbitMQMaxLag      int
+	// Ingestion queues consumed in weighted turns with their default weights, overridden at runtime
+	// by weights stored in the database, and the unacknowledged messages the broker sends per queue
+	RabbitMQQueueWeights       map[string]int
+	RabbitMQPrefetch           int
+	QueueWeightRefreshInterval time.Duration
+
+	// Ingestion from the Postgres outbox table, for producers that cannot publish to RabbitMQ reliably
+	OutboxEnabled      bool
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+	OutboxMaxAttempts  int
+
+	// Maximum time to wait for dependencies to become reachable at startup
+	StartupWaitTimeout time.Duration
+
+	// How long the validation of the installed model artifacts is reused
+	ModelCheckTTL time.Duration
+
+	// Shared model artifact storage (optional, disables model distribution when empty)
+	ArtifactStorePath string
+	ModelSyncInterval time.Duration
+
+	// AES-256 key encrypting artifacts in the shared store (optional, artifacts are stored as-is when empty)
+	ArtifactEncryptionKey []byte
+
+	// HTTP server timeouts
+	HTTPReadHeaderTimeout time.Duration
+	HTTPReadTimeout       time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+
+	// Per-route handler timeouts
+	PredictTimeout time.Duration
+	TrainTimeout   time.Duration
+
+	// How often workers look for queued async training jobs, and how many times a job interrupted
+	// by the loss of its worker is started before it fails
+	TrainJobPollInterval time.Duration
+	TrainJobMaxAttempts  int
+
+	// Scenario simulation limits
+	SimulationMaxScenarios int
+	SimulationTimeout      time.Duration
+
+	// Maximum number of items in a batch prediction
+	BatchMaxItems int
+
+	// Async batch predictions: run timeout and signed callback delivery
+	BatchTimeout                time.Duration
+	BatchCallbackSecret         []byte
+	BatchCallbackAllowedHosts   []string
+	BatchCallbackMaxAttempts    int
+	BatchCallbackInitialBackoff time.Duration
+	BatchCallbackMaxBackoff     time.Duration
+	BatchCallbackTimeout        time.Duration
+	BatchCallbackMaxInlineBytes int
+
+	// Externally reachable address of the service, used in links handed out to clients
+	PublicBaseURL string
+
+	// Shared storage of large job outputs served through signed download links (optional, results
+	// are only served from the database when empty), the link signing secret and the link lifetime
+	ResultStorePath string
+	ResultURLSecret []byte
+	ResultURLTTL    time.Duration
+
+	// Maximum bytes of Python output stored per training run
+	TrainingLogMaxBytes int
+
+	// Maximum age in days of the latest history row before it is considered stale (0 disables the check)
+	HistoryMaxStalenessDays int
+	// Reject requests with stale history instead of warning about it
+	HistoryStrictMode bool
+	// Maximum days after the latest history row a minimal prediction may ask for (0 disables the limit)
+	PredictionMaxHorizonDays int
+
+	// How newly trained models count the days of lag features, "calendar" or "business", and the
+	// holiday calendar business days skip besides weekends
+	LagMode      string
+	HolidaysFile string
+	// How newly trained models fill days missing from the history: "none", "ffill" or "linear"
+	HistoryInterpolation string
+
+	// Prediction strategies tried in order until one answers: "global", "category" and "last_observed"
+	PredictionFallbackChain []string
+
+	// Rows of the training data new models learn from: "expanding" uses all of them, "sliding" the
+	// last TrainingWindowDays days
+	TrainingWindow     string
+	TrainingWindowDays int
+	// Soft quota on the training data: past TrainingMaxRows rows or a TrainingMaxBytes training file,
+	// the rows are downsampled within every category; 0 is no limit
+	TrainingMaxRows  int
+	TrainingMaxBytes int
+
+	// Space kept free on the data, model and temp volumes: a training run whose copies of the
+	// datasets and staged models would leave less is refused, and with 0 only runs that don't fit
+	// at all are. Run and staging directories older
+	// than DiskLeakAge count as leaked; the monitor measures everything every DiskCheckInterval
+	DiskMinFreeBytes  int
+	DiskCheckInterval time.Duration
+	DiskLeakAge       time.Duration
+
+	// Boosting rounds without a better validation score after which training stops, and how far in
+	// percent the validation RMSE of a model may exceed its training RMSE before the run is suspect
+	// and kept out of production (0 disables the check)
+	EarlyStoppingRounds         int
+	OverfittingThresholdPercent float64
+
+	// How newly trained models encode a category value they were not trained on: "missing",
+	// "other", "frequency" or "reject", and how many training rows a value needs to get a category
+	// of its own
+	EncoderUnseenPolicy string
+	EncoderMinCount     int
+	// How predictions encode a category value the installed models were not trained on, overriding
+	// the policy they were trained with; empty follows it
+	PredictionUnseenPolicy string
+
+	// Targets newly trained models predict: price and sales, followed by any extra targets whose
+	// <name>_target column the training data holds
+	PredictionTargets []string
+
+	// Error metrics reported for forecasts against their actuals: mae, rmse, mape, smape, wape, bias
+	EvaluationMetrics []string
+
+	// External feature providers merged into feature vectors, with the time allowed per call and
+	// how long their responses are cached
+	FeatureProviders        []FeatureProvider
+	FeatureProviderTimeout  time.Duration
+	FeatureProviderCacheTTL time.Duration
+
+	// Cron schedules of the background jobs
+	RetrainJob          JobSchedule
+	ReconciliationJob   JobSchedule
+	RetrainTriggerJob   JobSchedule
+	SellerStatsJob      JobSchedule
+	BacktestJob         JobSchedule
+	UsageRollupJob      JobSchedule
+	StandbyPromotionJob JobSchedule
+
+	// Date the v1 prediction routes are removed; zero while they are not deprecated
+	APIV1Sunset time.Time
+
+	// Retraining triggered by ingested volume; both thresholds at 0 disable it
+	RetrainMinNewRows        int
+	RetrainMinNewRowsPercent float64
+
+	// Days of processed data, up to its latest date, aggregated into seller stats
+	SellerStatsWindowDays int
+
+	// Weekly origins and products per origin of the backtest job, and how much worse than the
+	// average of the previous 4 runs its sales metric may get before an alert
+	BacktestOrigins               int
+	BacktestMaxCases              int
+	BacktestAlertMetric           string
+	BacktestAlertThresholdPercent float64
+
+	// How often each replica stores the API usage it counted, and how many days of hourly usage
+	// the usage_rollup job keeps after rolling them up into daily usage
+	APIUsageFlushInterval time.Duration
+	APIUsageRetentionDays int
+
+	// Warm standby of newly trained models: the percentage of live predictions mirrored to the
+	// standby version (0 installs new models directly), and what the standby_promotion job requires
+	// of its shadow predictions before promoting it: how many, the percentage that may fail, and how
+	// far in percent their mean may diverge from the predictions of the active version
+	ShadowPercent              float64
+	ShadowMinSamples           int
+	ShadowMaxErrorPercent      float64
+	ShadowMaxDivergencePercent float64
+
+	// Golden set of feature vectors run through every model version this replica loads, with the
+	// relative difference from the version's expected outputs it tolerates (no file disables it)
+	GoldenSetFile      string
+	GoldenSetTolerance float64
+
+	// Inference engine used to serve predictions
+	InferenceEngine string
+	// Maximum number of Python prediction processes running at once
+	PythonMaxConcurrency int
+	// Longest interactive predictions should wait for a Python process before background work yields slots
+	InferenceInteractiveSLO time.Duration
+
+	// Tasks of catalog-wide jobs run in parallel across all jobs, and per-job caps (0 uses the pool size)
+	WorkerPoolSize        int
+	SimulationWorkers     int
+	BatchWorkers          int
+	ReconciliationWorkers int
+	BacktestWorkers       int
+
+	// How a Python environment not matching requirements.txt is handled: strict, warn or off
+	PythonEnvCheck string
+
+	// How long running background jobs get to finish once the replica enters lame-duck mode, and
+	// how long the Python processes of the jobs cancelled after that get to exit before being killed
+	DrainTimeout           time.Duration
+	PythonTerminationGrace time.Duration
+	// Shortest time the preStop hook holds, so that the load balancer sees the replica not ready
+	PreStopDelay time.Duration
+
+	// Remote model server used by the remote inference engine. Failed calls are made up to
+	// ModelServerMaxAttempts times
+	ModelServerURL         string
+	ModelServerToken       string
+	ModelServerTimeout     time.Duration
+	ModelServerMaxAttempts int
+
+	// Circuit breaker of the outbound HTTP clients: a host failing OutboundCircuitFailures requests
+	// in a row is not called for OutboundCircuitCooldown, 0 failures disables it
+	OutboundCircuitFailures int
+	OutboundCircuitCooldown time.Duration
+
+	// Latency of every call to the stub inference engine
+	StubEngineLatency time.Duration
+
+	// Service level objectives tracked from the request metrics
+	SLOs []SLO
+
+	// Feature flag defaults by name, overridden at runtime by settings stored in the database
+	FeatureFlags               map[string]FeatureFlag
+	FeatureFlagRefreshInterval time.Duration
+
+	// Token required by the fault injection API of binaries built with the chaos tag
+	ChaosToken string
 }
 
 func New() (*Config, error) {
@@ -48,20 +297,25 @@ func New() (*Config, error) {
 		serverPort = "8080"
 	}
 
-	// Scheduler interval (default: 24 hours)
-	var schedulerInterval time.Duration
-	intervalStr := os.Getenv("SCHEDULER_INTERVAL")
-	if intervalStr == "" {
-		schedulerInterval = 24 * time.Hour
-	} else {
-		intervalHours, err := strconv.Atoi(intervalStr)
-		if err != nil {
-			schedulerInterval = 24 * time.Hour
-		} else {
-			schedulerInterval = time.Duration(intervalHours) * time.Hour
-		}
+	// Run mode
+	runMode := os.Getenv("RUN_MODE")
+	switch runMode {
+	case "":
+		runMode = "all"
+	case "api", "worker", "all":
+	default:
+		return nil, fmt.Errorf("invalid RUN_MODE %q, expected api, worker or all", runMode)
 	}
 
+	// Scheduled jobs
+	retrainJob := getJobSchedule("RETRAIN", "0 3 * * *", false)
+	reconciliationJob := getJobSchedule("RECONCILIATION", "0 * * * *", true)
+	retrainTriggerJob := getJobSchedule("RETRAIN_TRIGGER", "*/15 * * * *", true)
+	sellerStatsJob := getJobSchedule("SELLER_STATS", "30 2 * * *", true)
+	backtestJob := getJobSchedule("BACKTEST", "0 4 * * 1", true)
+	usageRollupJob := getJobSchedule("USAGE_ROLLUP", "15 0 * * *", true)
+	standbyPromotionJob := getJobSchedule("STANDBY_PROMOTION", "*/10 * * * *", true)
+
 	// PostgreSQL configuration
 	postgresHost := os.Getenv("POSTGRES_HOST")
 	if postgresHost == "" {
@@ -93,18 +347,578 @@ func New() (*Config, error) {
 		postgresSSLMode = "disable"
 	}
 
+	// Database retry policy
+	dbRetryMaxAttempts := getEnvInt("DB_RETRY_MAX_ATTEMPTS", 3)
+	dbRetryInitialBackoff := getEnvDuration("DB_RETRY_INITIAL_BACKOFF", 100*time.Millisecond)
+	dbRetryMaxBackoff := getEnvDuration("DB_RETRY_MAX_BACKOFF", 2*time.Second)
+
+	// RabbitMQ connection URL
+	rabbitMQURL := os.Getenv("RABBITMQ_URL")
+	rabbitMQProducerID := os.Getenv("RABBITMQ_PRODUCER_ID")
+	rabbitMQSigningKeys, err := getSigningKeys("RABBITMQ_SIGNING_KEYS")
+	if err != nil {
+		return nil, err
+	}
+	if rabbitMQProducerID != "" && rabbitMQSigningKeys[rabbitMQProducerID] == nil {
+		return nil, fmt.Errorf("RABBITMQ_PRODUCER_ID %q has no key in RABBITMQ_SIGNING_KEYS", rabbitMQProducerID)
+	}
+	rabbitMQSignatureMaxAge := getEnvDuration("RABBITMQ_SIGNATURE_MAX_AGE", 0)
+	if rabbitMQSignatureMaxAge < 0 {
+		return nil, fmt.Errorf("invalid RABBITMQ_SIGNATURE_MAX_AGE %s, expected 0 or a positive duration", rabbitMQSignatureMaxAge)
+	}
+	rabbitMQLagInterval := getEnvDuration("RABBITMQ_LAG_CHECK_INTERVAL", 15*time.Second)
+	if rabbitMQLagInterval < 0 {
+		return nil, fmt.Errorf("invalid RABBITMQ_LAG_CHECK_INTERVAL %s, expected 0 or a positive duration", rabbitMQLagInterval)
+	}
+	rabbitMQMaxLag := getEnvInt("RABBITMQ_MAX_CONSUMER_LAG", 0)
+	if rabbitMQMaxLag < 0 {
+		return nil, fmt.Errorf("invalid RABBITMQ_MAX_CONSUMER_LAG %d, expected 0 or more", rabbitMQMaxLag)
+	}
+	rabbitMQQueueWeights, err := getQueueWeights("RABBITMQ_QUEUE_WEIGHTS")
+	if err != nil {
+		return nil, err
+	}
+	rabbitMQPrefetch := getEnvInt("RABBITMQ_PREFETCH", 10)
+	if rabbitMQPrefetch < 1 {
+		return nil, fmt.Errorf("invalid RABBITMQ_PREFETCH %d, expected at least 1", rabbitMQPrefetch)
+	}
+	queueWeightRefreshInterval := getEnvDuration("QUEUE_WEIGHT_REFRESH_INTERVAL", 10*time.Second)
+	if queueWeightRefreshInterval <= 0 {
+		return nil, fmt.Errorf("invalid QUEUE_WEIGHT_REFRESH_INTERVAL %s, expected a positive duration", queueWeightRefreshInterval)
+	}
+
+	// Outbox ingestion
+	outboxEnabled := os.Getenv("OUTBOX_ENABLED") == "true"
+	outboxPollInterval := getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second)
+	if outboxPollInterval <= 0 {
+		return nil, fmt.Errorf("invalid OUTBOX_POLL_INTERVAL %s, expected a positive duration", outboxPollInterval)
+	}
+	outboxBatchSize := getEnvInt("OUTBOX_BATCH_SIZE", 100)
+	if outboxBatchSize < 1 {
+		return nil, fmt.Errorf("invalid OUTBOX_BATCH_SIZE %d, expected at least 1", outboxBatchSize)
+	}
+	outboxMaxAttempts := getEnvInt("OUTBOX_MAX_ATTEMPTS", 5)
+	if outboxMaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid OUTBOX_MAX_ATTEMPTS %d, expected at least 1", outboxMaxAttempts)
+	}
+
+	// Startup dependency wait
+	startupWaitTimeout := getEnvDuration("STARTUP_WAIT_TIMEOUT", 60*time.Second)
+
+	// Model distribution between replicas
+	artifactStorePath := os.Getenv("ARTIFACT_STORE_PATH")
+	modelSyncInterval := getEnvDuration("MODEL_SYNC_INTERVAL", 10*time.Second)
+	if modelSyncInterval <= 0 {
+		return nil, fmt.Errorf("invalid MODEL_SYNC_INTERVAL %s, expected a positive duration", modelSyncInterval)
+	}
+	modelCheckTTL := getEnvDuration("MODEL_CHECK_TTL", time.Minute)
+
+	// Artifact encryption at rest; the key file variant suits keys mounted by a secrets manager or KMS agent
+	artifactEncryptionKey, err := getEncryptionKey("ARTIFACT_ENCRYPTION_KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	// HTTP server and handler timeouts
+	predictTimeout := getEnvDuration("PREDICT_TIMEOUT", 30*time.Second)
+	trainTimeout := getEnvDuration("TRAIN_TIMEOUT", 30*time.Minute)
+	httpReadHeaderTimeout := getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second)
+	httpReadTimeout := getEnvDuration("HTTP_READ_TIMEOUT", 30*time.Second)
+	// The write timeout must outlive the slowest handler, otherwise its response is dropped
+	httpWriteTimeout := getEnvDuration("HTTP_WRITE_TIMEOUT", trainTimeout+30*time.Second)
+	httpIdleTimeout := getEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second)
+
+	// Async training jobs
+	trainJobPollInterval := getEnvDuration("TRAIN_JOB_POLL_INTERVAL", 5*time.Second)
+	if trainJobPollInterval <= 0 {
+		return nil, fmt.Errorf("invalid TRAIN_JOB_POLL_INTERVAL %s, expected a positive duration", trainJobPollInterval)
+	}
+	trainJobMaxAttempts := getEnvInt("TRAIN_JOB_MAX_ATTEMPTS", 3)
+	if trainJobMaxAttempts < 1 {
+		return nil, fmt.Errorf("invalid TRAIN_JOB_MAX_ATTEMPTS %d, expected at least 1", trainJobMaxAttempts)
+	}
+
+	// Scenario simulations
+	simulationMaxScenarios := getEnvInt("SIMULATION_MAX_SCENARIOS", 100000)
+	simulationTimeout := getEnvDuration("SIMULATION_TIMEOUT", 30*time.Minute)
+
+	// Batch predictions
+	batchMaxItems := getEnvInt("BATCH_MAX_ITEMS", 1000)
+	batchTimeout := getEnvDuration("BATCH_TIMEOUT", 30*time.Minute)
+	batchCallbackSecret := []byte(os.Getenv("BATCH_CALLBACK_SECRET"))
+	var batchCallbackAllowedHosts []string
+	for _, host := range strings.Split(os.Getenv("BATCH_CALLBACK_ALLOWED_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			batchCallbackAllowedHosts = append(batchCallbackAllowedHosts, host)
+		}
+	}
+	batchCallbackMaxAttempts := getEnvInt("BATCH_CALLBACK_MAX_ATTEMPTS", 5)
+	batchCallbackInitialBackoff := getEnvDuration("BATCH_CALLBACK_INITIAL_BACKOFF", time.Second)
+	batchCallbackMaxBackoff := getEnvDuration("BATCH_CALLBACK_MAX_BACKOFF", time.Minute)
+	batchCallbackTimeout := getEnvDuration("BATCH_CALLBACK_TIMEOUT", 10*time.Second)
+	batchCallbackMaxInlineBytes := getEnvInt("BATCH_CALLBACK_MAX_INLINE_BYTES", 1024*1024)
+
+	publicBaseURL := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if publicBaseURL == "" {
+		publicBaseURL = "http://localhost:" + serverPort
+	}
+
+	// Job result files and their download links
+	resultStorePath := os.Getenv("RESULT_STORE_PATH")
+	resultURLSecret := []byte(os.Getenv("RESULT_URL_SECRET"))
+	if resultStorePath != "" && len(resultURLSecret) == 0 {
+		return nil, fmt.Errorf("RESULT_URL_SECRET is required when RESULT_STORE_PATH is set")
+	}
+	resultURLTTL := getEnvDuration("RESULT_URL_TTL", 15*time.Minute)
+
+	// Training run history
+	trainingLogMaxBytes := getEnvInt("TRAINING_LOG_MAX_BYTES", 64*1024)
+
+	// Historical data staleness
+	historyMaxStalenessDays := getEnvInt("HISTORY_MAX_STALENESS_DAYS", 30)
+	historyStrictMode := os.Getenv("HISTORY_STRICT_MODE") == "true"
+	predictionMaxHorizonDays := getEnvInt("PREDICTION_MAX_HORIZON_DAYS", 30)
+	if predictionMaxHorizonDays < 0 {
+		return nil, fmt.Errorf("invalid PREDICTION_MAX_HORIZON_DAYS %d, expected 0 or more", predictionMaxHorizonDays)
+	}
+
+	// Lag features
+	lagMode := os.Getenv("LAG_MODE")
+	if lagMode == "" {
+		lagMode = "calendar"
+	}
+	if lagMode != "calendar" && lagMode != "business" {
+		return nil, fmt.Errorf("invalid LAG_MODE %q, expected calendar or business", lagMode)
+	}
+	holidaysFile := os.Getenv("HOLIDAYS_FILE")
+	historyInterpolation := os.Getenv("HISTORY_INTERPOLATION")
+	if historyInterpolation == "" {
+		historyInterpolation = "none"
+	}
+	if historyInterpolation != "none" && historyInterpolation != "ffill" && historyInterpolation != "linear" {
+		return nil, fmt.Errorf("invalid HISTORY_INTERPOLATION %q, expected none, ffill or linear", historyInterpolation)
+	}
+
+	// Prediction fallback chain
+	predictionFallbackChain, err := getFallbackChain("PREDICTION_FALLBACK_CHAIN", "global")
+	if err != nil {
+		return nil, err
+	}
+
+	// Training window
+	trainingWindow := os.Getenv("TRAINING_WINDOW")
+	if trainingWindow == "" {
+		trainingWindow = "expanding"
+	}
+	if trainingWindow != "expanding" && trainingWindow != "sliding" {
+		return nil, fmt.Errorf("invalid TRAINING_WINDOW %q, expected expanding or sliding", trainingWindow)
+	}
+	trainingWindowDays := getEnvInt("TRAINING_WINDOW_DAYS", 365)
+	if trainingWindowDays < 1 {
+		return nil, fmt.Errorf("invalid TRAINING_WINDOW_DAYS %d, expected at least 1", trainingWindowDays)
+	}
+	trainingMaxRows := getEnvInt("TRAINING_MAX_ROWS", 0)
+	trainingMaxBytes := getEnvInt("TRAINING_MAX_BYTES", 0)
+	if trainingMaxRows < 0 || trainingMaxBytes < 0 {
+		return nil, fmt.Errorf("invalid training quota: TRAINING_MAX_ROWS and TRAINING_MAX_BYTES must not be negative")
+	}
+
+	// Disk monitor
+	diskMinFreeBytes := getEnvInt("DISK_MIN_FREE_BYTES", 0)
+	if diskMinFreeBytes < 0 {
+		return nil, fmt.Errorf("invalid DISK_MIN_FREE_BYTES %d, expected at least 0", diskMinFreeBytes)
+	}
+	diskCheckInterval := getEnvDuration("DISK_CHECK_INTERVAL", time.Minute)
+	if diskCheckInterval <= 0 {
+		return nil, fmt.Errorf("invalid DISK_CHECK_INTERVAL %s, expected a positive duration", diskCheckInterval)
+	}
+	diskLeakAge := getEnvDuration("DISK_LEAK_AGE", 6*time.Hour)
+	if diskLeakAge <= 0 {
+		return nil, fmt.Errorf("invalid DISK_LEAK_AGE %s, expected a positive duration", diskLeakAge)
+	}
+
+	// Early stopping and overfitting check
+	earlyStoppingRounds := getEnvInt("EARLY_STOPPING_ROUNDS", 50)
+	if earlyStoppingRounds < 1 {
+		return nil, fmt.Errorf("invalid EARLY_STOPPING_ROUNDS %d, expected at least 1", earlyStoppingRounds)
+	}
+	overfittingThresholdPercent := getEnvFloat("OVERFITTING_THRESHOLD_PERCENT", 0)
+	if overfittingThresholdPercent < 0 {
+		return nil, fmt.Errorf("invalid OVERFITTING_THRESHOLD_PERCENT %g, expected 0 or more", overfittingThresholdPercent)
+	}
+
+	// Category encoders
+	encoderUnseenPolicy, err := features.ParseUnseenPolicy(os.Getenv("ENCODER_UNSEEN_POLICY"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ENCODER_UNSEEN_POLICY: %w", err)
+	}
+	encoderMinCount := getEnvInt("ENCODER_MIN_COUNT", 1)
+	if encoderMinCount < 1 {
+		return nil, fmt.Errorf("invalid ENCODER_MIN_COUNT %d, expected at least 1", encoderMinCount)
+	}
+	predictionUnseenPolicy := os.Getenv("PREDICTION_UNSEEN_POLICY")
+	if predictionUnseenPolicy != "" {
+		if _, err := features.ParseUnseenPolicy(predictionUnseenPolicy); err != nil {
+			return nil, fmt.Errorf("invalid PREDICTION_UNSEEN_POLICY: %w", err)
+		}
+	}
+
+	// Prediction targets
+	predictionTargets, err := features.ParseTargets(os.Getenv("PREDICTION_TARGETS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PREDICTION_TARGETS: %w", err)
+	}
+
+	// Forecast evaluation metrics
+	evaluationMetrics, err := evaluation.ParseMetricSet(os.Getenv("EVALUATION_METRICS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid EVALUATION_METRICS: %w", err)
+	}
+
+	// External feature providers
+	featureProviders, err := getFeatureProviders("FEATURE_PROVIDERS")
+	if err != nil {
+		return nil, err
+	}
+	featureProviderTimeout := getEnvDuration("FEATURE_PROVIDER_TIMEOUT", 500*time.Millisecond)
+	featureProviderCacheTTL := getEnvDuration("FEATURE_PROVIDER_CACHE_TTL", 15*time.Minute)
+
+	// Retraining on ingested volume
+	retrainMinNewRows := getEnvInt("RETRAIN_MIN_NEW_ROWS", 0)
+	retrainMinNewRowsPercent := getEnvFloat("RETRAIN_MIN_NEW_ROWS_PERCENT", 0)
+
+	// Seller reliability features
+	sellerStatsWindowDays := getEnvInt("SELLER_STATS_WINDOW_DAYS", 90)
+	if sellerStatsWindowDays < 2 {
+		return nil, fmt.Errorf("invalid SELLER_STATS_WINDOW_DAYS %d, expected at least 2", sellerStatsWindowDays)
+	}
+
+	// Rolling-origin backtest
+	backtestOrigins := getEnvInt("BACKTEST_ORIGINS", 4)
+	if backtestOrigins < 1 {
+		return nil, fmt.Errorf("invalid BACKTEST_ORIGINS %d, expected at least 1", backtestOrigins)
+	}
+	backtestMaxCases := getEnvInt("BACKTEST_MAX_CASES", 200)
+	if backtestMaxCases < 1 {
+		return nil, fmt.Errorf("invalid BACKTEST_MAX_CASES %d, expected at least 1", backtestMaxCases)
+	}
+	backtestAlertMetric := os.Getenv("BACKTEST_ALERT_METRIC")
+	if backtestAlertMetric == "" {
+		backtestAlertMetric = evaluation.WAPE
+	}
+	if !evaluation.IsMetric(backtestAlertMetric) {
+		return nil, fmt.Errorf("invalid BACKTEST_ALERT_METRIC %q, expected one of %s", backtestAlertMetric,
+			strings.Join(evaluation.AllMetrics, ", "))
+	}
+	backtestAlertThresholdPercent := getEnvFloat("BACKTEST_ALERT_THRESHOLD_PERCENT", 10)
+	if backtestAlertThresholdPercent <= 0 {
+		return nil, fmt.Errorf("invalid BACKTEST_ALERT_THRESHOLD_PERCENT %g, expected a positive percentage", backtestAlertThresholdPercent)
+	}
+
+	// API usage analytics
+	apiUsageFlushInterval := getEnvDuration("API_USAGE_FLUSH_INTERVAL", time.Minute)
+	if apiUsageFlushInterval <= 0 {
+		return nil, fmt.Errorf("invalid API_USAGE_FLUSH_INTERVAL %s, expected a positive duration", apiUsageFlushInterval)
+	}
+	apiUsageRetentionDays := getEnvInt("API_USAGE_RETENTION_DAYS", 14)
+	if apiUsageRetentionDays < 1 {
+		return nil, fmt.Errorf("invalid API_USAGE_RETENTION_DAYS %d, expected at least 1", apiUsageRetentionDays)
+	}
+
+	// Warm standby
+	shadowPercent := getEnvFloat("SHADOW_PERCENT", 0)
+	if shadowPercent < 0 || shadowPercent > 100 {
+		return nil, fmt.Errorf("invalid SHADOW_PERCENT %g, expected a percentage between 0 and 100", shadowPercent)
+	}
+	shadowMinSamples := getEnvInt("SHADOW_MIN_SAMPLES", 200)
+	if shadowMinSamples < 1 {
+		return nil, fmt.Errorf("invalid SHADOW_MIN_SAMPLES %d, expected at least 1", shadowMinSamples)
+	}
+	shadowMaxErrorPercent := getEnvFloat("SHADOW_MAX_ERROR_PERCENT", 1)
+	if shadowMaxErrorPercent < 0 || shadowMaxErrorPercent > 100 {
+		return nil, fmt.Errorf("invalid SHADOW_MAX_ERROR_PERCENT %g, expected a percentage between 0 and 100", shadowMaxErrorPercent)
+	}
+	shadowMaxDivergencePercent := getEnvFloat("SHADOW_MAX_DIVERGENCE_PERCENT", 20)
+	if shadowMaxDivergencePercent <= 0 {
+		return nil, fmt.Errorf("invalid SHADOW_MAX_DIVERGENCE_PERCENT %g, expected a positive percentage", shadowMaxDivergencePercent)
+	}
+
+	// Golden set verification
+	goldenSetFile := os.Getenv("GOLDEN_SET_FILE")
+	goldenSetTolerance := getEnvFloat("GOLDEN_SET_TOLERANCE", 1e-6)
+	if goldenSetTolerance < 0 {
+		return nil, fmt.Errorf("invalid GOLDEN_SET_TOLERANCE %g, expected a non-negative relative difference", goldenSetTolerance)
+	}
+
+	// API versioning
+	var apiV1Sunset time.Time
+	if value := os.Getenv("API_V1_SUNSET"); value != "" {
+		sunset, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API_V1_SUNSET %q, expected YYYY-MM-DD: %w", value, err)
+		}
+		apiV1Sunset = sunset
+	}
+
+	// Inference engine
+	inferenceEngine := os.Getenv("INFERENCE_ENGINE")
+	if inferenceEngine == "" {
+		inferenceEngine = "python"
+	}
+	modelServerURL := os.Getenv("MODEL_SERVER_URL")
+	modelServerToken := os.Getenv("MODEL_SERVER_TOKEN")
+	modelServerTimeout := getEnvDuration("MODEL_SERVER_TIMEOUT", 10*time.Second)
+	modelServerMaxAttempts := getEnvInt("MODEL_SERVER_MAX_ATTEMPTS", 2)
+	outboundCircuitFailures := getEnvInt("OUTBOUND_CIRCUIT_FAILURES", 5)
+	outboundCircuitCooldown := getEnvDuration("OUTBOUND_CIRCUIT_COOLDOWN", 30*time.Second)
+	stubEngineLatency := getEnvDuration("STUB_ENGINE_LATENCY", 0)
+	pythonMaxConcurrency := getEnvInt("PYTHON_MAX_CONCURRENCY", 4)
+	if pythonMaxConcurrency < 1 {
+		return nil, fmt.Errorf("invalid PYTHON_MAX_CONCURRENCY %d, expected at least 1", pythonMaxConcurrency)
+	}
+	inferenceInteractiveSLO := getEnvDuration("INFERENCE_INTERACTIVE_SLO", time.Second)
+
+	// Worker pool of catalog-wide jobs; with the Python engine it must leave prediction processes
+	// free for interactive requests
+	workerPoolSize := getEnvInt("WORKER_POOL_SIZE", 2)
+	if workerPoolSize < 1 {
+		return nil, fmt.Errorf("invalid WORKER_POOL_SIZE %d, expected at least 1", workerPoolSize)
+	}
+	if inferenceEngine == "python" && workerPoolSize >= pythonMaxConcurrency {
+		return nil, fmt.Errorf("WORKER_POOL_SIZE %d must be below PYTHON_MAX_CONCURRENCY %d to leave room for interactive requests",
+			workerPoolSize, pythonMaxConcurrency)
+	}
+	simulationWorkers, err := getWorkers("SIMULATION_WORKERS", workerPoolSize)
+	if err != nil {
+		return nil, err
+	}
+	batchWorkers, err := getWorkers("BATCH_WORKERS", workerPoolSize)
+	if err != nil {
+		return nil, err
+	}
+	reconciliationWorkers, err := getWorkers("RECONCILIATION_WORKERS", workerPoolSize)
+	if err != nil {
+		return nil, err
+	}
+	backtestWorkers, err := getWorkers("BACKTEST_WORKERS", workerPoolSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Service level objectives
+	sloNames := os.Getenv("SLO_NAMES")
+	if sloNames == "" {
+		sloNames = "predict"
+	}
+	var slos []SLO
+	for _, name := range strings.Split(sloNames, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		slo, err := getSLO(name)
+		if err != nil {
+			return nil, err
+		}
+		slos = append(slos, slo)
+	}
+
+	// Feature flags
+	featureFlags, err := getFeatureFlags("FEATURE_FLAGS")
+	if err != nil {
+		return nil, err
+	}
+	featureFlagRefreshInterval := getEnvDuration("FEATURE_FLAG_REFRESH_INTERVAL", 10*time.Second)
+	if featureFlagRefreshInterval <= 0 {
+		return nil, fmt.Errorf("invalid FEATURE_FLAG_REFRESH_INTERVAL %s, expected a positive duration", featureFlagRefreshInterval)
+	}
+
+	// Fault injection, only honoured by chaos builds
+	chaosToken := os.Getenv("CHAOS_TOKEN")
+
+	// Graceful shutdown
+	drainTimeout := getEnvDuration("DRAIN_TIMEOUT", 5*time.Minute)
+	pythonTerminationGrace := getEnvDuration("PYTHON_TERMINATION_GRACE", 10*time.Second)
+	if pythonTerminationGrace <= 0 {
+		return nil, fmt.Errorf("invalid PYTHON_TERMINATION_GRACE %s, expected a positive duration", pythonTerminationGrace)
+	}
+	preStopDelay := getEnvDuration("PRESTOP_DELAY", 5*time.Second)
+	if preStopDelay < 0 {
+		return nil, fmt.Errorf("invalid PRESTOP_DELAY %s, expected a non-negative duration", preStopDelay)
+	}
+
+	// Python environment verification
+	pythonEnvCheck := os.Getenv("PYTHON_ENV_CHECK")
+	switch pythonEnvCheck {
+	case "":
+		pythonEnvCheck = "strict"
+	case "strict", "warn", "off":
+	default:
+		return nil, fmt.Errorf("invalid PYTHON_ENV_CHECK %q, expected strict, warn or off", pythonEnvCheck)
+	}
+
 	return &Config{
 		DataPath:          dataPath,
 		ModelPath:         modelPath,
 		ProcessedDataPath: processedDataPath,
 		ServerPort:        serverPort,
-		SchedulerInterval: schedulerInterval,
+		RunMode:           runMode,
 		PostgresHost:      postgresHost,
 		PostgresPort:      postgresPort,
 		PostgresUser:      postgresUser,
 		PostgresPassword:  postgresPassword,
 		PostgresDBName:    postgresDBName,
 		PostgresSSLMode:   postgresSSLMode,
+
+		DBRetryMaxAttempts:    dbRetryMaxAttempts,
+		DBRetryInitialBackoff: dbRetryInitialBackoff,
+		DBRetryMaxBackoff:     dbRetryMaxBackoff,
+
+		RabbitMQURL:                rabbitMQURL,
+		RabbitMQProducerID:         rabbitMQProducerID,
+		RabbitMQSigningKeys:        rabbitMQSigningKeys,
+		RabbitMQSignatureMaxAge:    rabbitMQSignatureMaxAge,
+		RabbitMQLagInterval:        rabbitMQLagInterval,
+		RabbitMQMaxLag:             rabbitMQMaxLag,
+		RabbitMQQueueWeights:       rabbitMQQueueWeights,
+		RabbitMQPrefetch:           rabbitMQPrefetch,
+		QueueWeightRefreshInterval: queueWeightRefreshInterval,
+		OutboxEnabled:              outboxEnabled,
+		OutboxPollInterval:         outboxPollInterval,
+		OutboxBatchSize:            outboxBatchSize,
+		OutboxMaxAttempts:          outboxMaxAttempts,
+		StartupWaitTimeout:         startupWaitTimeout,
+
+		ArtifactStorePath:     artifactStorePath,
+		ModelSyncInterval:     modelSyncInterval,
+		ModelCheckTTL:         modelCheckTTL,
+		ArtifactEncryptionKey: artifactEncryptionKey,
+
+		HTTPReadHeaderTimeout: httpReadHeaderTimeout,
+		HTTPReadTimeout:       httpReadTimeout,
+		HTTPWriteTimeout:      httpWriteTimeout,
+		HTTPIdleTimeout:       httpIdleTimeout,
+		PredictTimeout:        predictTimeout,
+		TrainTimeout:          trainTimeout,
+
+		TrainJobPollInterval: trainJobPollInterval,
+		TrainJobMaxAttempts:  trainJobMaxAttempts,
+
+		SimulationMaxScenarios: simulationMaxScenarios,
+		SimulationTimeout:      simulationTimeout,
+
+		BatchMaxItems:               batchMaxItems,
+		BatchTimeout:                batchTimeout,
+		BatchCallbackSecret:         batchCallbackSecret,
+		BatchCallbackAllowedHosts:   batchCallbackAllowedHosts,
+		BatchCallbackMaxAttempts:    batchCallbackMaxAttempts,
+		BatchCallbackInitialBackoff: batchCallbackInitialBackoff,
+		BatchCallbackMaxBackoff:     batchCallbackMaxBackoff,
+		BatchCallbackTimeout:        batchCallbackTimeout,
+		BatchCallbackMaxInlineBytes: batchCallbackMaxInlineBytes,
+
+		PublicBaseURL: publicBaseURL,
+
+		ResultStorePath: resultStorePath,
+		ResultURLSecret: resultURLSecret,
+		ResultURLTTL:    resultURLTTL,
+
+		TrainingLogMaxBytes: trainingLogMaxBytes,
+
+		HistoryMaxStalenessDays: historyMaxStalenessDays,
+		HistoryStrictMode:       historyStrictMode,
+
+		PredictionMaxHorizonDays: predictionMaxHorizonDays,
+
+		LagMode:              lagMode,
+		HolidaysFile:         holidaysFile,
+		HistoryInterpolation: historyInterpolation,
+
+		PredictionFallbackChain: predictionFallbackChain,
+
+		TrainingWindow:     trainingWindow,
+		TrainingWindowDays: trainingWindowDays,
+		TrainingMaxRows:    trainingMaxRows,
+		TrainingMaxBytes:   trainingMaxBytes,
+
+		DiskMinFreeBytes:  diskMinFreeBytes,
+		DiskCheckInterval: diskCheckInterval,
+		DiskLeakAge:       diskLeakAge,
+
+		EarlyStoppingRounds:         earlyStoppingRounds,
+		OverfittingThresholdPercent: overfittingThresholdPercent,
+
+		EncoderUnseenPolicy: string(encoderUnseenPolicy),
+		EncoderMinCount:     encoderMinCount,
+
+		PredictionUnseenPolicy: predictionUnseenPolicy,
+
+		PredictionTargets: predictionTargets,
+
+		EvaluationMetrics: evaluationMetrics,
+
+		FeatureProviders:        featureProviders,
+		FeatureProviderTimeout:  featureProviderTimeout,
+		FeatureProviderCacheTTL: featureProviderCacheTTL,
+
+		RetrainJob:          retrainJob,
+		ReconciliationJob:   reconciliationJob,
+		RetrainTriggerJob:   retrainTriggerJob,
+		SellerStatsJob:      sellerStatsJob,
+		BacktestJob:         backtestJob,
+		UsageRollupJob:      usageRollupJob,
+		StandbyPromotionJob: standbyPromotionJob,
+
+		APIV1Sunset: apiV1Sunset,
+
+		RetrainMinNewRows:        retrainMinNewRows,
+		RetrainMinNewRowsPercent: retrainMinNewRowsPercent,
+
+		SellerStatsWindowDays: sellerStatsWindowDays,
+
+		BacktestOrigins:               backtestOrigins,
+		BacktestMaxCases:              backtestMaxCases,
+		BacktestAlertMetric:           backtestAlertMetric,
+		BacktestAlertThresholdPercent: backtestAlertThresholdPercent,
+
+		APIUsageFlushInterval: apiUsageFlushInterval,
+		APIUsageRetentionDays: apiUsageRetentionDays,
+
+		ShadowPercent:              shadowPercent,
+		ShadowMinSamples:           shadowMinSamples,
+		ShadowMaxErrorPercent:      shadowMaxErrorPercent,
+		ShadowMaxDivergencePercent: shadowMaxDivergencePercent,
+
+		GoldenSetFile:      goldenSetFile,
+		GoldenSetTolerance: goldenSetTolerance,
+
+		InferenceEngine:      inferenceEngine,
+		PythonMaxConcurrency: pythonMaxConcurrency,
+		PythonEnvCheck:       pythonEnvCheck,
+		DrainTimeout:         drainTimeout,
+		ModelServerURL:       modelServerURL,
+		ModelServerToken:     modelServerToken,
+		ModelServerTimeout:   modelServerTimeout,
+		StubEngineLatency:    stubEngineLatency,
+
+		ModelServerMaxAttempts:  modelServerMaxAttempts,
+		OutboundCircuitFailures: outboundCircuitFailures,
+		OutboundCircuitCooldown: outboundCircuitCooldown,
+
+		PythonTerminationGrace:  pythonTerminationGrace,
+		PreStopDelay:            preStopDelay,
+		InferenceInteractiveSLO: inferenceInteractiveSLO,
+		WorkerPoolSize:          workerPoolSize,
+		SimulationWorkers:       simulationWorkers,
+		BatchWorkers:            batchWorkers,
+		ReconciliationWorkers:   reconciliationWorkers,
+		BacktestWorkers:         backtestWorkers,
+
+		SLOs: slos,
+
+		FeatureFlags:               featureFlags,
+		FeatureFlagRefreshInterval: featureFlagRefreshInterval,
+
+		ChaosToken: chaosToken,
 	}, nil
 }
 
@@ -113,3 +927,306 @@ func (c *Config) GetPostgresConnectionString() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		c.PostgresHost, c.PostgresPort, c.PostgresUser, c.PostgresPassword, c.PostgresDBName, c.PostgresSSLMode)
 }
+
+// JobSchedule is the cron expression of a background job and whether it runs on it
+type JobSchedule struct {
+	Cron    string
+	Enabled bool
+}
+
+// FeatureProvider is an HTTP endpoint supplying external features. URL may hold the {product},
+// {category}, {region}, {seller} and {date} placeholders
+type FeatureProvider struct {
+	Name  string
+	URL   string
+	Token string
+}
+
+// getJobSchedule reads JOB_<name>_CRON and JOB_<name>_ENABLED, falling back to the defaults
+func getJobSchedule(name, defaultCron string, defaultEnabled bool) JobSchedule {
+	schedule := JobSchedule{Cron: defaultCron, Enabled: defaultEnabled}
+	if value := os.Getenv("JOB_" + name + "_CRON"); value != "" {
+		schedule.Cron = value
+	}
+	if enabled, err := strconv.ParseBool(os.Getenv("JOB_" + name + "_ENABLED")); err == nil {
+		schedule.Enabled = enabled
+	}
+	return schedule
+}
+
+// SLO is a service level objective over the requests of some routes; targets are percentages
+// of good requests and an objective is off when its target is 0
+type SLO struct {
+	Name               string
+	Routes             []string
+	LatencyThreshold   time.Duration
+	LatencyTarget      float64
+	AvailabilityTarget float64
+}
+
+// defaultSLOs are the objectives used for SLOs whose variables are not set
+var defaultSLOs = map[string]SLO{
+	"predict": {
+		Routes: []string{"POST /api/v1/predict", "POST /api/v1/predict/minimal",
+			"POST /api/v2/predictions", "POST /api/v2/predictions/features"},
+		LatencyThreshold:   500 * time.Millisecond,
+		LatencyTarget:      95,
+		AvailabilityTarget: 99.5,
+	},
+}
+
+// getSLO reads SLO_<name>_ROUTES (comma-separated "METHOD /route" pairs, every route when empty),
+// SLO_<name>_LATENCY, SLO_<name>_LATENCY_TARGET and SLO_<name>_AVAILABILITY_TARGET
+func getSLO(name string) (SLO, error) {
+	slo := defaultSLOs[name]
+	slo.Name = name
+
+	prefix := "SLO_" + strings.ToUpper(name) + "_"
+	if value := os.Getenv(prefix + "ROUTES"); value != "" {
+		slo.Routes = nil
+		for _, route := range strings.Split(value, ",") {
+			if route = strings.TrimSpace(route); route != "" {
+				slo.Routes = append(slo.Routes, route)
+			}
+		}
+	}
+	slo.LatencyThreshold = getEnvDuration(prefix+"LATENCY", slo.LatencyThreshold)
+	slo.LatencyTarget = getEnvFloat(prefix+"LATENCY_TARGET", slo.LatencyTarget)
+	slo.AvailabilityTarget = getEnvFloat(prefix+"AVAILABILITY_TARGET", slo.AvailabilityTarget)
+
+	if slo.LatencyTarget < 0 || slo.LatencyTarget >= 100 {
+		return SLO{}, fmt.Errorf("invalid %sLATENCY_TARGET %v, expected a percentage below 100", prefix, slo.LatencyTarget)
+	}
+	if slo.AvailabilityTarget < 0 || slo.AvailabilityTarget >= 100 {
+		return SLO{}, fmt.Errorf("invalid %sAVAILABILITY_TARGET %v, expected a percentage below 100", prefix, slo.AvailabilityTarget)
+	}
+	return slo, nil
+}
+
+// FeatureFlag is the configured default of a feature flag: whether it is on and the percentage of
+// clients it is on for
+type FeatureFlag struct {
+	Enabled    bool
+	Percentage int
+}
+
+// getFeatureFlags reads comma-separated name=value pairs, where the value is on, off or a rollout
+// percentage such as 25%
+func getFeatureFlags(name string) (map[string]FeatureFlag, error) {
+	flags := make(map[string]FeatureFlag)
+	value := os.Getenv(name)
+	if value == "" {
+		return flags, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		flag, setting, ok := strings.Cut(pair, "=")
+		flag, setting = strings.TrimSpace(flag), strings.TrimSpace(setting)
+		if !ok || flag == "" {
+			return nil, fmt.Errorf("invalid %s entry %q, expected name=on|off|<percent>%%", name, pair)
+		}
+
+		switch {
+		case setting == "on":
+			flags[flag] = FeatureFlag{Enabled: true, Percentage: 100}
+		case setting == "off":
+			flags[flag] = FeatureFlag{Enabled: false, Percentage: 100}
+		case strings.HasSuffix(setting, "%"):
+			percentage, err := strconv.Atoi(strings.TrimSuffix(setting, "%"))
+			if err != nil || percentage < 0 || percentage > 100 {
+				return nil, fmt.Errorf("invalid %s percentage %q for %s", name, setting, flag)
+			}
+			flags[flag] = FeatureFlag{Enabled: true, Percentage: percentage}
+		default:
+			return nil, fmt.Errorf("invalid %s value %q for %s, expected on, off or a percentage", name, setting, flag)
+		}
+	}
+	return flags, nil
+}
+
+// getQueueWeights reads comma-separated queue=weight pairs, where the weight is between 0 and 100
+func getQueueWeights(name string) (map[string]int, error) {
+	weights := make(map[string]int)
+	value := os.Getenv(name)
+	if value == "" {
+		return weights, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		queue, setting, ok := strings.Cut(pair, "=")
+		queue, setting = strings.TrimSpace(queue), strings.TrimSpace(setting)
+		if !ok || queue == "" {
+			return nil, fmt.Errorf("invalid %s entry %q, expected queue=weight", name, pair)
+		}
+		weight, err := strconv.Atoi(setting)
+		if err != nil || weight < 0 || weight > 100 {
+			return nil, fmt.Errorf("invalid %s weight %q for %s, expected 0-100", name, setting, queue)
+		}
+		weights[queue] = weight
+	}
+	return weights, nil
+}
+
+// getFallbackChain reads a comma-separated list of prediction strategies, each listed at most once
+func getFallbackChain(name, defaultValue string) ([]string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		value = defaultValue
+	}
+
+	var chain []string
+	seen := make(map[string]bool)
+	for _, strategy := range strings.Split(value, ",") {
+		strategy = strings.TrimSpace(strategy)
+		if strategy != "global" && strategy != "category" && strategy != "last_observed" {
+			return nil, fmt.Errorf("invalid %s strategy %q, expected global, category or last_observed", name, strategy)
+		}
+		if seen[strategy] {
+			return nil, fmt.Errorf("duplicate %s strategy %s", name, strategy)
+		}
+		seen[strategy] = true
+		chain = append(chain, strategy)
+	}
+	return chain, nil
+}
+
+// getFeatureProviders reads comma-separated name=url pairs of HTTP feature providers, taking the
+// bearer token of each from FEATURE_PROVIDER_<NAME>_TOKEN
+func getFeatureProviders(name string) ([]FeatureProvider, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	var providers []FeatureProvider
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		provider, url, ok := strings.Cut(pair, "=")
+		provider, url = strings.TrimSpace(provider), strings.TrimSpace(url)
+		if !ok || url == "" || !validProviderName(provider) {
+			return nil, fmt.Errorf("invalid %s entry %q, expected name=url with a name of lowercase letters, digits and underscores", name, pair)
+		}
+		if seen[provider] {
+			return nil, fmt.Errorf("duplicate %s entry for %s", name, provider)
+		}
+		seen[provider] = true
+		providers = append(providers, FeatureProvider{
+			Name:  provider,
+			URL:   url,
+			Token: os.Getenv("FEATURE_PROVIDER_" + strings.ToUpper(provider) + "_TOKEN"),
+		})
+	}
+	return providers, nil
+}
+
+// validProviderName reports whether a provider name is safe to embed in feature names
+func validProviderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// getEncryptionKey reads a base64-encoded 32-byte key from <name> or from the file named by <name>_FILE,
+// returning nil when neither is set
+func getEncryptionKey(name string) ([]byte, error) {
+	value := os.Getenv(name)
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		if value != "" {
+			return nil, fmt.Errorf("only one of %s and %s_FILE may be set", name, name)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s_FILE: %w", name, err)
+		}
+		value = strings.TrimSpace(string(data))
+	}
+	if value == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, expected base64: %w", name, err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid %s, expected a 32-byte key, got %d bytes", name, len(key))
+	}
+	return key, nil
+}
+
+// getSigningKeys reads per-producer shared secrets from a comma-separated list of producer=secret
+// pairs, returning nil when the variable is unset
+func getSigningKeys(name string) (map[string][]byte, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(value, ",") {
+		producer, secret, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || producer == "" || secret == "" {
+			return nil, fmt.Errorf("invalid %s entry %q, expected producer=secret", name, pair)
+		}
+		if _, exists := keys[producer]; exists {
+			return nil, fmt.Errorf("invalid %s, producer %q is listed twice", name, producer)
+		}
+		keys[producer] = []byte(secret)
+	}
+	return keys, nil
+}
+
+// getEnvInt reads an integer environment variable, falling back to the default when unset or invalid
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getWorkers reads a per-job worker override, which may not exceed the worker pool (0 uses the whole pool)
+func getWorkers(name string, poolSize int) (int, error) {
+	workers := getEnvInt(name, 0)
+	if workers < 0 || workers > poolSize {
+		return 0, fmt.Errorf("invalid %s %d, expected between 0 and WORKER_POOL_SIZE %d", name, workers, poolSize)
+	}
+	return workers, nil
+}
+
+// getEnvFloat reads a float environment variable, falling back to the default when unset or invalid
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvDuration reads a duration environment variable (e.g. "500ms", "2s"),
+// falling back to the default when unset or invalid
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,479 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultUsageLimit = 20
+	maxUsageLimit     = 500
+)
+
+// AdminAPIController handles HTTP requests for operating the service
+type AdminAPIController struct {
+	deprecations *DeprecationTracker
+	lifecycle    *service.Lifecycle
+	scheduler    Scheduler
+	auditLog     AuditLog
+	slos         *metrics.SLOTracker
+	flags        FeatureFlags
+	queueWeights QueueWeights
+	usage        UsageTracker
+	replayer     Replayer
+	logger       *zap.SugaredLogger
+}
+
+// NewAdminAPIController creates a new admin API controller
+func NewAdminAPIController(deprecations *DeprecationTracker, lifecycle *service.Lifecycle, scheduler Scheduler, auditLog AuditLog, slos *metrics.SLOTracker, flags FeatureFlags, queueWeights QueueWeights, usage UsageTracker, replayer Replayer, logger *zap.SugaredLogger) *AdminAPIController {
+	return &AdminAPIController{
+		deprecations: deprecations,
+		lifecycle:    lifecycle,
+		scheduler:    scheduler,
+		auditLog:     auditLog,
+		slos:         slos,
+		flags:        flags,
+		queueWeights: queueWeights,
+		usage:        usage,
+		replayer:     replayer,
+		logger:       logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the admin API
+func (c *AdminAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/admin")
+	{
+		api.GET("/deprecations", c.HandleDeprecations)
+		api.GET("/audit", c.HandleAuditLog)
+		api.GET("/slo", c.HandleSLO)
+		api.GET("/flags", c.HandleFlags)
+		api.PUT("/flags/:name", Audited(c.auditLog, service.AuditActionSetFlag), c.HandleSetFlag)
+		api.DELETE("/flags/:name", Audited(c.auditLog, service.AuditActionSetFlag), c.HandleResetFlag)
+		api.GET("/queue-weights", c.HandleQueueWeights)
+		api.PUT("/queue-weights/:queue", Audited(c.auditLog, service.AuditActionSetQueueWeight), c.HandleSetQueueWeight)
+		api.DELETE("/queue-weights/:queue", Audited(c.auditLog, service.AuditActionSetQueueWeight), c.HandleResetQueueWeight)
+		api.GET("/usage", c.HandleUsage)
+		api.GET("/replay/engines", c.HandleReplayEngines)
+		api.POST("/replay", Audited(c.auditLog, service.AuditActionReplay), c.HandleReplay)
+	}
+	c.RegisterJobRoutes(router)
+}
+
+// RegisterJobRoutes registers the HTTP routes for the lame-duck mode and background jobs of the
+// replica, the only admin routes served by workers
+func (c *AdminAPIController) RegisterJobRoutes(router gin.IRouter) {
+	api := router.Group("/api/v1/admin")
+	{
+		api.GET("/lame-duck", c.HandleGetLameDuck)
+		api.POST("/lame-duck", Audited(c.auditLog, service.AuditActionLameDuck), c.HandleEnterLameDuck)
+		api.GET("/jobs", c.HandleJobs)
+		api.POST("/jobs/:name/run", Audited(c.auditLog, service.AuditActionRunJob), c.HandleRunJob)
+	}
+}
+
+// HandleDeprecations handles deprecated API usage requests
+// @Summary Deprecated API usage
+// @Description List the clients, identified by API key hash or user agent, that still call deprecated routes or send deprecated fields
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/deprecations [get]
+func (c *AdminAPIController) HandleDeprecations(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"items": c.deprecations.Usage()})
+}
+
+// HandleGetLameDuck handles lifecycle state requests
+// @Summary Lame-duck state
+// @Description Whether the replica is draining and how many background jobs are still running
+// @Produce json
+// @Success 200 {object} service.LifecycleState
+// @Router /api/v1/admin/lame-duck [get]
+func (c *AdminAPIController) HandleGetLameDuck(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.lifecycle.State())
+}
+
+// HandleEnterLameDuck handles lame-duck requests
+// @Summary Enter lame-duck mode
+// @Description Make the readiness probe fail and refuse new background jobs while running jobs finish, ahead of a restart
+// @Produce json
+// @Success 202 {object} service.LifecycleState
+// @Router /api/v1/admin/lame-duck [post]
+func (c *AdminAPIController) HandleEnterLameDuck(ctx *gin.Context) {
+	c.lifecycle.EnterLameDuck()
+	state := c.lifecycle.State()
+	c.logger.Infow("Entered lame-duck mode", "source", "admin_api", "in_flight_jobs", state.InFlightJobs)
+	ctx.JSON(http.StatusAccepted, state)
+}
+
+// HandleJobs handles scheduled job requests
+// @Summary Scheduled jobs
+// @Description List the background jobs with their cron schedule, enabled flag, next run and last run status
+// @Produce json
+// @Success 200 {object} map[string][]service.JobStatus
+// @Router /api/v1/admin/jobs [get]
+func (c *AdminAPIController) HandleJobs(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"items": c.scheduler.Jobs()})
+}
+
+// HandleRunJob handles manual job runs
+// @Summary Run a job now
+// @Description Start a background job immediately, even when its schedule is disabled
+// @Produce json
+// @Param name path string true "Job name"
+// @Success 202 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /api/v1/admin/jobs/{name}/run [post]
+func (c *AdminAPIController) HandleRunJob(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	err := c.scheduler.RunNow(name)
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	case errors.Is(err, service.ErrJobRunning):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrLameDuck):
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.logger.Errorw("Error starting job", "error", err, "job", name)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start job"})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{"status": "started", "job": name})
+}
+
+// HandleAuditLog handles audit log requests
+// @Summary Audit log
+// @Description List recorded calls to administrative operations with the caller, parameters and outcome, newest first
+// @Produce json
+// @Param action query string false "Audited action: train, lame_duck, run_job, set_flag, set_queue_weight or inject_fault"
+// @Param caller query string false "Caller identity, e.g. key:3f2a9c1b7e4d"
+// @Param outcome query string false "success or failure"
+// @Param from query string false "Calls made on or after this date (YYYY-MM-DD)"
+// @Param to query string false "Calls made on or before this date (YYYY-MM-DD)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param offset query int false "Number of entries to skip (default 0)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/audit [get]
+func (c *AdminAPIController) HandleAuditLog(ctx *gin.Context) {
+	limit, offset, ok := parsePagination(ctx)
+	if !ok {
+		return
+	}
+	from, to, ok := parseDateRange(ctx)
+	if !ok {
+		return
+	}
+
+	filter := service.AuditFilter{
+		Action:  ctx.Query("action"),
+		Caller:  ctx.Query("caller"),
+		Outcome: ctx.Query("outcome"),
+		From:    from,
+		To:      to,
+	}
+
+	entries, total, err := c.auditLog.List(filter, limit, offset)
+	if err != nil {
+		c.logger.Errorw("Error listing audit log", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit log"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":  entries,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// HandleSLO handles SLO summary requests
+// @Summary Service level objectives
+// @Description Burn rates of every SLO objective over the 5m, 30m, 1h and 6h windows and the alert that fires, if any
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/admin/slo [get]
+func (c *AdminAPIController) HandleSLO(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"items": c.slos.Summary()})
+}
+
+// HandleFlags handles feature flag listing requests
+// @Summary Feature flags
+// @Description List the feature flags with their setting and whether it comes from the default, the environment or the database
+// @Produce json
+// @Success 200 {object} map[string][]service.FeatureFlag
+// @Router /api/v1/admin/flags [get]
+func (c *AdminAPIController) HandleFlags(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"items": c.flags.List()})
+}
+
+// HandleSetFlag handles feature flag changes
+// @Summary Change a feature flag
+// @Description Store a setting of the flag that overrides its configured default on every replica within the refresh interval
+// @Accept json
+// @Produce json
+// @Param name path string true "Flag name"
+// @Param request body service.FeatureFlagSetting true "Flag setting"
+// @Success 200 {object} service.FeatureFlag
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/flags/{name} [put]
+func (c *AdminAPIController) HandleSetFlag(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	// An omitted percentage rolls the flag out to every client
+	setting := service.FeatureFlagSetting{Percentage: 100}
+	if err := ctx.ShouldBindJSON(&setting); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	flag, err := c.flags.Set(name, setting, clientID(ctx))
+	if err != nil {
+		c.respondFlagError(ctx, name, err)
+		return
+	}
+
+	c.logger.Infow("Feature flag changed", "flag", name, "enabled", flag.Enabled,
+		"percentage", flag.Percentage, "clients", flag.Clients)
+	ctx.JSON(http.StatusOK, flag)
+}
+
+// HandleResetFlag handles feature flag resets
+// @Summary Reset a feature flag
+// @Description Remove the stored setting of the flag, returning it to its configured default
+// @Produce json
+// @Param name path string true "Flag name"
+// @Success 200 {object} service.FeatureFlag
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/flags/{name} [delete]
+func (c *AdminAPIController) HandleResetFlag(ctx *gin.Context) {
+	name := ctx.Param("name")
+
+	flag, err := c.flags.Reset(name)
+	if err != nil {
+		c.respondFlagError(ctx, name, err)
+		return
+	}
+
+	c.logger.Infow("Feature flag reset", "flag", name, "enabled", flag.Enabled, "percentage", flag.Percentage)
+	ctx.JSON(http.StatusOK, flag)
+}
+
+// respondFlagError maps feature flag errors to HTTP responses
+func (c *AdminAPIController) respondFlagError(ctx *gin.Context, name string, err error) {
+	switch {
+	case errors.Is(err, service.ErrFlagNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Feature flag not found"})
+	case errors.Is(err, service.ErrInvalidFlag):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.logger.Errorw("Error changing feature flag", "error", err, "flag", name)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change feature flag"})
+	}
+}
+
+// QueueWeightRequest is a request to change the weight of an ingestion queue
+type QueueWeightRequest struct {
+	Weight *int `json:"weight" binding:"required"`
+}
+
+// HandleQueueWeights handles queue weight listing requests
+// @Summary Ingestion queue weights
+// @Description List the consumed ingestion queues with their weight and whether it comes from the environment or the database
+// @Produce json
+// @Success 200 {object} map[string][]service.QueueWeight
+// @Router /api/v1/admin/queue-weights [get]
+func (c *AdminAPIController) HandleQueueWeights(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"items": c.queueWeights.List()})
+}
+
+// HandleSetQueueWeight handles queue weight changes
+// @Summary Change a queue weight
+// @Description Store a weight of the queue that overrides its configured default on every replica within the refresh interval; 0 pauses the queue
+// @Accept json
+// @Produce json
+// @Param queue path string true "Queue name"
+// @Param request body QueueWeightRequest true "Queue weight"
+// @Success 200 {object} service.QueueWeight
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/queue-weights/{queue} [put]
+func (c *AdminAPIController) HandleSetQueueWeight(ctx *gin.Context) {
+	queue := ctx.Param("queue")
+
+	var request QueueWeightRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	weight, err := c.queueWeights.Set(queue, *request.Weight, clientID(ctx))
+	if err != nil {
+		c.respondQueueWeightError(ctx, queue, err)
+		return
+	}
+
+	c.logger.Infow("Queue weight changed", "queue", queue, "weight", weight.Weight)
+	ctx.JSON(http.StatusOK, weight)
+}
+
+// HandleResetQueueWeight handles queue weight resets
+// @Summary Reset a queue weight
+// @Description Remove the stored weight of the queue, returning it to its configured default
+// @Produce json
+// @Param queue path string true "Queue name"
+// @Success 200 {object} service.QueueWeight
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/queue-weights/{queue} [delete]
+func (c *AdminAPIController) HandleResetQueueWeight(ctx *gin.Context) {
+	queue := ctx.Param("queue")
+
+	weight, err := c.queueWeights.Reset(queue)
+	if err != nil {
+		c.respondQueueWeightError(ctx, queue, err)
+		return
+	}
+
+	c.logger.Infow("Queue weight reset", "queue", queue, "weight", weight.Weight)
+	ctx.JSON(http.StatusOK, weight)
+}
+
+// respondQueueWeightError maps queue weight errors to HTTP responses
+func (c *AdminAPIController) respondQueueWeightError(ctx *gin.Context, queue string, err error) {
+	switch {
+	case errors.Is(err, service.ErrQueueNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Queue not found"})
+	case errors.Is(err, service.ErrInvalidQueueWeight):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.logger.Errorw("Error changing queue weight", "error", err, "queue", queue)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change queue weight"})
+	}
+}
+
+// HandleUsage handles API usage requests
+// @Summary API usage by client
+// @Description Requests, error rate, latency and data volume of every client, identified by API key hash or user agent, over a range of days, the heaviest first; by_route breaks each client down by route
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD (default 6 days before to)"
+// @Param to query string false "Last day, YYYY-MM-DD (default today, UTC)"
+// @Param client query string false "Client identity, e.g. key:3f2a9c1b7e4d"
+// @Param route query string false "Route pattern, e.g. /api/v1/predict"
+// @Param by_route query bool false "Break the usage of each client down by route"
+// @Param limit query int false "Number of rows (default 20, max 500)"
+// @Success 200 {object} service.APIUsageReport
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/usage [get]
+func (c *AdminAPIController) HandleUsage(ctx *gin.Context) {
+	request := service.APIUsageRequest{
+		Client: ctx.Query("client"),
+		Route:  ctx.Query("route"),
+		Limit:  defaultUsageLimit,
+	}
+	for _, bound := range []struct {
+		name string
+		date *time.Time
+	}{{"from", &request.From}, {"to", &request.To}} {
+		value := ctx.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": bound.name + " must be a date in YYYY-MM-DD format"})
+			return
+		}
+		*bound.date = date
+	}
+	var err error
+	if request.ByRoute, err = strconv.ParseBool(ctx.DefaultQuery("by_route", "false")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "by_route must be true or false"})
+		return
+	}
+	if value := ctx.Query("limit"); value != "" {
+		if request.Limit, err = strconv.Atoi(value); err != nil || request.Limit <= 0 || request.Limit > maxUsageLimit {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+	}
+
+	report, err := c.usage.Report(&request)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUsageRequest) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.Errorw("Error building API usage report", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build usage report"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// HandleReplayEngines handles replay engine requests
+// @Summary Replay engine backends
+// @Description List the inference engine backends a replay can target
+// @Produce json
+// @Success 200 {object} map[string][]string
+// @Router /api/v1/admin/replay/engines [get]
+func (c *AdminAPIController) HandleReplayEngines(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"items": c.replayer.Engines()})
+}
+
+// HandleReplay handles shadow traffic replay requests
+// @Summary Replay recorded predictions
+// @Description Run the latest predictions the installed models made against a model version or another engine backend, and report how far the outputs are from the recorded ones. Replays are not recorded in the prediction log
+// @Accept json
+// @Produce json
+// @Param request body service.ReplayRequest true "Replay target and number of predictions"
+// @Success 200 {object} service.ReplayReport
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/admin/replay [post]
+func (c *AdminAPIController) HandleReplay(ctx *gin.Context) {
+	var request service.ReplayRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := c.replayer.Replay(ctx.Request.Context(), &request)
+	switch {
+	case errors.Is(err, service.ErrInvalidReplayRequest):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrModelVersionUnavailable), errors.Is(err, service.ErrModelIncompatible):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.logger.Errorw("Error replaying predictions", "error", err, "model_version", request.ModelVersion, "engine", request.Engine)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay predictions"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+)
+
+// maxAuditBodyBytes bounds the request and response bodies kept for an audit entry
+const maxAuditBodyBytes = 16 * 1024
+
+// redactedValue replaces the values of parameters that look like credentials
+const redactedValue = "[REDACTED]"
+
+// sensitiveParams are substrings of parameter names whose values are never written to the audit log
+var sensitiveParams = []string{"password", "secret", "token", "key"}
+
+// auditResponseWriter keeps the beginning of the response body so that the error can be audited
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *auditResponseWriter) capture(data []byte) {
+	if remaining := maxAuditBodyBytes - w.body.Len(); remaining > 0 {
+		if len(data) > remaining {
+			data = data[:remaining]
+		}
+		w.body.Write(data)
+	}
+}
+
+// Audited records every call of the route in the audit log with the caller, the request
+// parameters and the outcome. It goes before other middleware of the route so that responses
+// written by them, such as timeouts, are audited too
+func Audited(auditLog AuditLog, action string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		started := time.Now()
+
+		body, _ := io.ReadAll(io.LimitReader(ctx.Request.Body, maxAuditBodyBytes+1))
+		ctx.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), ctx.Request.Body))
+
+		writer := &auditResponseWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		entry := &service.AuditEntry{
+			Action:     action,
+			Caller:     clientID(ctx),
+			RemoteAddr: ctx.ClientIP(),
+			Method:     ctx.Request.Method,
+			Path:       ctx.Request.URL.Path,
+			Params:     auditParams(ctx, body),
+			StatusCode: status,
+			Outcome:    service.AuditOutcomeSuccess,
+			CreatedAt:  started,
+			DurationMs: time.Since(started).Milliseconds(),
+		}
+		if status >= http.StatusBadRequest {
+			entry.Outcome = service.AuditOutcomeFailure
+			entry.Error = auditError(writer.body.Bytes(), status)
+		}
+		auditLog.Record(entry)
+	}
+}
+
+// auditParams collects the path parameters, query and JSON body of a request, with credentials redacted
+func auditParams(ctx *gin.Context, body []byte) json.RawMessage {
+	params := make(map[string]any)
+
+	if len(ctx.Params) > 0 {
+		path := make(map[string]string, len(ctx.Params))
+		for _, param := range ctx.Params {
+			path[param.Key] = param.Value
+		}
+		params["path"] = path
+	}
+
+	if query := ctx.Request.URL.Query(); len(query) > 0 {
+		values := make(map[string]any, len(query))
+		for name, value := range query {
+			values[name] = value
+		}
+		params["query"] = redact(values)
+	}
+
+	if len(body) > maxAuditBodyBytes {
+		params["body"] = "[TRUNCATED]"
+	} else if len(body) > 0 {
+		var payload any
+		if json.Unmarshal(body, &payload) == nil {
+			params["body"] = redactValue(payload)
+		} else {
+			params["body"] = "[NON-JSON]"
+		}
+	}
+
+	if len(params) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(params)
+	return data
+}
+
+// redact replaces the values of credential-like keys, descending into nested objects
+func redact(values map[string]any) map[string]any {
+	for name, value := range values {
+		if isSensitiveParam(name) {
+			values[name] = redactedValue
+			continue
+		}
+		values[name] = redactValue(value)
+	}
+	return values
+}
+
+// redactValue applies redact to the objects within a decoded JSON value
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return redact(v)
+	case []any:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return value
+}
+
+// isSensitiveParam reports whether a parameter name looks like a credential
+func isSensitiveParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range sensitiveParams {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditError extracts the error message of a failed response, falling back to the status text
+func auditError(body []byte, status int) string {
+	var response struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &response) == nil && response.Error != "" {
+		return response.Error
+	}
+	return http.StatusText(status)
+}
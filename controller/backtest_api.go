@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// BacktestAPIController handles HTTP requests for backtest results
+type BacktestAPIController struct {
+	backtester BacktestService
+	logger     *zap.SugaredLogger
+}
+
+// NewBacktestAPIController creates a new backtest API controller
+func NewBacktestAPIController(backtester BacktestService, logger *zap.SugaredLogger) *BacktestAPIController {
+	return &BacktestAPIController{
+		backtester: backtester,
+		logger:     logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the backtest API
+func (c *BacktestAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/backtests")
+	{
+		api.GET("/trend", c.HandleTrend)
+	}
+}
+
+// HandleTrend handles backtest trend requests
+// @Summary Backtest accuracy trend
+// @Description List the latest runs of the weekly rolling-origin backtest with their price and sales metrics, the average of the alert metric over the previous runs and whether the run was marked degraded
+// @Produce json
+// @Param limit query int false "Number of runs (default 12, max 100)"
+// @Success 200 {object} service.BacktestTrend
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/backtests/trend [get]
+func (c *BacktestAPIController) HandleTrend(ctx *gin.Context) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "12"))
+	if err != nil || limit < 1 || limit > 100 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be an integer between 1 and 100"})
+		return
+	}
+
+	trend, err := c.backtester.Trend(limit)
+	if err != nil {
+		c.logger.Errorw("Error listing backtest runs", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list backtest runs"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, trend)
+}
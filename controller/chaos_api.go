@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/internal/chaos"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// InjectFaultRequest describes the failures to inject into a dependency
+type InjectFaultRequest struct {
+	// LatencyMs is added to every affected call
+	LatencyMs int64 `json:"latency_ms"`
+	// ErrorRate is the share of affected calls that fail, between 0 and 1
+	ErrorRate float64 `json:"error_rate"`
+	// Calls limits the fault to this many calls, 0 for no limit
+	Calls int `json:"calls"`
+	// DurationSeconds ends the fault after this long, 0 to keep it until it is cleared
+	DurationSeconds int `json:"duration_seconds"`
+}
+
+// ChaosAPIController handles HTTP requests injecting dependency failures. It is only registered by
+// binaries built with the chaos tag and a CHAOS_TOKEN configured
+type ChaosAPIController struct {
+	token    string
+	auditLog AuditLog
+	logger   *zap.SugaredLogger
+}
+
+// NewChaosAPIController creates a new chaos API controller; every call must carry token in the
+// X-Chaos-Token header
+func NewChaosAPIController(token string, auditLog AuditLog, logger *zap.SugaredLogger) *ChaosAPIController {
+	return &ChaosAPIController{
+		token:    token,
+		auditLog: auditLog,
+		logger:   logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the chaos API
+func (c *ChaosAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/admin/chaos", c.requireToken)
+	{
+		api.GET("", c.HandleFaults)
+		api.PUT("/:target", Audited(c.auditLog, service.AuditActionInjectFault), c.HandleInjectFault)
+		api.DELETE("/:target", Audited(c.auditLog, service.AuditActionInjectFault), c.HandleClearFault)
+	}
+}
+
+// requireToken rejects calls without the chaos token
+func (c *ChaosAPIController) requireToken(ctx *gin.Context) {
+	if subtle.ConstantTimeCompare([]byte(ctx.GetHeader("X-Chaos-Token")), []byte(c.token)) != 1 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid chaos token"})
+		return
+	}
+	ctx.Next()
+}
+
+// HandleFaults handles fault listing requests
+// @Summary Injected faults
+// @Description List the active dependency faults with the number of calls each has affected
+// @Produce json
+// @Param X-Chaos-Token header string true "Chaos token"
+// @Success 200 {object} map[string][]chaos.Fault
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/admin/chaos [get]
+func (c *ChaosAPIController) HandleFaults(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"items": chaos.Faults()})
+}
+
+// HandleInjectFault handles fault injection requests
+// @Summary Inject a fault
+// @Description Add latency to the calls of a dependency (postgres, python or rabbitmq), fail a share of them, or both, replacing its previous fault
+// @Accept json
+// @Produce json
+// @Param X-Chaos-Token header string true "Chaos token"
+// @Param target path string true "Dependency: postgres, python or rabbitmq"
+// @Param request body controller.InjectFaultRequest true "Fault"
+// @Success 200 {object} chaos.Fault
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /api/v1/admin/chaos/{target} [put]
+func (c *ChaosAPIController) HandleInjectFault(ctx *gin.Context) {
+	var request InjectFaultRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.DurationSeconds < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "duration_seconds must not be negative"})
+		return
+	}
+
+	fault := chaos.Fault{
+		Target:    ctx.Param("target"),
+		LatencyMs: request.LatencyMs,
+		ErrorRate: request.ErrorRate,
+		Remaining: request.Calls,
+	}
+	if request.DurationSeconds > 0 {
+		expiresAt := time.Now().Add(time.Duration(request.DurationSeconds) * time.Second)
+		fault.ExpiresAt = &expiresAt
+	}
+
+	fault, err := chaos.Set(fault)
+	if errors.Is(err, chaos.ErrInvalidFault) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.logger.Warnw("Injecting dependency fault", "target", fault.Target, "latency_ms", fault.LatencyMs,
+		"error_rate", fault.ErrorRate, "calls", fault.Remaining, "expires_at", fault.ExpiresAt)
+	ctx.JSON(http.StatusOK, fault)
+}
+
+// HandleClearFault handles fault removal requests
+// @Summary Clear a fault
+// @Description Stop injecting failures into a dependency
+// @Produce json
+// @Param X-Chaos-Token header string true "Chaos token"
+// @Param target path string true "Dependency: postgres, python or rabbitmq"
+// @Success 204
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/admin/chaos/{target} [delete]
+func (c *ChaosAPIController) HandleClearFault(ctx *gin.Context) {
+	target := ctx.Param("target")
+	if !chaos.Clear(target) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No fault is injected into " + target})
+		return
+	}
+
+	c.logger.Infow("Cleared dependency fault", "target", target)
+	ctx.Status(http.StatusNoContent)
+}
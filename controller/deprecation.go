@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+)
+
+// Kinds of deprecated API usage
+const (
+	DeprecatedRoute = "route"
+	DeprecatedField = "field"
+)
+
+// maxUserAgentLength bounds the user agent used as a client identifier
+const maxUserAgentLength = 64
+
+// DeprecationUsage counts the calls of one client to a deprecated route or field
+type DeprecationUsage struct {
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name"`
+	Client   string    `json:"client"`
+	Count    uint64    `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// DeprecationTracker records which clients still use deprecated routes and fields
+type DeprecationTracker struct {
+	counter *metrics.CounterVec
+
+	mu    sync.Mutex
+	usage map[string]*DeprecationUsage
+}
+
+// NewDeprecationTracker creates a tracker and registers its counter in the registry
+func NewDeprecationTracker(registry *metrics.Registry) *DeprecationTracker {
+	return &DeprecationTracker{
+		counter: registry.NewCounterVec("api_deprecated_usage_total",
+			"Calls to deprecated routes and uses of deprecated fields", "kind", "name", "client"),
+		usage: make(map[string]*DeprecationUsage),
+	}
+}
+
+// Record counts one use of a deprecated route or field by the client of the request
+func (t *DeprecationTracker) Record(ctx *gin.Context, kind, name string) {
+	client := clientID(ctx)
+	t.counter.WithLabelValues(kind, name, client).Inc()
+
+	key := kind + "\xff" + name + "\xff" + client
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	usage, ok := t.usage[key]
+	if !ok {
+		usage = &DeprecationUsage{Kind: kind, Name: name, Client: client}
+		t.usage[key] = usage
+	}
+	usage.Count++
+	usage.LastSeen = time.Now()
+}
+
+// Usage returns the recorded usage, most used first
+func (t *DeprecationTracker) Usage() []DeprecationUsage {
+	t.mu.Lock()
+	usage := make([]DeprecationUsage, 0, len(t.usage))
+	for _, u := range t.usage {
+		usage = append(usage, *u)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Count != usage[j].Count {
+			return usage[i].Count > usage[j].Count
+		}
+		return usage[i].Name+usage[i].Client < usage[j].Name+usage[j].Client
+	})
+	return usage
+}
+
+// clientID identifies the caller by API key, never exposing the key itself, or by user agent
+func clientID(ctx *gin.Context) string {
+	if key := ctx.GetHeader("X-API-Key"); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:])[:12]
+	}
+
+	userAgent := ctx.Request.UserAgent()
+	if userAgent == "" {
+		return "unknown"
+	}
+	// The first product token (e.g. "python-requests/2.31.0") keeps the label cardinality bounded
+	userAgent, _, _ = strings.Cut(userAgent, " ")
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return "ua:" + userAgent
+}
+
+// addWarning appends an RFC 7234 warning header to the response
+func addWarning(ctx *gin.Context, message string) {
+	ctx.Writer.Header().Add("Warning", fmt.Sprintf("299 - %q", message))
+}
+
+// Deprecated marks responses of a deprecated route with the Deprecation, Sunset and Warning headers
+// and a link to its successor, and records which clients still call it
+func Deprecated(tracker *DeprecationTracker, sunset time.Time, successor string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Deprecation", "true")
+		ctx.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		message := fmt.Sprintf("%s is deprecated and will be removed on %s",
+			ctx.FullPath(), sunset.Format("2006-01-02"))
+		if successor != "" {
+			ctx.Header("Link", "<"+successor+`>; rel="successor-version"`)
+			message += ", use " + successor
+		}
+		addWarning(ctx, message)
+		tracker.Record(ctx, DeprecatedRoute, ctx.Request.Method+" "+ctx.FullPath())
+		ctx.Next()
+	}
+}
+
+// DeprecatedFields records and warns about deprecated top-level fields in JSON request bodies.
+// fields maps each deprecated field to a description of its replacement.
+func DeprecatedFields(tracker *DeprecationTracker, fields map[string]string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		body, err := io.ReadAll(ctx.Request.Body)
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			ctx.Next()
+			return
+		}
+
+		var payload map[string]json.RawMessage
+		if json.Unmarshal(body, &payload) == nil {
+			for field, replacement := range fields {
+				if _, ok := payload[field]; ok {
+					addWarning(ctx, fmt.Sprintf("field %q is deprecated, use %s", field, replacement))
+					tracker.Record(ctx, DeprecatedField, ctx.FullPath()+" "+field)
+				}
+			}
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// EventAPIController handles HTTP requests about model lifecycle events
+type EventAPIController struct {
+	events EventLog
+	logger *zap.SugaredLogger
+}
+
+// NewEventAPIController creates a new event API controller
+func NewEventAPIController(events EventLog, logger *zap.SugaredLogger) *EventAPIController {
+	return &EventAPIController{
+		events: events,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the event API
+func (c *EventAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1")
+	{
+		api.GET("/events", c.HandleEvents)
+	}
+}
+
+// HandleEvents handles model lifecycle event requests
+// @Summary List model lifecycle events
+// @Description List recorded model lifecycle events, such as trained and promoted model versions, newest first
+// @Produce json
+// @Param type query string false "Event type: model_trained, model_promoted, model_rolled_back, drift_detected or artifact_deleted"
+// @Param model_version query string false "Model version, e.g. 20250301T120000Z"
+// @Param from query string false "Events recorded on or after this date (YYYY-MM-DD)"
+// @Param to query string false "Events recorded on or before this date (YYYY-MM-DD)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param offset query int false "Number of events to skip (default 0)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/events [get]
+func (c *EventAPIController) HandleEvents(ctx *gin.Context) {
+	limit, offset, ok := parsePagination(ctx)
+	if !ok {
+		return
+	}
+	from, to, ok := parseDateRange(ctx)
+	if !ok {
+		return
+	}
+
+	eventType := ctx.Query("type")
+	if eventType != "" && !slices.Contains(service.EventTypes, eventType) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "type must be one of " + strings.Join(service.EventTypes, ", ")})
+		return
+	}
+
+	filter := service.EventFilter{
+		Type:         eventType,
+		ModelVersion: ctx.Query("model_version"),
+		From:         from,
+		To:           to,
+	}
+
+	events, total, err := c.events.List(filter, limit, offset)
+	if err != nil {
+		c.logger.Errorw("Error listing events", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list events"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":  events,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
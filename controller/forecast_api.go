@@ -0,0 +1,329 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// ForecastAPIController handles HTTP requests for stored and launch forecasts
+type ForecastAPIController struct {
+	forecastService  ForecastService
+	recomputer       ForecastRecomputer
+	recomputeTimeout time.Duration
+	auditLog         AuditLog
+	logger           *zap.SugaredLogger
+}
+
+// NewForecastAPIController creates a new forecast API controller
+func NewForecastAPIController(forecastService ForecastService, recomputer ForecastRecomputer, recomputeTimeout time.Duration, auditLog AuditLog, logger *zap.SugaredLogger) *ForecastAPIController {
+	return &ForecastAPIController{
+		forecastService:  forecastService,
+		recomputer:       recomputer,
+		recomputeTimeout: recomputeTimeout,
+		auditLog:         auditLog,
+		logger:           logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the forecast API
+func (c *ForecastAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1")
+	{
+		api.GET("/forecasts", c.HandleForecasts)
+		api.GET("/forecasts/accuracy", c.HandleForecastAccuracy)
+		api.POST("/forecasts/launch", c.HandleLaunchForecast)
+		api.POST("/forecasts/recompute", Audited(c.auditLog, service.AuditActionRecompute),
+			RequestTimeout(c.recomputeTimeout), c.HandleRecompute)
+		api.GET("/metrics/accuracy/leaderboard", c.HandleAccuracyLeaderboard)
+		api.GET("/products/:name/timeseries", c.HandleTimeSeries)
+	}
+}
+
+// HandleForecasts handles forecast history requests
+// @Summary Latest forecasts per date
+// @Description List the most recent stored forecast for every target date of a product, with actuals once known; with Accept: application/x-ndjson the forecasts are streamed one per line, followed by a summary line
+// @Produce json,application/x-ndjson
+// @Param product query string true "Product name"
+// @Param region query string true "Region"
+// @Param seller query string true "Seller"
+// @Param from query string false "First forecast date, YYYY-MM-DD (default 30 days ago)"
+// @Param to query string false "Last forecast date, YYYY-MM-DD (default today)"
+// @Success 200 {object} map[string][]service.Forecast
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/forecasts [get]
+func (c *ForecastAPIController) HandleForecasts(ctx *gin.Context) {
+	product, region, seller := ctx.Query("product"), ctx.Query("region"), ctx.Query("seller")
+	if product == "" || region == "" || seller == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "product, region and seller are required"})
+		return
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if value := ctx.Query("from"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date in YYYY-MM-DD format"})
+			return
+		}
+		from = date
+	}
+	if value := ctx.Query("to"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date in YYYY-MM-DD format"})
+			return
+		}
+		to = date
+	}
+
+	if wantsNDJSON(ctx) {
+		writer := newNDJSONWriter(ctx)
+		err := c.forecastService.EachLatestForecast(product, region, seller, from, to, func(forecast *service.Forecast) error {
+			return writer.Write(forecast)
+		})
+		if err != nil {
+			c.logger.Errorw("Error streaming forecasts", "error", err)
+			err = errors.New("failed to list forecasts")
+		}
+		writer.Close(NDJSONSummary{}, err)
+		return
+	}
+
+	forecasts, err := c.forecastService.LatestForecasts(product, region, seller, from, to)
+	if err != nil {
+		c.logger.Errorw("Error listing forecasts", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list forecasts"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"items": forecasts})
+}
+
+// HandleLaunchForecast handles new-product launch forecast requests
+// @Summary Launch forecast of a product without history
+// @Description Forecast the daily sales of a new product from the launches of analog products of its category, preferring its brand, adjusted to the planned price. The response is labeled with mode cold_start
+// @Accept json
+// @Produce json
+// @Param request body service.LaunchForecastRequest true "Product about to launch"
+// @Success 200 {object} service.LaunchForecast
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/forecasts/launch [post]
+func (c *ForecastAPIController) HandleLaunchForecast(ctx *gin.Context) {
+	var request service.LaunchForecastRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	forecast, err := c.forecastService.Launch(&request)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidLaunchRequest):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrProductHasHistory):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrNoLaunchAnalogs):
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.logger.Errorw("Error building launch forecast", "error", err, "category", request.Category)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build launch forecast"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, forecast)
+}
+
+// HandleRecompute handles forecast recompute requests
+// @Summary Recompute stored forecasts
+// @Description Delete the stored forecasts of a product, region and seller filter and date range, of every model version, and predict them again on their dates with the installed models, for use after backfills or corrections of processed_data. External features are fetched again instead of read from the provider cache, and the actuals of past dates are filled in by the next reconciliation
+// @Accept json
+// @Produce json
+// @Param request body service.ForecastRecomputeRequest true "Forecasts to recompute"
+// @Success 200 {object} service.ForecastRecomputeReport
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /api/v1/forecasts/recompute [post]
+func (c *ForecastAPIController) HandleRecompute(ctx *gin.Context) {
+	var request service.ForecastRecomputeRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	report, err := c.recomputer.Recompute(ctx.Request.Context(), &request)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRecomputeRequest) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if respondContextError(ctx, err) {
+			c.logger.Warnw("Forecast recompute did not complete in time", "error", err)
+			return
+		}
+		c.logger.Errorw("Error recomputing forecasts", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to recompute forecasts"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// HandleForecastAccuracy handles forecast accuracy requests
+// @Summary Accuracy of stored forecasts
+// @Description Report the configured error metrics (EVALUATION_METRICS) of the stored forecasts whose actuals are known, for price and sales, overall and optionally per category, region or seller
+// @Produce json
+// @Param from query string false "First forecast date, YYYY-MM-DD"
+// @Param to query string false "Last forecast date, YYYY-MM-DD"
+// @Param model_version query string false "Only forecasts of this model version"
+// @Param group_by query string false "Segment breakdown: category, region or seller"
+// @Success 200 {object} service.AccuracyReport
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/forecasts/accuracy [get]
+func (c *ForecastAPIController) HandleForecastAccuracy(ctx *gin.Context) {
+	request := service.AccuracyRequest{
+		ModelVersion: ctx.Query("model_version"),
+		GroupBy:      ctx.Query("group_by"),
+	}
+	for _, bound := range []struct {
+		name string
+		date *time.Time
+	}{{"from", &request.From}, {"to", &request.To}} {
+		value := ctx.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": bound.name + " must be a date in YYYY-MM-DD format"})
+			return
+		}
+		*bound.date = date
+	}
+
+	report, err := c.forecastService.Accuracy(&request)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAccuracyRequest) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.Errorw("Error evaluating forecasts", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate forecasts"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// HandleAccuracyLeaderboard handles accuracy leaderboard requests
+// @Summary Best- and worst-forecasted products
+// @Description Rank the products, per region and seller, by the error of their forecasts with actuals over the last days, with the coverage of their history over the same window
+// @Produce json
+// @Param days query int false "Window of forecast dates ending today (default 30, max 365)"
+// @Param limit query int false "Products on each side of the leaderboard (default 10, max 100)"
+// @Param target query string false "sales (default) or price"
+// @Param metric query string false "Ranking metric: mae, rmse, mape, smape, wape (default) or bias"
+// @Param min_forecasts query int false "Minimum forecasts with actuals for a product to be ranked (default 3)"
+// @Success 200 {object} service.AccuracyLeaderboard
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/metrics/accuracy/leaderboard [get]
+func (c *ForecastAPIController) HandleAccuracyLeaderboard(ctx *gin.Context) {
+	request := service.LeaderboardRequest{
+		Target: ctx.Query("target"),
+		Metric: ctx.Query("metric"),
+	}
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{"days", &request.Days}, {"limit", &request.Limit}, {"min_forecasts", &request.MinForecasts}} {
+		value := ctx.Query(param.name)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": param.name + " must be an integer"})
+			return
+		}
+		*param.value = number
+	}
+
+	leaderboard, err := c.forecastService.AccuracyLeaderboard(&request)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAccuracyRequest) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.Errorw("Error building accuracy leaderboard", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build accuracy leaderboard"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, leaderboard)
+}
+
+// HandleTimeSeries handles chart data requests
+// @Summary History and forecasts of a product for charts
+// @Description Return one point per day of the range with the actual price and sales of a product, region and seller merged with its latest stored forecasts and their confidence bands
+// @Produce json
+// @Param name path string true "Product name"
+// @Param region query string true "Region"
+// @Param seller query string true "Seller"
+// @Param from query string false "First date, YYYY-MM-DD (default 89 days before to)"
+// @Param to query string false "Last date, YYYY-MM-DD (default today)"
+// @Success 200 {object} service.TimeSeries
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/products/{name}/timeseries [get]
+func (c *ForecastAPIController) HandleTimeSeries(ctx *gin.Context) {
+	product, region, seller := ctx.Param("name"), ctx.Query("region"), ctx.Query("seller")
+	if region == "" || seller == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "region and seller are required"})
+		return
+	}
+
+	var from, to time.Time
+	for _, bound := range []struct {
+		name string
+		date *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := ctx.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": bound.name + " must be a date in YYYY-MM-DD format"})
+			return
+		}
+		*bound.date = date
+	}
+
+	series, err := c.forecastService.TimeSeries(product, region, seller, from, to)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTimeSeriesRequest) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.Errorw("Error building time series", "error", err, "product", product)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build time series"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, series)
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// JobAPIController handles HTTP requests about the history of background jobs
+type JobAPIController struct {
+	scheduler Scheduler
+	logger    *zap.SugaredLogger
+}
+
+// NewJobAPIController creates a new job API controller
+func NewJobAPIController(scheduler Scheduler, logger *zap.SugaredLogger) *JobAPIController {
+	return &JobAPIController{
+		scheduler: scheduler,
+		logger:    logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the job API
+func (c *JobAPIController) RegisterRoutes(router gin.IRouter) {
+	api := router.Group("/api/v1")
+	{
+		api.GET("/jobs", c.HandleJobHistory)
+	}
+}
+
+// HandleJobHistory handles job history requests
+// @Summary List background job runs
+// @Description List recorded runs of background jobs with their parameters, duration, status, error and trigger, newest first
+// @Produce json
+// @Param type query string false "Job type, e.g. retrain"
+// @Param status query string false "running, succeeded or failed"
+// @Param triggered_by query string false "schedule or manual"
+// @Param from query string false "Runs started on or after this date (YYYY-MM-DD)"
+// @Param to query string false "Runs started on or before this date (YYYY-MM-DD)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param offset query int false "Number of runs to skip (default 0)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/jobs [get]
+func (c *JobAPIController) HandleJobHistory(ctx *gin.Context) {
+	limit, offset, ok := parsePagination(ctx)
+	if !ok {
+		return
+	}
+
+	from, to, ok := parseDateRange(ctx)
+	if !ok {
+		return
+	}
+
+	filter := service.JobFilter{
+		JobType:     ctx.Query("type"),
+		Status:      ctx.Query("status"),
+		TriggeredBy: ctx.Query("triggered_by"),
+		From:        from,
+		To:          to,
+	}
+
+	executions, total, err := c.scheduler.History(filter, limit, offset)
+	if err != nil {
+		c.logger.Errorw("Error listing job history", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list job history"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":  executions,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// parseDateRange parses the optional from and to date query parameters, writing an error response
+// if they are invalid. The returned end is exclusive, so that the whole to day is included
+func parseDateRange(ctx *gin.Context) (time.Time, time.Time, bool) {
+	var from, to time.Time
+	if value := ctx.Query("from"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date in YYYY-MM-DD format"})
+			return from, to, false
+		}
+		from = date
+	}
+	if value := ctx.Query("to"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date in YYYY-MM-DD format"})
+			return from, to, false
+		}
+		to = date.AddDate(0, 0, 1)
+	}
+	return from, to, true
+}
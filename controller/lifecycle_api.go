@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// LifecycleAPIController handles the hooks of the container orchestrator. Its routes are served
+// under /internal, which the ingress should not expose
+type LifecycleAPIController struct {
+	lifecycle    *service.Lifecycle
+	auditLog     AuditLog
+	drainTimeout time.Duration
+	preStopDelay time.Duration
+	logger       *zap.SugaredLogger
+}
+
+// PreStopResponse reports whether the replica finished its work before the preStop hook returned
+type PreStopResponse struct {
+	service.LifecycleState
+	Drained  bool  `json:"drained"`
+	WaitedMs int64 `json:"waited_ms"`
+}
+
+// NewLifecycleAPIController creates a new lifecycle API controller
+func NewLifecycleAPIController(lifecycle *service.Lifecycle, auditLog AuditLog, drainTimeout, preStopDelay time.Duration, logger *zap.SugaredLogger) *LifecycleAPIController {
+	return &LifecycleAPIController{
+		lifecycle:    lifecycle,
+		auditLog:     auditLog,
+		drainTimeout: drainTimeout,
+		preStopDelay: preStopDelay,
+		logger:       logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the lifecycle API
+func (c *LifecycleAPIController) RegisterRoutes(router *gin.Engine) {
+	internal := router.Group("/internal")
+	{
+		internal.POST("/prestop", Audited(c.auditLog, service.AuditActionLameDuck), c.HandlePreStop)
+	}
+}
+
+// HandlePreStop handles preStop hooks
+// @Summary preStop hook
+// @Description Enter lame-duck mode and wait until the background jobs are done or the drain timeout, counted from the start of lame-duck mode, is over. The response is held for at least PRESTOP_DELAY so that the failing readiness probe takes the replica out of the load balancer before it is sent SIGTERM
+// @Produce json
+// @Success 200 {object} PreStopResponse
+// @Failure 503 {object} PreStopResponse
+// @Router /internal/prestop [post]
+func (c *LifecycleAPIController) HandlePreStop(ctx *gin.Context) {
+	started := time.Now()
+	c.lifecycle.EnterLameDuck()
+	c.logger.Infow("Entered lame-duck mode", "source", "prestop", "in_flight_jobs", c.lifecycle.State().InFlightJobs)
+
+	// The wait may outlast HTTP_WRITE_TIMEOUT, which is sized for the slowest handler
+	_ = http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{})
+
+	delay := time.NewTimer(c.preStopDelay)
+	defer delay.Stop()
+	waitCtx, cancel := context.WithDeadline(ctx.Request.Context(), c.lifecycle.DrainDeadline(c.drainTimeout))
+	defer cancel()
+	drained := c.lifecycle.Wait(waitCtx) == nil
+	select {
+	case <-delay.C:
+	case <-ctx.Request.Context().Done():
+	}
+
+	response := PreStopResponse{
+		LifecycleState: c.lifecycle.State(),
+		Drained:        drained,
+		WaitedMs:       time.Since(started).Milliseconds(),
+	}
+	if !drained {
+		c.logger.Warnw("Background jobs still running at the end of the preStop hook", "in_flight_jobs", response.InFlightJobs)
+		ctx.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	c.logger.Infow("Drained for the preStop hook", "waited_ms", response.WaitedMs)
+	ctx.JSON(http.StatusOK, response)
+}
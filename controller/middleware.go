@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+)
+
+// RequestTimeout bounds the request context to the given duration.
+// If the deadline expires before the handler writes a response, a 504 is returned.
+func RequestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		ctx.Next()
+
+		if !ctx.Writer.Written() {
+			respondContextError(ctx, reqCtx.Err())
+		}
+	}
+}
+
+// respondContextError writes a structured 504/503 response if err was caused by the request
+// deadline or by cancellation, and reports whether a response was written
+func respondContextError(ctx *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		ctx.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+			"error": "Request timed out",
+			"code":  "timeout",
+		})
+		return true
+	case errors.Is(err, context.Canceled):
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Request was cancelled before it could complete",
+			"code":  "cancelled",
+		})
+		return true
+	}
+	return false
+}
+
+// respondModelIncompatible writes a 503 response when the installed models no longer match the
+// feature builder and reports whether it did. The models have to be retrained before they serve again.
+func respondModelIncompatible(ctx *gin.Context, err error) bool {
+	if !errors.Is(err, service.ErrModelIncompatible) {
+		return false
+	}
+	ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+		"error": err.Error(),
+		"code":  "model_incompatible",
+	})
+	return true
+}
+
+// respondUnseenCategory writes a 422 response when the installed models reject a category value they
+// were not trained on, and reports whether it did
+func respondUnseenCategory(ctx *gin.Context, err error) bool {
+	if !errors.Is(err, service.ErrUnseenCategory) {
+		return false
+	}
+	ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+		"error": err.Error(),
+		"code":  "unseen_category",
+	})
+	return true
+}
+
+// respondPredictionDate writes a 422 response with the error code and the allowed range when a
+// prediction date is out of the range of its key's history, and reports whether it did
+func respondPredictionDate(ctx *gin.Context, err error) bool {
+	var dateErr *service.PredictionDateError
+	if !errors.As(err, &dateErr) {
+		return false
+	}
+	response := gin.H{
+		"error":         err.Error(),
+		"code":          dateErr.Code,
+		"earliest_date": dateErr.Earliest.Format("2006-01-02"),
+	}
+	if dateErr.Latest != nil {
+		response["latest_date"] = dateErr.Latest.Format("2006-01-02")
+	}
+	ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, response)
+	return true
+}
+
+// RequestMetrics records the count, status and latency of every request by its route pattern and
+// tracks the SLOs covering the route
+func RequestMetrics(m *metrics.HTTPMetrics, slos *metrics.SLOTracker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		started := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			// Unmatched paths are grouped to keep label cardinality bounded
+			route = "unmatched"
+		}
+		duration := time.Since(started)
+		m.Observe(ctx.Request.Method, route, ctx.Writer.Status(), duration)
+		slos.Observe(ctx.Request.Method, route, ctx.Writer.Status(), duration)
+	}
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// TrackUsage records every request in the usage analytics by client and route pattern, with its
+// status, latency and the sizes of its request and response bodies. Request bodies without a
+// Content-Length count the bytes the handler read
+func TrackUsage(usage UsageTracker) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		started := time.Now()
+		var body *countingReader
+		if ctx.Request.Body != nil {
+			body = &countingReader{ReadCloser: ctx.Request.Body}
+			ctx.Request.Body = body
+		}
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		record := &service.APIUsageRecord{
+			Client:        clientID(ctx),
+			Method:        ctx.Request.Method,
+			Route:         route,
+			StatusCode:    ctx.Writer.Status(),
+			Duration:      time.Since(started),
+			RequestBytes:  max(ctx.Request.ContentLength, 0),
+			ResponseBytes: int64(max(ctx.Writer.Size(), 0)),
+			At:            started,
+		}
+		if body != nil && body.n > record.RequestBytes {
+			record.RequestBytes = body.n
+		}
+		usage.Record(record)
+	}
+}
@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// ModelAPIController handles HTTP requests about trained model versions
+type ModelAPIController struct {
+	mlService ModelService
+	standby   StandbyModel
+	golden    GoldenSet
+	activator ModelActivator
+	auditLog  AuditLog
+	logger    *zap.SugaredLogger
+}
+
+// NewModelAPIController creates a new model API controller
+func NewModelAPIController(mlService ModelService, standby StandbyModel, golden GoldenSet, activator ModelActivator, auditLog AuditLog, logger *zap.SugaredLogger) *ModelAPIController {
+	return &ModelAPIController{
+		mlService: mlService,
+		standby:   standby,
+		golden:    golden,
+		activator: activator,
+		auditLog:  auditLog,
+		logger:    logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the model API
+func (c *ModelAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/models")
+	{
+		api.GET("/metrics", c.HandleMetrics)
+		api.GET("/versions", c.HandleVersions)
+		api.POST("/versions/:version/activate", Audited(c.auditLog, service.AuditActionActivateModel), c.HandleActivateVersion)
+		api.GET("/coverage", c.HandleCoverage)
+		api.GET("/encoders", c.HandleEncoders)
+		api.GET("/standby", c.HandleStandby)
+		api.POST("/standby/promote", Audited(c.auditLog, service.AuditActionPromoteModel), c.HandlePromoteStandby)
+		api.DELETE("/standby", Audited(c.auditLog, service.AuditActionDiscardModel), c.HandleDiscardStandby)
+		api.GET("/golden", c.HandleGoldenCheck)
+		api.POST("/golden/verify", Audited(c.auditLog, service.AuditActionVerifyModel), c.HandleVerifyGolden)
+	}
+}
+
+// HandleMetrics handles model metrics history requests
+// @Summary Training metrics history
+// @Description Time series of validation metrics (RMSE best_score and MAE) per training run from the model registry
+// @Produce json
+// @Param from query string false "Start date (YYYY-MM-DD), default one year ago"
+// @Param to query string false "End date (YYYY-MM-DD), default today"
+// @Success 200 {object} map[string][]service.ModelVersionMetrics
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/models/metrics [get]
+func (c *ModelAPIController) HandleMetrics(ctx *gin.Context) {
+	to := time.Now()
+	from := to.AddDate(-1, 0, 0)
+
+	if value := ctx.Query("from"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date in YYYY-MM-DD format"})
+			return
+		}
+		from = date
+	}
+	if value := ctx.Query("to"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date in YYYY-MM-DD format"})
+			return
+		}
+		// Include the whole end day
+		to = date.AddDate(0, 0, 1)
+	}
+
+	metrics, err := c.mlService.ListModelMetrics(from, to)
+	if err != nil {
+		c.logger.Errorw("Error listing model metrics", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list model metrics"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"items": metrics})
+}
+
+// HandleVersions handles model version list requests
+// @Summary List model versions
+// @Description Registered model versions, newest first, with their validation metrics, the dataset hash and row count of the training run that produced them, and whether they are active or in the standby slot
+// @Produce json
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param offset query int false "Number of versions to skip (default 0)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/models/versions [get]
+func (c *ModelAPIController) HandleVersions(ctx *gin.Context) {
+	limit, offset, ok := parsePagination(ctx)
+	if !ok {
+		return
+	}
+
+	versions, total, err := c.mlService.ListModelVersions(limit, offset)
+	if err != nil {
+		c.logger.Errorw("Error listing model versions", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list model versions"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":  versions,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// HandleActivateVersion handles model version activation requests
+// @Summary Activate a model version
+// @Description Make a registered version the active one, e.g. to roll back. Its artifacts are read from the artifact store and checked before the registry is changed; this replica installs them at once and the others within MODEL_SYNC_INTERVAL
+// @Produce json
+// @Param version path string true "Model version"
+// @Success 200 {object} service.ModelActivation
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/models/versions/{version}/activate [post]
+func (c *ModelAPIController) HandleActivateVersion(ctx *gin.Context) {
+	version := ctx.Param("version")
+	activation, err := c.activator.Activate(ctx.Request.Context(), version)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownModelVersion):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrModelVersionNotStored):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrModelIncompatible), errors.Is(err, service.ErrSampledModel):
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.logger.Errorw("Error activating model version", "error", err, "version", version)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to activate model version"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, activation)
+}
+
+// HandleCoverage handles model coverage requests
+// @Summary Model coverage across segments
+// @Description Data volume, serving model and last training date of every category/region segment, flagging segments that fall back to the global model
+// @Produce json
+// @Success 200 {object} map[string][]service.SegmentCoverage
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/models/coverage [get]
+func (c *ModelAPIController) HandleCoverage(ctx *gin.Context) {
+	coverage, err := c.mlService.ModelCoverage()
+	if err != nil {
+		c.logger.Errorw("Error listing model coverage", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list model coverage"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"items": coverage})
+}
+
+// HandleEncoders handles category encoder requests
+// @Summary Category encoders of the installed models
+// @Description Categories of brand, region, category and seller the installed models were trained on, with the policy applied to values outside them
+// @Produce json
+// @Success 200 {object} service.CategoryEncoders
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/models/encoders [get]
+func (c *ModelAPIController) HandleEncoders(ctx *gin.Context) {
+	encoders, err := c.mlService.ModelEncoders()
+	if err != nil {
+		c.logger.Errorw("Error reading model encoders", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read model encoders"})
+		return
+	}
+	if encoders == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "The installed models have no category encoders"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, encoders)
+}
+
+// HandleStandby handles standby slot requests
+// @Summary Standby model version
+// @Description The version shadow-tested next to the active one, its shadow predictions and the checks they still fail before the standby_promotion job promotes it
+// @Produce json
+// @Success 200 {object} service.StandbyStatus
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/models/standby [get]
+func (c *ModelAPIController) HandleStandby(ctx *gin.Context) {
+	status, err := c.standby.Status()
+	if err != nil {
+		c.logger.Errorw("Error getting standby model status", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get standby model status"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, status)
+}
+
+// HandlePromoteStandby handles standby promotion requests
+// @Summary Promote the standby model version
+// @Description Make the standby version the active one without waiting for its shadow predictions to pass the checks
+// @Produce json
+// @Success 200 {object} service.StandbyStatus
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/models/standby/promote [post]
+func (c *ModelAPIController) HandlePromoteStandby(ctx *gin.Context) {
+	status, err := c.standby.Promote(ctx.Request.Context())
+	if errors.Is(err, service.ErrNoStandbyModel) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No standby model version"})
+		return
+	}
+	if err != nil {
+		c.logger.Errorw("Error promoting standby model version", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to promote standby model version"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, status)
+}
+
+// HandleDiscardStandby handles standby discard requests
+// @Summary Discard the standby model version
+// @Description Take the standby version out of the slot without promoting it, keeping the active version
+// @Produce json
+// @Success 200 {object} service.StandbyStatus
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/models/standby [delete]
+func (c *ModelAPIController) HandleDiscardStandby(ctx *gin.Context) {
+	status, err := c.standby.Discard()
+	if errors.Is(err, service.ErrNoStandbyModel) {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No standby model version"})
+		return
+	}
+	if err != nil {
+		c.logger.Errorw("Error discarding standby model version", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discard standby model version"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, status)
+}
+
+// HandleGoldenCheck handles golden set check requests
+// @Summary Latest golden set check
+// @Description Outcome of the latest run of the golden set through the models loaded by this replica, compared with the outputs recorded for the model version
+// @Produce json
+// @Success 200 {object} service.GoldenCheck
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/models/golden [get]
+func (c *ModelAPIController) HandleGoldenCheck(ctx *gin.Context) {
+	check, err := c.golden.Last()
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if check == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "The loaded models have not been checked yet"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, check)
+}
+
+// HandleVerifyGolden handles golden set verification requests
+// @Summary Verify the loaded models against the golden set
+// @Description Run the golden set through the models loaded by this replica now and compare the outputs with those recorded for the model version, recording the missing ones
+// @Produce json
+// @Success 200 {object} service.GoldenCheck
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/models/golden/verify [post]
+func (c *ModelAPIController) HandleVerifyGolden(ctx *gin.Context) {
+	check, err := c.golden.Verify(ctx.Request.Context())
+	switch {
+	case errors.Is(err, service.ErrGoldenSetDisabled):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrNoModelVersion):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.logger.Errorw("Error verifying models against the golden set", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify models against the golden set"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, check)
+}
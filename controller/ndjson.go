@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ndjsonContentType is the media type of newline-delimited JSON responses
+const ndjsonContentType = "application/x-ndjson"
+
+// wantsNDJSON reports whether the client asked for a newline-delimited JSON stream
+func wantsNDJSON(ctx *gin.Context) bool {
+	return strings.Contains(ctx.GetHeader("Accept"), ndjsonContentType)
+}
+
+// NDJSONSummary is the trailer line ending every NDJSON stream. Complete is false when the stream
+// was cut short by an error, which is then reported in Error, since the status code was already sent
+type NDJSONSummary struct {
+	Count     int    `json:"count"`
+	Succeeded *int   `json:"succeeded,omitempty"`
+	Failed    *int   `json:"failed,omitempty"`
+	Complete  bool   `json:"complete"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ndjsonWriter writes records as newline-delimited JSON, flushing each one to the client as it is written
+type ndjsonWriter struct {
+	ctx     *gin.Context
+	encoder *json.Encoder
+	count   int
+}
+
+// newNDJSONWriter starts a 200 NDJSON response
+func newNDJSONWriter(ctx *gin.Context) *ndjsonWriter {
+	ctx.Header("Content-Type", ndjsonContentType)
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	ctx.Status(http.StatusOK)
+	return &ndjsonWriter{
+		ctx:     ctx,
+		encoder: json.NewEncoder(ctx.Writer),
+	}
+}
+
+// Write sends one record; it fails once the client has gone away
+func (w *ndjsonWriter) Write(record any) error {
+	if err := w.ctx.Request.Context().Err(); err != nil {
+		return err
+	}
+	if err := w.encoder.Encode(record); err != nil {
+		return err
+	}
+	w.count++
+	w.ctx.Writer.Flush()
+	return nil
+}
+
+// Close sends the summary trailer with the number of records written and the error that ended the
+// stream, if any
+func (w *ndjsonWriter) Close(summary NDJSONSummary, err error) {
+	summary.Count = w.count
+	summary.Complete = err == nil
+	if err != nil {
+		summary.Error = err.Error()
+	}
+	w.encoder.Encode(gin.H{"summary": summary})
+	w.ctx.Writer.Flush()
+}
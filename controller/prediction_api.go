@@ -1,7 +1,11 @@
 package controller
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/graduate-work-mirea/data-processor-service/service"
@@ -10,15 +14,28 @@ import (
 
 // PredictionAPIController handles HTTP requests for ML predictions
 type PredictionAPIController struct {
-	mlService *service.MLPredictionService
-	logger    *zap.SugaredLogger
+	mlService      PredictionService
+	trainingJobs   TrainingJobService
+	predictTimeout time.Duration
+	trainTimeout   time.Duration
+	// v1Sunset is the date the v1 prediction routes are removed, zero while they are not deprecated
+	v1Sunset     time.Time
+	deprecations *DeprecationTracker
+	auditLog     AuditLog
+	logger       *zap.SugaredLogger
 }
 
 // NewPredictionAPIController creates a new prediction API controller
-func NewPredictionAPIController(mlService *service.MLPredictionService, logger *zap.SugaredLogger) *PredictionAPIController {
+func NewPredictionAPIController(mlService PredictionService, trainingJobs TrainingJobService, predictTimeout, trainTimeout time.Duration, v1Sunset time.Time, deprecations *DeprecationTracker, auditLog AuditLog, logger *zap.SugaredLogger) *PredictionAPIController {
 	return &PredictionAPIController{
-		mlService: mlService,
-		logger:    logger,
+		mlService:      mlService,
+		trainingJobs:   trainingJobs,
+		predictTimeout: predictTimeout,
+		trainTimeout:   trainTimeout,
+		v1Sunset:       v1Sunset,
+		deprecations:   deprecations,
+		auditLog:       auditLog,
+		logger:         logger,
 	}
 }
 
@@ -26,22 +43,50 @@ func NewPredictionAPIController(mlService *service.MLPredictionService, logger *
 func (c *PredictionAPIController) RegisterRoutes(router *gin.Engine) {
 	api := router.Group("/api/v1")
 	{
-		api.POST("/predict", c.HandlePredict)
-		api.POST("/predict/minimal", c.HandlePredictMinimal)
-		api.POST("/train", c.HandleTrain)
-		api.GET("/status", c.HandleStatus)
+		api.POST("/predict", c.deprecatedBy("/api/v2/predictions/features"),
+			RequestTimeout(c.predictTimeout), c.HandlePredict)
+		api.POST("/predict/minimal", c.deprecatedBy("/api/v2/predictions"),
+			c.deprecatedFields(map[string]string{"prediction_date": `"date" of /api/v2/predictions`}),
+			RequestTimeout(c.predictTimeout), c.HandlePredictMinimal)
+		api.GET("/features", c.HandleFeatures)
+		api.POST("/predictions/:id/reproduce", RequestTimeout(c.predictTimeout), c.HandleReproduce)
+		api.POST("/train", Audited(c.auditLog, service.AuditActionTrain),
+			RequestTimeout(c.trainTimeout), c.HandleTrain)
+		api.GET("/train/jobs/:id", c.HandleTrainJob)
+		api.GET("/train/history", c.HandleTrainHistory)
+		api.GET("/train/history/:id/learning-curve", c.HandleLearningCurve)
 	}
 }
 
+// deprecatedBy marks a v1 route as deprecated in favour of its v2 successor once a sunset date is configured
+func (c *PredictionAPIController) deprecatedBy(successor string) gin.HandlerFunc {
+	if c.v1Sunset.IsZero() {
+		return func(ctx *gin.Context) { ctx.Next() }
+	}
+	return Deprecated(c.deprecations, c.v1Sunset, successor)
+}
+
+// deprecatedFields tracks v1 request fields renamed in v2 once a sunset date is configured
+func (c *PredictionAPIController) deprecatedFields(fields map[string]string) gin.HandlerFunc {
+	if c.v1Sunset.IsZero() {
+		return func(ctx *gin.Context) { ctx.Next() }
+	}
+	return DeprecatedFields(c.deprecations, fields)
+}
+
 // HandlePredict handles prediction requests with full feature set
 // @Summary Make a price and sales prediction with full feature set
 // @Description Predict future price and sales for a product based on input features
 // @Accept json
 // @Produce json
 // @Param request body service.PredictionRequest true "Product data for prediction"
+// @Param baseline query bool false "Add the naive baseline predictions"
+// @Param explain query bool false "Add the SHAP contributions of the features"
 // @Success 200 {object} service.PredictionResult
 // @Failure 400 {object} map[string]string
+// @Failure 422 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 501 {object} map[string]string
 // @Router /api/v1/predict [post]
 func (c *PredictionAPIController) HandlePredict(ctx *gin.Context) {
 	var request service.PredictionRequest
@@ -58,13 +103,25 @@ func (c *PredictionAPIController) HandlePredict(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Price must be positive"})
 		return
 	}
+	baseline, ok := parseBaseline(ctx)
+	if !ok {
+		return
+	}
+	explain, ok := parseFlag(ctx, "explain")
+	if !ok {
+		return
+	}
 
 	// Make prediction
-	result, err := c.mlService.Predict(&request)
+	result, err := c.mlService.Predict(ctx.Request.Context(), &request)
 	if err != nil {
 		c.logger.Errorw("Error making prediction", "error", err,
 			"product", request.ProductName, "region", request.Region, "seller", request.Seller)
 
+		if respondContextError(ctx, err) || respondModelIncompatible(ctx, err) || respondUnseenCategory(ctx, err) {
+			return
+		}
+
 		// Check if this might be a problem with JSON parsing from Python script
 		if err.Error() == "error extracting JSON from output" ||
 			err.Error() == "error parsing prediction results" {
@@ -78,19 +135,87 @@ func (c *PredictionAPIController) HandlePredict(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make prediction: " + err.Error()})
 		return
 	}
+	if baseline {
+		result.Baselines = service.NaiveBaselines(&request)
+	}
+	if explain {
+		explanation, err := c.mlService.Explain(ctx.Request.Context(), &request)
+		if err != nil {
+			c.logger.Errorw("Error explaining prediction", "error", err,
+				"product", request.ProductName, "region", request.Region, "seller", request.Seller)
+			if respondContextError(ctx, err) || respondModelIncompatible(ctx, err) {
+				return
+			}
+			if errors.Is(err, service.ErrExplainNotSupported) {
+				ctx.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to explain prediction: " + err.Error()})
+			return
+		}
+		result.Explanation = explanation
+	}
 
 	// Return prediction result
 	ctx.JSON(http.StatusOK, result)
 }
 
+// HandleReproduce handles prediction reproduction requests
+// @Summary Reproduce a recorded prediction
+// @Description Re-run a prediction from the prediction log with its recorded feature vector and model version and report whether the output matches
+// @Produce json
+// @Param id path int true "Prediction ID"
+// @Param tolerance query number false "Largest absolute difference of price and sales that still matches (default 0)"
+// @Success 200 {object} service.PredictionReproduction
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 504 {object} map[string]string
+// @Router /api/v1/predictions/{id}/reproduce [post]
+func (c *PredictionAPIController) HandleReproduce(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prediction ID"})
+		return
+	}
+	tolerance, err := strconv.ParseFloat(ctx.DefaultQuery("tolerance", "0"), 64)
+	if err != nil || tolerance < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "tolerance must be a non-negative number"})
+		return
+	}
+
+	reproduction, err := c.mlService.ReproducePrediction(ctx.Request.Context(), id, tolerance)
+	switch {
+	case errors.Is(err, service.ErrPredictionNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Prediction not found"})
+		return
+	case errors.Is(err, service.ErrModelVersionUnavailable), errors.Is(err, service.ErrModelIncompatible):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.logger.Errorw("Error reproducing prediction", "error", err, "prediction_id", id)
+		if respondContextError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reproduce prediction: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, reproduction)
+}
+
 // HandlePredictMinimal handles prediction requests with minimal input
 // @Summary Make a price and sales prediction with minimal input
-// @Description Predict future price and sales for a product using minimal input and auto-fetched historical data
+// @Description Predict price and sales for a product on any past or future date using minimal input and auto-fetched historical data. Dates outside the product's history and maximum horizon are rejected with 422 and a code
 // @Accept json
 // @Produce json
 // @Param request body service.PredictionRequestMinimal true "Minimal product data for prediction"
+// @Param baseline query bool false "Add the naive baseline predictions"
+// @Param debug query bool false "Add the provenance of every feature resolved from history"
 // @Success 200 {object} service.PredictionResult
 // @Failure 400 {object} map[string]string
+// @Failure 422 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /api/v1/predict/minimal [post]
 func (c *PredictionAPIController) HandlePredictMinimal(ctx *gin.Context) {
@@ -102,11 +227,28 @@ func (c *PredictionAPIController) HandlePredictMinimal(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
+	var ok bool
+	if request.Baseline, ok = parseBaseline(ctx); !ok {
+		return
+	}
+	if request.Debug, ok = parseDebug(ctx); !ok {
+		return
+	}
 
 	// Make prediction with minimal data
-	result, err := c.mlService.PredictMinimal(&request)
+	result, err := c.mlService.PredictMinimal(ctx.Request.Context(), &request)
 	if err != nil {
 		c.logger.Errorw("Error making prediction with minimal data", "error", err)
+		if respondContextError(ctx, err) {
+			return
+		}
+		if errors.Is(err, service.ErrStaleHistory) {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if respondPredictionDate(ctx, err) || respondModelIncompatible(ctx, err) || respondUnseenCategory(ctx, err) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make prediction: " + err.Error()})
 		return
 	}
@@ -115,40 +257,122 @@ func (c *PredictionAPIController) HandlePredictMinimal(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, result)
 }
 
+// HandleFeatures handles feature vector requests
+// @Summary Resolve the feature vector for a product
+// @Description Return the feature vector that a minimal prediction would send to the model, without running the model
+// @Produce json
+// @Param product query string true "Product name"
+// @Param region query string true "Region"
+// @Param seller query string true "Seller"
+// @Param date query string false "Prediction date in YYYY-MM-DD format (default today)"
+// @Success 200 {object} service.FeatureVector
+// @Failure 400 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Router /api/v1/features [get]
+func (c *PredictionAPIController) HandleFeatures(ctx *gin.Context) {
+	request := service.PredictionRequestMinimal{
+		ProductName: ctx.Query("product"),
+		Region:      ctx.Query("region"),
+		Seller:      ctx.Query("seller"),
+	}
+	if request.ProductName == "" || request.Region == "" || request.Seller == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "product, region and seller are required"})
+		return
+	}
+
+	if value := ctx.Query("date"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "date must be in YYYY-MM-DD format"})
+			return
+		}
+		request.PredictionDate = &date
+	}
+
+	vector, err := c.mlService.ResolveFeatures(ctx.Request.Context(), &request)
+	if err != nil {
+		if errors.Is(err, service.ErrStaleHistory) {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if respondPredictionDate(ctx, err) || respondUnseenCategory(ctx, err) {
+			return
+		}
+		c.logger.Errorw("Error resolving features", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve features"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, vector)
+}
+
+// TrainRequest is the optional body of a training request
+type TrainRequest struct {
+	// Sample makes the run a fast train on part of the training rows, whose models are never promoted
+	Sample *service.TrainingSample `json:"sample,omitempty"`
+}
+
 // HandleTrain handles model training requests
 // @Summary Train the prediction models
-// @Description Train the price and sales prediction models using the processed data
+// @Description Train the price and sales prediction models using the processed data. With a sample, train on a random percent or the last days of the rows for a quick experiment; such models are registered inactive and never promoted. With async=true the run is queued for a worker and its job is returned at once, to be followed at /api/v1/train/jobs/{id}
 // @Accept json
 // @Produce json
+// @Param request body TrainRequest false "Fast-train sample"
+// @Param async query bool false "Queue the run as a training job instead of waiting for it"
 // @Success 200 {object} service.TrainingResult
+// @Success 202 {object} service.TrainingJob
+// @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 507 {object} map[string]string
 // @Router /api/v1/train [post]
 func (c *PredictionAPIController) HandleTrain(ctx *gin.Context) {
+	// The body is optional, training without it uses the whole training window
+	var request TrainRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	async, ok := parseFlag(ctx, "async")
+	if !ok {
+		return
+	}
+	if async {
+		c.submitTraining(ctx, request)
+		return
+	}
+
 	// Train models
-	result, err := c.mlService.TrainModels()
+	var result *service.TrainingResult
+	var err error
+	if request.Sample != nil {
+		result, err = c.mlService.TrainModelsOnSample(ctx.Request.Context(), *request.Sample)
+	} else {
+		result, err = c.mlService.TrainModels(ctx.Request.Context())
+	}
 	if err != nil {
-		errMsg := err.Error()
-
-		// Check if this is Python output that we should log as info
-		if len(errMsg) > 13 && errMsg[:13] == "python_output:" {
-			// Extract and log the Python output as info
-			pythonOutput := errMsg[13:]
-			c.logger.Infow("Python training process", "python_logs", pythonOutput)
-
-			// Try to still find valid metrics in the Python output
-			// We'll treat this as a partial success if the models were trained
-			if c.mlService.CheckModelsExist() {
-				c.logger.Infow("Models were successfully created despite warnings")
-				ctx.JSON(http.StatusOK, gin.H{
-					"message":       "Training completed with warnings, models created",
-					"python_output": pythonOutput,
-				})
-			} else {
-				ctx.JSON(http.StatusInternalServerError, gin.H{
-					"error":         "Training did not complete successfully",
-					"python_output": pythonOutput,
-				})
-			}
+		if errors.Is(err, service.ErrInvalidTrainingSample) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrInsufficientDiskSpace) {
+			c.logger.Warnw("Training refused for lack of disk space", "error", err)
+			ctx.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+			return
+		}
+		if respondContextError(ctx, err) {
+			c.logger.Warnw("Training request did not complete in time", "error", err)
+			return
+		}
+
+		// The script ran but stopped before printing metrics, so its log tells why. The previous
+		// models stay installed, since only a finished run replaces them
+		var outputErr *service.TrainingOutputError
+		if errors.As(err, &outputErr) {
+			c.logger.Infow("Python training process", "python_logs", outputErr.Output)
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error":         "Training did not complete successfully",
+				"python_output": outputErr.Output,
+			})
 			return
 		}
 
@@ -167,16 +391,151 @@ func (c *PredictionAPIController) HandleTrain(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, result)
 }
 
-// HandleStatus handles model status requests
-// @Summary Check model status
-// @Description Check if the prediction models are trained and available
+// submitTraining queues a training job and answers with it and its location
+func (c *PredictionAPIController) submitTraining(ctx *gin.Context, request TrainRequest) {
+	job, err := c.trainingJobs.Submit(request.Sample, clientID(ctx))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTrainingSample) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.Errorw("Error queueing training job", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue training job"})
+		return
+	}
+
+	c.logger.Infow("Training job queued", "job_id", job.ID, "requested_by", job.RequestedBy)
+	ctx.Header("Location", "/api/v1/train/jobs/"+strconv.FormatInt(job.ID, 10))
+	ctx.JSON(http.StatusAccepted, job)
+}
+
+// HandleTrainJob handles training job status requests
+// @Summary Get a training job
+// @Description Status of a training run queued with async=true: queued, running with the stage it reached (preparing, training, installing), succeeded with its result or failed with its error
+// @Produce json
+// @Param id path int true "Training job ID"
+// @Success 200 {object} service.TrainingJob
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/train/jobs/{id} [get]
+func (c *PredictionAPIController) HandleTrainJob(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training job ID"})
+		return
+	}
+
+	job, err := c.trainingJobs.Get(id)
+	if err != nil {
+		c.logger.Errorw("Error fetching training job", "error", err, "job_id", id)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch training job"})
+		return
+	}
+	if job == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Training job not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+// HandleTrainHistory handles training run history requests
+// @Summary List training runs
+// @Description List recorded training runs with metrics, duration, dataset hash, parameters and truncated Python output, newest first
 // @Produce json
-// @Success 200 {object} map[string]bool
-// @Router /api/v1/status [get]
-func (c *PredictionAPIController) HandleStatus(ctx *gin.Context) {
-	// Check if models exist
-	modelsExist := c.mlService.CheckModelsExist()
-
-	// Return status
-	ctx.JSON(http.StatusOK, gin.H{"models_trained": modelsExist})
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param offset query int false "Number of runs to skip (default 0)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/train/history [get]
+func (c *PredictionAPIController) HandleTrainHistory(ctx *gin.Context) {
+	limit, offset, ok := parsePagination(ctx)
+	if !ok {
+		return
+	}
+
+	runs, total, err := c.mlService.ListTrainingRuns(limit, offset)
+	if err != nil {
+		c.logger.Errorw("Error listing training runs", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list training runs"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":  runs,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// HandleLearningCurve handles learning curve requests for a training run
+// @Summary Learning curve of a training run
+// @Description Iteration-level train/validation RMSE of the price and sales models parsed from the training output
+// @Produce json
+// @Param id path int true "Training run ID"
+// @Success 200 {object} map[string][]service.TrainingProgress
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/train/history/{id}/learning-curve [get]
+func (c *PredictionAPIController) HandleLearningCurve(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid training run ID"})
+		return
+	}
+
+	curve, err := c.mlService.GetTrainingLearningCurve(id)
+	if err != nil {
+		c.logger.Errorw("Error fetching learning curve", "error", err, "training_run_id", id)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch learning curve"})
+		return
+	}
+	if curve == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Training run not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"items": curve})
+}
+
+// parsePagination reads limit/offset query parameters, writing a 400 response if they are invalid
+func parsePagination(ctx *gin.Context) (int, int, bool) {
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+		return 0, 0, false
+	}
+
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+		return 0, 0, false
+	}
+
+	return limit, offset, true
+}
+
+// parseBaseline reads the baseline query parameter, which asks for the naive baselines next to the
+// prediction, writing a 400 response when it is not a boolean
+func parseBaseline(ctx *gin.Context) (bool, bool) {
+	return parseFlag(ctx, "baseline")
+}
+
+// parseDebug reads the debug query parameter, which asks for the provenance of the features next
+// to the prediction, writing a 400 response when it is not a boolean
+func parseDebug(ctx *gin.Context) (bool, bool) {
+	return parseFlag(ctx, "debug")
+}
+
+// parseFlag reads a boolean query parameter, false when absent
+func parseFlag(ctx *gin.Context, name string) (bool, bool) {
+	value, err := strconv.ParseBool(ctx.DefaultQuery(name, "false"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": name + " must be true or false"})
+		return false, false
+	}
+	return value, true
 }
@@ -0,0 +1,501 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// PredictRequestV2 is the v2 request for a prediction resolved from history
+type PredictRequestV2 struct {
+	ProductName string `json:"product_name" binding:"required"`
+	Region      string `json:"region" binding:"required"`
+	Seller      string `json:"seller" binding:"required"`
+	// Date is the prediction date in YYYY-MM-DD format, today when empty
+	Date      string              `json:"date,omitempty"`
+	Overrides *FeatureOverridesV2 `json:"overrides,omitempty"`
+}
+
+// FeatureOverridesV2 are the features a v2 caller may set instead of resolving them from history
+type FeatureOverridesV2 struct {
+	Price          *float64 `json:"price,omitempty"`
+	OriginalPrice  *float64 `json:"original_price,omitempty"`
+	StockLevel     *float64 `json:"stock_level,omitempty"`
+	CustomerRating *float64 `json:"customer_rating,omitempty"`
+	ReviewCount    *float64 `json:"review_count,omitempty"`
+	DeliveryDays   *float64 `json:"delivery_days,omitempty"`
+}
+
+// PredictFeaturesRequestV2 is the v2 request for a prediction from a complete feature vector
+type PredictFeaturesRequestV2 struct {
+	Features *service.PredictionRequest `json:"features" binding:"required"`
+}
+
+// PredictionV2 holds the predicted values
+type PredictionV2 struct {
+	Price float64 `json:"price"`
+	Sales float64 `json:"sales"`
+	// Targets are the predicted values of the targets beyond price and sales, by name
+	Targets map[string]float64 `json:"targets,omitempty"`
+}
+
+// PredictResponseV2 is the v2 prediction response
+type PredictResponseV2 struct {
+	// PredictionID identifies the recorded prediction, e.g. to reproduce it; batch items have none
+	PredictionID int64        `json:"prediction_id,omitempty"`
+	Prediction   PredictionV2 `json:"prediction"`
+	ModelVersion string       `json:"model_version"`
+	// Overrides lists the overridden features, empty for predictions from history alone
+	Overrides []string `json:"overrides"`
+	// HistoryDate is the date of the latest history row in YYYY-MM-DD format
+	HistoryDate     *string              `json:"history_date"`
+	Warnings        []string             `json:"warnings"`
+	FeaturesPresent map[string]bool      `json:"features_present,omitempty"`
+	DataQuality     *service.DataQuality `json:"data_quality,omitempty"`
+	// Strategy is the prediction strategy of the fallback chain that answered
+	Strategy string `json:"strategy,omitempty"`
+	// Baselines are the naive baseline predictions, with ?baseline=true
+	Baselines map[string]service.BaselinePrediction `json:"baselines,omitempty"`
+	// Provenance is where every feature resolved from history came from, with ?debug=true
+	Provenance map[string]service.FeatureProvenance `json:"provenance,omitempty"`
+}
+
+// batchStreamChunkSize is the number of items predicted per model pass when a batch is streamed
+const batchStreamChunkSize = 100
+
+// PredictBatchRequestV2 is the v2 request for predictions of many products resolved from history
+type PredictBatchRequestV2 struct {
+	Items []PredictRequestV2 `json:"items" binding:"required,min=1"`
+	// CallbackURL makes the batch asynchronous: it is accepted right away and the results are
+	// POSTed to this URL once they are ready
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// BatchErrorV2 describes why an item of a batch failed
+type BatchErrorV2 struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// BatchItemV2 is the outcome of one item of a batch, in request order
+type BatchItemV2 struct {
+	Index      int                `json:"index"`
+	Status     string             `json:"status"`
+	Prediction *PredictResponseV2 `json:"prediction,omitempty"`
+	Error      *BatchErrorV2      `json:"error,omitempty"`
+}
+
+// PredictBatchResponseV2 is the v2 batch prediction response
+type PredictBatchResponseV2 struct {
+	Items     []BatchItemV2 `json:"items"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+}
+
+// PredictionAPIV2Controller handles the v2 prediction API
+type PredictionAPIV2Controller struct {
+	mlService      Predictor
+	asyncBatches   BatchService
+	flags          FeatureFlags
+	predictTimeout time.Duration
+	batchMaxItems  int
+	logger         *zap.SugaredLogger
+}
+
+// NewPredictionAPIV2Controller creates a new v2 prediction API controller
+func NewPredictionAPIV2Controller(mlService Predictor, asyncBatches BatchService, flags FeatureFlags, predictTimeout time.Duration, batchMaxItems int, logger *zap.SugaredLogger) *PredictionAPIV2Controller {
+	return &PredictionAPIV2Controller{
+		mlService:      mlService,
+		asyncBatches:   asyncBatches,
+		flags:          flags,
+		predictTimeout: predictTimeout,
+		batchMaxItems:  batchMaxItems,
+		logger:         logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the v2 prediction API
+func (c *PredictionAPIV2Controller) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v2")
+	{
+		api.POST("/predictions", RequestTimeout(c.predictTimeout), c.HandlePredict)
+		api.POST("/predictions/features", RequestTimeout(c.predictTimeout), c.HandlePredictFeatures)
+		api.POST("/predictions/batch", RequestTimeout(c.predictTimeout), c.HandlePredictBatch)
+		api.GET("/predictions/batch/:id", c.HandleGetBatch)
+		api.GET("/predictions/batch/:id/results", c.HandleGetBatchResults)
+	}
+}
+
+// HandlePredict handles v2 predictions resolved from history
+// @Summary Make a prediction from history
+// @Description Predict price and sales for a product from its history, with optional feature overrides
+// @Accept json
+// @Produce json
+// @Param request body controller.PredictRequestV2 true "Product key, date and overrides"
+// @Param baseline query bool false "Add the naive baseline predictions"
+// @Param debug query bool false "Add the provenance of every feature resolved from history"
+// @Success 200 {object} controller.PredictResponseV2
+// @Failure 400 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v2/predictions [post]
+func (c *PredictionAPIV2Controller) HandlePredict(ctx *gin.Context) {
+	var request PredictRequestV2
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	minRequest, err := request.toMinimal()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var ok bool
+	if minRequest.Baseline, ok = parseBaseline(ctx); !ok {
+		return
+	}
+	if minRequest.Debug, ok = parseDebug(ctx); !ok {
+		return
+	}
+
+	result, err := c.mlService.PredictMinimal(ctx.Request.Context(), minRequest)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, c.newResponse(result))
+}
+
+// toMinimal converts a v2 request into the service's minimal prediction request
+func (r *PredictRequestV2) toMinimal() (*service.PredictionRequestMinimal, error) {
+	minRequest := &service.PredictionRequestMinimal{
+		ProductName: r.ProductName,
+		Region:      r.Region,
+		Seller:      r.Seller,
+	}
+	if r.Date != "" {
+		date, err := time.Parse("2006-01-02", r.Date)
+		if err != nil {
+			return nil, errors.New("date must be in YYYY-MM-DD format")
+		}
+		minRequest.PredictionDate = &date
+	}
+	if o := r.Overrides; o != nil {
+		minRequest.Price = o.Price
+		minRequest.OriginalPrice = o.OriginalPrice
+		minRequest.StockLevel = o.StockLevel
+		minRequest.CustomerRating = o.CustomerRating
+		minRequest.ReviewCount = o.ReviewCount
+		minRequest.DeliveryDays = o.DeliveryDays
+	}
+	return minRequest, nil
+}
+
+// HandlePredictFeatures handles v2 predictions from a complete feature vector
+// @Summary Make a prediction from a feature vector
+// @Description Predict price and sales from a complete feature vector, as returned by GET /api/v1/features
+// @Accept json
+// @Produce json
+// @Param request body controller.PredictFeaturesRequestV2 true "Feature vector"
+// @Param baseline query bool false "Add the naive baseline predictions"
+// @Success 200 {object} controller.PredictResponseV2
+// @Failure 400 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v2/predictions/features [post]
+func (c *PredictionAPIV2Controller) HandlePredictFeatures(ctx *gin.Context) {
+	var request PredictFeaturesRequestV2
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if request.Features.Price <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "features.price must be positive"})
+		return
+	}
+	baseline, ok := parseBaseline(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := c.mlService.Predict(ctx.Request.Context(), request.Features)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+	if baseline {
+		result.Baselines = service.NaiveBaselines(request.Features)
+	}
+
+	ctx.JSON(http.StatusOK, c.newResponse(result))
+}
+
+// HandlePredictBatch handles v2 batch predictions resolved from history
+// @Summary Make predictions for many products
+// @Description Predict price and sales for many products in one model pass; items that can't be predicted fail on their own and the response is 207 Multi-Status. With Accept: application/x-ndjson the items are streamed one per line as they are predicted, followed by a summary line. With a callback_url the batch is accepted with 202 and its results are POSTed to the callback
+// @Accept json
+// @Produce json,application/x-ndjson
+// @Param request body controller.PredictBatchRequestV2 true "Items as in POST /api/v2/predictions"
+// @Success 200 {object} controller.PredictBatchResponseV2
+// @Success 202 {object} service.BatchPrediction
+// @Success 207 {object} controller.PredictBatchResponseV2
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v2/predictions/batch [post]
+func (c *PredictionAPIV2Controller) HandlePredictBatch(ctx *gin.Context) {
+	var request PredictBatchRequestV2
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	if len(request.Items) > c.batchMaxItems {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("batch has %d items, at most %d are allowed",
+			len(request.Items), c.batchMaxItems)})
+		return
+	}
+
+	// Invalid items are reported with the batch instead of failing it
+	minRequests := make([]*service.PredictionRequestMinimal, len(request.Items))
+	invalid := make(map[int]string)
+	for i := range request.Items {
+		minRequest, err := request.Items[i].validate()
+		if err != nil {
+			invalid[i] = err.Error()
+			continue
+		}
+		minRequests[i] = minRequest
+	}
+
+	if request.CallbackURL != "" {
+		if !c.flags.Enabled(service.FlagAsyncBatches, clientID(ctx)) {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Async batches are not enabled for this client"})
+			return
+		}
+		c.submitBatch(ctx, minRequests, invalid, request.CallbackURL)
+		return
+	}
+	if wantsNDJSON(ctx) {
+		c.streamBatch(ctx, minRequests, invalid)
+		return
+	}
+
+	results, err := c.mlService.PredictMinimalBatch(ctx.Request.Context(), minRequests)
+	if err != nil {
+		c.respondError(ctx, err)
+		return
+	}
+
+	response := &PredictBatchResponseV2{Items: make([]BatchItemV2, len(results))}
+	for i := range results {
+		response.Items[i] = c.newBatchItem(&results[i], invalid[i])
+		if response.Items[i].Error != nil {
+			response.Failed++
+		} else {
+			response.Succeeded++
+		}
+	}
+
+	status := http.StatusOK
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	ctx.JSON(status, response)
+}
+
+// submitBatch accepts an async batch whose results are delivered to the callback URL
+func (c *PredictionAPIV2Controller) submitBatch(ctx *gin.Context, minRequests []*service.PredictionRequestMinimal, invalid map[int]string, callbackURL string) {
+	batch, err := c.asyncBatches.Submit(ctx.Request.Context(), minRequests, callbackURL, func(result *service.BatchItemResult) (any, bool) {
+		item := c.newBatchItem(result, invalid[result.Index])
+		return item, item.Error == nil
+	})
+	switch {
+	case errors.Is(err, service.ErrInvalidCallbackURL), errors.Is(err, service.ErrCallbacksDisabled):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrLameDuck):
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.logger.Errorw("Error submitting batch prediction", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit batch prediction: " + err.Error()})
+		return
+	}
+
+	ctx.Header("Location", fmt.Sprintf("/api/v2/predictions/batch/%d", batch.ID))
+	ctx.JSON(http.StatusAccepted, batch)
+}
+
+// HandleGetBatch handles async batch status requests
+// @Summary Get async batch status
+// @Description Status of a batch submitted with a callback_url, with its counts and callback delivery
+// @Produce json
+// @Param id path int true "Batch ID"
+// @Success 200 {object} service.BatchPrediction
+// @Failure 404 {object} map[string]string
+// @Router /api/v2/predictions/batch/{id} [get]
+func (c *PredictionAPIV2Controller) HandleGetBatch(ctx *gin.Context) {
+	batch, ok := c.lookupBatch(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, batch)
+}
+
+// HandleGetBatchResults handles async batch result downloads
+// @Summary Download async batch results
+// @Description The items of a completed async batch, in the same form as a synchronous batch response
+// @Produce json
+// @Param id path int true "Batch ID"
+// @Success 200 {object} controller.PredictBatchResponseV2
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v2/predictions/batch/{id}/results [get]
+func (c *PredictionAPIV2Controller) HandleGetBatchResults(ctx *gin.Context) {
+	batch, ok := c.lookupBatch(ctx)
+	if !ok {
+		return
+	}
+
+	if batch.Status != service.BatchStatusCompleted {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Batch is not completed", "status": batch.Status})
+		return
+	}
+
+	items, err := c.asyncBatches.Results(batch.ID)
+	if err != nil {
+		c.logger.Errorw("Error fetching batch results", "error", err, "batch_id", batch.ID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch batch results"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":     items,
+		"succeeded": batch.Succeeded,
+		"failed":    batch.Failed,
+	})
+}
+
+// lookupBatch resolves the async batch from the path, writing an error response if it can't
+func (c *PredictionAPIV2Controller) lookupBatch(ctx *gin.Context) (*service.BatchPrediction, bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid batch ID"})
+		return nil, false
+	}
+
+	batch, err := c.asyncBatches.Get(id)
+	if err != nil {
+		c.logger.Errorw("Error fetching batch", "error", err, "batch_id", id)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch batch"})
+		return nil, false
+	}
+	if batch == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Batch not found"})
+		return nil, false
+	}
+
+	return batch, true
+}
+
+// streamBatch writes the items of a batch prediction as NDJSON as each model pass completes.
+// The status is always 200 since it is sent before any item is predicted; the summary line
+// carries the succeeded and failed counts
+func (c *PredictionAPIV2Controller) streamBatch(ctx *gin.Context, minRequests []*service.PredictionRequestMinimal, invalid map[int]string) {
+	var succeeded, failed int
+	writer := newNDJSONWriter(ctx)
+	err := c.mlService.StreamMinimalBatch(ctx.Request.Context(), minRequests, batchStreamChunkSize,
+		func(result *service.BatchItemResult) error {
+			item := c.newBatchItem(result, invalid[result.Index])
+			if item.Error != nil {
+				failed++
+			} else {
+				succeeded++
+			}
+			return writer.Write(item)
+		})
+	if err != nil {
+		c.logger.Errorw("Error streaming batch prediction", "error", err)
+	}
+	writer.Close(NDJSONSummary{Succeeded: &succeeded, Failed: &failed}, err)
+}
+
+// validate checks the fields a batch item can't be bound without and converts it to a minimal request
+func (r *PredictRequestV2) validate() (*service.PredictionRequestMinimal, error) {
+	if r.ProductName == "" || r.Region == "" || r.Seller == "" {
+		return nil, errors.New("product_name, region and seller are required")
+	}
+	return r.toMinimal()
+}
+
+// newBatchItem converts the outcome of a batch item into its v2 representation
+func (c *PredictionAPIV2Controller) newBatchItem(result *service.BatchItemResult, invalid string) BatchItemV2 {
+	item := BatchItemV2{Index: result.Index, Status: service.BatchItemSucceeded}
+	switch {
+	case invalid != "":
+		item.Status = service.BatchItemFailed
+		item.Error = &BatchErrorV2{Code: service.BatchErrorInvalidRequest, Message: invalid}
+	case !result.Succeeded():
+		item.Status = service.BatchItemFailed
+		item.Error = &BatchErrorV2{Code: result.ErrorCode, Message: result.Error}
+	default:
+		item.Prediction = c.newResponse(result.Result)
+	}
+	return item
+}
+
+// newResponse converts a prediction result into the v2 response
+func (c *PredictionAPIV2Controller) newResponse(result *service.PredictionResult) *PredictResponseV2 {
+	response := &PredictResponseV2{
+		PredictionID: result.PredictionID,
+		Prediction: PredictionV2{
+			Price:   result.PredictedPrice,
+			Sales:   result.PredictedSales,
+			Targets: result.Targets,
+		},
+		ModelVersion:    c.mlService.ActiveModelVersion(),
+		Overrides:       result.Overrides,
+		Warnings:        result.Warnings,
+		FeaturesPresent: result.FeaturesPresent,
+		DataQuality:     result.DataQuality,
+		Strategy:        result.Strategy,
+		Baselines:       result.Baselines,
+		Provenance:      result.Provenance,
+	}
+	if response.Overrides == nil {
+		response.Overrides = []string{}
+	}
+	if response.Warnings == nil {
+		response.Warnings = []string{}
+	}
+	if result.HistoryDate != nil {
+		date := result.HistoryDate.Format("2006-01-02")
+		response.HistoryDate = &date
+	}
+	return response
+}
+
+// respondError writes the v2 error response for a failed prediction
+func (c *PredictionAPIV2Controller) respondError(ctx *gin.Context, err error) {
+	c.logger.Errorw("Error making v2 prediction", "error", err)
+	if respondContextError(ctx, err) {
+		return
+	}
+	if errors.Is(err, service.ErrStaleHistory) {
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if respondPredictionDate(ctx, err) || respondModelIncompatible(ctx, err) || respondUnseenCategory(ctx, err) {
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to make prediction: " + err.Error()})
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// ProductAPIController handles HTTP requests for the product catalog
+type ProductAPIController struct {
+	catalog ProductCatalog
+	logger  *zap.SugaredLogger
+}
+
+// NewProductAPIController creates a new product API controller
+func NewProductAPIController(catalog ProductCatalog, logger *zap.SugaredLogger) *ProductAPIController {
+	return &ProductAPIController{
+		catalog: catalog,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the product API
+func (c *ProductAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1")
+	{
+		api.GET("/products", c.HandleListProducts)
+		api.GET("/products/:name", c.HandleGetProduct)
+		api.PUT("/products/:name", c.HandlePutProduct)
+		api.DELETE("/products/:name", c.HandleDeleteProduct)
+	}
+}
+
+// HandleListProducts handles product catalog requests
+// @Summary List catalog products
+// @Description List the product catalog ordered by product name
+// @Produce json
+// @Param brand query string false "Brand"
+// @Param category query string false "Category"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param offset query int false "Number of products to skip (default 0)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/products [get]
+func (c *ProductAPIController) HandleListProducts(ctx *gin.Context) {
+	limit, offset, ok := parsePagination(ctx)
+	if !ok {
+		return
+	}
+
+	filter := service.ProductFilter{
+		Brand:    ctx.Query("brand"),
+		Category: ctx.Query("category"),
+	}
+
+	products, total, err := c.catalog.List(filter, limit, offset)
+	if err != nil {
+		c.logger.Errorw("Error listing products", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list products"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":  products,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// HandleGetProduct handles product lookups
+// @Summary Get a catalog product
+// @Produce json
+// @Param name path string true "Product name"
+// @Success 200 {object} service.Product
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/products/{name} [get]
+func (c *ProductAPIController) HandleGetProduct(ctx *gin.Context) {
+	product, err := c.catalog.Get(ctx.Param("name"))
+	if err != nil {
+		c.logger.Errorw("Error fetching product", "error", err, "product", ctx.Param("name"))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+	if product == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, product)
+}
+
+// HandlePutProduct handles product catalog updates
+// @Summary Create or replace a catalog product
+// @Description Set the brand, category, attributes and launch date of a product. Predictions use the brand and category instead of those of the product's history
+// @Accept json
+// @Produce json
+// @Param name path string true "Product name"
+// @Param request body service.ProductUpdate true "Catalog entry; product_name is taken from the path"
+// @Success 200 {object} service.Product
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/products/{name} [put]
+func (c *ProductAPIController) HandlePutProduct(ctx *gin.Context) {
+	var update service.ProductUpdate
+	if err := ctx.ShouldBindJSON(&update); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+	update.ProductName = ctx.Param("name")
+
+	product, err := c.catalog.Upsert(&update)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidProduct) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.Errorw("Error saving product", "error", err, "product", update.ProductName)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save product"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, product)
+}
+
+// HandleDeleteProduct handles product catalog removals
+// @Summary Remove a catalog product
+// @Description Remove the catalog entry of a product; predictions fall back to the brand and category of its history
+// @Param name path string true "Product name"
+// @Success 204
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/products/{name} [delete]
+func (c *ProductAPIController) HandleDeleteProduct(ctx *gin.Context) {
+	deleted, err := c.catalog.Delete(ctx.Param("name"))
+	if err != nil {
+		c.logger.Errorw("Error deleting product", "error", err, "product", ctx.Param("name"))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
+		return
+	}
+	if !deleted {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,263 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// PromotionAPIController handles HTTP requests for the promotion calendar
+type PromotionAPIController struct {
+	promotions Promotions
+	logger     *zap.SugaredLogger
+}
+
+// NewPromotionAPIController creates a new promotion API controller
+func NewPromotionAPIController(promotions Promotions, logger *zap.SugaredLogger) *PromotionAPIController {
+	return &PromotionAPIController{
+		promotions: promotions,
+		logger:     logger,
+	}
+}
+
+// PromotionRequest is the body of a promotion create or update request
+type PromotionRequest struct {
+	ProductName        string   `json:"product_name"`
+	Category           string   `json:"category"`
+	DiscountPercentage *float64 `json:"discount_percentage" binding:"required"`
+	// StartsOn and EndsOn are inclusive dates in YYYY-MM-DD format
+	StartsOn    string `json:"starts_on" binding:"required"`
+	EndsOn      string `json:"ends_on" binding:"required"`
+	Description string `json:"description"`
+}
+
+// RegisterRoutes registers the HTTP routes for the promotion API
+func (c *PromotionAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1")
+	{
+		api.GET("/promotions", c.HandleListPromotions)
+		api.POST("/promotions", c.HandleCreatePromotion)
+		api.GET("/promotions/:id", c.HandleGetPromotion)
+		api.PUT("/promotions/:id", c.HandleUpdatePromotion)
+		api.DELETE("/promotions/:id", c.HandleDeletePromotion)
+	}
+}
+
+// HandleListPromotions handles promotion calendar requests
+// @Summary List planned promotions
+// @Description List promotions ordered by start date, optionally only those of a product or category overlapping a date range
+// @Produce json
+// @Param product_name query string false "Product name"
+// @Param category query string false "Category"
+// @Param from query string false "Promotions ending on or after this date (YYYY-MM-DD)"
+// @Param to query string false "Promotions starting on or before this date (YYYY-MM-DD)"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param offset query int false "Number of promotions to skip (default 0)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/promotions [get]
+func (c *PromotionAPIController) HandleListPromotions(ctx *gin.Context) {
+	limit, offset, ok := parsePagination(ctx)
+	if !ok {
+		return
+	}
+	from, to, ok := parseDateRange(ctx)
+	if !ok {
+		return
+	}
+	// parseDateRange makes to exclusive, the filter takes inclusive dates
+	if !to.IsZero() {
+		to = to.AddDate(0, 0, -1)
+	}
+
+	filter := service.PromotionFilter{
+		ProductName: ctx.Query("product_name"),
+		Category:    ctx.Query("category"),
+		From:        from,
+		To:          to,
+	}
+
+	promotions, total, err := c.promotions.List(filter, limit, offset)
+	if err != nil {
+		c.logger.Errorw("Error listing promotions", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list promotions"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":  promotions,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// HandleCreatePromotion handles promotion creation requests
+// @Summary Plan a promotion
+// @Description Add a promotion of a product, or of a whole category when product_name is empty. Predictions and training derive promotion features from it
+// @Accept json
+// @Produce json
+// @Param request body PromotionRequest true "Promotion"
+// @Success 201 {object} service.Promotion
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/promotions [post]
+func (c *PromotionAPIController) HandleCreatePromotion(ctx *gin.Context) {
+	promotion, ok := c.bindPromotion(ctx)
+	if !ok {
+		return
+	}
+
+	created, err := c.promotions.Create(promotion)
+	if err != nil {
+		c.respondPromotionError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, created)
+}
+
+// HandleGetPromotion handles promotion lookups
+// @Summary Get a promotion
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Success 200 {object} service.Promotion
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/promotions/{id} [get]
+func (c *PromotionAPIController) HandleGetPromotion(ctx *gin.Context) {
+	id, ok := parsePromotionID(ctx)
+	if !ok {
+		return
+	}
+
+	promotion, err := c.promotions.Get(id)
+	if err != nil {
+		c.respondPromotionError(ctx, err)
+		return
+	}
+	if promotion == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, promotion)
+}
+
+// HandleUpdatePromotion handles promotion update requests
+// @Summary Replace a promotion
+// @Accept json
+// @Produce json
+// @Param id path int true "Promotion ID"
+// @Param request body PromotionRequest true "Promotion"
+// @Success 200 {object} service.Promotion
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/promotions/{id} [put]
+func (c *PromotionAPIController) HandleUpdatePromotion(ctx *gin.Context) {
+	id, ok := parsePromotionID(ctx)
+	if !ok {
+		return
+	}
+	promotion, ok := c.bindPromotion(ctx)
+	if !ok {
+		return
+	}
+	promotion.ID = id
+
+	updated, err := c.promotions.Update(promotion)
+	if err != nil {
+		c.respondPromotionError(ctx, err)
+		return
+	}
+	if updated == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, updated)
+}
+
+// HandleDeletePromotion handles promotion removal requests
+// @Summary Cancel a promotion
+// @Param id path int true "Promotion ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/promotions/{id} [delete]
+func (c *PromotionAPIController) HandleDeletePromotion(ctx *gin.Context) {
+	id, ok := parsePromotionID(ctx)
+	if !ok {
+		return
+	}
+
+	deleted, err := c.promotions.Delete(id)
+	if err != nil {
+		c.respondPromotionError(ctx, err)
+		return
+	}
+	if !deleted {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Promotion not found"})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// bindPromotion parses a promotion from the request body, writing an error response if it can't
+func (c *PromotionAPIController) bindPromotion(ctx *gin.Context) (*service.Promotion, bool) {
+	var request PromotionRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return nil, false
+	}
+
+	startsOn, err := time.Parse("2006-01-02", request.StartsOn)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "starts_on must be a date in YYYY-MM-DD format"})
+		return nil, false
+	}
+	endsOn, err := time.Parse("2006-01-02", request.EndsOn)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "ends_on must be a date in YYYY-MM-DD format"})
+		return nil, false
+	}
+
+	return &service.Promotion{
+		ProductName:        request.ProductName,
+		Category:           request.Category,
+		DiscountPercentage: *request.DiscountPercentage,
+		StartsOn:           startsOn,
+		EndsOn:             endsOn,
+		Description:        request.Description,
+	}, true
+}
+
+// parsePromotionID reads the promotion ID from the path, writing an error response if it is invalid
+func parsePromotionID(ctx *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondPromotionError writes the response for a failed promotion operation
+func (c *PromotionAPIController) respondPromotionError(ctx *gin.Context, err error) {
+	if errors.Is(err, service.ErrInvalidPromotion) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.logger.Errorw("Error managing promotion", "error", err)
+	ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to manage promotion"})
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRecommendationLimit = 50
+	maxRecommendationLimit     = 1000
+)
+
+// RecommendationAPIController handles HTTP requests for operational recommendations
+type RecommendationAPIController struct {
+	recommendationService RecommendationService
+	markdownTimeout       time.Duration
+	logger                *zap.SugaredLogger
+}
+
+// NewRecommendationAPIController creates a new recommendation API controller
+func NewRecommendationAPIController(recommendationService RecommendationService, markdownTimeout time.Duration, logger *zap.SugaredLogger) *RecommendationAPIController {
+	return &RecommendationAPIController{
+		recommendationService: recommendationService,
+		markdownTimeout:       markdownTimeout,
+		logger:                logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the recommendation API
+func (c *RecommendationAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/recommendations")
+	{
+		api.GET("/restock", c.HandleRestock)
+		api.POST("/markdown", RequestTimeout(c.markdownTimeout), c.HandleMarkdown)
+		api.POST("/region-transfer", RequestTimeout(c.markdownTimeout), c.HandleRegionTransfer)
+	}
+}
+
+// HandleRestock handles restock recommendation requests
+// @Summary Products predicted to stock out
+// @Description List products whose P90 demand over the forecast horizon exceeds current stock, with a suggested reorder quantity
+// @Produce json
+// @Param limit query int false "Maximum number of products (default 50)"
+// @Param window_days query int false "Only consider forecasts from the last N days (default 7)"
+// @Success 200 {object} map[string][]service.RestockRecommendation
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/recommendations/restock [get]
+func (c *RecommendationAPIController) HandleRestock(ctx *gin.Context) {
+	params := service.RestockParams{
+		Limit:      defaultRecommendationLimit,
+		WindowDays: 7,
+	}
+
+	var err error
+	if value := ctx.Query("limit"); value != "" {
+		if params.Limit, err = strconv.Atoi(value); err != nil || params.Limit <= 0 || params.Limit > maxRecommendationLimit {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+	}
+	if value := ctx.Query("window_days"); value != "" {
+		if params.WindowDays, err = strconv.Atoi(value); err != nil || params.WindowDays <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "window_days must be a positive integer"})
+			return
+		}
+	}
+
+	recommendations, err := c.recommendationService.Restock(params)
+	if err != nil {
+		c.logger.Errorw("Error building restock recommendations", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build recommendations"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"items": recommendations})
+}
+
+// HandleMarkdown handles markdown recommendation requests
+// @Summary Smallest markdown clearing overstock
+// @Description For overstocked products, search discount levels through the sales model for the smallest markdown projected to clear stock to the target by the given date
+// @Accept json
+// @Produce json
+// @Param request body service.MarkdownRequest true "Markdown search parameters"
+// @Success 200 {object} map[string][]service.MarkdownRecommendation
+// @Failure 400 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/recommendations/markdown [post]
+func (c *RecommendationAPIController) HandleMarkdown(ctx *gin.Context) {
+	var request service.MarkdownRequest
+
+	// Parse request body
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		c.logger.Errorw("Invalid markdown request", "error", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	recommendations, err := c.recommendationService.Markdown(ctx.Request.Context(), &request)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMarkdownRequest) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrStaleHistory) {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.Errorw("Error building markdown recommendations", "error", err)
+		if respondContextError(ctx, err) {
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build recommendations: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"items": recommendations})
+}
+
+// HandleRegionTransfer handles regional demand transfer requests
+// @Summary Demand of a product in a new region
+// @Description Estimate the demand of a product in a region it is not sold in, from its features in a region it is sold in, with its sales history scaled by the category's relative sales in the target region
+// @Accept json
+// @Produce json
+// @Param request body service.RegionTransferRequest true "Product and regions"
+// @Success 200 {object} service.RegionTransferEstimate
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/recommendations/region-transfer [post]
+func (c *RecommendationAPIController) HandleRegionTransfer(ctx *gin.Context) {
+	var request service.RegionTransferRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	estimate, err := c.recommendationService.RegionTransfer(ctx.Request.Context(), &request)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidRegionTransfer):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrProductInRegion):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrNoRegionTransferBasis), errors.Is(err, service.ErrStaleHistory):
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		default:
+			c.logger.Errorw("Error estimating region transfer", "error", err, "product", request.ProductName)
+			if respondContextError(ctx, err) {
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to estimate region transfer: " + err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, estimate)
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/internal/locale"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultTopMoversLimit = 20
+	maxTopMoversLimit     = 500
+)
+
+// ReportAPIController handles HTTP requests for analytical reports
+type ReportAPIController struct {
+	reportService ReportService
+	logger        *zap.SugaredLogger
+}
+
+// NewReportAPIController creates a new report API controller
+func NewReportAPIController(reportService ReportService, logger *zap.SugaredLogger) *ReportAPIController {
+	return &ReportAPIController{
+		reportService: reportService,
+		logger:        logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the report API
+func (c *ReportAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/reports")
+	{
+		api.GET("/top-movers", c.HandleTopMovers)
+		api.GET("/html", c.HandleHTMLReport)
+	}
+
+	data := router.Group("/api/v1/data")
+	{
+		data.GET("/coverage", c.HandleDataCoverage)
+	}
+}
+
+// HandleTopMovers handles top-movers report requests
+// @Summary Products whose forecast changes the most
+// @Description List products whose latest forecast deviates the most from their 7-day rolling mean
+// @Produce json
+// @Param metric query string false "sales (default) or price"
+// @Param limit query int false "Maximum number of products (default 20)"
+// @Param threshold query number false "Minimum absolute relative change, e.g. 0.1 for 10% (default 0)"
+// @Param window_days query int false "Only consider forecasts from the last N days (default 7)"
+// @Success 200 {object} map[string][]service.TopMover
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/reports/top-movers [get]
+func (c *ReportAPIController) HandleTopMovers(ctx *gin.Context) {
+	params := service.TopMoversParams{
+		Metric:     ctx.DefaultQuery("metric", service.TopMoverMetricSales),
+		Limit:      defaultTopMoversLimit,
+		WindowDays: 7,
+	}
+
+	if params.Metric != service.TopMoverMetricSales && params.Metric != service.TopMoverMetricPrice {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "metric must be 'sales' or 'price'"})
+		return
+	}
+
+	var err error
+	if value := ctx.Query("limit"); value != "" {
+		if params.Limit, err = strconv.Atoi(value); err != nil || params.Limit <= 0 || params.Limit > maxTopMoversLimit {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+	}
+	if value := ctx.Query("threshold"); value != "" {
+		if params.Threshold, err = strconv.ParseFloat(value, 64); err != nil || params.Threshold < 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be a non-negative number"})
+			return
+		}
+	}
+	if value := ctx.Query("window_days"); value != "" {
+		if params.WindowDays, err = strconv.Atoi(value); err != nil || params.WindowDays <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "window_days must be a positive integer"})
+			return
+		}
+	}
+
+	movers, err := c.reportService.TopMovers(params)
+	if err != nil {
+		c.logger.Errorw("Error building top-movers report", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"items": movers})
+}
+
+// HandleHTMLReport handles HTML report requests
+// @Summary Self-contained HTML report of a product or category
+// @Description Render an HTML page with the history and forecast charts, forecast accuracy, latest forecasts and feature importances of a product, region and seller or of a category. Styles and charts are inline, so the page can be attached to emails and wikis as is
+// @Produce html
+// @Param product query string false "Product name, with region and seller"
+// @Param region query string false "Region"
+// @Param seller query string false "Seller"
+// @Param category query string false "Category, instead of a product"
+// @Param from query string false "First date, YYYY-MM-DD (default 89 days before to)"
+// @Param to query string false "Last date, YYYY-MM-DD (default today)"
+// @Param download query bool false "Serve the page as an attachment"
+// @Param locale query string false "en-US or ru-RU: number separators and currency symbol of prices"
+// @Success 200 {string} string
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/reports/html [get]
+func (c *ReportAPIController) HandleHTMLReport(ctx *gin.Context) {
+	request := service.HTMLReportRequest{
+		ProductName: ctx.Query("product"),
+		Region:      ctx.Query("region"),
+		Seller:      ctx.Query("seller"),
+		Category:    ctx.Query("category"),
+	}
+	for _, bound := range []struct {
+		name string
+		date *time.Time
+	}{{"from", &request.From}, {"to", &request.To}} {
+		value := ctx.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": bound.name + " must be a date in YYYY-MM-DD format"})
+			return
+		}
+		*bound.date = date
+	}
+	download, err := strconv.ParseBool(ctx.DefaultQuery("download", "false"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "download must be true or false"})
+		return
+	}
+	if request.Locale, err = locale.Parse(ctx.Query("locale")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := c.reportService.HTMLReport(&request)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidReportRequest) || errors.Is(err, service.ErrInvalidTimeSeriesRequest) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.Errorw("Error building HTML report", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	if download {
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="report-%s.html"`, time.Now().Format("2006-01-02")))
+	}
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
+// HandleDataCoverage handles data completeness report requests
+// @Summary History coverage per product
+// @Description List the date range, number of observations and share of missing days of every product, region and seller, the least complete first
+// @Produce json
+// @Param product_name query string false "Product name"
+// @Param region query string false "Region"
+// @Param seller query string false "Seller"
+// @Param limit query int false "Page size (default 20, max 100)"
+// @Param offset query int false "Number of keys to skip (default 0)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/v1/data/coverage [get]
+func (c *ReportAPIController) HandleDataCoverage(ctx *gin.Context) {
+	limit, offset, ok := parsePagination(ctx)
+	if !ok {
+		return
+	}
+
+	filter := service.DataCoverageFilter{
+		ProductName: ctx.Query("product_name"),
+		Region:      ctx.Query("region"),
+		Seller:      ctx.Query("seller"),
+	}
+
+	coverage, total, err := c.reportService.DataCoverage(filter, limit, offset)
+	if err != nil {
+		c.logger.Errorw("Error building data coverage report", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"items":  coverage,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// ResultAPIController handles downloads of job result files through presigned links
+type ResultAPIController struct {
+	results ResultFiles
+	logger  *zap.SugaredLogger
+}
+
+// NewResultAPIController creates a new result API controller
+func NewResultAPIController(results ResultFiles, logger *zap.SugaredLogger) *ResultAPIController {
+	return &ResultAPIController{
+		results: results,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the result API
+func (c *ResultAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1")
+	{
+		api.GET("/results/*key", c.HandleDownloadResult)
+	}
+}
+
+// HandleDownloadResult handles result file downloads
+// @Summary Download a job result file
+// @Description Download the results file behind a presigned link from a simulation or batch status response
+// @Produce json
+// @Param key path string true "Result file key"
+// @Param expires query int true "Link expiry as Unix time"
+// @Param signature query string true "Link signature"
+// @Success 200 {file} file
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 410 {object} map[string]string
+// @Router /api/v1/results/{key} [get]
+func (c *ResultAPIController) HandleDownloadResult(ctx *gin.Context) {
+	key := strings.TrimPrefix(ctx.Param("key"), "/")
+
+	data, err := c.results.Open(key, ctx.Query("expires"), ctx.Query("signature"))
+	switch {
+	case errors.Is(err, service.ErrInvalidResultLink):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrResultLinkExpired):
+		ctx.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrResultNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Result file not found"})
+		return
+	case err != nil:
+		c.logger.Errorw("Error reading result file", "error", err, "key", key)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read result file"})
+		return
+	}
+
+	ctx.Header("Content-Disposition", "attachment; filename="+strings.ReplaceAll(key, "/", "_"))
+	ctx.Header("Cache-Control", "private, no-store")
+	ctx.Data(http.StatusOK, "application/json", data)
+}
@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/service"
+)
+
+// The controllers depend on the services through the interfaces below, each listing what its
+// controllers call, so that tests and other binaries can serve the API with fakes. The service
+// types implement them; in-memory state such as the lifecycle and the SLO tracker is used directly
+
+// Predictor is the prediction side of the ML service
+type Predictor interface {
+	Predict(ctx context.Context, request *service.PredictionRequest) (*service.PredictionResult, error)
+	Explain(ctx context.Context, request *service.PredictionRequest) (*service.PredictionExplanation, error)
+	PredictMinimal(ctx context.Context, minRequest *service.PredictionRequestMinimal) (*service.PredictionResult, error)
+	PredictMinimalBatch(ctx context.Context, requests []*service.PredictionRequestMinimal) ([]service.BatchItemResult, error)
+	StreamMinimalBatch(ctx context.Context, requests []*service.PredictionRequestMinimal, chunkSize int, emit func(*service.BatchItemResult) error) error
+	ResolveFeatures(ctx context.Context, minRequest *service.PredictionRequestMinimal) (*service.FeatureVector, error)
+	ReproducePrediction(ctx context.Context, id int64, tolerance float64) (*service.PredictionReproduction, error)
+	ActiveModelVersion() string
+}
+
+// Trainer is the training side of the ML service
+type Trainer interface {
+	TrainModels(ctx context.Context) (*service.TrainingResult, error)
+	TrainModelsOnSample(ctx context.Context, sample service.TrainingSample) (*service.TrainingResult, error)
+	ListTrainingRuns(limit, offset int) ([]service.TrainingRun, int, error)
+	GetTrainingLearningCurve(id int64) ([]service.TrainingProgress, error)
+}
+
+// TrainingJobService queues training runs to be run by the workers
+type TrainingJobService interface {
+	Submit(sample *service.TrainingSample, requestedBy string) (*service.TrainingJob, error)
+	Get(id int64) (*service.TrainingJob, error)
+}
+
+// PredictionService is what the v1 prediction API uses of the ML service
+type PredictionService interface {
+	Predictor
+	Trainer
+}
+
+// ModelService reports on the trained models
+type ModelService interface {
+	ListModelMetrics(from, to time.Time) ([]service.ModelVersionMetrics, error)
+	ListModelVersions(limit, offset int) ([]service.ModelVersionMetrics, int, error)
+	ModelCoverage() ([]service.SegmentCoverage, error)
+	ModelEncoders() (*service.CategoryEncoders, error)
+}
+
+// StandbyModel reports on and decides the fate of the version in the standby slot
+type StandbyModel interface {
+	Status() (*service.StandbyStatus, error)
+	Promote(ctx context.Context) (*service.StandbyStatus, error)
+	Discard() (*service.StandbyStatus, error)
+}
+
+// ModelActivator makes a registered model version the active one
+type ModelActivator interface {
+	Activate(ctx context.Context, version string) (*service.ModelActivation, error)
+}
+
+// GoldenSet checks the loaded models against the outputs recorded for their golden set
+type GoldenSet interface {
+	Last() (*service.GoldenCheck, error)
+	Verify(ctx context.Context) (*service.GoldenCheck, error)
+}
+
+// BatchService runs async batch predictions
+type BatchService interface {
+	Get(id int64) (*service.BatchPrediction, error)
+	Results(id int64) (json.RawMessage, error)
+	Submit(ctx context.Context, requests []*service.PredictionRequestMinimal, callbackURL string, render service.BatchItemRenderer) (*service.BatchPrediction, error)
+}
+
+// SimulationService runs scenario simulations
+type SimulationService interface {
+	GetSimulation(id int64) (*service.Simulation, error)
+	GetSimulationResults(id int64) ([]service.SimulationResultRow, error)
+	StartSimulation(request *service.SimulationRequest) (*service.Simulation, error)
+}
+
+// ReportService builds the analytical reports
+type ReportService interface {
+	DataCoverage(filter service.DataCoverageFilter, limit, offset int) ([]service.DataCoverage, int, error)
+	HTMLReport(request *service.HTMLReportRequest) ([]byte, error)
+	TopMovers(params service.TopMoversParams) ([]service.TopMover, error)
+}
+
+// ForecastService reads stored forecasts and their accuracy
+type ForecastService interface {
+	Accuracy(request *service.AccuracyRequest) (*service.AccuracyReport, error)
+	AccuracyLeaderboard(request *service.LeaderboardRequest) (*service.AccuracyLeaderboard, error)
+	EachLatestForecast(productName, region, seller string, from, to time.Time, fn func(*service.Forecast) error) error
+	LatestForecasts(productName, region, seller string, from, to time.Time) ([]service.Forecast, error)
+	Launch(request *service.LaunchForecastRequest) (*service.LaunchForecast, error)
+	TimeSeries(productName, region, seller string, from, to time.Time) (*service.TimeSeries, error)
+}
+
+// RecommendationService makes restock, markdown and expansion recommendations
+type RecommendationService interface {
+	Markdown(ctx context.Context, request *service.MarkdownRequest) ([]service.MarkdownRecommendation, error)
+	RegionTransfer(ctx context.Context, request *service.RegionTransferRequest) (*service.RegionTransferEstimate, error)
+	Restock(params service.RestockParams) ([]service.RestockRecommendation, error)
+}
+
+// StatusService reports the health of the replica
+type StatusService interface {
+	Readiness(ctx context.Context) []string
+	Status(ctx context.Context) *service.ServiceStatus
+}
+
+// BacktestService reports on the backtest runs
+type BacktestService interface {
+	Trend(limit int) (*service.BacktestTrend, error)
+}
+
+// Scheduler runs the background jobs
+type Scheduler interface {
+	Jobs() []service.JobStatus
+	RunNow(name string) error
+	History(filter service.JobFilter, limit, offset int) ([]service.JobExecution, int, error)
+}
+
+// AuditLog records and lists calls to administrative operations
+type AuditLog interface {
+	Record(entry *service.AuditEntry)
+	List(filter service.AuditFilter, limit, offset int) ([]service.AuditEntry, int, error)
+}
+
+// FeatureFlags evaluates and changes the feature flags
+type FeatureFlags interface {
+	Enabled(name, client string) bool
+	List() []service.FeatureFlag
+	Set(name string, setting service.FeatureFlagSetting, caller string) (service.FeatureFlag, error)
+	Reset(name string) (service.FeatureFlag, error)
+}
+
+// QueueWeights lists and changes the weights of the ingestion queues
+type QueueWeights interface {
+	List() []service.QueueWeight
+	Set(queue string, weight int, caller string) (service.QueueWeight, error)
+	Reset(queue string) (service.QueueWeight, error)
+}
+
+// UsageTracker counts API usage and reports it
+type UsageTracker interface {
+	Record(record *service.APIUsageRecord)
+	Report(request *service.APIUsageRequest) (*service.APIUsageReport, error)
+}
+
+// ForecastRecomputer predicts stored forecasts again after data corrections
+type ForecastRecomputer interface {
+	Recompute(ctx context.Context, request *service.ForecastRecomputeRequest) (*service.ForecastRecomputeReport, error)
+}
+
+// Replayer replays recorded predictions against a model version or engine backend
+type Replayer interface {
+	Replay(ctx context.Context, request *service.ReplayRequest) (*service.ReplayReport, error)
+	Engines() []string
+}
+
+// EventLog lists the model lifecycle events
+type EventLog interface {
+	List(filter service.EventFilter, limit, offset int) ([]service.Event, int, error)
+}
+
+// Promotions manages the promotion calendar
+type Promotions interface {
+	Create(promotion *service.Promotion) (*service.Promotion, error)
+	Delete(id int64) (bool, error)
+	Get(id int64) (*service.Promotion, error)
+	List(filter service.PromotionFilter, limit, offset int) ([]service.Promotion, int, error)
+	Update(promotion *service.Promotion) (*service.Promotion, error)
+}
+
+// ProductCatalog manages the catalog entries of the products
+type ProductCatalog interface {
+	Delete(productName string) (bool, error)
+	Get(productName string) (*service.Product, error)
+	List(filter service.ProductFilter, limit, offset int) ([]service.Product, int, error)
+	Upsert(update *service.ProductUpdate) (*service.Product, error)
+}
+
+// ResultFiles serves job result files through signed links
+type ResultFiles interface {
+	Open(key, expires, signature string) ([]byte, error)
+}
+
+var (
+	_ PredictionService     = (*service.MLPredictionService)(nil)
+	_ ModelService          = (*service.MLPredictionService)(nil)
+	_ TrainingJobService    = (*service.TrainingJobs)(nil)
+	_ StandbyModel          = (*service.StandbyModel)(nil)
+	_ GoldenSet             = (*service.GoldenSet)(nil)
+	_ BatchService          = (*service.AsyncBatchService)(nil)
+	_ SimulationService     = (*service.SimulationService)(nil)
+	_ ReportService         = (*service.ReportService)(nil)
+	_ ForecastService       = (*service.ForecastService)(nil)
+	_ RecommendationService = (*service.RecommendationService)(nil)
+	_ StatusService         = (*service.StatusService)(nil)
+	_ BacktestService       = (*service.Backtester)(nil)
+	_ Scheduler             = (*service.Scheduler)(nil)
+	_ AuditLog              = (*service.AuditLog)(nil)
+	_ FeatureFlags          = (*service.FeatureFlags)(nil)
+	_ QueueWeights          = (*service.QueueWeights)(nil)
+	_ UsageTracker          = (*service.APIUsage)(nil)
+	_ Replayer              = (*service.Replayer)(nil)
+	_ ModelActivator        = (*service.ModelSynchronizer)(nil)
+	_ ForecastRecomputer    = (*service.ForecastRecomputer)(nil)
+	_ EventLog              = (*service.EventLog)(nil)
+	_ Promotions            = (*service.Promotions)(nil)
+	_ ProductCatalog        = (*service.ProductCatalog)(nil)
+	_ ResultFiles           = (*service.ResultFiles)(nil)
+)
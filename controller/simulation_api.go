@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graduate-work-mirea/data-processor-service/internal/locale"
+	"github.com/graduate-work-mirea/data-processor-service/service"
+	"go.uber.org/zap"
+)
+
+// SimulationAPIController handles HTTP requests for scenario simulations
+type SimulationAPIController struct {
+	simulationService SimulationService
+	logger            *zap.SugaredLogger
+}
+
+// NewSimulationAPIController creates a new simulation API controller
+func NewSimulationAPIController(simulationService SimulationService, logger *zap.SugaredLogger) *SimulationAPIController {
+	return &SimulationAPIController{
+		simulationService: simulationService,
+		logger:            logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the simulation API
+func (c *SimulationAPIController) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1")
+	{
+		api.POST("/simulations", c.HandleCreateSimulation)
+		api.GET("/simulations/:id", c.HandleGetSimulation)
+		api.GET("/simulations/:id/results", c.HandleGetSimulationResults)
+	}
+}
+
+// HandleCreateSimulation handles simulation submission requests
+// @Summary Start a scenario simulation
+// @Description Sweep price × discount × stock combinations for a set of products over a horizon
+// @Accept json
+// @Produce json
+// @Param request body service.SimulationRequest true "Simulation parameters"
+// @Success 202 {object} service.Simulation
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /api/v1/simulations [post]
+func (c *SimulationAPIController) HandleCreateSimulation(ctx *gin.Context) {
+	var request service.SimulationRequest
+
+	// Parse request body
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		c.logger.Errorw("Invalid simulation request", "error", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format: " + err.Error()})
+		return
+	}
+
+	simulation, err := c.simulationService.StartSimulation(&request)
+	if err != nil {
+		if errors.Is(err, service.ErrTooManyScenarios) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrLameDuck) {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.Errorw("Error starting simulation", "error", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start simulation: " + err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, simulation)
+}
+
+// HandleGetSimulation handles simulation status requests
+// @Summary Get simulation status
+// @Produce json
+// @Param id path int true "Simulation ID"
+// @Success 200 {object} service.Simulation
+// @Failure 404 {object} map[string]string
+// @Router /api/v1/simulations/{id} [get]
+func (c *SimulationAPIController) HandleGetSimulation(ctx *gin.Context) {
+	simulation, ok := c.lookupSimulation(ctx)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, simulation)
+}
+
+// HandleGetSimulationResults handles simulation result downloads
+// @Summary Download simulation results
+// @Description Download the result matrix of a completed simulation as JSON or CSV
+// @Produce json,text/csv
+// @Param id path int true "Simulation ID"
+// @Param format query string false "json (default) or csv"
+// @Param locale query string false "en-US or ru-RU: decimal and field separators of the CSV for spreadsheets of the locale"
+// @Success 200 {array} service.SimulationResultRow
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/v1/simulations/{id}/results [get]
+func (c *SimulationAPIController) HandleGetSimulationResults(ctx *gin.Context) {
+	simulation, ok := c.lookupSimulation(ctx)
+	if !ok {
+		return
+	}
+
+	loc, err := locale.Parse(ctx.Query("locale"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if simulation.Status != service.SimulationStatusCompleted {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Simulation is not completed", "status": simulation.Status})
+		return
+	}
+
+	results, err := c.simulationService.GetSimulationResults(simulation.ID)
+	if err != nil {
+		c.logger.Errorw("Error fetching simulation results", "error", err, "simulation_id", simulation.ID)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch simulation results"})
+		return
+	}
+
+	if ctx.Query("format") != "csv" {
+		ctx.JSON(http.StatusOK, results)
+		return
+	}
+
+	ctx.Header("Content-Type", "text/csv")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=simulation_%d.csv", simulation.ID))
+	ctx.Status(http.StatusOK)
+
+	writer := newCSVWriter(ctx.Writer, loc)
+	writer.Write([]string{"product_name", "region", "seller", "date", "price", "discount_percentage",
+		"stock_level", "predicted_price", "predicted_sales"})
+	for _, row := range results {
+		writer.Write([]string{
+			row.ProductName, row.Region, row.Seller, row.Date.Format("2006-01-02"),
+			loc.FormatFloat(row.Price, -1), loc.FormatFloat(row.DiscountPercentage, -1), loc.FormatFloat(row.StockLevel, -1),
+			loc.FormatFloat(row.PredictedPrice, -1), loc.FormatFloat(row.PredictedSales, -1),
+		})
+	}
+	writer.Flush()
+}
+
+// lookupSimulation resolves the simulation from the path, writing an error response if it can't
+func (c *SimulationAPIController) lookupSimulation(ctx *gin.Context) (*service.Simulation, bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid simulation ID"})
+		return nil, false
+	}
+
+	simulation, err := c.simulationService.GetSimulation(id)
+	if err != nil {
+		c.logger.Errorw("Error fetching simulation", "error", err, "simulation_id", id)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch simulation"})
+		return nil, false
+	}
+	if simulation == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Simulation not found"})
+		return nil, false
+	}
+
+	return simulation, true
+}
+
+// newCSVWriter returns a CSV writer separating fields as spreadsheets of the locale expect. Files
+// for a locale start with a UTF-8 byte order mark, without which Excel reads Cyrillic names as
+// mojibake
+func newCSVWriter(w io.Writer, loc locale.Locale) *csv.Writer {
+	if loc.Tag != "" {
+		io.WriteString(w, "\ufeff")
+	}
+	writer := csv.NewWriter(w)
+	writer.Comma = loc.ListSeparator
+	return writer
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// StatusAPIController handles HTTP requests about the state of the service
+type StatusAPIController struct {
+	statusService StatusService
+	logger        *zap.SugaredLogger
+}
+
+// NewStatusAPIController creates a new status API controller
+func NewStatusAPIController(statusService StatusService, logger *zap.SugaredLogger) *StatusAPIController {
+	return &StatusAPIController{
+		statusService: statusService,
+		logger:        logger,
+	}
+}
+
+// RegisterRoutes registers the HTTP routes for the status API
+func (c *StatusAPIController) RegisterRoutes(router *gin.Engine) {
+	router.GET("/ready", c.HandleReady)
+
+	api := router.Group("/api/v1")
+	{
+		api.GET("/status", c.HandleStatus)
+	}
+}
+
+// HandleReady handles readiness probes
+// @Summary Readiness probe
+// @Description Returns 200 only when the models are loaded into the inference engine, the database is reachable and the replica is not in lame-duck mode
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 503 {object} map[string]interface{}
+// @Router /ready [get]
+func (c *StatusAPIController) HandleReady(ctx *gin.Context) {
+	if reasons := c.statusService.Readiness(ctx.Request.Context()); len(reasons) > 0 {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready", "reasons": reasons})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// HandleStatus handles service status requests
+// @Summary Service status
+// @Description Model versions, last training run, uptime, per-route request statistics and dependency checks
+// @Produce json
+// @Success 200 {object} service.ServiceStatus
+// @Router /api/v1/status [get]
+func (c *StatusAPIController) HandleStatus(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.statusService.Status(ctx.Request.Context()))
+}
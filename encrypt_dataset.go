@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/graduate-work-mirea/data-processor-service/config"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"github.com/joho/godotenv"
+)
+
+// runEncryptDataset implements "ml-service encrypt-dataset", which encrypts training datasets in
+// place with ARTIFACT_ENCRYPTION_KEY, so that a data processor writing plain CSV can hand its output
+// to a service that expects encrypted datasets. It returns the process exit code
+func runEncryptDataset(args []string) int {
+	flags := flag.NewFlagSet("encrypt-dataset", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ml-service encrypt-dataset FILE...")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	_ = godotenv.Load()
+	cfg, err := config.New()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+	if cfg.ArtifactEncryptionKey == nil {
+		fmt.Fprintln(os.Stderr, "ARTIFACT_ENCRYPTION_KEY is not set")
+		return 1
+	}
+	cipher, err := repository.NewArtifactCipher(cfg.ArtifactEncryptionKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize artifact encryption: %v\n", err)
+		return 1
+	}
+
+	for _, path := range flags.Args() {
+		if err := repository.EncryptDatasetFile(cipher, path); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,292 @@
+// Package bench generates load against an HTTP endpoint and reports its latency distribution.
+//
+// Requests are sent open loop: one is started every 1/RPS seconds whether or not earlier ones have
+// answered, so a slow service shows up as growing latency instead of silently lowering the rate
+// (coordinated omission). Requests due while MaxInFlight are still waiting are dropped and counted.
+//
+// Reports are plain JSON so that a run made before a change can be kept as a baseline and compared
+// with a run made after it.
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StatusError is the status reported for requests that got no response
+const StatusError = "error"
+
+// HistogramBucketsMs are the upper bounds of the latency histogram buckets in milliseconds
+var HistogramBucketsMs = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+
+// Options describe the load to generate
+type Options struct {
+	URL     string
+	Method  string
+	Body    []byte
+	Headers map[string]string
+	// RPS is the rate requests are started at
+	RPS      float64
+	Duration time.Duration
+	// Timeout bounds each request
+	Timeout time.Duration
+	// MaxInFlight bounds the requests waiting for a response
+	MaxInFlight int
+}
+
+// Latency summarises the latencies of the successful requests in milliseconds
+type Latency struct {
+	Min  float64 `json:"min_ms"`
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P95  float64 `json:"p95_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+// Bucket counts the successful requests that took at most LE milliseconds and more than the bound
+// of the previous bucket; the last bucket is "+Inf"
+type Bucket struct {
+	LE    string `json:"le"`
+	Count int    `json:"count"`
+}
+
+// Report is the outcome of a load test
+type Report struct {
+	Label     string    `json:"label,omitempty"`
+	URL       string    `json:"url"`
+	StartedAt time.Time `json:"started_at"`
+	TargetRPS float64   `json:"target_rps"`
+	// DurationSeconds is how long requests were started for; the run also waits for the last answers
+	DurationSeconds float64 `json:"duration_seconds"`
+	// AchievedRPS is the rate successful requests completed at
+	AchievedRPS float64 `json:"achieved_rps"`
+	Requests    int     `json:"requests"`
+	Succeeded   int     `json:"succeeded"`
+	Failed      int     `json:"failed"`
+	Dropped     int     `json:"dropped"`
+	// Statuses counts the answers by HTTP status, with StatusError for requests that got none
+	Statuses  map[string]int `json:"statuses"`
+	Latency   Latency        `json:"latency"`
+	Histogram []Bucket       `json:"histogram"`
+}
+
+// ErrorRate returns the share of the started requests that failed or were dropped
+func (r *Report) ErrorRate() float64 {
+	if r.Requests+r.Dropped == 0 {
+		return 0
+	}
+	return float64(r.Failed+r.Dropped) / float64(r.Requests+r.Dropped)
+}
+
+// sample is the outcome of one request
+type sample struct {
+	status  string
+	ok      bool
+	latency time.Duration
+}
+
+// Run generates the load described by opts until its duration passes or the context is cancelled,
+// then waits for the requests in flight
+func Run(ctx context.Context, client *http.Client, opts Options) (*Report, error) {
+	if opts.RPS <= 0 {
+		return nil, errors.New("rps must be positive")
+	}
+	if opts.Duration <= 0 {
+		return nil, errors.New("duration must be positive")
+	}
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = 1000
+	}
+
+	var (
+		mu      sync.Mutex
+		samples []sample
+		wg      sync.WaitGroup
+		dropped int
+	)
+	inFlight := make(chan struct{}, opts.MaxInFlight)
+	interval := time.Duration(float64(time.Second) / opts.RPS)
+
+	started := time.Now()
+	deadline := started.Add(opts.Duration)
+	for next := started; next.Before(deadline); next = next.Add(interval) {
+		if wait := time.Until(next); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			dropped++
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			s := send(ctx, client, opts)
+			mu.Lock()
+			samples = append(samples, s)
+			mu.Unlock()
+		}()
+	}
+	elapsed := time.Since(started)
+	wg.Wait()
+
+	report := newReport(samples, elapsed)
+	report.URL = opts.URL
+	report.StartedAt = started
+	report.TargetRPS = opts.RPS
+	report.Dropped = dropped
+	return report, nil
+}
+
+// send makes one request; latency is measured until the whole body is read
+func send(ctx context.Context, client *http.Client, opts Options) sample {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, opts.Method, opts.URL, bytes.NewReader(opts.Body))
+	if err != nil {
+		return sample{status: StatusError}
+	}
+	if opts.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range opts.Headers {
+		req.Header.Set(name, value)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return sample{status: StatusError, latency: time.Since(start)}
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	latency := time.Since(start)
+	if err != nil {
+		return sample{status: StatusError, latency: latency}
+	}
+
+	return sample{
+		status:  strconv.Itoa(resp.StatusCode),
+		ok:      resp.StatusCode >= 200 && resp.StatusCode < 300,
+		latency: latency,
+	}
+}
+
+// newReport summarises the samples of a run that started requests for elapsed
+func newReport(samples []sample, elapsed time.Duration) *Report {
+	report := &Report{
+		DurationSeconds: elapsed.Seconds(),
+		Requests:        len(samples),
+		Statuses:        map[string]int{},
+	}
+
+	var latencies []float64
+	for _, s := range samples {
+		report.Statuses[s.status]++
+		if !s.ok {
+			report.Failed++
+			continue
+		}
+		report.Succeeded++
+		latencies = append(latencies, float64(s.latency)/float64(time.Millisecond))
+	}
+	if elapsed > 0 {
+		report.AchievedRPS = float64(report.Succeeded) / elapsed.Seconds()
+	}
+
+	report.Histogram = histogram(latencies)
+	if len(latencies) == 0 {
+		return report
+	}
+
+	sort.Float64s(latencies)
+	var sum float64
+	for _, latency := range latencies {
+		sum += latency
+	}
+	report.Latency = Latency{
+		Min:  latencies[0],
+		Mean: sum / float64(len(latencies)),
+		P50:  percentile(latencies, 0.50),
+		P90:  percentile(latencies, 0.90),
+		P95:  percentile(latencies, 0.95),
+		P99:  percentile(latencies, 0.99),
+		Max:  latencies[len(latencies)-1],
+	}
+	return report
+}
+
+// percentile returns the nearest-rank q-quantile of sorted values
+func percentile(sorted []float64, q float64) float64 {
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
+
+// histogram counts latencies into HistogramBucketsMs
+func histogram(latencies []float64) []Bucket {
+	buckets := make([]Bucket, len(HistogramBucketsMs)+1)
+	for i, upper := range HistogramBucketsMs {
+		buckets[i].LE = strconv.FormatFloat(upper, 'f', -1, 64)
+	}
+	buckets[len(HistogramBucketsMs)].LE = "+Inf"
+
+	for _, latency := range latencies {
+		buckets[sort.SearchFloat64s(HistogramBucketsMs, latency)].Count++
+	}
+	return buckets
+}
+
+// Compare checks a report against a baseline and describes every regression beyond maxRegression:
+// a median, p95 or p99 latency more than maxRegression (0.1 for 10%) above the baseline, or an error
+// rate more than maxRegression percentage points above it
+func Compare(baseline, current *Report, maxRegression float64) []string {
+	var regressions []string
+	for _, p := range []struct {
+		name          string
+		before, after float64
+	}{
+		{"p50", baseline.Latency.P50, current.Latency.P50},
+		{"p95", baseline.Latency.P95, current.Latency.P95},
+		{"p99", baseline.Latency.P99, current.Latency.P99},
+	} {
+		if p.before > 0 && p.after > p.before*(1+maxRegression) {
+			regressions = append(regressions, fmt.Sprintf("%s latency rose from %.1fms to %.1fms (+%.0f%%)",
+				p.name, p.before, p.after, (p.after/p.before-1)*100))
+		}
+	}
+
+	before, after := baseline.ErrorRate(), current.ErrorRate()
+	if after > before+maxRegression {
+		regressions = append(regressions, fmt.Sprintf("error rate rose from %.1f%% to %.1f%%", before*100, after*100))
+	}
+	return regressions
+}
@@ -0,0 +1,162 @@
+// Package chaos injects dependency failures on demand, for integration tests and game days.
+//
+// Faults are only injected by binaries built with the chaos tag (go build -tags chaos); in other
+// builds Enabled is false and every hook returns immediately. A fault targets one dependency and
+// adds latency to its calls, fails a share of them, or both. It lasts until it is cleared, until it
+// has affected a number of calls, or until it expires, whichever comes first.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Dependencies faults can be injected into
+const (
+	// TargetPostgres fails database calls as dropped connections (SQLSTATE 08006)
+	TargetPostgres = "postgres"
+	// TargetPython fails Python script runs as processes killed before they finish
+	TargetPython = "python"
+	// TargetRabbitMQ fails broker calls as a closed connection
+	TargetRabbitMQ = "rabbitmq"
+)
+
+// Targets lists the dependencies faults can be injected into
+var Targets = []string{TargetPostgres, TargetPython, TargetRabbitMQ}
+
+// ErrInjected is wrapped by every injected failure
+var ErrInjected = errors.New("injected failure")
+
+// ErrInvalidFault is returned for faults with an unknown target or out-of-range settings
+var ErrInvalidFault = errors.New("invalid fault")
+
+// Fault describes the failures injected into one dependency
+type Fault struct {
+	Target string `json:"target"`
+	// LatencyMs is added to every affected call before it runs or fails
+	LatencyMs int64 `json:"latency_ms"`
+	// ErrorRate is the share of affected calls that fail, between 0 and 1
+	ErrorRate float64 `json:"error_rate"`
+	// Remaining is the number of calls still to affect, 0 for no limit
+	Remaining int `json:"remaining,omitempty"`
+	// ExpiresAt ends the fault, nil for no expiry
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Injected counts the calls the fault has affected
+	Injected int `json:"injected"`
+}
+
+var (
+	mu     sync.Mutex
+	faults = map[string]*Fault{}
+)
+
+// Set installs a fault, replacing the previous fault of its target
+func Set(fault Fault) (Fault, error) {
+	if !isTarget(fault.Target) {
+		return Fault{}, fmt.Errorf("%w: unknown target %q", ErrInvalidFault, fault.Target)
+	}
+	if fault.ErrorRate < 0 || fault.ErrorRate > 1 {
+		return Fault{}, fmt.Errorf("%w: error rate %v is outside 0-1", ErrInvalidFault, fault.ErrorRate)
+	}
+	if fault.LatencyMs < 0 || fault.Remaining < 0 {
+		return Fault{}, fmt.Errorf("%w: latency and remaining calls must not be negative", ErrInvalidFault)
+	}
+	if fault.LatencyMs == 0 && fault.ErrorRate == 0 {
+		return Fault{}, fmt.Errorf("%w: neither latency nor an error rate is set", ErrInvalidFault)
+	}
+
+	fault.Injected = 0
+	mu.Lock()
+	defer mu.Unlock()
+	faults[fault.Target] = &fault
+	return fault, nil
+}
+
+// Clear removes the fault of a target and reports whether there was one
+func Clear(target string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := faults[target]
+	delete(faults, target)
+	return ok
+}
+
+// Faults returns the active faults ordered by target
+func Faults() []Fault {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	active := make([]Fault, 0, len(faults))
+	for target, fault := range faults {
+		if fault.ExpiresAt != nil && now.After(*fault.ExpiresAt) {
+			delete(faults, target)
+			continue
+		}
+		active = append(active, *fault)
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].Target < active[j].Target })
+	return active
+}
+
+// Inject applies the fault of the target to a call: it waits for the fault's latency, or until ctx
+// is done, and returns an error wrapping ErrInjected when the call is picked to fail
+func Inject(ctx context.Context, target string) error {
+	if !Enabled {
+		return nil
+	}
+
+	latency, fail := take(target)
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if fail {
+		return fmt.Errorf("%w into %s", ErrInjected, target)
+	}
+	return nil
+}
+
+// take consumes one call of the target's fault and decides its latency and whether it fails
+func take(target string) (time.Duration, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	fault, ok := faults[target]
+	if !ok {
+		return 0, false
+	}
+	if fault.ExpiresAt != nil && time.Now().After(*fault.ExpiresAt) {
+		delete(faults, target)
+		return 0, false
+	}
+
+	fault.Injected++
+	if fault.Remaining > 0 {
+		fault.Remaining--
+		if fault.Remaining == 0 {
+			delete(faults, target)
+		}
+	}
+	return time.Duration(fault.LatencyMs) * time.Millisecond, rand.Float64() < fault.ErrorRate
+}
+
+// isTarget reports whether faults can be injected into the named dependency
+func isTarget(name string) bool {
+	for _, target := range Targets {
+		if target == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,7 @@
+//go:build !chaos
+
+package chaos
+
+// Enabled reports whether the binary was built with the chaos tag. Without it no fault is ever
+// injected and the hooks compile to nothing
+const Enabled = false
@@ -0,0 +1,127 @@
+package chaos
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/lib/pq"
+)
+
+// WrapConnector returns a connector whose connections inject the Postgres fault into every
+// statement, transaction and ping. Without the chaos tag the connector is returned as is
+func WrapConnector(connector driver.Connector) driver.Connector {
+	if !Enabled {
+		return connector
+	}
+	return &faultyConnector{Connector: connector}
+}
+
+// injectPostgres applies the Postgres fault, reporting failures as a dropped connection so that
+// the retry policy treats them like the real thing
+func injectPostgres(ctx context.Context) error {
+	if err := Inject(ctx, TargetPostgres); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return &pq.Error{Code: "08006", Message: err.Error()}
+	}
+	return nil
+}
+
+type faultyConnector struct {
+	driver.Connector
+}
+
+func (c *faultyConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := injectPostgres(ctx); err != nil {
+		return nil, err
+	}
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyConn{conn: conn}, nil
+}
+
+// faultyConn delegates to a pq connection, injecting the fault before each call
+type faultyConn struct {
+	conn driver.Conn
+}
+
+func (c *faultyConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *faultyConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := injectPostgres(ctx); err != nil {
+		return nil, err
+	}
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.conn.Prepare(query)
+}
+
+func (c *faultyConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *faultyConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *faultyConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if err := injectPostgres(ctx); err != nil {
+		return nil, err
+	}
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.conn.Begin()
+}
+
+func (c *faultyConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := injectPostgres(ctx); err != nil {
+		return nil, err
+	}
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *faultyConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := injectPostgres(ctx); err != nil {
+		return nil, err
+	}
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c *faultyConn) Ping(ctx context.Context) error {
+	if err := injectPostgres(ctx); err != nil {
+		return err
+	}
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *faultyConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *faultyConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
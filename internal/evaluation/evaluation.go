@@ -0,0 +1,158 @@
+// Package evaluation computes the error metrics of forecasts against their actuals. Every consumer
+// of forecast accuracy goes through the Accumulator, so that a metric means the same thing in the
+// accuracy API as in reconciliation logs.
+package evaluation
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Metric names
+const (
+	// MAE is the mean absolute error
+	MAE = "mae"
+	// RMSE is the root mean squared error
+	RMSE = "rmse"
+	// MAPE is the mean absolute percentage error over the observations with a non-zero actual
+	MAPE = "mape"
+	// SMAPE is the symmetric mean absolute percentage error, |e| / ((|actual| + |predicted|) / 2);
+	// observations where both are zero count as no error
+	SMAPE = "smape"
+	// WAPE is the sum of absolute errors as a percentage of the sum of absolute actuals
+	WAPE = "wape"
+	// Bias is the mean of predicted minus actual; positive values mean over-forecasting
+	Bias = "bias"
+)
+
+// AllMetrics lists every metric in report order
+var AllMetrics = []string{MAE, RMSE, MAPE, SMAPE, WAPE, Bias}
+
+// MetricSet is the metrics a report includes, in order
+type MetricSet []string
+
+// ParseMetricSet parses a comma-separated list of metric names, each listed at most once;
+// an empty string is AllMetrics
+func ParseMetricSet(value string) (MetricSet, error) {
+	if strings.TrimSpace(value) == "" {
+		return MetricSet(AllMetrics), nil
+	}
+
+	var set MetricSet
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !IsMetric(name) {
+			return nil, fmt.Errorf("unknown metric %q, expected one of %s", name, strings.Join(AllMetrics, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate metric %s", name)
+		}
+		seen[name] = true
+		set = append(set, name)
+	}
+	return set, nil
+}
+
+// IsMetric reports whether name is one of AllMetrics
+func IsMetric(name string) bool {
+	for _, metric := range AllMetrics {
+		if metric == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Accumulator sums the errors of (actual, predicted) pairs as they are added, so that metrics of
+// arbitrarily many forecasts are computed without holding them. The zero value is ready to use
+type Accumulator struct {
+	count        int64
+	sumError     float64
+	sumAbsError  float64
+	sumSqError   float64
+	sumAbsActual float64
+	sumAPE       float64
+	countAPE     int64
+	sumSMAPE     float64
+}
+
+// Add records a forecast and its actual
+func (a *Accumulator) Add(actual, predicted float64) {
+	e := predicted - actual
+	abs := math.Abs(e)
+
+	a.count++
+	a.sumError += e
+	a.sumAbsError += abs
+	a.sumSqError += e * e
+	a.sumAbsActual += math.Abs(actual)
+	if actual != 0 {
+		a.sumAPE += abs / math.Abs(actual)
+		a.countAPE++
+	}
+	if denominator := (math.Abs(actual) + math.Abs(predicted)) / 2; denominator > 0 {
+		a.sumSMAPE += abs / denominator
+	}
+}
+
+// Merge adds the observations of other
+func (a *Accumulator) Merge(other *Accumulator) {
+	a.count += other.count
+	a.sumError += other.sumError
+	a.sumAbsError += other.sumAbsError
+	a.sumSqError += other.sumSqError
+	a.sumAbsActual += other.sumAbsActual
+	a.sumAPE += other.sumAPE
+	a.countAPE += other.countAPE
+	a.sumSMAPE += other.sumSMAPE
+}
+
+// Count returns the number of observations added
+func (a *Accumulator) Count() int64 {
+	return a.count
+}
+
+// Metric returns the value of a metric and whether it is defined: no metric is defined without
+// observations, MAPE needs a non-zero actual and WAPE a non-zero sum of actuals. Percentage
+// metrics are in percent
+func (a *Accumulator) Metric(name string) (float64, bool) {
+	if a.count == 0 {
+		return 0, false
+	}
+	n := float64(a.count)
+
+	switch name {
+	case MAE:
+		return a.sumAbsError / n, true
+	case RMSE:
+		return math.Sqrt(a.sumSqError / n), true
+	case MAPE:
+		if a.countAPE == 0 {
+			return 0, false
+		}
+		return 100 * a.sumAPE / float64(a.countAPE), true
+	case SMAPE:
+		return 100 * a.sumSMAPE / n, true
+	case WAPE:
+		if a.sumAbsActual == 0 {
+			return 0, false
+		}
+		return 100 * a.sumAbsError / a.sumAbsActual, true
+	case Bias:
+		return a.sumError / n, true
+	}
+	return 0, false
+}
+
+// Evaluate returns the defined metrics of the set by name
+func (s MetricSet) Evaluate(a *Accumulator) map[string]float64 {
+	values := make(map[string]float64, len(s))
+	for _, name := range s {
+		if value, ok := a.Metric(name); ok {
+			values[name] = value
+		}
+	}
+	return values
+}
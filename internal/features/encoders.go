@@ -0,0 +1,179 @@
+package features
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EncodersFile is the model artifact holding the categories the models were trained on
+const EncodersFile = "encoders.json"
+
+// EncoderVersion is the version of the encoders.json format the feature builder reads. Models stamp
+// the version of their encoders into feature_info.json, 0 for models trained before encoders
+const EncoderVersion = 1
+
+// OtherCategory is the category values the encoders fold together under UnseenOther
+const OtherCategory = "__other__"
+
+// UnseenPolicy is how a model encodes a category value it was not trained on
+type UnseenPolicy string
+
+const (
+	// UnseenMissing encodes an unseen value as a missing value, which LightGBM sends down the
+	// branch it learned for missing values
+	UnseenMissing UnseenPolicy = "missing"
+	// UnseenOther encodes an unseen value as OtherCategory, the category the values seen fewer
+	// than the minimum count times were folded into during training
+	UnseenOther UnseenPolicy = "other"
+	// UnseenFrequency encodes an unseen value as the category with the fewest training rows: a value
+	// never seen in training is nearest in frequency to the rarest one that was
+	UnseenFrequency UnseenPolicy = "frequency"
+	// UnseenReject fails predictions with an unseen value
+	UnseenReject UnseenPolicy = "reject"
+)
+
+// ParseUnseenPolicy parses an unseen category policy; an empty string is UnseenMissing
+func ParseUnseenPolicy(value string) (UnseenPolicy, error) {
+	switch UnseenPolicy(value) {
+	case "", UnseenMissing:
+		return UnseenMissing, nil
+	case UnseenOther, UnseenFrequency, UnseenReject:
+		return UnseenPolicy(value), nil
+	}
+	return "", fmt.Errorf("unknown unseen category policy %q, expected %q, %q, %q or %q", value,
+		UnseenMissing, UnseenOther, UnseenFrequency, UnseenReject)
+}
+
+// EncodedFeatures are the categorical fields of Vector whose values are encoded from the categories
+// seen in training. product_name is not a model input and has no encoder
+var EncodedFeatures = []string{"brand", "region", "category", "seller"}
+
+// Encoders are the category encoders of a model version
+type Encoders struct {
+	Version      int          `json:"encoder_version"`
+	UnseenPolicy UnseenPolicy `json:"unseen_policy"`
+	// MinCount is how many training rows a value needed to get a category of its own
+	MinCount int `json:"min_count"`
+	// Categories lists the categories of every encoded feature, in the order of their codes
+	Categories map[string][]string `json:"categories"`
+	// Counts are the training rows of every category, in the order of Categories; encoders written
+	// before they were recorded have none and encode values as missing under UnseenFrequency
+	Counts map[string][]int `json:"counts,omitempty"`
+
+	known  map[string]map[string]bool
+	rarest map[string]string
+}
+
+// ParseEncoders parses an encoders.json artifact
+func ParseEncoders(data []byte) (*Encoders, error) {
+	var encoders Encoders
+	if err := json.Unmarshal(data, &encoders); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", EncodersFile, err)
+	}
+	if encoders.Version != EncoderVersion {
+		return nil, fmt.Errorf("encoder version %d, feature builder version %d", encoders.Version, EncoderVersion)
+	}
+	policy, err := ParseUnseenPolicy(string(encoders.UnseenPolicy))
+	if err != nil {
+		return nil, err
+	}
+	encoders.UnseenPolicy = policy
+
+	encoders.known = make(map[string]map[string]bool, len(encoders.Categories))
+	for feature, categories := range encoders.Categories {
+		known := make(map[string]bool, len(categories))
+		for _, category := range categories {
+			known[category] = true
+		}
+		encoders.known[feature] = known
+	}
+
+	encoders.rarest = make(map[string]string, len(encoders.Counts))
+	for feature, counts := range encoders.Counts {
+		categories := encoders.Categories[feature]
+		if len(counts) != len(categories) {
+			return nil, fmt.Errorf("%s has %d counts for %d categories of %s", EncodersFile, len(counts), len(categories), feature)
+		}
+		if len(counts) == 0 {
+			continue
+		}
+		rarest := 0
+		for i, count := range counts {
+			if count < counts[rarest] {
+				rarest = i
+			}
+		}
+		encoders.rarest[feature] = categories[rarest]
+	}
+	return &encoders, nil
+}
+
+// UnseenCategory is a category value of a vector the encoders were not trained on
+type UnseenCategory struct {
+	Feature string `json:"feature"`
+	Value   string `json:"value"`
+	// EncodedAs is the category the models see instead of the value, empty when they see a missing
+	// value
+	EncodedAs string `json:"encoded_as"`
+}
+
+// Unseen returns the values of the encoded features of v that have no category of their own, with
+// the categories policy encodes them as. Empty values are missing rather than unseen
+func (e *Encoders) Unseen(v *Vector, policy UnseenPolicy) []UnseenCategory {
+	var unseen []UnseenCategory
+	for _, feature := range EncodedFeatures {
+		known, ok := e.known[feature]
+		if !ok {
+			continue
+		}
+		value := categoricalValue(v, feature)
+		if value == "" || (known[value] && value != OtherCategory) {
+			continue
+		}
+		var encodedAs string
+		switch policy {
+		case UnseenOther:
+			if known[OtherCategory] {
+				encodedAs = OtherCategory
+			}
+		case UnseenFrequency:
+			encodedAs = e.rarest[feature]
+		}
+		unseen = append(unseen, UnseenCategory{Feature: feature, Value: value, EncodedAs: encodedAs})
+	}
+	return unseen
+}
+
+// Encode returns a copy of v with the unseen values replaced by the categories they are encoded as,
+// so that every inference engine sees the same input whatever policy its models were trained with
+func Encode(v *Vector, unseen []UnseenCategory) *Vector {
+	encoded := *v
+	for _, u := range unseen {
+		switch u.Feature {
+		case "brand":
+			encoded.Brand = u.EncodedAs
+		case "region":
+			encoded.Region = u.EncodedAs
+		case "category":
+			encoded.Category = u.EncodedAs
+		case "seller":
+			encoded.Seller = u.EncodedAs
+		}
+	}
+	return &encoded
+}
+
+// categoricalValue returns the value of an encoded feature of v
+func categoricalValue(v *Vector, feature string) string {
+	switch feature {
+	case "brand":
+		return v.Brand
+	case "region":
+		return v.Region
+	case "category":
+		return v.Category
+	case "seller":
+		return v.Seller
+	}
+	return ""
+}
@@ -0,0 +1,236 @@
+// Package features builds the model input for a product from its processed history.
+//
+// Numeric features are resolved in the following order of precedence:
+//
+//  1. A caller override (price, original price, stock level, customer rating, review count,
+//     delivery days) replaces the resolved value. Overrides are applied last and do not
+//     feed into derived features, so overriding the price leaves the lags untouched.
+//  2. The value stored in processed_data for the product, region and seller.
+//  3. A value derived from features resolved before it: the discount from the price and
+//     original price, missing price lags from the current price, and missing rolling
+//     means from the lags.
+//  4. A fixed default.
+//
+// Brand and category come from the product catalog when it has them, then from the history
+// lookup, and default to DefaultBrand and DefaultCategory.
+//
+// Calendar features come from the history lookup, which describes the day after the
+// prediction date. Without history they describe the prediction date itself.
+//
+// Promotion features are not part of the history: ApplyPromotions derives them from the planned
+// promotions of the product and its category on the prediction date, and seller features are
+// set by ApplySellerStats from the aggregates of the seller_stats table.
+package features
+
+import (
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// Defaults used when neither history nor a derivation provides a value
+const (
+	DefaultBrand          = "Unknown Brand"
+	DefaultCategory       = "Unknown Category"
+	DefaultPrice          = 1000.0
+	DefaultStockLevel     = 100.0
+	DefaultCustomerRating = 4.0
+	DefaultReviewCount    = 10.0
+	DefaultDeliveryDays   = 3.0
+	DefaultSalesLag1      = 10.0
+	DefaultSalesLag3      = 9.0
+	DefaultSalesLag7      = 8.0
+	// Missing price lags are derived from the current price with these factors
+	priceLag3Factor = 0.98
+	priceLag7Factor = 0.95
+)
+
+// Vector is the full set of features the models are trained on
+type Vector struct {
+	ProductName               string  `json:"product_name"`
+	Brand                     string  `json:"brand"`
+	Category                  string  `json:"category"`
+	Region                    string  `json:"region"`
+	Seller                    string  `json:"seller"`
+	Price                     float64 `json:"price"`
+	OriginalPrice             float64 `json:"original_price"`
+	DiscountPercentage        float64 `json:"discount_percentage"`
+	StockLevel                float64 `json:"stock_level"`
+	CustomerRating            float64 `json:"customer_rating"`
+	ReviewCount               float64 `json:"review_count"`
+	DeliveryDays              float64 `json:"delivery_days"`
+	IsWeekend                 bool    `json:"is_weekend"`
+	IsHoliday                 bool    `json:"is_holiday"`
+	DayOfWeek                 int     `json:"day_of_week"`
+	Month                     int     `json:"month"`
+	Quarter                   int     `json:"quarter"`
+	SalesQuantityLag1         float64 `json:"sales_quantity_lag_1"`
+	PriceLag1                 float64 `json:"price_lag_1"`
+	SalesQuantityLag3         float64 `json:"sales_quantity_lag_3"`
+	PriceLag3                 float64 `json:"price_lag_3"`
+	SalesQuantityLag7         float64 `json:"sales_quantity_lag_7"`
+	PriceLag7                 float64 `json:"price_lag_7"`
+	SalesQuantityRollingMean3 float64 `json:"sales_quantity_rolling_mean_3"`
+	PriceRollingMean3         float64 `json:"price_rolling_mean_3"`
+	SalesQuantityRollingMean7 float64 `json:"sales_quantity_rolling_mean_7"`
+	PriceRollingMean7         float64 `json:"price_rolling_mean_7"`
+	// Planned promotions, set by ApplyPromotions
+	PromoActive                     bool    `json:"promo_active"`
+	PromoDiscountPercentage         float64 `json:"promo_discount_percentage"`
+	PromoUpcoming                   bool    `json:"promo_upcoming"`
+	PromoUpcomingDiscountPercentage float64 `json:"promo_upcoming_discount_percentage"`
+	// Seller reliability, set by ApplySellerStats
+	SellerAvgDeliveryDays  float64 `json:"seller_avg_delivery_days"`
+	SellerCancellationRate float64 `json:"seller_cancellation_rate"`
+	SellerRatingTrend      float64 `json:"seller_rating_trend"`
+	// External holds the features of external providers by their ext_ names. It is not a model
+	// input of its own: the features are flattened into the row the models see
+	External map[string]float64 `json:"external,omitempty"`
+}
+
+// Overrides are caller-supplied feature values that take precedence over history
+type Overrides struct {
+	Price          *float64
+	OriginalPrice  *float64
+	StockLevel     *float64
+	CustomerRating *float64
+	ReviewCount    *float64
+	DeliveryDays   *float64
+}
+
+// BuildFeatures resolves a feature vector from history, derivations, defaults and overrides.
+// historical may be nil when no history could be loaded. It returns the vector and the
+// names of the overridden features. Product, region and seller are left to the caller.
+func BuildFeatures(historical *repository.ProductHistoricalData, overrides Overrides, date time.Time) (*Vector, []string) {
+	v := &Vector{
+		Brand:    DefaultBrand,
+		Category: DefaultCategory,
+	}
+	if historical == nil {
+		historical = &repository.ProductHistoricalData{}
+		ApplyCalendar(v, date)
+	} else {
+		v.Brand = historical.Brand
+		v.Category = historical.Category
+		v.IsWeekend = historical.IsWeekend
+		v.IsHoliday = historical.IsHoliday
+		v.DayOfWeek = historical.DayOfWeek
+		v.Month = historical.Month
+		v.Quarter = historical.Quarter
+	}
+
+	// Current values
+	v.Price = valueOr(historical.Price.Float64, historical.Price.Valid, DefaultPrice)
+	v.OriginalPrice = valueOr(historical.OriginalPrice.Float64, historical.OriginalPrice.Valid, v.Price)
+	v.DiscountPercentage = valueOr(historical.DiscountPerc.Float64, historical.DiscountPerc.Valid, discount(v.Price, v.OriginalPrice))
+	v.StockLevel = valueOr(historical.StockLevel.Float64, historical.StockLevel.Valid, DefaultStockLevel)
+	v.CustomerRating = valueOr(historical.CustomerRating.Float64, historical.CustomerRating.Valid, DefaultCustomerRating)
+	v.ReviewCount = valueOr(historical.ReviewCount.Float64, historical.ReviewCount.Valid, DefaultReviewCount)
+	v.DeliveryDays = valueOr(historical.DeliveryDays.Float64, historical.DeliveryDays.Valid, DefaultDeliveryDays)
+
+	// Lags
+	v.SalesQuantityLag1 = valueOr(historical.SalesQuantityLag1.Float64, historical.SalesQuantityLag1.Valid, DefaultSalesLag1)
+	v.PriceLag1 = valueOr(historical.PriceLag1.Float64, historical.PriceLag1.Valid, v.Price)
+	v.SalesQuantityLag3 = valueOr(historical.SalesQuantityLag3.Float64, historical.SalesQuantityLag3.Valid, DefaultSalesLag3)
+	v.PriceLag3 = valueOr(historical.PriceLag3.Float64, historical.PriceLag3.Valid, v.Price*priceLag3Factor)
+	v.SalesQuantityLag7 = valueOr(historical.SalesQuantityLag7.Float64, historical.SalesQuantityLag7.Valid, DefaultSalesLag7)
+	v.PriceLag7 = valueOr(historical.PriceLag7.Float64, historical.PriceLag7.Valid, v.Price*priceLag7Factor)
+
+	// Rolling means, derived from the lags when missing
+	v.SalesQuantityRollingMean3 = valueOr(historical.SalesQuantityRollingMean3.Float64, historical.SalesQuantityRollingMean3.Valid,
+		(v.SalesQuantityLag1+v.SalesQuantityLag3)/2)
+	v.PriceRollingMean3 = valueOr(historical.PriceRollingMean3.Float64, historical.PriceRollingMean3.Valid,
+		(v.Price+v.PriceLag1+v.PriceLag3)/3)
+	v.SalesQuantityRollingMean7 = valueOr(historical.SalesQuantityRollingMean7.Float64, historical.SalesQuantityRollingMean7.Valid,
+		(v.SalesQuantityLag1+v.SalesQuantityLag3+v.SalesQuantityLag7)/3)
+	v.PriceRollingMean7 = valueOr(historical.PriceRollingMean7.Float64, historical.PriceRollingMean7.Valid,
+		(v.Price+v.PriceLag1+v.PriceLag3+v.PriceLag7)/4)
+
+	return v, applyOverrides(v, overrides)
+}
+
+// Presence reports, for every feature read from processed_data, whether the stored value was
+// non-NULL. Features reported as absent were derived or defaulted by BuildFeatures.
+// historical may be nil, in which case every feature is absent.
+func Presence(historical *repository.ProductHistoricalData) map[string]bool {
+	if historical == nil {
+		historical = &repository.ProductHistoricalData{}
+	}
+	return map[string]bool{
+		"price":                         historical.Price.Valid,
+		"original_price":                historical.OriginalPrice.Valid,
+		"discount_percentage":           historical.DiscountPerc.Valid,
+		"stock_level":                   historical.StockLevel.Valid,
+		"customer_rating":               historical.CustomerRating.Valid,
+		"review_count":                  historical.ReviewCount.Valid,
+		"delivery_days":                 historical.DeliveryDays.Valid,
+		"sales_quantity_lag_1":          historical.SalesQuantityLag1.Valid,
+		"price_lag_1":                   historical.PriceLag1.Valid,
+		"sales_quantity_lag_3":          historical.SalesQuantityLag3.Valid,
+		"price_lag_3":                   historical.PriceLag3.Valid,
+		"sales_quantity_lag_7":          historical.SalesQuantityLag7.Valid,
+		"price_lag_7":                   historical.PriceLag7.Valid,
+		"sales_quantity_rolling_mean_3": historical.SalesQuantityRollingMean3.Valid,
+		"price_rolling_mean_3":          historical.PriceRollingMean3.Valid,
+		"sales_quantity_rolling_mean_7": historical.SalesQuantityRollingMean7.Valid,
+		"price_rolling_mean_7":          historical.PriceRollingMean7.Valid,
+	}
+}
+
+// ApplyCatalog sets the brand and category of a vector from the product catalog. Empty values
+// leave those resolved from history in place
+func ApplyCatalog(v *Vector, brand, category string) {
+	if brand != "" {
+		v.Brand = brand
+	}
+	if category != "" {
+		v.Category = category
+	}
+}
+
+// ApplyCalendar sets the calendar features of a vector for the given date
+func ApplyCalendar(v *Vector, date time.Time) {
+	v.IsWeekend = date.Weekday() == time.Saturday || date.Weekday() == time.Sunday
+	v.DayOfWeek = int(date.Weekday())
+	v.Month = int(date.Month())
+	v.Quarter = (int(date.Month())-1)/3 + 1
+}
+
+// applyOverrides replaces resolved values with the supplied overrides and returns their feature names
+func applyOverrides(v *Vector, overrides Overrides) []string {
+	var applied []string
+	for _, o := range []struct {
+		name   string
+		value  *float64
+		target *float64
+	}{
+		{"price", overrides.Price, &v.Price},
+		{"original_price", overrides.OriginalPrice, &v.OriginalPrice},
+		{"stock_level", overrides.StockLevel, &v.StockLevel},
+		{"customer_rating", overrides.CustomerRating, &v.CustomerRating},
+		{"review_count", overrides.ReviewCount, &v.ReviewCount},
+		{"delivery_days", overrides.DeliveryDays, &v.DeliveryDays},
+	} {
+		if o.value != nil {
+			*o.target = *o.value
+			applied = append(applied, o.name)
+		}
+	}
+	return applied
+}
+
+// discount derives the discount percentage from the current and original price
+func discount(price, originalPrice float64) float64 {
+	if originalPrice > price {
+		return (originalPrice - price) / originalPrice * 100
+	}
+	return 0
+}
+
+// valueOr returns value if it is valid and fallback otherwise
+func valueOr(value float64, valid bool, fallback float64) float64 {
+	if valid {
+		return value
+	}
+	return fallback
+}
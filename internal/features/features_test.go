@@ -0,0 +1,289 @@
+package features
+
+import (
+	"database/sql"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+func valid(value float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: value, Valid: true}
+}
+
+func ptr(value float64) *float64 {
+	return &value
+}
+
+func TestBuildFeaturesPrecedence(t *testing.T) {
+	date := time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		historical *repository.ProductHistoricalData
+		overrides  Overrides
+		get        func(v *Vector) float64
+		want       float64
+	}{
+		// 1. An override replaces the stored value
+		{
+			name:       "override beats stored price",
+			historical: &repository.ProductHistoricalData{Price: valid(800)},
+			overrides:  Overrides{Price: ptr(500)},
+			get:        func(v *Vector) float64 { return v.Price },
+			want:       500,
+		},
+		{
+			name:       "override beats default stock level",
+			historical: &repository.ProductHistoricalData{},
+			overrides:  Overrides{StockLevel: ptr(0)},
+			get:        func(v *Vector) float64 { return v.StockLevel },
+			want:       0,
+		},
+		{
+			name:       "override does not feed derived lags",
+			historical: &repository.ProductHistoricalData{Price: valid(800)},
+			overrides:  Overrides{Price: ptr(500)},
+			get:        func(v *Vector) float64 { return v.PriceLag1 },
+			want:       800,
+		},
+		{
+			name:       "override does not feed the derived discount",
+			historical: &repository.ProductHistoricalData{Price: valid(800), OriginalPrice: valid(1000)},
+			overrides:  Overrides{Price: ptr(500)},
+			get:        func(v *Vector) float64 { return v.DiscountPercentage },
+			want:       20,
+		},
+		// 2. A stored value beats a derivation
+		{
+			name:       "stored original price beats the price",
+			historical: &repository.ProductHistoricalData{Price: valid(800), OriginalPrice: valid(900)},
+			get:        func(v *Vector) float64 { return v.OriginalPrice },
+			want:       900,
+		},
+		{
+			name:       "stored discount beats the derived one",
+			historical: &repository.ProductHistoricalData{Price: valid(800), OriginalPrice: valid(1000), DiscountPerc: valid(5)},
+			get:        func(v *Vector) float64 { return v.DiscountPercentage },
+			want:       5,
+		},
+		{
+			name:       "stored price lag beats the derived one",
+			historical: &repository.ProductHistoricalData{Price: valid(800), PriceLag3: valid(700)},
+			get:        func(v *Vector) float64 { return v.PriceLag3 },
+			want:       700,
+		},
+		{
+			name: "stored rolling mean beats the lags",
+			historical: &repository.ProductHistoricalData{
+				SalesQuantityLag1: valid(4), SalesQuantityLag3: valid(6), SalesQuantityRollingMean3: valid(11),
+			},
+			get:  func(v *Vector) float64 { return v.SalesQuantityRollingMean3 },
+			want: 11,
+		},
+		// 3. A derivation beats the default
+		{
+			name:       "original price derived from the price",
+			historical: &repository.ProductHistoricalData{Price: valid(800)},
+			get:        func(v *Vector) float64 { return v.OriginalPrice },
+			want:       800,
+		},
+		{
+			name:       "discount derived from the prices",
+			historical: &repository.ProductHistoricalData{Price: valid(750), OriginalPrice: valid(1000)},
+			get:        func(v *Vector) float64 { return v.DiscountPercentage },
+			want:       25,
+		},
+		{
+			name:       "no discount when the original price is lower",
+			historical: &repository.ProductHistoricalData{Price: valid(1000), OriginalPrice: valid(900)},
+			get:        func(v *Vector) float64 { return v.DiscountPercentage },
+			want:       0,
+		},
+		{
+			name:       "price lag 7 derived from the price",
+			historical: &repository.ProductHistoricalData{Price: valid(800)},
+			get:        func(v *Vector) float64 { return v.PriceLag7 },
+			want:       800 * priceLag7Factor,
+		},
+		{
+			name:       "sales rolling mean derived from the lags",
+			historical: &repository.ProductHistoricalData{SalesQuantityLag1: valid(4), SalesQuantityLag3: valid(6), SalesQuantityLag7: valid(8)},
+			get:        func(v *Vector) float64 { return v.SalesQuantityRollingMean7 },
+			want:       6,
+		},
+		{
+			name:       "price rolling mean derived from the price and its lags",
+			historical: &repository.ProductHistoricalData{Price: valid(100), PriceLag1: valid(90), PriceLag3: valid(80)},
+			get:        func(v *Vector) float64 { return v.PriceRollingMean3 },
+			want:       90,
+		},
+		// 4. Defaults
+		{
+			name: "default price without history",
+			get:  func(v *Vector) float64 { return v.Price },
+			want: DefaultPrice,
+		},
+		{
+			name:       "default customer rating",
+			historical: &repository.ProductHistoricalData{},
+			get:        func(v *Vector) float64 { return v.CustomerRating },
+			want:       DefaultCustomerRating,
+		},
+		{
+			name:       "default sales lag",
+			historical: &repository.ProductHistoricalData{},
+			get:        func(v *Vector) float64 { return v.SalesQuantityLag3 },
+			want:       DefaultSalesLag3,
+		},
+		{
+			name: "price lag derived from the default price",
+			get:  func(v *Vector) float64 { return v.PriceLag3 },
+			want: DefaultPrice * priceLag3Factor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := BuildFeatures(tt.historical, tt.overrides, date)
+			if got := tt.get(v); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildFeaturesCatalogDefaults(t *testing.T) {
+	tests := []struct {
+		name       string
+		historical *repository.ProductHistoricalData
+		wantBrand  string
+		wantCat    string
+	}{
+		{name: "no history", wantBrand: DefaultBrand, wantCat: DefaultCategory},
+		{
+			name:       "history",
+			historical: &repository.ProductHistoricalData{Brand: "Махаон", Category: "Книги"},
+			wantBrand:  "Махаон",
+			wantCat:    "Книги",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := BuildFeatures(tt.historical, Overrides{}, time.Now())
+			if v.Brand != tt.wantBrand || v.Category != tt.wantCat {
+				t.Errorf("brand, category = %q, %q, want %q, %q", v.Brand, v.Category, tt.wantBrand, tt.wantCat)
+			}
+		})
+	}
+}
+
+func TestApplyCalendar(t *testing.T) {
+	tests := []struct {
+		name string
+		date time.Time
+		want Vector
+	}{
+		{
+			name: "weekday",
+			date: time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC),
+			want: Vector{IsWeekend: false, DayOfWeek: int(time.Friday), Month: 3, Quarter: 1},
+		},
+		{
+			name: "saturday",
+			date: time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC),
+			want: Vector{IsWeekend: true, DayOfWeek: int(time.Saturday), Month: 6, Quarter: 2},
+		},
+		{
+			name: "sunday",
+			date: time.Date(2024, time.December, 29, 0, 0, 0, 0, time.UTC),
+			want: Vector{IsWeekend: true, DayOfWeek: int(time.Sunday), Month: 12, Quarter: 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Vector
+			ApplyCalendar(&v, tt.date)
+			if !reflect.DeepEqual(v, tt.want) {
+				t.Errorf("ApplyCalendar() = %+v, want %+v", v, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildFeaturesCalendar(t *testing.T) {
+	date := time.Date(2024, time.August, 3, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		historical *repository.ProductHistoricalData
+		want       Vector
+	}{
+		{
+			// Without history the calendar describes the prediction date
+			name: "nil history",
+			want: Vector{IsWeekend: true, DayOfWeek: int(time.Saturday), Month: 8, Quarter: 3},
+		},
+		{
+			// Loaded history carries its own calendar, even when it has no values
+			name:       "empty history",
+			historical: &repository.ProductHistoricalData{},
+			want:       Vector{},
+		},
+		{
+			name: "history",
+			historical: &repository.ProductHistoricalData{
+				IsWeekend: true, IsHoliday: true, DayOfWeek: int(time.Sunday), Month: 8, Quarter: 3,
+			},
+			want: Vector{IsWeekend: true, IsHoliday: true, DayOfWeek: int(time.Sunday), Month: 8, Quarter: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := BuildFeatures(tt.historical, Overrides{}, date)
+			got := Vector{IsWeekend: v.IsWeekend, IsHoliday: v.IsHoliday, DayOfWeek: v.DayOfWeek, Month: v.Month, Quarter: v.Quarter}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("calendar = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOverridesNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides Overrides
+		want      []string
+	}{
+		{name: "none", want: nil},
+		{name: "price", overrides: Overrides{Price: ptr(10)}, want: []string{"price"}},
+		{name: "zero value counts", overrides: Overrides{ReviewCount: ptr(0)}, want: []string{"review_count"}},
+		{
+			name: "all in declaration order",
+			overrides: Overrides{
+				DeliveryDays: ptr(2), CustomerRating: ptr(4.5), Price: ptr(10),
+				OriginalPrice: ptr(12), StockLevel: ptr(7), ReviewCount: ptr(3),
+			},
+			want: []string{"price", "original_price", "stock_level", "customer_rating", "review_count", "delivery_days"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Vector
+			if got := applyOverrides(&v, tt.overrides); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyOverrides() = %v, want %v", got, tt.want)
+			}
+			_, names := BuildFeatures(nil, tt.overrides, time.Now())
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("BuildFeatures() overrides = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
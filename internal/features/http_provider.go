@@ -0,0 +1,101 @@
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxProviderResponseBytes bounds the response of an HTTP provider
+const maxProviderResponseBytes = 1 << 20
+
+// Doer sends HTTP requests, e.g. an *http.Client or the retrying client of the service
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// HTTPProvider fetches features from an HTTP endpoint. The URL is a template whose {product},
+// {category}, {region}, {seller} and {date} placeholders are replaced with the escaped values of
+// the request, and the endpoint answers with a JSON object of numeric features, e.g.
+// {"temperature_c": 21.5, "precipitation_mm": 0}. Other values in the object are ignored
+type HTTPProvider struct {
+	name        string
+	urlTemplate string
+	token       string
+	client      Doer
+}
+
+// NewHTTPProvider creates a provider that calls the URL template, sending token as a bearer token
+// when it is set
+func NewHTTPProvider(name, urlTemplate, token string, client Doer) *HTTPProvider {
+	return &HTTPProvider{
+		name:        name,
+		urlTemplate: urlTemplate,
+		token:       token,
+		client:      client,
+	}
+}
+
+// Name returns the name of the provider
+func (p *HTTPProvider) Name() string {
+	return p.name
+}
+
+// Scope returns the expanded URL, so that products whose URLs are equal share a cached value
+func (p *HTTPProvider) Scope(key Key, date time.Time) string {
+	return p.url(key, date)
+}
+
+// Fetch calls the endpoint for a product on a date
+func (p *HTTPProvider) Fetch(ctx context.Context, key Key, date time.Time) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url(key, date), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("provider returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(body, &values); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+	result := make(map[string]float64, len(values))
+	for name, value := range values {
+		if number, ok := value.(float64); ok {
+			result[name] = number
+		}
+	}
+	return result, nil
+}
+
+// url expands the URL template for a product on a date
+func (p *HTTPProvider) url(key Key, date time.Time) string {
+	return strings.NewReplacer(
+		"{product}", url.QueryEscape(key.ProductName),
+		"{category}", url.QueryEscape(key.Category),
+		"{region}", url.QueryEscape(key.Region),
+		"{seller}", url.QueryEscape(key.Seller),
+		"{date}", date.Format("2006-01-02"),
+	).Replace(p.urlTemplate)
+}
@@ -0,0 +1,164 @@
+package features
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// Interpolation is how lag features and rolling means fill days without a history row. Like the
+// lag mode it is stamped into feature_info.json at training time and followed by predictions
+type Interpolation string
+
+const (
+	// InterpolationNone leaves missing days missing, so that lags fall back to derived values and
+	// defaults; models trained without a stamp use it
+	InterpolationNone Interpolation = "none"
+	// InterpolationForwardFill carries the latest earlier row forward
+	InterpolationForwardFill Interpolation = "ffill"
+	// InterpolationLinear interpolates between the nearest rows around the day, and carries the
+	// earlier one forward when no later row is known yet
+	InterpolationLinear Interpolation = "linear"
+)
+
+// InterpolationMaxGapDays is how far away the rows a missing day is filled from may be.
+// scripts/lightGBM_model.py uses the same number for training data
+const InterpolationMaxGapDays = 7
+
+// ParseInterpolation parses an interpolation method; an empty string is InterpolationNone
+func ParseInterpolation(value string) (Interpolation, error) {
+	switch Interpolation(value) {
+	case "", InterpolationNone:
+		return InterpolationNone, nil
+	case InterpolationForwardFill:
+		return InterpolationForwardFill, nil
+	case InterpolationLinear:
+		return InterpolationLinear, nil
+	}
+	return "", fmt.Errorf("unknown interpolation %q, expected %q, %q or %q", value, InterpolationNone,
+		InterpolationForwardFill, InterpolationLinear)
+}
+
+// Interpolate fills the lags and rolling means of historical on the days series has no value for.
+// series holds the daily rows of the key up to the lookup date, ordered by date; rows after the
+// lookup date are never used. A missing lag takes the interpolated value of its day, and a rolling
+// mean with missing days is recomputed over the stored and interpolated values of its window. It
+// returns the names of the features that used interpolated values
+func Interpolate(historical *repository.ProductHistoricalData, series []repository.SeriesPoint, lags repository.LagDates, method Interpolation) []string {
+	if method == InterpolationNone || historical == nil || len(series) == 0 {
+		return nil
+	}
+
+	prices := dailyValues(series, func(p repository.SeriesPoint) (float64, bool) { return p.Price.Float64, p.Price.Valid })
+	sales := dailyValues(series, func(p repository.SeriesPoint) (float64, bool) { return p.Sales.Float64, p.Sales.Valid })
+
+	var interpolated []string
+	lagFeatures := []struct {
+		name   string
+		values []dailyValue
+		day    time.Time
+		target *sql.NullFloat64
+	}{
+		{"price_lag_1", prices, lags.Lag1, &historical.PriceLag1},
+		{"sales_quantity_lag_1", sales, lags.Lag1, &historical.SalesQuantityLag1},
+		{"price_lag_3", prices, lags.Lag3, &historical.PriceLag3},
+		{"sales_quantity_lag_3", sales, lags.Lag3, &historical.SalesQuantityLag3},
+		{"price_lag_7", prices, lags.Lag7, &historical.PriceLag7},
+		{"sales_quantity_lag_7", sales, lags.Lag7, &historical.SalesQuantityLag7},
+	}
+	for _, f := range lagFeatures {
+		if f.target.Valid {
+			continue
+		}
+		if value, ok := interpolateDay(f.values, f.day, method); ok {
+			*f.target = sql.NullFloat64{Float64: value, Valid: true}
+			interpolated = append(interpolated, f.name)
+		}
+	}
+
+	windowFeatures := []struct {
+		name   string
+		values []dailyValue
+		window []time.Time
+		target *sql.NullFloat64
+	}{
+		{"price_rolling_mean_3", prices, lags.Window3, &historical.PriceRollingMean3},
+		{"sales_quantity_rolling_mean_3", sales, lags.Window3, &historical.SalesQuantityRollingMean3},
+		{"price_rolling_mean_7", prices, lags.Window7, &historical.PriceRollingMean7},
+		{"sales_quantity_rolling_mean_7", sales, lags.Window7, &historical.SalesQuantityRollingMean7},
+	}
+	for _, f := range windowFeatures {
+		sum, count, filled := 0.0, 0, false
+		for _, day := range f.window {
+			if value, ok := storedDay(f.values, day); ok {
+				sum += value
+				count++
+			} else if value, ok := interpolateDay(f.values, day, method); ok {
+				sum += value
+				count++
+				filled = true
+			}
+		}
+		if filled {
+			*f.target = sql.NullFloat64{Float64: sum / float64(count), Valid: true}
+			interpolated = append(interpolated, f.name)
+		}
+	}
+	return interpolated
+}
+
+// dailyValue is a stored value of one field of the series
+type dailyValue struct {
+	day   time.Time
+	value float64
+}
+
+// dailyValues returns the valid values of a field of the series, ordered by day
+func dailyValues(series []repository.SeriesPoint, field func(repository.SeriesPoint) (float64, bool)) []dailyValue {
+	var values []dailyValue
+	for _, point := range series {
+		if value, ok := field(point); ok {
+			values = append(values, dailyValue{day: truncateDay(point.Date), value: value})
+		}
+	}
+	return values
+}
+
+// storedDay returns the stored value of a day
+func storedDay(values []dailyValue, day time.Time) (float64, bool) {
+	for _, v := range values {
+		if v.day.Equal(day) {
+			return v.value, true
+		}
+	}
+	return 0, false
+}
+
+// interpolateDay returns the value of a day without a stored value from the nearest stored values
+// within InterpolationMaxGapDays around it
+func interpolateDay(values []dailyValue, day time.Time, method Interpolation) (float64, bool) {
+	var before, after *dailyValue
+	for i := range values {
+		v := &values[i]
+		if !v.day.After(day) {
+			before = v
+		} else if after == nil {
+			after = v
+		}
+	}
+	if before == nil || daysBetween(before.day, day) > InterpolationMaxGapDays {
+		return 0, false
+	}
+	if method == InterpolationLinear && after != nil && daysBetween(day, after.day) <= InterpolationMaxGapDays {
+		weight := float64(daysBetween(before.day, day)) / float64(daysBetween(before.day, after.day))
+		return before.value + (after.value-before.value)*weight, true
+	}
+	return before.value, true
+}
+
+// daysBetween returns the number of days from a to b
+func daysBetween(a, b time.Time) int {
+	return int(b.Sub(a).Hours() / 24)
+}
@@ -0,0 +1,122 @@
+package features
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// LagMode is how lag features and rolling means count days. A model is trained with one mode,
+// stamped into its feature_info.json, and predictions build its features the same way
+type LagMode string
+
+const (
+	// LagModeCalendar counts every day; models trained without a stamp use it
+	LagModeCalendar LagMode = "calendar"
+	// LagModeBusiness skips weekends and holidays
+	LagModeBusiness LagMode = "business"
+)
+
+// ParseLagMode parses a lag mode; an empty string is LagModeCalendar
+func ParseLagMode(value string) (LagMode, error) {
+	switch LagMode(value) {
+	case "", LagModeCalendar:
+		return LagModeCalendar, nil
+	case LagModeBusiness:
+		return LagModeBusiness, nil
+	}
+	return "", fmt.Errorf("unknown lag mode %q, expected %q or %q", value, LagModeCalendar, LagModeBusiness)
+}
+
+// Holidays is a holiday calendar, a set of dates in YYYY-MM-DD format
+type Holidays map[string]bool
+
+// LoadHolidays reads a holiday calendar file with one YYYY-MM-DD date per line. Blank lines and
+// lines starting with # are skipped
+func LoadHolidays(path string) (Holidays, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening holiday calendar: %w", err)
+	}
+	defer file.Close()
+
+	holidays := make(Holidays)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		value := strings.TrimSpace(scanner.Text())
+		if value == "" || strings.HasPrefix(value, "#") {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q on line %d of holiday calendar %s", value, line, path)
+		}
+		holidays[date.Format("2006-01-02")] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading holiday calendar: %w", err)
+	}
+	return holidays, nil
+}
+
+// IsHoliday reports whether the calendar date of t is a holiday
+func (h Holidays) IsHoliday(t time.Time) bool {
+	return h[t.Format("2006-01-02")]
+}
+
+// isBusinessDay reports whether the calendar date of t is neither a weekend nor a holiday
+func (h Holidays) isBusinessDay(t time.Time) bool {
+	return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday && !h.IsHoliday(t)
+}
+
+// LagDates returns the days the lag features and rolling means of a history lookup on date are
+// read from. In calendar mode lag N is N days before the date and a rolling mean of N covers the N
+// days ending on it. In business mode lag N is the Nth business day before the date and a rolling
+// mean of N covers the N business days ending on or before it. scripts/lightGBM_model.py builds
+// the training lags with the same rules
+func LagDates(date time.Time, mode LagMode, holidays Holidays) repository.LagDates {
+	day := truncateDay(date)
+
+	// The 7 business days before the date, nearest first. A calendar without them in the year
+	// before the date is unusable and falls back to calendar days
+	var before []time.Time
+	for d := day.AddDate(0, 0, -1); mode == LagModeBusiness && len(before) < 7 && d.After(day.AddDate(-1, 0, 0)); d = d.AddDate(0, 0, -1) {
+		if holidays.isBusinessDay(d) {
+			before = append(before, d)
+		}
+	}
+	if len(before) < 7 {
+		return repository.LagDates{
+			Lag1:    day.AddDate(0, 0, -1),
+			Lag3:    day.AddDate(0, 0, -3),
+			Lag7:    day.AddDate(0, 0, -7),
+			Window3: calendarDays(day, 3),
+			Window7: calendarDays(day, 7),
+		}
+	}
+
+	window := before
+	if holidays.isBusinessDay(day) {
+		window = append([]time.Time{day}, before...)
+	}
+	return repository.LagDates{
+		Lag1:    before[0],
+		Lag3:    before[2],
+		Lag7:    before[6],
+		Window3: window[:3],
+		Window7: window[:7],
+	}
+}
+
+// calendarDays returns the n days ending on day, nearest first
+func calendarDays(day time.Time, n int) []time.Time {
+	days := make([]time.Time, n)
+	for i := range days {
+		days[i] = day.AddDate(0, 0, -i)
+	}
+	return days
+}
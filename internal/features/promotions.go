@@ -0,0 +1,46 @@
+package features
+
+import "time"
+
+// PromotionHorizonDays is how far ahead a promotion counts as upcoming. It matches the 7-day
+// horizon of the models, and scripts/lightGBM_model.py uses the same number for training data
+const PromotionHorizonDays = 7
+
+// Promotion is a planned promotion of a product, or of a whole category when ProductName is empty.
+// StartsOn and EndsOn are inclusive dates
+type Promotion struct {
+	ProductName        string
+	Category           string
+	DiscountPercentage float64
+	StartsOn           time.Time
+	EndsOn             time.Time
+}
+
+// ApplyPromotions sets the promotion features of a vector for the given date. A promotion is active
+// when it covers the date and upcoming when it starts within PromotionHorizonDays after it; the
+// discount features hold the deepest discount among the active and upcoming promotions. Promotions
+// of other products and categories are ignored
+func ApplyPromotions(v *Vector, promotions []Promotion, date time.Time) {
+	day := truncateDay(date)
+	horizon := day.AddDate(0, 0, PromotionHorizonDays)
+
+	for _, p := range promotions {
+		if !(p.ProductName != "" && p.ProductName == v.ProductName) && !(p.Category != "" && p.Category == v.Category) {
+			continue
+		}
+		starts, ends := truncateDay(p.StartsOn), truncateDay(p.EndsOn)
+		switch {
+		case !starts.After(day) && !ends.Before(day):
+			v.PromoActive = true
+			v.PromoDiscountPercentage = max(v.PromoDiscountPercentage, p.DiscountPercentage)
+		case starts.After(day) && !starts.After(horizon):
+			v.PromoUpcoming = true
+			v.PromoUpcomingDiscountPercentage = max(v.PromoUpcomingDiscountPercentage, p.DiscountPercentage)
+		}
+	}
+}
+
+// truncateDay returns the calendar date of t as midnight UTC
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
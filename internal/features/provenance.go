@@ -0,0 +1,135 @@
+package features
+
+import (
+	"slices"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// Sources of a feature value
+const (
+	// SourceHistory is a current value, brand or category read from the latest history row
+	SourceHistory = "db"
+	// SourceLag1, SourceLag3 and SourceLag7 are lags read from the history row of their day
+	SourceLag1 = "db-lag1"
+	SourceLag3 = "db-lag3"
+	SourceLag7 = "db-lag7"
+	// SourceRolling is a rolling mean of the history rows of its window
+	SourceRolling = "rolling"
+	// SourceInterpolated is a lag or rolling mean computed from interpolated days
+	SourceInterpolated = "interpolated"
+	// SourceDerived is a value derived from other features, such as a missing price lag from the
+	// current price
+	SourceDerived = "derived"
+	// SourceDefault is a fixed default
+	SourceDefault = "default"
+	// SourceOverride is a value supplied by the caller
+	SourceOverride = "override"
+	// SourceCatalog is a brand or category of the product catalog
+	SourceCatalog = "catalog"
+)
+
+// Provenance tells where the value of a feature came from and which days of the history it
+// reflects
+type Provenance struct {
+	Source string `json:"source"`
+	// Date is the history day the value was read from, the latest day of the window for rolling
+	// means; nil for values not read from history
+	Date *time.Time `json:"date,omitempty"`
+	// From is the earliest day of the window of a rolling mean
+	From *time.Time `json:"from,omitempty"`
+}
+
+// historicalSources lists the features read from processed_data with where they are read from,
+// the window of the rolling means, and whether BuildFeatures derives them or falls back to a
+// default when missing
+var historicalSources = []struct {
+	name    string
+	source  string
+	window  int
+	derived bool
+}{
+	{"price", SourceHistory, 0, false},
+	{"original_price", SourceHistory, 0, true},
+	{"discount_percentage", SourceHistory, 0, true},
+	{"stock_level", SourceHistory, 0, false},
+	{"customer_rating", SourceHistory, 0, false},
+	{"review_count", SourceHistory, 0, false},
+	{"delivery_days", SourceHistory, 0, false},
+	{"sales_quantity_lag_1", SourceLag1, 0, false},
+	{"price_lag_1", SourceLag1, 0, true},
+	{"sales_quantity_lag_3", SourceLag3, 0, false},
+	{"price_lag_3", SourceLag3, 0, true},
+	{"sales_quantity_lag_7", SourceLag7, 0, false},
+	{"price_lag_7", SourceLag7, 0, true},
+	{"sales_quantity_rolling_mean_3", SourceRolling, 3, true},
+	{"price_rolling_mean_3", SourceRolling, 3, true},
+	{"sales_quantity_rolling_mean_7", SourceRolling, 7, true},
+	{"price_rolling_mean_7", SourceRolling, 7, true},
+}
+
+// TraceProvenance returns the provenance of the historical features, brand and category of a
+// vector built by BuildFeatures. present is the Presence of the history before interpolation,
+// latest the date of its latest row, nil without history, and interpolated and overrides the
+// features Interpolate and the caller filled in. The brand and category of the product catalog are
+// left to the caller
+func TraceProvenance(present map[string]bool, latest *time.Time, lags repository.LagDates, interpolated, overrides []string) map[string]Provenance {
+	provenance := make(map[string]Provenance, len(historicalSources)+2)
+	for _, f := range historicalSources {
+		var days []time.Time
+		switch f.source {
+		case SourceHistory:
+			if latest != nil {
+				days = []time.Time{*latest}
+			}
+		case SourceLag1:
+			days = []time.Time{lags.Lag1}
+		case SourceLag3:
+			days = []time.Time{lags.Lag3}
+		case SourceLag7:
+			days = []time.Time{lags.Lag7}
+		case SourceRolling:
+			days = lags.Window7
+			if f.window == 3 {
+				days = lags.Window3
+			}
+		}
+
+		switch {
+		case slices.Contains(overrides, f.name):
+			provenance[f.name] = Provenance{Source: SourceOverride}
+		case slices.Contains(interpolated, f.name):
+			provenance[f.name] = daysProvenance(SourceInterpolated, days)
+		case present[f.name]:
+			provenance[f.name] = daysProvenance(f.source, days)
+		case f.derived:
+			provenance[f.name] = Provenance{Source: SourceDerived}
+		default:
+			provenance[f.name] = Provenance{Source: SourceDefault}
+		}
+	}
+
+	categorical := Provenance{Source: SourceDefault}
+	if latest != nil {
+		categorical = daysProvenance(SourceHistory, []time.Time{*latest})
+	}
+	provenance["brand"] = categorical
+	provenance["category"] = categorical
+	return provenance
+}
+
+// daysProvenance is the provenance of a value read from days, nearest first
+func daysProvenance(source string, days []time.Time) Provenance {
+	provenance := Provenance{Source: source}
+	if len(days) == 0 {
+		return provenance
+	}
+	date := days[0]
+	provenance.Date = &date
+	if len(days) > 1 {
+		from := days[len(days)-1]
+		provenance.From = &from
+	}
+	return provenance
+}
@@ -0,0 +1,42 @@
+package features
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// ExternalPrefix starts the names of features supplied by providers. Models may be trained on such
+// features; the compatibility check accepts them since a provider may be unavailable at any time,
+// and the model then sees them as missing values
+const ExternalPrefix = "ext_"
+
+// Key identifies the product a provider is asked about
+type Key struct {
+	ProductName string
+	Category    string
+	Region      string
+	Seller      string
+}
+
+// Provider supplies features from outside processed_data, such as the weather in a region or the
+// price of a competitor
+type Provider interface {
+	// Name identifies the provider; its features are named ext_<name>_<feature>
+	Name() string
+	// Scope returns what the features depend on, e.g. the region and date for weather, so that
+	// products sharing it share a cached value
+	Scope(key Key, date time.Time) string
+	// Fetch returns the features for a product on a date by their name within the provider
+	Fetch(ctx context.Context, key Key, date time.Time) (map[string]float64, error)
+}
+
+// ExternalName returns the feature name of a value supplied by a provider
+func ExternalName(provider, feature string) string {
+	return ExternalPrefix + provider + "_" + feature
+}
+
+// IsExternal reports whether a feature name belongs to a provider
+func IsExternal(name string) bool {
+	return strings.HasPrefix(name, ExternalPrefix)
+}
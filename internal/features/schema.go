@@ -0,0 +1,91 @@
+package features
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SchemaVersion identifies the feature set built by this package. scripts/lightGBM_model.py
+// stamps the same number into feature_info.json at training time; bump both whenever a
+// feature is added, removed or changes meaning.
+const SchemaVersion = 3
+
+// ModelInfo is the feature_info.json written next to the trained models
+type ModelInfo struct {
+	// SchemaVersion is 0 for models trained before the stamp was introduced
+	SchemaVersion       int      `json:"schema_version"`
+	FeatureNames        []string `json:"feature_names"`
+	CategoricalFeatures []string `json:"categorical_features"`
+	LightGBMVersion     string   `json:"lightgbm_version,omitempty"`
+	// LagMode is empty for models trained before lag modes were introduced, which count
+	// calendar days
+	LagMode LagMode `json:"lag_mode,omitempty"`
+	// Interpolation is empty for models trained without filling missing days
+	Interpolation Interpolation `json:"interpolation,omitempty"`
+	// Targets lists the targets the version has a model for; it is empty for models trained before
+	// targets were declared, which have the CoreTargets only
+	Targets []string `json:"targets,omitempty"`
+	// TrainingWindow is "expanding" or "sliding", empty for models trained on all rows before the
+	// window was stamped; TrainingWindowDays is the length of a sliding window
+	TrainingWindow     string `json:"training_window,omitempty"`
+	TrainingWindowDays int    `json:"training_window_days,omitempty"`
+	// SamplePercent and SampleDays are set for models trained on a random sample or the last days
+	// of the training rows, which are for experiments only
+	SamplePercent float64 `json:"sample_percent,omitempty"`
+	SampleDays    int     `json:"sample_days,omitempty"`
+	// FeatureImportances is the total gain of the splits on each feature, per target; it is empty
+	// for models trained before importances were stamped
+	FeatureImportances map[string]map[string]float64 `json:"feature_importances,omitempty"`
+	// EncoderVersion is the version of the encoders.json artifact of the models, 0 for models
+	// trained before encoders, which leave unseen categories to LightGBM
+	EncoderVersion int `json:"encoder_version,omitempty"`
+}
+
+// Sampled reports whether the models were trained on a sample of the training rows
+func (info *ModelInfo) Sampled() bool {
+	return info.SamplePercent > 0 || info.SampleDays > 0
+}
+
+// Names returns the JSON names of the fields of Vector, leaving out External whose features are
+// named by their providers
+func Names() []string {
+	t := reflect.TypeOf(Vector{})
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "external" {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// CheckCompatibility reports an error when the model expects a different schema or encoder version or a
+// feature that Vector does not provide. Unstamped models are checked by feature names only.
+// External features are always accepted: a missing one reaches the model as a missing value.
+func CheckCompatibility(info *ModelInfo) error {
+	if info.SchemaVersion != 0 && info.SchemaVersion != SchemaVersion {
+		return fmt.Errorf("model feature schema version %d, feature builder version %d", info.SchemaVersion, SchemaVersion)
+	}
+	if info.EncoderVersion != 0 && info.EncoderVersion != EncoderVersion {
+		return fmt.Errorf("model encoder version %d, feature builder version %d", info.EncoderVersion, EncoderVersion)
+	}
+
+	provided := make(map[string]bool)
+	for _, name := range Names() {
+		provided[name] = true
+	}
+
+	var missing []string
+	for _, name := range info.FeatureNames {
+		if !provided[name] && !IsExternal(name) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("model expects features the feature builder does not provide: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
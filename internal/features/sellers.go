@@ -0,0 +1,28 @@
+package features
+
+// SellerStats are the reliability aggregates of a seller, refreshed from processed data by the
+// seller_stats job
+type SellerStats struct {
+	AvgDeliveryDays float64
+	// CancellationRate is nil when cancellations are not ingested
+	CancellationRate *float64
+	RatingTrend      float64
+}
+
+// ApplySellerStats sets the seller features of a vector. Without stats, as for a seller the last
+// refresh did not see, the average delivery time is the vector's own delivery time and the
+// cancellation rate and rating trend are 0. scripts/lightGBM_model.py applies the same defaults
+// to training rows
+func ApplySellerStats(v *Vector, stats *SellerStats) {
+	v.SellerAvgDeliveryDays = v.DeliveryDays
+	v.SellerCancellationRate = 0
+	v.SellerRatingTrend = 0
+	if stats == nil {
+		return
+	}
+	v.SellerAvgDeliveryDays = stats.AvgDeliveryDays
+	if stats.CancellationRate != nil {
+		v.SellerCancellationRate = *stats.CancellationRate
+	}
+	v.SellerRatingTrend = stats.RatingTrend
+}
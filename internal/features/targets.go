@@ -0,0 +1,63 @@
+package features
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Prediction targets every model version has a model for
+const (
+	TargetPrice = "price"
+	TargetSales = "sales"
+)
+
+// CoreTargets are the targets the prediction API has dedicated fields for
+var CoreTargets = []string{TargetPrice, TargetSales}
+
+// targetName is the form of a target name; the training data holds it as the <name>_target column
+var targetName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ParseTargets parses a comma-separated list of prediction targets. The core targets are always
+// included, first and in CoreTargets order, whether or not the list names them
+func ParseTargets(value string) ([]string, error) {
+	targets := append([]string(nil), CoreTargets...)
+	seen := map[string]bool{TargetPrice: true, TargetSales: true}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || (seen[name] && IsCoreTarget(name)) {
+			continue
+		}
+		if !targetName.MatchString(name) {
+			return nil, fmt.Errorf("invalid target name %q, expected lowercase letters, digits and underscores", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate target %s", name)
+		}
+		seen[name] = true
+		targets = append(targets, name)
+	}
+	return targets, nil
+}
+
+// IsCoreTarget reports whether target is one of CoreTargets
+func IsCoreTarget(target string) bool {
+	return target == TargetPrice || target == TargetSales
+}
+
+// ModelFile returns the name of the model artifact of a target
+func ModelFile(target string) string {
+	return target + "_model.pkl"
+}
+
+// ExtraTargets returns the targets of the model beyond CoreTargets, in training order. Models
+// trained before targets were declared have none
+func (info *ModelInfo) ExtraTargets() []string {
+	var extra []string
+	for _, target := range info.Targets {
+		if !IsCoreTarget(target) {
+			extra = append(extra, target)
+		}
+	}
+	return extra
+}
@@ -0,0 +1,281 @@
+// Package httpclient is the HTTP client of the integrations calling other services: batch
+// callbacks, external feature providers and the remote model server. Each integration gets a
+// Client of its own, with a timeout per attempt, retries with exponential backoff, a circuit
+// breaker per host and metrics labelled with its name
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// ErrCircuitOpen is returned without calling a host whose circuit is open after repeated failures
+var ErrCircuitOpen = errors.New("circuit open")
+
+// maxDrainBytes bounds what is read from the body of a response that is retried, so that its
+// connection can be reused
+const maxDrainBytes = 64 * 1024
+
+// Prepare is called on every attempt of a request right before it is sent, e.g. to sign it with
+// the time of the attempt
+type Prepare func(req *http.Request)
+
+// Policy says how a client calls other services
+type Policy struct {
+	// Timeout bounds each attempt, 0 leaves attempts to the request context
+	Timeout time.Duration
+	// MaxAttempts is the number of attempts of a request whose failures are retried; network
+	// errors, 429 and 5xx responses are, other responses are final
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// FailureThreshold is the number of consecutive failed requests after which the circuit of a
+	// host opens for Cooldown, failing requests to it at once; 0 disables the breaker
+	FailureThreshold int
+	Cooldown         time.Duration
+	// NoRedirects returns redirect responses instead of following them
+	NoRedirects bool
+	// PublicOnly refuses to connect to loopback, private, link-local and other internal addresses,
+	// for requests to URLs supplied by API clients
+	PublicOnly bool
+}
+
+// Client sends requests to other services following its policy
+type Client struct {
+	name   string
+	policy Policy
+	client *http.Client
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+
+	attempts     *metrics.CounterVec
+	latency      *metrics.HistogramVec
+	circuitOpens *metrics.CounterVec
+	logger       *zap.SugaredLogger
+}
+
+// circuit is the failure streak of a host
+type circuit struct {
+	failures  int
+	openUntil time.Time
+}
+
+// Metrics are the metrics shared by the clients, labelled with their names
+type Metrics struct {
+	attempts     *metrics.CounterVec
+	latency      *metrics.HistogramVec
+	circuitOpens *metrics.CounterVec
+}
+
+// NewMetrics registers the outbound request metrics; registry may be nil, in which case no
+// metrics are recorded
+func NewMetrics(registry *metrics.Registry) *Metrics {
+	if registry == nil {
+		return nil
+	}
+	return &Metrics{
+		attempts: registry.NewCounterVec("ml_outbound_attempts_total",
+			"Outbound HTTP attempts by client and result: a status class, error or circuit_open", "client", "result"),
+		latency: registry.NewHistogramVec("ml_outbound_attempt_seconds",
+			"Duration of outbound HTTP attempts", metrics.DefaultBuckets, "client"),
+		circuitOpens: registry.NewCounterVec("ml_outbound_circuit_opens_total",
+			"Circuits opened after repeated failures of a host", "client"),
+	}
+}
+
+// New creates a client named name in the metrics and logs. m may be nil
+func New(name string, policy Policy, m *Metrics, logger *zap.SugaredLogger) *Client {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	c := &Client{
+		name:     name,
+		policy:   policy,
+		client:   &http.Client{Timeout: policy.Timeout},
+		circuits: make(map[string]*circuit),
+		logger:   logger,
+	}
+	if policy.PublicOnly {
+		c.client.Transport = publicOnlyTransport()
+	}
+	if policy.NoRedirects {
+		c.client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	if m != nil {
+		c.attempts, c.latency, c.circuitOpens = m.attempts, m.latency, m.circuitOpens
+	}
+	return c
+}
+
+// Do sends a request like Send, without the number of attempts
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	resp, _, err := c.Send(req, nil)
+	return resp, err
+}
+
+// Send sends a request, retrying its failures with exponential backoff, and returns the response
+// of the last attempt and the number of attempts made. A request whose body can't be read again
+// is sent once. A response with a failed status is returned like any other, after its retries;
+// only requests that got no response return an error. prepare may be nil
+func (c *Client) Send(req *http.Request, prepare Prepare) (*http.Response, int, error) {
+	host := req.URL.Host
+	if !c.allow(host) {
+		c.observe("circuit_open", 0)
+		return nil, 0, fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+	}
+
+	maxAttempts := c.policy.MaxAttempts
+	if req.Body != nil && req.GetBody == nil {
+		maxAttempts = 1
+	}
+
+	var resp *http.Response
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		resp, err = c.attempt(req, attempt, prepare)
+		if !retryable(resp, err) || attempt == maxAttempts || req.Context().Err() != nil {
+			break
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+			resp.Body.Close()
+		}
+		if sleepErr := sleep(req.Context(), c.backoff(attempt-1)); sleepErr != nil {
+			if resp != nil {
+				return nil, attempt, sleepErr
+			}
+			break
+		}
+	}
+
+	// A caller that went away says nothing about the host
+	if req.Context().Err() == nil {
+		c.record(host, !retryable(resp, err))
+	}
+	return resp, attempt, err
+}
+
+// attempt makes one attempt of a request
+func (c *Client) attempt(req *http.Request, attempt int, prepare Prepare) (*http.Response, error) {
+	if attempt > 1 {
+		req = req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	result := "error"
+	if err == nil {
+		result = strconv.Itoa(resp.StatusCode/100) + "xx"
+	}
+	c.observe(result, time.Since(start))
+	return resp, err
+}
+
+// retryable reports whether the outcome of an attempt is a failure worth retrying
+func retryable(resp *http.Response, err error) bool {
+	if errors.Is(err, ErrNonPublicAddress) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoff returns the delay before the given retry, doubling from InitialBackoff up to MaxBackoff
+func (c *Client) backoff(retry int) time.Duration {
+	delay := c.policy.InitialBackoff << uint(retry)
+	if delay <= 0 || delay > c.policy.MaxBackoff {
+		delay = c.policy.MaxBackoff
+	}
+	return delay
+}
+
+// allow reports whether a host may be called, i.e. its circuit is not open
+func (c *Client) allow(host string) bool {
+	if c.policy.FailureThreshold <= 0 {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.circuits[host]
+	return !ok || time.Now().After(state.openUntil)
+}
+
+// record adds the outcome of a request to the failure streak of its host, opening its circuit
+// once the streak reaches the threshold
+func (c *Client) record(host string, succeeded bool) {
+	if c.policy.FailureThreshold <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.circuits[host]
+	if succeeded {
+		if ok {
+			delete(c.circuits, host)
+		}
+		return
+	}
+	if !ok {
+		state = &circuit{}
+		c.circuits[host] = state
+	}
+	state.failures++
+	if state.failures < c.policy.FailureThreshold {
+		return
+	}
+	state.failures = 0
+	state.openUntil = time.Now().Add(c.policy.Cooldown)
+	if c.circuitOpens != nil {
+		c.circuitOpens.WithLabelValues(c.name).Inc()
+	}
+	c.logger.Warnw("Outbound host keeps failing, opening its circuit", "client", c.name, "host", host,
+		"failures", c.policy.FailureThreshold, "cooldown", c.policy.Cooldown)
+}
+
+// observe counts an attempt, and records its duration unless it was not made
+func (c *Client) observe(result string, duration time.Duration) {
+	if c.attempts == nil {
+		return
+	}
+	c.attempts.WithLabelValues(c.name, result).Inc()
+	if result != "circuit_open" {
+		c.latency.WithLabelValues(c.name).Observe(duration.Seconds())
+	}
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
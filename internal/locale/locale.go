@@ -0,0 +1,124 @@
+// Package locale formats the numbers of exported files for the locale of their reader, so that a
+// spreadsheet opens a CSV export with the decimal and list separators it expects and an HTML report
+// reads naturally.
+package locale
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedLocale is returned when a locale tag is not one of Supported
+var ErrUnsupportedLocale = errors.New("unsupported locale")
+
+// Locale is how numbers and amounts are written for the readers of a language and region. Amounts
+// are rubles, the currency of the data, whatever the locale
+type Locale struct {
+	// Tag is the BCP 47 tag of the locale, empty for Invariant
+	Tag string
+	// Decimal is the decimal separator, Group the thousands separator or empty for no grouping
+	Decimal string
+	Group   string
+	// Currency is the symbol of rubles, written before amounts unless CurrencyAfter is set. Amounts
+	// have no symbol when it is empty
+	Currency      string
+	CurrencyAfter bool
+	// PercentSpace separates a number from its percent sign
+	PercentSpace string
+	// ListSeparator is the field separator spreadsheets of the locale expect in CSV files
+	ListSeparator rune
+}
+
+var (
+	// Invariant is the format of exports that don't ask for a locale: dot decimals, no grouping,
+	// no currency symbol and comma-separated CSV, as read by programs rather than people
+	Invariant = Locale{Decimal: ".", ListSeparator: ','}
+	// EnUS writes 1,234.5 and RUB 1,234.50
+	EnUS = Locale{Tag: "en-US", Decimal: ".", Group: ",", Currency: "RUB\u00a0", ListSeparator: ','}
+	// RuRU writes 1 234,5 and 1 234,50 ₽ with no-break spaces. Russian Excel reads commas as decimal
+	// separators, so its CSV files are separated by semicolons
+	RuRU = Locale{Tag: "ru-RU", Decimal: ",", Group: "\u00a0", Currency: "\u00a0₽", CurrencyAfter: true,
+		PercentSpace: "\u00a0", ListSeparator: ';'}
+)
+
+// Supported lists the locales exports can be formatted for
+var Supported = []Locale{EnUS, RuRU}
+
+// Parse returns the locale of a tag. Tags are matched case-insensitively, with an underscore for
+// the hyphen or by language alone ("ru", "ru_RU"); an empty tag is Invariant
+func Parse(tag string) (Locale, error) {
+	if tag == "" {
+		return Invariant, nil
+	}
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	for _, l := range Supported {
+		lower := strings.ToLower(l.Tag)
+		if normalized == lower || normalized == lower[:strings.IndexByte(lower, '-')] {
+			return l, nil
+		}
+	}
+	tags := make([]string, len(Supported))
+	for i, l := range Supported {
+		tags[i] = l.Tag
+	}
+	return Invariant, fmt.Errorf("%w %q, expected one of %s", ErrUnsupportedLocale, tag, strings.Join(tags, ", "))
+}
+
+// FormatFloat formats a value like strconv.FormatFloat with the 'f' format, -1 precision being the
+// fewest digits that represent it exactly, and the decimal separator of the locale. Digits are not
+// grouped, so that spreadsheets read the value as a number
+func (l Locale) FormatFloat(value float64, precision int) string {
+	formatted := strconv.FormatFloat(value, 'f', precision, 64)
+	if l.Decimal != "." {
+		formatted = strings.Replace(formatted, ".", l.Decimal, 1)
+	}
+	return formatted
+}
+
+// Number formats a value with precision decimals for display, grouping the thousands
+func (l Locale) Number(value float64, precision int) string {
+	formatted := strconv.FormatFloat(value, 'f', precision, 64)
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return formatted
+	}
+	sign := ""
+	if strings.HasPrefix(formatted, "-") {
+		sign, formatted = "-", formatted[1:]
+	}
+	integer, fraction, hasFraction := strings.Cut(formatted, ".")
+	if l.Group != "" && len(integer) > 3 {
+		var grouped strings.Builder
+		head := len(integer) % 3
+		if head > 0 {
+			grouped.WriteString(integer[:head])
+		}
+		for i := head; i < len(integer); i += 3 {
+			if grouped.Len() > 0 {
+				grouped.WriteString(l.Group)
+			}
+			grouped.WriteString(integer[i : i+3])
+		}
+		integer = grouped.String()
+	}
+	if hasFraction {
+		return sign + integer + l.Decimal + fraction
+	}
+	return sign + integer
+}
+
+// Amount formats an amount of rubles with two decimals and the currency symbol of the locale
+func (l Locale) Amount(value float64) string {
+	number := l.Number(value, 2)
+	if l.CurrencyAfter {
+		return number + l.Currency
+	}
+	return l.Currency + number
+}
+
+// Percent formats a percentage, 12.5 for 12.5%, with precision decimals
+func (l Locale) Percent(value float64, precision int) string {
+	return l.Number(value, precision) + l.PercentSpace + "%"
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+)
+
+// HTTPMetrics records request counts and latencies per route
+type HTTPMetrics struct {
+	requests *CounterVec
+	duration *HistogramVec
+}
+
+// RouteStats summarizes the requests served by a route
+type RouteStats struct {
+	Method       string  `json:"method"`
+	Route        string  `json:"route"`
+	Requests     uint64  `json:"requests"`
+	Errors       uint64  `json:"errors"`
+	P95LatencyMs float64 `json:"p95_latency_ms"`
+}
+
+// NewHTTPMetrics registers the HTTP request metrics in the registry
+func NewHTTPMetrics(registry *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: registry.NewCounterVec("http_requests_total",
+			"Number of HTTP requests", "method", "route", "status"),
+		duration: registry.NewHistogramVec("http_request_duration_seconds",
+			"HTTP request latency", DefaultBuckets, "method", "route"),
+	}
+}
+
+// Observe records a finished request
+func (m *HTTPMetrics) Observe(method, route string, status int, duration time.Duration) {
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.duration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// Routes returns per-route statistics ordered by method and route.
+// Responses with a 5xx status count as errors.
+func (m *HTTPMetrics) Routes() []RouteStats {
+	errors := make(map[string]uint64)
+	m.requests.each(func(values []string, c *Counter) {
+		if len(values[2]) == 3 && values[2][0] == '5' {
+			errors[values[0]+" "+values[1]] += uint64(c.Value())
+		}
+	})
+
+	var stats []RouteStats
+	m.duration.each(func(values []string, h *Histogram) {
+		stats = append(stats, RouteStats{
+			Method:       values[0],
+			Route:        values[1],
+			Requests:     h.Count(),
+			Errors:       errors[values[0]+" "+values[1]],
+			P95LatencyMs: h.Quantile(0.95) * 1000,
+		})
+	})
+	return stats
+}
@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SLO objectives
+const (
+	ObjectiveLatency      = "latency"
+	ObjectiveAvailability = "availability"
+)
+
+// Alert severities of a burning error budget
+const (
+	AlertPage   = "page"
+	AlertTicket = "ticket"
+)
+
+// BurnRateWindows are the windows burn rates are computed over. Alerts follow the multiwindow,
+// multi-burn-rate recipe for a 30-day budget: a page when both the 1h and 5m burn rates exceed
+// 14.4 (2% of the budget spent in an hour) and a ticket when both the 6h and 30m burn rates exceed
+// 6 (5% of the budget spent in six hours)
+var BurnRateWindows = []time.Duration{5 * time.Minute, 30 * time.Minute, time.Hour, 6 * time.Hour}
+
+// Burn rate thresholds of the alerts
+const (
+	pageBurnRate   = 14.4
+	ticketBurnRate = 6
+)
+
+// sloBucketCount is the number of one-minute buckets kept per SLO, enough for the longest window
+const sloBucketCount = 360
+
+// SLO is a service level objective over the requests of some routes. A request is good for the
+// latency objective when it finishes within LatencyThreshold and for the availability objective
+// when it does not fail with a 5xx status. Each objective is off when its target is 0
+type SLO struct {
+	Name string
+	// Routes are "METHOD /route" pairs as registered with the router; empty matches every route
+	Routes             []string
+	LatencyThreshold   time.Duration
+	LatencyTarget      float64
+	AvailabilityTarget float64
+}
+
+// SLOWindow is the state of an objective over one burn rate window
+type SLOWindow struct {
+	Window   string  `json:"window"`
+	Requests uint64  `json:"requests"`
+	Bad      uint64  `json:"bad"`
+	BurnRate float64 `json:"burn_rate"`
+}
+
+// SLOObjective is the state of one objective of an SLO
+type SLOObjective struct {
+	Objective          string      `json:"objective"`
+	Target             float64     `json:"target"`
+	LatencyThresholdMs int64       `json:"latency_threshold_ms,omitempty"`
+	Windows            []SLOWindow `json:"windows"`
+	// Alert is the severity of the burn rate alert that fires, empty when none does
+	Alert string `json:"alert,omitempty"`
+}
+
+// SLOSummary is the state of an SLO and its objectives
+type SLOSummary struct {
+	Name       string         `json:"name"`
+	Routes     []string       `json:"routes,omitempty"`
+	Objectives []SLOObjective `json:"objectives"`
+}
+
+// sloBucket counts the requests of one minute
+type sloBucket struct {
+	minute int64
+	total  uint64
+	slow   uint64
+	failed uint64
+}
+
+// sloState tracks the requests of one SLO in a ring of one-minute buckets
+type sloState struct {
+	slo     SLO
+	routes  map[string]bool
+	mu      sync.Mutex
+	buckets [sloBucketCount]sloBucket
+}
+
+// SLOTracker tracks SLOs from finished requests and exposes their burn rates and alerts as metrics
+type SLOTracker struct {
+	slos []*sloState
+	now  func() time.Time
+}
+
+// NewSLOTracker registers the SLO metrics of the given objectives in the registry
+func NewSLOTracker(registry *Registry, slos []SLO) *SLOTracker {
+	t := &SLOTracker{now: time.Now}
+	for _, slo := range slos {
+		state := &sloState{slo: slo}
+		if len(slo.Routes) > 0 {
+			state.routes = make(map[string]bool, len(slo.Routes))
+			for _, route := range slo.Routes {
+				state.routes[route] = true
+			}
+		}
+		t.slos = append(t.slos, state)
+	}
+	registry.register(t)
+	return t
+}
+
+// Observe records a finished request against the SLOs covering its route
+func (t *SLOTracker) Observe(method, route string, status int, duration time.Duration) {
+	minute := t.now().Unix() / 60
+	for _, state := range t.slos {
+		if state.routes != nil && !state.routes[method+" "+route] {
+			continue
+		}
+
+		state.mu.Lock()
+		bucket := &state.buckets[minute%sloBucketCount]
+		if bucket.minute != minute {
+			*bucket = sloBucket{minute: minute}
+		}
+		bucket.total++
+		if state.slo.LatencyThreshold > 0 && duration > state.slo.LatencyThreshold {
+			bucket.slow++
+		}
+		if status >= 500 {
+			bucket.failed++
+		}
+		state.mu.Unlock()
+	}
+}
+
+// Summary returns the current state of every SLO
+func (t *SLOTracker) Summary() []SLOSummary {
+	minute := t.now().Unix() / 60
+	summaries := make([]SLOSummary, 0, len(t.slos))
+	for _, state := range t.slos {
+		summaries = append(summaries, state.summary(minute))
+	}
+	return summaries
+}
+
+// summary computes the objectives of an SLO as of the given minute
+func (s *sloState) summary(minute int64) SLOSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := SLOSummary{Name: s.slo.Name, Routes: s.slo.Routes}
+	if s.slo.LatencyThreshold > 0 && s.slo.LatencyTarget > 0 {
+		objective := s.objective(minute, ObjectiveLatency, s.slo.LatencyTarget, func(b *sloBucket) uint64 { return b.slow })
+		objective.LatencyThresholdMs = s.slo.LatencyThreshold.Milliseconds()
+		summary.Objectives = append(summary.Objectives, objective)
+	}
+	if s.slo.AvailabilityTarget > 0 {
+		summary.Objectives = append(summary.Objectives,
+			s.objective(minute, ObjectiveAvailability, s.slo.AvailabilityTarget, func(b *sloBucket) uint64 { return b.failed }))
+	}
+	return summary
+}
+
+// objective computes the burn rates of one objective. The lock must be held
+func (s *sloState) objective(minute int64, name string, target float64, bad func(*sloBucket) uint64) SLOObjective {
+	objective := SLOObjective{Objective: name, Target: target}
+	burnRates := make(map[time.Duration]float64, len(BurnRateWindows))
+	for _, window := range BurnRateWindows {
+		var total, badCount uint64
+		first := minute - int64(window/time.Minute) + 1
+		for i := range s.buckets {
+			bucket := &s.buckets[i]
+			if bucket.minute >= first && bucket.minute <= minute {
+				total += bucket.total
+				badCount += bad(bucket)
+			}
+		}
+
+		var burnRate float64
+		if total > 0 && target < 1 {
+			burnRate = float64(badCount) / float64(total) / (1 - target)
+		}
+		burnRates[window] = burnRate
+		objective.Windows = append(objective.Windows, SLOWindow{
+			Window:   formatWindow(window),
+			Requests: total,
+			Bad:      badCount,
+			BurnRate: burnRate,
+		})
+	}
+
+	switch {
+	case burnRates[time.Hour] > pageBurnRate && burnRates[5*time.Minute] > pageBurnRate:
+		objective.Alert = AlertPage
+	case burnRates[6*time.Hour] > ticketBurnRate && burnRates[30*time.Minute] > ticketBurnRate:
+		objective.Alert = AlertTicket
+	}
+	return objective
+}
+
+// write renders the targets, burn rates and alerts of the SLOs
+func (t *SLOTracker) write(w io.Writer) {
+	summaries := t.Summary()
+
+	fmt.Fprintf(w, "# HELP slo_target Target ratio of good requests\n# TYPE slo_target gauge\n")
+	for _, summary := range summaries {
+		for _, objective := range summary.Objectives {
+			fmt.Fprintf(w, "slo_target%s %s\n",
+				formatLabels([]string{"slo", "objective"}, []string{summary.Name, objective.Objective}),
+				formatValue(objective.Target))
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP slo_burn_rate Rate the error budget is spent at over the window, 1 spends it exactly\n# TYPE slo_burn_rate gauge\n")
+	for _, summary := range summaries {
+		for _, objective := range summary.Objectives {
+			for _, window := range objective.Windows {
+				fmt.Fprintf(w, "slo_burn_rate%s %s\n",
+					formatLabels([]string{"slo", "objective", "window"}, []string{summary.Name, objective.Objective, window.Window}),
+					formatValue(window.BurnRate))
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP slo_alert Whether the burn rate alert of the severity fires\n# TYPE slo_alert gauge\n")
+	for _, summary := range summaries {
+		for _, objective := range summary.Objectives {
+			for _, severity := range []string{AlertPage, AlertTicket} {
+				firing := 0.0
+				if objective.Alert == severity {
+					firing = 1
+				}
+				fmt.Fprintf(w, "slo_alert%s %s\n",
+					formatLabels([]string{"slo", "objective", "severity"}, []string{summary.Name, objective.Objective, severity}),
+					formatValue(firing))
+			}
+		}
+	}
+}
+
+// formatWindow renders a window the way Prometheus writes durations, such as 5m or 6h
+func formatWindow(window time.Duration) string {
+	if window%time.Hour == 0 {
+		return fmt.Sprintf("%dh", window/time.Hour)
+	}
+	return fmt.Sprintf("%dm", window/time.Minute)
+}
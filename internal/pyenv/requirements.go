@@ -0,0 +1,164 @@
+// Package pyenv parses pip requirement specifiers and checks installed package versions against them.
+//
+// Only the subset used by requirements.txt is supported: one package per line with at most one
+// comparison (==, !=, >=, <=, >, < or ~=). Comments, blank lines and environment markers are ignored.
+package pyenv
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Requirement is a single package requirement, e.g. lightgbm==3.3.5
+type Requirement struct {
+	Name string
+	// Op is the comparison operator, empty when any version is accepted
+	Op      string
+	Version string
+}
+
+// String formats the requirement as in requirements.txt
+func (r Requirement) String() string {
+	return r.Name + r.Op + r.Version
+}
+
+// Mismatch describes a requirement not satisfied by the installed environment
+type Mismatch struct {
+	Package  string `json:"package"`
+	Required string `json:"required"`
+	// Installed is empty when the package is missing
+	Installed string `json:"installed,omitempty"`
+}
+
+// String describes the mismatch for error messages
+func (m Mismatch) String() string {
+	if m.Installed == "" {
+		return fmt.Sprintf("%s is not installed (required %s)", m.Package, m.Required)
+	}
+	return fmt.Sprintf("%s %s is installed (required %s)", m.Package, m.Installed, m.Required)
+}
+
+var requirementPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:(==|!=|>=|<=|~=|>|<)\s*([^\s,;]+))?$`)
+
+// ParseRequirements parses a requirements.txt document
+func ParseRequirements(text string) ([]Requirement, error) {
+	var requirements []Requirement
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; scanner.Scan(); line++ {
+		spec, _, _ := strings.Cut(scanner.Text(), "#")
+		spec, _, _ = strings.Cut(spec, ";")
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		match := requirementPattern.FindStringSubmatch(spec)
+		if match == nil {
+			return nil, fmt.Errorf("line %d: unsupported requirement %q", line, spec)
+		}
+		requirements = append(requirements, Requirement{
+			Name:    strings.ToLower(match[1]),
+			Op:      match[2],
+			Version: match[3],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return requirements, nil
+}
+
+// Names returns the package names of the requirements
+func Names(requirements []Requirement) []string {
+	names := make([]string, 0, len(requirements))
+	for _, r := range requirements {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// Verify compares the installed versions, keyed by package name, with the requirements
+func Verify(requirements []Requirement, installed map[string]string) []Mismatch {
+	var mismatches []Mismatch
+	for _, r := range requirements {
+		version := installed[r.Name]
+		if version == "" || !r.SatisfiedBy(version) {
+			mismatches = append(mismatches, Mismatch{Package: r.Name, Required: r.String(), Installed: version})
+		}
+	}
+	return mismatches
+}
+
+// SatisfiedBy reports whether the installed version satisfies the requirement
+func (r Requirement) SatisfiedBy(version string) bool {
+	cmp := compareVersions(version, r.Version)
+	switch r.Op {
+	case "":
+		return true
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "~=":
+		// ~=1.4.2 means >=1.4.2 and ==1.4.*
+		parts := strings.Split(r.Version, ".")
+		if len(parts) < 2 {
+			return cmp >= 0
+		}
+		prefix := strings.Join(parts[:len(parts)-1], ".")
+		return cmp >= 0 && compareVersions(truncateVersion(version, len(parts)-1), prefix) == 0
+	}
+	return false
+}
+
+// truncateVersion keeps the first n release segments of a version
+func truncateVersion(version string, n int) string {
+	parts := strings.Split(version, ".")
+	if len(parts) > n {
+		parts = parts[:n]
+	}
+	return strings.Join(parts, ".")
+}
+
+// compareVersions compares dotted versions segment by segment, numerically where both segments
+// are numbers, treating missing segments as 0. Pre-release suffixes are compared as text.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+
+		xn, xErr := strconv.Atoi(x)
+		yn, yErr := strconv.Atoi(y)
+		switch {
+		case xErr == nil && yErr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package rabbitmq
+
+import (
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+)
+
+// Outcomes of a consumed message
+const (
+	OutcomeAcked            = "acked"
+	OutcomeRejected         = "rejected"
+	OutcomeInvalidSignature = "invalid_signature"
+)
+
+// ConsumerMetrics records how far consumers are behind their queues and how they process messages
+type ConsumerMetrics struct {
+	lag          *metrics.GaugeVec
+	inFlight     *metrics.GaugeVec
+	processing   *metrics.HistogramVec
+	redeliveries *metrics.CounterVec
+}
+
+// NewConsumerMetrics registers the consumer metrics in the registry
+func NewConsumerMetrics(registry *metrics.Registry) *ConsumerMetrics {
+	return &ConsumerMetrics{
+		lag: registry.NewGaugeVec("rabbitmq_consumer_lag_messages",
+			"Messages ready in a consumed queue, waiting for a consumer", "queue"),
+		inFlight: registry.NewGaugeVec("rabbitmq_consumer_in_flight_messages",
+			"Messages received and not yet acknowledged or rejected", "queue"),
+		processing: registry.NewHistogramVec("rabbitmq_message_processing_seconds",
+			"Time from receiving a message to acknowledging or rejecting it", metrics.DefaultBuckets, "queue", "outcome"),
+		redeliveries: registry.NewCounterVec("rabbitmq_message_redeliveries_total",
+			"Messages received again after an earlier delivery was not acknowledged", "queue"),
+	}
+}
+
+// observeLag records the ready messages of a queue
+func (m *ConsumerMetrics) observeLag(queueName string, messages int) {
+	if m == nil {
+		return
+	}
+	m.lag.WithLabelValues(queueName).Set(float64(messages))
+}
+
+// begin records a received message and returns the function recording its outcome
+func (m *ConsumerMetrics) begin(queueName string, redelivered bool) func(outcome string) {
+	if m == nil {
+		return func(string) {}
+	}
+
+	started := time.Now()
+	if redelivered {
+		m.redeliveries.WithLabelValues(queueName).Inc()
+	}
+	inFlight := m.inFlight.WithLabelValues(queueName)
+	inFlight.Add(1)
+	return func(outcome string) {
+		inFlight.Add(-1)
+		m.processing.WithLabelValues(queueName, outcome).Observe(time.Since(started).Seconds())
+	}
+}
@@ -3,8 +3,12 @@ package rabbitmq
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/graduate-work-mirea/data-processor-service/internal/chaos"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
 )
@@ -12,10 +16,20 @@ import (
 type Client struct {
 	conn    *amqp.Connection
 	channel *amqp.Channel
-	logger  *zap.SugaredLogger
+	// signer signs published and verifies consumed messages; nil disables message signing
+	signer *Signer
+	// consumerMetrics records consumer lag and processing; nil disables them
+	consumerMetrics *ConsumerMetrics
+	// lagInterval is how often the lag of consumed queues is measured; 0 disables the measurement
+	lagInterval time.Duration
+	logger      *zap.SugaredLogger
+
+	mu sync.Mutex
+	// lag holds the last measured ready messages of the queues being consumed
+	lag map[string]int
 }
 
-func NewClient(rabbitMQURL string, logger *zap.SugaredLogger) (*Client, error) {
+func NewClient(rabbitMQURL string, signer *Signer, consumerMetrics *ConsumerMetrics, lagInterval time.Duration, logger *zap.SugaredLogger) (*Client, error) {
 	conn, err := amqp.Dial(rabbitMQURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
@@ -28,13 +42,20 @@ func NewClient(rabbitMQURL string, logger *zap.SugaredLogger) (*Client, error) {
 	}
 
 	return &Client{
-		conn:    conn,
-		channel: ch,
-		logger:  logger,
+		conn:            conn,
+		channel:         ch,
+		signer:          signer,
+		consumerMetrics: consumerMetrics,
+		lagInterval:     lagInterval,
+		logger:          logger,
+		lag:             map[string]int{},
 	}, nil
 }
 
 func (c *Client) DeclareQueue(queueName string) (amqp.Queue, error) {
+	if err := injectDisconnect(context.Background()); err != nil {
+		return amqp.Queue{}, err
+	}
 	return c.channel.QueueDeclare(
 		queueName, // name
 		true,      // durable
@@ -49,16 +70,26 @@ func (c *Client) PublishMessage(ctx context.Context, queueName string, body []by
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	msg := amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	}
+	if c.signer != nil && c.signer.producer != "" {
+		if err := c.signer.Sign(queueName, &msg); err != nil {
+			return fmt.Errorf("failed to sign message: %w", err)
+		}
+	}
+
+	if err := injectDisconnect(ctx); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
 	err := c.channel.PublishWithContext(
 		ctx,
 		"",        // exchange
 		queueName, // routing key
 		false,     // mandatory
 		false,     // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
+		msg,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to publish message: %w", err)
@@ -68,6 +99,105 @@ func (c *Client) PublishMessage(ctx context.Context, queueName string, body []by
 	return nil
 }
 
+// handle verifies and processes a single delivery. With a signer, messages that are unsigned, signed
+// by an unknown producer, tampered with or replayed are rejected without requeueing, so they go to
+// the queue's dead-letter exchange if it has one, and never reach handler. Messages are acknowledged
+// when handler succeeds and rejected when it fails
+func (c *Client) handle(ctx context.Context, queueName string, delivery amqp.Delivery, handler func(ctx context.Context, delivery amqp.Delivery) error) {
+	done := c.consumerMetrics.begin(queueName, delivery.Redelivered)
+
+	if c.signer != nil {
+		if producer, err := c.signer.Verify(&delivery); err != nil {
+			c.logger.Warnw("Rejected message with invalid signature", "error", err, "queue", queueName, "producer", producer)
+			delivery.Reject(false)
+			done(OutcomeInvalidSignature)
+			return
+		}
+	}
+
+	if err := handler(ctx, delivery); err != nil {
+		c.logger.Errorw("Failed to process message", "error", err, "queue", queueName, "redelivered", delivery.Redelivered)
+		delivery.Reject(false)
+		done(OutcomeRejected)
+		return
+	}
+	delivery.Ack(false)
+	done(OutcomeAcked)
+}
+
+// trackLag measures the lag of a consumed queue until ctx is done
+func (c *Client) trackLag(ctx context.Context, queueName string) {
+	ticker := time.NewTicker(c.lagInterval)
+	defer ticker.Stop()
+	defer func() {
+		c.mu.Lock()
+		delete(c.lag, queueName)
+		c.mu.Unlock()
+	}()
+
+	for {
+		if depth, err := c.QueueDepth(queueName); err != nil {
+			c.logger.Warnw("Failed to measure consumer lag", "error", err, "queue", queueName)
+		} else {
+			c.mu.Lock()
+			c.lag[queueName] = depth
+			c.mu.Unlock()
+			c.consumerMetrics.observeLag(queueName, depth)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// QueueDepth returns the number of messages ready in a queue. The queue is declared passively on a
+// channel of its own, since a failed declaration closes the channel it was made on
+func (c *Client) QueueDepth(queueName string) (int, error) {
+	if err := injectDisconnect(context.Background()); err != nil {
+		return 0, err
+	}
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	queue, err := ch.QueueDeclarePassive(
+		queueName, // name
+		true,      // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		nil,       // arguments
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect queue %s: %w", queueName, err)
+	}
+	return queue.Messages, nil
+}
+
+// CheckLag reports an error when a consumed queue had more than maxLag messages ready when its lag
+// was last measured. Queues whose lag could not be measured yet are not reported
+func (c *Client) CheckLag(maxLag int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var behind []string
+	for queueName, depth := range c.lag {
+		if depth > maxLag {
+			behind = append(behind, fmt.Sprintf("%s has %d messages ready", queueName, depth))
+		}
+	}
+	if len(behind) == 0 {
+		return nil
+	}
+	sort.Strings(behind)
+	return fmt.Errorf("consumer lag above %d: %s", maxLag, strings.Join(behind, ", "))
+}
+
 func (c *Client) Close() {
 	if c.channel != nil {
 		c.channel.Close()
@@ -77,6 +207,23 @@ func (c *Client) Close() {
 	}
 }
 
+// Healthy reports an error if the connection to the broker has been closed
+func (c *Client) Healthy() error {
+	if c.conn == nil || c.conn.IsClosed() || injectDisconnect(context.Background()) != nil {
+		return fmt.Errorf("RabbitMQ connection is closed")
+	}
+	return nil
+}
+
+// injectDisconnect applies the RabbitMQ fault of chaos builds, failing the call as if the broker
+// had closed the connection
+func injectDisconnect(ctx context.Context) error {
+	if err := chaos.Inject(ctx, chaos.TargetRabbitMQ); err != nil {
+		return fmt.Errorf("%w (%v)", amqp.ErrClosed, err)
+	}
+	return nil
+}
+
 // Channel returns the underlying AMQP channel
 func (c *Client) Channel() *amqp.Channel {
 	return c.channel
@@ -0,0 +1,176 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// pausedRecheckInterval is how often a consumer with paused queues looks at the weights again
+const pausedRecheckInterval = time.Second
+
+// weightedSource is a queue consumed by ConsumeWeighted
+type weightedSource struct {
+	queue      string
+	deliveries <-chan amqp.Delivery
+	// head is a received delivery waiting for its turn
+	head *amqp.Delivery
+	// current is the smooth weighted round-robin credit of the queue
+	current int
+}
+
+// ConsumeWeighted delivers the messages of several queues to handler until ctx is done, one at a
+// time, taking turns between the queues that have messages waiting in proportion to their weights
+// (smooth weighted round-robin). A high-volume queue therefore cannot starve the others, and a queue
+// that was idle does not get a burst of turns when messages arrive. weight is asked before every
+// turn, so weight changes apply immediately; a weight of 0 pauses the queue. The broker sends at
+// most prefetch unacknowledged messages per queue, so messages wait in their queue instead of in
+// this process. Deliveries are verified, acknowledged and measured by handle, and the lag of the
+// queues is measured every lag interval
+func (c *Client) ConsumeWeighted(ctx context.Context, queueNames []string, prefetch int, weight func(queueName string) int, handler func(ctx context.Context, delivery amqp.Delivery) error) error {
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	// Without a prefetch limit the broker pushes every message, and the turns would only reorder
+	// messages that are already here
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set prefetch: %w", err)
+	}
+
+	sources := make([]weightedSource, len(queueNames))
+	for i, queueName := range queueNames {
+		deliveries, err := ch.ConsumeWithContext(
+			ctx,
+			queueName, // queue
+			"",        // consumer
+			false,     // auto-ack
+			false,     // exclusive
+			false,     // no-local
+			false,     // no-wait
+			nil,       // args
+		)
+		if err != nil {
+			return fmt.Errorf("failed to consume queue %s: %w", queueName, err)
+		}
+		sources[i] = weightedSource{queue: queueName, deliveries: deliveries}
+	}
+
+	if c.lagInterval > 0 {
+		lagCtx, stopLag := context.WithCancel(ctx)
+		defer stopLag()
+		for _, queueName := range queueNames {
+			go c.trackLag(lagCtx, queueName)
+		}
+	}
+
+	weights := make([]int, len(sources))
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for i := range sources {
+			weights[i] = weight(sources[i].queue)
+		}
+
+		// Take the next delivery of every active queue that has one waiting
+		for i := range sources {
+			source := &sources[i]
+			if source.head != nil || weights[i] <= 0 {
+				continue
+			}
+			select {
+			case delivery, ok := <-source.deliveries:
+				if !ok {
+					return fmt.Errorf("delivery channel of queue %s closed", source.queue)
+				}
+				source.head = &delivery
+			default:
+			}
+		}
+
+		turn := nextTurn(sources, weights)
+		if turn < 0 {
+			if err := waitForDelivery(ctx, sources, weights); err != nil {
+				return err
+			}
+			continue
+		}
+
+		source := &sources[turn]
+		delivery := *source.head
+		source.head = nil
+		if err := injectDisconnect(ctx); err != nil {
+			delivery.Nack(false, true)
+			return fmt.Errorf("delivery channel of queue %s closed: %w", source.queue, err)
+		}
+		c.handle(ctx, source.queue, delivery, handler)
+	}
+}
+
+// nextTurn picks the queue whose waiting delivery is handled next, or -1 when no active queue has
+// one. Only queues with a delivery waiting earn credit
+func nextTurn(sources []weightedSource, weights []int) int {
+	total := 0
+	turn := -1
+	for i := range sources {
+		if sources[i].head == nil || weights[i] <= 0 {
+			continue
+		}
+		sources[i].current += weights[i]
+		total += weights[i]
+		if turn < 0 || sources[i].current > sources[turn].current {
+			turn = i
+		}
+	}
+	if turn >= 0 {
+		sources[turn].current -= total
+	}
+	return turn
+}
+
+// waitForDelivery blocks until a delivery of an active queue arrives and stores it as the head of
+// its queue. While any queue is paused it also returns after pausedRecheckInterval, so that a queue
+// resumed while the active ones are idle is consumed again
+func waitForDelivery(ctx context.Context, sources []weightedSource, weights []int) error {
+	timer := time.NewTimer(pausedRecheckInterval)
+	defer timer.Stop()
+
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C)},
+	}
+	var indexes []int
+	for i := range sources {
+		if weights[i] > 0 {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sources[i].deliveries)})
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == len(sources) {
+		// Active queues only get here without messages, and a weight change between active queues
+		// matters from their next delivery on, so there is no need to re-read the weights
+		cases[1].Chan = reflect.ValueOf((<-chan time.Time)(nil))
+	}
+
+	chosen, value, ok := reflect.Select(cases)
+	switch chosen {
+	case 0:
+		return ctx.Err()
+	case 1:
+		return nil
+	}
+
+	source := &sources[indexes[chosen-2]]
+	if !ok {
+		return fmt.Errorf("delivery channel of queue %s closed", source.queue)
+	}
+	delivery := value.Interface().(amqp.Delivery)
+	source.head = &delivery
+	return nil
+}
@@ -0,0 +1,46 @@
+package startup
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	initialWaitBackoff = 500 * time.Millisecond
+	maxWaitBackoff     = 5 * time.Second
+)
+
+// WaitFor calls check with exponential backoff until it succeeds or the timeout elapses.
+// It is used at startup so the service tolerates dependencies that come up a few seconds later.
+func WaitFor(name string, timeout time.Duration, check func() error, logger *zap.SugaredLogger) error {
+	deadline := time.Now().Add(timeout)
+	backoff := initialWaitBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			if attempt > 1 {
+				logger.Infow("Dependency is reachable", "dependency", name, "attempts", attempt)
+			}
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%s not reachable after %v: %w", name, timeout, err)
+		}
+
+		logger.Warnw("Waiting for dependency", "dependency", name, "attempt", attempt, "retry_in", backoff, "error", err)
+		if backoff > remaining {
+			backoff = remaining
+		}
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > maxWaitBackoff {
+			backoff = maxWaitBackoff
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	_ "embed"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,14 +11,35 @@ import (
 
 	"github.com/graduate-work-mirea/data-processor-service/assembly"
 	"github.com/graduate-work-mirea/data-processor-service/config"
+	"github.com/graduate-work-mirea/data-processor-service/service"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
+// pythonRequirements is the Python package manifest the installed environment is verified against
+//
+//go:embed requirements.txt
+var pythonRequirements string
+
+// jobStopTimeout is how long cancelled background jobs get to record their outcome once their
+// Python processes are terminated
+const jobStopTimeout = 5 * time.Second
+
 // @title ML Prediction Service
 // @version 1.0
 // @description Predict product price and sales using LightGBM models
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			os.Exit(runBench(os.Args[2:]))
+		case "prestop":
+			os.Exit(runPreStop(os.Args[2:]))
+		case "encrypt-dataset":
+			os.Exit(runEncryptDataset(os.Args[2:]))
+		}
+	}
+
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 	sugar := logger.Sugar()
@@ -31,41 +53,98 @@ func main() {
 		sugar.Fatalf("Failed to load config: %v", err)
 	}
 
-	locator, err := assembly.NewServiceLocator(cfg, sugar)
+	locator, err := assembly.NewServiceLocator(cfg, pythonRequirements, sugar)
 	if err != nil {
 		sugar.Fatalf("Failed to initialize service locator: %v", err)
 	}
 	defer locator.Close()
 
-	// Create context for graceful shutdown
-	ctx, cancel := context.WithCancel(context.Background())
+	// Create context for graceful shutdown; it is cancelled with the background jobs at the end of
+	// the shutdown grace period
+	ctx, cancel := context.WithCancel(locator.Lifecycle.Context())
 	defer cancel()
 
-	// Check if models exist, if not, train them
+	// Pull the active model version from shared storage and keep following it
+	if locator.ModelSynchronizer != nil {
+		if err := locator.ModelSynchronizer.Sync(); err != nil {
+			sugar.Warnf("Failed to synchronize models: %v", err)
+		}
+		go locator.ModelSynchronizer.Start(ctx)
+	}
+
+	// Follow feature flag changes made on any replica
+	go locator.FeatureFlags.Start(ctx)
+	go locator.QueueWeights.Start(ctx)
+
+	// Watch the free disk space, the artifacts on disk and the work directories runs leave behind
+	go locator.DiskMonitor.Start(ctx)
+
+	// Store the API usage counted by this replica
+	if locator.ServesAPI() {
+		go locator.APIUsage.Start(ctx)
+	}
+
+	if locator.RunsWorkers() {
+		// Consume catalog updates from the configured ingestion paths
+		go locator.Ingestion.Run(ctx, locator.IngestionHandlers.Handle)
+
+		// Run the background jobs (retraining, forecast reconciliation, ...) on their cron schedules
+		go locator.Scheduler.Start(ctx)
+
+		// Run the training jobs queued with async=true on any replica
+		go locator.TrainingJobs.Run(ctx)
+	}
+
+	// Check if valid models exist, if not, train them. API replicas leave training to the workers
+	// and serve the models they publish once the model synchronizer pulls them
 	if !locator.MLPredictionService.CheckModelsExist() {
-		sugar.Info("Models not found, training new models...")
-		result, err := locator.MLPredictionService.TrainModels()
-		if err != nil {
-			sugar.Warnf("Failed to train models: %v", err)
+		problems := locator.MLPredictionService.CheckModels().Problems
+		if locator.RunsWorkers() {
+			sugar.Infow("Models not found or invalid, training new models...", "problems", problems)
+			result, err := locator.MLPredictionService.TrainModels(ctx)
+			if err != nil {
+				sugar.Warnf("Failed to train models: %v", err)
+			} else {
+				sugar.Infof("Models trained successfully: %v", result)
+			}
 		} else {
-			sugar.Infof("Models trained successfully: %v", result)
+			sugar.Warnw("Models not found or invalid, waiting for a worker to train them", "problems", problems)
 		}
+	} else {
+		// Check the installed models on this replica's numeric libraries
+		go locator.GoldenSet.VerifyLoaded(ctx)
 	}
 
 	// Start HTTP server
 	go func() {
-		sugar.Infof("Starting HTTP server on port %s", cfg.ServerPort)
+		sugar.Infof("Starting HTTP server on port %s in %s mode", cfg.ServerPort, cfg.RunMode)
 		if err := locator.HTTPServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			sugar.Fatalf("Failed to start HTTP server: %v", err)
 		}
 	}()
 
-	// Wait for termination signal
+	// Wait for termination signal; lame-duck signals only start draining
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigCh, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, lameDuckSignals...)...)
 
-	sig := <-sigCh
+	var sig os.Signal
+	for sig = range sigCh {
+		if sig == syscall.SIGINT || sig == syscall.SIGTERM {
+			break
+		}
+		locator.Lifecycle.EnterLameDuck()
+		sugar.Infow("Entered lame-duck mode", "source", "signal", "in_flight_jobs", locator.Lifecycle.State().InFlightJobs)
+		locator.AuditLog.Record(&service.AuditEntry{
+			Action:    service.AuditActionLameDuck,
+			Caller:    "signal",
+			Method:    "SIGNAL",
+			Path:      sig.String(),
+			Outcome:   service.AuditOutcomeSuccess,
+			CreatedAt: time.Now(),
+		})
+	}
 	sugar.Infof("Received signal: %v, shutting down...", sig)
+	locator.Lifecycle.EnterLameDuck()
 
 	// Create context with timeout for graceful shutdown
 	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 5*time.Second)
@@ -77,4 +156,25 @@ func main() {
 	} else {
 		sugar.Info("HTTP server shutdown gracefully")
 	}
+	if err := locator.APIUsage.Flush(); err != nil {
+		sugar.Errorf("Failed to store API usage: %v", err)
+	}
+
+	// Let running background jobs such as simulations finish. The drain timeout counts from the start
+	// of lame-duck mode, which a preStop hook may have entered well before the signal
+	drainCtx, drainCancel := context.WithDeadline(context.Background(), locator.Lifecycle.DrainDeadline(cfg.DrainTimeout))
+	defer drainCancel()
+	drainErr := locator.Lifecycle.Wait(drainCtx)
+
+	// Cancel the work left, so that no Python process outlives the service: they are sent SIGTERM
+	// and killed after PYTHON_TERMINATION_GRACE
+	locator.Lifecycle.Terminate()
+	if drainErr != nil {
+		sugar.Warnw("Background jobs still running at shutdown, cancelling them", "in_flight_jobs", locator.Lifecycle.State().InFlightJobs)
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), cfg.PythonTerminationGrace+jobStopTimeout)
+		defer stopCancel()
+		if err := locator.Lifecycle.Wait(stopCtx); err != nil {
+			sugar.Errorw("Background jobs did not stop", "in_flight_jobs", locator.Lifecycle.State().InFlightJobs)
+		}
+	}
 }
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// runPreStop implements "ml-service prestop", a preStop hook for images without an HTTP client: it
+// calls /internal/prestop of the local service, which returns once the replica has drained, and
+// prints the response. It returns the process exit code
+func runPreStop(args []string) int {
+	port := os.Getenv("SERVER_PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	flags := flag.NewFlagSet("prestop", flag.ContinueOnError)
+	url := flags.String("url", "http://localhost:"+port+"/internal/prestop", "preStop endpoint of the service")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	resp, err := http.Post(*url, "application/json", nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to call the preStop hook: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the preStop response: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(body))
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
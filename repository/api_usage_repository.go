@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIUsageBucket is the usage of a route by a client during an hour, or a day once rolled up
+type APIUsageBucket struct {
+	// Bucket is the start of the hour in UTC
+	Bucket       time.Time
+	Client       string
+	Method       string
+	Route        string
+	Requests     int64
+	ClientErrors int64
+	ServerErrors int64
+	// DurationMs is the total latency of the requests, MaxDurationMs the slowest
+	DurationMs    float64
+	MaxDurationMs float64
+	RequestBytes  int64
+	ResponseBytes int64
+}
+
+// APIUsageFilter narrows a usage report; empty fields match everything. From and To are days,
+// inclusive
+type APIUsageFilter struct {
+	From   time.Time
+	To     time.Time
+	Client string
+	Route  string
+}
+
+// APIUsageSummary is the usage of a client, or of a route by a client, over the days of a report
+type APIUsageSummary struct {
+	Client        string
+	Method        string
+	Route         string
+	Requests      int64
+	ClientErrors  int64
+	ServerErrors  int64
+	DurationMs    float64
+	MaxDurationMs float64
+	RequestBytes  int64
+	ResponseBytes int64
+}
+
+// UpsertAPIUsage adds hourly usage buckets to the api_usage table, summing with the buckets that
+// this or other replicas already stored for the same hour, client and route
+func (r *PostgresRepository) UpsertAPIUsage(buckets []APIUsageBucket) error {
+	err := r.retryPolicy.DoWrite(func() error {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		stmt, err := tx.Prepare(`
+			INSERT INTO api_usage (bucket, client, method, route, requests, client_errors, server_errors,
+				duration_ms, max_duration_ms, request_bytes, response_bytes)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (bucket, client, method, route) DO UPDATE SET
+				requests = api_usage.requests + EXCLUDED.requests,
+				client_errors = api_usage.client_errors + EXCLUDED.client_errors,
+				server_errors = api_usage.server_errors + EXCLUDED.server_errors,
+				duration_ms = api_usage.duration_ms + EXCLUDED.duration_ms,
+				max_duration_ms = GREATEST(api_usage.max_duration_ms, EXCLUDED.max_duration_ms),
+				request_bytes = api_usage.request_bytes + EXCLUDED.request_bytes,
+				response_bytes = api_usage.response_bytes + EXCLUDED.response_bytes
+		`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, b := range buckets {
+			_, err := stmt.Exec(b.Bucket, b.Client, b.Method, b.Route, b.Requests, b.ClientErrors, b.ServerErrors,
+				b.DurationMs, b.MaxDurationMs, b.RequestBytes, b.ResponseBytes)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store API usage: %w", err)
+	}
+	return nil
+}
+
+// RollupAPIUsage sums the hourly usage of every day before `before` into api_usage_daily, replacing
+// the rollups of days already rolled up, and deletes the hourly usage before `prune`. Days are in
+// UTC. It returns the number of daily rows written and of hourly rows deleted
+func (r *PostgresRepository) RollupAPIUsage(before, prune time.Time) (int64, int64, error) {
+	var rolledUp, pruned int64
+	err := r.retryPolicy.Do(func() error {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec(`
+			INSERT INTO api_usage_daily (day, client, method, route, requests, client_errors, server_errors,
+				duration_ms, max_duration_ms, request_bytes, response_bytes)
+			SELECT (bucket AT TIME ZONE 'UTC')::DATE, client, method, route, SUM(requests), SUM(client_errors),
+				SUM(server_errors), SUM(duration_ms), MAX(max_duration_ms), SUM(request_bytes), SUM(response_bytes)
+			FROM api_usage
+			WHERE bucket < $1
+			GROUP BY 1, client, method, route
+			ON CONFLICT (day, client, method, route) DO UPDATE SET
+				requests = EXCLUDED.requests,
+				client_errors = EXCLUDED.client_errors,
+				server_errors = EXCLUDED.server_errors,
+				duration_ms = EXCLUDED.duration_ms,
+				max_duration_ms = EXCLUDED.max_duration_ms,
+				request_bytes = EXCLUDED.request_bytes,
+				response_bytes = EXCLUDED.response_bytes
+		`, before)
+		if err != nil {
+			return err
+		}
+		if rolledUp, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		result, err = tx.Exec(`DELETE FROM api_usage WHERE bucket < $1`, prune)
+		if err != nil {
+			return err
+		}
+		if pruned, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to roll up API usage: %w", err)
+	}
+	return rolledUp, pruned, nil
+}
+
+// ListAPIUsage returns the usage matching the filter by client, or by client and route when
+// byRoute is set, the most requests first. Days already rolled up are read from api_usage_daily,
+// the others, such as today, from the hourly buckets
+func (r *PostgresRepository) ListAPIUsage(filter APIUsageFilter, byRoute bool, limit int) ([]APIUsageSummary, error) {
+	args := []any{filter.From, filter.To, filter.From, filter.To.AddDate(0, 0, 1)}
+	var conditions []string
+	if filter.Client != "" {
+		args = append(args, filter.Client)
+		conditions = append(conditions, fmt.Sprintf("client = $%d", len(args)))
+	}
+	if filter.Route != "" {
+		args = append(args, filter.Route)
+		conditions = append(conditions, fmt.Sprintf("route = $%d", len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	groups := "client"
+	if byRoute {
+		groups = "client, method, route"
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`
+		WITH usage AS (
+			SELECT client, method, route, requests, client_errors, server_errors, duration_ms, max_duration_ms,
+				request_bytes, response_bytes
+			FROM api_usage_daily
+			WHERE day >= $1::DATE AND day <= $2::DATE
+			UNION ALL
+			SELECT client, method, route, requests, client_errors, server_errors, duration_ms, max_duration_ms,
+				request_bytes, response_bytes
+			FROM api_usage h
+			WHERE bucket >= $3 AND bucket < $4
+				AND NOT EXISTS (
+					SELECT 1 FROM api_usage_daily d WHERE d.day = (h.bucket AT TIME ZONE 'UTC')::DATE
+				)
+		)
+		SELECT %s, SUM(requests), SUM(client_errors), SUM(server_errors), SUM(duration_ms), MAX(max_duration_ms),
+			SUM(request_bytes), SUM(response_bytes)
+		FROM usage
+		%s
+		GROUP BY %s
+		ORDER BY SUM(requests) DESC, %s
+		LIMIT $%d
+	`, groups, where, groups, groups, len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []APIUsageSummary
+	for rows.Next() {
+		var u APIUsageSummary
+		dest := []any{&u.Client}
+		if byRoute {
+			dest = append(dest, &u.Method, &u.Route)
+		}
+		dest = append(dest, &u.Requests, &u.ClientErrors, &u.ServerErrors, &u.DurationMs, &u.MaxDurationMs,
+			&u.RequestBytes, &u.ResponseBytes)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan API usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read API usage: %w", err)
+	}
+	return usage, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// artifactCipherMagic prefixes every encrypted artifact so that encrypted and plain files can be told apart
+var artifactCipherMagic = []byte("MLSENC1\x00")
+
+// artifactKeyIDSize is the length of the key fingerprint stored in the header of encrypted artifacts
+const artifactKeyIDSize = 8
+
+// ErrArtifactKeyMismatch is returned when an artifact was encrypted with a different key
+var ErrArtifactKeyMismatch = errors.New("artifact was encrypted with a different key")
+
+// ArtifactCipher encrypts artifacts at rest with AES-256-GCM.
+// An encrypted artifact is laid out as magic | key ID | nonce | ciphertext and tag. The label the
+// artifact is stored under is authenticated as additional data, so an encrypted file can't be
+// swapped for one stored under another label
+type ArtifactCipher struct {
+	aead  cipher.AEAD
+	keyID []byte
+}
+
+// NewArtifactCipher creates a cipher from a 32-byte AES-256 key
+func NewArtifactCipher(key []byte) (*ArtifactCipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("artifact encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact cipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact cipher: %v", err)
+	}
+
+	fingerprint := sha256.Sum256(key)
+	return &ArtifactCipher{
+		aead:  aead,
+		keyID: fingerprint[:artifactKeyIDSize],
+	}, nil
+}
+
+// IsEncryptedArtifact reports whether data is an artifact written by an ArtifactCipher
+func IsEncryptedArtifact(data []byte) bool {
+	return bytes.HasPrefix(data, artifactCipherMagic)
+}
+
+// Seal encrypts the contents of the artifact stored under label, which must name its location
+// completely: the version and file name of a model artifact, the key of a result file, the file
+// name of a dataset
+func (c *ArtifactCipher) Seal(label string, plaintext []byte) ([]byte, error) {
+	header := make([]byte, 0, len(artifactCipherMagic)+artifactKeyIDSize+c.aead.NonceSize())
+	header = append(header, artifactCipherMagic...)
+	header = append(header, c.keyID...)
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	header = append(header, nonce...)
+
+	return c.aead.Seal(header, nonce, plaintext, []byte(label)), nil
+}
+
+// Open decrypts the contents of the artifact stored under label, rejecting plain, tampered,
+// foreign-key data and data sealed under another label
+func (c *ArtifactCipher) Open(label string, data []byte) ([]byte, error) {
+	if !IsEncryptedArtifact(data) {
+		return nil, fmt.Errorf("artifact %s is not encrypted", label)
+	}
+	data = data[len(artifactCipherMagic):]
+
+	nonceSize := c.aead.NonceSize()
+	if len(data) < artifactKeyIDSize+nonceSize+c.aead.Overhead() {
+		return nil, fmt.Errorf("encrypted artifact %s is truncated", label)
+	}
+	if !bytes.Equal(data[:artifactKeyIDSize], c.keyID) {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactKeyMismatch, label)
+	}
+	data = data[artifactKeyIDSize:]
+
+	plaintext, err := c.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(label))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt artifact %s: %v", label, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ArtifactStore stores model artifacts in storage shared by all replicas
+type ArtifactStore interface {
+	// Upload copies the named files from srcDir into the store under the given version
+	Upload(version string, srcDir string, names []string) error
+	// Download copies the named files of the given version from the store into destDir
+	Download(version string, destDir string, names []string) error
+}
+
+// FileArtifactStore is an ArtifactStore backed by a directory on a shared volume.
+// With a cipher, artifacts are encrypted in the store and decrypted on download, bound to their
+// version and file name so that an artifact of another version fails to decrypt
+type FileArtifactStore struct {
+	basePath string
+	cipher   *ArtifactCipher
+}
+
+// NewFileArtifactStore creates a new FileArtifactStore instance; cipher may be nil to store artifacts as-is
+func NewFileArtifactStore(basePath string, cipher *ArtifactCipher) (*FileArtifactStore, error) {
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create artifact store directory: %v", err)
+	}
+
+	return &FileArtifactStore{
+		basePath: basePath,
+		cipher:   cipher,
+	}, nil
+}
+
+// Upload copies the named files from srcDir into the store under the given version
+func (s *FileArtifactStore) Upload(version string, srcDir string, names []string) error {
+	versionDir := filepath.Join(s.basePath, version)
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		return fmt.Errorf("failed to create version directory: %v", err)
+	}
+
+	for _, name := range names {
+		if err := s.upload(filepath.Join(srcDir, name), filepath.Join(versionDir, name), artifactLabel(version, name)); err != nil {
+			return fmt.Errorf("failed to upload artifact %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Download copies the named files of the given version from the store into destDir
+func (s *FileArtifactStore) Download(version string, destDir string, names []string) error {
+	versionDir := filepath.Join(s.basePath, version)
+	for _, name := range names {
+		if err := s.download(filepath.Join(versionDir, name), filepath.Join(destDir, name), artifactLabel(version, name)); err != nil {
+			return fmt.Errorf("failed to download artifact %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// artifactLabel is the label an artifact is encrypted under
+func artifactLabel(version, name string) string {
+	return version + "/" + name
+}
+
+// upload copies a single artifact into the store, encrypting it under label when a cipher is
+// configured
+func (s *FileArtifactStore) upload(src, dst, label string) error {
+	if s.cipher == nil {
+		return copyFile(src, dst)
+	}
+
+	plaintext, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	sealed, err := s.cipher.Seal(label, plaintext)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, sealed)
+}
+
+// download copies a single artifact out of the store, decrypting it from label when a cipher is
+// configured
+func (s *FileArtifactStore) download(src, dst, label string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	if s.cipher != nil {
+		if data, err = s.cipher.Open(label, data); err != nil {
+			return err
+		}
+	} else if IsEncryptedArtifact(data) {
+		return fmt.Errorf("artifact is encrypted but no encryption key is configured")
+	}
+	return writeFileAtomic(dst, data)
+}
+
+// writeFileAtomic writes data to dst through a temporary file so readers never see a partial write
+func writeFileAtomic(dst string, data []byte) error {
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// copyFile copies src to dst, writing through a temporary file so readers never see a partial copy
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, dst)
+}
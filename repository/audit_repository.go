@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEntry is a recorded call to an administrative operation
+type AuditEntry struct {
+	ID         int64
+	Action     string
+	Caller     string
+	RemoteAddr string
+	Method     string
+	Path       string
+	Params     []byte
+	StatusCode int
+	Outcome    string
+	Error      string
+	CreatedAt  time.Time
+	DurationMs int64
+}
+
+// AuditEntryFilter narrows an audit log listing; empty fields match everything
+type AuditEntryFilter struct {
+	Action  string
+	Caller  string
+	Outcome string
+	From    time.Time
+	To      time.Time
+}
+
+// where builds the WHERE clause and arguments of the filter
+func (f AuditEntryFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.Caller != "" {
+		add("caller = $%d", f.Caller)
+	}
+	if f.Outcome != "" {
+		add("outcome = $%d", f.Outcome)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// InsertAuditEntry appends an entry to the audit log
+func (r *PostgresRepository) InsertAuditEntry(entry *AuditEntry) error {
+	err := r.retryPolicy.DoWrite(func() error {
+		_, err := r.db.Exec(`
+			INSERT INTO audit_log (action, caller, remote_addr, method, path, params, status_code, outcome, error, created_at, duration_ms)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		`, entry.Action, entry.Caller, entry.RemoteAddr, entry.Method, entry.Path, nullableJSON(entry.Params),
+			entry.StatusCode, entry.Outcome, entry.Error, entry.CreatedAt, entry.DurationMs)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries returns a page of audit entries matching the filter, newest first,
+// and the total number of matching entries
+func (r *PostgresRepository) ListAuditEntries(filter AuditEntryFilter, limit, offset int) ([]AuditEntry, int, error) {
+	where, args := filter.where()
+
+	var total int
+	if err := r.queryRow(`SELECT COUNT(*) FROM audit_log `+where, args, &total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, action, caller, remote_addr, method, path, params, status_code, outcome, error, created_at, duration_ms
+		FROM audit_log
+		%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+
+	rows, err := r.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var params, errMsg sql.NullString
+		if err := rows.Scan(&e.ID, &e.Action, &e.Caller, &e.RemoteAddr, &e.Method, &e.Path, &params,
+			&e.StatusCode, &e.Outcome, &errMsg, &e.CreatedAt, &e.DurationMs); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		if params.Valid {
+			e.Params = []byte(params.String)
+		}
+		e.Error = errMsg.String
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read audit entries: %w", err)
+	}
+
+	return entries, total, nil
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// BacktestCase is a product, region and seller observed on a backtest origin, with the features
+// of that day and the actuals of the horizon after it
+type BacktestCase struct {
+	ProductName    string
+	Region         string
+	Seller         string
+	Price          sql.NullFloat64
+	OriginalPrice  sql.NullFloat64
+	StockLevel     sql.NullFloat64
+	CustomerRating sql.NullFloat64
+	ReviewCount    sql.NullFloat64
+	DeliveryDays   sql.NullFloat64
+	// ActualPrice is the price on the last day of the horizon, ActualSales the sales summed over it
+	ActualPrice sql.NullFloat64
+	ActualSales float64
+}
+
+// BacktestRun is a recorded backtest with its summary metrics as JSON objects by metric name
+type BacktestRun struct {
+	ID           int64
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	ModelVersion string
+	Origins      int
+	Cases        int
+	HorizonDays  int
+	PriceMetrics []byte
+	SalesMetrics []byte
+	// BaselineMetrics holds the price and sales metrics of every naive baseline
+	BaselineMetrics []byte
+	// AlertMetric is the sales metric compared with the average of the previous runs, AlertBaseline
+	// that average; it is invalid when no earlier run had the metric
+	AlertMetric   string
+	AlertValue    sql.NullFloat64
+	AlertBaseline sql.NullFloat64
+	Degraded      bool
+}
+
+// LatestProcessedDate returns the latest date in processed_data; it is invalid when the table is empty
+func (r *PostgresRepository) LatestProcessedDate() (sql.NullTime, error) {
+	var date sql.NullTime
+	if err := r.queryRow(`SELECT MAX(date) FROM processed_data`, nil, &date); err != nil {
+		return date, fmt.Errorf("failed to get latest processed date: %w", err)
+	}
+	return date, nil
+}
+
+// ListBacktestCases returns up to limit keys with a processed_data row on origin and sales recorded
+// in the horizonDays days after it. Keys are sampled in a stable pseudo-random order, so that
+// successive runs evaluate the same products
+func (r *PostgresRepository) ListBacktestCases(origin time.Time, horizonDays, limit int) ([]BacktestCase, error) {
+	query := `
+		SELECT o.product_name, o.region, o.seller,
+			o.price, o.original_price, o.stock_level, o.customer_rating, o.review_count, o.delivery_days,
+			(SELECT p.price FROM processed_data p
+				WHERE p.product_name = o.product_name AND p.region = o.region AND p.seller = o.seller
+					AND p.date = o.date + $2::INTEGER
+				LIMIT 1),
+			s.sales
+		FROM processed_data o
+		CROSS JOIN LATERAL (
+			SELECT SUM(p.sales_quantity) AS sales FROM processed_data p
+			WHERE p.product_name = o.product_name AND p.region = o.region AND p.seller = o.seller
+				AND p.date > o.date AND p.date <= o.date + $2::INTEGER
+		) s
+		WHERE o.date = $1 AND s.sales IS NOT NULL
+		ORDER BY md5(o.product_name || '|' || o.region || '|' || o.seller)
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(query, origin.Format("2006-01-02"), horizonDays, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backtest cases: %w", err)
+	}
+	defer rows.Close()
+
+	var cases []BacktestCase
+	for rows.Next() {
+		var c BacktestCase
+		if err := rows.Scan(&c.ProductName, &c.Region, &c.Seller, &c.Price, &c.OriginalPrice, &c.StockLevel,
+			&c.CustomerRating, &c.ReviewCount, &c.DeliveryDays, &c.ActualPrice, &c.ActualSales); err != nil {
+			return nil, fmt.Errorf("failed to scan backtest case: %w", err)
+		}
+		cases = append(cases, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read backtest cases: %w", err)
+	}
+	return cases, nil
+}
+
+// SaveBacktestRun records a finished backtest and returns its ID
+func (r *PostgresRepository) SaveBacktestRun(run *BacktestRun) (int64, error) {
+	query := `
+		INSERT INTO backtest_runs (
+			started_at, finished_at, model_version, origins, cases, horizon_days,
+			price_metrics, sales_metrics, baseline_metrics, alert_metric, alert_value, alert_baseline, degraded
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id
+	`
+
+	var id int64
+	err := r.writeRow(query, []any{
+		run.StartedAt, run.FinishedAt, run.ModelVersion, run.Origins, run.Cases, run.HorizonDays,
+		nullableJSON(run.PriceMetrics), nullableJSON(run.SalesMetrics), nullableJSON(run.BaselineMetrics), run.AlertMetric, run.AlertValue,
+		run.AlertBaseline, run.Degraded,
+	}, &id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save backtest run: %w", err)
+	}
+	return id, nil
+}
+
+// ListBacktestRuns returns the latest limit backtest runs, newest first
+func (r *PostgresRepository) ListBacktestRuns(limit int) ([]BacktestRun, error) {
+	rows, err := r.db.Query(`
+		SELECT id, started_at, finished_at, model_version, origins, cases, horizon_days,
+			price_metrics, sales_metrics, baseline_metrics, alert_metric, alert_value, alert_baseline, degraded
+		FROM backtest_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backtest runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []BacktestRun
+	for rows.Next() {
+		var run BacktestRun
+		var priceMetrics, salesMetrics, baselineMetrics sql.NullString
+		if err := rows.Scan(&run.ID, &run.StartedAt, &run.FinishedAt, &run.ModelVersion, &run.Origins, &run.Cases,
+			&run.HorizonDays, &priceMetrics, &salesMetrics, &baselineMetrics, &run.AlertMetric, &run.AlertValue, &run.AlertBaseline,
+			&run.Degraded); err != nil {
+			return nil, fmt.Errorf("failed to scan backtest run: %w", err)
+		}
+		if priceMetrics.Valid {
+			run.PriceMetrics = []byte(priceMetrics.String)
+		}
+		if salesMetrics.Valid {
+			run.SalesMetrics = []byte(salesMetrics.String)
+		}
+		if baselineMetrics.Valid {
+			run.BaselineMetrics = []byte(baselineMetrics.String)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read backtest runs: %w", err)
+	}
+	return runs, nil
+}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// BatchPrediction represents a stored asynchronous batch prediction job
+type BatchPrediction struct {
+	ID               int64
+	Status           string
+	ItemCount        int
+	CallbackURL      string
+	Succeeded        int
+	Failed           int
+	Error            string
+	CallbackStatus   string
+	CallbackAttempts int
+	CallbackError    string
+	ResultsKey       string
+	CreatedAt        time.Time
+	CompletedAt      *time.Time
+}
+
+// CreateBatchPrediction stores a new batch prediction in pending state and returns its ID
+func (r *PostgresRepository) CreateBatchPrediction(itemCount int, callbackURL string) (int64, error) {
+	var id int64
+	err := r.writeRow(`
+		INSERT INTO batch_predictions (status, item_count, callback_url, callback_status)
+		VALUES ('pending', $1, $2, 'pending')
+		RETURNING id
+	`, []any{itemCount, callbackURL}, &id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create batch prediction: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateBatchPredictionStatus sets the status of a batch prediction, completing it for terminal states
+func (r *PostgresRepository) UpdateBatchPredictionStatus(id int64, status string, errMsg string) error {
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`
+			UPDATE batch_predictions
+			SET status = $2, error = $3,
+				completed_at = CASE WHEN $2 IN ('completed', 'failed') THEN NOW() ELSE completed_at END
+			WHERE id = $1
+		`, id, status, errMsg)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update batch prediction status: %w", err)
+	}
+	return nil
+}
+
+// SaveBatchPredictionResults stores the result items of a batch prediction and their counts
+func (r *PostgresRepository) SaveBatchPredictionResults(id int64, results []byte, succeeded, failed int) error {
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`
+			UPDATE batch_predictions SET results = $2, succeeded = $3, failed = $4
+			WHERE id = $1
+		`, id, results, succeeded, failed)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save batch prediction results: %w", err)
+	}
+	return nil
+}
+
+// SetBatchResultsKey records the result store key of a batch prediction's results file
+func (r *PostgresRepository) SetBatchResultsKey(id int64, key string) error {
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`UPDATE batch_predictions SET results_key = $2 WHERE id = $1`, id, key)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set batch results key: %w", err)
+	}
+	return nil
+}
+
+// UpdateBatchCallback records the delivery state of a batch prediction's callback
+func (r *PostgresRepository) UpdateBatchCallback(id int64, status string, attempts int, errMsg string) error {
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`
+			UPDATE batch_predictions SET callback_status = $2, callback_attempts = $3, callback_error = $4
+			WHERE id = $1
+		`, id, status, attempts, errMsg)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update batch callback: %w", err)
+	}
+	return nil
+}
+
+// GetBatchPrediction returns a batch prediction without its results, or nil if it does not exist
+func (r *PostgresRepository) GetBatchPrediction(id int64) (*BatchPrediction, error) {
+	var batch BatchPrediction
+	var errMsg, callbackError, resultsKey sql.NullString
+	var completedAt sql.NullTime
+	err := r.queryRow(`
+		SELECT id, status, item_count, callback_url, succeeded, failed, error,
+			callback_status, callback_attempts, callback_error, results_key, created_at, completed_at
+		FROM batch_predictions
+		WHERE id = $1
+	`, []any{id}, &batch.ID, &batch.Status, &batch.ItemCount, &batch.CallbackURL, &batch.Succeeded, &batch.Failed,
+		&errMsg, &batch.CallbackStatus, &batch.CallbackAttempts, &callbackError, &resultsKey, &batch.CreatedAt, &completedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get batch prediction: %w", err)
+	}
+
+	batch.Error = errMsg.String
+	batch.CallbackError = callbackError.String
+	batch.ResultsKey = resultsKey.String
+	if completedAt.Valid {
+		batch.CompletedAt = &completedAt.Time
+	}
+	return &batch, nil
+}
+
+// GetBatchPredictionResults returns the stored result items of a batch prediction, nil if there are none
+func (r *PostgresRepository) GetBatchPredictionResults(id int64) ([]byte, error) {
+	var results sql.NullString
+	if err := r.queryRow(`SELECT results FROM batch_predictions WHERE id = $1`, []any{id}, &results); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get batch prediction results: %w", err)
+	}
+	if !results.Valid {
+		return nil, nil
+	}
+	return []byte(results.String), nil
+}
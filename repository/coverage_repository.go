@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DataCoverage is how completely the daily history of a product, region and seller is filled
+type DataCoverage struct {
+	ProductName  string
+	Region       string
+	Seller       string
+	FirstDate    time.Time
+	LastDate     time.Time
+	Observations int64
+	// MissingDays are the days between the first and last date without a row
+	MissingDays int64
+	// GapPercentage is MissingDays as a percentage of the days between the first and last date
+	GapPercentage float64
+}
+
+// DataCoverageFilter narrows the coverage report; empty fields match everything
+type DataCoverageFilter struct {
+	ProductName string
+	Region      string
+	Seller      string
+}
+
+// where builds the WHERE clause and arguments of the filter
+func (f DataCoverageFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.ProductName != "" {
+		add("product_name = $%d", f.ProductName)
+	}
+	if f.Region != "" {
+		add("region = $%d", f.Region)
+	}
+	if f.Seller != "" {
+		add("seller = $%d", f.Seller)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ListDataCoverage returns a page of the coverage of every product, region and seller in
+// processed_data matching the filter, the least complete first, and the total number of matching
+// keys
+func (r *PostgresRepository) ListDataCoverage(filter DataCoverageFilter, limit, offset int) ([]DataCoverage, int, error) {
+	where, args := filter.where()
+
+	var total int
+	err := r.queryRow(`
+		SELECT COUNT(*) FROM (
+			SELECT 1 FROM processed_data `+where+` GROUP BY product_name, region, seller
+		) k
+	`, args, &total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count data coverage: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT product_name, region, seller, first_date, last_date, observations,
+			span - days AS missing_days,
+			100.0 * (span - days) / span AS gap_percentage
+		FROM (
+			SELECT product_name, region, seller,
+				MIN(date) AS first_date, MAX(date) AS last_date, COUNT(*) AS observations,
+				COUNT(DISTINCT date) AS days, MAX(date) - MIN(date) + 1 AS span
+			FROM processed_data
+			%s
+			GROUP BY product_name, region, seller
+		) c
+		ORDER BY gap_percentage DESC, product_name, region, seller
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+
+	rows, err := r.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list data coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var coverage []DataCoverage
+	for rows.Next() {
+		var c DataCoverage
+		if err := rows.Scan(&c.ProductName, &c.Region, &c.Seller, &c.FirstDate, &c.LastDate, &c.Observations,
+			&c.MissingDays, &c.GapPercentage); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan data coverage: %w", err)
+		}
+		coverage = append(coverage, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read data coverage: %w", err)
+	}
+	return coverage, total, nil
+}
+
+// HistoryRange is the first and last date of the history of a product, region and seller; both are
+// invalid without history
+type HistoryRange struct {
+	FirstDate sql.NullTime
+	LastDate  sql.NullTime
+}
+
+// GetHistoryRange returns the dates of the first and last processed_data rows of a key
+func (r *PostgresRepository) GetHistoryRange(productName, region, seller string) (*HistoryRange, error) {
+	var history HistoryRange
+	err := r.queryRow(`
+		SELECT MIN(date), MAX(date)
+		FROM processed_data
+		WHERE product_name = $1 AND region = $2 AND seller = $3
+	`, []any{productName, region, seller}, &history.FirstDate, &history.LastDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history range: %w", err)
+	}
+	return &history, nil
+}
+
+// WindowCoverage is how many days of a date window a product, region and seller has history for
+type WindowCoverage struct {
+	ProductName  string
+	Region       string
+	Seller       string
+	Observations int64
+	// Days counts the distinct dates of the observations
+	Days int64
+	// LastDate is the latest date with history, not limited to the window; invalid without history
+	LastDate sql.NullTime
+}
+
+// GetWindowCoverage returns the coverage of [from, to] for each key given as the same index of
+// products, regions and sellers. Keys without history in the window have no observations
+func (r *PostgresRepository) GetWindowCoverage(products, regions, sellers []string, from, to time.Time) ([]WindowCoverage, error) {
+	query := `
+		SELECT k.product_name, k.region, k.seller,
+			COUNT(p.date), COUNT(DISTINCT p.date),
+			(SELECT MAX(l.date) FROM processed_data l
+				WHERE l.product_name = k.product_name AND l.region = k.region AND l.seller = k.seller)
+		FROM unnest($1::TEXT[], $2::TEXT[], $3::TEXT[]) AS k (product_name, region, seller)
+		LEFT JOIN processed_data p
+			ON p.product_name = k.product_name AND p.region = k.region AND p.seller = k.seller
+				AND p.date BETWEEN $4 AND $5
+		GROUP BY k.product_name, k.region, k.seller
+	`
+
+	rows, err := r.db.Query(query, pq.Array(products), pq.Array(regions), pq.Array(sellers),
+		from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get window coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var coverage []WindowCoverage
+	for rows.Next() {
+		var c WindowCoverage
+		if err := rows.Scan(&c.ProductName, &c.Region, &c.Seller, &c.Observations, &c.Days, &c.LastDate); err != nil {
+			return nil, fmt.Errorf("failed to scan window coverage: %w", err)
+		}
+		coverage = append(coverage, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read window coverage: %w", err)
+	}
+	return coverage, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package repository
+
+import "errors"
+
+// volumeSpace is not available without statfs
+func volumeSpace(path string) (device, total, free uint64, err error) {
+	return 0, 0, 0, errors.New("volume space is not available on this platform")
+}
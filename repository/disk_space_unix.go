@@ -0,0 +1,22 @@
+//go:build linux || darwin
+
+package repository
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// volumeSpace returns the device, the size and the space available to the service of the volume
+// holding path
+func volumeSpace(path string) (device, total, free uint64, err error) {
+	var info syscall.Stat_t
+	if err := syscall.Stat(path, &info); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to stat %s: %v", path, err)
+	}
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to stat the volume of %s: %v", path, err)
+	}
+	return uint64(info.Dev), stat.Blocks * uint64(stat.Bsize), stat.Bavail * uint64(stat.Bsize), nil
+}
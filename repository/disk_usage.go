@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// VolumeSpace is the size of the volume holding a directory and the space left on it
+type VolumeSpace struct {
+	Path string
+	// Device identifies the volume, directories on the same volume share their free space
+	Device     uint64
+	TotalBytes uint64
+	FreeBytes  uint64
+}
+
+// WorkDir is a run or staging directory left on disk
+type WorkDir struct {
+	Path       string
+	Bytes      int64
+	ModifiedAt time.Time
+}
+
+// TempPath returns the directory run directories are created in
+func (r *FileRepository) TempPath() string {
+	return os.TempDir()
+}
+
+// Volume returns the space of the volume holding dir
+func (r *FileRepository) Volume(dir string) (VolumeSpace, error) {
+	device, total, free, err := volumeSpace(dir)
+	if err != nil {
+		return VolumeSpace{}, err
+	}
+	return VolumeSpace{Path: dir, Device: device, TotalBytes: total, FreeBytes: free}, nil
+}
+
+// ModelDirUsage returns the number and total size of the files installed in the model directory,
+// leaving out staging directories
+func (r *FileRepository) ModelDirUsage() (int, int64, error) {
+	entries, err := os.ReadDir(r.modelPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list model directory: %v", err)
+	}
+	files, size := 0, int64(0)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files++
+		size += info.Size()
+	}
+	return files, size, nil
+}
+
+// DirSize returns the number of subdirectories directly under dir, such as the versions of an
+// artifact store, and the total size of the files below it
+func DirSize(dir string) (int, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list %s: %v", dir, err)
+	}
+	dirs := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs++
+		}
+	}
+	size, err := treeSize(dir)
+	return dirs, size, err
+}
+
+// StaleWorkDirs returns the run directories in the temp directory and the staging directories in
+// the model directory that were not modified for olderThan. Both are removed by the run that
+// created them, so old ones were left behind by a crash or a kill
+func (r *FileRepository) StaleWorkDirs(olderThan time.Duration) ([]WorkDir, error) {
+	runDirs, err := filepath.Glob(filepath.Join(os.TempDir(), runDirPrefix+"*"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list run directories: %v", err)
+	}
+	stagingDirs, err := filepath.Glob(filepath.Join(r.modelPath, stagingDirPrefix+"*"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list model staging directories: %v", err)
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	var stale []WorkDir
+	for _, dir := range append(runDirs, stagingDirs...) {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		size, _ := treeSize(dir)
+		stale = append(stale, WorkDir{Path: dir, Bytes: size, ModifiedAt: info.ModTime()})
+	}
+	return stale, nil
+}
+
+// IsStagingDir reports whether a work directory is a model staging directory rather than a run
+// directory
+func IsStagingDir(dir string) bool {
+	return strings.HasPrefix(filepath.Base(dir), stagingDirPrefix)
+}
+
+// treeSize returns the total size of the regular files below dir; files removed while it is
+// walked are skipped
+func treeSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return size, fmt.Errorf("failed to measure %s: %v", dir, err)
+	}
+	return size, nil
+}
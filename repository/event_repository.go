@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Event is a recorded model lifecycle event
+type Event struct {
+	ID           int64
+	Type         string
+	ModelVersion string
+	Details      []byte
+	CreatedAt    time.Time
+}
+
+// EventFilter narrows an event listing; empty fields match everything
+type EventFilter struct {
+	Type         string
+	ModelVersion string
+	From         time.Time
+	To           time.Time
+}
+
+// where builds the WHERE clause and arguments of the filter
+func (f EventFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Type != "" {
+		add("type = $%d", f.Type)
+	}
+	if f.ModelVersion != "" {
+		add("model_version = $%d", f.ModelVersion)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// InsertEvent appends an event to the event log. Events are never updated or deleted
+func (r *PostgresRepository) InsertEvent(event *Event) error {
+	err := r.retryPolicy.DoWrite(func() error {
+		_, err := r.db.Exec(`
+			INSERT INTO events (type, model_version, details, created_at)
+			VALUES ($1, $2, $3, $4)
+		`, event.Type, event.ModelVersion, nullableJSON(event.Details), event.CreatedAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert event: %w", err)
+	}
+	return nil
+}
+
+// ListEvents returns a page of events matching the filter, newest first, and the total number of
+// matching events
+func (r *PostgresRepository) ListEvents(filter EventFilter, limit, offset int) ([]Event, int, error) {
+	where, args := filter.where()
+
+	var total int
+	if err := r.queryRow(`SELECT COUNT(*) FROM events `+where, args, &total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count events: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, type, model_version, details, created_at
+		FROM events
+		%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+
+	rows, err := r.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		var details sql.NullString
+		if err := rows.Scan(&e.ID, &e.Type, &e.ModelVersion, &details, &e.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan event: %w", err)
+		}
+		if details.Valid {
+			e.Details = []byte(details.String)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	return events, total, nil
+}
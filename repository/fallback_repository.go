@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// LastObservation is the latest processed_data row of a product, region and seller
+type LastObservation struct {
+	Date  time.Time
+	Price float64
+	Sales float64
+}
+
+// CategoryBaseline is the average price and daily sales of a category in a region over a window
+// of processed data
+type CategoryBaseline struct {
+	AvgPrice  float64
+	AvgSales  float64
+	Rows      int64
+	WindowEnd time.Time
+}
+
+// GetLastObservation returns the latest row of a product, region and seller on or before a date,
+// or nil if it has none
+func (r *PostgresRepository) GetLastObservation(productName, region, seller string, date time.Time) (*LastObservation, error) {
+	var o LastObservation
+	err := r.queryRow(`
+		SELECT date, COALESCE(price, 0), COALESCE(sales_quantity, 0)
+		FROM processed_data
+		WHERE product_name = $1 AND region = $2 AND seller = $3 AND date <= $4
+		ORDER BY date DESC
+		LIMIT 1
+	`, []any{productName, region, seller, date.Format("2006-01-02")}, &o.Date, &o.Price, &o.Sales)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get last observation: %w", err)
+	}
+	return &o, nil
+}
+
+// GetCategoryBaseline returns the averages of a category in a region over the windowDays days
+// ending on its latest date on or before the given date, or nil if it has no rows there
+func (r *PostgresRepository) GetCategoryBaseline(category, region string, date time.Time, windowDays int) (*CategoryBaseline, error) {
+	var b CategoryBaseline
+	var windowEnd sql.NullTime
+	err := r.queryRow(`
+		WITH latest AS (
+			SELECT MAX(date) AS day FROM processed_data
+			WHERE category = $1 AND region = $2 AND date <= $3
+		)
+		SELECT COALESCE(AVG(p.price), 0), COALESCE(AVG(p.sales_quantity), 0), COUNT(p.date), MAX(latest.day)
+		FROM latest
+		LEFT JOIN processed_data p ON p.category = $1 AND p.region = $2
+			AND p.date > latest.day - $4::INTEGER AND p.date <= latest.day
+	`, []any{category, region, date.Format("2006-01-02"), windowDays}, &b.AvgPrice, &b.AvgSales, &b.Rows, &windowEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category baseline: %w", err)
+	}
+	if b.Rows == 0 || !windowEnd.Valid {
+		return nil, nil
+	}
+	b.WindowEnd = windowEnd.Time
+	return &b, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// FeatureFlag is a feature flag setting stored in the database, overriding the configured default
+type FeatureFlag struct {
+	Name       string
+	Enabled    bool
+	Percentage int
+	Clients    []string
+	UpdatedBy  string
+	UpdatedAt  time.Time
+}
+
+// ListFeatureFlags returns the stored feature flag settings
+func (r *PostgresRepository) ListFeatureFlags() ([]FeatureFlag, error) {
+	rows, err := r.db.Query(`
+		SELECT name, enabled, percentage, clients, updated_by, updated_at
+		FROM feature_flags
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	var flags []FeatureFlag
+	for rows.Next() {
+		var f FeatureFlag
+		if err := rows.Scan(&f.Name, &f.Enabled, &f.Percentage, pq.Array(&f.Clients), &f.UpdatedBy, &f.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag: %w", err)
+		}
+		flags = append(flags, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read feature flags: %w", err)
+	}
+
+	return flags, nil
+}
+
+// SaveFeatureFlag stores a feature flag setting, replacing the previous one
+func (r *PostgresRepository) SaveFeatureFlag(f *FeatureFlag) error {
+	clients := f.Clients
+	if clients == nil {
+		clients = []string{}
+	}
+
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`
+			INSERT INTO feature_flags (name, enabled, percentage, clients, updated_by, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (name) DO UPDATE SET
+				enabled = EXCLUDED.enabled,
+				percentage = EXCLUDED.percentage,
+				clients = EXCLUDED.clients,
+				updated_by = EXCLUDED.updated_by,
+				updated_at = EXCLUDED.updated_at
+		`, f.Name, f.Enabled, f.Percentage, pq.Array(clients), f.UpdatedBy, f.UpdatedAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save feature flag: %w", err)
+	}
+	return nil
+}
+
+// DeleteFeatureFlag removes the stored setting of a feature flag and reports whether there was one
+func (r *PostgresRepository) DeleteFeatureFlag(name string) (bool, error) {
+	var deleted bool
+	err := r.retryPolicy.Do(func() error {
+		result, err := r.db.Exec(`DELETE FROM feature_flags WHERE name = $1`, name)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		deleted = n > 0
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete feature flag: %w", err)
+	}
+	return deleted, nil
+}
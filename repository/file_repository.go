@@ -1,21 +1,54 @@
 package repository
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/chaos"
+	"go.uber.org/zap"
 )
 
+// modelVersionFile records which registry version the local model directory holds
+const modelVersionFile = "VERSION"
+
 // FileRepository handles file operations
 type FileRepository struct {
 	baseDataPath string
 	modelPath    string
+	// terminationGrace is how long a Python script gets to exit after SIGTERM before it is killed
+	terminationGrace time.Duration
+	// datasetCipher decrypts the training datasets, which must be encrypted when it is set
+	datasetCipher *ArtifactCipher
+	logger        *zap.SugaredLogger
+
+	// versionMu guards the installed model version, which is read from the VERSION file once and
+	// then kept in memory, since every prediction records it
+	versionMu     sync.Mutex
+	version       string
+	versionLoaded bool
 }
 
-// NewFileRepository creates a new FileRepository instance
-func NewFileRepository(baseDataPath string, modelPath string) *FileRepository {
+// NewFileRepository creates a new FileRepository instance. Its paths are made absolute, since
+// Python scripts run in a directory of their own. Training datasets are decrypted with
+// datasetCipher unless it is nil. The logger receives the stderr of the scripts
+func NewFileRepository(baseDataPath string, modelPath string, terminationGrace time.Duration, datasetCipher *ArtifactCipher, logger *zap.SugaredLogger) *FileRepository {
+	var err error
+	if baseDataPath, err = filepath.Abs(baseDataPath); err != nil {
+		panic(fmt.Sprintf("Failed to resolve data directory: %v", err))
+	}
+	if modelPath, err = filepath.Abs(modelPath); err != nil {
+		panic(fmt.Sprintf("Failed to resolve model directory: %v", err))
+	}
+
 	// Create base directories if they don't exist
 	if err := os.MkdirAll(baseDataPath, 0755); err != nil {
 		panic(fmt.Sprintf("Failed to create data directory: %v", err))
@@ -26,8 +59,11 @@ func NewFileRepository(baseDataPath string, modelPath string) *FileRepository {
 	}
 
 	return &FileRepository{
-		baseDataPath: baseDataPath,
-		modelPath:    modelPath,
+		baseDataPath:     baseDataPath,
+		modelPath:        modelPath,
+		terminationGrace: terminationGrace,
+		datasetCipher:    datasetCipher,
+		logger:           logger,
 	}
 }
 
@@ -41,56 +77,156 @@ func (r *FileRepository) GetModelPath() string {
 	return r.modelPath
 }
 
+// ReadModelVersion returns the model version installed in the model directory, or "" if unknown
+func (r *FileRepository) ReadModelVersion() string {
+	r.versionMu.Lock()
+	defer r.versionMu.Unlock()
+
+	if !r.versionLoaded {
+		if data, err := os.ReadFile(filepath.Join(r.modelPath, modelVersionFile)); err == nil {
+			r.version = strings.TrimSpace(string(data))
+		}
+		r.versionLoaded = true
+	}
+	return r.version
+}
+
+// WriteModelVersion records the model version installed in the model directory
+func (r *FileRepository) WriteModelVersion(version string) error {
+	r.versionMu.Lock()
+	defer r.versionMu.Unlock()
+
+	if err := os.WriteFile(filepath.Join(r.modelPath, modelVersionFile), []byte(version+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write model version: %v", err)
+	}
+	r.version = version
+	r.versionLoaded = true
+	return nil
+}
+
+// HashFiles returns the SHA-256 digest of the concatenated contents of the given files
+func (r *FileRepository) HashFiles(paths ...string) (string, error) {
+	hash := sha256.New()
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to open file for hashing: %v", err)
+		}
+		_, err = io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to hash file: %v", err)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 // FileExists checks if a file exists at the given path
 func (r *FileRepository) FileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
 }
 
-// RunPythonScript executes a Python script with the given arguments
-func (r *FileRepository) RunPythonScript(scriptPath string, args ...string) (string, error) {
-	cmd := exec.Command("python", append([]string{scriptPath}, args...)...)
+// RunPythonScript executes a Python script with the given arguments.
+// The process is terminated if the context is cancelled before it completes, and killed if it
+// is still running after the termination grace period.
+func (r *FileRepository) RunPythonScript(ctx context.Context, scriptPath string, args ...string) (string, error) {
+	output, _, err := r.RunPythonScriptWithUsage(ctx, scriptPath, args...)
+	return output, err
+}
+
+// RunPythonScriptWithUsage executes a Python script like RunPythonScript and also reports
+// the wall time, CPU time and peak memory of the process. The script runs in a run directory of its
+// own, removed when it exits, so paths passed to it must be absolute.
+//
+// The returned output is the script's stdout. Its stderr is forwarded line by line to the logger
+// while the script runs, at the level given by the line's prefix, and is only included in the
+// error when the script fails
+func (r *FileRepository) RunPythonScriptWithUsage(ctx context.Context, scriptPath string, args ...string) (string, *ResourceUsage, error) {
+	usage := &ResourceUsage{}
+	started := time.Now()
+
+	scriptPath, err := filepath.Abs(scriptPath)
+	if err != nil {
+		return "", usage, fmt.Errorf("failed to resolve Python script path: %v", err)
+	}
+	workDir, err := r.CreateRunDir()
+	if err != nil {
+		return "", usage, err
+	}
+	defer r.RemoveRunDir(workDir)
+
+	// Chaos builds may delay the script or crash it, by killing the process right after it starts
+	crash := chaos.Inject(ctx, chaos.TargetPython) != nil
+
+	cmd := exec.CommandContext(ctx, "python", append([]string{scriptPath}, args...)...)
+	cmd.Dir = workDir
+	cmd.Cancel = func() error {
+		return terminateProcess(cmd.Process)
+	}
+	cmd.WaitDelay = r.terminationGrace
 
 	// Create pipes for both stdout and stderr
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return "", fmt.Errorf("failed to create stdout pipe: %v", err)
+		return "", usage, fmt.Errorf("failed to create stdout pipe: %v", err)
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return "", fmt.Errorf("failed to create stderr pipe: %v", err)
+		return "", usage, fmt.Errorf("failed to create stderr pipe: %v", err)
 	}
 
-	// Combine both outputs
-	output := ""
-
 	// Start the command
 	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("failed to start Python script: %v", err)
+		return "", usage, fmt.Errorf("failed to start Python script: %v", err)
+	}
+	if crash {
+		cmd.Process.Kill()
 	}
 
-	// Read stdout in a goroutine
-	stdoutDone := make(chan bool)
+	// Both streams are read concurrently, so that neither pipe fills up and blocks the script
+	logger := r.logger.With("script", filepath.Base(scriptPath), "pid", cmd.Process.Pid)
+	stderrDone := make(chan string, 1)
 	go func() {
-		stdoutBytes, _ := io.ReadAll(stdout)
-		output += string(stdoutBytes)
-		stdoutDone <- true
+		stderrDone <- forwardScriptLog(stderr, logger)
 	}()
+	stdoutBytes, _ := io.ReadAll(stdout)
+	output := string(stdoutBytes)
+	stderrOutput := <-stderrDone
 
-	// Read stderr
-	stderrBytes, _ := io.ReadAll(stderr)
-	output += string(stderrBytes)
+	// Wait for the command to complete
+	err = cmd.Wait()
+	usage.WallTime = time.Since(started)
+	if cmd.ProcessState != nil {
+		fillProcessUsage(usage, cmd.ProcessState)
+	}
 
-	// Wait for stdout to be read
-	<-stdoutDone
+	if err != nil {
+		if ctx.Err() != nil {
+			return output, usage, fmt.Errorf("Python script interrupted: %w", ctx.Err())
+		}
+		return output, usage, fmt.Errorf("Python script failed: %v\nOutput: %s\nStderr: %s", err, output, stderrOutput)
+	}
 
-	// Wait for the command to complete
-	if err := cmd.Wait(); err != nil {
-		return output, fmt.Errorf("Python script failed: %v\nOutput: %s", err, output)
+	return output, usage, nil
+}
+
+// ReadModelFile reads a file from the model directory
+func (r *FileRepository) ReadModelFile(fileName string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(r.modelPath, fileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model file: %v", err)
 	}
+	return data, nil
+}
 
-	return output, nil
+// WriteModelFile replaces a file in the model directory
+func (r *FileRepository) WriteModelFile(fileName string, data []byte) error {
+	if err := writeFileAtomic(filepath.Join(r.modelPath, fileName), data); err != nil {
+		return fmt.Errorf("failed to write model file: %v", err)
+	}
+	return nil
 }
 
 // ReadDataFile reads a file from the data directory
@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Forecast represents a stored forecast for a product on a date, with actuals once they are known
+type Forecast struct {
+	ID             int64
+	CreatedAt      time.Time
+	ProductName    string
+	Region         string
+	Seller         string
+	ForecastDate   time.Time
+	HorizonDays    int
+	PredictedPrice float64
+	PredictedSales float64
+	ModelVersion   string
+	ActualPrice    *float64
+	ActualSales    *float64
+}
+
+// forecastColumns lists the columns read by GetLatestForecasts, in scan order
+const forecastColumns = `id, created_at, product_name, region, seller, forecast_date, horizon_days,
+	predicted_price, predicted_sales, model_version, actual_price, actual_sales`
+
+// SaveForecast stores a forecast and returns its ID. A forecast for the same key, target date and
+// model version is updated in place, keeping any actuals already filled in.
+func (r *PostgresRepository) SaveForecast(forecast *Forecast) (int64, error) {
+	query := `
+		INSERT INTO forecasts (
+			product_name, region, seller, forecast_date, horizon_days,
+			predicted_price, predicted_sales, model_version
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (product_name, region, seller, forecast_date, model_version) DO UPDATE SET
+			created_at = NOW(),
+			horizon_days = EXCLUDED.horizon_days,
+			predicted_price = EXCLUDED.predicted_price,
+			predicted_sales = EXCLUDED.predicted_sales
+		RETURNING id
+	`
+
+	var id int64
+	err := r.queryRow(query, []any{
+		forecast.ProductName, forecast.Region, forecast.Seller, forecast.ForecastDate, forecast.HorizonDays,
+		forecast.PredictedPrice, forecast.PredictedSales, forecast.ModelVersion,
+	}, &id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save forecast: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetLatestForecasts returns, for every target date in [from, to], the most recently stored forecast
+// of the key across model versions, ordered by date
+func (r *PostgresRepository) GetLatestForecasts(productName, region, seller string, from, to time.Time) ([]Forecast, error) {
+	var forecasts []Forecast
+	err := r.EachLatestForecast(productName, region, seller, from, to, func(f *Forecast) error {
+		forecasts = append(forecasts, *f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return forecasts, nil
+}
+
+// EachLatestForecast calls fn with the forecasts GetLatestForecasts returns, one row at a time as they
+// are read, so that large ranges are never held in memory. An error from fn stops the iteration
+func (r *PostgresRepository) EachLatestForecast(productName, region, seller string, from, to time.Time, fn func(*Forecast) error) error {
+	rows, err := r.db.Query(`
+		SELECT DISTINCT ON (forecast_date) `+forecastColumns+`
+		FROM forecasts
+		WHERE product_name = $1 AND region = $2 AND seller = $3
+			AND forecast_date BETWEEN $4 AND $5
+		ORDER BY forecast_date, created_at DESC, id DESC
+	`, productName, region, seller, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("failed to get latest forecasts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f Forecast
+		if err := rows.Scan(&f.ID, &f.CreatedAt, &f.ProductName, &f.Region, &f.Seller, &f.ForecastDate,
+			&f.HorizonDays, &f.PredictedPrice, &f.PredictedSales, &f.ModelVersion,
+			&f.ActualPrice, &f.ActualSales); err != nil {
+			return fmt.Errorf("failed to scan forecast: %w", err)
+		}
+		if err := fn(&f); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read forecasts: %w", err)
+	}
+
+	return nil
+}
+
+// ListPendingActualsDates returns the forecast dates that have forecasts without actuals whose horizon
+// ended on or before asOf, oldest first
+func (r *PostgresRepository) ListPendingActualsDates(asOf time.Time) ([]time.Time, error) {
+	rows, err := r.db.Query(`
+		SELECT DISTINCT forecast_date FROM forecasts
+		WHERE actual_sales IS NULL AND forecast_date + horizon_days <= $1
+		ORDER BY forecast_date
+	`, asOf.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending actuals dates: %w", err)
+	}
+	defer rows.Close()
+
+	var dates []time.Time
+	for rows.Next() {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			return nil, fmt.Errorf("failed to scan pending actuals date: %w", err)
+		}
+		dates = append(dates, date)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pending actuals dates: %w", err)
+	}
+
+	return dates, nil
+}
+
+// UpdateForecastActuals fills in the actual price and sales of the forecasts made on forecastDate whose
+// horizon ended on or before asOf: the price on the last day of the horizon and the sales summed over it.
+// It returns the number of forecasts updated.
+func (r *PostgresRepository) UpdateForecastActuals(asOf, forecastDate time.Time) (int64, error) {
+	query := `
+		UPDATE forecasts f
+		SET actual_price = a.price, actual_sales = a.sales, actuals_updated_at = NOW()
+		FROM (
+			SELECT f2.id,
+				(SELECT p.price FROM processed_data p
+					WHERE p.product_name = f2.product_name AND p.region = f2.region AND p.seller = f2.seller
+						AND p.date = f2.forecast_date + f2.horizon_days
+					LIMIT 1) AS price,
+				(SELECT SUM(p.sales_quantity) FROM processed_data p
+					WHERE p.product_name = f2.product_name AND p.region = f2.region AND p.seller = f2.seller
+						AND p.date > f2.forecast_date AND p.date <= f2.forecast_date + f2.horizon_days) AS sales
+			FROM forecasts f2
+			WHERE f2.actual_sales IS NULL AND f2.forecast_date + f2.horizon_days <= $1 AND f2.forecast_date = $2
+		) a
+		WHERE f.id = a.id AND a.sales IS NOT NULL
+	`
+
+	var updated int64
+	err := r.retryPolicy.Do(func() error {
+		result, err := r.db.Exec(query, asOf.Format("2006-01-02"), forecastDate.Format("2006-01-02"))
+		if err != nil {
+			return err
+		}
+		updated, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to update forecast actuals: %w", err)
+	}
+
+	return updated, nil
+}
+
+// ForecastActual is a forecast whose actuals are known, with the category of its product
+type ForecastActual struct {
+	ProductName    string
+	Region         string
+	Seller         string
+	Category       string
+	ForecastDate   time.Time
+	ModelVersion   string
+	PredictedPrice float64
+	PredictedSales float64
+	ActualPrice    *float64
+	ActualSales    float64
+}
+
+// ForecastActualFilter narrows the forecasts EachForecastActual reads; zero fields match everything
+type ForecastActualFilter struct {
+	From         time.Time
+	To           time.Time
+	ModelVersion string
+	// UpdatedSince matches the forecasts whose actuals were filled in at or after it
+	UpdatedSince time.Time
+}
+
+// where builds the WHERE clause and arguments of the filter
+func (f ForecastActualFilter) where() (string, []any) {
+	conditions := []string{"f.actual_sales IS NOT NULL"}
+	var args []any
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if !f.From.IsZero() {
+		add("f.forecast_date >= $%d", f.From.Format("2006-01-02"))
+	}
+	if !f.To.IsZero() {
+		add("f.forecast_date <= $%d", f.To.Format("2006-01-02"))
+	}
+	if f.ModelVersion != "" {
+		add("f.model_version = $%d", f.ModelVersion)
+	}
+	if !f.UpdatedSince.IsZero() {
+		add("f.actuals_updated_at >= $%d", f.UpdatedSince)
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// EachForecastActual calls fn with every forecast matching the filter, one row at a time. The
+// category is that of the catalog entry of the product, or of its latest processed data otherwise.
+// An error from fn stops the iteration
+func (r *PostgresRepository) EachForecastActual(filter ForecastActualFilter, fn func(*ForecastActual) error) error {
+	where, args := filter.where()
+	rows, err := r.db.Query(`
+		SELECT f.product_name, f.region, f.seller,
+			COALESCE(NULLIF(c.category, ''), (
+				SELECT p.category FROM processed_data p
+				WHERE p.product_name = f.product_name
+				ORDER BY p.date DESC
+				LIMIT 1
+			), ''),
+			f.forecast_date, f.model_version, f.predicted_price, f.predicted_sales,
+			f.actual_price, f.actual_sales
+		FROM forecasts f
+		LEFT JOIN products c ON c.product_name = f.product_name
+		`+where, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get forecast actuals: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f ForecastActual
+		if err := rows.Scan(&f.ProductName, &f.Region, &f.Seller, &f.Category, &f.ForecastDate, &f.ModelVersion,
+			&f.PredictedPrice, &f.PredictedSales, &f.ActualPrice, &f.ActualSales); err != nil {
+			return fmt.Errorf("failed to scan forecast actual: %w", err)
+		}
+		if err := fn(&f); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read forecast actuals: %w", err)
+	}
+	return nil
+}
+
+// ForecastKey is a product, region and seller with a target date that has stored forecasts
+type ForecastKey struct {
+	ProductName  string
+	Region       string
+	Seller       string
+	ForecastDate time.Time
+}
+
+// ForecastFilter selects stored forecasts by key and target date; empty fields match everything,
+// the dates are inclusive
+type ForecastFilter struct {
+	ProductName string
+	Region      string
+	Seller      string
+	From        time.Time
+	To          time.Time
+}
+
+// where builds the WHERE clause and arguments of the filter
+func (f ForecastFilter) where() (string, []any) {
+	conditions := []string{"forecast_date BETWEEN $1 AND $2"}
+	args := []any{f.From.Format("2006-01-02"), f.To.Format("2006-01-02")}
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.ProductName != "" {
+		add("product_name = $%d", f.ProductName)
+	}
+	if f.Region != "" {
+		add("region = $%d", f.Region)
+	}
+	if f.Seller != "" {
+		add("seller = $%d", f.Seller)
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// ListForecastKeys returns up to limit keys and target dates with forecasts matching the filter,
+// of any model version, ordered by date
+func (r *PostgresRepository) ListForecastKeys(filter ForecastFilter, limit int) ([]ForecastKey, error) {
+	where, args := filter.where()
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT DISTINCT product_name, region, seller, forecast_date
+		FROM forecasts
+		%s
+		ORDER BY forecast_date, product_name, region, seller
+		LIMIT $%d
+	`, where, len(args)+1), append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list forecast keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []ForecastKey
+	for rows.Next() {
+		var k ForecastKey
+		if err := rows.Scan(&k.ProductName, &k.Region, &k.Seller, &k.ForecastDate); err != nil {
+			return nil, fmt.Errorf("failed to scan forecast key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read forecast keys: %w", err)
+	}
+	return keys, nil
+}
+
+// DeleteForecasts deletes the forecasts matching the filter, of every model version and with their
+// actuals, and returns how many were deleted
+func (r *PostgresRepository) DeleteForecasts(filter ForecastFilter) (int64, error) {
+	where, args := filter.where()
+	var deleted int64
+	err := r.retryPolicy.Do(func() error {
+		result, err := r.db.Exec(`DELETE FROM forecasts `+where, args...)
+		if err != nil {
+			return err
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete forecasts: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+)
+
+// GoldenOutput is the expected output of a model version for a golden set case. CaseHash identifies
+// the features of the case, so that an edited case gets new expectations
+type GoldenOutput struct {
+	ModelVersion   string
+	CaseName       string
+	CaseHash       string
+	PredictedPrice float64
+	PredictedSales float64
+	// Engine and RecordedBy tell which inference engine and replica produced the expectation
+	Engine     string
+	RecordedBy string
+	CreatedAt  time.Time
+}
+
+// ListGoldenOutputs returns the expected outputs recorded for a model version
+func (r *PostgresRepository) ListGoldenOutputs(version string) ([]GoldenOutput, error) {
+	rows, err := r.db.Query(`
+		SELECT model_version, case_name, case_hash, predicted_price, predicted_sales, engine, recorded_by, created_at
+		FROM golden_outputs
+		WHERE model_version = $1
+		ORDER BY case_name
+	`, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list golden outputs: %w", err)
+	}
+	defer rows.Close()
+
+	var outputs []GoldenOutput
+	for rows.Next() {
+		var output GoldenOutput
+		err := rows.Scan(&output.ModelVersion, &output.CaseName, &output.CaseHash, &output.PredictedPrice,
+			&output.PredictedSales, &output.Engine, &output.RecordedBy, &output.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan golden output: %w", err)
+		}
+		outputs = append(outputs, output)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read golden outputs: %w", err)
+	}
+
+	return outputs, nil
+}
+
+// SaveGoldenOutputs records expected outputs. An expectation already recorded for the same version
+// and case is kept, so the first replica to record one sets it for all of them
+func (r *PostgresRepository) SaveGoldenOutputs(outputs []GoldenOutput) error {
+	for _, output := range outputs {
+		err := r.retryPolicy.Do(func() error {
+			_, err := r.db.Exec(`
+				INSERT INTO golden_outputs (
+					model_version, case_name, case_hash, predicted_price, predicted_sales, engine, recorded_by, created_at
+				) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				ON CONFLICT (model_version, case_name, case_hash) DO NOTHING
+			`, output.ModelVersion, output.CaseName, output.CaseHash, output.PredictedPrice, output.PredictedSales,
+				output.Engine, output.RecordedBy, output.CreatedAt)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to save golden output: %w", err)
+		}
+	}
+	return nil
+}
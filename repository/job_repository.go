@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// JobExecution is a recorded run of a background job
+type JobExecution struct {
+	ID          int64
+	JobType     string
+	Params      []byte
+	StartedAt   time.Time
+	FinishedAt  *time.Time
+	Status      string
+	Error       string
+	TriggeredBy string
+}
+
+// JobExecutionFilter narrows a job execution listing; empty fields match everything
+type JobExecutionFilter struct {
+	JobType     string
+	Status      string
+	TriggeredBy string
+	From        time.Time
+	To          time.Time
+}
+
+// where builds the WHERE clause and arguments of the filter
+func (f JobExecutionFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.JobType != "" {
+		add("job_type = $%d", f.JobType)
+	}
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.TriggeredBy != "" {
+		add("triggered_by = $%d", f.TriggeredBy)
+	}
+	if !f.From.IsZero() {
+		add("started_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("started_at < $%d", f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// CreateJobExecution records the start of a job run and returns its ID
+func (r *PostgresRepository) CreateJobExecution(execution *JobExecution) (int64, error) {
+	var id int64
+	err := r.writeRow(`
+		INSERT INTO jobs (job_type, params, started_at, status, triggered_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, []any{execution.JobType, nullableJSON(execution.Params), execution.StartedAt, execution.Status, execution.TriggeredBy}, &id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create job execution: %w", err)
+	}
+	return id, nil
+}
+
+// FinishJobExecution records the outcome of a job run
+func (r *PostgresRepository) FinishJobExecution(id int64, status string, errMsg string, finishedAt time.Time) error {
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`
+			UPDATE jobs SET status = $2, error = $3, finished_at = $4
+			WHERE id = $1
+		`, id, status, errMsg, finishedAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to finish job execution: %w", err)
+	}
+	return nil
+}
+
+// ListJobExecutions returns a page of job runs matching the filter, newest first,
+// and the total number of matching runs
+func (r *PostgresRepository) ListJobExecutions(filter JobExecutionFilter, limit, offset int) ([]JobExecution, int, error) {
+	where, args := filter.where()
+
+	var total int
+	if err := r.queryRow(`SELECT COUNT(*) FROM jobs `+where, args, &total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count job executions: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, job_type, params, started_at, finished_at, status, error, triggered_by
+		FROM jobs
+		%s
+		ORDER BY started_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)+1, len(args)+2)
+
+	rows, err := r.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list job executions: %w", err)
+	}
+	defer rows.Close()
+
+	var executions []JobExecution
+	for rows.Next() {
+		var e JobExecution
+		var params, errMsg sql.NullString
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&e.ID, &e.JobType, &params, &e.StartedAt, &finishedAt, &e.Status, &errMsg, &e.TriggeredBy); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan job execution: %w", err)
+		}
+		if params.Valid {
+			e.Params = []byte(params.String)
+		}
+		if finishedAt.Valid {
+			e.FinishedAt = &finishedAt.Time
+		}
+		e.Error = errMsg.String
+		executions = append(executions, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read job executions: %w", err)
+	}
+
+	return executions, total, nil
+}
+
+// ClaimScheduledJob claims the scheduled run of a job at scheduledAt for replica. Every replica
+// running the scheduler fires the same schedules, and only the first to claim a run gets true
+func (r *PostgresRepository) ClaimScheduledJob(name string, scheduledAt time.Time, replica string) (bool, error) {
+	var n int64
+	// A claim that was applied no longer matches, so it is only retried when it was not applied
+	err := r.retryPolicy.DoWrite(func() error {
+		result, err := r.db.Exec(`
+			INSERT INTO job_leases (job_type, scheduled_at, replica)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (job_type) DO UPDATE SET
+				scheduled_at = EXCLUDED.scheduled_at, replica = EXCLUDED.replica, claimed_at = NOW()
+			WHERE job_leases.scheduled_at < EXCLUDED.scheduled_at
+		`, name, scheduledAt, replica)
+		if err != nil {
+			return err
+		}
+		n, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to claim scheduled job: %w", err)
+	}
+	return n > 0, nil
+}
+
+// TryLockJob takes the lock of a background job shared by all replicas, so that a job runs on one
+// replica at a time, and reports false when another replica holds it. The lock is a session-level
+// advisory lock, held on a connection of its own until unlock is called or the connection is lost
+func (r *PostgresRepository) TryLockJob(name string) (unlock func(), locked bool, err error) {
+	ctx := context.Background()
+	key := jobLockKey(name)
+
+	var conn *sql.Conn
+	err = r.retryPolicy.Do(func() error {
+		c, err := r.db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		if err := c.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+			c.Close()
+			return err
+		}
+		conn = c
+		return nil
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to lock job: %w", err)
+	}
+	if !locked {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, key); err != nil {
+			// A connection still holding the lock must not go back to the pool; closing it
+			// ends the session and releases the lock
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, true, nil
+}
+
+// jobLockKey derives the advisory lock key of a job from its name
+func jobLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("job:" + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,74 @@
+package repository
+
+import "fmt"
+
+// LaunchAnalogDay is the total daily sales and average price of an analog product on a day of its
+// launch period, Day 0 being its launch date
+type LaunchAnalogDay struct {
+	ProductName string
+	Brand       string
+	Day         int
+	Sales       float64
+	Price       float64
+}
+
+// HasProductHistory reports whether processed_data has any row of a product
+func (r *PostgresRepository) HasProductHistory(productName string) (bool, error) {
+	var exists bool
+	err := r.queryRow(`SELECT EXISTS (SELECT 1 FROM processed_data WHERE product_name = $1)`, []any{productName}, &exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check product history: %w", err)
+	}
+	return exists, nil
+}
+
+// LaunchAnalogDays returns the first days days after launch of every product of a category, the
+// analogs of a new product of that category, ordered by product and day. Brand and category come
+// from the product catalog when it has them and from the latest processed_data row otherwise. The
+// launch date is the catalog's launch_date, or else the product's first processed_data row;
+// products whose first row is also the first row of processed_data were already selling when the
+// data starts and are left out unless the catalog dates their launch
+func (r *PostgresRepository) LaunchAnalogDays(category string, days int) ([]LaunchAnalogDay, error) {
+	query := `
+		WITH history AS (
+			SELECT DISTINCT ON (product_name) product_name, brand, category,
+				MIN(date) OVER (PARTITION BY product_name) AS first_date
+			FROM processed_data
+			ORDER BY product_name, date DESC
+		),
+		analogs AS (
+			SELECT h.product_name, COALESCE(NULLIF(c.brand, ''), h.brand) AS brand,
+				COALESCE(c.launch_date, h.first_date) AS launched_on
+			FROM history h
+			LEFT JOIN products c ON c.product_name = h.product_name
+			WHERE COALESCE(NULLIF(c.category, ''), h.category) = $1
+				AND (c.launch_date IS NOT NULL OR h.first_date > (SELECT MIN(date) FROM processed_data))
+		)
+		SELECT a.product_name, a.brand, p.date - a.launched_on AS day,
+			SUM(p.sales_quantity), AVG(p.price)
+		FROM analogs a
+		JOIN processed_data p ON p.product_name = a.product_name
+		WHERE p.date >= a.launched_on AND p.date < a.launched_on + $2::INTEGER
+		GROUP BY a.product_name, a.brand, day
+		ORDER BY a.product_name, day
+	`
+
+	rows, err := r.db.Query(query, category, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get launch analogs: %w", err)
+	}
+	defer rows.Close()
+
+	var result []LaunchAnalogDay
+	for rows.Next() {
+		var d LaunchAnalogDay
+		if err := rows.Scan(&d.ProductName, &d.Brand, &d.Day, &d.Sales, &d.Price); err != nil {
+			return nil, fmt.Errorf("failed to scan launch analog: %w", err)
+		}
+		result = append(result, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read launch analogs: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ModelVersion represents a trained model version recorded in the registry
+type ModelVersion struct {
+	Version   string
+	CreatedAt time.Time
+	IsActive  bool
+	// IsStandby marks the version loaded next to the active one to be shadow-tested before promotion
+	IsStandby          bool
+	PriceBestIteration int
+	PriceBestScore     float64
+	SalesBestIteration int
+	SalesBestScore     float64
+	PriceMAE           float64
+	SalesMAE           float64
+	// PriceBaselineMAE and SalesBaselineMAE are JSON objects with the validation MAE of each naive
+	// baseline, nil for versions trained before baselines were measured
+	PriceBaselineMAE []byte
+	SalesBaselineMAE []byte
+	// PromotionBlocked says why an inactive version was not made active when it was registered
+	PromotionBlocked []string
+	// DatasetHash and DatasetRows describe the data of the training run that produced the version;
+	// only ListModelVersionPage reads them
+	DatasetHash string
+	DatasetRows int64
+}
+
+// modelVersionColumns lists the columns scanned by scanModelVersion
+const modelVersionColumns = `version, created_at, is_active, is_standby,
+	price_best_iteration, price_best_score, sales_best_iteration, sales_best_score,
+	price_mae, sales_mae, price_baseline_mae, sales_baseline_mae, promotion_blocked`
+
+// modelVersionFields returns the scan destinations matching modelVersionColumns
+func modelVersionFields(v *ModelVersion) []any {
+	return []any{&v.Version, &v.CreatedAt, &v.IsActive, &v.IsStandby,
+		&v.PriceBestIteration, &v.PriceBestScore, &v.SalesBestIteration, &v.SalesBestScore,
+		&v.PriceMAE, &v.SalesMAE, &v.PriceBaselineMAE, &v.SalesBaselineMAE, pq.Array(&v.PromotionBlocked)}
+}
+
+// RegisterModelVersion inserts a model version, making it the active one when IsActive is set and
+// the standby one when IsStandby is
+func (r *PostgresRepository) RegisterModelVersion(v *ModelVersion) error {
+	return r.retryPolicy.DoWrite(func() error {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if v.IsActive {
+			if _, err := tx.Exec(`UPDATE model_versions SET is_active = FALSE WHERE is_active`); err != nil {
+				return err
+			}
+		}
+		if v.IsStandby {
+			if _, err := tx.Exec(`UPDATE model_versions SET is_standby = FALSE WHERE is_standby`); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO model_versions (
+				version, created_at, is_active, is_standby,
+				price_best_iteration, price_best_score, sales_best_iteration, sales_best_score,
+				price_mae, sales_mae, price_baseline_mae, sales_baseline_mae, promotion_blocked
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		`, v.Version, v.CreatedAt, v.IsActive, v.IsStandby, v.PriceBestIteration, v.PriceBestScore, v.SalesBestIteration, v.SalesBestScore,
+			v.PriceMAE, v.SalesMAE, nullableJSON(v.PriceBaselineMAE), nullableJSON(v.SalesBaselineMAE), pq.Array(v.PromotionBlocked))
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// GetActiveModelVersion returns the active model version, or nil if none is registered
+func (r *PostgresRepository) GetActiveModelVersion() (*ModelVersion, error) {
+	query := `SELECT ` + modelVersionColumns + ` FROM model_versions WHERE is_active LIMIT 1`
+
+	var v ModelVersion
+	err := r.queryRow(query, nil, modelVersionFields(&v)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get active model version: %w", err)
+	}
+
+	return &v, nil
+}
+
+// GetStandbyModelVersion returns the standby model version, or nil if there is none
+func (r *PostgresRepository) GetStandbyModelVersion() (*ModelVersion, error) {
+	query := `SELECT ` + modelVersionColumns + ` FROM model_versions WHERE is_standby LIMIT 1`
+
+	var v ModelVersion
+	err := r.queryRow(query, nil, modelVersionFields(&v)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get standby model version: %w", err)
+	}
+
+	return &v, nil
+}
+
+// PromoteStandbyModelVersion makes the standby version the active one. It reports false, changing
+// nothing, when the version is no longer the standby one
+func (r *PostgresRepository) PromoteStandbyModelVersion(version string) (bool, error) {
+	var promoted bool
+	err := r.retryPolicy.Do(func() error {
+		promoted = false
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var standby bool
+		err = tx.QueryRow(`SELECT is_standby FROM model_versions WHERE version = $1 FOR UPDATE`, version).Scan(&standby)
+		if err == sql.ErrNoRows || (err == nil && !standby) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`UPDATE model_versions SET is_active = FALSE WHERE is_active`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE model_versions SET is_active = TRUE, is_standby = FALSE WHERE version = $1`, version); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		promoted = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to promote standby model version: %w", err)
+	}
+	return promoted, nil
+}
+
+// RejectStandbyModelVersion takes the version out of the standby slot, recording why it was not
+// promoted. It reports false when the version is no longer the standby one
+func (r *PostgresRepository) RejectStandbyModelVersion(version string, reasons []string) (bool, error) {
+	var rejected bool
+	err := r.retryPolicy.Do(func() error {
+		result, err := r.db.Exec(`
+			UPDATE model_versions SET is_standby = FALSE, promotion_blocked = $2
+			WHERE version = $1 AND is_standby
+		`, version, pq.Array(reasons))
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		rejected = affected > 0
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to reject standby model version: %w", err)
+	}
+	return rejected, nil
+}
+
+// ListModelVersions returns the model versions created in the given period, oldest first
+func (r *PostgresRepository) ListModelVersions(from, to time.Time) ([]ModelVersion, error) {
+	query := `SELECT ` + modelVersionColumns + ` FROM model_versions
+		WHERE created_at BETWEEN $1 AND $2
+		ORDER BY created_at`
+
+	rows, err := r.db.Query(query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list model versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []ModelVersion
+	for rows.Next() {
+		var v ModelVersion
+		if err := rows.Scan(modelVersionFields(&v)...); err != nil {
+			return nil, fmt.Errorf("failed to scan model version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read model versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+// GetModelVersion returns a registered model version, or nil if it does not exist
+func (r *PostgresRepository) GetModelVersion(version string) (*ModelVersion, error) {
+	query := `SELECT ` + modelVersionColumns + ` FROM model_versions WHERE version = $1`
+
+	var v ModelVersion
+	err := r.queryRow(query, []any{version}, modelVersionFields(&v)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get model version: %w", err)
+	}
+
+	return &v, nil
+}
+
+// ListModelVersionPage returns a page of the model versions, newest first, with the dataset of the
+// training run that produced each one, and the total number of versions
+func (r *PostgresRepository) ListModelVersionPage(limit, offset int) ([]ModelVersion, int, error) {
+	var total int
+	if err := r.queryRow(`SELECT COUNT(*) FROM model_versions`, nil, &total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count model versions: %w", err)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+modelVersionColumns+`, COALESCE(run.dataset_hash, ''), COALESCE(run.dataset_rows, 0)
+		FROM model_versions
+		LEFT JOIN LATERAL (
+			SELECT dataset_hash, dataset_rows FROM training_runs
+			WHERE training_runs.version = model_versions.version
+			ORDER BY id DESC
+			LIMIT 1
+		) run ON TRUE
+		ORDER BY created_at DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list model versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []ModelVersion
+	for rows.Next() {
+		var v ModelVersion
+		if err := rows.Scan(append(modelVersionFields(&v), &v.DatasetHash, &v.DatasetRows)...); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan model version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read model versions: %w", err)
+	}
+
+	return versions, total, nil
+}
+
+// ActivateModelVersion makes a registered version the active one, taking it out of the standby slot
+// if it was there. It reports false, changing nothing, when the version is not registered
+func (r *PostgresRepository) ActivateModelVersion(version string) (bool, error) {
+	var activated bool
+	err := r.retryPolicy.Do(func() error {
+		activated = false
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var exists bool
+		err = tx.QueryRow(`SELECT TRUE FROM model_versions WHERE version = $1 FOR UPDATE`, version).Scan(&exists)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`UPDATE model_versions SET is_active = FALSE WHERE is_active`); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE model_versions SET is_active = TRUE, is_standby = FALSE WHERE version = $1`, version); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		activated = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to activate model version: %w", err)
+	}
+	return activated, nil
+}
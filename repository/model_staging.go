@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stagingDirPrefix names the temporary directories new model artifacts are written to before install
+const stagingDirPrefix = ".staging-"
+
+// CreateStagingDir creates an empty directory for new model artifacts. It lives inside the model
+// directory so that installing the artifacts is a same-filesystem rename
+func (r *FileRepository) CreateStagingDir() (string, error) {
+	dir, err := os.MkdirTemp(r.modelPath, stagingDirPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create model staging directory: %v", err)
+	}
+	return dir, nil
+}
+
+// RemoveStagingDir deletes a staging directory and whatever artifacts are left in it
+func (r *FileRepository) RemoveStagingDir(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove model staging directory: %v", err)
+	}
+	return nil
+}
+
+// CleanStagingDirs removes staging directories left behind by runs that crashed before installing
+func (r *FileRepository) CleanStagingDirs() error {
+	dirs, err := filepath.Glob(filepath.Join(r.modelPath, stagingDirPrefix+"*"))
+	if err != nil {
+		return fmt.Errorf("failed to list model staging directories: %v", err)
+	}
+	for _, dir := range dirs {
+		if err := r.RemoveStagingDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadStagedFile reads an artifact from a staging directory
+func (r *FileRepository) ReadStagedFile(dir string, fileName string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(dir, fileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staged model file: %v", err)
+	}
+	return data, nil
+}
+
+// VerifyStagedArtifacts checks that every named artifact was fully written to the staging directory
+func (r *FileRepository) VerifyStagedArtifacts(dir string, names []string) error {
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("staged model artifact %s is missing: %v", name, err)
+		}
+		if info.Size() == 0 {
+			return fmt.Errorf("staged model artifact %s is empty", name)
+		}
+	}
+	return nil
+}
+
+// InstallStagedArtifacts moves the named artifacts from the staging directory into the model
+// directory and removes the staging directory. Each file is swapped in with a rename, so readers
+// see either the old or the new file, never a partial one; artifacts are installed in the given
+// order, so callers list the compatibility stamp (feature_info.json) last
+func (r *FileRepository) InstallStagedArtifacts(dir string, names []string) error {
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(dir, name), filepath.Join(r.modelPath, name)); err != nil {
+			return fmt.Errorf("failed to install model artifact %s: %v", name, err)
+		}
+	}
+	return r.RemoveStagingDir(dir)
+}
+
+// MoveStagedArtifacts moves the named artifacts from one staging directory to another
+func (r *FileRepository) MoveStagedArtifacts(from, to string, names []string) error {
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(from, name), filepath.Join(to, name)); err != nil {
+			return fmt.Errorf("failed to move staged model artifact %s: %v", name, err)
+		}
+	}
+	return nil
+}
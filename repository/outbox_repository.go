@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// OutboxMessage is a message a producer wrote to the ingestion outbox in the same transaction as the
+// change it describes
+type OutboxMessage struct {
+	ID        int64
+	Topic     string
+	Producer  string
+	Payload   []byte
+	CreatedAt time.Time
+	// Attempts is the number of earlier deliveries that failed
+	Attempts int
+}
+
+// ProcessOutboxMessages locks up to limit pending messages that have failed fewer than maxAttempts
+// times, passes them to handle in the order they were written and marks each one processed, all in
+// one transaction. The locks are taken with SKIP LOCKED, so replicas polling together share the
+// messages instead of delivering them twice. A failing message has its attempt recorded and ends the
+// batch, so that the messages written after it are not processed before it is retried. Returns the
+// number of messages processed
+func (r *PostgresRepository) ProcessOutboxMessages(ctx context.Context, limit, maxAttempts int, handle func(ctx context.Context, message OutboxMessage) error) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin outbox transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, topic, producer, payload, created_at, attempts
+		FROM ingestion_outbox
+		WHERE processed_at IS NULL AND attempts < $1
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, maxAttempts, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock outbox messages: %w", err)
+	}
+	var messages []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		if err := rows.Scan(&m.ID, &m.Topic, &m.Producer, &m.Payload, &m.CreatedAt, &m.Attempts); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		messages = append(messages, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read outbox messages: %w", err)
+	}
+
+	processed := 0
+	for _, m := range messages {
+		if handleErr := handle(ctx, m); handleErr != nil {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE ingestion_outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1
+			`, m.ID, handleErr.Error())
+			if err != nil {
+				return 0, fmt.Errorf("failed to record outbox message failure: %w", err)
+			}
+			break
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE ingestion_outbox SET processed_at = NOW() WHERE id = $1`, m.ID); err != nil {
+			return 0, fmt.Errorf("failed to mark outbox message processed: %w", err)
+		}
+		processed++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit outbox transaction: %w", err)
+	}
+	return processed, nil
+}
@@ -1,16 +1,19 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/graduate-work-mirea/data-processor-service/internal/chaos"
+	"github.com/lib/pq"
 )
 
 // PostgresRepository handles database operations for product data
 type PostgresRepository struct {
-	db *sql.DB
+	db          *sql.DB
+	retryPolicy RetryPolicy
 }
 
 // ProductHistoricalData represents historical data for a product
@@ -35,6 +38,8 @@ type ProductHistoricalData struct {
 	DeliveryDays   sql.NullFloat64
 	Brand          string
 	Category       string
+	// LatestDate is the date of the latest processed_data row for the key
+	LatestDate sql.NullTime
 	// Date related
 	IsWeekend bool
 	IsHoliday bool
@@ -43,46 +48,80 @@ type ProductHistoricalData struct {
 	Quarter   int
 }
 
-// NewPostgresRepository creates a new PostgresRepository instance
-func NewPostgresRepository(connStr string) (*PostgresRepository, error) {
-	db, err := sql.Open("postgres", connStr)
+// NewPostgresRepository creates a new PostgresRepository instance. It pings the database once,
+// without the retry policy, which applies to queries: callers waiting for the database to come up,
+// such as startup.WaitFor, retry the constructor instead
+func NewPostgresRepository(connStr string, retryPolicy RetryPolicy) (*PostgresRepository, error) {
+	connector, err := pq.NewConnector(connStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	db := sql.OpenDB(chaos.WrapConnector(connector))
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	return &PostgresRepository{
-		db: db,
+		db:          db,
+		retryPolicy: retryPolicy,
 	}, nil
 }
 
+// NewPostgresRepositoryFromDB creates a PostgresRepository over an open database, such as a test
+// database or one opened with a fake driver. The repository takes ownership of db and closes it
+func NewPostgresRepositoryFromDB(db *sql.DB, retryPolicy RetryPolicy) *PostgresRepository {
+	return &PostgresRepository{
+		db:          db,
+		retryPolicy: retryPolicy,
+	}
+}
+
 // Close closes the database connection
 func (r *PostgresRepository) Close() error {
 	return r.db.Close()
 }
 
-// GetLatestProductData retrieves the latest product data from the database
-func (r *PostgresRepository) GetLatestProductData(productName, region, seller string) (*ProductHistoricalData, error) {
+// Ping checks that the database is reachable
+func (r *PostgresRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// queryRow runs a single-row query and scans it into dest, retrying transient errors
+func (r *PostgresRepository) queryRow(query string, args []any, dest ...any) error {
+	return r.retryPolicy.Do(func() error {
+		return r.db.QueryRow(query, args...).Scan(dest...)
+	})
+}
+
+// writeRow runs a single-row write that is not idempotent, such as an INSERT ... RETURNING, and
+// scans it into dest. It is only retried when it failed before it was applied
+func (r *PostgresRepository) writeRow(query string, args []any, dest ...any) error {
+	return r.retryPolicy.DoWrite(func() error {
+		return r.db.QueryRow(query, args...).Scan(dest...)
+	})
+}
+
+// GetLatestProductData retrieves the latest product data from the database up to and including a date
+func (r *PostgresRepository) GetLatestProductData(productName, region, seller string, asOf time.Time) (*ProductHistoricalData, error) {
 	query := `
 		SELECT 
 			brand, category, price, original_price, discount_percentage, 
 			stock_level, customer_rating, review_count, delivery_days,
-			is_weekend, is_holiday, day_of_week, month, quarter
+			is_weekend, is_holiday, day_of_week, month, quarter, date
 		FROM processed_data 
-		WHERE product_name = $1 AND region = $2 AND seller = $3
+		WHERE product_name = $1 AND region = $2 AND seller = $3 AND date <= $4
 		ORDER BY date DESC
 		LIMIT 1
 	`
 
 	var data ProductHistoricalData
-	err := r.db.QueryRow(query, productName, region, seller).Scan(
+	err := r.queryRow(query, []any{productName, region, seller, asOf.Format("2006-01-02")},
 		&data.Brand, &data.Category, &data.Price, &data.OriginalPrice, &data.DiscountPerc,
 		&data.StockLevel, &data.CustomerRating, &data.ReviewCount, &data.DeliveryDays,
-		&data.IsWeekend, &data.IsHoliday, &data.DayOfWeek, &data.Month, &data.Quarter,
+		&data.IsWeekend, &data.IsHoliday, &data.DayOfWeek, &data.Month, &data.Quarter, &data.LatestDate,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -100,11 +139,19 @@ func (r *PostgresRepository) GetLatestProductData(productName, region, seller st
 	return &data, nil
 }
 
-// GetProductHistoricalData retrieves historical data for a product from the database
-func (r *PostgresRepository) GetProductHistoricalData(productName, region, seller string, date time.Time) (*ProductHistoricalData, error) {
-	// Get the date in YYYY-MM-DD format
-	dateStr := date.Format("2006-01-02")
+// LagDates are the days the lag features and rolling means of a history lookup are read from
+type LagDates struct {
+	Lag1    time.Time
+	Lag3    time.Time
+	Lag7    time.Time
+	Window3 []time.Time
+	Window7 []time.Time
+}
 
+// GetProductHistoricalData retrieves historical data for a product from the database as of date,
+// reading the lags and rolling means from the given days and the current values from the latest
+// row up to date
+func (r *PostgresRepository) GetProductHistoricalData(productName, region, seller string, date time.Time, lags LagDates) (*ProductHistoricalData, error) {
 	// Calculate date features for next day (prediction date)
 	predictionDate := date.AddDate(0, 0, 1)
 	dayOfWeek := int(predictionDate.Weekday())
@@ -113,7 +160,7 @@ func (r *PostgresRepository) GetProductHistoricalData(productName, region, selle
 	isWeekend := predictionDate.Weekday() == time.Saturday || predictionDate.Weekday() == time.Sunday
 
 	// Get basic data (brand, category) from the latest record
-	latestData, err := r.GetLatestProductData(productName, region, seller)
+	latestData, err := r.GetLatestProductData(productName, region, seller, date)
 	if err != nil {
 		return nil, err
 	}
@@ -129,74 +176,51 @@ func (r *PostgresRepository) GetProductHistoricalData(productName, region, selle
 		Quarter:   quarter,
 	}
 
-	// Get price and sales quantity lag 1
-	lag1Date := date.AddDate(0, 0, -1)
-	lag1Query := `
+	lagQuery := `
 		SELECT price, sales_quantity 
 		FROM processed_data 
 		WHERE product_name = $1 AND region = $2 AND seller = $3 AND date = $4
 		LIMIT 1
 	`
-	err = r.db.QueryRow(lag1Query, productName, region, seller, lag1Date.Format("2006-01-02")).
-		Scan(&data.PriceLag1, &data.SalesQuantityLag1)
+
+	// Get price and sales quantity lag 1
+	err = r.queryRow(lagQuery, []any{productName, region, seller, lags.Lag1.Format("2006-01-02")},
+		&data.PriceLag1, &data.SalesQuantityLag1)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("failed to get lag 1 data: %w", err)
 	}
 
 	// Get price and sales quantity lag 3
-	lag3Date := date.AddDate(0, 0, -3)
-	lag3Query := `
-		SELECT price, sales_quantity 
-		FROM processed_data 
-		WHERE product_name = $1 AND region = $2 AND seller = $3 AND date = $4
-		LIMIT 1
-	`
-	err = r.db.QueryRow(lag3Query, productName, region, seller, lag3Date.Format("2006-01-02")).
-		Scan(&data.PriceLag3, &data.SalesQuantityLag3)
+	err = r.queryRow(lagQuery, []any{productName, region, seller, lags.Lag3.Format("2006-01-02")},
+		&data.PriceLag3, &data.SalesQuantityLag3)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("failed to get lag 3 data: %w", err)
 	}
 
 	// Get price and sales quantity lag 7
-	lag7Date := date.AddDate(0, 0, -7)
-	lag7Query := `
-		SELECT price, sales_quantity 
-		FROM processed_data 
-		WHERE product_name = $1 AND region = $2 AND seller = $3 AND date = $4
-		LIMIT 1
-	`
-	err = r.db.QueryRow(lag7Query, productName, region, seller, lag7Date.Format("2006-01-02")).
-		Scan(&data.PriceLag7, &data.SalesQuantityLag7)
+	err = r.queryRow(lagQuery, []any{productName, region, seller, lags.Lag7.Format("2006-01-02")},
+		&data.PriceLag7, &data.SalesQuantityLag7)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("failed to get lag 7 data: %w", err)
 	}
 
-	// Calculate rolling means - for sales quantity over last 3 days
-	rollingMean3Query := `
+	rollingMeanQuery := `
 		SELECT AVG(price), AVG(sales_quantity)
 		FROM processed_data 
 		WHERE product_name = $1 AND region = $2 AND seller = $3 
-		AND date BETWEEN $4 AND $5
+		AND date = ANY($4::date[])
 	`
-	rolling3StartDate := date.AddDate(0, 0, -2) // Last 3 days including current
-	err = r.db.QueryRow(rollingMean3Query, productName, region, seller,
-		rolling3StartDate.Format("2006-01-02"), dateStr).
-		Scan(&data.PriceRollingMean3, &data.SalesQuantityRollingMean3)
+
+	// Calculate rolling means - for sales quantity over the last 3 days
+	err = r.queryRow(rollingMeanQuery, []any{productName, region, seller, pq.Array(formatDates(lags.Window3))},
+		&data.PriceRollingMean3, &data.SalesQuantityRollingMean3)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("failed to get rolling mean 3 data: %w", err)
 	}
 
-	// Calculate rolling means - for sales quantity over last 7 days
-	rollingMean7Query := `
-		SELECT AVG(price), AVG(sales_quantity)
-		FROM processed_data 
-		WHERE product_name = $1 AND region = $2 AND seller = $3 
-		AND date BETWEEN $4 AND $5
-	`
-	rolling7StartDate := date.AddDate(0, 0, -6) // Last 7 days including current
-	err = r.db.QueryRow(rollingMean7Query, productName, region, seller,
-		rolling7StartDate.Format("2006-01-02"), dateStr).
-		Scan(&data.PriceRollingMean7, &data.SalesQuantityRollingMean7)
+	// Calculate rolling means - for sales quantity over the last 7 days
+	err = r.queryRow(rollingMeanQuery, []any{productName, region, seller, pq.Array(formatDates(lags.Window7))},
+		&data.PriceRollingMean7, &data.SalesQuantityRollingMean7)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("failed to get rolling mean 7 data: %w", err)
 	}
@@ -209,6 +233,51 @@ func (r *PostgresRepository) GetProductHistoricalData(productName, region, selle
 	data.CustomerRating = latestData.CustomerRating
 	data.ReviewCount = latestData.ReviewCount
 	data.DeliveryDays = latestData.DeliveryDays
+	data.LatestDate = latestData.LatestDate
 
 	return data, nil
 }
+
+// SeriesPoint is a day of the history of a product, region and seller
+type SeriesPoint struct {
+	Date  time.Time
+	Price sql.NullFloat64
+	Sales sql.NullFloat64
+}
+
+// GetProductSeries returns the daily price and sales of a product, region and seller between two
+// dates inclusive, ordered by date
+func (r *PostgresRepository) GetProductSeries(productName, region, seller string, from, to time.Time) ([]SeriesPoint, error) {
+	rows, err := r.db.Query(`
+		SELECT date, price, sales_quantity
+		FROM processed_data
+		WHERE product_name = $1 AND region = $2 AND seller = $3 AND date BETWEEN $4 AND $5
+		ORDER BY date
+	`, productName, region, seller, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product series: %w", err)
+	}
+	defer rows.Close()
+
+	var series []SeriesPoint
+	for rows.Next() {
+		var point SeriesPoint
+		if err := rows.Scan(&point.Date, &point.Price, &point.Sales); err != nil {
+			return nil, fmt.Errorf("failed to scan product series: %w", err)
+		}
+		series = append(series, point)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read product series: %w", err)
+	}
+	return series, nil
+}
+
+// formatDates formats dates as YYYY-MM-DD
+func formatDates(dates []time.Time) []string {
+	formatted := make([]string, len(dates))
+	for i, date := range dates {
+		formatted[i] = date.Format("2006-01-02")
+	}
+	return formatted
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PredictionLogEntry represents a single prediction recorded in the audit log
+type PredictionLogEntry struct {
+	ID             int64
+	CreatedAt      time.Time
+	ProductName    string
+	Region         string
+	Seller         string
+	PredictionDate *time.Time
+	Features       []byte
+	Overrides      []string
+	PredictedPrice float64
+	PredictedSales float64
+	ModelVersion   string
+}
+
+// SavePredictionLog records a prediction in the audit log and returns its ID
+func (r *PostgresRepository) SavePredictionLog(entry *PredictionLogEntry) (int64, error) {
+	query := `
+		INSERT INTO prediction_log (
+			product_name, region, seller, prediction_date, features, overrides,
+			predicted_price, predicted_sales, model_version
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+
+	overrides := entry.Overrides
+	if overrides == nil {
+		overrides = []string{}
+	}
+
+	var id int64
+	err := r.writeRow(query, []any{
+		entry.ProductName, entry.Region, entry.Seller, entry.PredictionDate, entry.Features,
+		pq.Array(overrides), entry.PredictedPrice, entry.PredictedSales, entry.ModelVersion,
+	}, &id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save prediction log: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetPredictionLog returns a recorded prediction, or nil if there is none with the ID
+func (r *PostgresRepository) GetPredictionLog(id int64) (*PredictionLogEntry, error) {
+	var entry PredictionLogEntry
+	var predictionDate sql.NullTime
+	err := r.queryRow(`
+		SELECT id, created_at, product_name, region, seller, prediction_date, features, overrides,
+			predicted_price, predicted_sales, model_version
+		FROM prediction_log
+		WHERE id = $1
+	`, []any{id}, &entry.ID, &entry.CreatedAt, &entry.ProductName, &entry.Region, &entry.Seller, &predictionDate,
+		&entry.Features, pq.Array(&entry.Overrides), &entry.PredictedPrice, &entry.PredictedSales, &entry.ModelVersion)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get prediction log: %w", err)
+	}
+
+	if predictionDate.Valid {
+		entry.PredictionDate = &predictionDate.Time
+	}
+	return &entry, nil
+}
+
+// ListRecentPredictionLogs returns the latest recorded predictions, newest first, only those made by
+// modelVersion when it is not empty
+func (r *PostgresRepository) ListRecentPredictionLogs(limit int, modelVersion string) ([]PredictionLogEntry, error) {
+	rows, err := r.db.Query(`
+		SELECT id, created_at, product_name, region, seller, prediction_date, features, overrides,
+			predicted_price, predicted_sales, model_version
+		FROM prediction_log
+		WHERE $2 = '' OR model_version = $2
+		ORDER BY id DESC
+		LIMIT $1
+	`, limit, modelVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prediction logs: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []PredictionLogEntry
+	for rows.Next() {
+		var entry PredictionLogEntry
+		var predictionDate sql.NullTime
+		err := rows.Scan(&entry.ID, &entry.CreatedAt, &entry.ProductName, &entry.Region, &entry.Seller, &predictionDate,
+			&entry.Features, pq.Array(&entry.Overrides), &entry.PredictedPrice, &entry.PredictedSales, &entry.ModelVersion)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan prediction log: %w", err)
+		}
+		if predictionDate.Valid {
+			entry.PredictionDate = &predictionDate.Time
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read prediction logs: %w", err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package repository
+
+import "os"
+
+// terminateProcess kills a Python process, as there is no termination signal to send it
+func terminateProcess(process *os.Process) error {
+	return process.Kill()
+}
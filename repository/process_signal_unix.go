@@ -0,0 +1,13 @@
+//go:build unix
+
+package repository
+
+import (
+	"os"
+	"syscall"
+)
+
+// terminateProcess asks a Python process to exit, letting it clean up before it is killed
+func terminateProcess(process *os.Process) error {
+	return process.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Product is the catalog entry of a product, maintained independently of processed_data
+type Product struct {
+	ProductName string
+	Brand       string
+	Category    string
+	Attributes  []byte
+	LaunchDate  sql.NullTime
+	UpdatedAt   time.Time
+}
+
+// ProductFilter narrows a product listing; empty fields match everything
+type ProductFilter struct {
+	Brand    string
+	Category string
+}
+
+// where builds the WHERE clause and arguments of the filter
+func (f ProductFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.Brand != "" {
+		add("brand = $%d", f.Brand)
+	}
+	if f.Category != "" {
+		add("category = $%d", f.Category)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+const productColumns = `product_name, brand, category, attributes, launch_date, updated_at`
+
+// UpsertProduct creates or replaces the catalog entry of a product
+func (r *PostgresRepository) UpsertProduct(p *Product) error {
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`
+			INSERT INTO products (product_name, brand, category, attributes, launch_date, updated_at)
+			VALUES ($1, $2, $3, $4, $5, NOW())
+			ON CONFLICT (product_name) DO UPDATE
+			SET brand = EXCLUDED.brand, category = EXCLUDED.category, attributes = EXCLUDED.attributes,
+				launch_date = EXCLUDED.launch_date, updated_at = EXCLUDED.updated_at
+		`, p.ProductName, p.Brand, p.Category, nullableJSON(p.Attributes), p.LaunchDate)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save product: %w", err)
+	}
+	return nil
+}
+
+// GetProduct returns the catalog entry of a product, or nil if it has none
+func (r *PostgresRepository) GetProduct(productName string) (*Product, error) {
+	var p Product
+	var attributes sql.NullString
+	err := r.queryRow(`SELECT `+productColumns+` FROM products WHERE product_name = $1`, []any{productName},
+		&p.ProductName, &p.Brand, &p.Category, &attributes, &p.LaunchDate, &p.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+	if attributes.Valid {
+		p.Attributes = []byte(attributes.String)
+	}
+	return &p, nil
+}
+
+// DeleteProduct removes the catalog entry of a product and reports whether it existed
+func (r *PostgresRepository) DeleteProduct(productName string) (bool, error) {
+	var deleted int64
+	err := r.retryPolicy.Do(func() error {
+		result, err := r.db.Exec(`DELETE FROM products WHERE product_name = $1`, productName)
+		if err != nil {
+			return err
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete product: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// ListProducts returns a page of catalog entries matching the filter, ordered by name, and the
+// total number of matching entries
+func (r *PostgresRepository) ListProducts(filter ProductFilter, limit, offset int) ([]Product, int, error) {
+	where, args := filter.where()
+
+	var total int
+	if err := r.queryRow(`SELECT COUNT(*) FROM products `+where, args, &total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count products: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM products
+		%s
+		ORDER BY product_name
+		LIMIT $%d OFFSET $%d
+	`, productColumns, where, len(args)+1, len(args)+2)
+
+	rows, err := r.db.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []Product
+	for rows.Next() {
+		var p Product
+		var attributes sql.NullString
+		if err := rows.Scan(&p.ProductName, &p.Brand, &p.Category, &attributes, &p.LaunchDate, &p.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan product: %w", err)
+		}
+		if attributes.Valid {
+			p.Attributes = []byte(attributes.String)
+		}
+		products = append(products, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read products: %w", err)
+	}
+	return products, total, nil
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Promotion is a planned promotion of a product, or of every product in a category when
+// ProductName is empty. StartsOn and EndsOn are inclusive dates
+type Promotion struct {
+	ID                 int64
+	ProductName        string
+	Category           string
+	DiscountPercentage float64
+	StartsOn           time.Time
+	EndsOn             time.Time
+	Description        string
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+// PromotionFilter narrows a promotion listing; empty fields match everything
+type PromotionFilter struct {
+	ProductName string
+	Category    string
+	// From and To select promotions overlapping the dates between them, both inclusive
+	From time.Time
+	To   time.Time
+}
+
+// where builds the WHERE clause and arguments of the filter
+func (f PromotionFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.ProductName != "" {
+		add("product_name = $%d", f.ProductName)
+	}
+	if f.Category != "" {
+		add("category = $%d", f.Category)
+	}
+	if !f.From.IsZero() {
+		add("ends_on >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("starts_on <= $%d", f.To)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
+
+const promotionColumns = `id, product_name, category, discount_percentage, starts_on, ends_on, description, created_at, updated_at`
+
+// CreatePromotion stores a new promotion and returns its ID
+func (r *PostgresRepository) CreatePromotion(p *Promotion) (int64, error) {
+	var id int64
+	err := r.writeRow(`
+		INSERT INTO promotions (product_name, category, discount_percentage, starts_on, ends_on, description)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, []any{p.ProductName, p.Category, p.DiscountPercentage, p.StartsOn, p.EndsOn, p.Description}, &id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create promotion: %w", err)
+	}
+	return id, nil
+}
+
+// GetPromotion returns a promotion by ID, or nil if it does not exist
+func (r *PostgresRepository) GetPromotion(id int64) (*Promotion, error) {
+	var p Promotion
+	err := r.queryRow(`SELECT `+promotionColumns+` FROM promotions WHERE id = $1`, []any{id},
+		&p.ID, &p.ProductName, &p.Category, &p.DiscountPercentage, &p.StartsOn, &p.EndsOn, &p.Description, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get promotion: %w", err)
+	}
+	return &p, nil
+}
+
+// UpdatePromotion replaces a promotion and reports whether it exists
+func (r *PostgresRepository) UpdatePromotion(p *Promotion) (bool, error) {
+	var updated int64
+	err := r.retryPolicy.Do(func() error {
+		result, err := r.db.Exec(`
+			UPDATE promotions
+			SET product_name = $2, category = $3, discount_percentage = $4, starts_on = $5, ends_on = $6,
+				description = $7, updated_at = NOW()
+			WHERE id = $1
+		`, p.ID, p.ProductName, p.Category, p.DiscountPercentage, p.StartsOn, p.EndsOn, p.Description)
+		if err != nil {
+			return err
+		}
+		updated, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update promotion: %w", err)
+	}
+	return updated > 0, nil
+}
+
+// DeletePromotion removes a promotion and reports whether it existed
+func (r *PostgresRepository) DeletePromotion(id int64) (bool, error) {
+	var deleted int64
+	err := r.retryPolicy.Do(func() error {
+		result, err := r.db.Exec(`DELETE FROM promotions WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete promotion: %w", err)
+	}
+	return deleted > 0, nil
+}
+
+// ListPromotions returns a page of promotions matching the filter, ordered by start date, and the
+// total number of matching promotions
+func (r *PostgresRepository) ListPromotions(filter PromotionFilter, limit, offset int) ([]Promotion, int, error) {
+	where, args := filter.where()
+
+	var total int
+	if err := r.queryRow(`SELECT COUNT(*) FROM promotions `+where, args, &total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count promotions: %w", err)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM promotions
+		%s
+		ORDER BY starts_on, id
+		LIMIT $%d OFFSET $%d
+	`, promotionColumns, where, len(args)+1, len(args)+2)
+
+	promotions, err := r.queryPromotions(query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return promotions, total, nil
+}
+
+// PromotionsFor returns the promotions of a product or its category that overlap the dates between
+// from and to, both inclusive
+func (r *PostgresRepository) PromotionsFor(productName, category string, from, to time.Time) ([]Promotion, error) {
+	return r.queryPromotions(`
+		SELECT `+promotionColumns+`
+		FROM promotions
+		WHERE ((product_name <> '' AND product_name = $1) OR (category <> '' AND category = $2))
+			AND ends_on >= $3 AND starts_on <= $4
+		ORDER BY starts_on, id
+	`, productName, category, from, to)
+}
+
+// AllPromotions returns every promotion, ordered by start date
+func (r *PostgresRepository) AllPromotions() ([]Promotion, error) {
+	return r.queryPromotions(`SELECT ` + promotionColumns + ` FROM promotions ORDER BY starts_on, id`)
+}
+
+// queryPromotions runs a query selecting promotionColumns
+func (r *PostgresRepository) queryPromotions(query string, args ...any) ([]Promotion, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list promotions: %w", err)
+	}
+	defer rows.Close()
+
+	var promotions []Promotion
+	for rows.Next() {
+		var p Promotion
+		if err := rows.Scan(&p.ID, &p.ProductName, &p.Category, &p.DiscountPercentage, &p.StartsOn, &p.EndsOn,
+			&p.Description, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan promotion: %w", err)
+		}
+		promotions = append(promotions, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read promotions: %w", err)
+	}
+	return promotions, nil
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+)
+
+// QueueWeight is the consumption weight of a RabbitMQ queue stored in the database, overriding the
+// configured default
+type QueueWeight struct {
+	Queue     string
+	Weight    int
+	UpdatedBy string
+	UpdatedAt time.Time
+}
+
+// ListQueueWeights returns the stored queue weights
+func (r *PostgresRepository) ListQueueWeights() ([]QueueWeight, error) {
+	rows, err := r.db.Query(`
+		SELECT queue, weight, updated_by, updated_at
+		FROM queue_weights
+		ORDER BY queue
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queue weights: %w", err)
+	}
+	defer rows.Close()
+
+	var weights []QueueWeight
+	for rows.Next() {
+		var w QueueWeight
+		if err := rows.Scan(&w.Queue, &w.Weight, &w.UpdatedBy, &w.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan queue weight: %w", err)
+		}
+		weights = append(weights, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read queue weights: %w", err)
+	}
+
+	return weights, nil
+}
+
+// SaveQueueWeight stores the weight of a queue, replacing the previous one
+func (r *PostgresRepository) SaveQueueWeight(w *QueueWeight) error {
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`
+			INSERT INTO queue_weights (queue, weight, updated_by, updated_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (queue) DO UPDATE SET
+				weight = EXCLUDED.weight,
+				updated_by = EXCLUDED.updated_by,
+				updated_at = EXCLUDED.updated_at
+		`, w.Queue, w.Weight, w.UpdatedBy, w.UpdatedAt)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save queue weight: %w", err)
+	}
+	return nil
+}
+
+// DeleteQueueWeight removes the stored weight of a queue and reports whether there was one
+func (r *PostgresRepository) DeleteQueueWeight(queue string) (bool, error) {
+	var deleted bool
+	err := r.retryPolicy.Do(func() error {
+		result, err := r.db.Exec(`DELETE FROM queue_weights WHERE queue = $1`, queue)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		deleted = n > 0
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to delete queue weight: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// StockPosition pairs the latest stored forecast of a product with its current stock
+// and the variability of its recent daily sales
+type StockPosition struct {
+	ProductName    string
+	Region         string
+	Seller         string
+	ForecastAt     time.Time
+	PredictedSales float64
+	StockLevel     float64
+	SalesStdDev    float64
+	ObservedDays   int
+}
+
+// GetStockPositions returns, for each product with a genuine (non what-if) forecast made since
+// the given time, its latest forecast, its latest stock level and the standard deviation of
+// its daily sales over the preceding historyDays
+func (r *PostgresRepository) GetStockPositions(since time.Time, historyDays int) ([]StockPosition, error) {
+	query := `
+		SELECT l.product_name, l.region, l.seller, l.created_at, l.predicted_sales,
+			s.stock_level, h.sales_stddev, h.observed_days
+		FROM (
+			SELECT DISTINCT ON (product_name, region, seller)
+				product_name, region, seller, created_at, predicted_sales
+			FROM prediction_log
+			WHERE created_at >= $1 AND cardinality(overrides) = 0
+			ORDER BY product_name, region, seller, created_at DESC
+		) l
+		CROSS JOIN LATERAL (
+			SELECT p.stock_level, p.date
+			FROM processed_data p
+			WHERE p.product_name = l.product_name AND p.region = l.region AND p.seller = l.seller
+			ORDER BY p.date DESC
+			LIMIT 1
+		) s
+		CROSS JOIN LATERAL (
+			SELECT STDDEV_SAMP(p.sales_quantity) AS sales_stddev, COUNT(*) AS observed_days
+			FROM processed_data p
+			WHERE p.product_name = l.product_name AND p.region = l.region AND p.seller = l.seller
+			AND p.date > s.date - $2::int
+		) h
+	`
+
+	rows, err := r.db.Query(query, since, historyDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stock positions: %w", err)
+	}
+	defer rows.Close()
+
+	var result []StockPosition
+	for rows.Next() {
+		var p StockPosition
+		var stockLevel, stddev sql.NullFloat64
+		if err := rows.Scan(&p.ProductName, &p.Region, &p.Seller, &p.ForecastAt, &p.PredictedSales,
+			&stockLevel, &stddev, &p.ObservedDays); err != nil {
+			return nil, fmt.Errorf("failed to scan stock position: %w", err)
+		}
+		if !stockLevel.Valid {
+			continue
+		}
+		p.StockLevel = stockLevel.Float64
+		p.SalesStdDev = stddev.Float64
+		result = append(result, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stock positions: %w", err)
+	}
+
+	return result, nil
+}
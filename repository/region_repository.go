@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// RegionCategoryStats summarizes the processed data of a category in a region
+type RegionCategoryStats struct {
+	Region string
+	// AvgSales is the average daily sales of a product and seller
+	AvgSales float64
+	Rows     int64
+}
+
+// HasProductInRegion reports whether processed_data has any row of a product in a region
+func (r *PostgresRepository) HasProductInRegion(productName, region string) (bool, error) {
+	var exists bool
+	err := r.queryRow(`SELECT EXISTS (SELECT 1 FROM processed_data WHERE product_name = $1 AND region = $2)`,
+		[]any{productName, region}, &exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check product region: %w", err)
+	}
+	return exists, nil
+}
+
+// GetRegionCategoryStats returns the stats of a category in each of the given regions over the
+// windowDays days of processed data up to its latest date. Regions without data are left out
+func (r *PostgresRepository) GetRegionCategoryStats(category string, regions []string, windowDays int) ([]RegionCategoryStats, error) {
+	query := `
+		WITH latest AS (SELECT MAX(date) AS day FROM processed_data)
+		SELECT p.region, AVG(p.sales_quantity), COUNT(*)
+		FROM processed_data p, latest
+		WHERE p.category = $1 AND p.region = ANY($2) AND p.date > latest.day - $3::INTEGER
+		GROUP BY p.region
+	`
+
+	rows, err := r.db.Query(query, category, pq.Array(regions), windowDays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get region category stats: %w", err)
+	}
+	defer rows.Close()
+
+	var result []RegionCategoryStats
+	for rows.Next() {
+		var s RegionCategoryStats
+		if err := rows.Scan(&s.Region, &s.AvgSales, &s.Rows); err != nil {
+			return nil, fmt.Errorf("failed to scan region category stats: %w", err)
+		}
+		result = append(result, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read region category stats: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+)
+
+// ForecastVersusHistory pairs the latest stored forecast of a product with its recent history
+type ForecastVersusHistory struct {
+	ProductName       string
+	Region            string
+	Seller            string
+	ForecastAt        time.Time
+	PredictedPrice    float64
+	PredictedSales    float64
+	PriceRollingMean7 float64
+	SalesRollingMean7 float64
+}
+
+// GetLatestForecastsWithHistory returns, for each product with a genuine (non what-if) forecast
+// made since the given time, its latest forecast and the 7-day rolling means preceding it
+func (r *PostgresRepository) GetLatestForecastsWithHistory(since time.Time) ([]ForecastVersusHistory, error) {
+	query := `
+		SELECT l.product_name, l.region, l.seller, l.created_at,
+			l.predicted_price, l.predicted_sales, h.mean_price, h.mean_sales
+		FROM (
+			SELECT DISTINCT ON (product_name, region, seller)
+				product_name, region, seller, created_at, predicted_price, predicted_sales,
+				COALESCE(prediction_date, created_at::date) AS reference_date
+			FROM prediction_log
+			WHERE created_at >= $1 AND cardinality(overrides) = 0
+			ORDER BY product_name, region, seller, created_at DESC
+		) l
+		CROSS JOIN LATERAL (
+			SELECT AVG(p.price) AS mean_price, AVG(p.sales_quantity) AS mean_sales
+			FROM processed_data p
+			WHERE p.product_name = l.product_name AND p.region = l.region AND p.seller = l.seller
+			AND p.date BETWEEN l.reference_date - 6 AND l.reference_date
+		) h
+		WHERE h.mean_price IS NOT NULL AND h.mean_sales IS NOT NULL
+	`
+
+	rows, err := r.db.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest forecasts: %w", err)
+	}
+	defer rows.Close()
+
+	var result []ForecastVersusHistory
+	for rows.Next() {
+		var f ForecastVersusHistory
+		if err := rows.Scan(&f.ProductName, &f.Region, &f.Seller, &f.ForecastAt,
+			&f.PredictedPrice, &f.PredictedSales, &f.PriceRollingMean7, &f.SalesRollingMean7); err != nil {
+			return nil, fmt.Errorf("failed to scan forecast: %w", err)
+		}
+		result = append(result, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read forecasts: %w", err)
+	}
+
+	return result, nil
+}
+
+// categoryProducts selects the products of the category given as $1: that of their catalog entry,
+// or of their history otherwise
+const categoryProducts = `
+	SELECT DISTINCT p.product_name
+	FROM processed_data p
+	LEFT JOIN products c ON c.product_name = p.product_name
+	WHERE COALESCE(NULLIF(c.category, ''), p.category) = $1
+`
+
+// GetCategorySeries returns the daily mean price and total sales of the products of a category
+// between two dates inclusive, ordered by date
+func (r *PostgresRepository) GetCategorySeries(category string, from, to time.Time) ([]SeriesPoint, error) {
+	rows, err := r.db.Query(`
+		SELECT date, AVG(price), SUM(sales_quantity)
+		FROM processed_data
+		WHERE product_name IN (`+categoryProducts+`) AND date BETWEEN $2 AND $3
+		GROUP BY date
+		ORDER BY date
+	`, category, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category series: %w", err)
+	}
+	defer rows.Close()
+
+	var series []SeriesPoint
+	for rows.Next() {
+		var point SeriesPoint
+		if err := rows.Scan(&point.Date, &point.Price, &point.Sales); err != nil {
+			return nil, fmt.Errorf("failed to scan category series: %w", err)
+		}
+		series = append(series, point)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read category series: %w", err)
+	}
+	return series, nil
+}
+
+// GetCategoryForecasts sums the latest forecast of every product, region and seller of a category
+// per target date in [from, to], ordered by date. Prices are averaged. Actuals are only set on the
+// dates where every forecast has them
+func (r *PostgresRepository) GetCategoryForecasts(category string, from, to time.Time) ([]Forecast, error) {
+	rows, err := r.db.Query(`
+		SELECT forecast_date, MAX(horizon_days), AVG(predicted_price), SUM(predicted_sales),
+			CASE WHEN COUNT(actual_price) = COUNT(*) THEN AVG(actual_price) END,
+			CASE WHEN COUNT(actual_sales) = COUNT(*) THEN SUM(actual_sales) END
+		FROM (
+			SELECT DISTINCT ON (product_name, region, seller, forecast_date)
+				forecast_date, horizon_days, predicted_price, predicted_sales, actual_price, actual_sales
+			FROM forecasts
+			WHERE product_name IN (`+categoryProducts+`) AND forecast_date BETWEEN $2 AND $3
+			ORDER BY product_name, region, seller, forecast_date, created_at DESC, id DESC
+		) latest
+		GROUP BY forecast_date
+		ORDER BY forecast_date
+	`, category, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category forecasts: %w", err)
+	}
+	defer rows.Close()
+
+	var forecasts []Forecast
+	for rows.Next() {
+		var f Forecast
+		if err := rows.Scan(&f.ForecastDate, &f.HorizonDays, &f.PredictedPrice, &f.PredictedSales,
+			&f.ActualPrice, &f.ActualSales); err != nil {
+			return nil, fmt.Errorf("failed to scan category forecast: %w", err)
+		}
+		forecasts = append(forecasts, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read category forecasts: %w", err)
+	}
+	return forecasts, nil
+}
@@ -0,0 +1,16 @@
+package repository
+
+import "time"
+
+// ResourceUsage describes the resources consumed by a finished child process
+type ResourceUsage struct {
+	WallTime     time.Duration
+	UserCPU      time.Duration
+	SystemCPU    time.Duration
+	PeakRSSBytes int64
+}
+
+// CPUTime returns the total user and system CPU time
+func (u ResourceUsage) CPUTime() time.Duration {
+	return u.UserCPU + u.SystemCPU
+}
@@ -0,0 +1,22 @@
+//go:build linux
+
+package repository
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// fillProcessUsage copies the rusage reported by wait4 into the usage
+func fillProcessUsage(usage *ResourceUsage, state *os.ProcessState) {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || rusage == nil {
+		return
+	}
+
+	usage.UserCPU = time.Duration(rusage.Utime.Nano())
+	usage.SystemCPU = time.Duration(rusage.Stime.Nano())
+	// ru_maxrss is reported in kilobytes on Linux
+	usage.PeakRSSBytes = rusage.Maxrss * 1024
+}
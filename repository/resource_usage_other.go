@@ -0,0 +1,12 @@
+//go:build !linux
+
+package repository
+
+import "os"
+
+// fillProcessUsage copies the CPU times reported by the OS into the usage.
+// Peak RSS is only collected on Linux.
+func fillProcessUsage(usage *ResourceUsage, state *os.ProcessState) {
+	usage.UserCPU = state.UserTime()
+	usage.SystemCPU = state.SystemTime()
+}
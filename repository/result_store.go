@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrResultNotFound is returned when a result file does not exist in the store
+var ErrResultNotFound = errors.New("result file not found")
+
+// ResultStore stores job output files in storage shared by all replicas
+type ResultStore interface {
+	// Put stores data under the given key, replacing an existing file
+	Put(key string, data []byte) error
+	// Get returns the data stored under the given key
+	Get(key string) ([]byte, error)
+}
+
+// FileResultStore is a ResultStore backed by a directory on a shared volume. Keys are slash-separated
+// relative paths. With a cipher, results are encrypted in the store and decrypted on read
+type FileResultStore struct {
+	basePath string
+	cipher   *ArtifactCipher
+}
+
+// NewFileResultStore creates a new FileResultStore instance; cipher may be nil to store results as-is
+func NewFileResultStore(basePath string, cipher *ArtifactCipher) (*FileResultStore, error) {
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create result store directory: %v", err)
+	}
+
+	return &FileResultStore{
+		basePath: basePath,
+		cipher:   cipher,
+	}, nil
+}
+
+// Put stores data under the given key, replacing an existing file
+func (s *FileResultStore) Put(key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create result directory: %v", err)
+	}
+
+	if s.cipher != nil {
+		if data, err = s.cipher.Seal(key, data); err != nil {
+			return fmt.Errorf("failed to encrypt result %s: %v", key, err)
+		}
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write result %s: %v", key, err)
+	}
+	return nil
+}
+
+// Get returns the data stored under the given key
+func (s *FileResultStore) Get(key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrResultNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read result %s: %v", key, err)
+	}
+
+	if s.cipher != nil {
+		return s.cipher.Open(key, data)
+	}
+	if IsEncryptedArtifact(data) {
+		return nil, fmt.Errorf("result %s is encrypted but no encryption key is configured", key)
+	}
+	return data, nil
+}
+
+// path maps a key to its file, refusing keys that would escape the store directory
+func (s *FileResultStore) path(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid result key %q", key)
+	}
+	return filepath.Join(s.basePath, cleaned), nil
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RetryPolicy controls how transient database errors are retried
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// retryablePgCodes lists PostgreSQL error codes that indicate a transient failure
+var retryablePgCodes = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// unsentPgCodes lists PostgreSQL error codes raised before a statement ran, or once its transaction
+// was rolled back, so that running it again can't apply it twice
+var unsentPgCodes = map[pq.ErrorCode]bool{
+	"08001": true, // sqlclient_unable_to_establish_sqlconnection
+	"08004": true, // sqlserver_rejected_establishment_of_sqlconnection
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P03": true, // cannot_connect_now
+}
+
+// IsRetryableError reports whether err is a transient database error worth retrying
+func IsRetryableError(err error) bool {
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// Class 08 - connection exceptions
+		if pqErr.Code.Class() == "08" {
+			return true
+		}
+		return retryablePgCodes[pqErr.Code]
+	}
+
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isUnsentError reports whether err is a transient database error known to have happened before a
+// statement was applied: the connection could not be established, or the transaction was rolled
+// back. Other connection errors, such as a reset while the result was awaited, leave it unknown
+// whether a write was applied
+func isUnsentError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return unsentPgCodes[pqErr.Code]
+	}
+	// database/sql and the driver only report a bad connection before anything was sent on it
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// IsPermanentError reports whether err is a database error that will not go away on retry
+func IsPermanentError(err error) bool {
+	return err != nil && !errors.Is(err, sql.ErrNoRows) && !IsRetryableError(err)
+}
+
+// backoff returns the delay before the given retry attempt using exponential backoff with full jitter
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.InitialBackoff << uint(attempt)
+	if delay <= 0 || delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// Do runs fn until it succeeds, fails with a non-retryable error, or attempts are exhausted. fn must
+// be safe to run more than once, such as a read or an idempotent write
+func (p RetryPolicy) Do(fn func() error) error {
+	return p.retry(fn, IsRetryableError)
+}
+
+// DoWrite runs a write that is not idempotent, such as an INSERT or an increment, like Do, but only
+// retries errors raised before the write was applied, so that it is never applied twice. Its other
+// failures are returned at once, since the write may have been applied despite them
+func (p RetryPolicy) DoWrite(fn func() error) error {
+	return p.retry(fn, isUnsentError)
+}
+
+// retry runs fn until it succeeds, fails with an error retryable does not accept, or attempts are
+// exhausted
+func (p RetryPolicy) retry(fn func() error, retryable func(error) bool) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.backoff(attempt - 1))
+		}
+		if err = fn(); err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
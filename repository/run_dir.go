@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// runDirPrefix names the private directories of Python runs
+const runDirPrefix = "python-run-"
+
+// CreateRunDir creates a private temporary directory for the working files of one Python run, so
+// that concurrent trainings and predictions never share an input or output file
+func (r *FileRepository) CreateRunDir() (string, error) {
+	dir, err := os.MkdirTemp("", runDirPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create run directory: %v", err)
+	}
+	return dir, nil
+}
+
+// RemoveRunDir deletes a run directory and everything in it
+func (r *FileRepository) RemoveRunDir(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove run directory: %v", err)
+	}
+	return nil
+}
+
+// CopyToRunDir copies a file into a run directory under its own name and returns the copy's path
+func (r *FileRepository) CopyToRunDir(dir, path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer src.Close()
+
+	target := filepath.Join(dir, filepath.Base(path))
+	dst, err := os.Create(target)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", target, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", fmt.Errorf("failed to copy %s: %v", path, err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("failed to copy %s: %v", path, err)
+	}
+	return target, nil
+}
+
+// datasetLabel is the label a training dataset is encrypted under. Datasets are looked up by file
+// name in the processed data directory, so the label is that name
+func datasetLabel(path string) string {
+	return "dataset/" + filepath.Base(path)
+}
+
+// CopyDatasetToRunDir copies a training dataset into a run directory under its own name, like
+// CopyToRunDir, and returns the copy's path. With a dataset cipher the dataset must be encrypted,
+// and the copy is decrypted for the Python script; without one an encrypted dataset is rejected
+func (r *FileRepository) CopyDatasetToRunDir(dir, path string) (string, error) {
+	if r.datasetCipher == nil {
+		encrypted, err := isEncryptedFile(path)
+		if err != nil {
+			return "", err
+		}
+		if encrypted {
+			return "", fmt.Errorf("dataset %s is encrypted, but no encryption key is set", path)
+		}
+		return r.CopyToRunDir(dir, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	plaintext, err := r.datasetCipher.Open(datasetLabel(path), data)
+	if err != nil {
+		return "", fmt.Errorf("failed to read dataset: %w", err)
+	}
+
+	target := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(target, plaintext, 0600); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", target, err)
+	}
+	return target, nil
+}
+
+// EncryptDatasetFile encrypts the training dataset at path in place with cipher, for data
+// processors that don't encrypt their output themselves. A dataset that is already encrypted is
+// left as it is
+func EncryptDatasetFile(cipher *ArtifactCipher, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if IsEncryptedArtifact(data) {
+		return nil
+	}
+	sealed, err := cipher.Seal(datasetLabel(path), data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", path, err)
+	}
+
+	// Replace the dataset atomically, so that a training run never reads a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(sealed); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encrypt %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to encrypt %s: %v", path, err)
+	}
+	return nil
+}
+
+// isEncryptedFile reports whether the file at path starts like an encrypted artifact
+func isEncryptedFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	header := make([]byte, len(artifactCipherMagic))
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return IsEncryptedArtifact(header[:n]), nil
+}
@@ -0,0 +1,373 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+)
+
+// schemaStatements creates the tables owned by this service.
+// The processed_data table is owned by the data processor service and is not created here.
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS model_versions (
+		version              TEXT PRIMARY KEY,
+		created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		is_active            BOOLEAN NOT NULL DEFAULT FALSE,
+		price_best_iteration INTEGER NOT NULL DEFAULT 0,
+		price_best_score     DOUBLE PRECISION NOT NULL DEFAULT 0,
+		sales_best_iteration INTEGER NOT NULL DEFAULT 0,
+		sales_best_score     DOUBLE PRECISION NOT NULL DEFAULT 0
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS model_versions_single_active
+		ON model_versions (is_active) WHERE is_active`,
+	`ALTER TABLE model_versions ADD COLUMN IF NOT EXISTS price_mae DOUBLE PRECISION NOT NULL DEFAULT 0`,
+	`ALTER TABLE model_versions ADD COLUMN IF NOT EXISTS sales_mae DOUBLE PRECISION NOT NULL DEFAULT 0`,
+	`ALTER TABLE model_versions ADD COLUMN IF NOT EXISTS price_baseline_mae JSONB`,
+	`ALTER TABLE model_versions ADD COLUMN IF NOT EXISTS sales_baseline_mae JSONB`,
+	`ALTER TABLE model_versions ADD COLUMN IF NOT EXISTS promotion_blocked TEXT[] NOT NULL DEFAULT '{}'`,
+	`CREATE INDEX IF NOT EXISTS model_versions_created_at_idx ON model_versions (created_at)`,
+	`ALTER TABLE model_versions ADD COLUMN IF NOT EXISTS is_standby BOOLEAN NOT NULL DEFAULT FALSE`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS model_versions_single_standby
+		ON model_versions (is_standby) WHERE is_standby`,
+	`CREATE TABLE IF NOT EXISTS prediction_log (
+		id              BIGSERIAL PRIMARY KEY,
+		created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		product_name    TEXT NOT NULL,
+		region          TEXT NOT NULL,
+		seller          TEXT NOT NULL,
+		prediction_date DATE,
+		features        JSONB NOT NULL,
+		overrides       TEXT[] NOT NULL DEFAULT '{}',
+		predicted_price DOUBLE PRECISION NOT NULL,
+		predicted_sales DOUBLE PRECISION NOT NULL,
+		model_version   TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS prediction_log_product_idx
+		ON prediction_log (product_name, region, seller, created_at)`,
+	`CREATE TABLE IF NOT EXISTS shadow_predictions (
+		id              BIGSERIAL PRIMARY KEY,
+		created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		model_version   TEXT NOT NULL,
+		active_version  TEXT NOT NULL,
+		prediction_id   BIGINT,
+		active_price    DOUBLE PRECISION NOT NULL,
+		active_sales    DOUBLE PRECISION NOT NULL,
+		shadow_price    DOUBLE PRECISION,
+		shadow_sales    DOUBLE PRECISION,
+		error           TEXT,
+		duration_ms     BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS shadow_predictions_version_idx
+		ON shadow_predictions (model_version, created_at)`,
+	`CREATE TABLE IF NOT EXISTS golden_outputs (
+		model_version   TEXT NOT NULL,
+		case_name       TEXT NOT NULL,
+		case_hash       TEXT NOT NULL,
+		predicted_price DOUBLE PRECISION NOT NULL,
+		predicted_sales DOUBLE PRECISION NOT NULL,
+		engine          TEXT NOT NULL,
+		recorded_by     TEXT NOT NULL,
+		created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (model_version, case_name, case_hash)
+	)`,
+	`CREATE TABLE IF NOT EXISTS simulations (
+		id             BIGSERIAL PRIMARY KEY,
+		status         TEXT NOT NULL,
+		request        JSONB NOT NULL,
+		scenario_count INTEGER NOT NULL,
+		error          TEXT,
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		completed_at   TIMESTAMPTZ
+	)`,
+	`CREATE TABLE IF NOT EXISTS simulation_results (
+		simulation_id       BIGINT NOT NULL REFERENCES simulations (id) ON DELETE CASCADE,
+		product_name        TEXT NOT NULL,
+		region              TEXT NOT NULL,
+		seller              TEXT NOT NULL,
+		date                DATE NOT NULL,
+		price               DOUBLE PRECISION NOT NULL,
+		discount_percentage DOUBLE PRECISION NOT NULL,
+		stock_level         DOUBLE PRECISION NOT NULL,
+		predicted_price     DOUBLE PRECISION NOT NULL,
+		predicted_sales     DOUBLE PRECISION NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS simulation_results_simulation_idx
+		ON simulation_results (simulation_id)`,
+	`CREATE TABLE IF NOT EXISTS training_runs (
+		id            BIGSERIAL PRIMARY KEY,
+		started_at    TIMESTAMPTZ NOT NULL,
+		finished_at   TIMESTAMPTZ NOT NULL,
+		duration_ms   BIGINT NOT NULL,
+		status        TEXT NOT NULL,
+		version       TEXT NOT NULL DEFAULT '',
+		metrics       JSONB,
+		dataset_hash  TEXT NOT NULL DEFAULT '',
+		parameters    JSONB,
+		python_output TEXT NOT NULL DEFAULT '',
+		error         TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS training_runs_started_at_idx ON training_runs (started_at)`,
+	`ALTER TABLE training_runs ADD COLUMN IF NOT EXISTS learning_curve JSONB`,
+	`ALTER TABLE training_runs ADD COLUMN IF NOT EXISTS wall_time_ms BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE training_runs ADD COLUMN IF NOT EXISTS cpu_time_ms BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE training_runs ADD COLUMN IF NOT EXISTS peak_rss_bytes BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE training_runs ADD COLUMN IF NOT EXISTS dataset_rows BIGINT NOT NULL DEFAULT 0`,
+	// Training requested with async=true, queued until a worker claims it
+	`CREATE TABLE IF NOT EXISTS training_jobs (
+		id           BIGSERIAL PRIMARY KEY,
+		status       TEXT NOT NULL,
+		stage        TEXT NOT NULL DEFAULT '',
+		sample       JSONB,
+		requested_by TEXT NOT NULL DEFAULT '',
+		replica      TEXT NOT NULL DEFAULT '',
+		attempts     INTEGER NOT NULL DEFAULT 0,
+		result       JSONB,
+		error        TEXT NOT NULL DEFAULT '',
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		started_at   TIMESTAMPTZ,
+		heartbeat_at TIMESTAMPTZ,
+		finished_at  TIMESTAMPTZ
+	)`,
+	`CREATE INDEX IF NOT EXISTS training_jobs_pending_idx ON training_jobs (id) WHERE status IN ('queued', 'running')`,
+	`CREATE TABLE IF NOT EXISTS forecasts (
+		id                 BIGSERIAL PRIMARY KEY,
+		created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		product_name       TEXT NOT NULL,
+		region             TEXT NOT NULL,
+		seller             TEXT NOT NULL,
+		forecast_date      DATE NOT NULL,
+		horizon_days       INTEGER NOT NULL,
+		predicted_price    DOUBLE PRECISION NOT NULL,
+		predicted_sales    DOUBLE PRECISION NOT NULL,
+		model_version      TEXT NOT NULL DEFAULT '',
+		actual_price       DOUBLE PRECISION,
+		actual_sales       DOUBLE PRECISION,
+		actuals_updated_at TIMESTAMPTZ
+	)`,
+	`CREATE INDEX IF NOT EXISTS forecasts_product_date_idx
+		ON forecasts (product_name, region, seller, forecast_date)`,
+	`CREATE INDEX IF NOT EXISTS forecasts_pending_actuals_idx
+		ON forecasts (forecast_date) WHERE actual_sales IS NULL`,
+	// Forecasts are unique per key, target date and model version; older duplicates are dropped
+	// before the unique index is built
+	`DELETE FROM forecasts f USING forecasts d
+		WHERE f.product_name = d.product_name AND f.region = d.region AND f.seller = d.seller
+			AND f.forecast_date = d.forecast_date AND f.model_version = d.model_version AND f.id < d.id`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS forecasts_key_idx
+		ON forecasts (product_name, region, seller, forecast_date, model_version)`,
+	`DROP INDEX IF EXISTS forecasts_product_date_idx`,
+	`CREATE TABLE IF NOT EXISTS jobs (
+		id           BIGSERIAL PRIMARY KEY,
+		job_type     TEXT NOT NULL,
+		params       JSONB,
+		started_at   TIMESTAMPTZ NOT NULL,
+		finished_at  TIMESTAMPTZ,
+		status       TEXT NOT NULL,
+		error        TEXT,
+		triggered_by TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS jobs_started_at_idx ON jobs (started_at)`,
+	`CREATE INDEX IF NOT EXISTS jobs_type_started_at_idx ON jobs (job_type, started_at)`,
+	`CREATE TABLE IF NOT EXISTS job_leases (
+		job_type     TEXT PRIMARY KEY,
+		scheduled_at TIMESTAMPTZ NOT NULL,
+		replica      TEXT NOT NULL,
+		claimed_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id          BIGSERIAL PRIMARY KEY,
+		action      TEXT NOT NULL,
+		caller      TEXT NOT NULL,
+		remote_addr TEXT NOT NULL,
+		method      TEXT NOT NULL,
+		path        TEXT NOT NULL,
+		params      JSONB,
+		status_code INTEGER NOT NULL,
+		outcome     TEXT NOT NULL,
+		error       TEXT,
+		created_at  TIMESTAMPTZ NOT NULL,
+		duration_ms BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_action_created_at_idx ON audit_log (action, created_at)`,
+	`CREATE TABLE IF NOT EXISTS batch_predictions (
+		id                BIGSERIAL PRIMARY KEY,
+		status            TEXT NOT NULL,
+		item_count        INTEGER NOT NULL,
+		callback_url      TEXT NOT NULL,
+		succeeded         INTEGER NOT NULL DEFAULT 0,
+		failed            INTEGER NOT NULL DEFAULT 0,
+		results           JSONB,
+		error             TEXT,
+		callback_status   TEXT NOT NULL,
+		callback_attempts INTEGER NOT NULL DEFAULT 0,
+		callback_error    TEXT,
+		created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		completed_at      TIMESTAMPTZ
+	)`,
+	`ALTER TABLE simulations ADD COLUMN IF NOT EXISTS results_key TEXT`,
+	`ALTER TABLE batch_predictions ADD COLUMN IF NOT EXISTS results_key TEXT`,
+	`CREATE TABLE IF NOT EXISTS feature_flags (
+		name       TEXT PRIMARY KEY,
+		enabled    BOOLEAN NOT NULL,
+		percentage INTEGER NOT NULL DEFAULT 100,
+		clients    TEXT[] NOT NULL DEFAULT '{}',
+		updated_by TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS queue_weights (
+		queue      TEXT PRIMARY KEY,
+		weight     INTEGER NOT NULL,
+		updated_by TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	// Producers that cannot publish to RabbitMQ reliably write their messages here in the transaction
+	// of the change the message describes
+	`CREATE TABLE IF NOT EXISTS ingestion_outbox (
+		id           BIGSERIAL PRIMARY KEY,
+		topic        TEXT NOT NULL,
+		producer     TEXT NOT NULL DEFAULT '',
+		payload      JSONB NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		processed_at TIMESTAMPTZ,
+		attempts     INTEGER NOT NULL DEFAULT 0,
+		last_error   TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS ingestion_outbox_pending_idx ON ingestion_outbox (id) WHERE processed_at IS NULL`,
+	`CREATE TABLE IF NOT EXISTS events (
+		id            BIGSERIAL PRIMARY KEY,
+		type          TEXT NOT NULL,
+		model_version TEXT NOT NULL DEFAULT '',
+		details       JSONB,
+		created_at    TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS events_created_at_idx ON events (created_at)`,
+	`CREATE INDEX IF NOT EXISTS events_type_created_at_idx ON events (type, created_at)`,
+	`CREATE TABLE IF NOT EXISTS promotions (
+		id                  BIGSERIAL PRIMARY KEY,
+		product_name        TEXT NOT NULL DEFAULT '',
+		category            TEXT NOT NULL DEFAULT '',
+		discount_percentage DOUBLE PRECISION NOT NULL,
+		starts_on           DATE NOT NULL,
+		ends_on             DATE NOT NULL,
+		description         TEXT NOT NULL DEFAULT '',
+		created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		updated_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		CHECK (product_name <> '' OR category <> ''),
+		CHECK (ends_on >= starts_on)
+	)`,
+	`CREATE INDEX IF NOT EXISTS promotions_dates_idx ON promotions (ends_on, starts_on)`,
+	`CREATE TABLE IF NOT EXISTS products (
+		product_name TEXT PRIMARY KEY,
+		brand        TEXT NOT NULL DEFAULT '',
+		category     TEXT NOT NULL DEFAULT '',
+		attributes   JSONB,
+		launch_date  DATE,
+		updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS products_category_idx ON products (category)`,
+	`CREATE TABLE IF NOT EXISTS seller_stats (
+		seller            TEXT PRIMARY KEY,
+		avg_delivery_days DOUBLE PRECISION NOT NULL,
+		cancellation_rate DOUBLE PRECISION,
+		rating_trend      DOUBLE PRECISION NOT NULL DEFAULT 0,
+		row_count         BIGINT NOT NULL,
+		window_end        DATE NOT NULL,
+		refreshed_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS backtest_runs (
+		id               BIGSERIAL PRIMARY KEY,
+		started_at       TIMESTAMPTZ NOT NULL,
+		finished_at      TIMESTAMPTZ NOT NULL,
+		model_version    TEXT NOT NULL DEFAULT '',
+		origins          INTEGER NOT NULL,
+		cases            INTEGER NOT NULL,
+		horizon_days     INTEGER NOT NULL,
+		price_metrics    JSONB,
+		sales_metrics    JSONB,
+		baseline_metrics JSONB,
+		alert_metric     TEXT NOT NULL,
+		alert_value      DOUBLE PRECISION,
+		alert_baseline   DOUBLE PRECISION,
+		degraded         BOOLEAN NOT NULL DEFAULT FALSE
+	)`,
+	`CREATE INDEX IF NOT EXISTS backtest_runs_started_at_idx ON backtest_runs (started_at)`,
+	`CREATE TABLE IF NOT EXISTS api_usage (
+		bucket          TIMESTAMPTZ NOT NULL,
+		client          TEXT NOT NULL,
+		method          TEXT NOT NULL,
+		route           TEXT NOT NULL,
+		requests        BIGINT NOT NULL,
+		client_errors   BIGINT NOT NULL,
+		server_errors   BIGINT NOT NULL,
+		duration_ms     DOUBLE PRECISION NOT NULL,
+		max_duration_ms DOUBLE PRECISION NOT NULL,
+		request_bytes   BIGINT NOT NULL,
+		response_bytes  BIGINT NOT NULL,
+		PRIMARY KEY (bucket, client, method, route)
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_usage_daily (
+		day             DATE NOT NULL,
+		client          TEXT NOT NULL,
+		method          TEXT NOT NULL,
+		route           TEXT NOT NULL,
+		requests        BIGINT NOT NULL,
+		client_errors   BIGINT NOT NULL,
+		server_errors   BIGINT NOT NULL,
+		duration_ms     DOUBLE PRECISION NOT NULL,
+		max_duration_ms DOUBLE PRECISION NOT NULL,
+		request_bytes   BIGINT NOT NULL,
+		response_bytes  BIGINT NOT NULL,
+		PRIMARY KEY (day, client, method, route)
+	)`,
+}
+
+// requiredTables lists the tables the service cannot run without
+var requiredTables = []string{
+	"model_versions", "prediction_log", "simulations", "simulation_results", "training_runs", "forecasts", "jobs",
+	"audit_log", "batch_predictions", "feature_flags", "queue_weights", "events", "promotions", "products",
+	"seller_stats", "api_usage", "api_usage_daily", "shadow_predictions", "golden_outputs",
+	"training_jobs", "job_leases",
+}
+
+// MissingTables returns the tables among the given ones that do not exist in the database
+func (r *PostgresRepository) MissingTables(tables ...string) ([]string, error) {
+	var missing []string
+	for _, table := range tables {
+		var exists bool
+		if err := r.queryRow(`SELECT to_regclass($1) IS NOT NULL`, []any{table}, &exists); err != nil {
+			return nil, fmt.Errorf("failed to check table %s: %w", table, err)
+		}
+		if !exists {
+			missing = append(missing, table)
+		}
+	}
+	return missing, nil
+}
+
+// VerifySchema checks that every table the service writes to exists, so that a schema that could
+// not be applied fails at startup instead of on the first write
+func (r *PostgresRepository) VerifySchema() error {
+	missing, err := r.MissingTables(requiredTables...)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("database schema is incomplete, missing tables: %s; apply the statements in repository/schema.go",
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// EnsureSchema creates the service's tables if they do not exist yet
+func (r *PostgresRepository) EnsureSchema() error {
+	for _, statement := range schemaStatements {
+		err := r.retryPolicy.Do(func() error {
+			_, err := r.db.Exec(statement)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply schema: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxScriptLogLine bounds a single stderr line forwarded from a Python script; after a longer line
+// the rest of the stream is captured without being logged
+const maxScriptLogLine = 1 << 20
+
+// scriptLogPrefixes map the prefixes Python scripts and their libraries put on stderr lines to log
+// levels. Lines without a known prefix are logged at info level
+var scriptLogPrefixes = []struct {
+	prefix string
+	level  zapcore.Level
+}{
+	{"ОШИБКА", zapcore.ErrorLevel},
+	{"ERROR", zapcore.ErrorLevel},
+	{"CRITICAL", zapcore.ErrorLevel},
+	{"Traceback", zapcore.ErrorLevel},
+	{"[LightGBM] [Fatal]", zapcore.ErrorLevel},
+	{"WARNING", zapcore.WarnLevel},
+	{"WARN", zapcore.WarnLevel},
+	{"[LightGBM] [Warning]", zapcore.WarnLevel},
+	{"INFO", zapcore.InfoLevel},
+	{"[LightGBM] [Info]", zapcore.InfoLevel},
+	{"DEBUG", zapcore.DebugLevel},
+	{"[LightGBM] [Debug]", zapcore.DebugLevel},
+}
+
+// scriptLogLevel returns the log level of a stderr line and the line without its level prefix.
+// Python warnings ("file.py:12: UserWarning: ...") are logged as warnings
+func scriptLogLevel(line string) (zapcore.Level, string) {
+	trimmed := strings.TrimSpace(line)
+	for _, p := range scriptLogPrefixes {
+		if !strings.HasPrefix(trimmed, p.prefix) {
+			continue
+		}
+		message := strings.TrimSpace(strings.TrimPrefix(trimmed, p.prefix))
+		message = strings.TrimSpace(strings.TrimPrefix(message, ":"))
+		if p.prefix == "Traceback" || message == "" {
+			message = trimmed
+		}
+		return p.level, message
+	}
+	if strings.Contains(trimmed, "Warning: ") {
+		return zapcore.WarnLevel, trimmed
+	}
+	return zapcore.InfoLevel, trimmed
+}
+
+// forwardScriptLog logs every line read from a script's stderr as it arrives and returns
+// everything read once the stream is closed
+func forwardScriptLog(stderr io.Reader, logger *zap.SugaredLogger) string {
+	var captured strings.Builder
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxScriptLogLine)
+	for scanner.Scan() {
+		line := scanner.Text()
+		captured.WriteString(line)
+		captured.WriteByte('\n')
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		level, message := scriptLogLevel(line)
+		logger.Logw(level, message)
+	}
+	// Drain whatever is left after an error, so that the script never blocks on a full pipe
+	if rest, _ := io.ReadAll(stderr); len(rest) > 0 {
+		captured.Write(rest)
+	}
+	return captured.String()
+}
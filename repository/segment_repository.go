@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SegmentVolume summarizes the processed data of one category/region segment
+type SegmentVolume struct {
+	Category  string
+	Region    string
+	Rows      int64
+	Products  int64
+	RowsSince int64
+	LastDate  time.Time
+}
+
+// GetSegmentVolumes returns the data volume of every category/region segment in processed_data,
+// largest first. RowsSince counts the rows dated after since, a zero since counts every row.
+func (r *PostgresRepository) GetSegmentVolumes(since time.Time) ([]SegmentVolume, error) {
+	query := `
+		SELECT category, region, COUNT(*),
+			COUNT(DISTINCT (product_name, seller)),
+			COUNT(*) FILTER (WHERE date > $1),
+			MAX(date)
+		FROM processed_data
+		GROUP BY category, region
+		ORDER BY COUNT(*) DESC, category, region
+	`
+
+	rows, err := r.db.Query(query, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get segment volumes: %w", err)
+	}
+	defer rows.Close()
+
+	var result []SegmentVolume
+	for rows.Next() {
+		var v SegmentVolume
+		var category, region sql.NullString
+		if err := rows.Scan(&category, &region, &v.Rows, &v.Products, &v.RowsSince, &v.LastDate); err != nil {
+			return nil, fmt.Errorf("failed to scan segment volume: %w", err)
+		}
+		v.Category = category.String
+		v.Region = region.String
+		result = append(result, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read segment volumes: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SellerStats are the reliability aggregates of a seller over the latest window of processed data
+type SellerStats struct {
+	Seller          string
+	AvgDeliveryDays float64
+	// CancellationRate is only known when processed_data carries cancelled quantities
+	CancellationRate sql.NullFloat64
+	// RatingTrend is the average customer rating of the second half of the window minus that of
+	// the first half
+	RatingTrend float64
+	RowCount    int64
+	WindowEnd   time.Time
+	RefreshedAt time.Time
+}
+
+const sellerStatsColumns = `seller, avg_delivery_days, cancellation_rate, rating_trend, row_count, window_end, refreshed_at`
+
+// sellerStatsFields returns the scan destinations of sellerStatsColumns
+func sellerStatsFields(s *SellerStats) []any {
+	return []any{&s.Seller, &s.AvgDeliveryDays, &s.CancellationRate, &s.RatingTrend, &s.RowCount, &s.WindowEnd,
+		&s.RefreshedAt}
+}
+
+// RefreshSellerStats recomputes the stats of every seller from the windowDays days of processed
+// data up to its latest date, replacing those of the previous refresh. The cancellation rate is
+// computed when processed_data has a cancelled_quantity column and left NULL otherwise. It returns
+// the number of sellers
+func (r *PostgresRepository) RefreshSellerStats(windowDays int) (int64, error) {
+	var cancellations bool
+	err := r.queryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'processed_data'
+				AND column_name = 'cancelled_quantity'
+		)
+	`, nil, &cancellations)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect processed data columns: %w", err)
+	}
+
+	cancellationRate := `NULL::DOUBLE PRECISION`
+	if cancellations {
+		cancellationRate = `SUM(cancelled_quantity)::DOUBLE PRECISION
+			/ NULLIF(SUM(sales_quantity) + SUM(cancelled_quantity), 0)`
+	}
+
+	// Halving the window splits it into the two periods whose average ratings make up the trend
+	query := fmt.Sprintf(`
+		WITH latest AS (SELECT MAX(date) AS day FROM processed_data),
+		windowed AS (
+			SELECT p.*, latest.day AS window_end
+			FROM processed_data p, latest
+			WHERE p.date > latest.day - $1::INTEGER
+		)
+		INSERT INTO seller_stats (%s)
+		SELECT seller,
+			COALESCE(AVG(delivery_days), 0),
+			%s,
+			COALESCE(AVG(customer_rating) FILTER (WHERE date > window_end - $1::INTEGER / 2)
+				- AVG(customer_rating) FILTER (WHERE date <= window_end - $1::INTEGER / 2), 0),
+			COUNT(*),
+			MAX(window_end),
+			NOW()
+		FROM windowed
+		GROUP BY seller
+	`, sellerStatsColumns, cancellationRate)
+
+	var sellers int64
+	err = r.retryPolicy.Do(func() error {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(`DELETE FROM seller_stats`); err != nil {
+			return err
+		}
+		result, err := tx.Exec(query, windowDays)
+		if err != nil {
+			return err
+		}
+		if sellers, err = result.RowsAffected(); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to refresh seller stats: %w", err)
+	}
+	return sellers, nil
+}
+
+// GetSellerStats returns the stats of a seller, or nil if the last refresh found no data for it
+func (r *PostgresRepository) GetSellerStats(seller string) (*SellerStats, error) {
+	var s SellerStats
+	err := r.queryRow(`SELECT `+sellerStatsColumns+` FROM seller_stats WHERE seller = $1`, []any{seller},
+		sellerStatsFields(&s)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get seller stats: %w", err)
+	}
+	return &s, nil
+}
+
+// AllSellerStats returns the stats of every seller, ordered by seller
+func (r *PostgresRepository) AllSellerStats() ([]SellerStats, error) {
+	rows, err := r.db.Query(`SELECT ` + sellerStatsColumns + ` FROM seller_stats ORDER BY seller`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list seller stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []SellerStats
+	for rows.Next() {
+		var s SellerStats
+		if err := rows.Scan(sellerStatsFields(&s)...); err != nil {
+			return nil, fmt.Errorf("failed to scan seller stats: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read seller stats: %w", err)
+	}
+	return stats, nil
+}
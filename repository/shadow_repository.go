@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ShadowPrediction is a live prediction mirrored to the standby model version. Error is set, and
+// the shadow outputs are not, when the standby version failed to predict
+type ShadowPrediction struct {
+	ModelVersion  string
+	ActiveVersion string
+	PredictionID  int64
+	ActivePrice   float64
+	ActiveSales   float64
+	ShadowPrice   *float64
+	ShadowSales   *float64
+	Error         string
+	DurationMs    int64
+	CreatedAt     time.Time
+}
+
+// ShadowSummary aggregates the shadow predictions of a model version
+type ShadowSummary struct {
+	Samples int64
+	Errors  int64
+	// Mean absolute outputs of the active version and mean absolute differences of the standby
+	// version from them, over the successful shadow predictions
+	ActivePriceMean float64
+	ActiveSalesMean float64
+	PriceDiffMean   float64
+	SalesDiffMean   float64
+	DurationMsMean  float64
+	FirstAt         *time.Time
+	LastAt          *time.Time
+}
+
+// SaveShadowPrediction records a shadow prediction
+func (r *PostgresRepository) SaveShadowPrediction(p *ShadowPrediction) error {
+	var predictionID sql.NullInt64
+	if p.PredictionID != 0 {
+		predictionID = sql.NullInt64{Int64: p.PredictionID, Valid: true}
+	}
+	var shadowError sql.NullString
+	if p.Error != "" {
+		shadowError = sql.NullString{String: p.Error, Valid: true}
+	}
+
+	err := r.retryPolicy.DoWrite(func() error {
+		_, err := r.db.Exec(`
+			INSERT INTO shadow_predictions (
+				created_at, model_version, active_version, prediction_id,
+				active_price, active_sales, shadow_price, shadow_sales, error, duration_ms
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`, p.CreatedAt, p.ModelVersion, p.ActiveVersion, predictionID,
+			p.ActivePrice, p.ActiveSales, p.ShadowPrice, p.ShadowSales, shadowError, p.DurationMs)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save shadow prediction: %w", err)
+	}
+	return nil
+}
+
+// SummarizeShadowPredictions aggregates the shadow predictions of a model version
+func (r *PostgresRepository) SummarizeShadowPredictions(version string) (*ShadowSummary, error) {
+	var summary ShadowSummary
+	var firstAt, lastAt sql.NullTime
+	err := r.queryRow(`
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE error IS NOT NULL),
+			COALESCE(AVG(ABS(active_price)) FILTER (WHERE error IS NULL), 0),
+			COALESCE(AVG(ABS(active_sales)) FILTER (WHERE error IS NULL), 0),
+			COALESCE(AVG(ABS(shadow_price - active_price)) FILTER (WHERE error IS NULL), 0),
+			COALESCE(AVG(ABS(shadow_sales - active_sales)) FILTER (WHERE error IS NULL), 0),
+			COALESCE(AVG(duration_ms), 0),
+			MIN(created_at),
+			MAX(created_at)
+		FROM shadow_predictions
+		WHERE model_version = $1
+	`, []any{version}, &summary.Samples, &summary.Errors, &summary.ActivePriceMean, &summary.ActiveSalesMean,
+		&summary.PriceDiffMean, &summary.SalesDiffMean, &summary.DurationMsMean, &firstAt, &lastAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize shadow predictions: %w", err)
+	}
+
+	if firstAt.Valid {
+		summary.FirstAt = &firstAt.Time
+	}
+	if lastAt.Valid {
+		summary.LastAt = &lastAt.Time
+	}
+	return &summary, nil
+}
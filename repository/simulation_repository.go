@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Simulation represents a stored scenario simulation job
+type Simulation struct {
+	ID            int64
+	Status        string
+	Request       []byte
+	ScenarioCount int
+	Error         string
+	ResultsKey    string
+	CreatedAt     time.Time
+	CompletedAt   *time.Time
+}
+
+// SimulationResultRow represents a single scenario of a simulation and its prediction
+type SimulationResultRow struct {
+	ProductName        string
+	Region             string
+	Seller             string
+	Date               time.Time
+	Price              float64
+	DiscountPercentage float64
+	StockLevel         float64
+	PredictedPrice     float64
+	PredictedSales     float64
+}
+
+// CreateSimulation stores a new simulation in pending state and returns its ID
+func (r *PostgresRepository) CreateSimulation(request []byte, scenarioCount int) (int64, error) {
+	var id int64
+	err := r.writeRow(`
+		INSERT INTO simulations (status, request, scenario_count)
+		VALUES ('pending', $1, $2)
+		RETURNING id
+	`, []any{request, scenarioCount}, &id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create simulation: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateSimulationStatus sets the status of a simulation, completing it for terminal states
+func (r *PostgresRepository) UpdateSimulationStatus(id int64, status string, errMsg string) error {
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`
+			UPDATE simulations
+			SET status = $2, error = $3,
+				completed_at = CASE WHEN $2 IN ('completed', 'failed') THEN NOW() ELSE completed_at END
+			WHERE id = $1
+		`, id, status, errMsg)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update simulation status: %w", err)
+	}
+	return nil
+}
+
+// SetSimulationResultsKey records the result store key of a simulation's results file
+func (r *PostgresRepository) SetSimulationResultsKey(id int64, key string) error {
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`UPDATE simulations SET results_key = $2 WHERE id = $1`, id, key)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set simulation results key: %w", err)
+	}
+	return nil
+}
+
+// GetSimulation returns a simulation by ID, or nil if it does not exist
+func (r *PostgresRepository) GetSimulation(id int64) (*Simulation, error) {
+	var sim Simulation
+	var errMsg, resultsKey sql.NullString
+	var completedAt sql.NullTime
+	err := r.queryRow(`
+		SELECT id, status, request, scenario_count, error, results_key, created_at, completed_at
+		FROM simulations
+		WHERE id = $1
+	`, []any{id}, &sim.ID, &sim.Status, &sim.Request, &sim.ScenarioCount, &errMsg, &resultsKey, &sim.CreatedAt, &completedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get simulation: %w", err)
+	}
+
+	sim.Error = errMsg.String
+	sim.ResultsKey = resultsKey.String
+	if completedAt.Valid {
+		sim.CompletedAt = &completedAt.Time
+	}
+	return &sim, nil
+}
+
+// SaveSimulationResults bulk-inserts the result matrix of a simulation
+func (r *PostgresRepository) SaveSimulationResults(id int64, rows []SimulationResultRow) error {
+	err := r.retryPolicy.Do(func() error {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		stmt, err := tx.Prepare(pq.CopyIn("simulation_results",
+			"simulation_id", "product_name", "region", "seller", "date",
+			"price", "discount_percentage", "stock_level", "predicted_price", "predicted_sales"))
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			_, err := stmt.Exec(id, row.ProductName, row.Region, row.Seller, row.Date,
+				row.Price, row.DiscountPercentage, row.StockLevel, row.PredictedPrice, row.PredictedSales)
+			if err != nil {
+				stmt.Close()
+				return err
+			}
+		}
+		if _, err := stmt.Exec(); err != nil {
+			stmt.Close()
+			return err
+		}
+		if err := stmt.Close(); err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save simulation results: %w", err)
+	}
+	return nil
+}
+
+// GetSimulationResults returns the result matrix of a simulation
+func (r *PostgresRepository) GetSimulationResults(id int64) ([]SimulationResultRow, error) {
+	rows, err := r.db.Query(`
+		SELECT product_name, region, seller, date,
+			price, discount_percentage, stock_level, predicted_price, predicted_sales
+		FROM simulation_results
+		WHERE simulation_id = $1
+		ORDER BY product_name, region, seller, date, price, discount_percentage, stock_level
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get simulation results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SimulationResultRow
+	for rows.Next() {
+		var row SimulationResultRow
+		if err := rows.Scan(&row.ProductName, &row.Region, &row.Seller, &row.Date,
+			&row.Price, &row.DiscountPercentage, &row.StockLevel, &row.PredictedPrice, &row.PredictedSales); err != nil {
+			return nil, fmt.Errorf("failed to scan simulation result: %w", err)
+		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read simulation results: %w", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTrainingJobClaimLost is returned when a worker updates a training job it no longer holds,
+// because another worker took it over after its heartbeat went stale or it was failed meanwhile
+var ErrTrainingJobClaimLost = errors.New("training job is no longer claimed by this worker")
+
+// TrainingJob is a stored asynchronous training request
+type TrainingJob struct {
+	ID     int64
+	Status string
+	Stage  string
+	// Sample is the JSON fast-train sample of the request, nil to train on the whole window
+	Sample      []byte
+	RequestedBy string
+	// Replica is the worker running or last running the job, and Attempts how many times one
+	// started it
+	Replica     string
+	Attempts    int
+	Result      []byte
+	Error       string
+	CreatedAt   time.Time
+	StartedAt   *time.Time
+	HeartbeatAt *time.Time
+	FinishedAt  *time.Time
+}
+
+// trainingJobColumns are the columns scanned by scanTrainingJob
+const trainingJobColumns = `id, status, stage, sample, requested_by, replica, attempts, result, error,
+	created_at, started_at, heartbeat_at, finished_at`
+
+// CreateTrainingJob stores a queued training job and returns its ID
+func (r *PostgresRepository) CreateTrainingJob(sample []byte, requestedBy string) (int64, error) {
+	var id int64
+	err := r.writeRow(`
+		INSERT INTO training_jobs (status, sample, requested_by)
+		VALUES ('queued', $1, $2)
+		RETURNING id
+	`, []any{nullableJSON(sample), requestedBy}, &id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create training job: %w", err)
+	}
+	return id, nil
+}
+
+// GetTrainingJob returns a training job, or nil if it does not exist
+func (r *PostgresRepository) GetTrainingJob(id int64) (*TrainingJob, error) {
+	job, err := r.scanTrainingJob(r.queryRow, `SELECT `+trainingJobColumns+` FROM training_jobs WHERE id = $1`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get training job: %w", err)
+	}
+	return job, nil
+}
+
+// ClaimTrainingJob marks the oldest queued training job as running on replica and returns it, nil
+// when there is none. A running job whose heartbeat is older than staleAfter lost its worker, e.g.
+// to a restart, and is claimed again; once it was started maxAttempts times it fails instead. The
+// job is locked with SKIP LOCKED, so workers polling together never claim the same one
+func (r *PostgresRepository) ClaimTrainingJob(replica string, staleAfter time.Duration, maxAttempts int) (*TrainingJob, error) {
+	stale := fmt.Sprintf("%d milliseconds", staleAfter.Milliseconds())
+	err := r.retryPolicy.Do(func() error {
+		_, err := r.db.Exec(`
+			UPDATE training_jobs
+			SET status = 'failed', finished_at = NOW(),
+				error = 'interrupted ' || attempts || ' times, last on ' || replica
+			WHERE status = 'running' AND heartbeat_at < NOW() - $1::interval AND attempts >= $2
+		`, stale, maxAttempts)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fail interrupted training jobs: %w", err)
+	}
+
+	// The claim increments attempts, so it is only retried when it was not applied
+	job, err := r.scanTrainingJob(r.writeRow, `
+		UPDATE training_jobs
+		SET status = 'running', stage = '', replica = $1, attempts = attempts + 1, error = '',
+			started_at = NOW(), heartbeat_at = NOW()
+		WHERE id = (
+			SELECT id FROM training_jobs
+			WHERE status = 'queued' OR (status = 'running' AND heartbeat_at < NOW() - $2::interval)
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+trainingJobColumns, replica, stale)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to claim training job: %w", err)
+	}
+	return job, nil
+}
+
+// UpdateTrainingJobStage records the stage a running training job reached, which also counts as
+// a heartbeat; an empty stage only records the heartbeat. The job must still be running under the
+// claim of replica that made attempts starts, or ErrTrainingJobClaimLost is returned
+func (r *PostgresRepository) UpdateTrainingJobStage(id int64, replica string, attempts int, stage string) error {
+	var n int64
+	err := r.retryPolicy.Do(func() error {
+		result, err := r.db.Exec(`
+			UPDATE training_jobs
+			SET stage = CASE WHEN $4 = '' THEN stage ELSE $4 END, heartbeat_at = NOW()
+			WHERE id = $1 AND replica = $2 AND attempts = $3 AND status = 'running'
+		`, id, replica, attempts, stage)
+		if err != nil {
+			return err
+		}
+		n, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update training job stage: %w", err)
+	}
+	if n == 0 {
+		return ErrTrainingJobClaimLost
+	}
+	return nil
+}
+
+// FinishTrainingJob records the outcome of a training job: its JSON result or error for the
+// terminal statuses, or queued to hand an interrupted job to another worker. Like
+// UpdateTrainingJobStage it only updates a job still running under the claim of replica. Once
+// applied, the update no longer matches the job, so it is only retried when it was not applied
+func (r *PostgresRepository) FinishTrainingJob(id int64, replica string, attempts int, status string, result []byte, errMsg string) error {
+	var n int64
+	err := r.retryPolicy.DoWrite(func() error {
+		res, err := r.db.Exec(`
+			UPDATE training_jobs
+			SET status = $4, result = $5, error = $6,
+				finished_at = CASE WHEN $4 = 'queued' THEN NULL ELSE NOW() END
+			WHERE id = $1 AND replica = $2 AND attempts = $3 AND status = 'running'
+		`, id, replica, attempts, status, nullableJSON(result), errMsg)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to finish training job: %w", err)
+	}
+	if n == 0 {
+		return ErrTrainingJobClaimLost
+	}
+	return nil
+}
+
+// scanTrainingJob runs a query returning trainingJobColumns of a single job with queryRow or writeRow
+func (r *PostgresRepository) scanTrainingJob(run func(query string, args []any, dest ...any) error, query string, args ...any) (*TrainingJob, error) {
+	var job TrainingJob
+	var sample, result sql.NullString
+	var startedAt, heartbeatAt, finishedAt sql.NullTime
+	err := run(query, args, &job.ID, &job.Status, &job.Stage, &sample, &job.RequestedBy, &job.Replica,
+		&job.Attempts, &result, &job.Error, &job.CreatedAt, &startedAt, &heartbeatAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if sample.Valid {
+		job.Sample = []byte(sample.String)
+	}
+	if result.Valid {
+		job.Result = []byte(result.String)
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if heartbeatAt.Valid {
+		job.HeartbeatAt = &heartbeatAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+	}
+	return &job, nil
+}
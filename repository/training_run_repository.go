@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TrainingRun represents a recorded model training run
+type TrainingRun struct {
+	ID           int64
+	StartedAt    time.Time
+	FinishedAt   time.Time
+	DurationMs   int64
+	Status       string
+	Version      string
+	Metrics      []byte
+	DatasetHash  string
+	Parameters   []byte
+	PythonOutput string
+	Error        string
+	// LearningCurve holds the iteration-level metrics as a JSON array
+	LearningCurve []byte
+	// Resource usage of the training subprocess
+	WallTimeMs   int64
+	CPUTimeMs    int64
+	PeakRSSBytes int64
+	// DatasetRows is the number of processed_data rows when the run started
+	DatasetRows int64
+}
+
+// SaveTrainingRun records a finished training run and returns its ID
+func (r *PostgresRepository) SaveTrainingRun(run *TrainingRun) (int64, error) {
+	query := `
+		INSERT INTO training_runs (
+			started_at, finished_at, duration_ms, status, version, metrics,
+			dataset_hash, parameters, python_output, error, learning_curve,
+			wall_time_ms, cpu_time_ms, peak_rss_bytes, dataset_rows
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id
+	`
+
+	var id int64
+	err := r.writeRow(query, []any{
+		run.StartedAt, run.FinishedAt, run.DurationMs, run.Status, run.Version, nullableJSON(run.Metrics),
+		run.DatasetHash, nullableJSON(run.Parameters), run.PythonOutput, run.Error, nullableJSON(run.LearningCurve),
+		run.WallTimeMs, run.CPUTimeMs, run.PeakRSSBytes, run.DatasetRows,
+	}, &id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save training run: %w", err)
+	}
+
+	return id, nil
+}
+
+// ListTrainingRuns returns a page of training runs, newest first, and the total number of runs
+func (r *PostgresRepository) ListTrainingRuns(limit, offset int) ([]TrainingRun, int, error) {
+	var total int
+	if err := r.queryRow(`SELECT COUNT(*) FROM training_runs`, nil, &total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count training runs: %w", err)
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, started_at, finished_at, duration_ms, status, version, metrics,
+			dataset_hash, parameters, python_output, error,
+			wall_time_ms, cpu_time_ms, peak_rss_bytes, dataset_rows
+		FROM training_runs
+		ORDER BY started_at DESC, id DESC
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list training runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []TrainingRun
+	for rows.Next() {
+		var run TrainingRun
+		var metrics, parameters sql.NullString
+		if err := rows.Scan(&run.ID, &run.StartedAt, &run.FinishedAt, &run.DurationMs, &run.Status, &run.Version,
+			&metrics, &run.DatasetHash, &parameters, &run.PythonOutput, &run.Error,
+			&run.WallTimeMs, &run.CPUTimeMs, &run.PeakRSSBytes, &run.DatasetRows); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan training run: %w", err)
+		}
+		if metrics.Valid {
+			run.Metrics = []byte(metrics.String)
+		}
+		if parameters.Valid {
+			run.Parameters = []byte(parameters.String)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read training runs: %w", err)
+	}
+
+	return runs, total, nil
+}
+
+// GetTrainingRunLearningCurve returns the learning curve JSON of a training run
+// and whether the run exists
+func (r *PostgresRepository) GetTrainingRunLearningCurve(id int64) ([]byte, bool, error) {
+	var curve sql.NullString
+	err := r.queryRow(`SELECT learning_curve FROM training_runs WHERE id = $1`, []any{id}, &curve)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to get learning curve: %w", err)
+	}
+
+	if !curve.Valid {
+		return nil, true, nil
+	}
+	return []byte(curve.String), true, nil
+}
+
+// GetLastTrainedDatasetRows returns the dataset size of the latest successful training run
+// and whether there is one
+func (r *PostgresRepository) GetLastTrainedDatasetRows() (int64, bool, error) {
+	var datasetRows int64
+	err := r.queryRow(`
+		SELECT dataset_rows FROM training_runs
+		WHERE status = 'succeeded'
+		ORDER BY started_at DESC, id DESC
+		LIMIT 1
+	`, nil, &datasetRows)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to get last trained dataset rows: %w", err)
+	}
+
+	return datasetRows, true, nil
+}
+
+// CountProcessedRows returns the number of rows in processed_data
+func (r *PostgresRepository) CountProcessedRows() (int64, error) {
+	var count int64
+	if err := r.queryRow(`SELECT COUNT(*) FROM processed_data`, nil, &count); err != nil {
+		return 0, fmt.Errorf("failed to count processed rows: %w", err)
+	}
+	return count, nil
+}
+
+// nullableJSON converts an empty JSON document to NULL
+func nullableJSON(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
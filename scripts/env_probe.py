@@ -0,0 +1,26 @@
+import json
+import platform
+import sys
+from importlib import metadata
+
+
+def installed_versions(packages):
+    """
+    Look up the installed distribution version of every package without importing it
+
+    Missing packages are reported as null.
+    """
+    versions = {}
+    for package in packages:
+        try:
+            versions[package] = metadata.version(package)
+        except metadata.PackageNotFoundError:
+            versions[package] = None
+    return versions
+
+
+if __name__ == "__main__":
+    print(json.dumps({
+        "python": platform.python_version(),
+        "packages": installed_versions(sys.argv[1:]),
+    }))
@@ -6,22 +6,390 @@ import lightgbm as lgb
 import pickle
 import sys
 import argparse
+import bisect
 from typing import Dict, List, Tuple, Any, Optional
 from sklearn.model_selection import train_test_split
+from sklearn.metrics import mean_absolute_error
+
+PROGRESS_EVERY = 10
+
+# Version of the feature set built by the Go service (internal/features.SchemaVersion).
+# Stamped into feature_info.json; bump both together when a feature is added, removed or changes meaning.
+FEATURE_SCHEMA_VERSION = 3
+
+# Prefix of features supplied by external providers (internal/features.ExternalPrefix)
+EXTERNAL_PREFIX = 'ext_'
+
+# Promotion features and how far ahead a promotion counts as upcoming (internal/features.ApplyPromotions)
+PROMOTION_FEATURES = ['promo_active', 'promo_discount_percentage', 'promo_upcoming', 'promo_upcoming_discount_percentage']
+PROMOTION_HORIZON_DAYS = 7
+
+# Seller reliability features (internal/features.ApplySellerStats)
+SELLER_FEATURES = ['seller_avg_delivery_days', 'seller_cancellation_rate', 'seller_rating_trend']
+
+# How lag features count days (internal/features.LagMode)
+LAG_MODE_CALENDAR = 'calendar'
+LAG_MODE_BUSINESS = 'business'
+LAG_DAYS = [1, 3, 7]
+ROLLING_WINDOWS = [3, 7]
+
+# How lag features fill days missing from the history (internal/features.Interpolation)
+INTERPOLATION_NONE = 'none'
+INTERPOLATION_FFILL = 'ffill'
+INTERPOLATION_LINEAR = 'linear'
+INTERPOLATION_MAX_GAP_DAYS = 7
+
+# Which training rows new models learn from (service.TrainingWindow): all of them, or the last
+# --window-days days of the training data
+WINDOW_EXPANDING = 'expanding'
+WINDOW_SLIDING = 'sliding'
+
+# Category encoders written to encoders.json (internal/features.Encoders): the categories of every
+# encoded feature seen in training, their training rows and the policy for values outside them. Bump ENCODER_VERSION
+# together with internal/features.EncoderVersion when the format changes
+ENCODER_VERSION = 1
+ENCODERS_FILE = 'encoders.json'
+ENCODED_FEATURES = ['brand', 'region', 'category', 'seller']
+UNSEEN_MISSING = 'missing'
+UNSEEN_OTHER = 'other'
+UNSEEN_FREQUENCY = 'frequency'
+UNSEEN_REJECT = 'reject'
+OTHER_CATEGORY = '__other__'
+
+# Targets every model version predicts (internal/features.CoreTargets); extra targets are read from
+# the <name>_target column of the training data and saved as <name>_model.pkl
+CORE_TARGETS = ['price', 'sales']
+
+# Naive baselines the models are judged against (service.NaiveBaselines), as the price and daily
+# sales columns they repeat; daily sales are scaled to the days of the sales target
+SALES_TARGET_DAYS = 7
+BASELINES = {
+    'last_value': ('price', 'sales_quantity_lag_1'),
+    'seasonal_naive': ('price', 'sales_quantity_rolling_mean_7'),
+    'moving_average': ('price_rolling_mean_3', 'sales_quantity_rolling_mean_3'),
+}
+
+
+def progress_callback(model_name: str):
+    """
+    Create a LightGBM callback emitting NDJSON progress lines on stdout
+
+    Each line is a JSON object with "event": "progress", the model name, the iteration
+    number and one "<dataset>_<metric>" field per evaluated metric, e.g. valid_rmse.
+    """
+    def _callback(env):
+        iteration = env.iteration + 1
+        if iteration % PROGRESS_EVERY != 0 and iteration != env.end_iteration:
+            return
+        record = {"event": "progress", "model": model_name, "iteration": iteration}
+        for data_name, metric_name, value, _ in env.evaluation_result_list:
+            record[f"{data_name}_{metric_name}"] = value
+        print(json.dumps(record), flush=True)
+
+    _callback.order = 30
+    return _callback
+
+
+def flatten_external(row: Dict[str, Any]) -> Dict[str, Any]:
+    """
+    Move the features of external providers, sent under "external", into the row itself
+    """
+    external = row.get('external')
+    if not external:
+        return row
+    flat = {key: value for key, value in row.items() if key != 'external'}
+    flat.update(external)
+    return flat
+
+
+def add_promotion_features(df: pd.DataFrame, promotions: List[Dict[str, Any]]) -> pd.DataFrame:
+    """
+    Derive the promotion features of training rows from the promotion calendar
+
+    A promotion applies to rows of its product, or of its category when it has no product. It is
+    active on the dates from starts_on to ends_on and upcoming when it starts within
+    PROMOTION_HORIZON_DAYS after the row date. Columns already present in the data are kept, and
+    rows without a date get no promotions.
+    """
+    if all(col in df.columns for col in PROMOTION_FEATURES):
+        return df
+    for col in PROMOTION_FEATURES:
+        df[col] = 0.0
+    if not promotions or 'date' not in df.columns:
+        return df
+
+    dates = pd.to_datetime(df['date'], utc=True).dt.tz_localize(None).dt.normalize()
+    horizon = dates + pd.Timedelta(days=PROMOTION_HORIZON_DAYS)
+    for promo in promotions:
+        matches = pd.Series(False, index=df.index)
+        if promo.get('product_name') and 'product_name' in df.columns:
+            matches |= df['product_name'] == promo['product_name']
+        if promo.get('category') and 'category' in df.columns:
+            matches |= df['category'].astype(str) == promo['category']
+
+        starts = pd.Timestamp(promo['starts_on'])
+        ends = pd.Timestamp(promo['ends_on'])
+        discount = float(promo['discount_percentage'])
+
+        active = matches & (dates >= starts) & (dates <= ends)
+        df.loc[active, 'promo_active'] = 1
+        df.loc[active, 'promo_discount_percentage'] = df.loc[active, 'promo_discount_percentage'].clip(lower=discount)
+
+        upcoming = matches & (starts > dates) & (starts <= horizon)
+        df.loc[upcoming, 'promo_upcoming'] = 1
+        df.loc[upcoming, 'promo_upcoming_discount_percentage'] = df.loc[upcoming, 'promo_upcoming_discount_percentage'].clip(lower=discount)
+    return df
+
+
+def add_seller_features(df: pd.DataFrame, seller_stats: List[Dict[str, Any]]) -> pd.DataFrame:
+    """
+    Derive the seller features of training rows from the exported seller stats
+
+    Rows of sellers without stats get their own delivery_days as the average delivery time and 0
+    as the cancellation rate and rating trend, like predictions do. Columns already present in the
+    data are kept.
+    """
+    if all(col in df.columns for col in SELLER_FEATURES):
+        return df
+    default_delivery = df['delivery_days'] if 'delivery_days' in df.columns else 0.0
+    stats = {s['seller']: s for s in seller_stats}
+    sellers = df['seller'] if 'seller' in df.columns else pd.Series('', index=df.index)
+
+    df['seller_avg_delivery_days'] = sellers.map(lambda s: stats[s]['avg_delivery_days'] if s in stats else np.nan)
+    df['seller_avg_delivery_days'] = df['seller_avg_delivery_days'].fillna(default_delivery)
+    df['seller_cancellation_rate'] = sellers.map(lambda s: (stats[s].get('cancellation_rate') or 0.0) if s in stats else 0.0)
+    df['seller_rating_trend'] = sellers.map(lambda s: stats[s]['rating_trend'] if s in stats else 0.0)
+    for col in SELLER_FEATURES:
+        df[col] = df[col].astype(float)
+    return df
+
+
+def load_holidays(path: str) -> set:
+    """Read a holiday calendar with one YYYY-MM-DD date per line, skipping blank and # lines"""
+    holidays = set()
+    with open(path, 'r') as f:
+        for line in f:
+            value = line.strip()
+            if value and not value.startswith('#'):
+                holidays.add(pd.Timestamp(value).strftime('%Y-%m-%d'))
+    return holidays
+
+
+def series_value(days: list, values: list, day: pd.Timestamp, reference: pd.Timestamp, interpolation: str) -> float:
+    """
+    Value of a key's field on a day (internal/features.Interpolate)
+
+    days and values are the days the field is stored for, in order. A day without a value is left
+    missing, or filled from the stored values within INTERPOLATION_MAX_GAP_DAYS around it: the
+    latest earlier one for ffill, and the line through the nearest earlier and later ones for
+    linear. Later values after reference, the row date, are never used.
+    """
+    i = bisect.bisect_right(days, day)
+    if i > 0 and days[i - 1] == day:
+        return values[i - 1]
+    if interpolation == INTERPOLATION_NONE or i == 0 or (day - days[i - 1]).days > INTERPOLATION_MAX_GAP_DAYS:
+        return np.nan
+    if interpolation == INTERPOLATION_LINEAR and i < len(days) and days[i] <= reference \
+            and (days[i] - day).days <= INTERPOLATION_MAX_GAP_DAYS:
+        weight = (day - days[i - 1]).days / (days[i] - days[i - 1]).days
+        return values[i - 1] + (values[i] - values[i - 1]) * weight
+    return values[i - 1]
+
+
+def build_lags(df: pd.DataFrame, lag_mode: str, holidays: set, interpolation: str) -> bool:
+    """
+    Rebuild the lag and rolling mean columns (internal/features.LagDates and Interpolate)
+
+    In calendar mode lag N of a row is its product, region and seller's price and sales N days
+    before the row date and a rolling mean of N averages the N days ending on it. In business mode
+    lag N is the Nth business day before the row date and a rolling mean of N covers the N business
+    days ending on or before it; business days skip weekends and the holidays. Days without a row
+    are filled with the interpolation method. Returns False and leaves the data untouched when it
+    lacks the date, key, price or sales_quantity columns.
+    """
+    required = {'date', 'product_name', 'region', 'seller', 'price', 'sales_quantity'}
+    if not required.issubset(df.columns):
+        return False
+
+    dates = pd.to_datetime(df['date'], utc=True).dt.tz_localize(None).dt.normalize()
+    all_days = pd.date_range(dates.min() - pd.Timedelta(days=60), dates.max(), freq='D')
+    business = [d for d in all_days if d.weekday() < 5 and d.strftime('%Y-%m-%d') not in holidays]
+
+    keys = list(zip(df['product_name'], df['region'], df['seller']))
+    stored = {}
+    for key, date, price, sales in zip(keys, dates, df['price'], df['sales_quantity']):
+        for field, value in (('price', price), ('sales_quantity', sales)):
+            if pd.notna(value):
+                stored.setdefault((key, field), {})[date] = float(value)
+    series = {k: (sorted(v), [v[d] for d in sorted(v)]) for k, v in stored.items()}
+
+    def value(key, field, day, reference):
+        days, values = series.get((key, field), ([], []))
+        return series_value(days, values, day, reference, interpolation)
+
+    columns = {f'{name}_lag_{n}': [] for n in LAG_DAYS for name in ('sales_quantity', 'price')}
+    columns.update({f'{name}_rolling_mean_{n}': [] for n in ROLLING_WINDOWS for name in ('sales_quantity', 'price')})
+    for key, date in zip(keys, dates):
+        if lag_mode == LAG_MODE_BUSINESS:
+            before = bisect.bisect_left(business, date)
+            through = bisect.bisect_right(business, date)
+            lag_days = {n: business[before - n] if before >= n else None for n in LAG_DAYS}
+            windows = {n: business[max(through - n, 0):through] for n in ROLLING_WINDOWS}
+        else:
+            lag_days = {n: date - pd.Timedelta(days=n) for n in LAG_DAYS}
+            windows = {n: [date - pd.Timedelta(days=i) for i in range(n)] for n in ROLLING_WINDOWS}
+
+        for n in LAG_DAYS:
+            for field in ('price', 'sales_quantity'):
+                columns[f'{field}_lag_{n}'].append(value(key, field, lag_days[n], date) if lag_days[n] is not None else np.nan)
+        for n in ROLLING_WINDOWS:
+            for field in ('price', 'sales_quantity'):
+                window = [v for v in (value(key, field, d, date) for d in windows[n]) if pd.notna(v)]
+                columns[f'{field}_rolling_mean_{n}'].append(np.mean(window) if window else np.nan)
+
+    for name, column in columns.items():
+        df[name] = column
+    return True
+
+
+def apply_window(df: pd.DataFrame, window: str, window_days: int) -> Tuple[pd.DataFrame, Dict[str, Any]]:
+    """Keep the rows of the training window, returning them with a summary of the window"""
+    info = {'mode': window}
+    if window == WINDOW_SLIDING:
+        info['days'] = window_days
+    if 'date' not in df.columns:
+        if window == WINDOW_SLIDING:
+            return df, None
+        info.update({'rows': len(df), 'dropped_rows': 0})
+        return df, info
+
+    dates = pd.to_datetime(df['date'])
+    kept = df
+    if window == WINDOW_SLIDING:
+        start = dates.max().normalize() - pd.Timedelta(days=window_days - 1)
+        in_window = (dates >= start).values
+        kept, dates = df[in_window], dates[in_window]
+    info.update({
+        'from': dates.min().strftime('%Y-%m-%d'),
+        'to': dates.max().strftime('%Y-%m-%d'),
+        'rows': len(kept),
+        'dropped_rows': len(df) - len(kept),
+    })
+    return kept, info
+
+
+def apply_sample(df: pd.DataFrame, sample_percent: float, sample_days: int) -> Tuple[pd.DataFrame, Optional[Dict[str, Any]]]:
+    """Keep a fast-train sample of the rows: a random percent of them, or those of the last days"""
+    if sample_days:
+        if 'date' not in df.columns:
+            return df, None
+        dates = pd.to_datetime(df['date'])
+        start = dates.max().normalize() - pd.Timedelta(days=sample_days - 1)
+        kept = df[(dates >= start).values]
+        info = {'days': sample_days}
+    else:
+        # A fixed seed keeps repeated experiments on the same rows
+        kept = df.sample(frac=sample_percent / 100, random_state=42)
+        info = {'percent': sample_percent}
+    info.update({'rows': len(kept), 'dropped_rows': len(df) - len(kept)})
+    return kept, info
+
+
+def apply_quota(df: pd.DataFrame, max_rows: int, max_bytes: int, row_bytes: float) -> Tuple[pd.DataFrame, Optional[Dict[str, Any]]]:
+    """Downsample the rows to the training quota, keeping the share of every category; None when they fit"""
+    limit = len(df)
+    if max_rows:
+        limit = min(limit, max_rows)
+    if max_bytes and row_bytes > 0:
+        limit = min(limit, int(max_bytes / row_bytes))
+    if limit >= len(df):
+        return df, None
+
+    # A fixed seed keeps repeated runs on the same rows
+    fraction = limit / len(df)
+    info = {'fraction': fraction}
+    if 'category' in df.columns:
+        kept = df.groupby('category', group_keys=False, dropna=False).sample(frac=fraction, random_state=42).sort_index()
+        info['stratified_by'] = 'category'
+    else:
+        kept = df.sample(n=limit, random_state=42).sort_index()
+    if max_rows:
+        info['max_rows'] = max_rows
+    if max_bytes:
+        info['max_bytes'] = max_bytes
+    info.update({'rows': len(kept), 'dropped_rows': len(df) - len(kept)})
+    return kept, info
+
+
+def baseline_mae(X: pd.DataFrame, y_price: np.ndarray, y_sales: np.ndarray) -> Optional[Dict[str, Dict[str, float]]]:
+    """
+    Validation MAE of the naive baselines for the price and sales models
+
+    Each baseline is measured over the rows where its column is known. Returns None when a column
+    is missing or never known, so that no partial comparison is reported.
+    """
+    result = {'price_model': {}, 'sales_model': {}}
+    for name, (price_col, sales_col) in BASELINES.items():
+        for model, col, y, scale in (('price_model', price_col, y_price, 1), ('sales_model', sales_col, y_sales, SALES_TARGET_DAYS)):
+            if col not in X.columns:
+                return None
+            values = X[col].astype(float).values * scale
+            known = ~np.isnan(values)
+            if not known.any():
+                return None
+            result[model][name] = float(mean_absolute_error(y[known], values[known]))
+    return result
+
 
 class LightGBMPredictor:
-    def __init__(self, model_dir: str = "models"):
+    def __init__(self, model_dir: str = "models", lag_mode: str = LAG_MODE_CALENDAR, holidays: Optional[set] = None,
+                 interpolation: str = INTERPOLATION_NONE, targets: Optional[List[str]] = None,
+                 window: str = WINDOW_EXPANDING, window_days: int = 0, early_stopping_rounds: int = 50,
+                 sample_percent: float = 0, sample_days: int = 0, unseen_policy: str = UNSEEN_MISSING,
+                 encoder_min_count: int = 1, max_rows: int = 0, max_bytes: int = 0):
         """
         Initialize the LightGBM predictor
 
         Args:
             model_dir: Directory to save/load model files
+            lag_mode: How training lags count days, stamped into feature_info.json
+            holidays: Dates skipped besides weekends when lag_mode is business
+            interpolation: How training lags fill missing days, stamped into feature_info.json
+            targets: Targets to train, CORE_TARGETS first, stamped into feature_info.json
+            window: Training rows to learn from, expanding or sliding, stamped into feature_info.json
+            window_days: Length of a sliding window in days
+            early_stopping_rounds: Rounds without a better validation score after which boosting stops
+            sample_percent: Random percent of the training rows a fast train learns from, stamped into feature_info.json
+            sample_days: Last days of the training rows a fast train learns from, stamped into feature_info.json
+            unseen_policy: How categories unseen in training are encoded, written to encoders.json
+            encoder_min_count: Training rows a category needs to be encoded on its own, written to encoders.json
+            max_rows: Training rows past which they are downsampled within every category, 0 for no limit
+            max_bytes: Size of the training data file past which its rows are downsampled, 0 for no limit
         """
         self.model_dir = model_dir
+        self.lag_mode = lag_mode
+        self.holidays = holidays or set()
+        self.interpolation = interpolation
+        self.targets = CORE_TARGETS + [t for t in (targets or []) if t not in CORE_TARGETS]
+        self.window = window
+        self.window_days = window_days
+        self.early_stopping_rounds = early_stopping_rounds
+        self.sample_percent = sample_percent
+        self.sample_days = sample_days
+        self.max_rows = max_rows
+        self.max_bytes = max_bytes
         self.price_model = None
         self.sales_model = None
+        # Models of the targets beyond CORE_TARGETS, by target
+        self.target_models = {}
         self.feature_names = None
         self.categorical_features = None
+        self.unseen_policy = unseen_policy
+        self.encoder_min_count = encoder_min_count
+        # Categories of the encoded features and their training rows, by feature; None for models
+        # trained before encoders
+        self.encoders = None
+        self.encoder_counts = None
 
         # Create model directory if it doesn't exist
         os.makedirs(model_dir, exist_ok=True)
@@ -46,23 +414,87 @@ class LightGBMPredictor:
             'sales_quantity_lag_1', 'price_lag_1', 'sales_quantity_lag_3', 'price_lag_3',
             'sales_quantity_lag_7', 'price_lag_7', 'sales_quantity_rolling_mean_3',
             'price_rolling_mean_3', 'sales_quantity_rolling_mean_7', 'price_rolling_mean_7'
-        ]
+        ] + PROMOTION_FEATURES + SELLER_FEATURES
+
+        # Features supplied by external providers, present when the training data carries them
+        external_features = sorted(col for col in df.columns if col.startswith(EXTERNAL_PREFIX))
 
         # Combine features
-        feature_names = numerical_features + categorical_features
+        feature_names = numerical_features + external_features + categorical_features
 
         # Ensure is_weekend and is_holiday are converted to integers
         df['is_weekend'] = df['is_weekend'].astype(int)
         df['is_holiday'] = df['is_holiday'].astype(int)
 
         # Convert categorical features to category type
-        for cat_feat in categorical_features:
-            if cat_feat in df.columns:
-                df[cat_feat] = df[cat_feat].astype('category')
+        self._encode_categories(df, categorical_features)
 
         # Return features DataFrame and names
         return df[feature_names], feature_names, categorical_features
 
+    def fit_encoders(self, df: pd.DataFrame) -> None:
+        """
+        Learn the categories of the encoded features from the training rows. Values seen in fewer
+        than encoder_min_count rows get no category of their own and are encoded like unseen ones
+
+        Args:
+            df: Pandas DataFrame with the training rows
+        """
+        self.encoders = {}
+        self.encoder_counts = {}
+        for feature in ENCODED_FEATURES:
+            if feature not in df.columns:
+                continue
+            values = df[feature].dropna().astype(str)
+            counts = values[values != ''].value_counts()
+            categories = sorted(str(value) for value in counts[counts >= self.encoder_min_count].index if value != OTHER_CATEGORY)
+            category_counts = [int(counts[category]) for category in categories]
+            if self.unseen_policy == UNSEEN_OTHER:
+                categories.append(OTHER_CATEGORY)
+                category_counts.append(int(counts[counts < self.encoder_min_count].sum()))
+            self.encoders[feature] = categories
+            self.encoder_counts[feature] = category_counts
+
+    def _rarest_category(self, feature: str) -> Optional[str]:
+        """
+        Category of feature with the fewest training rows, the one unseen values are encoded as under
+        the frequency policy; None when the encoders have no counts
+
+        Args:
+            feature: Name of the encoded feature
+        """
+        counts = (self.encoder_counts or {}).get(feature)
+        if not counts:
+            return None
+        return self.encoders[feature][counts.index(min(counts))]
+
+    def _encode_categories(self, df: pd.DataFrame, categorical_features: List[str]) -> None:
+        """
+        Convert the categorical features of df to the category type in place. The encoded features get
+        the categories of the encoders, so that a value has the same code in training and prediction;
+        the values outside them become missing, OTHER_CATEGORY under the other policy or the rarest
+        category under the frequency policy. Models trained before encoders leave the mapping to LightGBM
+
+        Args:
+            df: Pandas DataFrame with the features
+            categorical_features: Names of the categorical features
+        """
+        for cat_feat in categorical_features:
+            if cat_feat not in df.columns:
+                continue
+            categories = self.encoders.get(cat_feat) if self.encoders is not None else None
+            if categories is None:
+                df[cat_feat] = df[cat_feat].astype('category')
+                continue
+            values = df[cat_feat].map(lambda value: None if value is None or pd.isna(value) or str(value) == '' else str(value))
+            if self.unseen_policy == UNSEEN_OTHER:
+                known = set(categories)
+                values = values.map(lambda value: value if pd.isna(value) or value in known else OTHER_CATEGORY)
+            elif self.unseen_policy == UNSEEN_FREQUENCY and self._rarest_category(cat_feat) is not None:
+                known, rarest = set(categories), self._rarest_category(cat_feat)
+                values = values.map(lambda value: value if pd.isna(value) or value in known else rarest)
+            df[cat_feat] = pd.Categorical(values, categories=categories)
+
     def validate_data(self, df: pd.DataFrame) -> bool:
         """
         Проверка данных на наличие необходимых столбцов и минимального количества строк
@@ -73,7 +505,7 @@ class LightGBMPredictor:
         Returns:
             True, если данные валидны, False в противном случае
         """
-        required_columns = ['price_target', 'sales_target', 'brand', 'region', 'category', 'seller', 'price', 'original_price']
+        required_columns = [f"{target}_target" for target in self.targets] + ['brand', 'region', 'category', 'seller', 'price', 'original_price']
         missing_columns = [col for col in required_columns if col not in df.columns]
         if missing_columns:
             print(f"Отсутствуют обязательные столбцы: {missing_columns}")
@@ -102,7 +534,8 @@ class LightGBMPredictor:
             df = df[(df[col] >= lower_bound) & (df[col] <= upper_bound)]
         return df
 
-    def train(self, train_data_path: str, val_data_path: str) -> Dict[str, Any]:
+    def train(self, train_data_path: str, val_data_path: str, promotions: Optional[List[Dict[str, Any]]] = None,
+              seller_stats: Optional[List[Dict[str, Any]]] = None) -> Dict[str, Any]:
         # Function to log to both stderr and stdout
         def log_info(msg):
             sys.stderr.write(msg + "\n")
@@ -110,6 +543,8 @@ class LightGBMPredictor:
             
         log_info(f"Загрузка обучающих данных из {train_data_path}")
         train_df = pd.read_csv(train_data_path)
+        # The byte quota is converted to rows with the average size of a row of the file
+        row_bytes = os.path.getsize(train_data_path) / len(train_df) if len(train_df) else 0
 
         log_info(f"Загрузка валидационных данных из {val_data_path}")
         val_df = pd.read_csv(val_data_path)
@@ -119,6 +554,48 @@ class LightGBMPredictor:
             log_info(f"ОШИБКА: {error_msg}")
             raise ValueError(error_msg)
 
+        if promotions and 'date' not in train_df.columns:
+            log_info("В обучающих данных нет столбца date, признаки промо-акций будут нулевыми")
+        train_df = add_promotion_features(train_df, promotions or [])
+        val_df = add_promotion_features(val_df, promotions or [])
+        train_df = add_seller_features(train_df, seller_stats or [])
+        val_df = add_seller_features(val_df, seller_stats or [])
+
+        if self.lag_mode == LAG_MODE_BUSINESS or self.interpolation != INTERPOLATION_NONE:
+            if not build_lags(train_df, self.lag_mode, self.holidays, self.interpolation) \
+                    or not build_lags(val_df, self.lag_mode, self.holidays, self.interpolation):
+                error_msg = "Для пересчёта лагов нужны столбцы date, product_name, region, seller, price и sales_quantity"
+                log_info(f"ОШИБКА: {error_msg}")
+                raise ValueError(error_msg)
+            log_info(f"Лаги пересчитаны: режим {self.lag_mode}, интерполяция {self.interpolation} "
+                     f"(праздников в календаре: {len(self.holidays)})")
+
+        # Окно обучения применяется после пересчёта лагов, чтобы первые дни окна сохранили историю
+        train_df, window_info = apply_window(train_df, self.window, self.window_days)
+        if window_info is None:
+            error_msg = "Для скользящего окна обучения нужен столбец date"
+            log_info(f"ОШИБКА: {error_msg}")
+            raise ValueError(error_msg)
+        if self.window == WINDOW_SLIDING:
+            log_info(f"Скользящее окно {self.window_days} дн.: {window_info['rows']} строк с {window_info['from']}, "
+                     f"отброшено {window_info['dropped_rows']}")
+        sample_info = None
+        if self.sample_percent or self.sample_days:
+            train_df, sample_info = apply_sample(train_df, self.sample_percent, self.sample_days)
+            if sample_info is None:
+                error_msg = "Для выборки последних дней нужен столбец date"
+                log_info(f"ОШИБКА: {error_msg}")
+                raise ValueError(error_msg)
+            log_info(f"Быстрое обучение на выборке: {sample_info['rows']} строк, отброшено {sample_info['dropped_rows']}")
+        train_df, quota_info = apply_quota(train_df, self.max_rows, self.max_bytes, row_bytes)
+        if quota_info is not None:
+            log_info(f"ПРЕДУПРЕЖДЕНИЕ: обучающие данные превышают квоту, оставлено {quota_info['rows']} строк "
+                     f"({quota_info['fraction']:.2%} каждой категории), отброшено {quota_info['dropped_rows']}")
+        if not self.validate_data(train_df):
+            error_msg = "Недостаточно обучающих данных в окне обучения"
+            log_info(f"ОШИБКА: {error_msg}")
+            raise ValueError(error_msg)
+
         # Удаление выбросов из тренировочных данных
         train_df = self.remove_outliers(train_df, ['price_target', 'sales_target'])
 
@@ -126,11 +603,16 @@ class LightGBMPredictor:
         train_df = train_df.dropna(subset=['price_target', 'sales_target'])
         val_df = val_df.dropna(subset=['price_target', 'sales_target'])
 
+        self.fit_encoders(train_df)
+        log_info("Категории для кодирования: " + ", ".join(f"{feature}={len(categories)}" for feature, categories in self.encoders.items()) +
+                 f" (политика для новых значений: {self.unseen_policy}, минимум строк: {self.encoder_min_count})")
+
         X_train, self.feature_names, self.categorical_features = self._prepare_features(train_df)
         y_price_train = train_df['price_target'].values
         y_sales_train = train_df['sales_target'].values
 
         X_val, _, _ = self._prepare_features(val_df)
+        X_val = X_val.reindex(columns=self.feature_names)
         y_price_val = val_df['price_target'].values
         y_sales_val = val_df['sales_target'].values
 
@@ -176,10 +658,6 @@ class LightGBMPredictor:
             'verbose': -1
         }
 
-        callbacks = [
-            lgb.early_stopping(stopping_rounds=50)
-        ]
-
         log_info("Обучение модели предсказания цены...")
         self.price_model = lgb.train(
             params,
@@ -187,7 +665,7 @@ class LightGBMPredictor:
             num_boost_round=1000,
             valid_sets=[lgb_train_price, lgb_val_price],
             valid_names=['train', 'valid'],
-            callbacks=callbacks
+            callbacks=[lgb.early_stopping(stopping_rounds=self.early_stopping_rounds), progress_callback("price")]
         )
 
         log_info("Обучение модели предсказания продаж...")
@@ -197,26 +675,91 @@ class LightGBMPredictor:
             num_boost_round=1000,
             valid_sets=[lgb_train_sales, lgb_val_sales],
             valid_names=['train', 'valid'],
-            callbacks=callbacks
+            callbacks=[lgb.early_stopping(stopping_rounds=self.early_stopping_rounds), progress_callback("sales")]
         )
 
+        extra_metrics = {}
+        for target in self.targets[len(CORE_TARGETS):]:
+            column = f"{target}_target"
+            train_known = train_df[column].notna().values
+            val_known = val_df[column].notna().values
+            if not train_known.any() or not val_known.any():
+                error_msg = f"Нет значений целевой переменной {column}"
+                log_info(f"ОШИБКА: {error_msg}")
+                raise ValueError(error_msg)
+
+            lgb_train_target = lgb.Dataset(
+                X_train[train_known],
+                label=train_df[column].values[train_known],
+                categorical_feature=self.categorical_features,
+                silent=True
+            )
+            lgb_val_target = lgb.Dataset(
+                X_val[val_known],
+                label=val_df[column].values[val_known],
+                reference=lgb_train_target,
+                categorical_feature=self.categorical_features,
+                silent=True
+            )
+            log_info(f"Обучение модели предсказания {target}...")
+            model = lgb.train(
+                params,
+                lgb_train_target,
+                num_boost_round=1000,
+                valid_sets=[lgb_train_target, lgb_val_target],
+                valid_names=['train', 'valid'],
+                callbacks=[lgb.early_stopping(stopping_rounds=self.early_stopping_rounds), progress_callback(target)]
+            )
+            self.target_models[target] = model
+            target_val_pred = model.predict(X_val[val_known], num_iteration=model.best_iteration)
+            extra_metrics[target] = {
+                "best_iteration": model.best_iteration,
+                "best_score": model.best_score['valid']['rmse'],
+                "train_score": model.best_score['train']['rmse'],
+                "mae": float(mean_absolute_error(val_df[column].values[val_known], target_val_pred))
+            }
+
         self.save_models()
 
+        price_val_pred = self.price_model.predict(X_val, num_iteration=self.price_model.best_iteration)
+        sales_val_pred = self.sales_model.predict(X_val, num_iteration=self.sales_model.best_iteration)
+
         metrics = {
             "price_model": {
                 "best_iteration": self.price_model.best_iteration,
-                "best_score": self.price_model.best_score['valid']['rmse']
+                "best_score": self.price_model.best_score['valid']['rmse'],
+                "train_score": self.price_model.best_score['train']['rmse'],
+                "mae": float(mean_absolute_error(y_price_val, price_val_pred))
             },
             "sales_model": {
                 "best_iteration": self.sales_model.best_iteration,
-                "best_score": self.sales_model.best_score['valid']['rmse']
+                "best_score": self.sales_model.best_score['valid']['rmse'],
+                "train_score": self.sales_model.best_score['train']['rmse'],
+                "mae": float(mean_absolute_error(y_sales_val, sales_val_pred))
             }
         }
+        baselines = baseline_mae(X_val, y_price_val, y_sales_val)
+        if baselines is not None:
+            metrics["price_model"]["baseline_mae"] = baselines["price_model"]
+            metrics["sales_model"]["baseline_mae"] = baselines["sales_model"]
+        if extra_metrics:
+            metrics["targets"] = extra_metrics
+        metrics["training_window"] = window_info
+        if sample_info is not None:
+            metrics["sample"] = sample_info
+        if quota_info is not None:
+            metrics["downsampled"] = quota_info
         
         # Log the training results
         log_info(f"Обучение завершено. Метрики моделей:")
         log_info(f"Модель цены - Лучшая итерация: {metrics['price_model']['best_iteration']}, Лучший RMSE: {metrics['price_model']['best_score']:.2f}")
         log_info(f"Модель продаж - Лучшая итерация: {metrics['sales_model']['best_iteration']}, Лучший RMSE: {metrics['sales_model']['best_score']:.2f}")
+        if baselines is not None:
+            for model in ('price_model', 'sales_model'):
+                summary = ', '.join(f"{name}={mae:.2f}" for name, mae in baselines[model].items())
+                log_info(f"MAE базовых прогнозов {model}: {summary}")
+        for target, target_metrics in extra_metrics.items():
+            log_info(f"Модель {target} - Лучшая итерация: {target_metrics['best_iteration']}, Лучший RMSE: {target_metrics['best_score']:.2f}")
         
         # Print the final JSON result - this will be parsed by the Go service
         print(json.dumps(metrics))
@@ -233,14 +776,44 @@ class LightGBMPredictor:
             with open(os.path.join(self.model_dir, 'sales_model.pkl'), 'wb') as f:
                 pickle.dump(self.sales_model, f)
 
-        # Save feature names and categorical features
+        for target, model in self.target_models.items():
+            with open(os.path.join(self.model_dir, f"{target}_model.pkl"), 'wb') as f:
+                pickle.dump(model, f)
+
+        # Save feature names and categorical features, with the gain importances of every model
         if self.feature_names is not None and self.categorical_features is not None:
+            models = {"price": self.price_model, "sales": self.sales_model, **self.target_models}
+            importances = {
+                target: dict(zip(self.feature_names, (float(gain) for gain in model.feature_importance(importance_type='gain'))))
+                for target, model in models.items() if model is not None
+            }
             with open(os.path.join(self.model_dir, 'feature_info.json'), 'w') as f:
                 json.dump({
+                    'schema_version': FEATURE_SCHEMA_VERSION,
+                    'lag_mode': self.lag_mode,
+                    'interpolation': self.interpolation,
+                    'targets': self.targets,
+                    'training_window': self.window,
+                    'training_window_days': self.window_days if self.window == WINDOW_SLIDING else 0,
+                    'sample_percent': self.sample_percent,
+                    'sample_days': self.sample_days,
                     'feature_names': self.feature_names,
-                    'categorical_features': self.categorical_features
+                    'categorical_features': self.categorical_features,
+                    'feature_importances': importances,
+                    'encoder_version': ENCODER_VERSION if self.encoders is not None else 0,
+                    'lightgbm_version': lgb.__version__
                 }, f)
 
+        if self.encoders is not None:
+            with open(os.path.join(self.model_dir, ENCODERS_FILE), 'w') as f:
+                json.dump({
+                    'encoder_version': ENCODER_VERSION,
+                    'unseen_policy': self.unseen_policy,
+                    'min_count': self.encoder_min_count,
+                    'categories': self.encoders,
+                    'counts': self.encoder_counts
+                }, f, ensure_ascii=False)
+
     def load_models(self) -> bool:
         """
         Load trained models from disk
@@ -260,8 +833,34 @@ class LightGBMPredictor:
             # Load feature info
             with open(os.path.join(self.model_dir, 'feature_info.json'), 'r') as f:
                 feature_info = json.load(f)
+                # Models trained before the stamp was introduced carry no schema version
+                schema_version = feature_info.get('schema_version', FEATURE_SCHEMA_VERSION)
+                if schema_version != FEATURE_SCHEMA_VERSION:
+                    raise ValueError(f"feature schema version {schema_version} does not match {FEATURE_SCHEMA_VERSION}, retrain the models")
                 self.feature_names = feature_info['feature_names']
                 self.categorical_features = feature_info['categorical_features']
+                # Models trained before targets were stamped only predict CORE_TARGETS
+                self.targets = feature_info.get('targets', CORE_TARGETS)
+                encoder_version = feature_info.get('encoder_version', 0)
+
+            # Load the category encoders; models trained before them have none
+            self.encoders = None
+            self.encoder_counts = None
+            if encoder_version:
+                if encoder_version != ENCODER_VERSION:
+                    raise ValueError(f"encoder version {encoder_version} does not match {ENCODER_VERSION}, retrain the models")
+                with open(os.path.join(self.model_dir, ENCODERS_FILE), 'r') as f:
+                    encoders = json.load(f)
+                self.unseen_policy = encoders.get('unseen_policy', UNSEEN_MISSING)
+                self.encoder_min_count = encoders.get('min_count', 1)
+                self.encoders = encoders['categories']
+                self.encoder_counts = encoders.get('counts')
+
+            # Load the models of extra targets
+            self.target_models = {}
+            for target in self.targets[len(CORE_TARGETS):]:
+                with open(os.path.join(self.model_dir, f"{target}_model.pkl"), 'rb') as f:
+                    self.target_models[target] = pickle.load(f)
 
             return True
         except Exception as e:
@@ -283,30 +882,102 @@ class LightGBMPredictor:
                 raise ValueError("Models not trained or loaded properly")
 
         # Convert product data to DataFrame
-        df = pd.DataFrame([product_data])
+        df = pd.DataFrame([flatten_external(product_data)])
 
         # Convert booleans to integers
-        if 'is_weekend' in df.columns:
-            df['is_weekend'] = df['is_weekend'].astype(int)
-        if 'is_holiday' in df.columns:
-            df['is_holiday'] = df['is_holiday'].astype(int)
+        for flag in ['is_weekend', 'is_holiday', 'promo_active', 'promo_upcoming']:
+            if flag in df.columns:
+                df[flag] = df[flag].astype(int)
 
         # Convert categorical features to category type
-        for cat_feat in self.categorical_features:
-            if cat_feat in df.columns:
-                df[cat_feat] = df[cat_feat].astype('category')
+        self._encode_categories(df, self.categorical_features)
 
-        # Prepare features
-        X = df[self.feature_names]
+        # Prepare features; external features the request lacks are passed as missing values
+        X = df.reindex(columns=self.feature_names)
 
         # Make predictions
         price_pred = self.price_model.predict(X)[0]
         sales_pred = self.sales_model.predict(X)[0]
 
-        return {
+        prediction = {
             "predicted_price": float(price_pred),
             "predicted_sales": float(sales_pred)
         }
+        if self.target_models:
+            prediction["targets"] = {target: float(model.predict(X)[0]) for target, model in self.target_models.items()}
+        return prediction
+
+    def predict_batch(self, rows: List[Dict[str, Any]]) -> List[Dict[str, float]]:
+        """
+        Make predictions for many products in a single model pass
+
+        Args:
+            rows: List of dictionaries with product features
+
+        Returns:
+            List of dictionaries with predicted price and sales, in input order
+        """
+        if self.price_model is None or self.sales_model is None:
+            if not self.load_models():
+                raise ValueError("Models not trained or loaded properly")
+
+        if not rows:
+            return []
+
+        df = pd.DataFrame([flatten_external(row) for row in rows])
+
+        for flag in ['is_weekend', 'is_holiday', 'promo_active', 'promo_upcoming']:
+            if flag in df.columns:
+                df[flag] = df[flag].astype(int)
+
+        self._encode_categories(df, self.categorical_features)
+
+        X = df.reindex(columns=self.feature_names)
+        price_preds = self.price_model.predict(X)
+        sales_preds = self.sales_model.predict(X)
+
+        predictions = [
+            {"predicted_price": float(price), "predicted_sales": float(sales)}
+            for price, sales in zip(price_preds, sales_preds)
+        ]
+        for target, model in self.target_models.items():
+            for prediction, value in zip(predictions, model.predict(X)):
+                prediction.setdefault("targets", {})[target] = float(value)
+        return predictions
+
+    def explain(self, product_data: Dict[str, Any]) -> Dict[str, Any]:
+        """
+        Attribute the price and sales predictions of a product to its features with SHAP values,
+        computed by LightGBM's TreeSHAP
+
+        Args:
+            product_data: Dictionary with product features
+
+        Returns:
+            Dictionary with the base value and the per-feature contributions of both models
+        """
+        if self.price_model is None or self.sales_model is None:
+            if not self.load_models():
+                raise ValueError("Models not trained or loaded properly")
+
+        df = pd.DataFrame([flatten_external(product_data)])
+
+        for flag in ['is_weekend', 'is_holiday', 'promo_active', 'promo_upcoming']:
+            if flag in df.columns:
+                df[flag] = df[flag].astype(int)
+
+        self._encode_categories(df, self.categorical_features)
+
+        X = df.reindex(columns=self.feature_names)
+        explanation = {}
+        for name, model in [("price", self.price_model), ("sales", self.sales_model)]:
+            # One row of contributions, one per feature followed by the expected value
+            contributions = np.asarray(model.predict(X, pred_contrib=True))[0]
+            explanation[f"{name}_base_value"] = float(contributions[-1])
+            explanation[f"{name}_contributions"] = {
+                feature: float(value) for feature, value in zip(self.feature_names, contributions[:-1])
+            }
+        return explanation
 
 def main():
     """
@@ -318,22 +989,53 @@ def main():
         print(f"INFO: {msg}")
     
     parser = argparse.ArgumentParser(description="LightGBM Model for Product Price and Sales Prediction")
-    parser.add_argument("action", choices=["train", "predict"], help="Action to perform: train or predict")
-    parser.add_argument("train_data", help="Path to training data CSV for training or JSON string for prediction")
+    parser.add_argument("action", choices=["train", "predict", "predict_batch", "explain"], help="Action to perform: train, predict, predict_batch or explain")
+    parser.add_argument("train_data", help="Path to training data CSV for training, JSON string for prediction and explanation or path to a JSON array file for batch prediction")
     parser.add_argument("--val-data", help="Path to validation data CSV (required for training)")
+    parser.add_argument("--promotions", help="Path to a JSON array of planned promotions used to derive promotion features for training")
+    parser.add_argument("--seller-stats", help="Path to a JSON array of per-seller stats used to derive seller features for training")
+    parser.add_argument("--lag-mode", choices=[LAG_MODE_CALENDAR, LAG_MODE_BUSINESS], default=LAG_MODE_CALENDAR, help="Count lag features over calendar or business days (training only)")
+    parser.add_argument("--holidays", help="Path to a holiday calendar, one YYYY-MM-DD date per line, skipped by business-day lags")
+    parser.add_argument("--interpolation", choices=[INTERPOLATION_NONE, INTERPOLATION_FFILL, INTERPOLATION_LINEAR], default=INTERPOLATION_NONE, help="Fill days missing from the history of lag features (training only)")
+    parser.add_argument("--targets", help="Comma-separated targets to train besides price and sales, each read from its <name>_target column (training only)")
+    parser.add_argument("--window", choices=[WINDOW_EXPANDING, WINDOW_SLIDING], default=WINDOW_EXPANDING, help="Train on all rows or on a sliding window of the latest rows (training only)")
+    parser.add_argument("--window-days", type=int, default=365, help="Length of the sliding training window in days")
+    parser.add_argument("--early-stopping-rounds", type=int, default=50, help="Stop boosting after this many rounds without a better validation score (training only)")
+    parser.add_argument("--sample-percent", type=float, default=0, help="Fast train on a random percent of the training rows (training only)")
+    parser.add_argument("--sample-days", type=int, default=0, help="Fast train on the last days of the training rows (training only)")
+    parser.add_argument("--unseen-policy", choices=[UNSEEN_MISSING, UNSEEN_OTHER, UNSEEN_FREQUENCY, UNSEEN_REJECT], default=UNSEEN_MISSING, help="Encode categories unseen in training as missing, as the other category, as the rarest category, or reject them (training only)")
+    parser.add_argument("--encoder-min-count", type=int, default=1, help="Training rows a category needs to be encoded on its own (training only)")
+    parser.add_argument("--max-rows", type=int, default=0, help="Downsample the training rows within every category past this many rows, 0 for no limit (training only)")
+    parser.add_argument("--max-bytes", type=int, default=0, help="Downsample the training rows within every category when the training file is larger, 0 for no limit (training only)")
     parser.add_argument("--model-dir", default="models", help="Directory for model files")
+    parser.add_argument("--output", help="Path to write batch prediction results to (required for predict_batch)")
 
     args = parser.parse_args()
     log_info(f"Запуск с параметрами: action={args.action}, data={args.train_data}, model_dir={args.model_dir}")
 
-    predictor = LightGBMPredictor(model_dir=args.model_dir)
+    holidays = load_holidays(args.holidays) if args.holidays else set()
+    targets = [t.strip() for t in args.targets.split(',') if t.strip()] if args.targets else []
+    predictor = LightGBMPredictor(model_dir=args.model_dir, lag_mode=args.lag_mode, holidays=holidays,
+                                  interpolation=args.interpolation, targets=targets, window=args.window,
+                                  window_days=args.window_days, early_stopping_rounds=args.early_stopping_rounds,
+                                  sample_percent=args.sample_percent, sample_days=args.sample_days,
+                                  unseen_policy=args.unseen_policy, encoder_min_count=args.encoder_min_count,
+                                  max_rows=args.max_rows, max_bytes=args.max_bytes)
 
     if args.action == "train":
         if not args.val_data:
             log_info("ОШИБКА: необходимо указать путь к валидационным данным с помощью --val-data")
             sys.exit(1)
         log_info(f"Запуск обучения моделей с данными: {args.train_data} и {args.val_data}")
-        metrics = predictor.train(args.train_data, args.val_data)
+        promotions = []
+        if args.promotions:
+            with open(args.promotions, 'r') as f:
+                promotions = json.load(f)
+        seller_stats = []
+        if args.seller_stats:
+            with open(args.seller_stats, 'r') as f:
+                seller_stats = json.load(f)
+        metrics = predictor.train(args.train_data, args.val_data, promotions, seller_stats)
         # Note: train() function now handles the printing of the metrics JSON
     elif args.action == "predict":
         try:
@@ -350,6 +1052,35 @@ def main():
             log_info(f"ОШИБКА при предсказании: {str(e)}")
             print(json.dumps({"error": str(e)}))
             sys.exit(1)
+    elif args.action == "explain":
+        try:
+            product_data = json.loads(args.train_data)
+            log_info("Запуск объяснения предсказания для данных продукта")
+            print(json.dumps(predictor.explain(product_data)))
+        except json.JSONDecodeError:
+            log_info("ОШИБКА: некорректный формат JSON для объяснения")
+            print(json.dumps({"error": "Invalid JSON input for explanation"}))
+            sys.exit(1)
+        except Exception as e:
+            log_info(f"ОШИБКА при объяснении предсказания: {str(e)}")
+            print(json.dumps({"error": str(e)}))
+            sys.exit(1)
+    elif args.action == "predict_batch":
+        if not args.output:
+            log_info("ОШИБКА: необходимо указать путь к файлу результатов с помощью --output")
+            sys.exit(1)
+        try:
+            with open(args.train_data, 'r') as f:
+                rows = json.load(f)
+            log_info(f"Запуск пакетного предсказания для {len(rows)} записей")
+            predictions = predictor.predict_batch(rows)
+            with open(args.output, 'w') as f:
+                json.dump({"predictions": predictions}, f)
+            print(json.dumps({"count": len(predictions)}))
+        except Exception as e:
+            log_info(f"ОШИБКА при пакетном предсказании: {str(e)}")
+            print(json.dumps({"error": str(e)}))
+            sys.exit(1)
 
 if __name__ == "__main__":
     main()
\ No newline at end of file
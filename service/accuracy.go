@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/evaluation"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// Segments the accuracy of forecasts can be broken down by
+const (
+	AccuracyGroupCategory = "category"
+	AccuracyGroupRegion   = "region"
+	AccuracyGroupSeller   = "seller"
+)
+
+// ErrInvalidAccuracyRequest is returned when a forecast accuracy request fails validation
+var ErrInvalidAccuracyRequest = errors.New("invalid accuracy request")
+
+// AccuracyRequest selects the forecasts whose accuracy is reported
+type AccuracyRequest struct {
+	// From and To bound the forecast dates; zero values leave the range open
+	From         time.Time
+	To           time.Time
+	ModelVersion string
+	// GroupBy is empty or one of the AccuracyGroup segments
+	GroupBy string
+}
+
+// AccuracyMetrics are the error metrics of a set of forecasts against their actuals. Price metrics
+// only cover the forecasts whose price on the last day of the horizon is known
+type AccuracyMetrics struct {
+	Forecasts      int64              `json:"forecasts"`
+	PriceForecasts int64              `json:"price_forecasts"`
+	Price          map[string]float64 `json:"price"`
+	Sales          map[string]float64 `json:"sales"`
+}
+
+// AccuracySegment is the accuracy of the forecasts of one category, region or seller
+type AccuracySegment struct {
+	Segment string `json:"segment"`
+	AccuracyMetrics
+}
+
+// AccuracyReport is the accuracy of the stored forecasts with actuals, overall and per segment
+type AccuracyReport struct {
+	Metrics      []string          `json:"metrics"`
+	From         *time.Time        `json:"from,omitempty"`
+	To           *time.Time        `json:"to,omitempty"`
+	ModelVersion string            `json:"model_version,omitempty"`
+	GroupBy      string            `json:"group_by,omitempty"`
+	Overall      AccuracyMetrics   `json:"overall"`
+	Segments     []AccuracySegment `json:"segments,omitempty"`
+}
+
+// accuracyAccumulator accumulates the price and sales errors of forecasts
+type accuracyAccumulator struct {
+	price evaluation.Accumulator
+	sales evaluation.Accumulator
+}
+
+// add records a forecast with its actuals
+func (a *accuracyAccumulator) add(f *repository.ForecastActual) {
+	a.sales.Add(f.ActualSales, f.PredictedSales)
+	if f.ActualPrice != nil {
+		a.price.Add(*f.ActualPrice, f.PredictedPrice)
+	}
+}
+
+// metrics evaluates the accumulated errors with the metric set
+func (a *accuracyAccumulator) metrics(set evaluation.MetricSet) AccuracyMetrics {
+	return AccuracyMetrics{
+		Forecasts:      a.sales.Count(),
+		PriceForecasts: a.price.Count(),
+		Price:          set.Evaluate(&a.price),
+		Sales:          set.Evaluate(&a.sales),
+	}
+}
+
+// Accuracy reports the configured error metrics of the stored forecasts with actuals, optionally
+// broken down by category, region or seller. Segments are ordered by number of forecasts
+func (s *ForecastService) Accuracy(request *AccuracyRequest) (*AccuracyReport, error) {
+	switch request.GroupBy {
+	case "", AccuracyGroupCategory, AccuracyGroupRegion, AccuracyGroupSeller:
+	default:
+		return nil, fmt.Errorf("%w: group_by must be %s, %s or %s", ErrInvalidAccuracyRequest,
+			AccuracyGroupCategory, AccuracyGroupRegion, AccuracyGroupSeller)
+	}
+	if !request.From.IsZero() && !request.To.IsZero() && request.To.Before(request.From) {
+		return nil, fmt.Errorf("%w: to must not be before from", ErrInvalidAccuracyRequest)
+	}
+
+	report, err := forecastAccuracy(s.postgresRepo, s.metrics, repository.ForecastActualFilter{
+		From:         request.From,
+		To:           request.To,
+		ModelVersion: request.ModelVersion,
+	}, request.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	if !request.From.IsZero() {
+		report.From = &request.From
+	}
+	if !request.To.IsZero() {
+		report.To = &request.To
+	}
+	report.ModelVersion = request.ModelVersion
+	return report, nil
+}
+
+// ForecastActualSource streams the forecasts whose actuals are known, which accuracy is measured
+// on. PostgresRepository implements it
+type ForecastActualSource interface {
+	EachForecastActual(filter repository.ForecastActualFilter, fn func(*repository.ForecastActual) error) error
+}
+
+// forecastAccuracy evaluates the forecasts matching the filter with the metric set, grouped by
+// the groupBy segment unless it is empty
+func forecastAccuracy(postgresRepo ForecastActualSource, set evaluation.MetricSet,
+	filter repository.ForecastActualFilter, groupBy string) (*AccuracyReport, error) {
+	var overall accuracyAccumulator
+	segments := make(map[string]*accuracyAccumulator)
+
+	err := postgresRepo.EachForecastActual(filter, func(f *repository.ForecastActual) error {
+		overall.add(f)
+
+		var segment string
+		switch groupBy {
+		case AccuracyGroupCategory:
+			segment = f.Category
+		case AccuracyGroupRegion:
+			segment = f.Region
+		case AccuracyGroupSeller:
+			segment = f.Seller
+		default:
+			return nil
+		}
+		accumulator, ok := segments[segment]
+		if !ok {
+			accumulator = &accuracyAccumulator{}
+			segments[segment] = accumulator
+		}
+		accumulator.add(f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AccuracyReport{
+		Metrics: set,
+		GroupBy: groupBy,
+		Overall: overall.metrics(set),
+	}
+	for segment, accumulator := range segments {
+		report.Segments = append(report.Segments, AccuracySegment{
+			Segment:         segment,
+			AccuracyMetrics: accumulator.metrics(set),
+		})
+	}
+	sort.Slice(report.Segments, func(i, j int) bool {
+		a, b := report.Segments[i], report.Segments[j]
+		if a.Forecasts != b.Forecasts {
+			return a.Forecasts > b.Forecasts
+		}
+		return a.Segment < b.Segment
+	})
+	return report, nil
+}
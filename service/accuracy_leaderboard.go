@@ -0,0 +1,236 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/evaluation"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// Forecast targets a leaderboard can rank by
+const (
+	AccuracyTargetPrice = "price"
+	AccuracyTargetSales = "sales"
+)
+
+const (
+	defaultLeaderboardDays         = 30
+	maxLeaderboardDays             = 365
+	defaultLeaderboardLimit        = 10
+	maxLeaderboardLimit            = 100
+	defaultLeaderboardMinForecasts = 3
+)
+
+// LeaderboardRequest selects the window and ranking of an accuracy leaderboard; zero values take
+// the defaults
+type LeaderboardRequest struct {
+	// Days is the window of forecast dates ending today
+	Days int
+	// Limit is the number of products on each side of the leaderboard
+	Limit int
+	// Target is AccuracyTargetSales by default
+	Target string
+	// Metric ranks the products, evaluation.WAPE by default; bias ranks by magnitude
+	Metric string
+	// MinForecasts leaves out products with fewer forecasts with actuals in the window
+	MinForecasts int
+}
+
+// LeaderboardCoverage is the history a product had over the leaderboard window
+type LeaderboardCoverage struct {
+	Observations int64 `json:"observations"`
+	// MissingDays are the days of the window without a history row
+	MissingDays   int64      `json:"missing_days"`
+	GapPercentage float64    `json:"gap_percentage"`
+	LastDate      *time.Time `json:"last_date,omitempty"`
+}
+
+// LeaderboardEntry is the accuracy of the forecasts of one product, region and seller
+type LeaderboardEntry struct {
+	ProductName string `json:"product_name"`
+	Region      string `json:"region"`
+	Seller      string `json:"seller"`
+	Category    string `json:"category"`
+	Forecasts   int64  `json:"forecasts"`
+	// Error is the value of the ranking metric
+	Error    float64             `json:"error"`
+	Metrics  map[string]float64  `json:"metrics"`
+	Coverage LeaderboardCoverage `json:"coverage"`
+}
+
+// AccuracyLeaderboard lists the best- and worst-forecasted products of a window. With fewer than
+// twice Limit ranked products the two lists overlap
+type AccuracyLeaderboard struct {
+	From         time.Time          `json:"from"`
+	To           time.Time          `json:"to"`
+	Target       string             `json:"target"`
+	Metric       string             `json:"metric"`
+	MinForecasts int                `json:"min_forecasts"`
+	Products     int                `json:"products"`
+	Best         []LeaderboardEntry `json:"best"`
+	Worst        []LeaderboardEntry `json:"worst"`
+}
+
+// leaderboardProduct accumulates the errors of a product's forecasts for the leaderboard
+type leaderboardProduct struct {
+	category    string
+	accumulator evaluation.Accumulator
+}
+
+// AccuracyLeaderboard ranks the products by the error of their forecasts with actuals over the
+// last Days days, and returns the Limit best and worst with the coverage of their history over
+// the same window, so that poor accuracy can be told apart from poor data
+func (s *ForecastService) AccuracyLeaderboard(request *LeaderboardRequest) (*AccuracyLeaderboard, error) {
+	days, limit, minForecasts := request.Days, request.Limit, request.MinForecasts
+	target, metric := request.Target, request.Metric
+	if days == 0 {
+		days = defaultLeaderboardDays
+	}
+	if limit == 0 {
+		limit = defaultLeaderboardLimit
+	}
+	if minForecasts == 0 {
+		minForecasts = defaultLeaderboardMinForecasts
+	}
+	if target == "" {
+		target = AccuracyTargetSales
+	}
+	if metric == "" {
+		metric = evaluation.WAPE
+	}
+	if days < 1 || days > maxLeaderboardDays {
+		return nil, fmt.Errorf("%w: days must be between 1 and %d", ErrInvalidAccuracyRequest, maxLeaderboardDays)
+	}
+	if limit < 1 || limit > maxLeaderboardLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidAccuracyRequest, maxLeaderboardLimit)
+	}
+	if minForecasts < 1 {
+		return nil, fmt.Errorf("%w: min_forecasts must be positive", ErrInvalidAccuracyRequest)
+	}
+	if target != AccuracyTargetSales && target != AccuracyTargetPrice {
+		return nil, fmt.Errorf("%w: target must be %s or %s", ErrInvalidAccuracyRequest, AccuracyTargetSales, AccuracyTargetPrice)
+	}
+	if !evaluation.IsMetric(metric) {
+		return nil, fmt.Errorf("%w: unknown metric %q", ErrInvalidAccuracyRequest, metric)
+	}
+
+	to := time.Now().Truncate(24 * time.Hour)
+	from := to.AddDate(0, 0, 1-days)
+
+	keys := make(map[[3]string]*leaderboardProduct)
+	err := s.postgresRepo.EachForecastActual(repository.ForecastActualFilter{From: from, To: to}, func(f *repository.ForecastActual) error {
+		actual, predicted := f.ActualSales, f.PredictedSales
+		if target == AccuracyTargetPrice {
+			if f.ActualPrice == nil {
+				return nil
+			}
+			actual, predicted = *f.ActualPrice, f.PredictedPrice
+		}
+		key := [3]string{f.ProductName, f.Region, f.Seller}
+		product, ok := keys[key]
+		if !ok {
+			product = &leaderboardProduct{category: f.Category}
+			keys[key] = product
+		}
+		product.accumulator.Add(actual, predicted)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ranked []LeaderboardEntry
+	for key, product := range keys {
+		if product.accumulator.Count() < int64(minForecasts) {
+			continue
+		}
+		value, ok := product.accumulator.Metric(metric)
+		if !ok {
+			continue
+		}
+		ranked = append(ranked, LeaderboardEntry{
+			ProductName: key[0],
+			Region:      key[1],
+			Seller:      key[2],
+			Category:    product.category,
+			Forecasts:   product.accumulator.Count(),
+			Error:       value,
+			Metrics:     s.metrics.Evaluate(&product.accumulator),
+		})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := math.Abs(ranked[i].Error), math.Abs(ranked[j].Error)
+		if a != b {
+			return a < b
+		}
+		if ranked[i].ProductName != ranked[j].ProductName {
+			return ranked[i].ProductName < ranked[j].ProductName
+		}
+		if ranked[i].Region != ranked[j].Region {
+			return ranked[i].Region < ranked[j].Region
+		}
+		return ranked[i].Seller < ranked[j].Seller
+	})
+
+	leaderboard := &AccuracyLeaderboard{
+		From:         from,
+		To:           to,
+		Target:       target,
+		Metric:       metric,
+		MinForecasts: minForecasts,
+		Products:     len(ranked),
+		Best:         make([]LeaderboardEntry, 0, limit),
+		Worst:        make([]LeaderboardEntry, 0, limit),
+	}
+	for i := 0; i < limit && i < len(ranked); i++ {
+		leaderboard.Best = append(leaderboard.Best, ranked[i])
+		leaderboard.Worst = append(leaderboard.Worst, ranked[len(ranked)-1-i])
+	}
+
+	if err := s.addLeaderboardCoverage(leaderboard, days); err != nil {
+		return nil, err
+	}
+	return leaderboard, nil
+}
+
+// addLeaderboardCoverage fills in the history coverage of the leaderboard's entries
+func (s *ForecastService) addLeaderboardCoverage(leaderboard *AccuracyLeaderboard, days int) error {
+	var products, regions, sellers []string
+	for _, entries := range [][]LeaderboardEntry{leaderboard.Best, leaderboard.Worst} {
+		for _, entry := range entries {
+			products = append(products, entry.ProductName)
+			regions = append(regions, entry.Region)
+			sellers = append(sellers, entry.Seller)
+		}
+	}
+	if len(products) == 0 {
+		return nil
+	}
+
+	rows, err := s.postgresRepo.GetWindowCoverage(products, regions, sellers, leaderboard.From, leaderboard.To)
+	if err != nil {
+		return err
+	}
+	coverage := make(map[[3]string]LeaderboardCoverage, len(rows))
+	for _, row := range rows {
+		c := LeaderboardCoverage{
+			Observations:  row.Observations,
+			MissingDays:   int64(days) - row.Days,
+			GapPercentage: 100 * float64(int64(days)-row.Days) / float64(days),
+		}
+		if row.LastDate.Valid {
+			c.LastDate = &row.LastDate.Time
+		}
+		coverage[[3]string{row.ProductName, row.Region, row.Seller}] = c
+	}
+
+	for _, entries := range [][]LeaderboardEntry{leaderboard.Best, leaderboard.Worst} {
+		for i := range entries {
+			entries[i].Coverage = coverage[[3]string{entries[i].ProductName, entries[i].Region, entries[i].Seller}]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAPIUsageDays = 7
+	maxAPIUsageDays     = 366
+)
+
+// ErrInvalidUsageRequest is returned when an API usage report request fails validation
+var ErrInvalidUsageRequest = errors.New("invalid usage request")
+
+// APIUsageRecord is a served request as usage analytics count it
+type APIUsageRecord struct {
+	// Client identifies the caller by API key hash or user agent
+	Client        string
+	Method        string
+	Route         string
+	StatusCode    int
+	Duration      time.Duration
+	RequestBytes  int64
+	ResponseBytes int64
+	At            time.Time
+}
+
+// APIUsageRequest selects the days and clients of a usage report; zero dates default to the last
+// defaultAPIUsageDays days. ByRoute breaks the usage of each client down by route
+type APIUsageRequest struct {
+	From    time.Time
+	To      time.Time
+	Client  string
+	Route   string
+	ByRoute bool
+	Limit   int
+}
+
+// APIUsageSummary is the usage of a client, or of a route by a client, over the days of a report
+type APIUsageSummary struct {
+	Client       string `json:"client"`
+	Method       string `json:"method,omitempty"`
+	Route        string `json:"route,omitempty"`
+	Requests     int64  `json:"requests"`
+	ClientErrors int64  `json:"client_errors"`
+	ServerErrors int64  `json:"server_errors"`
+	// ErrorRate is the share of requests answered with a 4xx or 5xx status, from 0 to 1
+	ErrorRate     float64 `json:"error_rate"`
+	AvgLatencyMs  float64 `json:"avg_latency_ms"`
+	MaxLatencyMs  float64 `json:"max_latency_ms"`
+	RequestBytes  int64   `json:"request_bytes"`
+	ResponseBytes int64   `json:"response_bytes"`
+}
+
+// APIUsageReport is the usage of the clients over a range of days, the heaviest first
+type APIUsageReport struct {
+	From  time.Time         `json:"from"`
+	To    time.Time         `json:"to"`
+	Items []APIUsageSummary `json:"items"`
+}
+
+// apiUsageKey identifies an hourly usage bucket
+type apiUsageKey struct {
+	bucket time.Time
+	client string
+	method string
+	route  string
+}
+
+// APIUsageStore holds the hourly and daily request counts. PostgresRepository implements it
+type APIUsageStore interface {
+	UpsertAPIUsage(buckets []repository.APIUsageBucket) error
+	RollupAPIUsage(before, prune time.Time) (int64, int64, error)
+	ListAPIUsage(filter repository.APIUsageFilter, byRoute bool, limit int) ([]repository.APIUsageSummary, error)
+}
+
+// APIUsage counts the requests of every client by route. Requests are summed in memory into hourly
+// buckets, which are added to the api_usage table every flush interval, so that tracking costs a
+// map update per request. The usage_rollup job sums the hourly buckets of past days into
+// api_usage_daily and prunes those older than the retention
+type APIUsage struct {
+	postgresRepo  APIUsageStore
+	interval      time.Duration
+	retentionDays int
+	logger        *zap.SugaredLogger
+
+	mu      sync.Mutex
+	pending map[apiUsageKey]*repository.APIUsageBucket
+}
+
+// NewAPIUsage creates usage analytics flushed every interval, keeping retentionDays days of hourly
+// buckets
+func NewAPIUsage(postgresRepo APIUsageStore, interval time.Duration, retentionDays int, logger *zap.SugaredLogger) *APIUsage {
+	return &APIUsage{
+		postgresRepo:  postgresRepo,
+		interval:      interval,
+		retentionDays: retentionDays,
+		logger:        logger,
+		pending:       make(map[apiUsageKey]*repository.APIUsageBucket),
+	}
+}
+
+// Record counts a served request in the bucket of its hour
+func (u *APIUsage) Record(record *APIUsageRecord) {
+	key := apiUsageKey{
+		bucket: record.At.UTC().Truncate(time.Hour),
+		client: record.Client,
+		method: record.Method,
+		route:  record.Route,
+	}
+	durationMs := float64(record.Duration) / float64(time.Millisecond)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	bucket, ok := u.pending[key]
+	if !ok {
+		bucket = &repository.APIUsageBucket{Bucket: key.bucket, Client: key.client, Method: key.method, Route: key.route}
+		u.pending[key] = bucket
+	}
+	bucket.Requests++
+	switch {
+	case record.StatusCode >= 500:
+		bucket.ServerErrors++
+	case record.StatusCode >= 400:
+		bucket.ClientErrors++
+	}
+	bucket.DurationMs += durationMs
+	bucket.MaxDurationMs = math.Max(bucket.MaxDurationMs, durationMs)
+	bucket.RequestBytes += record.RequestBytes
+	bucket.ResponseBytes += record.ResponseBytes
+}
+
+// Start flushes the recorded usage every interval until the context is cancelled. The last
+// buckets are flushed by calling Flush at shutdown, once the HTTP server has stopped
+func (u *APIUsage) Start(ctx context.Context) {
+	ticker := time.NewTicker(u.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := u.Flush(); err != nil {
+				u.logger.Errorw("Failed to store API usage", "error", err)
+			}
+		}
+	}
+}
+
+// Flush adds the usage recorded since the previous flush to the database. Buckets that fail to be
+// stored are kept for the next flush
+func (u *APIUsage) Flush() error {
+	u.mu.Lock()
+	pending := u.pending
+	u.pending = make(map[apiUsageKey]*repository.APIUsageBucket)
+	u.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	buckets := make([]repository.APIUsageBucket, 0, len(pending))
+	for _, bucket := range pending {
+		buckets = append(buckets, *bucket)
+	}
+	if err := u.postgresRepo.UpsertAPIUsage(buckets); err != nil {
+		u.restore(pending)
+		return err
+	}
+	return nil
+}
+
+// restore merges buckets that could not be stored back into the pending ones
+func (u *APIUsage) restore(buckets map[apiUsageKey]*repository.APIUsageBucket) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for key, b := range buckets {
+		pending, ok := u.pending[key]
+		if !ok {
+			u.pending[key] = b
+			continue
+		}
+		pending.Requests += b.Requests
+		pending.ClientErrors += b.ClientErrors
+		pending.ServerErrors += b.ServerErrors
+		pending.DurationMs += b.DurationMs
+		pending.MaxDurationMs = math.Max(pending.MaxDurationMs, b.MaxDurationMs)
+		pending.RequestBytes += b.RequestBytes
+		pending.ResponseBytes += b.ResponseBytes
+	}
+}
+
+// Rollup sums the hourly usage of the days before today, in UTC, into daily usage and deletes the
+// hourly buckets older than the retention. Days are rolled up again while their hourly buckets are
+// kept, so requests flushed late by another replica are counted on the next run
+func (u *APIUsage) Rollup(ctx context.Context) error {
+	if err := u.Flush(); err != nil {
+		u.logger.Warnw("Failed to store API usage before the rollup", "error", err)
+	}
+
+	today := calendarDay(time.Now().UTC())
+	rolledUp, pruned, err := u.postgresRepo.RollupAPIUsage(today, today.AddDate(0, 0, -u.retentionDays))
+	if err != nil {
+		return err
+	}
+	u.logger.Infow("API usage rolled up", "daily_rows", rolledUp, "pruned_hourly_rows", pruned,
+		"retention_days", u.retentionDays)
+	return nil
+}
+
+// Report returns the usage of the clients over the days of the request, the most requests first.
+// Usage still held in memory by the replicas is not included until their next flush
+func (u *APIUsage) Report(request *APIUsageRequest) (*APIUsageReport, error) {
+	to := request.To
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	to = calendarDay(to)
+	from := request.From
+	if from.IsZero() {
+		from = to.AddDate(0, 0, 1-defaultAPIUsageDays)
+	}
+	from = calendarDay(from)
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: to must not be before from", ErrInvalidUsageRequest)
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxAPIUsageDays {
+		return nil, fmt.Errorf("%w: the range may cover at most %d days", ErrInvalidUsageRequest, maxAPIUsageDays)
+	}
+
+	rows, err := u.postgresRepo.ListAPIUsage(repository.APIUsageFilter{
+		From:   from,
+		To:     to,
+		Client: request.Client,
+		Route:  request.Route,
+	}, request.ByRoute, request.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &APIUsageReport{From: from, To: to, Items: make([]APIUsageSummary, 0, len(rows))}
+	for _, row := range rows {
+		summary := APIUsageSummary{
+			Client:        row.Client,
+			Method:        row.Method,
+			Route:         row.Route,
+			Requests:      row.Requests,
+			ClientErrors:  row.ClientErrors,
+			ServerErrors:  row.ServerErrors,
+			MaxLatencyMs:  row.MaxDurationMs,
+			RequestBytes:  row.RequestBytes,
+			ResponseBytes: row.ResponseBytes,
+		}
+		if row.Requests > 0 {
+			summary.ErrorRate = float64(row.ClientErrors+row.ServerErrors) / float64(row.Requests)
+			summary.AvgLatencyMs = row.DurationMs / float64(row.Requests)
+		}
+		report.Items = append(report.Items, summary)
+	}
+	return report, nil
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// Batch prediction statuses
+const (
+	BatchStatusPending   = "pending"
+	BatchStatusRunning   = "running"
+	BatchStatusCompleted = "completed"
+	BatchStatusFailed    = "failed"
+)
+
+// Callback delivery statuses
+const (
+	CallbackStatusPending   = "pending"
+	CallbackStatusDelivered = "delivered"
+	CallbackStatusFailed    = "failed"
+)
+
+// ErrCallbacksDisabled is returned when an async batch is submitted without a callback signing secret
+var ErrCallbacksDisabled = errors.New("callbacks are not configured, set BATCH_CALLBACK_SECRET")
+
+// asyncBatchChunkSize is the number of items predicted per model pass in an async batch
+const asyncBatchChunkSize = 100
+
+// BatchItemRenderer converts the outcome of a batch item into the representation sent to the client
+// and reports whether the item succeeded
+type BatchItemRenderer func(result *BatchItemResult) (item any, succeeded bool)
+
+// BatchCallback describes the delivery of a batch's results to its callback URL
+type BatchCallback struct {
+	URL      string `json:"url"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BatchPrediction represents the state of an async batch prediction
+type BatchPrediction struct {
+	ID          int64         `json:"id"`
+	Status      string        `json:"status"`
+	ItemCount   int           `json:"item_count"`
+	Succeeded   int           `json:"succeeded"`
+	Failed      int           `json:"failed"`
+	Error       string        `json:"error,omitempty"`
+	Callback    BatchCallback `json:"callback"`
+	CreatedAt   time.Time     `json:"created_at"`
+	CompletedAt *time.Time    `json:"completed_at,omitempty"`
+	// ResultsLink is a short-lived download link of the results file, when result files are enabled
+	ResultsLink *ResultLink `json:"results_link,omitempty"`
+}
+
+// BatchCallbackPayload is the body POSTed to the callback URL once a batch is done. The items are
+// inline unless they exceed the inline size limit, in which case ResultsURL points at them
+type BatchCallbackPayload struct {
+	BatchID    int64           `json:"batch_id"`
+	Status     string          `json:"status"`
+	Succeeded  int             `json:"succeeded"`
+	Failed     int             `json:"failed"`
+	Error      string          `json:"error,omitempty"`
+	Items      json.RawMessage `json:"items,omitempty"`
+	ResultsURL string          `json:"results_url,omitempty"`
+}
+
+// BatchPredictionStore holds background batch predictions, their results and callback state.
+// PostgresRepository implements it
+type BatchPredictionStore interface {
+	CreateBatchPrediction(itemCount int, callbackURL string) (int64, error)
+	GetBatchPrediction(id int64) (*repository.BatchPrediction, error)
+	UpdateBatchPredictionStatus(id int64, status string, errMsg string) error
+	SaveBatchPredictionResults(id int64, results []byte, succeeded, failed int) error
+	SetBatchResultsKey(id int64, key string) error
+	GetBatchPredictionResults(id int64) ([]byte, error)
+	UpdateBatchCallback(id int64, status string, attempts int, errMsg string) error
+}
+
+// AsyncBatchService runs batch predictions in the background and delivers their results to a callback
+type AsyncBatchService struct {
+	mlService      *MLPredictionService
+	postgresRepo   BatchPredictionStore
+	callbacks      *CallbackSender
+	results        *ResultFiles
+	workers        *WorkerPool
+	timeout        time.Duration
+	maxInlineBytes int
+	publicBaseURL  string
+	lifecycle      *Lifecycle
+	logger         *zap.SugaredLogger
+}
+
+// NewAsyncBatchService creates a new async batch service. publicBaseURL is the externally reachable
+// address of the service, used to build results links for callbacks
+func NewAsyncBatchService(mlService *MLPredictionService, postgresRepo BatchPredictionStore, callbacks *CallbackSender, results *ResultFiles, workers *WorkerPool, timeout time.Duration, maxInlineBytes int, publicBaseURL string, lifecycle *Lifecycle, logger *zap.SugaredLogger) *AsyncBatchService {
+	return &AsyncBatchService{
+		mlService:      mlService,
+		postgresRepo:   postgresRepo,
+		callbacks:      callbacks,
+		results:        results,
+		workers:        workers,
+		timeout:        timeout,
+		maxInlineBytes: maxInlineBytes,
+		publicBaseURL:  publicBaseURL,
+		lifecycle:      lifecycle,
+		logger:         logger,
+	}
+}
+
+// Submit stores a batch prediction and runs it in the background. nil requests mark items the caller
+// already rejected, which render reports as failed
+func (s *AsyncBatchService) Submit(ctx context.Context, requests []*PredictionRequestMinimal, callbackURL string, render BatchItemRenderer) (*BatchPrediction, error) {
+	if !s.callbacks.Enabled() {
+		return nil, ErrCallbacksDisabled
+	}
+	if err := s.callbacks.Validate(ctx, callbackURL); err != nil {
+		return nil, err
+	}
+
+	done, err := s.lifecycle.BeginJob()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.postgresRepo.CreateBatchPrediction(len(requests), callbackURL)
+	if err != nil {
+		done()
+		return nil, err
+	}
+
+	go func() {
+		defer done()
+		s.run(id, requests, callbackURL, render)
+	}()
+
+	return s.Get(id)
+}
+
+// Get returns an async batch prediction by ID, or nil if it does not exist
+func (s *AsyncBatchService) Get(id int64) (*BatchPrediction, error) {
+	batch, err := s.postgresRepo.GetBatchPrediction(id)
+	if err != nil || batch == nil {
+		return nil, err
+	}
+
+	prediction := &BatchPrediction{
+		ID:        batch.ID,
+		Status:    batch.Status,
+		ItemCount: batch.ItemCount,
+		Succeeded: batch.Succeeded,
+		Failed:    batch.Failed,
+		Error:     batch.Error,
+		Callback: BatchCallback{
+			URL:      batch.CallbackURL,
+			Status:   batch.CallbackStatus,
+			Attempts: batch.CallbackAttempts,
+			Error:    batch.CallbackError,
+		},
+		CreatedAt:   batch.CreatedAt,
+		CompletedAt: batch.CompletedAt,
+	}
+	if batch.ResultsKey != "" && s.results.Enabled() {
+		prediction.ResultsLink = s.results.Link(batch.ResultsKey)
+	}
+	return prediction, nil
+}
+
+// Results returns the rendered result items of a completed batch as a JSON array
+func (s *AsyncBatchService) Results(id int64) (json.RawMessage, error) {
+	return s.postgresRepo.GetBatchPredictionResults(id)
+}
+
+// ResultsURL returns the externally reachable address of a batch's results
+func (s *AsyncBatchService) ResultsURL(id int64) string {
+	return fmt.Sprintf("%s/api/v2/predictions/batch/%d/results", s.publicBaseURL, id)
+}
+
+// run predicts a stored batch, records its outcome and delivers it to the callback
+func (s *AsyncBatchService) run(id int64, requests []*PredictionRequestMinimal, callbackURL string, render BatchItemRenderer) {
+	// Background predictions yield Python processes to interactive requests
+	ctx, cancel := context.WithTimeout(WithInferencePriority(s.lifecycle.Context(), PriorityBatch), s.timeout)
+	defer cancel()
+
+	if err := s.postgresRepo.UpdateBatchPredictionStatus(id, BatchStatusRunning, ""); err != nil {
+		s.logger.Errorw("Failed to mark batch prediction as running", "error", err, "batch_id", id)
+	}
+
+	started := time.Now()
+	payload := &BatchCallbackPayload{BatchID: id, Status: BatchStatusCompleted}
+	items, err := s.predict(ctx, requests, func(result *BatchItemResult) any {
+		item, succeeded := render(result)
+		if succeeded {
+			payload.Succeeded++
+		} else {
+			payload.Failed++
+		}
+		return item
+	})
+	if err == nil {
+		payload.Items, err = json.Marshal(items)
+	}
+	if err == nil {
+		err = s.postgresRepo.SaveBatchPredictionResults(id, payload.Items, payload.Succeeded, payload.Failed)
+	}
+
+	var resultsKey string
+	if err == nil {
+		resultsKey = s.saveResultsFile(id, payload.Items)
+	}
+
+	if err != nil {
+		s.logger.Errorw("Batch prediction failed", "error", err, "batch_id", id)
+		payload = &BatchCallbackPayload{BatchID: id, Status: BatchStatusFailed, Error: err.Error()}
+		if err := s.postgresRepo.UpdateBatchPredictionStatus(id, BatchStatusFailed, err.Error()); err != nil {
+			s.logger.Errorw("Failed to mark batch prediction as failed", "error", err, "batch_id", id)
+		}
+	} else {
+		if err := s.postgresRepo.UpdateBatchPredictionStatus(id, BatchStatusCompleted, ""); err != nil {
+			s.logger.Errorw("Failed to mark batch prediction as completed", "error", err, "batch_id", id)
+		}
+		s.logger.Infow("Batch prediction completed", "batch_id", id, "items", len(requests),
+			"failed", payload.Failed, "duration", time.Since(started))
+	}
+
+	s.deliver(id, callbackURL, payload, resultsKey)
+}
+
+// predict runs the model passes of a batch on the worker pool and renders the results in request order
+func (s *AsyncBatchService) predict(ctx context.Context, requests []*PredictionRequestMinimal, render func(*BatchItemResult) any) ([]any, error) {
+	chunks := make([][]BatchItemResult, (len(requests)+asyncBatchChunkSize-1)/asyncBatchChunkSize)
+	err := s.workers.Run(ctx, WorkloadBatch, len(chunks), func(ctx context.Context, chunk int) error {
+		start := chunk * asyncBatchChunkSize
+		end := min(start+asyncBatchChunkSize, len(requests))
+		results, err := s.mlService.predictMinimalChunk(ctx, requests[start:end], start)
+		chunks[chunk] = results
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]any, 0, len(requests))
+	for _, results := range chunks {
+		for i := range results {
+			items = append(items, render(&results[i]))
+		}
+	}
+	return items, nil
+}
+
+// saveResultsFile keeps the result items of a batch as a file for link downloads and returns its key.
+// The items are still served from the database when this fails, so a failure is only logged
+func (s *AsyncBatchService) saveResultsFile(id int64, items json.RawMessage) string {
+	if !s.results.Enabled() {
+		return ""
+	}
+
+	key, err := s.results.Save(ResultKindBatch, id, items)
+	if err == nil {
+		err = s.postgresRepo.SetBatchResultsKey(id, key)
+	}
+	if err != nil {
+		s.logger.Warnw("Failed to store batch results file", "error", err, "batch_id", id)
+		return ""
+	}
+	return key
+}
+
+// deliver POSTs the outcome of a batch to its callback URL and records the delivery. Items too large
+// to inline are replaced by a presigned link to the results file, or by the results endpoint without one
+func (s *AsyncBatchService) deliver(id int64, callbackURL string, payload *BatchCallbackPayload, resultsKey string) {
+	if len(payload.Items) > s.maxInlineBytes {
+		payload.Items = nil
+		if resultsKey != "" {
+			payload.ResultsURL = s.results.Link(resultsKey).URL
+		} else {
+			payload.ResultsURL = s.ResultsURL(id)
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		s.logger.Errorw("Failed to encode batch callback", "error", err, "batch_id", id)
+		return
+	}
+
+	// Retries get their own deadline so that a slow batch does not leave no time for the callback
+	ctx, cancel := context.WithTimeout(s.lifecycle.Context(), s.timeout)
+	defer cancel()
+
+	status, errMsg := CallbackStatusDelivered, ""
+	attempts, err := s.callbacks.Send(ctx, callbackURL, body)
+	if err != nil {
+		status, errMsg = CallbackStatusFailed, err.Error()
+		s.logger.Warnw("Batch callback failed", "error", err, "batch_id", id, "attempts", attempts)
+	}
+	if err := s.postgresRepo.UpdateBatchCallback(id, status, attempts, errMsg); err != nil {
+		s.logger.Errorw("Failed to record batch callback", "error", err, "batch_id", id)
+	}
+}
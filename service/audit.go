@@ -0,0 +1,135 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// Audit outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// Audited actions
+const (
+	AuditActionTrain          = "train"
+	AuditActionLameDuck       = "lame_duck"
+	AuditActionRunJob         = "run_job"
+	AuditActionSetFlag        = "set_flag"
+	AuditActionSetQueueWeight = "set_queue_weight"
+	AuditActionPromoteModel   = "promote_model"
+	AuditActionDiscardModel   = "discard_model"
+	AuditActionActivateModel  = "activate_model"
+	AuditActionReplay         = "replay"
+	AuditActionVerifyModel    = "verify_model"
+	AuditActionRecompute      = "recompute_forecasts"
+	// AuditActionInjectFault is only recorded by chaos builds
+	AuditActionInjectFault = "inject_fault"
+)
+
+// AuditEntry is a recorded call to an administrative operation
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	Action     string          `json:"action"`
+	Caller     string          `json:"caller"`
+	RemoteAddr string          `json:"remote_addr"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Params     json.RawMessage `json:"params,omitempty"`
+	StatusCode int             `json:"status_code"`
+	Outcome    string          `json:"outcome"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	DurationMs int64           `json:"duration_ms"`
+}
+
+// AuditFilter narrows the audit log; empty fields match everything
+type AuditFilter struct {
+	Action  string
+	Caller  string
+	Outcome string
+	From    time.Time
+	To      time.Time
+}
+
+// AuditStore holds the audit log. PostgresRepository implements it
+type AuditStore interface {
+	InsertAuditEntry(entry *repository.AuditEntry) error
+	ListAuditEntries(filter repository.AuditEntryFilter, limit, offset int) ([]repository.AuditEntry, int, error)
+}
+
+// AuditLog records who called administrative operations, with which parameters and how they ended
+type AuditLog struct {
+	postgresRepo AuditStore
+	logger       *zap.SugaredLogger
+}
+
+// NewAuditLog creates a new audit log
+func NewAuditLog(postgresRepo AuditStore, logger *zap.SugaredLogger) *AuditLog {
+	return &AuditLog{
+		postgresRepo: postgresRepo,
+		logger:       logger,
+	}
+}
+
+// Record stores an audit entry. The entry is also written to the service log, so the trail
+// survives even when the database insert fails
+func (a *AuditLog) Record(entry *AuditEntry) {
+	a.logger.Infow("Audit",
+		"action", entry.Action,
+		"caller", entry.Caller,
+		"remote_addr", entry.RemoteAddr,
+		"path", entry.Path,
+		"status_code", entry.StatusCode,
+		"outcome", entry.Outcome,
+	)
+
+	err := a.postgresRepo.InsertAuditEntry(&repository.AuditEntry{
+		Action:     entry.Action,
+		Caller:     entry.Caller,
+		RemoteAddr: entry.RemoteAddr,
+		Method:     entry.Method,
+		Path:       entry.Path,
+		Params:     entry.Params,
+		StatusCode: entry.StatusCode,
+		Outcome:    entry.Outcome,
+		Error:      entry.Error,
+		CreatedAt:  entry.CreatedAt,
+		DurationMs: entry.DurationMs,
+	})
+	if err != nil {
+		a.logger.Errorw("Failed to record audit entry", "error", err, "action", entry.Action, "caller", entry.Caller)
+	}
+}
+
+// List returns a page of audit entries matching the filter, newest first,
+// and the total number of matching entries
+func (a *AuditLog) List(filter AuditFilter, limit, offset int) ([]AuditEntry, int, error) {
+	rows, total, err := a.postgresRepo.ListAuditEntries(repository.AuditEntryFilter(filter), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]AuditEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, AuditEntry{
+			ID:         row.ID,
+			Action:     row.Action,
+			Caller:     row.Caller,
+			RemoteAddr: row.RemoteAddr,
+			Method:     row.Method,
+			Path:       row.Path,
+			Params:     json.RawMessage(row.Params),
+			StatusCode: row.StatusCode,
+			Outcome:    row.Outcome,
+			Error:      row.Error,
+			CreatedAt:  row.CreatedAt,
+			DurationMs: row.DurationMs,
+		})
+	}
+	return entries, total, nil
+}
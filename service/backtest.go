@@ -0,0 +1,403 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/evaluation"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// backtestTrendRuns is how many previous runs a backtest is compared with
+const backtestTrendRuns = 4
+
+// ErrNoBacktestData is returned when processed data has no origin with a complete horizon after it
+var ErrNoBacktestData = errors.New("no data to backtest")
+
+// BacktestConfig sets the size of a backtest and when its result raises an alert
+type BacktestConfig struct {
+	// Origins are the weekly forecast origins evaluated, the latest ending a horizon before the
+	// latest processed date
+	Origins int
+	// MaxCases caps the products, regions and sellers evaluated per origin
+	MaxCases int
+	// AlertMetric is the sales metric compared with the average of the previous runs
+	AlertMetric string
+	// AlertThresholdPercent is how much worse than that average the metric may get before the run
+	// is marked degraded
+	AlertThresholdPercent float64
+}
+
+// BacktestRun is the summary of a backtest
+type BacktestRun struct {
+	ID           int64              `json:"id"`
+	StartedAt    time.Time          `json:"started_at"`
+	FinishedAt   time.Time          `json:"finished_at"`
+	ModelVersion string             `json:"model_version"`
+	Origins      int                `json:"origins"`
+	Cases        int                `json:"cases"`
+	HorizonDays  int                `json:"horizon_days"`
+	Price        map[string]float64 `json:"price"`
+	Sales        map[string]float64 `json:"sales"`
+	// Baselines are the metrics of the naive baselines on the same cases, by baseline name, so that
+	// Price and Sales can be read relative to them
+	Baselines   map[string]BacktestBaseline `json:"baselines,omitempty"`
+	AlertMetric string                      `json:"alert_metric"`
+	// AlertBaseline is the average of AlertMetric over the previous runs, absent for the first run
+	AlertBaseline *float64 `json:"alert_baseline,omitempty"`
+	Degraded      bool     `json:"degraded"`
+}
+
+// BacktestBaseline is the accuracy of a naive baseline in a backtest
+type BacktestBaseline struct {
+	Price map[string]float64 `json:"price"`
+	Sales map[string]float64 `json:"sales"`
+}
+
+// backtestErrors accumulates the errors of the models and of the naive baselines
+type backtestErrors struct {
+	price, sales                 evaluation.Accumulator
+	baselinePrice, baselineSales map[string]*evaluation.Accumulator
+}
+
+// newBacktestErrors creates empty accumulators for the models and every naive baseline
+func newBacktestErrors() *backtestErrors {
+	e := &backtestErrors{
+		baselinePrice: make(map[string]*evaluation.Accumulator),
+		baselineSales: make(map[string]*evaluation.Accumulator),
+	}
+	for _, name := range []string{BaselineLastValue, BaselineSeasonalNaive, BaselineMovingAverage} {
+		e.baselinePrice[name] = &evaluation.Accumulator{}
+		e.baselineSales[name] = &evaluation.Accumulator{}
+	}
+	return e
+}
+
+// add adds the errors of one case. Price errors are only added when the actual price is known
+func (e *backtestErrors) add(actualPrice sql.NullFloat64, actualSales float64, prediction PredictionResult, baselines map[string]BaselinePrediction) {
+	e.sales.Add(actualSales, prediction.PredictedSales)
+	for name, baseline := range baselines {
+		e.baselineSales[name].Add(actualSales, baseline.PredictedSales)
+	}
+	if !actualPrice.Valid {
+		return
+	}
+	e.price.Add(actualPrice.Float64, prediction.PredictedPrice)
+	for name, baseline := range baselines {
+		e.baselinePrice[name].Add(actualPrice.Float64, baseline.PredictedPrice)
+	}
+}
+
+// merge adds the errors accumulated in other
+func (e *backtestErrors) merge(other *backtestErrors) {
+	e.price.Merge(&other.price)
+	e.sales.Merge(&other.sales)
+	for name := range e.baselineSales {
+		e.baselinePrice[name].Merge(other.baselinePrice[name])
+		e.baselineSales[name].Merge(other.baselineSales[name])
+	}
+}
+
+// baselines evaluates the metrics of every naive baseline
+func (e *backtestErrors) baselines(metrics evaluation.MetricSet) map[string]BacktestBaseline {
+	baselines := make(map[string]BacktestBaseline, len(e.baselineSales))
+	for name := range e.baselineSales {
+		baselines[name] = BacktestBaseline{
+			Price: metrics.Evaluate(e.baselinePrice[name]),
+			Sales: metrics.Evaluate(e.baselineSales[name]),
+		}
+	}
+	return baselines
+}
+
+// BacktestTrend is the history of backtest runs, newest first
+type BacktestTrend struct {
+	AlertMetric           string        `json:"alert_metric"`
+	AlertThresholdPercent float64       `json:"alert_threshold_percent"`
+	Runs                  []BacktestRun `json:"runs"`
+}
+
+// BacktestDegradedDetails describes the drift_detected event of a degraded backtest
+type BacktestDegradedDetails struct {
+	BacktestRunID    int64   `json:"backtest_run_id"`
+	Metric           string  `json:"metric"`
+	Value            float64 `json:"value"`
+	Baseline         float64 `json:"baseline"`
+	ThresholdPercent float64 `json:"threshold_percent"`
+}
+
+// BacktestStore provides the history backtests run over and records their runs. PostgresRepository
+// implements it
+type BacktestStore interface {
+	LatestProcessedDate() (sql.NullTime, error)
+	ListBacktestCases(origin time.Time, horizonDays, limit int) ([]repository.BacktestCase, error)
+	SaveBacktestRun(run *repository.BacktestRun) (int64, error)
+	ListBacktestRuns(limit int) ([]repository.BacktestRun, error)
+}
+
+// Backtester evaluates the installed models on history with a rolling origin: at each weekly
+// origin it predicts from the features as of that day and compares the predictions with what
+// happened over the following horizon. It runs as the backtest job, evaluating every origin as a
+// task of the worker pool
+type Backtester struct {
+	mlService    *MLPredictionService
+	postgresRepo BacktestStore
+	workers      *WorkerPool
+	metrics      evaluation.MetricSet
+	config       BacktestConfig
+	events       *EventLog
+	logger       *zap.SugaredLogger
+}
+
+// NewBacktester creates a new backtester
+func NewBacktester(mlService *MLPredictionService, postgresRepo BacktestStore, workers *WorkerPool, metrics evaluation.MetricSet, config BacktestConfig, events *EventLog, logger *zap.SugaredLogger) *Backtester {
+	return &Backtester{
+		mlService:    mlService,
+		postgresRepo: postgresRepo,
+		workers:      workers,
+		metrics:      metrics,
+		config:       config,
+		events:       events,
+		logger:       logger,
+	}
+}
+
+// Run backtests the installed models and the naive baselines, records the run and compares its
+// AlertMetric with the average of the previous runs, recording a drift_detected event when it is
+// more than AlertThresholdPercent worse
+func (b *Backtester) Run(ctx context.Context) error {
+	startedAt := time.Now()
+	latest, err := b.postgresRepo.LatestProcessedDate()
+	if err != nil {
+		return err
+	}
+	if !latest.Valid {
+		return ErrNoBacktestData
+	}
+
+	// Every origin accumulates its own errors, merged once all of them are done
+	byOrigin := make([]*backtestErrors, b.config.Origins)
+	for i := range byOrigin {
+		byOrigin[i] = newBacktestErrors()
+	}
+	err = b.workers.Run(ctx, WorkloadBacktest, b.config.Origins, func(ctx context.Context, i int) error {
+		origin := latest.Time.AddDate(0, 0, -salesForecastDays-7*i)
+		return b.evaluateOrigin(ctx, origin, byOrigin[i])
+	})
+	if err != nil {
+		return err
+	}
+	errs := newBacktestErrors()
+	for _, originErrs := range byOrigin {
+		errs.merge(originErrs)
+	}
+	price, sales := &errs.price, &errs.sales
+	if sales.Count() == 0 {
+		return fmt.Errorf("%w: no product has history on the %d origins before %s", ErrNoBacktestData,
+			b.config.Origins, latest.Time.Format("2006-01-02"))
+	}
+
+	run := &BacktestRun{
+		StartedAt:    startedAt,
+		ModelVersion: b.mlService.ActiveModelVersion(),
+		Origins:      b.config.Origins,
+		Cases:        int(sales.Count()),
+		HorizonDays:  salesForecastDays,
+		Price:        b.metrics.Evaluate(price),
+		Sales:        b.metrics.Evaluate(sales),
+		Baselines:    errs.baselines(b.metrics),
+		AlertMetric:  b.config.AlertMetric,
+	}
+	value, hasValue := sales.Metric(b.config.AlertMetric)
+
+	previous, err := b.postgresRepo.ListBacktestRuns(backtestTrendRuns)
+	if err != nil {
+		return err
+	}
+	if baseline, ok := backtestAlertBaseline(previous, b.config.AlertMetric); ok && hasValue {
+		run.AlertBaseline = &baseline
+		run.Degraded = math.Abs(value) > math.Abs(baseline)*(1+b.config.AlertThresholdPercent/100)
+	}
+	run.FinishedAt = time.Now()
+
+	priceMetrics, _ := json.Marshal(run.Price)
+	salesMetrics, _ := json.Marshal(run.Sales)
+	baselineMetrics, _ := json.Marshal(run.Baselines)
+	record := &repository.BacktestRun{
+		StartedAt:       run.StartedAt,
+		FinishedAt:      run.FinishedAt,
+		ModelVersion:    run.ModelVersion,
+		Origins:         run.Origins,
+		Cases:           run.Cases,
+		HorizonDays:     run.HorizonDays,
+		PriceMetrics:    priceMetrics,
+		SalesMetrics:    salesMetrics,
+		BaselineMetrics: baselineMetrics,
+		AlertMetric:     run.AlertMetric,
+		AlertValue:      sql.NullFloat64{Float64: value, Valid: hasValue},
+		Degraded:        run.Degraded,
+	}
+	if run.AlertBaseline != nil {
+		record.AlertBaseline = sql.NullFloat64{Float64: *run.AlertBaseline, Valid: true}
+	}
+	if run.ID, err = b.postgresRepo.SaveBacktestRun(record); err != nil {
+		return err
+	}
+
+	b.logger.Infow("Backtest finished", "id", run.ID, "model_version", run.ModelVersion, "cases", run.Cases,
+		"sales", run.Sales, "price", run.Price, "baselines", run.Baselines)
+	if run.Degraded {
+		b.logger.Warnw("Backtest accuracy degraded", "metric", run.AlertMetric, "value", value,
+			"baseline", *run.AlertBaseline, "threshold_percent", b.config.AlertThresholdPercent)
+		b.events.Record(EventDriftDetected, run.ModelVersion, BacktestDegradedDetails{
+			BacktestRunID:    run.ID,
+			Metric:           run.AlertMetric,
+			Value:            value,
+			Baseline:         *run.AlertBaseline,
+			ThresholdPercent: b.config.AlertThresholdPercent,
+		})
+	}
+	return nil
+}
+
+// evaluateOrigin predicts the sampled cases of an origin from their features as of that day, with
+// the models and the naive baselines, and adds the errors to errs. Features only known for the
+// latest day, such as the price and rating, are taken from the origin's own row
+func (b *Backtester) evaluateOrigin(ctx context.Context, origin time.Time, errs *backtestErrors) error {
+	cases, err := b.postgresRepo.ListBacktestCases(origin, salesForecastDays, b.config.MaxCases)
+	if err != nil || len(cases) == 0 {
+		return err
+	}
+
+	requests := make([]*PredictionRequest, 0, len(cases))
+	evaluated := make([]*repository.BacktestCase, 0, len(cases))
+	for i := range cases {
+		c := &cases[i]
+		resolved, err := b.mlService.resolveFeatures(ctx, &PredictionRequestMinimal{
+			ProductName:    c.ProductName,
+			Region:         c.Region,
+			Seller:         c.Seller,
+			PredictionDate: &origin,
+			Price:          nullFloatPointer(c.Price),
+			OriginalPrice:  nullFloatPointer(c.OriginalPrice),
+			StockLevel:     nullFloatPointer(c.StockLevel),
+			CustomerRating: nullFloatPointer(c.CustomerRating),
+			ReviewCount:    nullFloatPointer(c.ReviewCount),
+			DeliveryDays:   nullFloatPointer(c.DeliveryDays),
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			b.logger.Warnw("Skipping backtest case", "error", err, "origin", origin.Format("2006-01-02"),
+				"product", c.ProductName, "region", c.Region, "seller", c.Seller)
+			continue
+		}
+		requests = append(requests, resolved.request)
+		evaluated = append(evaluated, c)
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+
+	predictions, err := b.mlService.engine.PredictBatch(ctx, requests)
+	if err != nil {
+		return err
+	}
+	for i, prediction := range predictions {
+		errs.add(evaluated[i].ActualPrice, evaluated[i].ActualSales, prediction, NaiveBaselines(requests[i]))
+	}
+	return nil
+}
+
+// Trend returns the latest limit backtest runs, newest first
+func (b *Backtester) Trend(limit int) (*BacktestTrend, error) {
+	rows, err := b.postgresRepo.ListBacktestRuns(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	trend := &BacktestTrend{
+		AlertMetric:           b.config.AlertMetric,
+		AlertThresholdPercent: b.config.AlertThresholdPercent,
+		Runs:                  make([]BacktestRun, 0, len(rows)),
+	}
+	for _, row := range rows {
+		run := BacktestRun{
+			ID:           row.ID,
+			StartedAt:    row.StartedAt,
+			FinishedAt:   row.FinishedAt,
+			ModelVersion: row.ModelVersion,
+			Origins:      row.Origins,
+			Cases:        row.Cases,
+			HorizonDays:  row.HorizonDays,
+			AlertMetric:  row.AlertMetric,
+			Degraded:     row.Degraded,
+		}
+		run.Price = b.decodeMetrics(row.ID, row.PriceMetrics)
+		run.Sales = b.decodeMetrics(row.ID, row.SalesMetrics)
+		run.Baselines = b.decodeBaselines(row.ID, row.BaselineMetrics)
+		if row.AlertBaseline.Valid {
+			run.AlertBaseline = &row.AlertBaseline.Float64
+		}
+		trend.Runs = append(trend.Runs, run)
+	}
+	return trend, nil
+}
+
+// decodeMetrics decodes the metrics recorded for a run, logging rather than failing on bad data
+func (b *Backtester) decodeMetrics(id int64, data []byte) map[string]float64 {
+	if len(data) == 0 {
+		return nil
+	}
+	var values map[string]float64
+	if err := json.Unmarshal(data, &values); err != nil {
+		b.logger.Warnw("Failed to decode backtest metrics", "error", err, "id", id)
+		return nil
+	}
+	return values
+}
+
+// decodeBaselines decodes the baseline metrics recorded for a run, absent for runs recorded before
+// baselines were backtested
+func (b *Backtester) decodeBaselines(id int64, data []byte) map[string]BacktestBaseline {
+	if len(data) == 0 {
+		return nil
+	}
+	var baselines map[string]BacktestBaseline
+	if err := json.Unmarshal(data, &baselines); err != nil {
+		b.logger.Warnw("Failed to decode backtest baseline metrics", "error", err, "id", id)
+		return nil
+	}
+	return baselines
+}
+
+// backtestAlertBaseline averages the alert metric over the previous runs that recorded it
+func backtestAlertBaseline(runs []repository.BacktestRun, metric string) (float64, bool) {
+	var sum float64
+	var count int
+	for _, run := range runs {
+		if run.AlertMetric == metric && run.AlertValue.Valid {
+			sum += run.AlertValue.Float64
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+// nullFloatPointer returns a pointer to the value of a valid NullFloat64, and nil otherwise
+func nullFloatPointer(value sql.NullFloat64) *float64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Float64
+}
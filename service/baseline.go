@@ -0,0 +1,45 @@
+package service
+
+// Naive baselines that model accuracy is compared against. scripts/lightGBM_model.py computes the
+// validation MAE of the same baselines at training time
+const (
+	// BaselineLastValue repeats the current price and the latest day's sales
+	BaselineLastValue = "last_value"
+	// BaselineSeasonalNaive repeats last week: the current price, which falls on the weekday of the
+	// 7-day price target, and the sales of the last 7 days
+	BaselineSeasonalNaive = "seasonal_naive"
+	// BaselineMovingAverage uses the 3-day rolling means of price and sales
+	BaselineMovingAverage = "moving_average"
+)
+
+// BaselinePrediction is the prediction of a naive baseline
+type BaselinePrediction struct {
+	PredictedPrice float64 `json:"predicted_price"`
+	PredictedSales float64 `json:"predicted_sales"`
+}
+
+// BaselineMAE is the validation MAE of each naive baseline
+type BaselineMAE struct {
+	LastValue     float64 `json:"last_value"`
+	SeasonalNaive float64 `json:"seasonal_naive"`
+	MovingAverage float64 `json:"moving_average"`
+}
+
+// NaiveBaselines returns the predictions of the naive baselines for a feature vector by name.
+// Daily sales are scaled to the salesForecastDays days of the sales target
+func NaiveBaselines(request *PredictionRequest) map[string]BaselinePrediction {
+	return map[string]BaselinePrediction{
+		BaselineLastValue: {
+			PredictedPrice: request.Price,
+			PredictedSales: request.SalesQuantityLag1 * salesForecastDays,
+		},
+		BaselineSeasonalNaive: {
+			PredictedPrice: request.Price,
+			PredictedSales: request.SalesQuantityRollingMean7 * salesForecastDays,
+		},
+		BaselineMovingAverage: {
+			PredictedPrice: request.PriceRollingMean3,
+			PredictedSales: request.SalesQuantityRollingMean3 * salesForecastDays,
+		},
+	}
+}
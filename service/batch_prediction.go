@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// Batch item statuses
+const (
+	BatchItemSucceeded = "success"
+	BatchItemFailed    = "error"
+)
+
+// Batch item error codes. Items with a prediction date out of range fail with the code of their
+// PredictionDateError
+const (
+	BatchErrorInvalidRequest = "invalid_request"
+	BatchErrorStaleHistory   = "stale_history"
+	BatchErrorUnseenCategory = "unseen_category"
+	BatchErrorResolution     = "feature_resolution_failed"
+	BatchErrorPrediction     = "prediction_failed"
+)
+
+// BatchItemResult is the outcome of one item of a batch prediction
+type BatchItemResult struct {
+	Index  int
+	Result *PredictionResult
+	// ErrorCode and Error are set when the item failed
+	ErrorCode string
+	Error     string
+}
+
+// Succeeded reports whether the item was predicted
+func (r *BatchItemResult) Succeeded() bool {
+	return r.Result != nil
+}
+
+// PredictMinimalBatch predicts many products resolved from history in one model pass.
+// An item whose features can't be resolved fails on its own and the others are still predicted;
+// nil requests mark items the caller already rejected and are skipped. When the model pass fails
+// every item falls back to the rest of the fallback chain; the error is only returned when the
+// chain has nothing after the global models, since then no item can be predicted.
+// Results are returned in request order
+func (s *MLPredictionService) PredictMinimalBatch(ctx context.Context, requests []*PredictionRequestMinimal) ([]BatchItemResult, error) {
+	return s.predictMinimalChunk(ctx, requests, 0)
+}
+
+// StreamMinimalBatch predicts a batch like PredictMinimalBatch, but in model passes of chunkSize
+// items, handing every result to emit in request order as soon as its chunk is done. Only one chunk
+// of results is held in memory at a time. An error from emit or from a model pass stops the stream
+func (s *MLPredictionService) StreamMinimalBatch(ctx context.Context, requests []*PredictionRequestMinimal, chunkSize int, emit func(*BatchItemResult) error) error {
+	for start := 0; start < len(requests); start += chunkSize {
+		end := min(start+chunkSize, len(requests))
+		results, err := s.predictMinimalChunk(ctx, requests[start:end], start)
+		if err != nil {
+			return err
+		}
+		for i := range results {
+			if err := emit(&results[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// predictMinimalChunk predicts a slice of a batch in one model pass; offset is the index of the
+// first request within the batch
+func (s *MLPredictionService) predictMinimalChunk(ctx context.Context, requests []*PredictionRequestMinimal, offset int) ([]BatchItemResult, error) {
+	results := make([]BatchItemResult, len(requests))
+	var resolvedItems []*resolvedFeatures
+	var resolvedIndexes []int
+
+	for i, request := range requests {
+		results[i].Index = offset + i
+		if request == nil {
+			continue
+		}
+
+		resolved, err := s.resolveRequestedFeatures(ctx, request)
+		if err != nil {
+			results[i].ErrorCode = BatchErrorResolution
+			var dateErr *PredictionDateError
+			if errors.Is(err, ErrStaleHistory) {
+				results[i].ErrorCode = BatchErrorStaleHistory
+			} else if errors.Is(err, ErrUnseenCategory) {
+				results[i].ErrorCode = BatchErrorUnseenCategory
+			} else if errors.As(err, &dateErr) {
+				results[i].ErrorCode = dateErr.Code
+			}
+			results[i].Error = err.Error()
+			continue
+		}
+		resolvedItems = append(resolvedItems, resolved)
+		resolvedIndexes = append(resolvedIndexes, i)
+	}
+
+	if len(resolvedItems) == 0 {
+		return results, nil
+	}
+
+	// The global models run in one pass; the fallback chain is only walked item by item when it
+	// does not start with them or the pass fails
+	strategies := s.fallback.strategies()
+	var modelErr error
+	if strategies[0] == PredictionStrategyGlobal {
+		scenarios := make([]*PredictionRequest, len(resolvedItems))
+		for i, resolved := range resolvedItems {
+			scenarios[i] = resolved.modelRequest()
+		}
+		predictions, err := s.engine.PredictBatch(ctx, scenarios)
+		if err == nil {
+			for i, resolved := range resolvedItems {
+				result := &predictions[i]
+				result.Strategy = PredictionStrategyGlobal
+				s.completeMinimalPrediction(resolved, result)
+				results[resolvedIndexes[i]].Result = result
+			}
+			return results, nil
+		}
+		if len(strategies) == 1 || ctx.Err() != nil {
+			return nil, err
+		}
+		modelErr = err
+	}
+
+	for i, resolved := range resolvedItems {
+		result, err := s.predictResolved(ctx, resolved, modelErr)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			results[resolvedIndexes[i]].ErrorCode = BatchErrorPrediction
+			results[resolvedIndexes[i]].Error = err.Error()
+			continue
+		}
+		s.completeMinimalPrediction(resolved, result)
+		results[resolvedIndexes[i]].Result = result
+	}
+	return results, nil
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Benchmarks of the work done in Go around every model call. Compare runs before and after a change
+// with benchstat:
+//
+//	go test ./service -run '^$' -bench . -count 10 > new.txt
+
+// predictionOutput is what the Python engine parses after every prediction
+const predictionOutput = `/usr/local/lib/python3.10/site-packages/lightgbm/basic.py:2065: UserWarning: Using categorical_feature in Dataset.
+INFO: Загрузка моделей из /app/models
+{"predicted_price": 7412.55, "predicted_sales": 12.31}
+`
+
+func BenchmarkExtractJSONPrediction(b *testing.B) {
+	for b.Loop() {
+		if _, err := extractJSON(predictionOutput); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseTrainingOutput parses the output of a long training run, with a progress record per
+// iteration of both models before the metrics
+func BenchmarkParseTrainingOutput(b *testing.B) {
+	var output strings.Builder
+	for _, model := range []string{"price", "sales"} {
+		for i := 1; i <= 2000; i++ {
+			fmt.Fprintf(&output, `{"event": "progress", "model": %q, "iteration": %d, "train_rmse": 431.2, "valid_rmse": 455.0}`+"\n", model, i)
+		}
+	}
+	output.WriteString(`{"price_model": {"best_iteration": 1870, "best_score": 412.37, "mae": 298.11}, "sales_model": {"best_iteration": 1430, "best_score": 3.82, "mae": 2.41}}` + "\n")
+	b.SetBytes(int64(output.Len()))
+
+	for b.Loop() {
+		if _, err := parseTrainingOutput(output.String()); err != nil {
+			b.Fatal(err)
+		}
+		parseTrainingProgress(output.String())
+	}
+}
+
+// BenchmarkStubEnginePredict is the floor of an engine call: a prediction through the stub engine
+// including the JSON encoding the API does around it
+func BenchmarkStubEnginePredict(b *testing.B) {
+	engine := NewStubInferenceEngine(0)
+	request := &PredictionRequest{ProductName: "Джинсы Lee Rider", Price: 7500, SalesQuantityLag1: 11}
+	body, _ := json.Marshal(request)
+	ctx := context.Background()
+
+	for b.Loop() {
+		var decoded PredictionRequest
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			b.Fatal(err)
+		}
+		result, err := engine.Predict(ctx, &decoded)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := json.Marshal(result); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchFeatureVector is a feature vector as the feature builder resolves it
+var benchFeatureVector = PredictionRequest{
+	ProductName:               "Смартфон Xiaomi 14 Pro",
+	Brand:                     "Xiaomi",
+	Category:                  "Электроника",
+	Region:                    "Санкт-Петербург",
+	Seller:                    "ИП «Некрасова, Фролов и Кириллова»",
+	Price:                     74990,
+	OriginalPrice:             79990,
+	DiscountPercentage:        6.25,
+	StockLevel:                118,
+	CustomerRating:            4.7,
+	ReviewCount:               1243,
+	DeliveryDays:              2,
+	DayOfWeek:                 5,
+	Month:                     11,
+	Quarter:                   4,
+	SalesQuantityLag1:         14,
+	PriceLag1:                 74990,
+	SalesQuantityLag3:         12,
+	PriceLag3:                 76490,
+	SalesQuantityLag7:         9,
+	PriceLag7:                 79990,
+	SalesQuantityRollingMean3: 12.666666666666666,
+	PriceRollingMean3:         75490,
+	SalesQuantityRollingMean7: 11.142857142857142,
+	PriceRollingMean7:         77418.57142857143,
+}
+
+// BenchmarkEncodeFeatureVector compares encoding a feature vector for the Python engine and the
+// prediction log with json.Marshal and with a pooled buffer
+func BenchmarkEncodeFeatureVector(b *testing.B) {
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			data, err := json.Marshal(&benchFeatureVector)
+			if err != nil {
+				b.Fatal(err)
+			}
+			_ = string(data)
+		}
+	})
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := getJSONBuffer(1)
+			if err := encodeJSON(buf, &benchFeatureVector); err != nil {
+				b.Fatal(err)
+			}
+			_ = buf.String()
+			putJSONBuffer(buf)
+		}
+	})
+}
+
+// BenchmarkSimulationScenarios expands a product into a 30-day simulation of 1800 scenarios
+func BenchmarkSimulationScenarios(b *testing.B) {
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	request := &SimulationRequest{
+		PriceMultipliers:    []float64{0.8, 0.9, 1, 1.1, 1.2},
+		DiscountPercentages: []float64{0, 5, 10, 20},
+		StockLevels:         []float64{50, 100, 200},
+		HorizonDays:         30,
+		StartDate:           &start,
+	}
+	product := SimulationProduct{ProductName: benchFeatureVector.ProductName, Region: benchFeatureVector.Region, Seller: benchFeatureVector.Seller}
+	b.ReportAllocs()
+
+	for b.Loop() {
+		scenarios, _ := appendSimulationScenarios(nil, nil, request, product, &benchFeatureVector)
+		if len(scenarios) != 1800 {
+			b.Fatalf("got %d scenarios, want 1800", len(scenarios))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/httpclient"
+)
+
+// Callback request headers
+const (
+	CallbackSignatureHeader = "X-Signature"
+	CallbackTimestampHeader = "X-Signature-Timestamp"
+)
+
+// ErrInvalidCallbackURL is returned when a callback URL is malformed or not allowed
+var ErrInvalidCallbackURL = errors.New("invalid callback URL")
+
+// CallbackPolicy controls how callbacks are signed and where they may go
+type CallbackPolicy struct {
+	// Secret signs every callback body
+	Secret []byte
+	// AllowedHosts restricts the callback hosts. When empty any host is allowed whose addresses are
+	// public, so that API clients can't make the service call loopback, private or link-local
+	// endpoints such as cloud metadata
+	AllowedHosts []string
+}
+
+// CallbackSender POSTs signed JSON payloads to client callback URLs, retrying transient failures.
+// The X-Signature header is "sha256=" followed by the hex HMAC-SHA256 of the timestamp, a dot and
+// the body, keyed with the shared secret; the timestamp is sent in X-Signature-Timestamp so that
+// receivers can refuse replays
+type CallbackSender struct {
+	policy CallbackPolicy
+	client *httpclient.Client
+}
+
+// NewCallbackSender creates a callback sender delivering through client, whose policy must not
+// follow redirects: they would send the signed payload somewhere the caller did not ask for. Without
+// allowed hosts the policy of the client must be PublicOnly, which checks the address of every
+// connection, since a host may resolve to another address after it was validated
+func NewCallbackSender(policy CallbackPolicy, client *httpclient.Client) *CallbackSender {
+	return &CallbackSender{
+		policy: policy,
+		client: client,
+	}
+}
+
+// Enabled reports whether callbacks can be sent, which requires a signing secret
+func (s *CallbackSender) Enabled() bool {
+	return len(s.policy.Secret) > 0
+}
+
+// callbackResolveTimeout bounds the resolution of a callback host during validation
+const callbackResolveTimeout = 5 * time.Second
+
+// Validate checks that a callback URL is an absolute http(s) URL to an allowed host, or without
+// allowed hosts to a host resolving to public addresses only
+func (s *CallbackSender) Validate(ctx context.Context, callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: must be an absolute http or https URL", ErrInvalidCallbackURL)
+	}
+	if len(s.policy.AllowedHosts) == 0 {
+		ctx, cancel := context.WithTimeout(ctx, callbackResolveTimeout)
+		defer cancel()
+		if err := httpclient.ResolvePublic(ctx, u.Hostname()); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCallbackURL, err)
+		}
+		return nil
+	}
+	for _, host := range s.policy.AllowedHosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %s is not allowed", ErrInvalidCallbackURL, u.Hostname())
+}
+
+// Sign returns the signature header value of a body sent at the given Unix timestamp
+func (s *CallbackSender) Sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, s.policy.Secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send delivers body to the callback URL, signing every attempt with its own timestamp. Network
+// errors, 429 and 5xx responses are retried by the client, redirects are not followed and other
+// responses are final. It returns the number of attempts made
+func (s *CallbackSender) Send(ctx context.Context, callbackURL string, body []byte) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, attempts, err := s.client.Send(request, func(attempt *http.Request) {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		attempt.Header.Set(CallbackTimestampHeader, timestamp)
+		attempt.Header.Set(CallbackSignatureHeader, s.Sign(timestamp, body))
+	})
+	if err != nil {
+		return attempts, err
+	}
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return attempts, fmt.Errorf("callback returned status %d", response.StatusCode)
+	}
+	return attempts, nil
+}
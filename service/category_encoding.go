@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// ErrUnseenCategory is returned when a request has a category value the models were not trained on
+// and their encoders reject unseen values
+var ErrUnseenCategory = errors.New("category unseen in training")
+
+// CategoryEncoders are the category encoders of a model version
+type CategoryEncoders = features.Encoders
+
+// CategoryEncoding decides how new models encode their categorical features. The script writes the
+// categories it saw and the unseen policy into encoders.json, and predictions follow the policy of
+// the installed encoders unless PredictUnseenPolicy overrides it
+type CategoryEncoding struct {
+	UnseenPolicy features.UnseenPolicy
+	// MinCount is how many training rows a value needs to get a category of its own, the rarer
+	// ones are encoded like unseen values
+	MinCount int
+	// PredictUnseenPolicy is how predictions encode unseen values whatever policy the installed
+	// models were trained with, empty to follow their encoders
+	PredictUnseenPolicy features.UnseenPolicy
+}
+
+// scriptArgs returns the training script arguments selecting the unseen policy and minimum count
+func (e CategoryEncoding) scriptArgs() []string {
+	var args []string
+	if e.UnseenPolicy != "" && e.UnseenPolicy != features.UnseenMissing {
+		args = append(args, "--unseen-policy", string(e.UnseenPolicy))
+	}
+	if e.MinCount > 1 {
+		args = append(args, "--encoder-min-count", strconv.Itoa(e.MinCount))
+	}
+	return args
+}
+
+// readEncoders reads the encoders of the models in modelDir, nil for models trained before encoders
+func readEncoders(fileRepo *repository.FileRepository, modelDir string) (*features.Encoders, error) {
+	data, err := fileRepo.ReadStagedFile(modelDir, featureInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parseModelInfo(data)
+	if err != nil || info.EncoderVersion == 0 {
+		return nil, err
+	}
+	if data, err = fileRepo.ReadStagedFile(modelDir, features.EncodersFile); err != nil {
+		return nil, err
+	}
+	return features.ParseEncoders(data)
+}
+
+// installedEncoders caches the encoders of the installed model version, reading them again once
+// another version is installed
+type installedEncoders struct {
+	fileRepo *repository.FileRepository
+	// policy overrides the unseen policy of the encoders when set
+	policy   features.UnseenPolicy
+	mu       sync.Mutex
+	loaded   bool
+	version  string
+	encoders *features.Encoders
+}
+
+// get returns the encoders of the installed models, nil when they have none
+func (c *installedEncoders) get() (*features.Encoders, error) {
+	version := c.fileRepo.ReadModelVersion()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loaded && version != "" && version == c.version {
+		return c.encoders, nil
+	}
+	encoders, err := readEncoders(c.fileRepo, c.fileRepo.GetModelPath())
+	if err != nil {
+		return nil, err
+	}
+	c.loaded, c.version, c.encoders = true, version, encoders
+	return encoders, nil
+}
+
+// check applies the unseen policy to a request: it fails with ErrUnseenCategory under UnseenReject
+// and otherwise returns the policy and the unseen values with the categories they are encoded as.
+// Models without encoders, or whose encoders are unreadable, are left to the engine
+func (c *installedEncoders) check(request *PredictionRequest) (features.UnseenPolicy, []features.UnseenCategory, error) {
+	if c == nil || !c.fileRepo.FileExists(filepath.Join(c.fileRepo.GetModelPath(), featureInfoFile)) {
+		return "", nil, nil
+	}
+	encoders, err := c.get()
+	if err != nil || encoders == nil {
+		return "", nil, nil
+	}
+
+	policy := encoders.UnseenPolicy
+	if c.policy != "" {
+		policy = c.policy
+	}
+	unseen := encoders.Unseen(request, policy)
+	if len(unseen) > 0 && policy == features.UnseenReject {
+		return "", nil, fmt.Errorf("%w: %s %q", ErrUnseenCategory, unseen[0].Feature, unseen[0].Value)
+	}
+	return policy, unseen, nil
+}
+
+// unseenWarnings describes how the unseen values of a request are encoded
+func unseenWarnings(unseen []features.UnseenCategory) []string {
+	var warnings []string
+	for _, u := range unseen {
+		encodedAs := u.EncodedAs
+		if encodedAs == "" {
+			encodedAs = "missing"
+		}
+		warnings = append(warnings, fmt.Sprintf("%s %q was not seen in training and is encoded as %s", u.Feature, u.Value, encodedAs))
+	}
+	return warnings
+}
+
+// withUnseen adds the unseen values of a request to its data quality, creating it when the history
+// was not interpolated
+func (q *DataQuality) withUnseen(policy features.UnseenPolicy, unseen []features.UnseenCategory) *DataQuality {
+	if len(unseen) == 0 {
+		return q
+	}
+	if q == nil {
+		q = &DataQuality{}
+	}
+	q.UnseenPolicy = policy
+	q.UnseenCategories = unseen
+	return q
+}
+
+// ModelEncoders returns the encoders of the installed models, nil when no models are installed or
+// they were trained before encoders
+func (s *MLPredictionService) ModelEncoders() (*CategoryEncoders, error) {
+	if !s.fileRepo.FileExists(filepath.Join(s.fileRepo.GetModelPath(), featureInfoFile)) {
+		return nil, nil
+	}
+	return s.encoders.get()
+}
@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// ErrInsufficientDiskSpace is returned when a training run would not fit on disk
+var ErrInsufficientDiskSpace = errors.New("insufficient disk space")
+
+// CheckDiskSpace is the dependency check failing while a volume has less free space than required
+const CheckDiskSpace = "disk_space"
+
+// Volumes watched by the disk monitor
+const (
+	VolumeData          = "data"
+	VolumeModels        = "models"
+	VolumeTemp          = "temp"
+	VolumeArtifactStore = "artifact_store"
+)
+
+// Kinds of leaked work directories
+const (
+	LeakedRunDir     = "run"
+	LeakedStagingDir = "staging"
+)
+
+// DiskPolicy says how much space the service keeps free and when a work directory counts as leaked
+type DiskPolicy struct {
+	// MinFreeBytes must stay free on every volume after a training run, 0 only requires the run
+	// to fit
+	MinFreeBytes uint64
+	// StaleAfter is the age after which a run or staging directory nobody removed is leaked
+	StaleAfter time.Duration
+	// ArtifactStorePath is the directory of the file artifact store, empty when there is none
+	ArtifactStorePath string
+}
+
+// DiskVolume is the space of the volume holding one of the service directories
+type DiskVolume struct {
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	Error      string `json:"error,omitempty"`
+
+	device uint64
+}
+
+// ArtifactUsage is the number and size of the model artifacts kept in one location: the model
+// files installed in the model directory or the versions of the artifact store
+type ArtifactUsage struct {
+	Location string `json:"location"`
+	Count    int    `json:"count"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// LeakedDir is a run or staging directory left behind by a crashed or killed run
+type LeakedDir struct {
+	Path       string    `json:"path"`
+	Kind       string    `json:"kind"`
+	Bytes      int64     `json:"bytes"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+// DiskReport is the disk usage of the service at one point in time
+type DiskReport struct {
+	Volumes    []DiskVolume    `json:"volumes"`
+	Artifacts  []ArtifactUsage `json:"artifacts"`
+	LeakedDirs []LeakedDir     `json:"leaked_dirs,omitempty"`
+	// LowVolumes are the volumes with less free space than the policy keeps
+	LowVolumes []string  `json:"low_volumes,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// DiskMonitor watches the free space of the data, model and temp directories, the artifacts kept
+// on disk and the work directories runs leave behind, and refuses training runs that would fill a
+// volume. A nil monitor watches nothing and lets every run start
+type DiskMonitor struct {
+	fileRepo *repository.FileRepository
+	policy   DiskPolicy
+	interval time.Duration
+	logger   *zap.SugaredLogger
+
+	mu   sync.Mutex
+	last *DiskReport
+
+	totalBytes  *metrics.GaugeVec
+	freeBytes   *metrics.GaugeVec
+	artifacts   *metrics.GaugeVec
+	artifactSum *metrics.GaugeVec
+	leaked      *metrics.GaugeVec
+	leakedBytes *metrics.GaugeVec
+}
+
+// NewDiskMonitor creates a disk monitor refreshing its report every interval. registry may be nil,
+// in which case no metrics are recorded
+func NewDiskMonitor(fileRepo *repository.FileRepository, policy DiskPolicy, interval time.Duration, registry *metrics.Registry, logger *zap.SugaredLogger) *DiskMonitor {
+	m := &DiskMonitor{
+		fileRepo: fileRepo,
+		policy:   policy,
+		interval: interval,
+		logger:   logger,
+	}
+	if registry != nil {
+		m.totalBytes = registry.NewGaugeVec("ml_disk_total_bytes",
+			"Size of the volumes holding the service directories", "volume")
+		m.freeBytes = registry.NewGaugeVec("ml_disk_free_bytes",
+			"Space available to the service on the volumes holding its directories", "volume")
+		m.artifacts = registry.NewGaugeVec("ml_artifacts",
+			"Model files installed in the model directory and versions kept in the artifact store", "location")
+		m.artifactSum = registry.NewGaugeVec("ml_artifact_bytes",
+			"Size of the model artifacts by location", "location")
+		m.leaked = registry.NewGaugeVec("ml_leaked_work_dirs",
+			"Run and staging directories left behind by crashed or killed runs", "kind")
+		m.leakedBytes = registry.NewGaugeVec("ml_leaked_work_dir_bytes",
+			"Size of the leaked run and staging directories", "kind")
+	}
+	return m
+}
+
+// Start refreshes the report until the context is cancelled
+func (m *DiskMonitor) Start(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	m.Refresh()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Refresh()
+		}
+	}
+}
+
+// Last returns the latest report, or nil before the first refresh
+func (m *DiskMonitor) Last() *DiskReport {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// Check is the dependency check of the disk space, failing while the latest report has a volume
+// with less free space than the policy keeps
+func (m *DiskMonitor) Check(ctx context.Context) error {
+	report := m.Last()
+	if report == nil || len(report.LowVolumes) == 0 {
+		return nil
+	}
+	return fmt.Errorf("less than %s free on volumes %s", formatBytes(m.policy.MinFreeBytes), strings.Join(report.LowVolumes, ", "))
+}
+
+// Refresh measures the disk usage, records it in the metrics and keeps it as the latest report
+func (m *DiskMonitor) Refresh() *DiskReport {
+	if m == nil {
+		return nil
+	}
+	report := &DiskReport{
+		Volumes:   m.volumes(),
+		Artifacts: m.artifactUsage(),
+		CheckedAt: time.Now().UTC(),
+	}
+
+	stale, err := m.fileRepo.StaleWorkDirs(m.policy.StaleAfter)
+	if err != nil {
+		m.logger.Warnw("Failed to list leaked work directories", "error", err)
+	}
+	for _, dir := range stale {
+		kind := LeakedRunDir
+		if repository.IsStagingDir(dir.Path) {
+			kind = LeakedStagingDir
+		}
+		report.LeakedDirs = append(report.LeakedDirs, LeakedDir{Path: dir.Path, Kind: kind, Bytes: dir.Bytes, ModifiedAt: dir.ModifiedAt})
+	}
+	sort.Slice(report.LeakedDirs, func(i, j int) bool { return report.LeakedDirs[i].Bytes > report.LeakedDirs[j].Bytes })
+
+	for _, volume := range report.Volumes {
+		if volume.Error == "" && volume.FreeBytes < m.policy.MinFreeBytes {
+			report.LowVolumes = append(report.LowVolumes, volume.Name)
+		}
+	}
+	if len(report.LowVolumes) > 0 {
+		m.logger.Warnw("Free disk space below the minimum", "volumes", report.LowVolumes,
+			"min_free", formatBytes(m.policy.MinFreeBytes))
+	}
+	if len(report.LeakedDirs) > 0 {
+		m.logger.Warnw("Work directories left behind by earlier runs", "count", len(report.LeakedDirs),
+			"bytes", leakedBytes(report.LeakedDirs))
+	}
+
+	m.record(report)
+	m.mu.Lock()
+	m.last = report
+	m.mu.Unlock()
+	return report
+}
+
+// CheckTrainingSpace refuses a training run on the given datasets unless its projected usage fits
+// on disk: the run copies the datasets to its temp directory and stages its models next to the
+// installed ones, so the temp volume needs the size of the datasets and the model volume the size
+// of the installed models, on top of the free space the policy keeps. The error suggests what can
+// be cleaned up
+func (m *DiskMonitor) CheckTrainingSpace(datasets ...string) error {
+	if m == nil {
+		return nil
+	}
+	report := m.Refresh()
+
+	var datasetBytes uint64
+	for _, path := range datasets {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat dataset %s: %v", path, err)
+		}
+		datasetBytes += uint64(info.Size())
+	}
+	_, modelBytes, err := m.fileRepo.ModelDirUsage()
+	if err != nil {
+		return err
+	}
+
+	// Directories on the same volume add up
+	needed := make(map[uint64]uint64)
+	volumes := make(map[uint64]DiskVolume)
+	names := make(map[uint64][]string)
+	for _, volume := range report.Volumes {
+		if volume.Error != "" {
+			continue
+		}
+		switch volume.Name {
+		case VolumeTemp:
+			needed[volume.device] += datasetBytes
+		case VolumeModels:
+			needed[volume.device] += uint64(modelBytes)
+		default:
+			continue
+		}
+		volumes[volume.device] = volume
+		names[volume.device] = append(names[volume.device], volume.Name)
+	}
+
+	var short []string
+	for device, volume := range volumes {
+		required := needed[device] + m.policy.MinFreeBytes
+		if volume.FreeBytes < required {
+			short = append(short, fmt.Sprintf("%s volume has %s free of the %s the run needs",
+				strings.Join(names[device], " and "), formatBytes(volume.FreeBytes), formatBytes(required)))
+		}
+	}
+	if len(short) == 0 {
+		return nil
+	}
+	sort.Strings(short)
+	return fmt.Errorf("%w: %s; %s", ErrInsufficientDiskSpace, strings.Join(short, ", "), m.cleanupSuggestions(report))
+}
+
+// cleanupSuggestions lists what can be removed to free space
+func (m *DiskMonitor) cleanupSuggestions(report *DiskReport) string {
+	var suggestions []string
+	if len(report.LeakedDirs) > 0 {
+		paths := make([]string, 0, 3)
+		for _, dir := range report.LeakedDirs {
+			if len(paths) == cap(paths) {
+				break
+			}
+			paths = append(paths, dir.Path)
+		}
+		suggestions = append(suggestions, fmt.Sprintf("remove the %d work directories left behind by earlier runs (%s), such as %s",
+			len(report.LeakedDirs), formatBytes(uint64(leakedBytes(report.LeakedDirs))), strings.Join(paths, ", ")))
+	}
+	for _, usage := range report.Artifacts {
+		if usage.Location == VolumeArtifactStore && usage.Count > 1 {
+			suggestions = append(suggestions, fmt.Sprintf("delete old versions from the artifact store at %s (%d versions, %s)",
+				m.policy.ArtifactStorePath, usage.Count, formatBytes(uint64(usage.Bytes))))
+		}
+	}
+	suggestions = append(suggestions, "free space on the volumes or lower DISK_MIN_FREE_BYTES")
+	return "to clean up: " + strings.Join(suggestions, "; ")
+}
+
+// volumes measures the volumes holding the service directories
+func (m *DiskMonitor) volumes() []DiskVolume {
+	dirs := [][2]string{
+		{VolumeData, m.fileRepo.GetDataFilePath("")},
+		{VolumeModels, m.fileRepo.GetModelPath()},
+		{VolumeTemp, m.fileRepo.TempPath()},
+	}
+	if m.policy.ArtifactStorePath != "" {
+		dirs = append(dirs, [2]string{VolumeArtifactStore, m.policy.ArtifactStorePath})
+	}
+
+	volumes := make([]DiskVolume, 0, len(dirs))
+	for _, dir := range dirs {
+		volume := DiskVolume{Name: dir[0], Path: dir[1]}
+		space, err := m.fileRepo.Volume(dir[1])
+		if err != nil {
+			volume.Error = err.Error()
+		} else {
+			volume.device, volume.TotalBytes, volume.FreeBytes = space.Device, space.TotalBytes, space.FreeBytes
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes
+}
+
+// artifactUsage measures the artifacts installed in the model directory and kept in the artifact
+// store; a location that can't be read is left out with a warning
+func (m *DiskMonitor) artifactUsage() []ArtifactUsage {
+	var usage []ArtifactUsage
+	if files, bytes, err := m.fileRepo.ModelDirUsage(); err != nil {
+		m.logger.Warnw("Failed to measure the model directory", "error", err)
+	} else {
+		usage = append(usage, ArtifactUsage{Location: VolumeModels, Count: files, Bytes: bytes})
+	}
+	if m.policy.ArtifactStorePath != "" {
+		if versions, bytes, err := repository.DirSize(m.policy.ArtifactStorePath); err != nil {
+			m.logger.Warnw("Failed to measure the artifact store", "error", err)
+		} else {
+			usage = append(usage, ArtifactUsage{Location: VolumeArtifactStore, Count: versions, Bytes: bytes})
+		}
+	}
+	return usage
+}
+
+// record sets the disk metrics from a report
+func (m *DiskMonitor) record(report *DiskReport) {
+	if m.totalBytes == nil {
+		return
+	}
+	for _, volume := range report.Volumes {
+		if volume.Error != "" {
+			continue
+		}
+		m.totalBytes.WithLabelValues(volume.Name).Set(float64(volume.TotalBytes))
+		m.freeBytes.WithLabelValues(volume.Name).Set(float64(volume.FreeBytes))
+	}
+	for _, usage := range report.Artifacts {
+		m.artifacts.WithLabelValues(usage.Location).Set(float64(usage.Count))
+		m.artifactSum.WithLabelValues(usage.Location).Set(float64(usage.Bytes))
+	}
+	for _, kind := range []string{LeakedRunDir, LeakedStagingDir} {
+		count, bytes := 0, int64(0)
+		for _, dir := range report.LeakedDirs {
+			if dir.Kind == kind {
+				count++
+				bytes += dir.Bytes
+			}
+		}
+		m.leaked.WithLabelValues(kind).Set(float64(count))
+		m.leakedBytes.WithLabelValues(kind).Set(float64(bytes))
+	}
+}
+
+// leakedBytes returns the total size of leaked directories
+func leakedBytes(dirs []LeakedDir) int64 {
+	var total int64
+	for _, dir := range dirs {
+		total += dir.Bytes
+	}
+	return total
+}
+
+// formatBytes formats a size with a binary unit, e.g. "1.5 GiB"
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
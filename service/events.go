@@ -0,0 +1,158 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// Model lifecycle event types
+const (
+	// EventModelTrained is recorded when a training run produces a complete set of models
+	EventModelTrained = "model_trained"
+	// EventModelPromoted is recorded when a model version becomes the active one
+	EventModelPromoted = "model_promoted"
+	// EventModelRolledBack is recorded when the active version is replaced by an earlier one
+	EventModelRolledBack = "model_rolled_back"
+	// EventDriftDetected is recorded when live data or errors move away from what a model was trained on
+	EventDriftDetected = "drift_detected"
+	// EventArtifactDeleted is recorded when the artifacts of a model version are removed
+	EventArtifactDeleted = "artifact_deleted"
+	// EventModelStandby is recorded when a trained version is loaded next to the active one to be
+	// shadow-tested
+	EventModelStandby = "model_standby"
+	// EventModelStandbyRejected is recorded when a standby version leaves the slot without promotion
+	EventModelStandbyRejected = "model_standby_rejected"
+	// EventGoldenSetMismatch is recorded when a replica's outputs for the golden set drift from the
+	// outputs recorded for the model version
+	EventGoldenSetMismatch = "golden_set_mismatch"
+)
+
+// EventTypes lists the model lifecycle event types
+var EventTypes = []string{EventModelTrained, EventModelPromoted, EventModelRolledBack, EventDriftDetected, EventArtifactDeleted,
+	EventModelStandby, EventModelStandbyRejected, EventGoldenSetMismatch}
+
+// Event is a model lifecycle event
+type Event struct {
+	ID           int64           `json:"id"`
+	Type         string          `json:"type"`
+	ModelVersion string          `json:"model_version,omitempty"`
+	Details      json.RawMessage `json:"details,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// EventFilter narrows the event log; empty fields match everything
+type EventFilter struct {
+	Type         string
+	ModelVersion string
+	From         time.Time
+	To           time.Time
+}
+
+// ModelTrainedDetails describes a model_trained event
+type ModelTrainedDetails struct {
+	DatasetHash string       `json:"dataset_hash,omitempty"`
+	DatasetRows int64        `json:"dataset_rows"`
+	DurationMs  int64        `json:"duration_ms"`
+	PriceModel  ModelMetrics `json:"price_model"`
+	SalesModel  ModelMetrics `json:"sales_model"`
+	// Suspect marks a version kept out of production because its models look overfitted
+	Suspect bool `json:"suspect,omitempty"`
+}
+
+// ModelPromotedDetails describes a model_promoted event
+type ModelPromotedDetails struct {
+	PreviousVersion string `json:"previous_version,omitempty"`
+	// Shadow describes the shadow predictions of a version promoted from the standby slot
+	Shadow *ShadowStats `json:"shadow,omitempty"`
+}
+
+// ModelStandbyDetails describes a model_standby event
+type ModelStandbyDetails struct {
+	ActiveVersion string  `json:"active_version,omitempty"`
+	ShadowPercent float64 `json:"shadow_percent"`
+}
+
+// ModelStandbyRejectedDetails describes a model_standby_rejected event
+type ModelStandbyRejectedDetails struct {
+	Reasons []string     `json:"reasons"`
+	Shadow  *ShadowStats `json:"shadow,omitempty"`
+}
+
+// GoldenSetMismatchDetails describes a golden_set_mismatch event
+type GoldenSetMismatchDetails struct {
+	Engine string `json:"engine"`
+	// RecordedBy is the replica whose outputs missed the expectations
+	RecordedBy string         `json:"recorded_by"`
+	Cases      int            `json:"cases"`
+	Tolerance  float64        `json:"tolerance"`
+	Mismatches []GoldenResult `json:"mismatches"`
+}
+
+// EventStore holds the model lifecycle events. PostgresRepository implements it
+type EventStore interface {
+	InsertEvent(event *repository.Event) error
+	ListEvents(filter repository.EventFilter, limit, offset int) ([]repository.Event, int, error)
+}
+
+// EventLog is the append-only log of model lifecycle events. Events are what happened to models
+// rather than who asked for it, which the audit log records
+type EventLog struct {
+	postgresRepo EventStore
+	logger       *zap.SugaredLogger
+}
+
+// NewEventLog creates a new event log
+func NewEventLog(postgresRepo EventStore, logger *zap.SugaredLogger) *EventLog {
+	return &EventLog{
+		postgresRepo: postgresRepo,
+		logger:       logger,
+	}
+}
+
+// Record appends an event with the given details. The event is also written to the service log,
+// and a failed insert is only logged, so recording never fails the operation it describes
+func (l *EventLog) Record(eventType, modelVersion string, details any) {
+	l.logger.Infow("Model lifecycle event", "type", eventType, "model_version", modelVersion)
+
+	var data []byte
+	if details != nil {
+		var err error
+		if data, err = json.Marshal(details); err != nil {
+			l.logger.Errorw("Failed to encode event details", "error", err, "type", eventType)
+		}
+	}
+
+	err := l.postgresRepo.InsertEvent(&repository.Event{
+		Type:         eventType,
+		ModelVersion: modelVersion,
+		Details:      data,
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		l.logger.Errorw("Failed to record event", "error", err, "type", eventType, "model_version", modelVersion)
+	}
+}
+
+// List returns a page of events matching the filter, newest first, and the total number of
+// matching events
+func (l *EventLog) List(filter EventFilter, limit, offset int) ([]Event, int, error) {
+	rows, total, err := l.postgresRepo.ListEvents(repository.EventFilter(filter), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	events := make([]Event, 0, len(rows))
+	for _, row := range rows {
+		events = append(events, Event{
+			ID:           row.ID,
+			Type:         row.Type,
+			ModelVersion: row.ModelVersion,
+			Details:      json.RawMessage(row.Details),
+			CreatedAt:    row.CreatedAt,
+		})
+	}
+	return events, total, nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Prediction strategies of the fallback chain
+const (
+	// PredictionStrategyGlobal runs the global models
+	PredictionStrategyGlobal = "global"
+	// PredictionStrategyCategory answers with the category's recent average sales in the region
+	PredictionStrategyCategory = "category"
+	// PredictionStrategyLastObserved repeats the latest history row of the product
+	PredictionStrategyLastObserved = "last_observed"
+)
+
+// Days of processed data, up to the category's latest date, the category heuristic averages
+const categoryBaselineWindowDays = 28
+
+// FallbackChain is the order in which prediction strategies are tried for predictions resolved
+// from history; the first one that answers is reported in the result. An empty chain only runs the
+// global models
+type FallbackChain []string
+
+// strategies returns the strategies to try in order
+func (c FallbackChain) strategies() []string {
+	if len(c) == 0 {
+		return []string{PredictionStrategyGlobal}
+	}
+	return c
+}
+
+// predictResolved runs the fallback chain on a resolved request. modelErr is the error of a model
+// pass that already failed for the request, in which case the global strategy is not run again.
+// A strategy that fails is skipped with a warning; when all of them fail the error of the first
+// is returned
+func (s *MLPredictionService) predictResolved(ctx context.Context, resolved *resolvedFeatures, modelErr error) (*PredictionResult, error) {
+	var firstErr error
+	var skipped []string
+	for _, strategy := range s.fallback.strategies() {
+		var result *PredictionResult
+		var err error
+		switch strategy {
+		case PredictionStrategyGlobal:
+			if err = modelErr; err == nil {
+				result, err = s.engine.Predict(ctx, resolved.modelRequest())
+			}
+		case PredictionStrategyCategory:
+			result, err = s.predictCategoryBaseline(resolved)
+		case PredictionStrategyLastObserved:
+			result, err = s.predictLastObserved(resolved)
+		}
+
+		if err == nil {
+			result.Strategy = strategy
+			if len(skipped) > 0 {
+				resolved.warnings = append(resolved.warnings, fmt.Sprintf("Predicted by the %s strategy after %s failed",
+					strategy, strings.Join(skipped, " and ")))
+			}
+			return result, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		s.logger.Warnw("Prediction strategy failed", "strategy", strategy, "error", err,
+			"product", resolved.request.ProductName,
+			"region", resolved.request.Region,
+			"seller", resolved.request.Seller)
+		skipped = append(skipped, strategy)
+	}
+	return nil, firstErr
+}
+
+// predictCategoryBaseline predicts the category's average daily sales in the region over the last
+// categoryBaselineWindowDays days of its data, at the product's current price, or the category's
+// average price when the product has none
+func (s *MLPredictionService) predictCategoryBaseline(resolved *resolvedFeatures) (*PredictionResult, error) {
+	request := resolved.request
+	baseline, err := s.postgresRepo.GetCategoryBaseline(request.Category, request.Region, resolved.predictionDate,
+		categoryBaselineWindowDays)
+	if err != nil {
+		return nil, err
+	}
+	if baseline == nil {
+		return nil, fmt.Errorf("category %s has no processed data in %s", request.Category, request.Region)
+	}
+
+	price := request.Price
+	if price <= 0 {
+		price = baseline.AvgPrice
+	}
+	return &PredictionResult{
+		PredictedPrice: price,
+		PredictedSales: baseline.AvgSales * salesForecastDays,
+	}, nil
+}
+
+// predictLastObserved predicts the price and daily sales of the product's latest history row on or
+// before the prediction date
+func (s *MLPredictionService) predictLastObserved(resolved *resolvedFeatures) (*PredictionResult, error) {
+	request := resolved.request
+	observation, err := s.postgresRepo.GetLastObservation(request.ProductName, request.Region, request.Seller,
+		resolved.predictionDate)
+	if err != nil {
+		return nil, err
+	}
+	if observation == nil {
+		return nil, fmt.Errorf("%s has no processed data in %s for seller %s", request.ProductName, request.Region, request.Seller)
+	}
+	return &PredictionResult{
+		PredictedPrice: observation.Price,
+		PredictedSales: observation.Sales * salesForecastDays,
+	}, nil
+}
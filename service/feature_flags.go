@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// Feature flags gating behaviours that are rolled out gradually
+const (
+	// FlagWorkerPool runs the tasks of catalog-wide jobs in parallel; off runs them one at a time
+	FlagWorkerPool = "worker_pool"
+	// FlagInferencePriority hands out Python process slots by priority; off serves every caller in
+	// arrival order
+	FlagInferencePriority = "inference_priority"
+	// FlagAsyncBatches accepts batches with a callback URL, evaluated per client
+	FlagAsyncBatches = "async_batches"
+)
+
+// Feature flag sources
+const (
+	FlagSourceDefault  = "default"
+	FlagSourceEnv      = "env"
+	FlagSourceDatabase = "database"
+)
+
+// Errors returned when changing feature flags
+var (
+	ErrFlagNotFound = errors.New("feature flag not found")
+	ErrInvalidFlag  = errors.New("invalid feature flag setting")
+)
+
+// featureFlagDescriptions lists the known flags; all of them are on unless configured otherwise
+var featureFlagDescriptions = map[string]string{
+	FlagWorkerPool:        "Run the tasks of simulations, async batches and reconciliation in parallel on the worker pool",
+	FlagInferencePriority: "Hand out Python prediction processes by priority instead of in arrival order",
+	FlagAsyncBatches:      "Accept batch predictions with a callback URL",
+}
+
+// FeatureFlagSetting is the state of a feature flag. A disabled flag is off for everyone. An enabled
+// flag is on for the listed clients and for Percentage percent of the others, picked by a stable
+// hash of the client, so that a client keeps its decision as the percentage grows
+type FeatureFlagSetting struct {
+	Enabled    bool     `json:"enabled"`
+	Percentage int      `json:"percentage"`
+	Clients    []string `json:"clients,omitempty"`
+}
+
+// FeatureFlag is a feature flag with its current setting and where the setting comes from
+type FeatureFlag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	FeatureFlagSetting
+	Source    string     `json:"source"`
+	UpdatedBy string     `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// FeatureFlagStore holds the feature flag settings stored over the configured defaults.
+// PostgresRepository implements it
+type FeatureFlagStore interface {
+	ListFeatureFlags() ([]repository.FeatureFlag, error)
+	SaveFeatureFlag(f *repository.FeatureFlag) error
+	DeleteFeatureFlag(name string) (bool, error)
+}
+
+// FeatureFlags evaluates feature flags. Defaults come from the configuration and settings stored in
+// the database override them; the stored settings are reloaded periodically, so a change made on one
+// replica reaches the others within the refresh interval
+type FeatureFlags struct {
+	postgresRepo FeatureFlagStore
+	defaults     map[string]FeatureFlag
+	interval     time.Duration
+	logger       *zap.SugaredLogger
+
+	mu     sync.RWMutex
+	stored map[string]repository.FeatureFlag
+}
+
+// NewFeatureFlags creates the feature flags with the configured defaults by flag name, refusing
+// unknown names and percentages outside 0-100
+func NewFeatureFlags(postgresRepo FeatureFlagStore, configured map[string]FeatureFlagSetting, interval time.Duration, logger *zap.SugaredLogger) (*FeatureFlags, error) {
+	defaults := make(map[string]FeatureFlag, len(featureFlagDescriptions))
+	for name, description := range featureFlagDescriptions {
+		defaults[name] = FeatureFlag{
+			Name:               name,
+			Description:        description,
+			FeatureFlagSetting: FeatureFlagSetting{Enabled: true, Percentage: 100},
+			Source:             FlagSourceDefault,
+		}
+	}
+	for name, setting := range configured {
+		flag, ok := defaults[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrFlagNotFound, name)
+		}
+		if err := validateFlagSetting(setting); err != nil {
+			return nil, fmt.Errorf("feature flag %s: %w", name, err)
+		}
+		flag.FeatureFlagSetting = setting
+		flag.Source = FlagSourceEnv
+		defaults[name] = flag
+	}
+
+	return &FeatureFlags{
+		postgresRepo: postgresRepo,
+		defaults:     defaults,
+		interval:     interval,
+		logger:       logger,
+		stored:       map[string]repository.FeatureFlag{},
+	}, nil
+}
+
+// Start reloads the stored settings until the context is cancelled
+func (f *FeatureFlags) Start(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.Refresh(); err != nil {
+				f.logger.Errorw("Failed to reload feature flags", "error", err)
+			}
+		}
+	}
+}
+
+// Refresh reloads the settings stored in the database. Settings of flags this build does not know
+// are ignored, so that replicas of different versions can share the table
+func (f *FeatureFlags) Refresh() error {
+	flags, err := f.postgresRepo.ListFeatureFlags()
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[string]repository.FeatureFlag, len(flags))
+	for _, flag := range flags {
+		if _, ok := f.defaults[flag.Name]; ok {
+			stored[flag.Name] = flag
+		}
+	}
+
+	f.mu.Lock()
+	f.stored = stored
+	f.mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether the flag is on for the client. Background work passes an empty client and
+// gets the flag whenever it is enabled, so for it the flag is a kill switch
+func (f *FeatureFlags) Enabled(name, client string) bool {
+	flag, ok := f.Get(name)
+	if !ok || !flag.Enabled {
+		return false
+	}
+	if client == "" || flag.Percentage >= 100 || slices.Contains(flag.Clients, client) {
+		return true
+	}
+	return rolloutBucket(name, client) < flag.Percentage
+}
+
+// Get returns a flag with its current setting
+func (f *FeatureFlags) Get(name string) (FeatureFlag, bool) {
+	flag, ok := f.defaults[name]
+	if !ok {
+		return FeatureFlag{}, false
+	}
+
+	f.mu.RLock()
+	stored, ok := f.stored[name]
+	f.mu.RUnlock()
+	if ok {
+		updatedAt := stored.UpdatedAt
+		flag.FeatureFlagSetting = FeatureFlagSetting{
+			Enabled:    stored.Enabled,
+			Percentage: stored.Percentage,
+			Clients:    stored.Clients,
+		}
+		flag.Source = FlagSourceDatabase
+		flag.UpdatedBy = stored.UpdatedBy
+		flag.UpdatedAt = &updatedAt
+	}
+	return flag, true
+}
+
+// List returns every flag with its current setting, ordered by name
+func (f *FeatureFlags) List() []FeatureFlag {
+	flags := make([]FeatureFlag, 0, len(f.defaults))
+	for name := range f.defaults {
+		flag, _ := f.Get(name)
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags
+}
+
+// Set stores a setting of the flag, overriding its default on every replica
+func (f *FeatureFlags) Set(name string, setting FeatureFlagSetting, caller string) (FeatureFlag, error) {
+	if _, ok := f.defaults[name]; !ok {
+		return FeatureFlag{}, ErrFlagNotFound
+	}
+	if err := validateFlagSetting(setting); err != nil {
+		return FeatureFlag{}, err
+	}
+
+	stored := repository.FeatureFlag{
+		Name:       name,
+		Enabled:    setting.Enabled,
+		Percentage: setting.Percentage,
+		Clients:    setting.Clients,
+		UpdatedBy:  caller,
+		UpdatedAt:  time.Now(),
+	}
+	if err := f.postgresRepo.SaveFeatureFlag(&stored); err != nil {
+		return FeatureFlag{}, err
+	}
+
+	f.mu.Lock()
+	f.stored[name] = stored
+	f.mu.Unlock()
+
+	flag, _ := f.Get(name)
+	return flag, nil
+}
+
+// Reset removes the stored setting of the flag, returning it to its configured default
+func (f *FeatureFlags) Reset(name string) (FeatureFlag, error) {
+	if _, ok := f.defaults[name]; !ok {
+		return FeatureFlag{}, ErrFlagNotFound
+	}
+	if _, err := f.postgresRepo.DeleteFeatureFlag(name); err != nil {
+		return FeatureFlag{}, err
+	}
+
+	f.mu.Lock()
+	delete(f.stored, name)
+	f.mu.Unlock()
+
+	flag, _ := f.Get(name)
+	return flag, nil
+}
+
+// validateFlagSetting checks the rollout percentage of a setting
+func validateFlagSetting(setting FeatureFlagSetting) error {
+	if setting.Percentage < 0 || setting.Percentage > 100 {
+		return fmt.Errorf("%w: percentage %d is outside 0-100", ErrInvalidFlag, setting.Percentage)
+	}
+	return nil
+}
+
+// rolloutBucket maps a client to a stable bucket in [0, 100) per flag, so that different flags
+// reach different clients first
+func rolloutBucket(name, client string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	hash.Write([]byte{0})
+	hash.Write([]byte(client))
+	return int(hash.Sum32() % 100)
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
+	"github.com/graduate-work-mirea/data-processor-service/internal/httpclient"
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// featureProviderCacheEntries bounds the number of cached provider responses
+const featureProviderCacheEntries = 10000
+
+// Outcomes of asking a provider for features
+const (
+	providerOutcomeCached  = "cached"
+	providerOutcomeFetched = "fetched"
+	providerOutcomeFailed  = "failed"
+	providerOutcomeSkipped = "skipped"
+)
+
+// FeatureProviders merges the features of external providers into feature vectors. Providers are
+// asked concurrently and their responses are cached per provider scope. A provider that fails only
+// leaves its features out with a warning; timeouts and skipping a provider that keeps failing are
+// left to its HTTP client, whose open circuit is counted as skipped
+type FeatureProviders struct {
+	providers []features.Provider
+	cacheTTL  time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedProviderFeatures
+
+	outcomes *metrics.CounterVec
+	latency  *metrics.HistogramVec
+	logger   *zap.SugaredLogger
+}
+
+// cachedProviderFeatures is a cached provider response
+type cachedProviderFeatures struct {
+	values    map[string]float64
+	expiresAt time.Time
+}
+
+// NewFeatureProviders creates the set of external providers. registry may be nil, in which case no
+// metrics are recorded
+func NewFeatureProviders(providers []features.Provider, cacheTTL time.Duration, registry *metrics.Registry, logger *zap.SugaredLogger) *FeatureProviders {
+	p := &FeatureProviders{
+		providers: providers,
+		cacheTTL:  cacheTTL,
+		cache:     make(map[string]cachedProviderFeatures),
+		logger:    logger,
+	}
+	if registry != nil {
+		p.outcomes = registry.NewCounterVec("ml_feature_provider_requests_total",
+			"Feature provider lookups by outcome: cached, fetched, failed or skipped", "provider", "outcome")
+		p.latency = registry.NewHistogramVec("ml_feature_provider_fetch_seconds",
+			"Duration of feature provider fetches", metrics.DefaultBuckets, "provider")
+	}
+	return p
+}
+
+// Names returns the names of the providers
+func (p *FeatureProviders) Names() []string {
+	names := make([]string, 0, len(p.providers))
+	for _, provider := range p.providers {
+		names = append(names, provider.Name())
+	}
+	return names
+}
+
+// Apply sets the external features of a vector for a prediction on date and returns a warning for
+// every provider whose features were left out
+func (p *FeatureProviders) Apply(ctx context.Context, vector *features.Vector, date time.Time) []string {
+	if p == nil || len(p.providers) == 0 {
+		return nil
+	}
+
+	key := features.Key{
+		ProductName: vector.ProductName,
+		Category:    vector.Category,
+		Region:      vector.Region,
+		Seller:      vector.Seller,
+	}
+	values := make([]map[string]float64, len(p.providers))
+	errs := make([]error, len(p.providers))
+
+	var wg sync.WaitGroup
+	for i, provider := range p.providers {
+		wg.Add(1)
+		go func(i int, provider features.Provider) {
+			defer wg.Done()
+			values[i], errs[i] = p.fetch(ctx, provider, key, date)
+		}(i, provider)
+	}
+	wg.Wait()
+
+	var warnings []string
+	for i, provider := range p.providers {
+		name := provider.Name()
+		if errs[i] != nil {
+			warnings = append(warnings, fmt.Sprintf("features of provider %s are missing: %v", name, errs[i]))
+			continue
+		}
+		if len(values[i]) > 0 && vector.External == nil {
+			vector.External = make(map[string]float64)
+		}
+		for feature, value := range values[i] {
+			vector.External[features.ExternalName(name, feature)] = value
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// fetch returns the features of one provider from the cache or the provider itself
+func (p *FeatureProviders) fetch(ctx context.Context, provider features.Provider, key features.Key, date time.Time) (map[string]float64, error) {
+	name := provider.Name()
+	cacheKey := name + "\x00" + provider.Scope(key, date)
+	if refresh, ok := ctx.Value(providerRefreshKey{}).(*providerRefresh); ok && refresh.first(cacheKey) {
+		p.drop(cacheKey)
+	}
+	if values, ok := p.cached(cacheKey); ok {
+		p.observe(name, providerOutcomeCached)
+		return values, nil
+	}
+
+	start := time.Now()
+	values, err := provider.Fetch(ctx, key, date)
+	if errors.Is(err, httpclient.ErrCircuitOpen) {
+		p.observe(name, providerOutcomeSkipped)
+		return nil, fmt.Errorf("skipped after consecutive failures: %w", err)
+	}
+	if p.latency != nil {
+		p.latency.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+	if err != nil {
+		p.observe(name, providerOutcomeFailed)
+		return nil, err
+	}
+
+	p.store(cacheKey, values)
+	p.observe(name, providerOutcomeFetched)
+	return values, nil
+}
+
+// cached returns an unexpired cached response
+func (p *FeatureProviders) cached(cacheKey string) (map[string]float64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.cache[cacheKey]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.values, true
+}
+
+// drop removes a cached response
+func (p *FeatureProviders) drop(cacheKey string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.cache, cacheKey)
+}
+
+// store caches a response, evicting expired entries first and arbitrary ones when the cache is
+// still full
+func (p *FeatureProviders) store(cacheKey string, values map[string]float64) {
+	if p.cacheTTL <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.cache) >= featureProviderCacheEntries {
+		now := time.Now()
+		for k, entry := range p.cache {
+			if now.After(entry.expiresAt) {
+				delete(p.cache, k)
+			}
+		}
+		for k := range p.cache {
+			if len(p.cache) < featureProviderCacheEntries {
+				break
+			}
+			delete(p.cache, k)
+		}
+	}
+	p.cache[cacheKey] = cachedProviderFeatures{values: values, expiresAt: time.Now().Add(p.cacheTTL)}
+}
+
+// observe counts a lookup outcome
+func (p *FeatureProviders) observe(provider, outcome string) {
+	if p.outcomes != nil {
+		p.outcomes.WithLabelValues(provider, outcome).Inc()
+	}
+}
+
+type providerRefreshKey struct{}
+
+// providerRefresh tracks the cached responses a refresh already dropped, so that every scope is
+// fetched again once however many predictions share it
+type providerRefresh struct {
+	mu      sync.Mutex
+	dropped map[string]bool
+}
+
+// first reports whether cacheKey is seen for the first time
+func (r *providerRefresh) first(cacheKey string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dropped[cacheKey] {
+		return false
+	}
+	r.dropped[cacheKey] = true
+	return true
+}
+
+// withProviderRefresh makes the predictions made with ctx fetch their external features again
+// instead of using the cached responses, which are replaced
+func withProviderRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, providerRefreshKey{}, &providerRefresh{dropped: make(map[string]bool)})
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/evaluation"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// ForecastActualsStore holds the forecasts ForecastActualsUpdater reconciles with what happened.
+// PostgresRepository implements it
+type ForecastActualsStore interface {
+	ForecastActualSource
+	ListPendingActualsDates(asOf time.Time) ([]time.Time, error)
+	UpdateForecastActuals(asOf, forecastDate time.Time) (int64, error)
+}
+
+// ForecastActualsUpdater fills in the actual price and sales of stored forecasts once their
+// horizon has passed and processed data for it is available. It runs as the reconciliation job,
+// updating the forecasts of every forecast date as a task of the worker pool, and logs the accuracy
+// of the forecasts it reconciled.
+type ForecastActualsUpdater struct {
+	postgresRepo ForecastActualsStore
+	workers      *WorkerPool
+	metrics      evaluation.MetricSet
+	logger       *zap.SugaredLogger
+}
+
+// NewForecastActualsUpdater creates a new forecast actuals updater
+func NewForecastActualsUpdater(postgresRepo ForecastActualsStore, workers *WorkerPool, metrics evaluation.MetricSet, logger *zap.SugaredLogger) *ForecastActualsUpdater {
+	return &ForecastActualsUpdater{
+		postgresRepo: postgresRepo,
+		workers:      workers,
+		metrics:      metrics,
+		logger:       logger,
+	}
+}
+
+// Update fills in the actuals of every forecast whose horizon ended by today
+func (u *ForecastActualsUpdater) Update(ctx context.Context) error {
+	asOf := time.Now()
+	dates, err := u.postgresRepo.ListPendingActualsDates(asOf)
+	if err != nil {
+		return err
+	}
+
+	var updated atomic.Int64
+	err = u.workers.Run(ctx, WorkloadReconciliation, len(dates), func(ctx context.Context, i int) error {
+		count, err := u.postgresRepo.UpdateForecastActuals(asOf, dates[i])
+		updated.Add(count)
+		return err
+	})
+	if updated.Load() > 0 {
+		u.logger.Infow("Forecast actuals updated", "forecasts", updated.Load(), "dates", len(dates))
+		u.logAccuracy(asOf)
+	}
+	return err
+}
+
+// logAccuracy logs the accuracy of the forecasts whose actuals were filled in since asOf
+func (u *ForecastActualsUpdater) logAccuracy(asOf time.Time) {
+	report, err := forecastAccuracy(u.postgresRepo, u.metrics, repository.ForecastActualFilter{UpdatedSince: asOf}, "")
+	if err != nil {
+		u.logger.Warnw("Failed to evaluate reconciled forecasts", "error", err)
+		return
+	}
+	u.logger.Infow("Reconciled forecast accuracy", "forecasts", report.Overall.Forecasts,
+		"sales", report.Overall.Sales, "price", report.Overall.Price)
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxRecomputeForecasts bounds the keys and dates a recompute may match
+	maxRecomputeForecasts = 10000
+	// recomputeChunkSize is the number of forecasts predicted in one model pass
+	recomputeChunkSize = 500
+)
+
+// ErrInvalidRecomputeRequest is returned when a forecast recompute request fails validation
+var ErrInvalidRecomputeRequest = errors.New("invalid forecast recompute request")
+
+// ForecastRecomputeRequest selects the stored forecasts to recompute. Empty product, region and
+// seller match every value; the dates are in YYYY-MM-DD format and inclusive
+type ForecastRecomputeRequest struct {
+	ProductName string `json:"product_name,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Seller      string `json:"seller,omitempty"`
+	From        string `json:"from" binding:"required"`
+	To          string `json:"to" binding:"required"`
+}
+
+// ForecastRecomputeFailure is a forecast that could not be predicted again
+type ForecastRecomputeFailure struct {
+	ProductName  string    `json:"product_name"`
+	Region       string    `json:"region"`
+	Seller       string    `json:"seller"`
+	ForecastDate time.Time `json:"forecast_date"`
+	// ErrorCode is one of the batch item error codes
+	ErrorCode string `json:"error_code"`
+	Error     string `json:"error"`
+}
+
+// ForecastRecomputeReport is the outcome of a recompute
+type ForecastRecomputeReport struct {
+	// ModelVersion is the version the forecasts were predicted with again
+	ModelVersion string `json:"model_version"`
+	// Matched is the number of keys and dates recomputed, and Deleted the number of stored
+	// forecasts of any model version they had
+	Matched    int   `json:"matched"`
+	Deleted    int64 `json:"deleted"`
+	Recomputed int   `json:"recomputed"`
+	// Unstored counts the predictions a fallback strategy answered, which are not stored as
+	// forecasts
+	Unstored   int                        `json:"unstored"`
+	Failed     int                        `json:"failed"`
+	Failures   []ForecastRecomputeFailure `json:"failures"`
+	DurationMs int64                      `json:"duration_ms"`
+}
+
+// ForecastRecomputeStore lists and replaces the stored forecasts ForecastRecomputer predicts again.
+// PostgresRepository implements it
+type ForecastRecomputeStore interface {
+	ListForecastKeys(filter repository.ForecastFilter, limit int) ([]repository.ForecastKey, error)
+	DeleteForecasts(filter repository.ForecastFilter) (int64, error)
+}
+
+// ForecastRecomputer predicts stored forecasts again after backfills or corrections of
+// processed_data changed the history they were built from
+type ForecastRecomputer struct {
+	mlService    *MLPredictionService
+	postgresRepo ForecastRecomputeStore
+	logger       *zap.SugaredLogger
+}
+
+// NewForecastRecomputer creates a forecast recomputer
+func NewForecastRecomputer(mlService *MLPredictionService, postgresRepo ForecastRecomputeStore, logger *zap.SugaredLogger) *ForecastRecomputer {
+	return &ForecastRecomputer{
+		mlService:    mlService,
+		postgresRepo: postgresRepo,
+		logger:       logger,
+	}
+}
+
+// filter validates the request and returns the forecasts it selects
+func (r *ForecastRecomputer) filter(request *ForecastRecomputeRequest) (repository.ForecastFilter, error) {
+	filter := repository.ForecastFilter{
+		ProductName: request.ProductName,
+		Region:      request.Region,
+		Seller:      request.Seller,
+	}
+	var err error
+	if filter.From, err = time.Parse("2006-01-02", request.From); err != nil {
+		return filter, fmt.Errorf("%w: from must be in YYYY-MM-DD format", ErrInvalidRecomputeRequest)
+	}
+	if filter.To, err = time.Parse("2006-01-02", request.To); err != nil {
+		return filter, fmt.Errorf("%w: to must be in YYYY-MM-DD format", ErrInvalidRecomputeRequest)
+	}
+	if filter.To.Before(filter.From) {
+		return filter, fmt.Errorf("%w: to must not be before from", ErrInvalidRecomputeRequest)
+	}
+	return filter, nil
+}
+
+// Recompute deletes the stored forecasts the request selects and predicts them again on their
+// dates with the installed models, which stores them anew; the actuals of past dates are filled in
+// again by the next reconciliation. External features of the forecasts are fetched again rather
+// than read from the cache of the providers
+func (r *ForecastRecomputer) Recompute(ctx context.Context, request *ForecastRecomputeRequest) (*ForecastRecomputeReport, error) {
+	filter, err := r.filter(request)
+	if err != nil {
+		return nil, err
+	}
+	s := r.mlService
+	started := time.Now()
+
+	keys, err := r.postgresRepo.ListForecastKeys(filter, maxRecomputeForecasts+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) > maxRecomputeForecasts {
+		return nil, fmt.Errorf("%w: the filter matches more than %d forecasts, narrow it", ErrInvalidRecomputeRequest, maxRecomputeForecasts)
+	}
+
+	report := &ForecastRecomputeReport{
+		ModelVersion: s.ActiveModelVersion(),
+		Matched:      len(keys),
+		Failures:     []ForecastRecomputeFailure{},
+	}
+	if len(keys) == 0 {
+		report.DurationMs = time.Since(started).Milliseconds()
+		return report, nil
+	}
+	if report.Deleted, err = r.postgresRepo.DeleteForecasts(filter); err != nil {
+		return nil, err
+	}
+
+	requests := make([]*PredictionRequestMinimal, len(keys))
+	for i, key := range keys {
+		date := key.ForecastDate
+		requests[i] = &PredictionRequestMinimal{
+			ProductName:    key.ProductName,
+			Region:         key.Region,
+			Seller:         key.Seller,
+			PredictionDate: &date,
+		}
+	}
+	err = s.StreamMinimalBatch(withProviderRefresh(ctx), requests, recomputeChunkSize, func(item *BatchItemResult) error {
+		switch {
+		case item.Succeeded() && item.Result.Strategy == PredictionStrategyGlobal:
+			report.Recomputed++
+		case item.Succeeded():
+			report.Unstored++
+		default:
+			key := keys[item.Index]
+			report.Failed++
+			report.Failures = append(report.Failures, ForecastRecomputeFailure{
+				ProductName:  key.ProductName,
+				Region:       key.Region,
+				Seller:       key.Seller,
+				ForecastDate: key.ForecastDate,
+				ErrorCode:    item.ErrorCode,
+				Error:        item.Error,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		// The forecasts are deleted already, so the log tells how far the recompute got
+		r.logger.Errorw("Forecast recompute stopped", "error", err, "matched", report.Matched,
+			"recomputed", report.Recomputed, "failed", report.Failed)
+		return nil, err
+	}
+
+	report.DurationMs = time.Since(started).Milliseconds()
+	r.logger.Infow("Forecasts recomputed", "product", request.ProductName, "region", request.Region,
+		"seller", request.Seller, "from", request.From, "to", request.To, "matched", report.Matched,
+		"recomputed", report.Recomputed, "unstored", report.Unstored, "failed", report.Failed)
+	return report, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/evaluation"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// Forecast is a stored forecast with its actuals once the horizon has passed
+type Forecast struct {
+	ForecastDate   time.Time `json:"forecast_date"`
+	HorizonDays    int       `json:"horizon_days"`
+	PredictedPrice float64   `json:"predicted_price"`
+	PredictedSales float64   `json:"predicted_sales"`
+	ModelVersion   string    `json:"model_version"`
+	CreatedAt      time.Time `json:"created_at"`
+	ActualPrice    *float64  `json:"actual_price"`
+	ActualSales    *float64  `json:"actual_sales"`
+}
+
+// ForecastStore provides the stored forecasts and history ForecastService reads, and the first
+// days of earlier launches that launch forecasts are built from. PostgresRepository implements it
+type ForecastStore interface {
+	ForecastActualSource
+	EachLatestForecast(productName, region, seller string, from, to time.Time, fn func(*repository.Forecast) error) error
+	GetLatestForecasts(productName, region, seller string, from, to time.Time) ([]repository.Forecast, error)
+	GetProductSeries(productName, region, seller string, from, to time.Time) ([]repository.SeriesPoint, error)
+	GetCategorySeries(category string, from, to time.Time) ([]repository.SeriesPoint, error)
+	GetCategoryForecasts(category string, from, to time.Time) ([]repository.Forecast, error)
+	GetWindowCoverage(products, regions, sellers []string, from, to time.Time) ([]repository.WindowCoverage, error)
+	HasProductHistory(productName string) (bool, error)
+	LaunchAnalogDays(category string, days int) ([]repository.LaunchAnalogDay, error)
+}
+
+// ForecastService reads stored forecasts and builds launch forecasts of new products
+type ForecastService struct {
+	postgresRepo ForecastStore
+	metrics      evaluation.MetricSet
+	logger       *zap.SugaredLogger
+}
+
+// NewForecastService creates a new forecast service
+func NewForecastService(postgresRepo ForecastStore, metrics evaluation.MetricSet, logger *zap.SugaredLogger) *ForecastService {
+	return &ForecastService{
+		postgresRepo: postgresRepo,
+		metrics:      metrics,
+		logger:       logger,
+	}
+}
+
+// LatestForecasts returns the latest forecast per target date for a product, region and seller
+func (s *ForecastService) LatestForecasts(productName, region, seller string, from, to time.Time) ([]Forecast, error) {
+	forecasts := make([]Forecast, 0)
+	err := s.EachLatestForecast(productName, region, seller, from, to, func(forecast *Forecast) error {
+		forecasts = append(forecasts, *forecast)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return forecasts, nil
+}
+
+// EachLatestForecast calls fn with the forecasts LatestForecasts returns, one at a time as they are
+// read from the database. An error from fn stops the iteration and is returned
+func (s *ForecastService) EachLatestForecast(productName, region, seller string, from, to time.Time, fn func(*Forecast) error) error {
+	return s.postgresRepo.EachLatestForecast(productName, region, seller, from, to, func(row *repository.Forecast) error {
+		return fn(&Forecast{
+			ForecastDate:   row.ForecastDate,
+			HorizonDays:    row.HorizonDays,
+			PredictedPrice: row.PredictedPrice,
+			PredictedSales: row.PredictedSales,
+			ModelVersion:   row.ModelVersion,
+			CreatedAt:      row.CreatedAt,
+			ActualPrice:    row.ActualPrice,
+			ActualSales:    row.ActualSales,
+		})
+	})
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// Golden set errors
+var (
+	ErrGoldenSetDisabled = errors.New("golden set verification is disabled, set GOLDEN_SET_FILE")
+	ErrNoModelVersion    = errors.New("no model version is installed")
+)
+
+// CheckGoldenSet is the dependency check failing while the loaded models miss their golden outputs
+const CheckGoldenSet = "golden_set"
+
+// GoldenCase is a fixed feature vector of the golden set
+type GoldenCase struct {
+	Name     string            `json:"name"`
+	Features PredictionRequest `json:"features"`
+}
+
+// LoadGoldenCases reads a golden set file, a JSON array of named feature vectors
+func LoadGoldenCases(path string) ([]GoldenCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading golden set: %w", err)
+	}
+	var cases []GoldenCase
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("error parsing golden set: %w", err)
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("golden set %s has no cases", path)
+	}
+	names := make(map[string]bool, len(cases))
+	for _, c := range cases {
+		if c.Name == "" {
+			return nil, fmt.Errorf("golden set %s has a case without a name", path)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("golden set %s has more than one case named %q", path, c.Name)
+		}
+		names[c.Name] = true
+	}
+	return cases, nil
+}
+
+// GoldenResult compares the output of the loaded models for a golden set case with the expected one
+type GoldenResult struct {
+	Name     string           `json:"name"`
+	Expected PredictionOutput `json:"expected"`
+	Actual   PredictionOutput `json:"actual"`
+	// PriceDiff and SalesDiff are the absolute differences relative to the expected values, or the
+	// absolute differences when the expected values are below 1
+	PriceDiff float64 `json:"price_diff"`
+	SalesDiff float64 `json:"sales_diff"`
+	// Recorded marks an expectation that this check recorded, the case was not verified against
+	// another replica's output
+	Recorded bool `json:"recorded,omitempty"`
+	Matches  bool `json:"matches"`
+}
+
+// GoldenCheck is the outcome of running the golden set through the loaded models
+type GoldenCheck struct {
+	ModelVersion string    `json:"model_version"`
+	Engine       string    `json:"engine"`
+	Tolerance    float64   `json:"tolerance"`
+	CheckedAt    time.Time `json:"checked_at"`
+	Passed       bool      `json:"passed"`
+	Cases        int       `json:"cases"`
+	Mismatches   int       `json:"mismatches"`
+	Recorded     int       `json:"recorded"`
+	// Error is set when the models failed to predict the golden set
+	Error   string         `json:"error,omitempty"`
+	Results []GoldenResult `json:"results,omitempty"`
+}
+
+// GoldenOutputStore holds the golden set outputs recorded for every model version.
+// PostgresRepository implements it
+type GoldenOutputStore interface {
+	ListGoldenOutputs(version string) ([]repository.GoldenOutput, error)
+	SaveGoldenOutputs(outputs []repository.GoldenOutput) error
+}
+
+// GoldenSet runs a fixed set of feature vectors through the models every time a replica loads a
+// version and compares the outputs with those recorded for the version. The first replica to
+// verify a version, usually the one that trained it, records the expectations; a replica whose
+// numeric stack differs, such as another LightGBM build, then fails the check
+type GoldenSet struct {
+	cases        []GoldenCase
+	hashes       []string
+	tolerance    float64
+	engine       InferenceEngine
+	engineName   string
+	fileRepo     *repository.FileRepository
+	postgresRepo GoldenOutputStore
+	events       *EventLog
+	mismatches   *metrics.GaugeVec
+	logger       *zap.SugaredLogger
+
+	// mu serializes checks so that concurrent loads don't record expectations twice
+	mu   sync.Mutex
+	last *GoldenCheck
+}
+
+// NewGoldenSet creates a golden set verifier of the models the engine serves
+func NewGoldenSet(cases []GoldenCase, tolerance float64, engine InferenceEngine, engineName string, fileRepo *repository.FileRepository,
+	postgresRepo GoldenOutputStore, events *EventLog, registry *metrics.Registry, logger *zap.SugaredLogger) (*GoldenSet, error) {
+	hashes := make([]string, len(cases))
+	for i, c := range cases {
+		data, err := json.Marshal(c.Features)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding golden case %s: %w", c.Name, err)
+		}
+		sum := sha256.Sum256(data)
+		hashes[i] = hex.EncodeToString(sum[:8])
+	}
+	return &GoldenSet{
+		cases:        cases,
+		hashes:       hashes,
+		tolerance:    tolerance,
+		engine:       engine,
+		engineName:   engineName,
+		fileRepo:     fileRepo,
+		postgresRepo: postgresRepo,
+		events:       events,
+		mismatches: registry.NewGaugeVec("ml_golden_set_mismatches",
+			"Golden set cases outside tolerance in the latest check of the loaded models, -1 when they failed to predict"),
+		logger: logger,
+	}, nil
+}
+
+// Last returns the latest check of this replica, nil before the first one
+func (g *GoldenSet) Last() (*GoldenCheck, error) {
+	if g == nil {
+		return nil, ErrGoldenSetDisabled
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.last, nil
+}
+
+// Check is the golden_set dependency check: it fails while the latest check did not pass
+func (g *GoldenSet) Check(ctx context.Context) error {
+	last, _ := g.Last()
+	switch {
+	case last == nil || last.Passed:
+		return nil
+	case last.Error != "":
+		return fmt.Errorf("model version %s failed to predict the golden set: %s", last.ModelVersion, last.Error)
+	default:
+		return fmt.Errorf("model version %s misses %d of %d golden outputs on this replica", last.ModelVersion, last.Mismatches, last.Cases)
+	}
+}
+
+// VerifyLoaded checks the models the engine just loaded; a failure is only logged. It does nothing
+// when golden set verification is disabled
+func (g *GoldenSet) VerifyLoaded(ctx context.Context) {
+	if g == nil {
+		return
+	}
+	if _, err := g.Verify(ctx); err != nil {
+		g.logger.Warnw("Failed to verify models against the golden set", "error", err)
+	}
+}
+
+// Verify runs the golden set through the installed models and compares the outputs with the
+// expectations recorded for the version, recording those missing
+func (g *GoldenSet) Verify(ctx context.Context) (*GoldenCheck, error) {
+	if g == nil {
+		return nil, ErrGoldenSetDisabled
+	}
+	version := g.fileRepo.ReadModelVersion()
+	if version == "" {
+		return nil, ErrNoModelVersion
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	check := &GoldenCheck{
+		ModelVersion: version,
+		Engine:       g.engineName,
+		Tolerance:    g.tolerance,
+		CheckedAt:    time.Now(),
+		Cases:        len(g.cases),
+	}
+	outputs, err := g.predict(ctx)
+	if err != nil {
+		check.Error = err.Error()
+		g.finish(check)
+		return check, nil
+	}
+
+	expected, err := g.expectations(version)
+	if err != nil {
+		return nil, err
+	}
+	var missing []repository.GoldenOutput
+	for i, c := range g.cases {
+		if _, ok := expected[goldenKey(c.Name, g.hashes[i])]; !ok {
+			missing = append(missing, repository.GoldenOutput{
+				ModelVersion:   version,
+				CaseName:       c.Name,
+				CaseHash:       g.hashes[i],
+				PredictedPrice: outputs[i].Price,
+				PredictedSales: outputs[i].Sales,
+				Engine:         g.engineName,
+				RecordedBy:     replicaName(),
+				CreatedAt:      check.CheckedAt,
+			})
+		}
+	}
+	if len(missing) > 0 {
+		// Another replica may have recorded the same cases meanwhile, its expectations are kept
+		if err := g.postgresRepo.SaveGoldenOutputs(missing); err != nil {
+			return nil, err
+		}
+		if expected, err = g.expectations(version); err != nil {
+			return nil, err
+		}
+	}
+	recordedNow := make(map[string]bool, len(missing))
+	for _, output := range missing {
+		recordedNow[goldenKey(output.CaseName, output.CaseHash)] = true
+	}
+
+	for i, c := range g.cases {
+		key := goldenKey(c.Name, g.hashes[i])
+		want := expected[key]
+		result := GoldenResult{
+			Name:      c.Name,
+			Expected:  PredictionOutput{Price: want.PredictedPrice, Sales: want.PredictedSales},
+			Actual:    outputs[i],
+			PriceDiff: relativeDiff(outputs[i].Price, want.PredictedPrice),
+			SalesDiff: relativeDiff(outputs[i].Sales, want.PredictedSales),
+			Recorded:  recordedNow[key] && want.RecordedBy == replicaName(),
+		}
+		result.Matches = result.PriceDiff <= g.tolerance && result.SalesDiff <= g.tolerance
+		if result.Recorded {
+			check.Recorded++
+		}
+		if !result.Matches {
+			check.Mismatches++
+		}
+		check.Results = append(check.Results, result)
+	}
+	check.Passed = check.Mismatches == 0
+	g.finish(check)
+	return check, nil
+}
+
+// predict runs the golden set through the loaded models
+func (g *GoldenSet) predict(ctx context.Context) ([]PredictionOutput, error) {
+	requests := make([]*PredictionRequest, len(g.cases))
+	for i := range g.cases {
+		// The engine may fill in the request, the cases stay as loaded
+		features := g.cases[i].Features
+		requests[i] = &features
+	}
+	results, err := g.engine.PredictBatch(WithInferencePriority(ctx, PriorityBatch), requests)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) != len(requests) {
+		return nil, fmt.Errorf("engine returned %d results for %d golden cases", len(results), len(requests))
+	}
+	outputs := make([]PredictionOutput, len(results))
+	for i, result := range results {
+		outputs[i] = PredictionOutput{Price: result.PredictedPrice, Sales: result.PredictedSales}
+	}
+	return outputs, nil
+}
+
+// expectations returns the expected outputs of a version by case name and hash
+func (g *GoldenSet) expectations(version string) (map[string]repository.GoldenOutput, error) {
+	outputs, err := g.postgresRepo.ListGoldenOutputs(version)
+	if err != nil {
+		return nil, err
+	}
+	expected := make(map[string]repository.GoldenOutput, len(outputs))
+	for _, output := range outputs {
+		expected[goldenKey(output.CaseName, output.CaseHash)] = output
+	}
+	return expected, nil
+}
+
+// finish keeps the check as the latest one, and reports a failed one. Callers hold g.mu
+func (g *GoldenSet) finish(check *GoldenCheck) {
+	g.last = check
+	switch {
+	case check.Error != "":
+		g.mismatches.WithLabelValues().Set(-1)
+		g.logger.Errorw("Loaded models failed to predict the golden set", "version", check.ModelVersion, "error", check.Error)
+	case !check.Passed:
+		g.mismatches.WithLabelValues().Set(float64(check.Mismatches))
+		details := GoldenSetMismatchDetails{Engine: check.Engine, RecordedBy: replicaName(), Cases: check.Cases, Tolerance: check.Tolerance}
+		for _, result := range check.Results {
+			if !result.Matches {
+				details.Mismatches = append(details.Mismatches, result)
+			}
+		}
+		g.events.Record(EventGoldenSetMismatch, check.ModelVersion, details)
+		g.logger.Errorw("Loaded models miss their golden outputs, check the numeric libraries of this replica",
+			"version", check.ModelVersion, "mismatches", check.Mismatches, "cases", check.Cases)
+	default:
+		g.mismatches.WithLabelValues().Set(0)
+		g.logger.Infow("Loaded models match their golden outputs", "version", check.ModelVersion,
+			"cases", check.Cases, "recorded", check.Recorded)
+	}
+}
+
+// goldenKey identifies the expectation of a golden case
+func goldenKey(name, hash string) string {
+	return name + "/" + hash
+}
+
+// relativeDiff is the absolute difference of actual from expected relative to expected, or
+// absolute when expected is below 1
+func relativeDiff(actual, expected float64) float64 {
+	return math.Abs(actual-expected) / math.Max(math.Abs(expected), 1)
+}
+
+// replicaName identifies this replica in the expectations it records
+func replicaName() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}
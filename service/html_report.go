@@ -0,0 +1,316 @@
+package service
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
+	"github.com/graduate-work-mirea/data-processor-service/internal/locale"
+)
+
+const (
+	// reportTopFeatures is the number of features listed per target in an HTML report
+	reportTopFeatures = 10
+	// reportForecastRows is the number of latest forecasts listed in an HTML report
+	reportForecastRows = 14
+)
+
+// Size of the charts of an HTML report, in SVG user units
+const (
+	reportChartWidth  = 720
+	reportChartHeight = 220
+	reportChartMargin = 10
+)
+
+// ErrInvalidReportRequest is returned when an HTML report request fails validation
+var ErrInvalidReportRequest = errors.New("invalid report request")
+
+//go:embed templates/html_report.html
+var htmlReportSource string
+
+// htmlReportTemplate is parsed with the functions of the invariant locale; every report is rendered
+// by a clone with the functions of its own
+var htmlReportTemplate = template.Must(template.New("report").Funcs(reportFuncs(locale.Invariant)).Parse(htmlReportSource))
+
+// reportFuncs returns the template functions formatting the numbers of a report for a locale
+func reportFuncs(loc locale.Locale) template.FuncMap {
+	optional := func(format func(float64) string) func(*float64) string {
+		return func(value *float64) string {
+			if value == nil {
+				return "—"
+			}
+			return format(*value)
+		}
+	}
+	number := func(value float64) string { return loc.Number(value, 2) }
+	return template.FuncMap{
+		"number":         number,
+		"amount":         loc.Amount,
+		"percent":        func(value float64) string { return loc.Percent(value, 1) },
+		"date":           func(value time.Time) string { return value.Format("2006-01-02") },
+		"optional":       optional(number),
+		"optionalAmount": optional(loc.Amount),
+	}
+}
+
+// HTMLReportRequest selects the subject of an HTML report, either a product, region and seller or a
+// category, and the range of its charts; zero dates take the time series defaults. Locale formats
+// its numbers and prices
+type HTMLReportRequest struct {
+	ProductName string
+	Region      string
+	Seller      string
+	Category    string
+	From        time.Time
+	To          time.Time
+	Locale      locale.Locale
+}
+
+// reportChart is a line chart of an actual and a forecast series with its band, drawn as SVG
+// polylines split at missing days
+type reportChart struct {
+	Title string
+	// Amounts marks the values of the chart as prices
+	Amounts       bool
+	Width, Height int
+	Actual        []string
+	Forecast      []string
+	Band          []string
+	Min, Max      float64
+}
+
+// reportFeature is the importance of a feature to the model of a target
+type reportFeature struct {
+	Name string
+	Gain float64
+	// Share is the gain as a percentage of the total gain of the model
+	Share float64
+}
+
+// reportImportances are the most important features of the model of a target
+type reportImportances struct {
+	Target   string
+	Features []reportFeature
+}
+
+// htmlReportData is what the report template renders
+type htmlReportData struct {
+	Title        string
+	Subtitle     string
+	GeneratedAt  time.Time
+	ModelVersion string
+	Series       *TimeSeries
+	BandPercent  float64
+	PriceChart   reportChart
+	SalesChart   reportChart
+	Metrics      []string
+	Accuracy     AccuracyMetrics
+	// Forecasts are the latest days of the range with a forecast, latest first
+	Forecasts   []TimeSeriesPoint
+	Importances []reportImportances
+}
+
+// HTMLReport renders a self-contained HTML page for a product or a category: the charts of its
+// history and forecasts, the accuracy of the forecasts with actuals, the latest forecasts and the
+// feature importances of the installed models. Styles and charts are inline, so the page can be
+// attached to an email or a wiki as is
+func (s *ReportService) HTMLReport(request *HTMLReportRequest) ([]byte, error) {
+	product := request.ProductName != "" || request.Region != "" || request.Seller != ""
+	if product == (request.Category != "") {
+		return nil, fmt.Errorf("%w: either product, region and seller or category is required", ErrInvalidReportRequest)
+	}
+	if product && (request.ProductName == "" || request.Region == "" || request.Seller == "") {
+		return nil, fmt.Errorf("%w: product, region and seller are required together", ErrInvalidReportRequest)
+	}
+
+	data := &htmlReportData{
+		GeneratedAt:  time.Now(),
+		ModelVersion: s.fileRepo.ReadModelVersion(),
+		Metrics:      s.metrics,
+	}
+	var err error
+	if product {
+		data.Series, err = s.forecasts.TimeSeries(request.ProductName, request.Region, request.Seller, request.From, request.To)
+		data.Title = request.ProductName
+		data.Subtitle = request.Region + " · " + request.Seller
+	} else {
+		data.Series, err = s.forecasts.CategoryTimeSeries(request.Category, request.From, request.To)
+		data.Title = request.Category
+		data.Subtitle = "Category: mean price and total sales of its products"
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	series := data.Series
+	data.BandPercent = 100 * series.BandLevel
+	data.Accuracy = AccuracyMetrics{
+		Forecasts:      series.salesErrors.Count(),
+		PriceForecasts: series.priceErrors.Count(),
+		Price:          s.metrics.Evaluate(&series.priceErrors),
+		Sales:          s.metrics.Evaluate(&series.salesErrors),
+	}
+	for i := len(series.Points) - 1; i >= 0 && len(data.Forecasts) < reportForecastRows; i-- {
+		if series.Points[i].ForecastSales != nil {
+			data.Forecasts = append(data.Forecasts, series.Points[i])
+		}
+	}
+
+	// Forecast sales cover the horizon, so the chart shows them as a daily average
+	horizon := float64(series.HorizonDays)
+	perDay := func(value *float64) *float64 {
+		if value == nil {
+			return nil
+		}
+		daily := *value / horizon
+		return &daily
+	}
+	data.PriceChart = newReportChart("Price", series.Points, func(p *TimeSeriesPoint) [4]*float64 {
+		return [4]*float64{p.Price, p.ForecastPrice, p.ForecastPriceLower, p.ForecastPriceUpper}
+	})
+	data.PriceChart.Amounts = true
+	salesTitle := fmt.Sprintf("Sales per day, forecasts as the daily average of their %d-day horizon", series.HorizonDays)
+	data.SalesChart = newReportChart(salesTitle, series.Points, func(p *TimeSeriesPoint) [4]*float64 {
+		return [4]*float64{p.Sales, perDay(p.ForecastSales), perDay(p.ForecastSalesLower), perDay(p.ForecastSalesUpper)}
+	})
+
+	data.Importances = s.featureImportances()
+
+	return renderHTMLReport(data, request.Locale)
+}
+
+// renderHTMLReport executes the report template with the number formats of a locale
+func renderHTMLReport(data *htmlReportData, loc locale.Locale) ([]byte, error) {
+	tmpl, err := htmlReportTemplate.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	var page bytes.Buffer
+	if err := tmpl.Funcs(reportFuncs(loc)).Execute(&page, data); err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	return page.Bytes(), nil
+}
+
+// featureImportances returns the most important features of the installed models by target, the
+// core targets first. It is empty when the models did not record importances
+func (s *ReportService) featureImportances() []reportImportances {
+	data, err := s.fileRepo.ReadModelFile(featureInfoFile)
+	if err != nil {
+		return nil
+	}
+	info, err := parseModelInfo(data)
+	if err != nil {
+		s.logger.Warnw("Failed to read feature importances", "error", err)
+		return nil
+	}
+
+	var importances []reportImportances
+	for _, target := range append(append([]string(nil), features.CoreTargets...), info.ExtraTargets()...) {
+		gains := info.FeatureImportances[target]
+		if len(gains) == 0 {
+			continue
+		}
+		var total float64
+		ranked := make([]reportFeature, 0, len(gains))
+		for name, gain := range gains {
+			total += gain
+			ranked = append(ranked, reportFeature{Name: name, Gain: gain})
+		}
+		sort.Slice(ranked, func(i, j int) bool {
+			if ranked[i].Gain != ranked[j].Gain {
+				return ranked[i].Gain > ranked[j].Gain
+			}
+			return ranked[i].Name < ranked[j].Name
+		})
+		if len(ranked) > reportTopFeatures {
+			ranked = ranked[:reportTopFeatures]
+		}
+		for i := range ranked {
+			if total > 0 {
+				ranked[i].Share = 100 * ranked[i].Gain / total
+			}
+		}
+		importances = append(importances, reportImportances{Target: target, Features: ranked})
+	}
+	return importances
+}
+
+// newReportChart scales the actual, forecast, lower and upper values that values returns for each
+// point into a chart. Days without a value split the lines
+func newReportChart(title string, points []TimeSeriesPoint, values func(*TimeSeriesPoint) [4]*float64) reportChart {
+	chart := reportChart{Title: title, Width: reportChartWidth, Height: reportChartHeight, Min: math.Inf(1), Max: math.Inf(-1)}
+	for i := range points {
+		for _, value := range values(&points[i]) {
+			if value != nil {
+				chart.Min = math.Min(chart.Min, *value)
+				chart.Max = math.Max(chart.Max, *value)
+			}
+		}
+	}
+	if math.IsInf(chart.Min, 0) {
+		chart.Min, chart.Max = 0, 0
+		return chart
+	}
+	if chart.Min > 0 {
+		chart.Min = 0
+	}
+	span := chart.Max - chart.Min
+	if span == 0 {
+		span = 1
+	}
+
+	x := func(i int) float64 {
+		if len(points) == 1 {
+			return reportChartWidth / 2
+		}
+		return reportChartMargin + float64(i)*(reportChartWidth-2*reportChartMargin)/float64(len(points)-1)
+	}
+	y := func(value float64) float64 {
+		return reportChartHeight - reportChartMargin - (value-chart.Min)*(reportChartHeight-2*reportChartMargin)/span
+	}
+
+	// The band and the lines are split at the days they have no value for
+	var lower, upper []string
+	for i := range points {
+		v := values(&points[i])
+		if v[2] != nil && v[3] != nil {
+			lower = append(lower, fmt.Sprintf("%.1f,%.1f", x(i), y(*v[2])))
+			upper = append([]string{fmt.Sprintf("%.1f,%.1f", x(i), y(*v[3]))}, upper...)
+			continue
+		}
+		if len(lower) > 0 {
+			chart.Band = append(chart.Band, strings.Join(append(lower, upper...), " "))
+		}
+		lower, upper = nil, nil
+	}
+	if len(lower) > 0 {
+		chart.Band = append(chart.Band, strings.Join(append(lower, upper...), " "))
+	}
+	line := func(n int) []string {
+		var polylines, current []string
+		for i := range points {
+			if value := values(&points[i])[n]; value != nil {
+				current = append(current, fmt.Sprintf("%.1f,%.1f", x(i), y(*value)))
+				continue
+			}
+			if len(current) > 0 {
+				polylines = append(polylines, strings.Join(current, " "))
+			}
+			current = nil
+		}
+		if len(current) > 0 {
+			polylines = append(polylines, strings.Join(current, " "))
+		}
+		return polylines
+	}
+	chart.Actual, chart.Forecast = line(0), line(1)
+	return chart
+}
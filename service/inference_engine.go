@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// Inference engine names accepted by the INFERENCE_ENGINE setting
+const (
+	InferenceEnginePython = "python"
+	InferenceEngineRemote = "remote"
+	// InferenceEngineStub answers without a model, for load tests
+	InferenceEngineStub = "stub"
+)
+
+// ErrExplainNotSupported is returned by engines that cannot attribute predictions to features
+var ErrExplainNotSupported = errors.New("inference engine does not support explanations")
+
+// PredictionExplanation attributes a prediction to the features of the request with SHAP values.
+// The contributions are keyed by model column and add up, together with the base value the model
+// predicts before seeing any feature, to the prediction
+type PredictionExplanation struct {
+	PriceBaseValue     float64            `json:"price_base_value"`
+	PriceContributions map[string]float64 `json:"price_contributions"`
+	SalesBaseValue     float64            `json:"sales_base_value"`
+	SalesContributions map[string]float64 `json:"sales_contributions"`
+}
+
+// InferenceEngine runs the trained models on fully resolved feature vectors.
+// Feature resolution, auditing and training stay in MLPredictionService, so engines
+// only need to turn requests into predictions.
+type InferenceEngine interface {
+	// Predict runs the models on a single request
+	Predict(ctx context.Context, request *PredictionRequest) (*PredictionResult, error)
+	// PredictBatch runs the models on many requests, returning results in request order
+	PredictBatch(ctx context.Context, requests []*PredictionRequest) ([]PredictionResult, error)
+	// Explain returns per-feature contributions for a request
+	Explain(ctx context.Context, request *PredictionRequest) (*PredictionExplanation, error)
+	// Load makes the engine serve the models currently installed in the model directory
+	Load(ctx context.Context) error
+	// Health reports whether the engine is able to serve predictions
+	Health(ctx context.Context) error
+}
+
+// StagedModelPredictor is implemented by engines that can run a set of model artifacts staged in a
+// directory instead of the installed models, such as an earlier version downloaded from the artifact
+// store
+type StagedModelPredictor interface {
+	PredictWithModels(ctx context.Context, request *PredictionRequest, modelDir string) (*PredictionResult, error)
+	PredictBatchWithModels(ctx context.Context, requests []*PredictionRequest, modelDir string) ([]PredictionResult, error)
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+	"go.uber.org/zap"
+)
+
+// InferencePriority orders the callers competing for prediction processes
+type InferencePriority int
+
+// Inference priorities, highest first
+const (
+	// PriorityInteractive is used by API requests a user is waiting for
+	PriorityInteractive InferencePriority = iota
+	// PriorityQueue is used by work driven by message queue deliveries
+	PriorityQueue
+	// PriorityBatch is used by catalog-wide background jobs
+	PriorityBatch
+
+	inferencePriorityCount
+)
+
+// sloRecoveryWindow is how long interactive waits must stay within the SLO before background work
+// gets back one of the slots it gave up
+const sloRecoveryWindow = time.Minute
+
+// String returns the metric label of the priority
+func (p InferencePriority) String() string {
+	switch p {
+	case PriorityQueue:
+		return "queue"
+	case PriorityBatch:
+		return "batch"
+	default:
+		return "interactive"
+	}
+}
+
+type inferencePriorityKey struct{}
+
+// WithInferencePriority marks the predictions made with ctx as having the given priority
+func WithInferencePriority(ctx context.Context, priority InferencePriority) context.Context {
+	return context.WithValue(ctx, inferencePriorityKey{}, priority)
+}
+
+// inferencePriority returns the priority of ctx; unmarked contexts are interactive
+func inferencePriority(ctx context.Context) InferencePriority {
+	if priority, ok := ctx.Value(inferencePriorityKey{}).(InferencePriority); ok && priority < inferencePriorityCount {
+		return priority
+	}
+	return PriorityInteractive
+}
+
+// inferenceWaiter is a caller queued for a prediction process slot
+type inferenceWaiter struct {
+	priority InferencePriority
+	ready    chan struct{}
+	granted  bool
+}
+
+// InferenceScheduler hands out a fixed number of prediction process slots by priority.
+// Free slots go to the oldest waiter of the highest priority. Queue-driven and batch work may only
+// hold part of the slots, one less than the capacity at first. Whenever an interactive caller waits
+// longer than the SLO for a slot, that share shrinks by one slot, down to a single slot so that
+// background jobs still progress; it grows back by one slot per minute without a breach. With the
+// inference_priority feature flag off, every caller is treated as interactive
+type InferenceScheduler struct {
+	mu         sync.Mutex
+	capacity   int
+	busy       int
+	lowBusy    int
+	lowLimit   int
+	waiters    [inferencePriorityCount][]*inferenceWaiter
+	slo        time.Duration
+	lastChange time.Time
+	now        func() time.Time
+	flags      *FeatureFlags
+
+	queueWait   *metrics.HistogramVec
+	sloBreaches *metrics.CounterVec
+	lowSlots    *metrics.GaugeVec
+	logger      *zap.SugaredLogger
+}
+
+// NewInferenceScheduler creates a scheduler of capacity slots. slo bounds how long interactive
+// callers should wait for a slot, 0 disables the adaptation
+func NewInferenceScheduler(capacity int, slo time.Duration, flags *FeatureFlags, registry *metrics.Registry, logger *zap.SugaredLogger) *InferenceScheduler {
+	capacity = max(capacity, 1)
+	s := &InferenceScheduler{
+		capacity: capacity,
+		lowLimit: max(capacity-1, 1),
+		slo:      slo,
+		now:      time.Now,
+		flags:    flags,
+		queueWait: registry.NewHistogramVec("ml_inference_queue_wait_seconds",
+			"Time predictions waited for a Python process slot", metrics.DefaultBuckets, "priority"),
+		sloBreaches: registry.NewCounterVec("ml_inference_slo_breaches_total",
+			"Interactive predictions that waited longer than the SLO for a process slot"),
+		lowSlots: registry.NewGaugeVec("ml_inference_background_slots",
+			"Process slots queue-driven and batch predictions may hold"),
+		logger: logger,
+	}
+	s.lowSlots.WithLabelValues().Set(float64(s.lowLimit))
+	return s
+}
+
+// Acquire waits for a process slot at the priority of ctx; the returned function releases it
+func (s *InferenceScheduler) Acquire(ctx context.Context) (func(), error) {
+	priority := inferencePriority(ctx)
+	if !s.flags.Enabled(FlagInferencePriority, "") {
+		priority = PriorityInteractive
+	}
+	started := s.now()
+
+	s.mu.Lock()
+	waiter := &inferenceWaiter{priority: priority, ready: make(chan struct{})}
+	s.waiters[priority] = append(s.waiters[priority], waiter)
+	s.dispatch()
+	s.mu.Unlock()
+
+	select {
+	case <-waiter.ready:
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if waiter.granted {
+			s.release(priority)
+		} else {
+			s.remove(waiter)
+		}
+		return nil, ctx.Err()
+	}
+
+	s.observeWait(priority, s.now().Sub(started))
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.release(priority)
+		})
+	}, nil
+}
+
+// dispatch grants free slots to waiters, highest priority first. The lock must be held
+func (s *InferenceScheduler) dispatch() {
+	for priority := range s.waiters {
+		for len(s.waiters[priority]) > 0 && s.canGrant(InferencePriority(priority)) {
+			waiter := s.waiters[priority][0]
+			s.waiters[priority] = s.waiters[priority][1:]
+			s.busy++
+			if waiter.priority != PriorityInteractive {
+				s.lowBusy++
+			}
+			waiter.granted = true
+			close(waiter.ready)
+		}
+		// Lower priorities wait while interactive callers do, even if they could use a background slot
+		if priority == int(PriorityInteractive) && len(s.waiters[priority]) > 0 {
+			return
+		}
+	}
+}
+
+// canGrant reports whether a slot is free for the priority. The lock must be held
+func (s *InferenceScheduler) canGrant(priority InferencePriority) bool {
+	if s.busy >= s.capacity {
+		return false
+	}
+	return priority == PriorityInteractive || s.lowBusy < s.lowLimit
+}
+
+// release frees a slot of the priority and hands it on. The lock must be held
+func (s *InferenceScheduler) release(priority InferencePriority) {
+	s.busy--
+	if priority != PriorityInteractive {
+		s.lowBusy--
+	}
+	if s.slo > 0 && s.lowLimit < max(s.capacity-1, 1) && s.now().Sub(s.lastChange) >= sloRecoveryWindow {
+		s.setLowLimit(s.lowLimit + 1)
+	}
+	s.dispatch()
+}
+
+// remove drops a waiter that gave up from its queue. The lock must be held
+func (s *InferenceScheduler) remove(waiter *inferenceWaiter) {
+	queue := s.waiters[waiter.priority]
+	for i, w := range queue {
+		if w == waiter {
+			s.waiters[waiter.priority] = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	// A waiter blocking lower priorities may have left
+	s.dispatch()
+}
+
+// observeWait records the wait of a granted caller and shrinks the background share on SLO breaches
+func (s *InferenceScheduler) observeWait(priority InferencePriority, wait time.Duration) {
+	s.queueWait.WithLabelValues(priority.String()).Observe(wait.Seconds())
+	if priority != PriorityInteractive || s.slo <= 0 || wait <= s.slo {
+		return
+	}
+
+	s.sloBreaches.WithLabelValues().Inc()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lowLimit > 1 {
+		s.setLowLimit(s.lowLimit - 1)
+		s.logger.Warnw("Interactive prediction waited longer than the SLO, shrinking background slots",
+			"wait", wait, "slo", s.slo, "background_slots", s.lowLimit)
+	} else {
+		s.lastChange = s.now()
+	}
+}
+
+// setLowLimit changes the slots background work may hold. The lock must be held
+func (s *InferenceScheduler) setLowLimit(limit int) {
+	s.lowLimit = limit
+	s.lastChange = s.now()
+	s.lowSlots.WithLabelValues().Set(float64(limit))
+}
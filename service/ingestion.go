@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/rabbitmq"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+// Ingestion paths
+const (
+	IngestionSourceRabbitMQ = "rabbitmq"
+	IngestionSourceOutbox   = "outbox"
+)
+
+// ingestionRestartDelay is how long a source that stopped with an error waits before consuming again
+const ingestionRestartDelay = 5 * time.Second
+
+// IngestionMessage is a message of a producer, whichever path delivered it
+type IngestionMessage struct {
+	// Source is the path that delivered the message
+	Source string
+	// ID identifies the message within its source. Both paths deliver a message again when its
+	// processing was interrupted, so handlers use the source and ID to skip messages they already applied
+	ID string
+	// Topic is the queue or outbox topic the message was sent to, e.g. sales.wb
+	Topic    string
+	Producer string
+	Body     []byte
+	// Redelivered reports that an earlier delivery of the message failed
+	Redelivered bool
+}
+
+// ErrUnknownTopic is returned for messages of a topic no handler is registered for
+var ErrUnknownTopic = errors.New("no handler for ingestion topic")
+
+// IngestionHandler processes a message. An error leaves the message to be delivered again, or
+// dead-lettered once its source gives up on it
+type IngestionHandler func(ctx context.Context, message IngestionMessage) error
+
+// TopicHandlers dispatches messages to the handler registered for their topic
+type TopicHandlers map[string]IngestionHandler
+
+// Handle passes a message to the handler of its topic. A message of an unknown topic fails, so
+// that it is dead-lettered rather than acknowledged and lost
+func (h TopicHandlers) Handle(ctx context.Context, message IngestionMessage) error {
+	handler, ok := h[message.Topic]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTopic, message.Topic)
+	}
+	return handler(ctx, message)
+}
+
+// IngestionSource delivers producer messages to a handler until the context is done or stop is
+// closed. Closing stop lets the message being handled finish under ctx but takes no new ones
+type IngestionSource interface {
+	Name() string
+	Consume(ctx context.Context, stop <-chan struct{}, handler IngestionHandler) error
+}
+
+// RabbitMQIngestion consumes the ingestion queues in weighted turns
+type RabbitMQIngestion struct {
+	client   *rabbitmq.Client
+	weights  *QueueWeights
+	prefetch int
+}
+
+// NewRabbitMQIngestion creates the RabbitMQ ingestion path over the queues listed in the weights
+func NewRabbitMQIngestion(client *rabbitmq.Client, weights *QueueWeights, prefetch int) *RabbitMQIngestion {
+	return &RabbitMQIngestion{
+		client:   client,
+		weights:  weights,
+		prefetch: prefetch,
+	}
+}
+
+// Name returns the name of the path
+func (s *RabbitMQIngestion) Name() string {
+	return IngestionSourceRabbitMQ
+}
+
+// Consume delivers the messages of the ingestion queues to handler. Messages are verified and
+// acknowledged by the RabbitMQ client, and rejected to the dead-letter exchange when handler fails.
+// Closing stop cancels the channel consumers, so the broker sends no more messages, and messages it
+// already sent but that were not handled go back to their queues when the channel closes
+func (s *RabbitMQIngestion) Consume(ctx context.Context, stop <-chan struct{}, handler IngestionHandler) error {
+	consumeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-consumeCtx.Done():
+		}
+	}()
+
+	// The message being handled when stop closes still runs under ctx
+	return s.client.ConsumeWeighted(consumeCtx, s.weights.Queues(), s.prefetch, s.weights.Weight, func(_ context.Context, delivery amqp.Delivery) error {
+		producer, _ := delivery.Headers[rabbitmq.HeaderProducer].(string)
+		return handler(ctx, IngestionMessage{
+			Source:      IngestionSourceRabbitMQ,
+			ID:          delivery.MessageId,
+			Topic:       delivery.RoutingKey,
+			Producer:    producer,
+			Body:        delivery.Body,
+			Redelivered: delivery.Redelivered,
+		})
+	})
+}
+
+// OutboxStore is the ingestion outbox table OutboxIngestion polls. PostgresRepository implements it
+type OutboxStore interface {
+	ProcessOutboxMessages(ctx context.Context, limit, maxAttempts int, handle func(ctx context.Context, message repository.OutboxMessage) error) (int, error)
+}
+
+// OutboxIngestion polls the ingestion outbox table, for producers that cannot publish reliably to
+// RabbitMQ and write their messages in their own database transaction instead
+type OutboxIngestion struct {
+	postgresRepo OutboxStore
+	interval     time.Duration
+	batchSize    int
+	maxAttempts  int
+	logger       *zap.SugaredLogger
+}
+
+// NewOutboxIngestion creates the outbox ingestion path, polling every interval for up to batchSize
+// messages and giving up on a message after maxAttempts failures
+func NewOutboxIngestion(postgresRepo OutboxStore, interval time.Duration, batchSize, maxAttempts int, logger *zap.SugaredLogger) *OutboxIngestion {
+	return &OutboxIngestion{
+		postgresRepo: postgresRepo,
+		interval:     interval,
+		batchSize:    batchSize,
+		maxAttempts:  maxAttempts,
+		logger:       logger,
+	}
+}
+
+// Name returns the name of the path
+func (s *OutboxIngestion) Name() string {
+	return IngestionSourceOutbox
+}
+
+// Consume delivers the pending outbox messages to handler. A message is marked processed in the
+// transaction that locked it, so once handler succeeds it is not delivered again; a crash before the
+// commit delivers it again. A full batch is followed by the next one without waiting for the interval.
+// Closing stop ends the polling after the batch being processed
+func (s *OutboxIngestion) Consume(ctx context.Context, stop <-chan struct{}, handler IngestionHandler) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		processed, err := s.postgresRepo.ProcessOutboxMessages(ctx, s.batchSize, s.maxAttempts, func(ctx context.Context, message repository.OutboxMessage) error {
+			err := handler(ctx, IngestionMessage{
+				Source:      IngestionSourceOutbox,
+				ID:          strconv.FormatInt(message.ID, 10),
+				Topic:       message.Topic,
+				Producer:    message.Producer,
+				Body:        message.Payload,
+				Redelivered: message.Attempts > 0,
+			})
+			if err != nil {
+				s.logger.Errorw("Failed to process outbox message", "error", err, "id", message.ID,
+					"topic", message.Topic, "attempt", message.Attempts+1, "max_attempts", s.maxAttempts)
+			}
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.logger.Errorw("Failed to poll the ingestion outbox", "error", err)
+		} else if processed == s.batchSize {
+			select {
+			case <-stop:
+				return nil
+			default:
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ingestion feeds the messages of every configured ingestion path to a single handler, so that
+// producers can use whichever path suits them. Lame-duck mode stops taking messages, so that they
+// go to the replicas that keep serving rather than being handled during the drain
+type Ingestion struct {
+	sources   []IngestionSource
+	lifecycle *Lifecycle
+	logger    *zap.SugaredLogger
+}
+
+// NewIngestion creates the ingestion over the given paths
+func NewIngestion(sources []IngestionSource, lifecycle *Lifecycle, logger *zap.SugaredLogger) *Ingestion {
+	return &Ingestion{
+		sources:   sources,
+		lifecycle: lifecycle,
+		logger:    logger,
+	}
+}
+
+// Sources returns the names of the configured paths
+func (i *Ingestion) Sources() []string {
+	names := make([]string, len(i.sources))
+	for n, source := range i.sources {
+		names[n] = source.Name()
+	}
+	return names
+}
+
+// Run consumes every path with handler until the context is cancelled or lame-duck mode starts. A
+// path that stops with an error, such as a closed broker connection, is consumed again after a pause
+func (i *Ingestion) Run(ctx context.Context, handler IngestionHandler) {
+	stop := i.lifecycle.LameDuck()
+	var wg sync.WaitGroup
+	for _, source := range i.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				err := source.Consume(ctx, stop, handler)
+				if ctx.Err() != nil {
+					return
+				}
+				select {
+				case <-stop:
+					i.logger.Infow("Ingestion path stopped for lame-duck mode", "source", source.Name())
+					return
+				default:
+				}
+				if err != nil && !errors.Is(err, context.Canceled) {
+					i.logger.Errorw("Ingestion path stopped, restarting", "error", err, "source", source.Name(),
+						"delay", ingestionRestartDelay)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-stop:
+					return
+				case <-time.After(ingestionRestartDelay):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// Feature vectors are encoded once per prediction, for the Python engine and for the prediction
+// log, so catalog jobs encode thousands of them per run. The buffers are pooled and pre-sized to
+// keep those encodings from growing and discarding a buffer each time
+const (
+	// featureVectorJSONSize is slightly above the encoded size of a feature vector with typical names
+	featureVectorJSONSize = 1024
+	// maxPooledBufferSize keeps buffers grown by unusually large values out of the pool
+	maxPooledBufferSize = 64 << 10
+)
+
+var jsonBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// getJSONBuffer returns an empty buffer with room for the given number of feature vectors.
+// It must be returned with putJSONBuffer once its contents are no longer used
+func getJSONBuffer(vectors int) *bytes.Buffer {
+	buf := jsonBuffers.Get().(*bytes.Buffer)
+	buf.Grow(vectors * featureVectorJSONSize)
+	return buf
+}
+
+// putJSONBuffer returns a buffer to the pool
+func putJSONBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	jsonBuffers.Put(buf)
+}
+
+// encodeJSON appends the encoding json.Marshal would produce for v to buf
+func encodeJSON(buf *bytes.Buffer, v any) error {
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	// Encode terminates the value with a newline that Marshal does not add
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
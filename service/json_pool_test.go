@@ -0,0 +1,29 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEncodeJSONMatchesMarshal(t *testing.T) {
+	want, err := json.Marshal(&benchFeatureVector)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A reused buffer must not carry over the previous encoding
+	for range 2 {
+		buf := getJSONBuffer(1)
+		if err := encodeJSON(buf, &benchFeatureVector); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != string(want) {
+			t.Errorf("encodeJSON() = %s, want %s", buf, want)
+		}
+		putJSONBuffer(buf)
+	}
+
+	if len(want) > featureVectorJSONSize {
+		t.Errorf("a feature vector encodes to %d bytes, above featureVectorJSONSize %d", len(want), featureVectorJSONSize)
+	}
+}
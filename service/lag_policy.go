@@ -0,0 +1,30 @@
+package service
+
+import "github.com/graduate-work-mirea/data-processor-service/internal/features"
+
+// LagPolicy decides how new models count the days of their lag features and fill the days missing
+// from the history. It only applies to training: the script stamps both into feature_info.json and
+// predictions follow the installed models, so a change takes effect with the next trained model
+type LagPolicy struct {
+	Mode          features.LagMode
+	Interpolation features.Interpolation
+	// Holidays are skipped along with weekends in business mode; HolidaysFile is the calendar file
+	// they were loaded from, passed on to the training script
+	Holidays     features.Holidays
+	HolidaysFile string
+}
+
+// scriptArgs returns the training script arguments selecting the lag mode and interpolation
+func (p LagPolicy) scriptArgs() []string {
+	var args []string
+	if p.Mode == features.LagModeBusiness {
+		args = append(args, "--lag-mode", string(features.LagModeBusiness))
+		if p.HolidaysFile != "" {
+			args = append(args, "--holidays", p.HolidaysFile)
+		}
+	}
+	if p.Interpolation != "" && p.Interpolation != features.InterpolationNone {
+		args = append(args, "--interpolation", string(p.Interpolation))
+	}
+	return args
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// LaunchForecastMode labels forecasts built from analogs instead of the product's own history
+const LaunchForecastMode = "cold_start"
+
+const (
+	defaultLaunchHorizonDays = 28
+	maxLaunchHorizonDays     = 90
+	// Brand analogs are preferred over the whole category once there are at least this many
+	minBrandLaunchAnalogs = 3
+	// Analog sales are scaled by (analog price / planned price) to this power, within the bounds
+	launchPriceElasticity = 1.0
+	minLaunchPriceScale   = 0.25
+	maxLaunchPriceScale   = 4.0
+)
+
+var (
+	// ErrInvalidLaunchRequest is returned when a launch forecast request fails validation
+	ErrInvalidLaunchRequest = errors.New("invalid launch forecast request")
+	// ErrProductHasHistory is returned for a launch forecast of a product that already has history
+	ErrProductHasHistory = errors.New("product has history")
+	// ErrNoLaunchAnalogs is returned when no product of the category has an observed launch
+	ErrNoLaunchAnalogs = errors.New("no launch analogs")
+)
+
+// LaunchForecastRequest describes a product about to launch
+type LaunchForecastRequest struct {
+	// ProductName is optional; a product that already has history is rejected
+	ProductName  string  `json:"product_name"`
+	Category     string  `json:"category" binding:"required"`
+	Brand        string  `json:"brand"`
+	PlannedPrice float64 `json:"planned_price" binding:"required"`
+	// LaunchDate is a date in YYYY-MM-DD format
+	LaunchDate  string `json:"launch_date" binding:"required"`
+	HorizonDays int    `json:"horizon_days"`
+}
+
+// LaunchForecastDay is the forecast of a day of the launch period
+type LaunchForecastDay struct {
+	Date time.Time `json:"date"`
+	// Day counts from 0 on the launch date
+	Day            int     `json:"day"`
+	PredictedSales float64 `json:"predicted_sales"`
+	// SalesP10 and SalesP90 are the spread of the price-adjusted analogs on that day
+	SalesP10 float64 `json:"sales_p10"`
+	SalesP90 float64 `json:"sales_p90"`
+	Analogs  int     `json:"analogs"`
+}
+
+// LaunchForecast is the launch curve of a product without history, averaged from analogs
+type LaunchForecast struct {
+	// Mode is always LaunchForecastMode
+	Mode         string    `json:"mode"`
+	ProductName  string    `json:"product_name,omitempty"`
+	Category     string    `json:"category"`
+	Brand        string    `json:"brand,omitempty"`
+	PlannedPrice float64   `json:"planned_price"`
+	LaunchDate   time.Time `json:"launch_date"`
+	HorizonDays  int       `json:"horizon_days"`
+	// AnalogScope is "brand" when the analogs share the brand and "category" otherwise
+	AnalogScope         string              `json:"analog_scope"`
+	Analogs             []string            `json:"analogs"`
+	TotalPredictedSales float64             `json:"total_predicted_sales"`
+	Days                []LaunchForecastDay `json:"days"`
+	Warnings            []string            `json:"warnings"`
+}
+
+// launchAnalog is the launch period of an analog product
+type launchAnalog struct {
+	brand      string
+	sales      map[int]float64
+	priceSum   float64
+	priceCount int
+}
+
+// Launch forecasts the daily sales of a product without history from the launch periods of other
+// products of its category, preferring those of its brand. Each analog's sales are scaled by the
+// ratio of its average launch price to the planned price, and the forecast of a day is the mean of
+// the analogs observed on that day after their own launch
+func (s *ForecastService) Launch(request *LaunchForecastRequest) (*LaunchForecast, error) {
+	if request.PlannedPrice <= 0 {
+		return nil, fmt.Errorf("%w: planned_price must be positive", ErrInvalidLaunchRequest)
+	}
+	launchDate, err := time.Parse("2006-01-02", request.LaunchDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: launch_date must be a date in YYYY-MM-DD format", ErrInvalidLaunchRequest)
+	}
+	horizonDays := request.HorizonDays
+	if horizonDays == 0 {
+		horizonDays = defaultLaunchHorizonDays
+	}
+	if horizonDays < 1 || horizonDays > maxLaunchHorizonDays {
+		return nil, fmt.Errorf("%w: horizon_days must be between 1 and %d", ErrInvalidLaunchRequest, maxLaunchHorizonDays)
+	}
+
+	if request.ProductName != "" {
+		hasHistory, err := s.postgresRepo.HasProductHistory(request.ProductName)
+		if err != nil {
+			return nil, err
+		}
+		if hasHistory {
+			return nil, fmt.Errorf("%w: %s already has processed data, use the prediction endpoints", ErrProductHasHistory, request.ProductName)
+		}
+	}
+
+	rows, err := s.postgresRepo.LaunchAnalogDays(request.Category, horizonDays)
+	if err != nil {
+		return nil, err
+	}
+	analogs := groupLaunchAnalogs(rows)
+	if len(analogs) == 0 {
+		return nil, fmt.Errorf("%w: no product of category %s has an observed launch", ErrNoLaunchAnalogs, request.Category)
+	}
+
+	forecast := &LaunchForecast{
+		Mode:         LaunchForecastMode,
+		ProductName:  request.ProductName,
+		Category:     request.Category,
+		Brand:        request.Brand,
+		PlannedPrice: request.PlannedPrice,
+		LaunchDate:   launchDate,
+		HorizonDays:  horizonDays,
+		AnalogScope:  "category",
+		Days:         make([]LaunchForecastDay, 0, horizonDays),
+		Warnings: []string{
+			"Cold-start forecast: the product has no history, the curve is averaged from the launches of other products of its category",
+		},
+	}
+
+	if request.Brand != "" {
+		brandAnalogs := make(map[string]*launchAnalog)
+		for name, analog := range analogs {
+			if analog.brand == request.Brand {
+				brandAnalogs[name] = analog
+			}
+		}
+		if len(brandAnalogs) >= minBrandLaunchAnalogs {
+			analogs = brandAnalogs
+			forecast.AnalogScope = "brand"
+		}
+	}
+
+	scales := make(map[string]float64, len(analogs))
+	for name, analog := range analogs {
+		forecast.Analogs = append(forecast.Analogs, name)
+		scales[name] = launchPriceScale(analog, request.PlannedPrice)
+	}
+	sort.Strings(forecast.Analogs)
+
+	covered := 0
+	for day := 0; day < horizonDays; day++ {
+		var values []float64
+		for _, name := range forecast.Analogs {
+			if sales, ok := analogs[name].sales[day]; ok {
+				values = append(values, sales*scales[name])
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		covered++
+		sort.Float64s(values)
+
+		mean := 0.0
+		for _, v := range values {
+			mean += v
+		}
+		mean /= float64(len(values))
+
+		forecast.Days = append(forecast.Days, LaunchForecastDay{
+			Date:           launchDate.AddDate(0, 0, day),
+			Day:            day,
+			PredictedSales: mean,
+			SalesP10:       sortedQuantile(values, 0.1),
+			SalesP90:       sortedQuantile(values, 0.9),
+			Analogs:        len(values),
+		})
+		forecast.TotalPredictedSales += mean
+	}
+
+	if len(analogs) < minBrandLaunchAnalogs {
+		forecast.Warnings = append(forecast.Warnings,
+			fmt.Sprintf("Only %d analog product(s), the forecast is highly uncertain", len(analogs)))
+	}
+	if covered < horizonDays {
+		forecast.Warnings = append(forecast.Warnings,
+			fmt.Sprintf("Analogs cover %d of %d days of the launch period, the other days are omitted", covered, horizonDays))
+	}
+	return forecast, nil
+}
+
+// groupLaunchAnalogs groups the launch days of analogs by product
+func groupLaunchAnalogs(rows []repository.LaunchAnalogDay) map[string]*launchAnalog {
+	analogs := make(map[string]*launchAnalog)
+	for _, row := range rows {
+		analog, ok := analogs[row.ProductName]
+		if !ok {
+			analog = &launchAnalog{brand: row.Brand, sales: make(map[int]float64)}
+			analogs[row.ProductName] = analog
+		}
+		analog.sales[row.Day] = row.Sales
+		analog.priceSum += row.Price
+		analog.priceCount++
+	}
+	return analogs
+}
+
+// launchPriceScale adjusts an analog's sales to the planned price: a cheaper launch sells more
+func launchPriceScale(analog *launchAnalog, plannedPrice float64) float64 {
+	if analog.priceCount == 0 || analog.priceSum <= 0 {
+		return 1
+	}
+	averagePrice := analog.priceSum / float64(analog.priceCount)
+	scale := math.Pow(averagePrice/plannedPrice, launchPriceElasticity)
+	return math.Min(math.Max(scale, minLaunchPriceScale), maxLaunchPriceScale)
+}
+
+// sortedQuantile returns the q-quantile of sorted values, interpolating between neighbours
+func sortedQuantile(sorted []float64, q float64) float64 {
+	position := q * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLameDuck is returned when new background work is refused because the replica is draining
+var ErrLameDuck = errors.New("service is in lame-duck mode and does not accept new jobs")
+
+// LifecycleState describes whether the replica is draining and how much work it still runs
+type LifecycleState struct {
+	LameDuck      bool       `json:"lame_duck"`
+	LameDuckSince *time.Time `json:"lame_duck_since,omitempty"`
+	InFlightJobs  int        `json:"in_flight_jobs"`
+}
+
+// Lifecycle tracks background jobs and lame-duck mode. In lame-duck mode the replica reports
+// itself not ready and refuses new background jobs, while jobs already running are allowed
+// to finish, so that it can be restarted without losing work. Jobs still running when the
+// shutdown grace period ends are cancelled through the context of the lifecycle.
+type Lifecycle struct {
+	mu            sync.Mutex
+	lameDuckSince time.Time
+	inFlight      int
+	idle          chan struct{}
+	// lameDuck is closed when lame-duck mode starts
+	lameDuck chan struct{}
+
+	ctx       context.Context
+	terminate context.CancelFunc
+}
+
+// NewLifecycle creates a lifecycle in serving mode
+func NewLifecycle() *Lifecycle {
+	idle := make(chan struct{})
+	close(idle)
+	ctx, terminate := context.WithCancel(context.Background())
+	return &Lifecycle{idle: idle, lameDuck: make(chan struct{}), ctx: ctx, terminate: terminate}
+}
+
+// Context is the context background jobs and requests run under. It is cancelled by Terminate,
+// which stops the Python processes they started
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// Terminate cancels the work still running at the end of the shutdown grace period
+func (l *Lifecycle) Terminate() {
+	l.terminate()
+}
+
+// DrainDeadline returns when the work of a replica in lame-duck mode has to be done by, timeout
+// after lame-duck mode started, so that a preStop hook and the shutdown that follows it share
+// the timeout. It is timeout from now outside lame-duck mode
+func (l *Lifecycle) DrainDeadline(timeout time.Duration) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lameDuckSince.IsZero() {
+		return time.Now().Add(timeout)
+	}
+	return l.lameDuckSince.Add(timeout)
+}
+
+// EnterLameDuck switches to lame-duck mode; calling it again keeps the original start time
+func (l *Lifecycle) EnterLameDuck() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.lameDuckSince.IsZero() {
+		l.lameDuckSince = time.Now()
+		close(l.lameDuck)
+	}
+}
+
+// LameDuck returns a channel that is closed when lame-duck mode starts, for consumers that stop
+// taking new work while the work they already took drains
+func (l *Lifecycle) LameDuck() <-chan struct{} {
+	return l.lameDuck
+}
+
+// State returns the current lifecycle state
+func (l *Lifecycle) State() LifecycleState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := LifecycleState{
+		LameDuck:     !l.lameDuckSince.IsZero(),
+		InFlightJobs: l.inFlight,
+	}
+	if state.LameDuck {
+		since := l.lameDuckSince
+		state.LameDuckSince = &since
+	}
+	return state
+}
+
+// BeginJob registers a background job and returns the function to call when it finishes.
+// It fails with ErrLameDuck once lame-duck mode has started.
+func (l *Lifecycle) BeginJob() (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.lameDuckSince.IsZero() {
+		return nil, ErrLameDuck
+	}
+	if l.inFlight == 0 {
+		l.idle = make(chan struct{})
+	}
+	l.inFlight++
+
+	var once sync.Once
+	return func() { once.Do(l.endJob) }, nil
+}
+
+// endJob unregisters a finished background job
+func (l *Lifecycle) endJob() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	if l.inFlight == 0 {
+		close(l.idle)
+	}
+}
+
+// Wait blocks until no background job is running or the context is done
+func (l *Lifecycle) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	idle := l.idle
+	l.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,12 +1,15 @@
 package service
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"path/filepath"
-	"regexp"
+	"strings"
 	"time"
 
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
 	"github.com/graduate-work-mirea/data-processor-service/repository"
 	"go.uber.org/zap"
 )
@@ -14,55 +17,109 @@ import (
 // MLPredictionService provides functionality for training ML models and making predictions
 type MLPredictionService struct {
 	fileRepo      *repository.FileRepository
-	postgresRepo  *repository.PostgresRepository
+	runner        ScriptRunner
+	postgresRepo  PredictionStore
+	artifactStore repository.ArtifactStore
+	engine        InferenceEngine
+	modelCheck    *ModelCheck
+	staleness     StalenessPolicy
+	horizon       PredictionHorizon
+	providers     *FeatureProviders
+	lags          LagPolicy
+	window        TrainingWindow
+	quota         TrainingQuota
+	overfitting   OverfittingPolicy
+	encoding      CategoryEncoding
+	encoders      *installedEncoders
+	fallback      FallbackChain
+	// targets are the targets newly trained models predict, features.CoreTargets first
+	targets       []string
 	scriptPath    string
 	trainDataPath string
 	testDataPath  string
-	logger        *zap.SugaredLogger
+	// Maximum bytes of Python output stored per training run
+	trainingLogMaxBytes int
+	processMetrics      *ProcessMetrics
+	events              *EventLog
+	standby             *StandbyModel
+	golden              *GoldenSet
+	disk                *DiskMonitor
+	logger              *zap.SugaredLogger
+}
+
+// MLPredictionDeps are the components and policies MLPredictionService is built from.
+// ArtifactStore may be nil when models are not shared between replicas, and Providers when no
+// external features are configured. New models go to the Standby slot when it is enabled, and are
+// installed directly otherwise. Golden is nil when golden set verification is disabled, and Disk when
+// training runs start without a disk space check.
+type MLPredictionDeps struct {
+	FileRepo       *repository.FileRepository
+	Store          PredictionStore
+	ArtifactStore  repository.ArtifactStore
+	Engine         InferenceEngine
+	ModelCheck     *ModelCheck
+	Providers      *FeatureProviders
+	ProcessMetrics *ProcessMetrics
+	Events         *EventLog
+	Standby        *StandbyModel
+	Golden         *GoldenSet
+	Disk           *DiskMonitor
+
+	Staleness   StalenessPolicy
+	Horizon     PredictionHorizon
+	Lags        LagPolicy
+	Window      TrainingWindow
+	Quota       TrainingQuota
+	Overfitting OverfittingPolicy
+	Encoding    CategoryEncoding
+	// Fallback is the chain of segment models tried before the global ones; an empty chain only
+	// runs the global models
+	Fallback FallbackChain
+	// Targets are the targets newly trained models predict
+	Targets []string
+	// TrainingLogMaxBytes is the maximum of Python output stored per training run
+	TrainingLogMaxBytes int
 }
 
 // NewMLPredictionService creates a new ML prediction service
-func NewMLPredictionService(fileRepo *repository.FileRepository, postgresRepo *repository.PostgresRepository, logger *zap.SugaredLogger) *MLPredictionService {
+func NewMLPredictionService(deps MLPredictionDeps, logger *zap.SugaredLogger) *MLPredictionService {
 	return &MLPredictionService{
-		fileRepo:      fileRepo,
-		postgresRepo:  postgresRepo,
-		scriptPath:    "scripts/lightGBM_model.py",
+		fileRepo:      deps.FileRepo,
+		runner:        deps.FileRepo,
+		postgresRepo:  deps.Store,
+		artifactStore: deps.ArtifactStore,
+		engine:        deps.Engine,
+		modelCheck:    deps.ModelCheck,
+		staleness:     deps.Staleness,
+		horizon:       deps.Horizon,
+		providers:     deps.Providers,
+		lags:          deps.Lags,
+		window:        deps.Window,
+		quota:         deps.Quota,
+		overfitting:   deps.Overfitting,
+		encoding:      deps.Encoding,
+		encoders:      &installedEncoders{fileRepo: deps.FileRepo, policy: deps.Encoding.PredictUnseenPolicy},
+		fallback:      deps.Fallback,
+		targets:       deps.Targets,
+		scriptPath:    pythonScriptPath,
 		trainDataPath: "train_data.csv",
 		testDataPath:  "test_data.csv",
-		logger:        logger,
+
+		trainingLogMaxBytes: deps.TrainingLogMaxBytes,
+		processMetrics:      deps.ProcessMetrics,
+		events:              deps.Events,
+		standby:             deps.Standby,
+		golden:              deps.Golden,
+		disk:                deps.Disk,
+		logger:              logger,
 	}
 }
 
+// modelArtifacts lists the files produced by a training run that make up a model version
+var modelArtifacts = []string{"price_model.pkl", "sales_model.pkl", featureInfoFile}
+
 // PredictionRequest represents the input data for making a prediction
-type PredictionRequest struct {
-	ProductName               string  `json:"product_name"`
-	Brand                     string  `json:"brand"`
-	Category                  string  `json:"category"`
-	Region                    string  `json:"region"`
-	Seller                    string  `json:"seller"`
-	Price                     float64 `json:"price"`
-	OriginalPrice             float64 `json:"original_price"`
-	DiscountPercentage        float64 `json:"discount_percentage"`
-	StockLevel                float64 `json:"stock_level"`
-	CustomerRating            float64 `json:"customer_rating"`
-	ReviewCount               float64 `json:"review_count"`
-	DeliveryDays              float64 `json:"delivery_days"`
-	IsWeekend                 bool    `json:"is_weekend"`
-	IsHoliday                 bool    `json:"is_holiday"`
-	DayOfWeek                 int     `json:"day_of_week"`
-	Month                     int     `json:"month"`
-	Quarter                   int     `json:"quarter"`
-	SalesQuantityLag1         float64 `json:"sales_quantity_lag_1"`
-	PriceLag1                 float64 `json:"price_lag_1"`
-	SalesQuantityLag3         float64 `json:"sales_quantity_lag_3"`
-	PriceLag3                 float64 `json:"price_lag_3"`
-	SalesQuantityLag7         float64 `json:"sales_quantity_lag_7"`
-	PriceLag7                 float64 `json:"price_lag_7"`
-	SalesQuantityRollingMean3 float64 `json:"sales_quantity_rolling_mean_3"`
-	PriceRollingMean3         float64 `json:"price_rolling_mean_3"`
-	SalesQuantityRollingMean7 float64 `json:"sales_quantity_rolling_mean_7"`
-	PriceRollingMean7         float64 `json:"price_rolling_mean_7"`
-}
+type PredictionRequest = features.Vector
 
 // PredictionRequestMinimal represents the minimal input data for making a prediction
 type PredictionRequestMinimal struct {
@@ -77,73 +134,237 @@ type PredictionRequestMinimal struct {
 	CustomerRating *float64 `json:"customer_rating,omitempty"`
 	ReviewCount    *float64 `json:"review_count,omitempty"`
 	DeliveryDays   *float64 `json:"delivery_days,omitempty"`
+	// Baseline adds the naive baselines to the result; it is set from the baseline query parameter
+	Baseline bool `json:"-"`
+	// Debug adds the provenance of the features to the result; it is set from the debug query
+	// parameter
+	Debug bool `json:"-"`
 }
 
 // PredictionResult represents the result of a prediction
 type PredictionResult struct {
+	// PredictionID identifies the prediction in the prediction log, 0 when it was not recorded
+	PredictionID   int64   `json:"prediction_id,omitempty"`
 	PredictedPrice float64 `json:"predicted_price"`
 	PredictedSales float64 `json:"predicted_sales"`
+	// Overrides lists the features supplied by the caller instead of resolved from history,
+	// a non-empty list marks the prediction as a "what-if" scenario
+	Overrides []string `json:"overrides,omitempty"`
+	// HistoryDate is the date of the latest history row the features were built from
+	HistoryDate *time.Time `json:"history_date,omitempty"`
+	// Warnings describe data quality issues, such as stale history
+	Warnings []string `json:"warnings,omitempty"`
+	// FeaturesPresent tells, per historical feature, whether it was stored in the database (true)
+	// or missing and filled in with a derived or default value (false)
+	FeaturesPresent map[string]bool `json:"features_present,omitempty"`
+	// Strategy is the prediction strategy of the fallback chain that answered
+	Strategy string `json:"strategy,omitempty"`
+	// DataQuality tells how days missing from the history were filled, when the models fill them,
+	// and how category values unseen in training were encoded
+	DataQuality *DataQuality `json:"data_quality,omitempty"`
+	// Baselines are the predictions of the naive baselines by name, when requested
+	Baselines map[string]BaselinePrediction `json:"baselines,omitempty"`
+	// Targets are the predictions of the targets beyond price and sales, by name
+	Targets map[string]float64 `json:"targets,omitempty"`
+	// Provenance tells, per feature resolved from history, where its value came from and the
+	// history day it reflects; only in debug mode
+	Provenance map[string]FeatureProvenance `json:"provenance,omitempty"`
+	// Explanation holds the SHAP contributions of the features, when requested
+	Explanation *PredictionExplanation `json:"explanation,omitempty"`
+}
+
+// FeatureProvenance is where the value of a feature came from
+type FeatureProvenance = features.Provenance
+
+// DataQuality describes how the features of a prediction were completed
+type DataQuality struct {
+	// Interpolation is the method the installed models fill missing days with
+	Interpolation features.Interpolation `json:"interpolation,omitempty"`
+	// Interpolated lists the lags and rolling means computed from interpolated days
+	Interpolated []string `json:"interpolated,omitempty"`
+	// UnseenPolicy is the policy the category values unseen in training were encoded with, and
+	// UnseenCategories lists those values
+	UnseenPolicy     features.UnseenPolicy     `json:"unseen_policy,omitempty"`
+	UnseenCategories []features.UnseenCategory `json:"unseen_categories,omitempty"`
+}
+
+// ModelMetrics represents the validation metrics of a single trained model
+type ModelMetrics struct {
+	BestIteration int     `json:"best_iteration"`
+	BestScore     float64 `json:"best_score"`
+	MAE           float64 `json:"mae"`
+	// BaselineMAE is the validation MAE of the naive baselines, the reference the model's MAE is
+	// judged against; nil for versions trained before baselines were measured
+	BaselineMAE *BaselineMAE `json:"baseline_mae,omitempty"`
+	// TrainScore is the training RMSE at the best iteration, absent for runs before it was reported
+	TrainScore float64 `json:"train_score,omitempty"`
+	// ScoreGapPercent is how much higher BestScore, the validation RMSE, is than TrainScore, in
+	// percent of TrainScore
+	ScoreGapPercent *float64 `json:"score_gap_percent,omitempty"`
+}
+
+// ModelVersionMetrics represents the metrics of a registered model version
+type ModelVersionMetrics struct {
+	Version   string    `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	IsActive  bool      `json:"is_active"`
+	// IsStandby marks the version being shadow-tested in the standby slot
+	IsStandby  bool         `json:"is_standby,omitempty"`
+	PriceModel ModelMetrics `json:"price_model"`
+	SalesModel ModelMetrics `json:"sales_model"`
+	// PromotionBlocked says why the version was not made active when it was trained
+	PromotionBlocked []string `json:"promotion_blocked,omitempty"`
+	// DatasetHash and DatasetRows describe the data the version was trained on; only the version
+	// list reports them
+	DatasetHash string `json:"dataset_hash,omitempty"`
+	DatasetRows int64  `json:"dataset_rows,omitempty"`
+}
+
+// Training run statuses
+const (
+	TrainingStatusSucceeded = "succeeded"
+	TrainingStatusFailed    = "failed"
+)
+
+// TrainingRun represents a recorded training run
+type TrainingRun struct {
+	ID           int64           `json:"id"`
+	StartedAt    time.Time       `json:"started_at"`
+	FinishedAt   time.Time       `json:"finished_at"`
+	DurationMs   int64           `json:"duration_ms"`
+	Status       string          `json:"status"`
+	Version      string          `json:"version,omitempty"`
+	Metrics      json.RawMessage `json:"metrics,omitempty"`
+	DatasetHash  string          `json:"dataset_hash,omitempty"`
+	DatasetRows  int64           `json:"dataset_rows,omitempty"`
+	Parameters   json.RawMessage `json:"parameters,omitempty"`
+	PythonOutput string          `json:"python_output,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	// ResourceUsage of the training subprocess, absent if it never started
+	ResourceUsage *ResourceUsage `json:"resource_usage,omitempty"`
 }
 
 // TrainingResult represents the result of model training
 type TrainingResult struct {
-	PriceModel struct {
-		BestIteration int     `json:"best_iteration"`
-		BestScore     float64 `json:"best_score"`
-	} `json:"price_model"`
-	SalesModel struct {
-		BestIteration int     `json:"best_iteration"`
-		BestScore     float64 `json:"best_score"`
-	} `json:"sales_model"`
-	PythonOutput string `json:"-"`
-}
-
-// extractJSON extracts JSON from a string output
+	PriceModel ModelMetrics `json:"price_model"`
+	SalesModel ModelMetrics `json:"sales_model"`
+	Version    string       `json:"version"`
+	// Targets are the metrics of the models of the targets beyond price and sales, by name
+	Targets map[string]ModelMetrics `json:"targets,omitempty"`
+	// TrainingWindow is the window of training rows the models learned from
+	TrainingWindow *TrainingWindowInfo `json:"training_window,omitempty"`
+	// Suspect marks a run whose models score much worse on the validation data than on the training
+	// data; SuspectReasons say which
+	Suspect        bool     `json:"suspect"`
+	SuspectReasons []string `json:"suspect_reasons,omitempty"`
+	// Sample is the part of the training rows a fast-train run learned from
+	Sample *TrainingSampleInfo `json:"sample,omitempty"`
+	// Downsampled tells how the training rows were reduced to stay within the training quota
+	Downsampled *TrainingDownsampleInfo `json:"downsampled,omitempty"`
+	// Promoted tells whether the models were installed as the active version. Suspect and sampled
+	// runs are registered inactive, with the reasons in PromotionBlocked
+	Promoted bool `json:"promoted"`
+	// Standby tells whether the models were loaded into the standby slot to be shadow-tested
+	Standby          bool     `json:"standby,omitempty"`
+	PromotionBlocked []string `json:"promotion_blocked,omitempty"`
+	PythonOutput     string   `json:"-"`
+	// ResourceUsage of the training subprocess
+	ResourceUsage *ResourceUsage `json:"resource_usage,omitempty"`
+}
+
+// TrainingOutputError is returned when the training script exits successfully without printing its
+// metrics, e.g. because it stopped on bad data after logging why. Output holds what it printed
+type TrainingOutputError struct {
+	Output string
+}
+
+func (e *TrainingOutputError) Error() string {
+	return "training script printed no metrics\n\nOutput: " + e.Output
+}
+
+// extractJSON returns the last JSON object in a script's output
 func extractJSON(output string) (string, error) {
-	// Find a well-formed JSON object in the output
-	// First try to extract using a stricter approach
-	reStrict := regexp.MustCompile(`(?s)\{(?:[^{}]|(?:\{[^{}]*\}))*\}`)
-	matches := reStrict.FindAllString(output, -1)
-
-	// Try each match, starting from the last one (usually contains the result)
-	if len(matches) > 0 {
-		for i := len(matches) - 1; i >= 0; i-- {
-			candidate := matches[i]
-			// Verify that it's valid JSON
-			var js json.RawMessage
-			if err := json.Unmarshal([]byte(candidate), &js); err == nil {
-				// Found valid JSON
-				return candidate, nil
-			}
+	objects := jsonObjects(output)
+	if len(objects) == 0 {
+		return "", fmt.Errorf("no valid JSON found in output: %s", output)
+	}
+	return objects[len(objects)-1], nil
+}
+
+// jsonObjects returns the JSON objects in a script's output in order. Scripts print log lines,
+// warnings and NDJSON progress records around their result; braces in log text that do not start
+// a valid object are skipped
+func jsonObjects(output string) []string {
+	var objects []string
+	for i := strings.IndexByte(output, '{'); i >= 0; {
+		decoder := json.NewDecoder(strings.NewReader(output[i:]))
+		var object json.RawMessage
+		next := i + 1
+		if err := decoder.Decode(&object); err == nil {
+			objects = append(objects, string(object))
+			next = i + int(decoder.InputOffset())
 		}
+
+		j := strings.IndexByte(output[next:], '{')
+		if j < 0 {
+			break
+		}
+		i = next + j
 	}
+	return objects
+}
 
-	// Fallback to simpler regex
-	re := regexp.MustCompile(`(?s)\{.*\}`)
-	match := re.FindString(output)
-	if match != "" {
-		// Try to validate it
-		var js json.RawMessage
-		if err := json.Unmarshal([]byte(match), &js); err == nil {
-			return match, nil
+// parseTrainingOutput parses the metrics the training script prints after its progress records.
+// Objects without both models' metrics, such as braces in later log lines or a fragment of a
+// truncated result, are skipped; a progress record after the last metrics means the script
+// stopped before it finished
+func parseTrainingOutput(output string) (*TrainingResult, error) {
+	objects := jsonObjects(output)
+	for i := len(objects) - 1; i >= 0; i-- {
+		if _, isProgress := ParseTrainingProgressLine(objects[i]); isProgress {
+			break
 		}
 
-		// If not valid, try to clean it up
-		// Remove trailing commas which are invalid in JSON
-		cleaned := regexp.MustCompile(`,\s*\}`).ReplaceAllString(match, "}")
-		cleaned = regexp.MustCompile(`,\s*\]`).ReplaceAllString(cleaned, "]")
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(objects[i]), &keys); err != nil || keys["price_model"] == nil || keys["sales_model"] == nil {
+			continue
+		}
 
-		if err := json.Unmarshal([]byte(cleaned), &js); err == nil {
-			return cleaned, nil
+		var result TrainingResult
+		if err := json.Unmarshal([]byte(objects[i]), &result); err != nil {
+			return nil, fmt.Errorf("error parsing training results JSON: %v\n\nOutput: %s", err, output)
 		}
+		result.PythonOutput = output
+		return &result, nil
 	}
+	return nil, &TrainingOutputError{Output: output}
+}
+
+// TrainModels trains the price and sales prediction models and records the run
+func (s *MLPredictionService) TrainModels(ctx context.Context) (*TrainingResult, error) {
+	run := &repository.TrainingRun{StartedAt: time.Now()}
+	result, err := s.trainModels(ctx, run, nil)
+	s.recordTrainingRun(run, result, err)
+	return result, err
+}
 
-	// No valid JSON found
-	return "", fmt.Errorf("no valid JSON found in output: %s", output)
+// TrainModelsOnSample trains models on a sample of the training rows for quick experiments and
+// records the run. The version is registered inactive and never installed
+func (s *MLPredictionService) TrainModelsOnSample(ctx context.Context, sample TrainingSample) (*TrainingResult, error) {
+	if err := sample.validate(); err != nil {
+		return nil, err
+	}
+	run := &repository.TrainingRun{StartedAt: time.Now()}
+	result, err := s.trainModels(ctx, run, &sample)
+	s.recordTrainingRun(run, result, err)
+	return result, err
 }
 
-// TrainModels trains the price and sales prediction models
-func (s *MLPredictionService) TrainModels() (*TrainingResult, error) {
+// trainModels runs the training script, filling in the run's dataset and output details as it
+// goes. A nil sample trains on the whole training window
+func (s *MLPredictionService) trainModels(ctx context.Context, run *repository.TrainingRun, sample *TrainingSample) (*TrainingResult, error) {
+	reportTrainingStage(ctx, TrainingStagePreparing)
+
 	// Check if the script exists
 	if !s.fileRepo.FileExists(s.scriptPath) {
 		return nil, fmt.Errorf("python script not found: %s", s.scriptPath)
@@ -152,76 +373,429 @@ func (s *MLPredictionService) TrainModels() (*TrainingResult, error) {
 	fullTrainPath := s.fileRepo.GetDataFilePath(s.trainDataPath)
 	fullValPath := s.fileRepo.GetDataFilePath(s.testDataPath)
 
+	parameters := map[string]string{
+		"script":     s.scriptPath,
+		"train_data": fullTrainPath,
+		"val_data":   fullValPath,
+		"model_dir":  s.fileRepo.GetModelPath(),
+		"targets":    strings.Join(s.targets, ","),
+		"window":     s.window.String(),
+		"quota":      s.quota.String(),
+	}
+	if sample != nil {
+		parameters["sample"] = sample.String()
+	}
+	run.Parameters, _ = json.Marshal(parameters)
+
 	if !s.fileRepo.FileExists(fullTrainPath) {
 		return nil, fmt.Errorf("training data file not found: %s", fullTrainPath)
 	}
 	if !s.fileRepo.FileExists(fullValPath) {
 		return nil, fmt.Errorf("validation data file not found: %s", fullValPath)
 	}
+	if err := s.disk.CheckTrainingSpace(fullTrainPath, fullValPath); err != nil {
+		return nil, err
+	}
 
-	// Run Python script to train models
-	output, err := s.fileRepo.RunPythonScript(s.scriptPath, "train", fullTrainPath, "--val-data", fullValPath)
+	// The run trains on its own copy of the datasets, so that the processor rewriting them or a
+	// concurrent run can't change what it reads, and the hash describes exactly what it trained on.
+	// Encrypted datasets are decrypted into the copy, since the script reads plain CSV
+	runDir, err := s.fileRepo.CreateRunDir()
 	if err != nil {
-		return nil, fmt.Errorf("error running training script: %v\n\nOutput: %s", err, output)
+		return nil, err
+	}
+	defer s.fileRepo.RemoveRunDir(runDir)
+	trainPath, err := s.fileRepo.CopyDatasetToRunDir(runDir, fullTrainPath)
+	if err != nil {
+		return nil, err
+	}
+	valPath, err := s.fileRepo.CopyDatasetToRunDir(runDir, fullValPath)
+	if err != nil {
+		return nil, err
 	}
 
-	// Save the output for logging purposes
-	pythonOutput := output
+	datasetHash, err := s.fileRepo.HashFiles(trainPath, valPath)
+	if err != nil {
+		s.logger.Warnw("Failed to hash training dataset", "error", err)
+	}
+	run.DatasetHash = datasetHash
 
-	// Extract JSON from the output
-	jsonStr, err := extractJSON(output)
+	// The processed data size lets the retrain trigger measure what was ingested since this run
+	datasetRows, err := s.postgresRepo.CountProcessedRows()
 	if err != nil {
-		// Return the full Python output as part of the error
-		return nil, fmt.Errorf("python_output:%s", pythonOutput)
+		s.logger.Warnw("Failed to count processed data rows", "error", err)
+	}
+	run.DatasetRows = datasetRows
+
+	// The script derives the promotion features of the training rows from the promotion calendar
+	promotionsPath, err := writePromotionsFile(s.postgresRepo, runDir)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting promotions: %w", err)
+	}
+
+	// The seller features of the training rows come from the last seller stats refresh
+	sellerStatsPath, err := writeSellerStatsFile(s.postgresRepo, runDir)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting seller stats: %w", err)
+	}
+
+	// Train into a staging directory so that a failed or interrupted run never leaves partial
+	// artifacts where the prediction path loads them from
+	stagingDir, err := s.fileRepo.CreateStagingDir()
+	if err != nil {
+		return nil, err
+	}
+	defer s.fileRepo.RemoveStagingDir(stagingDir)
+
+	reportTrainingStage(ctx, TrainingStageTraining)
+	result, err := s.runTrainingScript(ctx, run, trainPath, valPath, promotionsPath, sellerStatsPath, stagingDir, sample)
+	if err != nil {
+		return nil, err
+	}
+	reportTrainingStage(ctx, TrainingStageInstalling)
+	if result.Downsampled != nil {
+		s.logger.Warnw("Training data exceeded the quota and was downsampled", "quota", s.quota.String(),
+			"rows", result.Downsampled.Rows, "dropped_rows", result.Downsampled.DroppedRows,
+			"fraction", result.Downsampled.Fraction)
+	}
+
+	result.SuspectReasons = s.overfitting.check(result)
+	result.Suspect = len(result.SuspectReasons) > 0
+	result.PromotionBlocked = append(result.PromotionBlocked, result.SuspectReasons...)
+	if sample != nil {
+		result.PromotionBlocked = append(result.PromotionBlocked, "trained on "+sample.String())
+	}
+
+	result.Version, err = newModelVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only a complete, compatible set of artifacts replaces the installed models, and only once it
+	// passed the shadow test when the standby slot is enabled
+	standby := len(result.PromotionBlocked) == 0 && s.standby.Enabled()
+	if len(result.PromotionBlocked) == 0 && !standby {
+		if err := installModelArtifacts(s.fileRepo, s.modelCheck, stagingDir); err != nil {
+			return nil, fmt.Errorf("error installing trained models: %w", err)
+		}
+		result.Promoted = true
+	}
+
+	s.events.Record(EventModelTrained, result.Version, ModelTrainedDetails{
+		DatasetHash: run.DatasetHash,
+		DatasetRows: run.DatasetRows,
+		DurationMs:  time.Since(run.StartedAt).Milliseconds(),
+		PriceModel:  result.PriceModel,
+		SalesModel:  result.SalesModel,
+		Suspect:     result.Suspect,
+	})
+
+	// Suspect and sampled runs keep the installed models; their version is registered inactive,
+	// with its artifacts in the artifact store for inspection
+	if len(result.PromotionBlocked) > 0 {
+		s.logger.Warnw("Trained models are not promoted, keeping the installed models", "version", result.Version,
+			"reasons", result.PromotionBlocked)
+		artifacts, err := stagedArtifacts(s.fileRepo, stagingDir)
+		if err == nil {
+			err = s.publishModelVersion(result, stagingDir, artifacts, result.PromotionBlocked, false)
+		}
+		if err != nil {
+			s.logger.Errorw("Failed to register unpromoted model version", "error", err, "version", result.Version)
+		}
+		return result, nil
+	}
+
+	// The standby_promotion job promotes the version once enough live predictions were mirrored to it
+	if standby {
+		artifacts, err := stagedArtifacts(s.fileRepo, stagingDir)
+		if err == nil {
+			err = s.publishModelVersion(result, stagingDir, artifacts, nil, true)
+		}
+		if err == nil {
+			err = s.standby.Adopt(result.Version, stagingDir, artifacts)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error loading trained models into the standby slot: %w", err)
+		}
+		result.Standby = true
+		return result, nil
+	}
+
+	// Publish the new models so that other replicas pick them up
+	artifacts, err := installedArtifacts(s.fileRepo)
+	if err == nil {
+		err = s.publishModelVersion(result, s.fileRepo.GetModelPath(), artifacts, nil, false)
+	}
+	if err != nil {
+		s.logger.Errorw("Failed to publish trained model version", "error", err, "version", result.Version)
+	}
+	if err := s.engine.Load(ctx); err != nil {
+		s.logger.Errorw("Failed to load trained models into the inference engine", "error", err, "version", result.Version)
+	} else {
+		s.golden.VerifyLoaded(ctx)
+	}
+
+	return result, nil
+}
+
+// runTrainingScript trains models into the staging directory and parses the script's metrics,
+// recording its output, learning curve and resource usage in the run
+func (s *MLPredictionService) runTrainingScript(ctx context.Context, run *repository.TrainingRun, trainPath, valPath, promotionsPath, sellerStatsPath, stagingDir string, sample *TrainingSample) (*TrainingResult, error) {
+	args := []string{trainPath, "--val-data", valPath, "--promotions", promotionsPath, "--seller-stats", sellerStatsPath,
+		"--model-dir", stagingDir}
+	args = append(args, s.lags.scriptArgs()...)
+	args = append(args, s.window.scriptArgs()...)
+	args = append(args, s.quota.scriptArgs()...)
+	args = append(args, s.overfitting.scriptArgs()...)
+	args = append(args, s.encoding.scriptArgs()...)
+	if sample != nil {
+		args = append(args, sample.scriptArgs()...)
+	}
+	if len(s.targets) > len(features.CoreTargets) {
+		args = append(args, "--targets", strings.Join(s.targets, ","))
+	}
+	output, usage, err := s.runPython(ctx, "train", args...)
+	run.PythonOutput = output
+	if usage != nil {
+		run.WallTimeMs = usage.WallTime.Milliseconds()
+		run.CPUTimeMs = usage.CPUTime().Milliseconds()
+		run.PeakRSSBytes = usage.PeakRSSBytes
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error running training script: %w\n\nOutput: %s", err, output)
+	}
+
+	// Iteration-level metrics are emitted as NDJSON progress lines
+	run.LearningCurve, _ = json.Marshal(parseTrainingProgress(output))
+
+	result, err := parseTrainingOutput(output)
+	if err != nil {
+		return nil, err
+	}
+	result.ResourceUsage = newResourceUsage(usage)
+	return result, nil
+}
+
+// recordTrainingRun persists the outcome of a training run.
+// Failures are logged and do not affect the training result.
+func (s *MLPredictionService) recordTrainingRun(run *repository.TrainingRun, result *TrainingResult, trainErr error) {
+	run.FinishedAt = time.Now()
+	run.DurationMs = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	run.PythonOutput = truncateOutput(run.PythonOutput, s.trainingLogMaxBytes)
+
+	if trainErr != nil {
+		run.Status = TrainingStatusFailed
+		run.Error = truncateOutput(trainErr.Error(), s.trainingLogMaxBytes)
+	} else {
+		run.Status = TrainingStatusSucceeded
+		run.Version = result.Version
+		run.Metrics, _ = json.Marshal(result)
+	}
+
+	if _, err := s.postgresRepo.SaveTrainingRun(run); err != nil {
+		s.logger.Errorw("Failed to record training run", "error", err)
+	}
+}
+
+// ListTrainingRuns returns a page of recorded training runs, newest first, and the total count
+func (s *MLPredictionService) ListTrainingRuns(limit, offset int) ([]TrainingRun, int, error) {
+	runs, total, err := s.postgresRepo.ListTrainingRuns(limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]TrainingRun, 0, len(runs))
+	for _, run := range runs {
+		item := TrainingRun{
+			ID:           run.ID,
+			StartedAt:    run.StartedAt,
+			FinishedAt:   run.FinishedAt,
+			DurationMs:   run.DurationMs,
+			Status:       run.Status,
+			Version:      run.Version,
+			Metrics:      json.RawMessage(run.Metrics),
+			DatasetHash:  run.DatasetHash,
+			DatasetRows:  run.DatasetRows,
+			Parameters:   json.RawMessage(run.Parameters),
+			PythonOutput: run.PythonOutput,
+			Error:        run.Error,
+		}
+		if run.WallTimeMs > 0 {
+			item.ResourceUsage = &ResourceUsage{
+				WallTimeMs:   run.WallTimeMs,
+				CPUTimeMs:    run.CPUTimeMs,
+				PeakRSSBytes: run.PeakRSSBytes,
+			}
+		}
+		items = append(items, item)
 	}
+	return items, total, nil
+}
 
-	// Parse the output to get training metrics
-	var result TrainingResult
-	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
-		return nil, fmt.Errorf("error parsing training results JSON: %v\n\nOutput: %s", err, pythonOutput)
+// GetTrainingLearningCurve returns the iteration-level metrics of a training run,
+// or nil if the run does not exist
+func (s *MLPredictionService) GetTrainingLearningCurve(id int64) ([]TrainingProgress, error) {
+	data, found, err := s.postgresRepo.GetTrainingRunLearningCurve(id)
+	if err != nil || !found {
+		return nil, err
 	}
 
-	result.PythonOutput = pythonOutput
+	progress := []TrainingProgress{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &progress); err != nil {
+			return nil, fmt.Errorf("error parsing learning curve: %v", err)
+		}
+	}
+	return progress, nil
+}
 
-	return &result, nil
+// truncateOutput keeps the last maxBytes of the output, where errors and final metrics are printed
+func truncateOutput(output string, maxBytes int) string {
+	if maxBytes <= 0 || len(output) <= maxBytes {
+		return output
+	}
+	return "...[truncated]\n" + strings.ToValidUTF8(output[len(output)-maxBytes:], "")
 }
 
 // Predict makes predictions for product price and sales using the full request
-func (s *MLPredictionService) Predict(request *PredictionRequest) (*PredictionResult, error) {
-	// Check if the script exists
-	if !s.fileRepo.FileExists(s.scriptPath) {
-		return nil, fmt.Errorf("python script not found: %s", s.scriptPath)
+func (s *MLPredictionService) Predict(ctx context.Context, request *PredictionRequest) (*PredictionResult, error) {
+	policy, unseen, err := s.encoders.check(request)
+	if err != nil {
+		return nil, err
 	}
+	result, err := s.engine.Predict(ctx, features.Encode(request, unseen))
+	if err != nil {
+		return nil, err
+	}
+	result.Strategy = PredictionStrategyGlobal
+	result.Warnings = append(result.Warnings, unseenWarnings(unseen)...)
+	result.DataQuality = result.DataQuality.withUnseen(policy, unseen)
+
+	version := s.ActiveModelVersion()
+	s.recordPrediction(request, result, nil, version)
+	s.standby.Mirror(request, result, version)
+	return result, nil
+}
 
-	// Convert request to JSON
-	requestJSON, err := json.Marshal(request)
+// Explain attributes the prediction of the full request to its features. Engines that cannot
+// explain predictions return ErrExplainNotSupported
+func (s *MLPredictionService) Explain(ctx context.Context, request *PredictionRequest) (*PredictionExplanation, error) {
+	_, unseen, err := s.encoders.check(request)
 	if err != nil {
-		return nil, fmt.Errorf("error marshaling prediction request: %v", err)
+		return nil, err
 	}
+	return s.engine.Explain(ctx, features.Encode(request, unseen))
+}
 
-	// Run Python script to make prediction
-	output, err := s.fileRepo.RunPythonScript(s.scriptPath, "predict", string(requestJSON))
+// PredictMinimal makes predictions with minimal input by fetching historical data from PostgreSQL
+func (s *MLPredictionService) PredictMinimal(ctx context.Context, minRequest *PredictionRequestMinimal) (*PredictionResult, error) {
+	resolved, err := s.resolveRequestedFeatures(ctx, minRequest)
 	if err != nil {
-		return nil, fmt.Errorf("error making prediction: %v", err)
+		return nil, err
 	}
 
-	// Extract JSON from the output
-	jsonStr, err := extractJSON(output)
+	// Run the model with the full request, or the strategies configured to stand in for it
+	result, err := s.predictResolved(ctx, resolved, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error extracting JSON from output: %v", err)
+		return nil, err
 	}
 
-	// Parse the output to get prediction results
-	var result PredictionResult
-	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
-		return nil, fmt.Errorf("error parsing prediction results: %v", err)
+	s.completeMinimalPrediction(resolved, result)
+	return result, nil
+}
+
+// completeMinimalPrediction annotates a prediction with how its features were resolved and records
+// it. Only predictions of the models are recorded, since the log and forecasts are kept per model
+// version
+func (s *MLPredictionService) completeMinimalPrediction(resolved *resolvedFeatures, result *PredictionResult) {
+	result.Overrides = resolved.overrides
+	result.HistoryDate = resolved.historyDate
+	result.Warnings = resolved.warnings
+	result.FeaturesPresent = resolved.featuresPresent
+	result.DataQuality = resolved.dataQuality
+	if resolved.baseline {
+		result.Baselines = NaiveBaselines(resolved.request)
 	}
+	if resolved.debug {
+		result.Provenance = resolved.provenance
+	}
+	if result.Strategy != PredictionStrategyGlobal {
+		return
+	}
+	version := s.ActiveModelVersion()
+	s.recordPrediction(resolved.request, result, &resolved.predictionDate, version)
+	s.standby.Mirror(resolved.request, result, version)
+	if len(result.Overrides) == 0 {
+		s.recordForecast(resolved.request, result, resolved.predictionDate, version)
+	}
+}
 
-	return &result, nil
+// FeatureVector is the fully resolved model input for a product on a date
+type FeatureVector struct {
+	PredictionDate time.Time          `json:"prediction_date"`
+	Features       *PredictionRequest `json:"features"`
+	HistoryDate    *time.Time         `json:"history_date,omitempty"`
+	Warnings       []string           `json:"warnings,omitempty"`
+	// FeaturesPresent tells, per historical feature, whether it was stored in the database
+	FeaturesPresent map[string]bool `json:"features_present"`
+	DataQuality     *DataQuality    `json:"data_quality,omitempty"`
+	// Provenance tells, per feature resolved from history, where its value came from
+	Provenance map[string]FeatureProvenance `json:"provenance"`
 }
 
-// PredictMinimal makes predictions with minimal input by fetching historical data from PostgreSQL
-func (s *MLPredictionService) PredictMinimal(minRequest *PredictionRequestMinimal) (*PredictionResult, error) {
+// ResolveFeatures returns the feature vector PredictMinimal would send to the model, without running it
+func (s *MLPredictionService) ResolveFeatures(ctx context.Context, minRequest *PredictionRequestMinimal) (*FeatureVector, error) {
+	resolved, err := s.resolveRequestedFeatures(ctx, minRequest)
+	if err != nil {
+		return nil, err
+	}
+	return &FeatureVector{
+		PredictionDate: resolved.predictionDate,
+		Features:       resolved.request,
+		HistoryDate:    resolved.historyDate,
+		Warnings:       resolved.warnings,
+
+		FeaturesPresent: resolved.featuresPresent,
+		DataQuality:     resolved.dataQuality,
+		Provenance:      resolved.provenance,
+	}, nil
+}
+
+// resolvedFeatures is a full prediction request together with how it was resolved
+type resolvedFeatures struct {
+	request        *PredictionRequest
+	overrides      []string
+	predictionDate time.Time
+	historyDate    *time.Time
+	warnings       []string
+	// featuresPresent marks the historical features that were not NULL in the database
+	featuresPresent map[string]bool
+	// dataQuality is set when the installed models interpolate missing days or the request has
+	// category values unseen in training
+	dataQuality *DataQuality
+	// unseen are the category values unseen in training, which the models see encoded
+	unseen []features.UnseenCategory
+	// provenance is where the features resolved from history came from, and debug asks for it in
+	// the result
+	provenance map[string]FeatureProvenance
+	debug      bool
+	// baseline asks for the naive baselines in the result
+	baseline bool
+}
+
+// modelRequest is the request the models see, with the unseen category values encoded
+func (r *resolvedFeatures) modelRequest() *PredictionRequest {
+	if len(r.unseen) == 0 {
+		return r.request
+	}
+	return features.Encode(r.request, r.unseen)
+}
+
+// resolveFeatures builds a full prediction request from historical data and the overrides
+// supplied in the minimal request, following the precedence rules of the features package.
+// It fails with ErrStaleHistory only when the staleness policy is strict. The features of external
+// providers are merged last; a provider that fails adds a warning instead of failing the request.
+func (s *MLPredictionService) resolveFeatures(ctx context.Context, minRequest *PredictionRequestMinimal) (*resolvedFeatures, error) {
 	// Determine prediction date (default to today if not provided)
 	predictionDate := time.Now()
 	if minRequest.PredictionDate != nil {
@@ -229,11 +803,15 @@ func (s *MLPredictionService) PredictMinimal(minRequest *PredictionRequestMinima
 	}
 
 	// Fetch historical data from PostgreSQL
+	// Lags are counted and missing days filled the way the installed models were trained
+	modelCheck := s.modelCheck.Result()
+	lagDates := features.LagDates(predictionDate, modelCheck.LagMode, s.lags.Holidays)
 	historicalData, err := s.postgresRepo.GetProductHistoricalData(
 		minRequest.ProductName,
 		minRequest.Region,
 		minRequest.Seller,
 		predictionDate,
+		lagDates,
 	)
 	if err != nil {
 		s.logger.Errorw("Error fetching historical data", "error", err,
@@ -241,184 +819,327 @@ func (s *MLPredictionService) PredictMinimal(minRequest *PredictionRequestMinima
 			"region", minRequest.Region,
 			"seller", minRequest.Seller)
 		// Continue with default values instead of returning error
-		historicalData = &repository.ProductHistoricalData{
-			Brand:     "Unknown Brand",
-			Category:  "Unknown Category",
-			IsWeekend: predictionDate.Weekday() == time.Saturday || predictionDate.Weekday() == time.Sunday,
-			IsHoliday: false,
-			DayOfWeek: int(predictionDate.Weekday()),
-			Month:     int(predictionDate.Month()),
-			Quarter:   (int(predictionDate.Month())-1)/3 + 1,
-		}
+		historicalData = nil
 	}
-
-	// Create full prediction request from historical data
-	fullRequest := &PredictionRequest{
-		ProductName: minRequest.ProductName,
-		Brand:       historicalData.Brand,
-		Category:    historicalData.Category,
-		Region:      minRequest.Region,
-		Seller:      minRequest.Seller,
-		IsWeekend:   historicalData.IsWeekend,
-		IsHoliday:   historicalData.IsHoliday,
-		DayOfWeek:   historicalData.DayOfWeek,
-		Month:       historicalData.Month,
-		Quarter:     historicalData.Quarter,
-	}
-
-	// Set values from historical data if available, or use defaults if not
-	// Price
-	if historicalData.Price.Valid {
-		fullRequest.Price = historicalData.Price.Float64
-	} else {
-		fullRequest.Price = 1000.0 // Default price
+	// Presence is taken before interpolation, which fills some of the missing features
+	featuresPresent := features.Presence(historicalData)
+	var dataQuality *DataQuality
+	if historicalData != nil && modelCheck.Interpolation != "" && modelCheck.Interpolation != features.InterpolationNone {
+		dataQuality = s.interpolateHistory(historicalData, minRequest, predictionDate, lagDates, modelCheck.Interpolation)
 	}
 
-	// Original price
-	if historicalData.OriginalPrice.Valid {
-		fullRequest.OriginalPrice = historicalData.OriginalPrice.Float64
-	} else {
-		fullRequest.OriginalPrice = fullRequest.Price // Default to current price
+	fullRequest, overrides := features.BuildFeatures(historicalData, features.Overrides{
+		Price:          minRequest.Price,
+		OriginalPrice:  minRequest.OriginalPrice,
+		StockLevel:     minRequest.StockLevel,
+		CustomerRating: minRequest.CustomerRating,
+		ReviewCount:    minRequest.ReviewCount,
+		DeliveryDays:   minRequest.DeliveryDays,
+	}, predictionDate)
+	fullRequest.ProductName = minRequest.ProductName
+	fullRequest.Region = minRequest.Region
+	fullRequest.Seller = minRequest.Seller
+
+	var latestDate *time.Time
+	if historicalData != nil && historicalData.LatestDate.Valid {
+		latestDate = &historicalData.LatestDate.Time
 	}
+	var interpolated []string
+	if dataQuality != nil {
+		interpolated = dataQuality.Interpolated
+	}
+	provenance := features.TraceProvenance(featuresPresent, latestDate, lagDates, interpolated, overrides)
 
-	// Discount percentage
-	if historicalData.DiscountPerc.Valid {
-		fullRequest.DiscountPercentage = historicalData.DiscountPerc.Float64
-	} else {
-		// Calculate discount if we have original price and it's different from current price
-		if fullRequest.OriginalPrice > fullRequest.Price {
-			fullRequest.DiscountPercentage = (fullRequest.OriginalPrice - fullRequest.Price) / fullRequest.OriginalPrice * 100
-		} else {
-			fullRequest.DiscountPercentage = 0.0
+	// The product catalog knows brand and category even for products without recent history
+	product, err := s.postgresRepo.GetProduct(minRequest.ProductName)
+	if err != nil {
+		s.logger.Errorw("Error fetching product catalog entry", "error", err, "product", minRequest.ProductName)
+	} else if product != nil {
+		features.ApplyCatalog(fullRequest, product.Brand, product.Category)
+		if product.Brand != "" {
+			provenance["brand"] = FeatureProvenance{Source: features.SourceCatalog}
+		}
+		if product.Category != "" {
+			provenance["category"] = FeatureProvenance{Source: features.SourceCatalog}
 		}
 	}
 
-	// Stock level
-	if historicalData.StockLevel.Valid {
-		fullRequest.StockLevel = historicalData.StockLevel.Float64
+	// Planned promotions of the product and its category
+	day := time.Date(predictionDate.Year(), predictionDate.Month(), predictionDate.Day(), 0, 0, 0, 0, time.UTC)
+	promotions, err := s.postgresRepo.PromotionsFor(fullRequest.ProductName, fullRequest.Category,
+		day, day.AddDate(0, 0, features.PromotionHorizonDays))
+	if err != nil {
+		s.logger.Errorw("Error fetching promotions", "error", err, "product", minRequest.ProductName)
 	} else {
-		fullRequest.StockLevel = 100.0 // Default stock level
+		features.ApplyPromotions(fullRequest, featurePromotions(promotions), predictionDate)
 	}
 
-	// Customer rating
-	if historicalData.CustomerRating.Valid {
-		fullRequest.CustomerRating = historicalData.CustomerRating.Float64
-	} else {
-		fullRequest.CustomerRating = 4.0 // Default rating
+	// Reliability of the seller, as of the last seller stats refresh
+	sellerStats, err := s.postgresRepo.GetSellerStats(minRequest.Seller)
+	if err != nil {
+		s.logger.Errorw("Error fetching seller stats", "error", err, "seller", minRequest.Seller)
+		sellerStats = nil
 	}
+	features.ApplySellerStats(fullRequest, featureSellerStats(sellerStats))
 
-	// Review count
-	if historicalData.ReviewCount.Valid {
-		fullRequest.ReviewCount = historicalData.ReviewCount.Float64
-	} else {
-		fullRequest.ReviewCount = 10.0 // Default review count
+	resolved := &resolvedFeatures{
+		request:        fullRequest,
+		overrides:      overrides,
+		predictionDate: predictionDate,
+
+		featuresPresent: featuresPresent,
+		dataQuality:     dataQuality,
+		provenance:      provenance,
+		debug:           minRequest.Debug,
+		baseline:        minRequest.Baseline,
 	}
+	if historicalData != nil && historicalData.LatestDate.Valid {
+		historyDate := historicalData.LatestDate.Time
+		resolved.historyDate = &historyDate
 
-	// Delivery days
-	if historicalData.DeliveryDays.Valid {
-		fullRequest.DeliveryDays = historicalData.DeliveryDays.Float64
-	} else {
-		fullRequest.DeliveryDays = 3.0 // Default delivery days
+		if warning := s.staleness.check(historyDate, predictionDate); warning != "" {
+			if s.staleness.Strict {
+				return nil, fmt.Errorf("%w: %s", ErrStaleHistory, warning)
+			}
+			resolved.warnings = append(resolved.warnings, warning)
+		}
 	}
+	resolved.warnings = append(resolved.warnings, s.providers.Apply(ctx, fullRequest, predictionDate)...)
 
-	// Historical data - lags and rolling means
-	// Use defaults if not available
-	if historicalData.SalesQuantityLag1.Valid {
-		fullRequest.SalesQuantityLag1 = historicalData.SalesQuantityLag1.Float64
-	} else {
-		fullRequest.SalesQuantityLag1 = 10.0 // Default sales
+	return resolved, nil
+}
+
+// interpolateHistory fills the lags and rolling means of historical that fall on days without a
+// stored row from the neighbouring days of the product's history. A failed lookup leaves the
+// features missing and is only logged
+func (s *MLPredictionService) interpolateHistory(historical *repository.ProductHistoricalData, minRequest *PredictionRequestMinimal,
+	predictionDate time.Time, lagDates repository.LagDates, method features.Interpolation) *DataQuality {
+	quality := &DataQuality{Interpolation: method, Interpolated: []string{}}
+
+	from := lagDates.Lag7
+	for _, day := range lagDates.Window7 {
+		if day.Before(from) {
+			from = day
+		}
+	}
+	series, err := s.postgresRepo.GetProductSeries(minRequest.ProductName, minRequest.Region, minRequest.Seller,
+		from.AddDate(0, 0, -features.InterpolationMaxGapDays), predictionDate)
+	if err != nil {
+		s.logger.Errorw("Error fetching history for interpolation", "error", err,
+			"product", minRequest.ProductName,
+			"region", minRequest.Region,
+			"seller", minRequest.Seller)
+		return quality
 	}
+	if interpolated := features.Interpolate(historical, series, lagDates, method); interpolated != nil {
+		quality.Interpolated = interpolated
+	}
+	return quality
+}
 
-	if historicalData.PriceLag1.Valid {
-		fullRequest.PriceLag1 = historicalData.PriceLag1.Float64
-	} else {
-		fullRequest.PriceLag1 = fullRequest.Price // Default to current price
+// recordPrediction writes the prediction, made by the given model version, to the audit log.
+// Failures are logged and do not fail the prediction itself.
+func (s *MLPredictionService) recordPrediction(request *PredictionRequest, result *PredictionResult, predictionDate *time.Time, version string) {
+	features := getJSONBuffer(1)
+	defer putJSONBuffer(features)
+	if err := encodeJSON(features, request); err != nil {
+		s.logger.Errorw("Failed to encode features for prediction log", "error", err)
+		return
 	}
 
-	if historicalData.SalesQuantityLag3.Valid {
-		fullRequest.SalesQuantityLag3 = historicalData.SalesQuantityLag3.Float64
-	} else {
-		fullRequest.SalesQuantityLag3 = 9.0 // Slightly different from lag 1
+	id, err := s.postgresRepo.SavePredictionLog(&repository.PredictionLogEntry{
+		ProductName:    request.ProductName,
+		Region:         request.Region,
+		Seller:         request.Seller,
+		PredictionDate: predictionDate,
+		Features:       features.Bytes(),
+		Overrides:      result.Overrides,
+		PredictedPrice: result.PredictedPrice,
+		PredictedSales: result.PredictedSales,
+		ModelVersion:   version,
+	})
+	if err != nil {
+		s.logger.Errorw("Failed to record prediction", "error", err,
+			"product", request.ProductName, "region", request.Region, "seller", request.Seller)
+		return
 	}
+	result.PredictionID = id
+}
 
-	if historicalData.PriceLag3.Valid {
-		fullRequest.PriceLag3 = historicalData.PriceLag3.Float64
-	} else {
-		fullRequest.PriceLag3 = fullRequest.Price * 0.98 // Slight price change from current
+// recordForecast stores a forecast built from history alone, so it can later be compared with actuals.
+// Failures are logged and do not fail the prediction itself.
+func (s *MLPredictionService) recordForecast(request *PredictionRequest, result *PredictionResult, forecastDate time.Time, version string) {
+	_, err := s.postgresRepo.SaveForecast(&repository.Forecast{
+		ProductName:    request.ProductName,
+		Region:         request.Region,
+		Seller:         request.Seller,
+		ForecastDate:   forecastDate,
+		HorizonDays:    salesForecastDays,
+		PredictedPrice: result.PredictedPrice,
+		PredictedSales: result.PredictedSales,
+		ModelVersion:   version,
+	})
+	if err != nil {
+		s.logger.Errorw("Failed to record forecast", "error", err,
+			"product", request.ProductName, "region", request.Region, "seller", request.Seller)
 	}
+}
 
-	if historicalData.SalesQuantityLag7.Valid {
-		fullRequest.SalesQuantityLag7 = historicalData.SalesQuantityLag7.Float64
-	} else {
-		fullRequest.SalesQuantityLag7 = 8.0 // Default
+// CheckModelsExist checks if a valid set of trained models is installed
+func (s *MLPredictionService) CheckModelsExist() bool {
+	return s.modelCheck.Result().Valid
+}
+
+// CheckModels returns the outcome of validating the installed models
+func (s *MLPredictionService) CheckModels() ModelCheckResult {
+	return s.modelCheck.Result()
+}
+
+// ActiveModelVersion returns the model version installed locally, or "" if unknown
+func (s *MLPredictionService) ActiveModelVersion() string {
+	return s.fileRepo.ReadModelVersion()
+}
+
+// ListModelMetrics returns the metrics of every model version trained in the given period, oldest first
+func (s *MLPredictionService) ListModelMetrics(from, to time.Time) ([]ModelVersionMetrics, error) {
+	versions, err := s.postgresRepo.ListModelVersions(from, to)
+	if err != nil {
+		return nil, err
 	}
 
-	if historicalData.PriceLag7.Valid {
-		fullRequest.PriceLag7 = historicalData.PriceLag7.Float64
-	} else {
-		fullRequest.PriceLag7 = fullRequest.Price * 0.95 // Slight price change from current
+	metrics := make([]ModelVersionMetrics, 0, len(versions))
+	for i := range versions {
+		metrics = append(metrics, s.versionMetrics(&versions[i]))
 	}
+	return metrics, nil
+}
 
-	if historicalData.SalesQuantityRollingMean3.Valid {
-		fullRequest.SalesQuantityRollingMean3 = historicalData.SalesQuantityRollingMean3.Float64
-	} else {
-		// Average of lag1 and lag3 if available, otherwise default
-		fullRequest.SalesQuantityRollingMean3 = (fullRequest.SalesQuantityLag1 + fullRequest.SalesQuantityLag3) / 2
+// ListModelVersions returns a page of the registered model versions, newest first, with the
+// dataset each was trained on, and the total number of versions
+func (s *MLPredictionService) ListModelVersions(limit, offset int) ([]ModelVersionMetrics, int, error) {
+	versions, total, err := s.postgresRepo.ListModelVersionPage(limit, offset)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	if historicalData.PriceRollingMean3.Valid {
-		fullRequest.PriceRollingMean3 = historicalData.PriceRollingMean3.Float64
-	} else {
-		// Average of current, lag1 and lag3 if available
-		fullRequest.PriceRollingMean3 = (fullRequest.Price + fullRequest.PriceLag1 + fullRequest.PriceLag3) / 3
+	items := make([]ModelVersionMetrics, 0, len(versions))
+	for i := range versions {
+		item := s.versionMetrics(&versions[i])
+		item.DatasetHash, item.DatasetRows = versions[i].DatasetHash, versions[i].DatasetRows
+		items = append(items, item)
 	}
+	return items, total, nil
+}
 
-	if historicalData.SalesQuantityRollingMean7.Valid {
-		fullRequest.SalesQuantityRollingMean7 = historicalData.SalesQuantityRollingMean7.Float64
-	} else {
-		// Average of lag1, lag3 and lag7 if available, otherwise default
-		fullRequest.SalesQuantityRollingMean7 = (fullRequest.SalesQuantityLag1 + fullRequest.SalesQuantityLag3 + fullRequest.SalesQuantityLag7) / 3
+// versionMetrics converts a registered model version
+func (s *MLPredictionService) versionMetrics(v *repository.ModelVersion) ModelVersionMetrics {
+	return ModelVersionMetrics{
+		Version:   v.Version,
+		CreatedAt: v.CreatedAt,
+		IsActive:  v.IsActive,
+		IsStandby: v.IsStandby,
+		PriceModel: ModelMetrics{
+			BestIteration: v.PriceBestIteration,
+			BestScore:     v.PriceBestScore,
+			MAE:           v.PriceMAE,
+			BaselineMAE:   s.decodeBaselineMAE(v.Version, v.PriceBaselineMAE),
+		},
+		SalesModel: ModelMetrics{
+			BestIteration: v.SalesBestIteration,
+			BestScore:     v.SalesBestScore,
+			MAE:           v.SalesMAE,
+			BaselineMAE:   s.decodeBaselineMAE(v.Version, v.SalesBaselineMAE),
+		},
+		PromotionBlocked: v.PromotionBlocked,
 	}
+}
 
-	if historicalData.PriceRollingMean7.Valid {
-		fullRequest.PriceRollingMean7 = historicalData.PriceRollingMean7.Float64
-	} else {
-		// Average of current, lag1, lag3 and lag7
-		fullRequest.PriceRollingMean7 = (fullRequest.Price + fullRequest.PriceLag1 + fullRequest.PriceLag3 + fullRequest.PriceLag7) / 4
+// newModelVersion names a newly trained model version after its training time. The random suffix
+// keeps the names of versions trained within the same second on different replicas apart, since
+// the name is the key of the registry
+func newModelVersion() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("error naming model version: %w", err)
 	}
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix), nil
+}
 
-	// Override values if provided in the minimal request
-	if minRequest.Price != nil {
-		fullRequest.Price = *minRequest.Price
+// encodeBaselineMAE encodes the baseline MAE of a model for the registry, nil when there is none
+func encodeBaselineMAE(baselineMAE *BaselineMAE) ([]byte, error) {
+	if baselineMAE == nil {
+		return nil, nil
 	}
-	if minRequest.OriginalPrice != nil {
-		fullRequest.OriginalPrice = *minRequest.OriginalPrice
+	data, err := json.Marshal(baselineMAE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode baseline MAE: %w", err)
+	}
+	return data, nil
+}
+
+// decodeBaselineMAE decodes the baseline MAE of a registered model; a malformed value is logged
+// and left out
+func (s *MLPredictionService) decodeBaselineMAE(version string, data []byte) *BaselineMAE {
+	if len(data) == 0 {
+		return nil
 	}
-	if minRequest.StockLevel != nil {
-		fullRequest.StockLevel = *minRequest.StockLevel
+	var baselineMAE BaselineMAE
+	if err := json.Unmarshal(data, &baselineMAE); err != nil {
+		s.logger.Errorw("Failed to decode baseline MAE", "error", err, "version", version)
+		return nil
 	}
-	if minRequest.CustomerRating != nil {
-		fullRequest.CustomerRating = *minRequest.CustomerRating
+	return &baselineMAE
+}
+
+// publishModelVersion uploads freshly trained artifacts from dir and records them in the registry,
+// as the standby version when standby is set, or the active version unless promotion is blocked for
+// the given reasons
+func (s *MLPredictionService) publishModelVersion(result *TrainingResult, dir string, artifacts []string, blocked []string, standby bool) error {
+	if s.artifactStore != nil {
+		if err := s.artifactStore.Upload(result.Version, dir, artifacts); err != nil {
+			return err
+		}
 	}
-	if minRequest.ReviewCount != nil {
-		fullRequest.ReviewCount = *minRequest.ReviewCount
+
+	priceBaselineMAE, err := encodeBaselineMAE(result.PriceModel.BaselineMAE)
+	if err != nil {
+		return err
 	}
-	if minRequest.DeliveryDays != nil {
-		fullRequest.DeliveryDays = *minRequest.DeliveryDays
+	salesBaselineMAE, err := encodeBaselineMAE(result.SalesModel.BaselineMAE)
+	if err != nil {
+		return err
 	}
 
-	// Call the regular predict method with the full request
-	return s.Predict(fullRequest)
-}
+	previousVersion := s.fileRepo.ReadModelVersion()
+	err = s.postgresRepo.RegisterModelVersion(&repository.ModelVersion{
+		Version:            result.Version,
+		CreatedAt:          time.Now(),
+		IsActive:           len(blocked) == 0 && !standby,
+		IsStandby:          standby,
+		PriceBestIteration: result.PriceModel.BestIteration,
+		PriceBestScore:     result.PriceModel.BestScore,
+		SalesBestIteration: result.SalesModel.BestIteration,
+		SalesBestScore:     result.SalesModel.BestScore,
+		PriceMAE:           result.PriceModel.MAE,
+		SalesMAE:           result.SalesModel.MAE,
+		PriceBaselineMAE:   priceBaselineMAE,
+		SalesBaselineMAE:   salesBaselineMAE,
+		PromotionBlocked:   blocked,
+	})
+	if err != nil {
+		return err
+	}
+	if standby {
+		s.events.Record(EventModelStandby, result.Version, ModelStandbyDetails{
+			ActiveVersion: previousVersion,
+			ShadowPercent: s.standby.policy.Percent,
+		})
+		return nil
+	}
+	if len(blocked) > 0 {
+		return nil
+	}
+	s.events.Record(EventModelPromoted, result.Version, ModelPromotedDetails{PreviousVersion: previousVersion})
 
-// CheckModelsExist checks if trained models exist
-func (s *MLPredictionService) CheckModelsExist() bool {
-	modelDir := s.fileRepo.GetModelPath()
-	priceModelPath := filepath.Join(modelDir, "price_model.pkl")
-	salesModelPath := filepath.Join(modelDir, "sales_model.pkl")
-	featuresPath := filepath.Join(modelDir, "feature_info.json")
-
-	return s.fileRepo.FileExists(priceModelPath) &&
-		s.fileRepo.FileExists(salesModelPath) &&
-		s.fileRepo.FileExists(featuresPath)
+	return s.fileRepo.WriteModelVersion(result.Version)
 }
@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// pythonOutputDir holds captured outputs of the training script (<case>.txt) and what the service
+// makes of them (<case>.golden)
+const pythonOutputDir = "testdata/python_output"
+
+// fakeRunner is a ScriptRunner returning a canned output instead of starting Python
+type fakeRunner struct {
+	output string
+	usage  *repository.ResourceUsage
+	err    error
+
+	scriptPath string
+	args       []string
+}
+
+func (r *fakeRunner) RunPythonScriptWithUsage(ctx context.Context, scriptPath string, args ...string) (string, *repository.ResourceUsage, error) {
+	r.scriptPath = scriptPath
+	r.args = args
+	return r.output, r.usage, r.err
+}
+
+// parsedOutput is what the golden files record for a script output
+type parsedOutput struct {
+	JSON   json.RawMessage `json:"json,omitempty"`
+	Result *TrainingResult `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+func readPythonOutput(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(pythonOutputDir, name+".txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// firstLine drops the script output that error messages append after a blank line
+func firstLine(err error) string {
+	message, _, _ := strings.Cut(err.Error(), "\n")
+	return message
+}
+
+func TestParseTrainingOutputGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join(pythonOutputDir, "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no script outputs in " + pythonOutputDir)
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".txt")
+		t.Run(name, func(t *testing.T) {
+			output := readPythonOutput(t, name)
+
+			var parsed parsedOutput
+			if jsonStr, err := extractJSON(output); err == nil {
+				parsed.JSON = json.RawMessage(jsonStr)
+			}
+			result, err := parseTrainingOutput(output)
+			if err != nil {
+				parsed.Error = firstLine(err)
+			} else {
+				if result.PythonOutput != output {
+					t.Errorf("PythonOutput = %q, want the whole output", result.PythonOutput)
+				}
+				parsed.Result = result
+			}
+
+			got, err := json.MarshalIndent(parsed, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join(pythonOutputDir, name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v; run go test ./service -update to create it", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("parsed output does not match %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestExtractJSONReturnsLastObject(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"only object", `{"a": 1}`, `{"a": 1}`},
+		{"nested deeper than two levels", `{"a": {"b": {"c": {"d": 1}}}}`, `{"a": {"b": {"c": {"d": 1}}}}`},
+		{"later object wins", "{\"a\": 1}\n{\"b\": 2}\n", `{"b": 2}`},
+		{"python dict in a warning", "Warning: {'a': 1}\n{\"b\": 2}", `{"b": 2}`},
+		{"braces inside strings", `{"msg": "}{"}`, `{"msg": "}{"}`},
+		{"text after the object", "{\"a\": 1}\nDone {", `{"a": 1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractJSON(tt.output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("extractJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractJSONWithoutObject(t *testing.T) {
+	for _, output := range []string{"", "no json here", "{'a': 1}", `{"a": 1`, `{"a": NaN}`} {
+		if got, err := extractJSON(output); err == nil {
+			t.Errorf("extractJSON(%q) = %s, want an error", output, got)
+		}
+	}
+}
+
+func TestRunTrainingScript(t *testing.T) {
+	output := readPythonOutput(t, "progress_then_result")
+	runner := &fakeRunner{
+		output: output,
+		usage: &repository.ResourceUsage{
+			WallTime:     90 * time.Second,
+			UserCPU:      70 * time.Second,
+			SystemCPU:    5 * time.Second,
+			PeakRSSBytes: 512 << 20,
+		},
+	}
+	s := &MLPredictionService{runner: runner, scriptPath: "/app/scripts/lightGBM_model.py"}
+	run := &repository.TrainingRun{}
+
+	result, err := s.runTrainingScript(context.Background(), run, "train.csv", "val.csv", "promotions.json", "seller_stats.json", "staging", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if runner.scriptPath != s.scriptPath {
+		t.Errorf("script path = %s, want %s", runner.scriptPath, s.scriptPath)
+	}
+	wantArgs := []string{"train", "train.csv", "--val-data", "val.csv", "--promotions", "promotions.json", "--seller-stats", "seller_stats.json", "--model-dir", "staging"}
+	if strings.Join(runner.args, " ") != strings.Join(wantArgs, " ") {
+		t.Errorf("args = %q, want %q", runner.args, wantArgs)
+	}
+
+	wantPrice := ModelMetrics{BestIteration: 187, BestScore: 412.37, MAE: 298.11}
+	wantSales := ModelMetrics{BestIteration: 143, BestScore: 3.82, MAE: 2.41}
+	if result.PriceModel != wantPrice {
+		t.Errorf("PriceModel = %+v, want %+v", result.PriceModel, wantPrice)
+	}
+	if result.SalesModel != wantSales {
+		t.Errorf("SalesModel = %+v, want %+v", result.SalesModel, wantSales)
+	}
+	if result.PythonOutput != output {
+		t.Error("PythonOutput does not hold the script output")
+	}
+	wantUsage := ResourceUsage{WallTimeMs: 90000, CPUTimeMs: 75000, PeakRSSBytes: 512 << 20}
+	if result.ResourceUsage == nil || *result.ResourceUsage != wantUsage {
+		t.Errorf("ResourceUsage = %+v, want %+v", result.ResourceUsage, wantUsage)
+	}
+
+	if run.PythonOutput != output {
+		t.Error("run.PythonOutput does not hold the script output")
+	}
+	if run.WallTimeMs != 90000 || run.CPUTimeMs != 75000 || run.PeakRSSBytes != 512<<20 {
+		t.Errorf("run usage = %d ms wall, %d ms CPU, %d bytes, want 90000, 75000, %d",
+			run.WallTimeMs, run.CPUTimeMs, run.PeakRSSBytes, 512<<20)
+	}
+	var curve []TrainingProgress
+	if err := json.Unmarshal(run.LearningCurve, &curve); err != nil {
+		t.Fatal(err)
+	}
+	if len(curve) != 5 || curve[0].Model != "price" || curve[4].Model != "sales" || curve[4].Iteration != 143 {
+		t.Errorf("LearningCurve = %+v, want the 5 progress records", curve)
+	}
+}
+
+func TestRunTrainingScriptErrors(t *testing.T) {
+	errExit := errors.New("exit status 1")
+
+	tests := []struct {
+		name string
+		// fixture is the script output, empty for none
+		fixture   string
+		runnerErr error
+		// wantIs is the error the result must wrap; nil expects a TrainingOutputError
+		wantIs error
+	}{
+		{name: "script failed", fixture: "progress_then_crash", runnerErr: errExit, wantIs: errExit},
+		{name: "cancelled", runnerErr: context.Canceled, wantIs: context.Canceled},
+		{name: "deadline exceeded", fixture: "progress_then_crash", runnerErr: context.DeadlineExceeded, wantIs: context.DeadlineExceeded},
+		{name: "stopped on bad data", fixture: "stopped_on_bad_data"},
+		{name: "stopped after progress", fixture: "progress_then_crash"},
+		{name: "no output", fixture: "empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output string
+			if tt.fixture != "" {
+				output = readPythonOutput(t, tt.fixture)
+			}
+			s := &MLPredictionService{runner: &fakeRunner{output: output, err: tt.runnerErr}}
+			run := &repository.TrainingRun{}
+
+			result, err := s.runTrainingScript(context.Background(), run, "train.csv", "val.csv", "promotions.json", "seller_stats.json", "staging", nil)
+			if err == nil {
+				t.Fatalf("runTrainingScript() = %+v, want an error", result)
+			}
+			if run.PythonOutput != output {
+				t.Error("run.PythonOutput does not hold the script output")
+			}
+
+			var outputErr *TrainingOutputError
+			isOutputErr := errors.As(err, &outputErr)
+			if tt.wantIs != nil {
+				if !errors.Is(err, tt.wantIs) {
+					t.Errorf("error %q does not wrap %q", firstLine(err), tt.wantIs)
+				}
+				if isOutputErr {
+					t.Error("a runner error was reported as missing metrics")
+				}
+				if !strings.Contains(err.Error(), "Output: "+output) {
+					t.Error("the error does not include the script output")
+				}
+				return
+			}
+			if !isOutputErr {
+				t.Fatalf("error %q is not a TrainingOutputError", firstLine(err))
+			}
+			if outputErr.Output != output {
+				t.Error("TrainingOutputError.Output does not hold the script output")
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// modelChecksumsFile records the SHA-256 of every artifact installed in the model directory
+const modelChecksumsFile = "model_checksums.json"
+
+// ModelCheckResult is the outcome of validating the installed model artifacts
+type ModelCheckResult struct {
+	Valid bool `json:"valid"`
+	// Problems describe why the artifacts are not valid
+	Problems []string `json:"problems,omitempty"`
+	// LagMode is the lag mode the installed models were trained with
+	LagMode features.LagMode `json:"lag_mode,omitempty"`
+	// Interpolation is how the installed models fill days missing from the history
+	Interpolation features.Interpolation `json:"interpolation,omitempty"`
+	// Targets are the targets the installed models predict
+	Targets []string `json:"targets,omitempty"`
+	// TrainingWindow is the window of training rows the installed models learned from, e.g.
+	// "sliding 365d"; empty for models trained before it was stamped
+	TrainingWindow string    `json:"training_window,omitempty"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// ModelCheck validates the installed model artifacts: every artifact exists, matches the checksum
+// recorded when it was installed, and feature_info.json parses with a known lag mode. Hashing the artifacts is too slow
+// for every status call, so the result is cached until models are installed or the TTL passes; the
+// TTL catches files changed behind the service's back
+type ModelCheck struct {
+	fileRepo *repository.FileRepository
+	ttl      time.Duration
+	mu       sync.Mutex
+	result   *ModelCheckResult
+	now      func() time.Time
+}
+
+// NewModelCheck creates a model check whose results are reused for ttl; 0 caches them until
+// the next install
+func NewModelCheck(fileRepo *repository.FileRepository, ttl time.Duration) *ModelCheck {
+	return &ModelCheck{
+		fileRepo: fileRepo,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+// Result returns the cached result, validating the artifacts again when it is missing or expired
+func (c *ModelCheck) Result() ModelCheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.result == nil || (c.ttl > 0 && c.now().Sub(c.result.CheckedAt) >= c.ttl) {
+		result := c.validate()
+		c.result = &result
+	}
+	return *c.result
+}
+
+// Invalidate drops the cached result, so the next call validates the artifacts again
+func (c *ModelCheck) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.result = nil
+}
+
+// validate checks the installed artifacts. Models installed before checksums were recorded have no
+// checksums file and are only checked for presence and a parseable feature_info.json
+func (c *ModelCheck) validate() ModelCheckResult {
+	result := ModelCheckResult{CheckedAt: c.now()}
+	modelDir := c.fileRepo.GetModelPath()
+
+	var checksums map[string]string
+	if c.fileRepo.FileExists(filepath.Join(modelDir, modelChecksumsFile)) {
+		data, err := c.fileRepo.ReadModelFile(modelChecksumsFile)
+		if err == nil {
+			err = json.Unmarshal(data, &checksums)
+		}
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s is unreadable: %v", modelChecksumsFile, err))
+		}
+	}
+
+	// The models of extra targets are only known from feature_info.json, checked below
+	artifacts := modelArtifacts
+	var info *features.ModelInfo
+	if c.fileRepo.FileExists(filepath.Join(modelDir, featureInfoFile)) {
+		data, err := c.fileRepo.ReadModelFile(featureInfoFile)
+		if err == nil {
+			info, err = parseModelInfo(data)
+		}
+		if err == nil {
+			result.LagMode, err = features.ParseLagMode(string(info.LagMode))
+		}
+		if err == nil {
+			result.Interpolation, err = features.ParseInterpolation(string(info.Interpolation))
+		}
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s is unreadable: %v", featureInfoFile, err))
+		} else {
+			artifacts = versionArtifacts(info)
+			result.Targets = append(append([]string(nil), features.CoreTargets...), info.ExtraTargets()...)
+			if info.TrainingWindow != "" {
+				result.TrainingWindow = TrainingWindow{Mode: info.TrainingWindow, Days: info.TrainingWindowDays}.String()
+			}
+		}
+	}
+
+	for _, name := range artifacts {
+		path := filepath.Join(modelDir, name)
+		if !c.fileRepo.FileExists(path) {
+			result.Problems = append(result.Problems, name+" is missing")
+			continue
+		}
+		want, ok := checksums[name]
+		if !ok {
+			continue
+		}
+		got, err := c.fileRepo.HashFiles(path)
+		if err != nil {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s could not be hashed: %v", name, err))
+		} else if got != want {
+			result.Problems = append(result.Problems, name+" does not match its recorded checksum")
+		}
+	}
+
+	result.Valid = len(result.Problems) == 0
+	return result
+}
+
+// stagedChecksums returns the checksums file contents for the artifacts in a staging directory
+func stagedChecksums(fileRepo *repository.FileRepository, stagingDir string, artifacts []string) ([]byte, error) {
+	checksums := make(map[string]string, len(artifacts))
+	for _, name := range artifacts {
+		sum, err := fileRepo.HashFiles(filepath.Join(stagingDir, name))
+		if err != nil {
+			return nil, err
+		}
+		checksums[name] = sum
+	}
+	return json.MarshalIndent(checksums, "", "  ")
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// featureInfoFile is the model artifact describing the features the models were trained on
+const featureInfoFile = "feature_info.json"
+
+// ErrModelIncompatible is returned when the installed models expect features the feature builder
+// no longer produces, so that predictions are rejected instead of silently degrading
+var ErrModelIncompatible = errors.New("model is incompatible with the feature builder")
+
+// checkModelCompatibility verifies the feature_info.json stamp of the installed models
+// against the feature builder
+func checkModelCompatibility(fileRepo *repository.FileRepository) error {
+	data, err := fileRepo.ReadModelFile(featureInfoFile)
+	if err != nil {
+		return err
+	}
+	return checkFeatureInfo(data)
+}
+
+// checkFeatureInfo verifies a feature_info.json stamp against the feature builder
+func checkFeatureInfo(data []byte) error {
+	info, err := parseModelInfo(data)
+	if err != nil {
+		return err
+	}
+
+	if err := features.CheckCompatibility(info); err != nil {
+		return fmt.Errorf("%w: %v", ErrModelIncompatible, err)
+	}
+	return nil
+}
+
+// parseModelInfo parses a feature_info.json stamp
+func parseModelInfo(data []byte) (*features.ModelInfo, error) {
+	var info features.ModelInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", featureInfoFile, err)
+	}
+	return &info, nil
+}
+
+// versionArtifacts returns the artifacts of a model version: modelArtifacts, the model of every
+// extra target its feature_info.json declares and its encoders when it has them
+func versionArtifacts(info *features.ModelInfo) []string {
+	artifacts := append([]string(nil), modelArtifacts...)
+	for _, target := range info.ExtraTargets() {
+		artifacts = append(artifacts, features.ModelFile(target))
+	}
+	if info.EncoderVersion > 0 {
+		artifacts = append(artifacts, features.EncodersFile)
+	}
+	return artifacts
+}
+
+// installedArtifacts returns the artifacts of the installed model version
+func installedArtifacts(fileRepo *repository.FileRepository) ([]string, error) {
+	data, err := fileRepo.ReadModelFile(featureInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parseModelInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	return versionArtifacts(info), nil
+}
+
+// stagedArtifacts returns the artifacts of the model version in a staging directory
+func stagedArtifacts(fileRepo *repository.FileRepository, stagingDir string) ([]string, error) {
+	data, err := fileRepo.ReadStagedFile(stagingDir, featureInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parseModelInfo(data)
+	if err != nil {
+		return nil, err
+	}
+	return versionArtifacts(info), nil
+}
+
+// downloadModelArtifacts downloads a model version into a staging directory: modelArtifacts
+// first, then the models of the extra targets its feature_info.json declares. It returns the
+// artifacts of the version
+func downloadModelArtifacts(store repository.ArtifactStore, fileRepo *repository.FileRepository, version, stagingDir string) ([]string, error) {
+	if err := store.Download(version, stagingDir, modelArtifacts); err != nil {
+		return nil, err
+	}
+	artifacts, err := stagedArtifacts(fileRepo, stagingDir)
+	if err != nil {
+		return nil, err
+	}
+	if extra := artifacts[len(modelArtifacts):]; len(extra) > 0 {
+		if err := store.Download(version, stagingDir, extra); err != nil {
+			return nil, err
+		}
+	}
+	return artifacts, nil
+}
+
+// installModelArtifacts validates a complete set of artifacts in a staging directory and swaps
+// it into the model directory, recording the checksums of the new artifacts. The staging directory
+// is removed whether or not it was installed, and the model check is invalidated either way
+func installModelArtifacts(fileRepo *repository.FileRepository, check *ModelCheck, stagingDir string) error {
+	defer check.Invalidate()
+
+	if err := fileRepo.VerifyStagedArtifacts(stagingDir, modelArtifacts); err != nil {
+		fileRepo.RemoveStagingDir(stagingDir)
+		return err
+	}
+
+	data, err := fileRepo.ReadStagedFile(stagingDir, featureInfoFile)
+	if err == nil {
+		err = checkFeatureInfo(data)
+	}
+	var info *features.ModelInfo
+	if err == nil {
+		info, err = parseModelInfo(data)
+	}
+	// Models trained on a sample are for experiments and never serve predictions by default
+	if err == nil && info.Sampled() {
+		err = ErrSampledModel
+	}
+	// The models of extra targets are only known from feature_info.json
+	var artifacts []string
+	if err == nil {
+		artifacts = versionArtifacts(info)
+		err = fileRepo.VerifyStagedArtifacts(stagingDir, artifacts)
+	}
+	var checksums []byte
+	if err == nil {
+		checksums, err = stagedChecksums(fileRepo, stagingDir, artifacts)
+	}
+	if err != nil {
+		fileRepo.RemoveStagingDir(stagingDir)
+		return err
+	}
+
+	if err := fileRepo.InstallStagedArtifacts(stagingDir, artifacts); err != nil {
+		return err
+	}
+	return fileRepo.WriteModelFile(modelChecksumsFile, checksums)
+}
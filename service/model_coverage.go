@@ -0,0 +1,63 @@
+package service
+
+import (
+	"time"
+)
+
+// GlobalModel names the model trained on all segments, which serves every segment without its own model
+const GlobalModel = "global"
+
+// SegmentCoverage describes which model serves a category/region segment and how much data backs it
+type SegmentCoverage struct {
+	Category string `json:"category"`
+	Region   string `json:"region"`
+	// Model is the model serving the segment, GlobalModel when it falls back to the global model
+	Model        string     `json:"model"`
+	Fallback     bool       `json:"fallback"`
+	ModelVersion string     `json:"model_version,omitempty"`
+	TrainedAt    *time.Time `json:"trained_at,omitempty"`
+	Rows         int64      `json:"rows"`
+	Products     int64      `json:"products"`
+	// RowsSinceTraining counts the segment rows dated after the serving model was trained
+	RowsSinceTraining int64     `json:"rows_since_training"`
+	LastDataDate      time.Time `json:"last_data_date"`
+}
+
+// ModelCoverage lists every category/region segment in the processed data with the model serving it.
+// Only the global model is trained today, so every segment is reported as falling back to it.
+func (s *MLPredictionService) ModelCoverage() ([]SegmentCoverage, error) {
+	active, err := s.postgresRepo.GetActiveModelVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var since time.Time
+	if active != nil {
+		since = active.CreatedAt
+	}
+	volumes, err := s.postgresRepo.GetSegmentVolumes(since)
+	if err != nil {
+		return nil, err
+	}
+
+	coverage := make([]SegmentCoverage, 0, len(volumes))
+	for _, v := range volumes {
+		segment := SegmentCoverage{
+			Category:          v.Category,
+			Region:            v.Region,
+			Model:             GlobalModel,
+			Fallback:          true,
+			Rows:              v.Rows,
+			Products:          v.Products,
+			RowsSinceTraining: v.RowsSince,
+			LastDataDate:      v.LastDate,
+		}
+		if active != nil {
+			trainedAt := active.CreatedAt
+			segment.ModelVersion = active.Version
+			segment.TrainedAt = &trainedAt
+		}
+		coverage = append(coverage, segment)
+	}
+	return coverage, nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrUnknownModelVersion is returned when a model version is not in the registry
+	ErrUnknownModelVersion = errors.New("model version is not registered")
+	// ErrModelVersionNotStored is returned when the artifacts of a model version can't be read
+	// from the artifact store
+	ErrModelVersionNotStored = errors.New("model version artifacts are not available")
+)
+
+// ModelActivation is the outcome of activating a model version
+type ModelActivation struct {
+	Version         string `json:"version"`
+	PreviousVersion string `json:"previous_version,omitempty"`
+	// Changed is false when the version was already the active one
+	Changed bool `json:"changed"`
+}
+
+// ModelSyncStore is the model registry ModelSynchronizer follows. PostgresRepository implements it
+type ModelSyncStore interface {
+	GetActiveModelVersion() (*repository.ModelVersion, error)
+	GetModelVersion(version string) (*repository.ModelVersion, error)
+	ActivateModelVersion(version string) (bool, error)
+}
+
+// ModelSynchronizer keeps the local model directory in line with the active version in the registry,
+// so that every replica converges on the same model shortly after any of them finishes training. The
+// standby slot follows the standby version the same way
+type ModelSynchronizer struct {
+	fileRepo      *repository.FileRepository
+	postgresRepo  ModelSyncStore
+	artifactStore repository.ArtifactStore
+	engine        InferenceEngine
+	modelCheck    *ModelCheck
+	standby       *StandbyModel
+	golden        *GoldenSet
+	events        *EventLog
+	interval      time.Duration
+	logger        *zap.SugaredLogger
+
+	// mu keeps a sync and an activation from installing models at the same time
+	mu sync.Mutex
+}
+
+// NewModelSynchronizer creates a new model synchronizer
+func NewModelSynchronizer(fileRepo *repository.FileRepository, postgresRepo ModelSyncStore, artifactStore repository.ArtifactStore, engine InferenceEngine, modelCheck *ModelCheck, standby *StandbyModel, golden *GoldenSet, events *EventLog, interval time.Duration, logger *zap.SugaredLogger) *ModelSynchronizer {
+	return &ModelSynchronizer{
+		fileRepo:      fileRepo,
+		postgresRepo:  postgresRepo,
+		artifactStore: artifactStore,
+		engine:        engine,
+		modelCheck:    modelCheck,
+		standby:       standby,
+		golden:        golden,
+		events:        events,
+		interval:      interval,
+		logger:        logger,
+	}
+}
+
+// Start polls the registry until the context is cancelled
+func (s *ModelSynchronizer) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sync(); err != nil {
+				s.logger.Errorw("Model synchronization failed", "error", err)
+			}
+		}
+	}
+}
+
+// Sync downloads the active and standby registry versions if they differ from the local ones
+func (s *ModelSynchronizer) Sync() error {
+	if err := s.syncActive(); err != nil {
+		return err
+	}
+	return s.standby.Sync()
+}
+
+// syncActive downloads the active registry version if it differs from the locally installed one
+func (s *ModelSynchronizer) syncActive() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active, err := s.postgresRepo.GetActiveModelVersion()
+	if err != nil {
+		return err
+	}
+	if active == nil || active.Version == s.fileRepo.ReadModelVersion() {
+		return nil
+	}
+
+	s.logger.Infow("Pulling active model version", "version", active.Version,
+		"previous_version", s.fileRepo.ReadModelVersion())
+
+	stagingDir, err := s.fileRepo.CreateStagingDir()
+	if err != nil {
+		return err
+	}
+	if _, err := downloadModelArtifacts(s.artifactStore, s.fileRepo, active.Version, stagingDir); err != nil {
+		s.fileRepo.RemoveStagingDir(stagingDir)
+		return err
+	}
+	return s.install(context.Background(), active.Version, stagingDir)
+}
+
+// install swaps the models of a version downloaded into stagingDir into the model directory and
+// loads them
+func (s *ModelSynchronizer) install(ctx context.Context, version, stagingDir string) error {
+	if err := installModelArtifacts(s.fileRepo, s.modelCheck, stagingDir); err != nil {
+		return err
+	}
+	if err := s.fileRepo.WriteModelVersion(version); err != nil {
+		return err
+	}
+
+	s.logger.Infow("Model version installed", "version", version)
+	if err := s.engine.Load(ctx); err != nil {
+		return err
+	}
+	s.golden.VerifyLoaded(ctx)
+	return nil
+}
+
+// Activate makes a registered version the active one, to roll back to an earlier version or roll
+// forward to one that was not promoted. Its artifacts are downloaded and checked before the
+// registry is changed, so a version whose models can't serve is never activated; this replica
+// then installs them and the others pick them up with their synchronizer
+func (s *ModelSynchronizer) Activate(ctx context.Context, version string) (*ModelActivation, error) {
+	if s == nil {
+		return nil, fmt.Errorf("%w: no artifact store is configured", ErrModelVersionNotStored)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registered, err := s.postgresRepo.GetModelVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if registered == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownModelVersion, version)
+	}
+	activation := &ModelActivation{Version: version, PreviousVersion: s.fileRepo.ReadModelVersion()}
+	if registered.IsActive && activation.PreviousVersion == version {
+		return activation, nil
+	}
+
+	stagingDir, err := s.fileRepo.CreateStagingDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkStaged(version, stagingDir); err != nil {
+		s.fileRepo.RemoveStagingDir(stagingDir)
+		return nil, err
+	}
+
+	activated, err := s.postgresRepo.ActivateModelVersion(version)
+	if err == nil && !activated {
+		err = fmt.Errorf("%w: %s", ErrUnknownModelVersion, version)
+	}
+	if err != nil {
+		s.fileRepo.RemoveStagingDir(stagingDir)
+		return nil, err
+	}
+	activation.Changed = true
+	s.events.Record(EventModelPromoted, version, ModelPromotedDetails{PreviousVersion: activation.PreviousVersion})
+	s.logger.Infow("Model version activated", "version", version, "previous_version", activation.PreviousVersion)
+
+	if err := s.install(ctx, version, stagingDir); err != nil {
+		return nil, fmt.Errorf("error installing activated models: %w", err)
+	}
+	// A version activated from the standby slot leaves it empty
+	if err := s.standby.Sync(); err != nil {
+		s.logger.Warnw("Failed to sync the standby slot", "error", err)
+	}
+	return activation, nil
+}
+
+// checkStaged downloads a version into stagingDir and checks that its models can be installed
+func (s *ModelSynchronizer) checkStaged(version, stagingDir string) error {
+	artifacts, err := downloadModelArtifacts(s.artifactStore, s.fileRepo, version, stagingDir)
+	if err == nil {
+		err = s.fileRepo.VerifyStagedArtifacts(stagingDir, artifacts)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrModelVersionNotStored, err)
+	}
+
+	data, err := s.fileRepo.ReadStagedFile(stagingDir, featureInfoFile)
+	if err != nil {
+		return err
+	}
+	if err := checkFeatureInfo(data); err != nil {
+		return err
+	}
+	info, err := parseModelInfo(data)
+	if err != nil {
+		return err
+	}
+	if info.Sampled() {
+		return ErrSampledModel
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// OverfittingPolicy sets how long boosting continues without a better validation score, and how far
+// the validation score of a model may fall behind its training score before the run is suspect.
+// The models of a suspect run are not promoted automatically
+type OverfittingPolicy struct {
+	// EarlyStoppingRounds stops boosting after this many rounds without improving on the validation
+	// data; 0 leaves the script's default
+	EarlyStoppingRounds int
+	// ThresholdPercent is how much higher than its training RMSE the validation RMSE of a model may
+	// be, in percent of the training RMSE; 0 disables the check
+	ThresholdPercent float64
+}
+
+// scriptArgs returns the training script arguments selecting the early stopping rounds
+func (p OverfittingPolicy) scriptArgs() []string {
+	if p.EarlyStoppingRounds <= 0 {
+		return nil
+	}
+	return []string{"--early-stopping-rounds", strconv.Itoa(p.EarlyStoppingRounds)}
+}
+
+// check sets the score gap of every model of the result and returns why the run is suspect, if it is
+func (p OverfittingPolicy) check(result *TrainingResult) []string {
+	var reasons []string
+	checkModel := func(name string, metrics *ModelMetrics) {
+		metrics.ScoreGapPercent = scoreGapPercent(metrics)
+		if p.ThresholdPercent > 0 && metrics.ScoreGapPercent != nil && *metrics.ScoreGapPercent > p.ThresholdPercent {
+			reasons = append(reasons, fmt.Sprintf("%s validation RMSE is %.1f%% above its training RMSE, over the %g%% threshold",
+				name, *metrics.ScoreGapPercent, p.ThresholdPercent))
+		}
+	}
+
+	checkModel("price_model", &result.PriceModel)
+	checkModel("sales_model", &result.SalesModel)
+	targets := make([]string, 0, len(result.Targets))
+	for target := range result.Targets {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		metrics := result.Targets[target]
+		checkModel(target+"_model", &metrics)
+		result.Targets[target] = metrics
+	}
+	return reasons
+}
+
+// scoreGapPercent returns how much higher the validation RMSE of a model is than its training RMSE,
+// in percent of the training RMSE, or nil when the script reported no training score
+func scoreGapPercent(metrics *ModelMetrics) *float64 {
+	if metrics.TrainScore <= 0 {
+		return nil
+	}
+	gap := 100 * (metrics.BestScore - metrics.TrainScore) / metrics.TrainScore
+	return &gap
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Codes of the prediction dates a key has no features for
+const (
+	// PredictionDateBeforeHistory is a date before the first history row of the key
+	PredictionDateBeforeHistory = "prediction_date_before_history"
+	// PredictionDateBeyondHorizon is a date more than the maximum horizon after the latest history
+	// row of the key
+	PredictionDateBeyondHorizon = "prediction_date_beyond_horizon"
+)
+
+// ErrPredictionDateOutOfRange is returned when a minimal prediction asks for a date its key's
+// history can't build lag features for
+var ErrPredictionDateOutOfRange = errors.New("prediction date out of range")
+
+// PredictionDateError describes a prediction date out of the range of a key's history
+type PredictionDateError struct {
+	// Code is PredictionDateBeforeHistory or PredictionDateBeyondHorizon
+	Code string
+	Date time.Time
+	// Earliest is the first date the key can be predicted for, the date of its first history row
+	Earliest time.Time
+	// Latest is the last date the key can be predicted for, nil without a maximum horizon
+	Latest *time.Time
+}
+
+func (e *PredictionDateError) Error() string {
+	if e.Code == PredictionDateBeforeHistory {
+		return fmt.Sprintf("%v: %s is before the first history on %s", ErrPredictionDateOutOfRange,
+			e.Date.Format("2006-01-02"), e.Earliest.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("%v: %s is after %s, the maximum horizon past the latest history", ErrPredictionDateOutOfRange,
+		e.Date.Format("2006-01-02"), e.Latest.Format("2006-01-02"))
+}
+
+func (e *PredictionDateError) Unwrap() error {
+	return ErrPredictionDateOutOfRange
+}
+
+// PredictionHorizon limits how far past its history a key can be predicted
+type PredictionHorizon struct {
+	// MaxDays is how many days after the latest history row a prediction date may be, 0 disables
+	// the limit
+	MaxDays int
+}
+
+// check returns a PredictionDateError if date falls outside [first, last + MaxDays]. Dates are
+// compared by day
+func (h PredictionHorizon) check(date, first, last time.Time) error {
+	day := calendarDay(date)
+	err := &PredictionDateError{Date: day, Earliest: calendarDay(first)}
+	if h.MaxDays > 0 {
+		latest := calendarDay(last).AddDate(0, 0, h.MaxDays)
+		err.Latest = &latest
+	}
+
+	switch {
+	case day.Before(err.Earliest):
+		err.Code = PredictionDateBeforeHistory
+	case err.Latest != nil && day.After(*err.Latest):
+		err.Code = PredictionDateBeyondHorizon
+	default:
+		return nil
+	}
+	return err
+}
+
+// resolveRequestedFeatures resolves the features of a caller's minimal request like resolveFeatures,
+// failing with a PredictionDateError when its prediction date is out of range and applying the
+// unseen category policy. Backtests, simulations and recommendations call
+// resolveFeatures directly and are not checked
+func (s *MLPredictionService) resolveRequestedFeatures(ctx context.Context, minRequest *PredictionRequestMinimal) (*resolvedFeatures, error) {
+	if minRequest.PredictionDate != nil {
+		if err := s.checkPredictionDate(minRequest, *minRequest.PredictionDate); err != nil {
+			return nil, err
+		}
+	}
+	resolved, err := s.resolveFeatures(ctx, minRequest)
+	if err != nil {
+		return nil, err
+	}
+	policy, unseen, err := s.encoders.check(resolved.request)
+	if err != nil {
+		return nil, err
+	}
+	resolved.unseen = unseen
+	resolved.warnings = append(resolved.warnings, unseenWarnings(unseen)...)
+	resolved.dataQuality = resolved.dataQuality.withUnseen(policy, unseen)
+	return resolved, nil
+}
+
+// checkPredictionDate checks an explicit prediction date against the history of the request's key.
+// Keys without history are not checked, since they are predicted from defaults or the fallback
+// chain, and neither is the date when the history can't be read
+func (s *MLPredictionService) checkPredictionDate(minRequest *PredictionRequestMinimal, date time.Time) error {
+	history, err := s.postgresRepo.GetHistoryRange(minRequest.ProductName, minRequest.Region, minRequest.Seller)
+	if err != nil {
+		s.logger.Errorw("Error fetching history range", "error", err,
+			"product", minRequest.ProductName,
+			"region", minRequest.Region,
+			"seller", minRequest.Seller)
+		return nil
+	}
+	if !history.FirstDate.Valid {
+		return nil
+	}
+	return s.horizon.check(date, history.FirstDate.Time, history.LastDate.Time)
+}
+
+// calendarDay returns the date of t at midnight UTC
+func calendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// ProcessMetrics records resource usage of Python subprocesses
+type ProcessMetrics struct {
+	runs     *metrics.CounterVec
+	wallTime *metrics.HistogramVec
+	cpuTime  *metrics.CounterVec
+	peakRSS  *metrics.GaugeVec
+}
+
+// NewProcessMetrics registers the subprocess metrics in the registry
+func NewProcessMetrics(registry *metrics.Registry) *ProcessMetrics {
+	return &ProcessMetrics{
+		runs: registry.NewCounterVec("ml_python_process_runs_total",
+			"Number of Python subprocess runs", "action", "status"),
+		wallTime: registry.NewHistogramVec("ml_python_process_wall_seconds",
+			"Wall time of Python subprocesses", metrics.DefaultBuckets, "action"),
+		cpuTime: registry.NewCounterVec("ml_python_process_cpu_seconds_total",
+			"User and system CPU time consumed by Python subprocesses", "action"),
+		peakRSS: registry.NewGaugeVec("ml_python_process_peak_rss_bytes",
+			"Peak resident set size of the last Python subprocess", "action"),
+	}
+}
+
+// Observe records one finished subprocess
+func (m *ProcessMetrics) Observe(action string, usage *repository.ResourceUsage, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	m.runs.WithLabelValues(action, status).Inc()
+
+	if usage == nil {
+		return
+	}
+	m.wallTime.WithLabelValues(action).Observe(usage.WallTime.Seconds())
+	m.cpuTime.WithLabelValues(action).Add(usage.CPUTime().Seconds())
+	m.peakRSS.WithLabelValues(action).Set(float64(usage.PeakRSSBytes))
+}
+
+// ResourceUsage describes the resources consumed by a Python subprocess
+type ResourceUsage struct {
+	WallTimeMs   int64 `json:"wall_time_ms"`
+	CPUTimeMs    int64 `json:"cpu_time_ms"`
+	PeakRSSBytes int64 `json:"peak_rss_bytes"`
+}
+
+// newResourceUsage converts subprocess usage for API responses
+func newResourceUsage(usage *repository.ResourceUsage) *ResourceUsage {
+	if usage == nil {
+		return nil
+	}
+	return &ResourceUsage{
+		WallTimeMs:   usage.WallTime.Milliseconds(),
+		CPUTimeMs:    usage.CPUTime().Milliseconds(),
+		PeakRSSBytes: usage.PeakRSSBytes,
+	}
+}
+
+// ScriptRunner runs Python scripts and reports their combined output and resource usage.
+// FileRepository runs them as subprocesses; tests substitute canned outputs
+type ScriptRunner interface {
+	RunPythonScriptWithUsage(ctx context.Context, scriptPath string, args ...string) (string, *repository.ResourceUsage, error)
+}
+
+// runPython runs the model script for the given action and records its resource usage
+func (s *MLPredictionService) runPython(ctx context.Context, action string, args ...string) (string, *repository.ResourceUsage, error) {
+	return runPythonScript(ctx, s.runner, s.scriptPath, s.processMetrics, action, args...)
+}
+
+// runPythonScript runs a script action and records its resource usage when metrics are enabled
+func runPythonScript(ctx context.Context, runner ScriptRunner, scriptPath string, processMetrics *ProcessMetrics, action string, args ...string) (string, *repository.ResourceUsage, error) {
+	output, usage, err := runner.RunPythonScriptWithUsage(ctx, scriptPath, append([]string{action}, args...)...)
+	if processMetrics != nil {
+		processMetrics.Observe(action, usage, err)
+	}
+	return output, usage, err
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// ProductTopic is the ingestion topic of product catalog updates
+const ProductTopic = "products"
+
+// ErrInvalidProduct is returned when a catalog update fails validation
+var ErrInvalidProduct = errors.New("invalid product")
+
+// Product is the catalog entry of a product
+type Product struct {
+	ProductName string          `json:"product_name"`
+	Brand       string          `json:"brand,omitempty"`
+	Category    string          `json:"category,omitempty"`
+	Attributes  json.RawMessage `json:"attributes,omitempty"`
+	LaunchDate  *time.Time      `json:"launch_date,omitempty"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ProductUpdate replaces the catalog entry of a product, through the API or a message on the
+// products topic
+type ProductUpdate struct {
+	// ProductName is taken from the path in the API and required in messages
+	ProductName string `json:"product_name"`
+	Brand       string `json:"brand"`
+	Category    string `json:"category"`
+	// Attributes is a JSON object of free-form product attributes
+	Attributes json.RawMessage `json:"attributes"`
+	// LaunchDate is a date in YYYY-MM-DD format
+	LaunchDate string `json:"launch_date"`
+}
+
+// ProductFilter narrows the product catalog; empty fields match everything
+type ProductFilter struct {
+	Brand    string
+	Category string
+}
+
+// ProductStore holds the product dimension. PostgresRepository implements it
+type ProductStore interface {
+	ListProducts(filter repository.ProductFilter, limit, offset int) ([]repository.Product, int, error)
+	GetProduct(productName string) (*repository.Product, error)
+	UpsertProduct(p *repository.Product) error
+	DeleteProduct(productName string) (bool, error)
+}
+
+// ProductCatalog is the product dimension: brand, category, attributes and launch date of every
+// product, kept up to date through the API and the products ingestion topic. Feature resolution
+// prefers its brand and category over those of the latest processed_data row, which are missing or
+// stale for products with little history
+type ProductCatalog struct {
+	postgresRepo ProductStore
+	logger       *zap.SugaredLogger
+}
+
+// NewProductCatalog creates a new product catalog
+func NewProductCatalog(postgresRepo ProductStore, logger *zap.SugaredLogger) *ProductCatalog {
+	return &ProductCatalog{
+		postgresRepo: postgresRepo,
+		logger:       logger,
+	}
+}
+
+// Upsert validates an update and creates or replaces the catalog entry of the product
+func (c *ProductCatalog) Upsert(update *ProductUpdate) (*Product, error) {
+	row := &repository.Product{
+		ProductName: update.ProductName,
+		Brand:       update.Brand,
+		Category:    update.Category,
+	}
+	if row.ProductName == "" {
+		return nil, fmt.Errorf("%w: product_name is required", ErrInvalidProduct)
+	}
+	if attributes := bytes.TrimSpace(update.Attributes); len(attributes) > 0 && !bytes.Equal(attributes, []byte("null")) {
+		var object map[string]any
+		if err := json.Unmarshal(attributes, &object); err != nil {
+			return nil, fmt.Errorf("%w: attributes must be a JSON object", ErrInvalidProduct)
+		}
+		row.Attributes = attributes
+	}
+	if update.LaunchDate != "" {
+		launchDate, err := time.Parse("2006-01-02", update.LaunchDate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: launch_date must be a date in YYYY-MM-DD format", ErrInvalidProduct)
+		}
+		row.LaunchDate = sql.NullTime{Time: launchDate, Valid: true}
+	}
+
+	if err := c.postgresRepo.UpsertProduct(row); err != nil {
+		return nil, err
+	}
+	return c.Get(row.ProductName)
+}
+
+// Get returns the catalog entry of a product, or nil if it has none
+func (c *ProductCatalog) Get(productName string) (*Product, error) {
+	row, err := c.postgresRepo.GetProduct(productName)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	product := fromProductRow(*row)
+	return &product, nil
+}
+
+// Delete removes the catalog entry of a product and reports whether it existed. Predictions fall
+// back to the brand and category of its history
+func (c *ProductCatalog) Delete(productName string) (bool, error) {
+	return c.postgresRepo.DeleteProduct(productName)
+}
+
+// List returns a page of catalog entries matching the filter, ordered by name, and the total
+// number of matching entries
+func (c *ProductCatalog) List(filter ProductFilter, limit, offset int) ([]Product, int, error) {
+	rows, total, err := c.postgresRepo.ListProducts(repository.ProductFilter(filter), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	products := make([]Product, 0, len(rows))
+	for _, row := range rows {
+		products = append(products, fromProductRow(row))
+	}
+	return products, total, nil
+}
+
+// HandleMessage applies a ProductUpdate received on the products topic. Applying an update twice
+// has no further effect, so redelivered messages need no deduplication. An invalid update fails so
+// that the source dead-letters it
+func (c *ProductCatalog) HandleMessage(ctx context.Context, message IngestionMessage) error {
+	var update ProductUpdate
+	if err := json.Unmarshal(message.Body, &update); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProduct, err)
+	}
+	if _, err := c.Upsert(&update); err != nil {
+		return err
+	}
+	c.logger.Debugw("Product catalog updated", "product", update.ProductName, "source", message.Source,
+		"producer", message.Producer)
+	return nil
+}
+
+// fromProductRow converts a stored catalog entry
+func fromProductRow(row repository.Product) Product {
+	product := Product{
+		ProductName: row.ProductName,
+		Brand:       row.Brand,
+		Category:    row.Category,
+		Attributes:  json.RawMessage(row.Attributes),
+		UpdatedAt:   row.UpdatedAt,
+	}
+	if row.LaunchDate.Valid {
+		launchDate := row.LaunchDate.Time
+		product.LaunchDate = &launchDate
+	}
+	return product
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidPromotion is returned when a promotion fails validation
+var ErrInvalidPromotion = errors.New("invalid promotion")
+
+// Promotion is a planned promotion of a product, or of every product in a category when
+// product_name is empty. starts_on and ends_on are inclusive
+type Promotion struct {
+	ID                 int64     `json:"id"`
+	ProductName        string    `json:"product_name,omitempty"`
+	Category           string    `json:"category,omitempty"`
+	DiscountPercentage float64   `json:"discount_percentage"`
+	StartsOn           time.Time `json:"starts_on"`
+	EndsOn             time.Time `json:"ends_on"`
+	Description        string    `json:"description,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// PromotionFilter narrows the promotion calendar; empty fields match everything
+type PromotionFilter struct {
+	ProductName string
+	Category    string
+	// From and To select promotions overlapping the dates between them, both inclusive
+	From time.Time
+	To   time.Time
+}
+
+// PromotionStore holds the promotion calendar. PostgresRepository implements it
+type PromotionStore interface {
+	ListPromotions(filter repository.PromotionFilter, limit, offset int) ([]repository.Promotion, int, error)
+	AllPromotions() ([]repository.Promotion, error)
+	GetPromotion(id int64) (*repository.Promotion, error)
+	CreatePromotion(p *repository.Promotion) (int64, error)
+	UpdatePromotion(p *repository.Promotion) (bool, error)
+	DeletePromotion(id int64) (bool, error)
+}
+
+// Promotions manages the calendar of planned promotions. Predictions read it through the feature
+// resolution of MLPredictionService, and training through the promotions file passed to the script
+type Promotions struct {
+	postgresRepo PromotionStore
+	logger       *zap.SugaredLogger
+}
+
+// NewPromotions creates a new promotion calendar
+func NewPromotions(postgresRepo PromotionStore, logger *zap.SugaredLogger) *Promotions {
+	return &Promotions{
+		postgresRepo: postgresRepo,
+		logger:       logger,
+	}
+}
+
+// Create validates and stores a promotion
+func (p *Promotions) Create(promotion *Promotion) (*Promotion, error) {
+	if err := validatePromotion(promotion); err != nil {
+		return nil, err
+	}
+	id, err := p.postgresRepo.CreatePromotion(toPromotionRow(promotion))
+	if err != nil {
+		return nil, err
+	}
+	p.logger.Infow("Promotion created", "id", id, "product", promotion.ProductName, "category", promotion.Category)
+	return p.Get(id)
+}
+
+// Get returns a promotion, or nil if it does not exist
+func (p *Promotions) Get(id int64) (*Promotion, error) {
+	row, err := p.postgresRepo.GetPromotion(id)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	promotion := Promotion(*row)
+	return &promotion, nil
+}
+
+// Update validates and replaces a promotion, returning nil if it does not exist
+func (p *Promotions) Update(promotion *Promotion) (*Promotion, error) {
+	if err := validatePromotion(promotion); err != nil {
+		return nil, err
+	}
+	found, err := p.postgresRepo.UpdatePromotion(toPromotionRow(promotion))
+	if err != nil || !found {
+		return nil, err
+	}
+	p.logger.Infow("Promotion updated", "id", promotion.ID, "product", promotion.ProductName, "category", promotion.Category)
+	return p.Get(promotion.ID)
+}
+
+// Delete removes a promotion and reports whether it existed
+func (p *Promotions) Delete(id int64) (bool, error) {
+	deleted, err := p.postgresRepo.DeletePromotion(id)
+	if err == nil && deleted {
+		p.logger.Infow("Promotion deleted", "id", id)
+	}
+	return deleted, err
+}
+
+// List returns a page of promotions matching the filter, ordered by start date, and the total
+// number of matching promotions
+func (p *Promotions) List(filter PromotionFilter, limit, offset int) ([]Promotion, int, error) {
+	rows, total, err := p.postgresRepo.ListPromotions(repository.PromotionFilter(filter), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	promotions := make([]Promotion, 0, len(rows))
+	for _, row := range rows {
+		promotions = append(promotions, Promotion(row))
+	}
+	return promotions, total, nil
+}
+
+// validatePromotion checks that a promotion targets something, has a sensible discount and does
+// not end before it starts
+func validatePromotion(promotion *Promotion) error {
+	if promotion.ProductName == "" && promotion.Category == "" {
+		return fmt.Errorf("%w: product_name or category is required", ErrInvalidPromotion)
+	}
+	if promotion.DiscountPercentage <= 0 || promotion.DiscountPercentage > 100 {
+		return fmt.Errorf("%w: discount_percentage must be greater than 0 and at most 100", ErrInvalidPromotion)
+	}
+	if promotion.EndsOn.Before(promotion.StartsOn) {
+		return fmt.Errorf("%w: ends_on is before starts_on", ErrInvalidPromotion)
+	}
+	return nil
+}
+
+// toPromotionRow converts a promotion to its repository form
+func toPromotionRow(promotion *Promotion) *repository.Promotion {
+	return &repository.Promotion{
+		ID:                 promotion.ID,
+		ProductName:        promotion.ProductName,
+		Category:           promotion.Category,
+		DiscountPercentage: promotion.DiscountPercentage,
+		StartsOn:           promotion.StartsOn,
+		EndsOn:             promotion.EndsOn,
+		Description:        promotion.Description,
+	}
+}
+
+// promotionRecord is a promotion as the training script reads it
+type promotionRecord struct {
+	ProductName        string  `json:"product_name"`
+	Category           string  `json:"category"`
+	DiscountPercentage float64 `json:"discount_percentage"`
+	StartsOn           string  `json:"starts_on"`
+	EndsOn             string  `json:"ends_on"`
+}
+
+// writePromotionsFile writes every promotion to a file in the run directory of the training script,
+// which derives the promotion features of the training rows from it
+func writePromotionsFile(postgresRepo PredictionStore, runDir string) (string, error) {
+	rows, err := postgresRepo.AllPromotions()
+	if err != nil {
+		return "", err
+	}
+	records := make([]promotionRecord, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, promotionRecord{
+			ProductName:        row.ProductName,
+			Category:           row.Category,
+			DiscountPercentage: row.DiscountPercentage,
+			StartsOn:           row.StartsOn.Format("2006-01-02"),
+			EndsOn:             row.EndsOn.Format("2006-01-02"),
+		})
+	}
+
+	path := filepath.Join(runDir, "promotions.json")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("error creating promotions file: %v", err)
+	}
+	if err := json.NewEncoder(file).Encode(records); err != nil {
+		file.Close()
+		return "", fmt.Errorf("error writing promotions file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("error writing promotions file: %v", err)
+	}
+	return path, nil
+}
+
+// featurePromotions converts stored promotions to the input of features.ApplyPromotions
+func featurePromotions(rows []repository.Promotion) []features.Promotion {
+	promotions := make([]features.Promotion, 0, len(rows))
+	for _, row := range rows {
+		promotions = append(promotions, features.Promotion{
+			ProductName:        row.ProductName,
+			Category:           row.Category,
+			DiscountPercentage: row.DiscountPercentage,
+			StartsOn:           row.StartsOn,
+			EndsOn:             row.EndsOn,
+		})
+	}
+	return promotions
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// pythonScriptPath is the model script shared by training and the Python inference engine
+const pythonScriptPath = "scripts/lightGBM_model.py"
+
+// PythonInferenceEngine runs predictions by starting the model script for every call.
+// The scheduler bounds the prediction processes running at once and orders callers by priority
+type PythonInferenceEngine struct {
+	fileRepo       *repository.FileRepository
+	scriptPath     string
+	processMetrics *ProcessMetrics
+	scheduler      *InferenceScheduler
+}
+
+// NewPythonInferenceEngine creates an inference engine backed by Python subprocesses
+func NewPythonInferenceEngine(fileRepo *repository.FileRepository, processMetrics *ProcessMetrics, scheduler *InferenceScheduler) *PythonInferenceEngine {
+	return &PythonInferenceEngine{
+		fileRepo:       fileRepo,
+		scriptPath:     pythonScriptPath,
+		processMetrics: processMetrics,
+		scheduler:      scheduler,
+	}
+}
+
+// Predict runs the Python model on a fully resolved request
+func (e *PythonInferenceEngine) Predict(ctx context.Context, request *PredictionRequest) (*PredictionResult, error) {
+	// Check if the script exists
+	if !e.fileRepo.FileExists(e.scriptPath) {
+		return nil, fmt.Errorf("python script not found: %s", e.scriptPath)
+	}
+	if err := checkModelCompatibility(e.fileRepo); err != nil {
+		return nil, err
+	}
+	return e.predict(ctx, request, e.fileRepo.GetModelPath())
+}
+
+// PredictWithModels runs the models staged in modelDir instead of the installed ones
+func (e *PythonInferenceEngine) PredictWithModels(ctx context.Context, request *PredictionRequest, modelDir string) (*PredictionResult, error) {
+	if !e.fileRepo.FileExists(e.scriptPath) {
+		return nil, fmt.Errorf("python script not found: %s", e.scriptPath)
+	}
+	data, err := e.fileRepo.ReadStagedFile(modelDir, featureInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFeatureInfo(data); err != nil {
+		return nil, err
+	}
+	return e.predict(ctx, request, modelDir)
+}
+
+// predict runs the script on a single request with the models in modelDir
+func (e *PythonInferenceEngine) predict(ctx context.Context, request *PredictionRequest, modelDir string) (*PredictionResult, error) {
+
+	// Convert request to JSON
+	buf := getJSONBuffer(1)
+	err := encodeJSON(buf, request)
+	requestJSON := buf.String()
+	putJSONBuffer(buf)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling prediction request: %v", err)
+	}
+
+	release, err := e.scheduler.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Run Python script to make prediction
+	output, _, err := runPythonScript(ctx, e.fileRepo, e.scriptPath, e.processMetrics, "predict", requestJSON,
+		"--model-dir", modelDir)
+	if err != nil {
+		return nil, fmt.Errorf("error making prediction: %w", err)
+	}
+
+	// Extract JSON from the output
+	jsonStr, err := extractJSON(output)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting JSON from output: %v", err)
+	}
+
+	// Parse the output to get prediction results
+	var result PredictionResult
+	if err := json.Unmarshal([]byte(jsonStr), &result); err != nil {
+		return nil, fmt.Errorf("error parsing prediction results: %v", err)
+	}
+
+	return &result, nil
+}
+
+// PredictBatch runs the Python model once for many fully resolved requests.
+// Results are returned in the same order as the requests.
+func (e *PythonInferenceEngine) PredictBatch(ctx context.Context, requests []*PredictionRequest) ([]PredictionResult, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	if !e.fileRepo.FileExists(e.scriptPath) {
+		return nil, fmt.Errorf("python script not found: %s", e.scriptPath)
+	}
+	// The script reloads the models on every call, so they are checked before every batch
+	if err := checkModelCompatibility(e.fileRepo); err != nil {
+		return nil, err
+	}
+	return e.predictBatch(ctx, requests, e.fileRepo.GetModelPath())
+}
+
+// PredictBatchWithModels runs the models staged in modelDir on many requests
+func (e *PythonInferenceEngine) PredictBatchWithModels(ctx context.Context, requests []*PredictionRequest, modelDir string) ([]PredictionResult, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	if !e.fileRepo.FileExists(e.scriptPath) {
+		return nil, fmt.Errorf("python script not found: %s", e.scriptPath)
+	}
+	data, err := e.fileRepo.ReadStagedFile(modelDir, featureInfoFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFeatureInfo(data); err != nil {
+		return nil, err
+	}
+	return e.predictBatch(ctx, requests, modelDir)
+}
+
+// predictBatch runs the script once on many requests with the models in modelDir
+func (e *PythonInferenceEngine) predictBatch(ctx context.Context, requests []*PredictionRequest, modelDir string) ([]PredictionResult, error) {
+	// Batch input is passed through files since it does not fit on a command line; they live in a
+	// run directory of this batch only
+	runDir, err := e.fileRepo.CreateRunDir()
+	if err != nil {
+		return nil, err
+	}
+	defer e.fileRepo.RemoveRunDir(runDir)
+	inputFile, err := os.Create(filepath.Join(runDir, "input.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating batch input file: %v", err)
+	}
+
+	if err := json.NewEncoder(inputFile).Encode(requests); err != nil {
+		inputFile.Close()
+		return nil, fmt.Errorf("error writing batch input file: %v", err)
+	}
+	if err := inputFile.Close(); err != nil {
+		return nil, fmt.Errorf("error writing batch input file: %v", err)
+	}
+
+	outputPath := filepath.Join(runDir, "output.json")
+
+	release, err := e.scheduler.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	output, _, err := runPythonScript(ctx, e.fileRepo, e.scriptPath, e.processMetrics, "predict_batch", inputFile.Name(),
+		"--model-dir", modelDir, "--output", outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error making batch prediction: %w", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading batch prediction results: %v\n\nOutput: %s", err, output)
+	}
+
+	var batch struct {
+		Predictions []PredictionResult `json:"predictions"`
+	}
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("error parsing batch prediction results: %v", err)
+	}
+	if len(batch.Predictions) != len(requests) {
+		return nil, fmt.Errorf("batch prediction returned %d results for %d requests", len(batch.Predictions), len(requests))
+	}
+
+	return batch.Predictions, nil
+}
+
+// Explain runs the script on a fully resolved request to compute the SHAP contributions of its
+// features with the installed models
+func (e *PythonInferenceEngine) Explain(ctx context.Context, request *PredictionRequest) (*PredictionExplanation, error) {
+	if !e.fileRepo.FileExists(e.scriptPath) {
+		return nil, fmt.Errorf("python script not found: %s", e.scriptPath)
+	}
+	if err := checkModelCompatibility(e.fileRepo); err != nil {
+		return nil, err
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling explanation request: %v", err)
+	}
+
+	release, err := e.scheduler.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	output, _, err := runPythonScript(ctx, e.fileRepo, e.scriptPath, e.processMetrics, "explain", string(requestJSON),
+		"--model-dir", e.fileRepo.GetModelPath())
+	if err != nil {
+		return nil, fmt.Errorf("error explaining prediction: %w", err)
+	}
+
+	jsonStr, err := extractJSON(output)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting JSON from output: %v", err)
+	}
+	var explanation PredictionExplanation
+	if err := json.Unmarshal([]byte(jsonStr), &explanation); err != nil {
+		return nil, fmt.Errorf("error parsing prediction explanation: %v", err)
+	}
+	return &explanation, nil
+}
+
+// Load checks that the model artifacts are installed, compatible with the feature builder and that
+// their encoders are readable.
+// The script reads them on every call, so there is nothing to keep in memory.
+func (e *PythonInferenceEngine) Load(ctx context.Context) error {
+	modelDir := e.fileRepo.GetModelPath()
+	artifacts, err := installedArtifacts(e.fileRepo)
+	if err != nil {
+		return err
+	}
+	for _, name := range artifacts {
+		if !e.fileRepo.FileExists(filepath.Join(modelDir, name)) {
+			return fmt.Errorf("model artifact not found: %s", name)
+		}
+	}
+	if err := checkModelCompatibility(e.fileRepo); err != nil {
+		return err
+	}
+	_, err = readEncoders(e.fileRepo, modelDir)
+	return err
+}
+
+// Health reports whether the script and the model artifacts are in place
+func (e *PythonInferenceEngine) Health(ctx context.Context) error {
+	if !e.fileRepo.FileExists(e.scriptPath) {
+		return fmt.Errorf("python script not found: %s", e.scriptPath)
+	}
+	return e.Load(ctx)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/pyenv"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// Python environment check modes
+const (
+	PythonEnvCheckStrict = "strict"
+	PythonEnvCheckWarn   = "warn"
+	PythonEnvCheckOff    = "off"
+)
+
+// envProbeScriptPath is the script reporting the installed Python package versions
+const envProbeScriptPath = "scripts/env_probe.py"
+
+// ErrPythonEnvMismatch is returned when the installed Python packages do not match the required manifest
+var ErrPythonEnvMismatch = errors.New("python environment does not match the required packages")
+
+// PythonEnvReport describes the Python environment used to train and serve models
+type PythonEnvReport struct {
+	Python string `json:"python"`
+	// Packages maps every required package to its installed version, empty when missing
+	Packages   map[string]string `json:"packages"`
+	Mismatches []pyenv.Mismatch  `json:"mismatches,omitempty"`
+}
+
+// PythonEnvironment verifies the installed Python packages against the manifest embedded in the binary,
+// so that models are never trained or loaded with a lightgbm version producing incompatible pkl files
+type PythonEnvironment struct {
+	fileRepo     *repository.FileRepository
+	requirements []pyenv.Requirement
+}
+
+// NewPythonEnvironment creates a Python environment verifier from a requirements.txt manifest
+func NewPythonEnvironment(fileRepo *repository.FileRepository, manifest string) (*PythonEnvironment, error) {
+	requirements, err := pyenv.ParseRequirements(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Python requirements manifest: %v", err)
+	}
+
+	return &PythonEnvironment{
+		fileRepo:     fileRepo,
+		requirements: requirements,
+	}, nil
+}
+
+// Probe runs the environment probe and compares the installed versions with the manifest
+func (e *PythonEnvironment) Probe(ctx context.Context) (*PythonEnvReport, error) {
+	output, err := e.fileRepo.RunPythonScript(ctx, envProbeScriptPath, pyenv.Names(e.requirements)...)
+	if err != nil {
+		return nil, fmt.Errorf("error running environment probe: %v\n\nOutput: %s", err, output)
+	}
+
+	jsonStr, err := extractJSON(output)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing environment probe output: %v", err)
+	}
+
+	var probe struct {
+		Python   string             `json:"python"`
+		Packages map[string]*string `json:"packages"`
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &probe); err != nil {
+		return nil, fmt.Errorf("error parsing environment probe JSON: %v", err)
+	}
+
+	report := &PythonEnvReport{
+		Python:   probe.Python,
+		Packages: make(map[string]string, len(probe.Packages)),
+	}
+	for name, version := range probe.Packages {
+		if version != nil {
+			report.Packages[name] = *version
+		}
+	}
+	report.Mismatches = pyenv.Verify(e.requirements, report.Packages)
+
+	return report, nil
+}
+
+// Check reports an error when the probe fails or the environment does not match the manifest
+func (e *PythonEnvironment) Check(ctx context.Context) error {
+	report, err := e.Probe(ctx)
+	if err != nil {
+		return err
+	}
+	if len(report.Mismatches) == 0 {
+		return nil
+	}
+
+	details := make([]string, 0, len(report.Mismatches))
+	for _, m := range report.Mismatches {
+		details = append(details, m.String())
+	}
+	return fmt.Errorf("%w: %s", ErrPythonEnvMismatch, strings.Join(details, "; "))
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// MaxQueueWeight is the largest weight of an ingestion queue
+const MaxQueueWeight = 100
+
+// Errors returned when changing queue weights
+var (
+	ErrQueueNotFound      = errors.New("queue is not consumed")
+	ErrInvalidQueueWeight = errors.New("invalid queue weight")
+)
+
+// QueueWeight is the consumption weight of an ingestion queue and where it comes from. Queues with
+// messages waiting take turns in proportion to their weights; weight 0 pauses the queue
+type QueueWeight struct {
+	Queue     string     `json:"queue"`
+	Weight    int        `json:"weight"`
+	Source    string     `json:"source"`
+	UpdatedBy string     `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// QueueWeightStore holds the queue weights stored over the configured defaults. PostgresRepository
+// implements it
+type QueueWeightStore interface {
+	ListQueueWeights() ([]repository.QueueWeight, error)
+	SaveQueueWeight(w *repository.QueueWeight) error
+	DeleteQueueWeight(queue string) (bool, error)
+}
+
+// QueueWeights holds the weights of the consumed ingestion queues. Defaults come from the
+// configuration and weights stored in the database override them; the stored weights are reloaded
+// periodically like feature flags, so a change made on one replica reaches the others within the
+// refresh interval
+type QueueWeights struct {
+	postgresRepo QueueWeightStore
+	defaults     map[string]int
+	interval     time.Duration
+	logger       *zap.SugaredLogger
+
+	mu     sync.RWMutex
+	stored map[string]repository.QueueWeight
+}
+
+// NewQueueWeights creates the weights of the consumed queues from their configured defaults,
+// refusing weights outside 0-100
+func NewQueueWeights(postgresRepo QueueWeightStore, configured map[string]int, interval time.Duration, logger *zap.SugaredLogger) (*QueueWeights, error) {
+	defaults := make(map[string]int, len(configured))
+	for queue, weight := range configured {
+		if err := validateQueueWeight(weight); err != nil {
+			return nil, fmt.Errorf("queue %s: %w", queue, err)
+		}
+		defaults[queue] = weight
+	}
+
+	return &QueueWeights{
+		postgresRepo: postgresRepo,
+		defaults:     defaults,
+		interval:     interval,
+		logger:       logger,
+		stored:       map[string]repository.QueueWeight{},
+	}, nil
+}
+
+// Start reloads the stored weights until the context is cancelled
+func (q *QueueWeights) Start(ctx context.Context) {
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := q.Refresh(); err != nil {
+				q.logger.Errorw("Failed to reload queue weights", "error", err)
+			}
+		}
+	}
+}
+
+// Refresh reloads the weights stored in the database. Weights of queues this replica does not
+// consume are ignored
+func (q *QueueWeights) Refresh() error {
+	weights, err := q.postgresRepo.ListQueueWeights()
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[string]repository.QueueWeight, len(weights))
+	for _, weight := range weights {
+		if _, ok := q.defaults[weight.Queue]; ok {
+			stored[weight.Queue] = weight
+		}
+	}
+
+	q.mu.Lock()
+	q.stored = stored
+	q.mu.Unlock()
+	return nil
+}
+
+// Queues returns the consumed queues, ordered by name
+func (q *QueueWeights) Queues() []string {
+	queues := make([]string, 0, len(q.defaults))
+	for queue := range q.defaults {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+// Weight returns the current weight of a queue, 0 for a queue that is not consumed
+func (q *QueueWeights) Weight(queue string) int {
+	weight, _ := q.Get(queue)
+	return weight.Weight
+}
+
+// Get returns a queue with its current weight
+func (q *QueueWeights) Get(queue string) (QueueWeight, bool) {
+	weight, ok := q.defaults[queue]
+	if !ok {
+		return QueueWeight{}, false
+	}
+	result := QueueWeight{Queue: queue, Weight: weight, Source: FlagSourceEnv}
+
+	q.mu.RLock()
+	stored, ok := q.stored[queue]
+	q.mu.RUnlock()
+	if ok {
+		updatedAt := stored.UpdatedAt
+		result.Weight = stored.Weight
+		result.Source = FlagSourceDatabase
+		result.UpdatedBy = stored.UpdatedBy
+		result.UpdatedAt = &updatedAt
+	}
+	return result, true
+}
+
+// List returns every consumed queue with its current weight, ordered by name
+func (q *QueueWeights) List() []QueueWeight {
+	weights := make([]QueueWeight, 0, len(q.defaults))
+	for _, queue := range q.Queues() {
+		weight, _ := q.Get(queue)
+		weights = append(weights, weight)
+	}
+	return weights
+}
+
+// Set stores the weight of a queue, overriding its default on every replica
+func (q *QueueWeights) Set(queue string, weight int, caller string) (QueueWeight, error) {
+	if _, ok := q.defaults[queue]; !ok {
+		return QueueWeight{}, ErrQueueNotFound
+	}
+	if err := validateQueueWeight(weight); err != nil {
+		return QueueWeight{}, err
+	}
+
+	stored := repository.QueueWeight{
+		Queue:     queue,
+		Weight:    weight,
+		UpdatedBy: caller,
+		UpdatedAt: time.Now(),
+	}
+	if err := q.postgresRepo.SaveQueueWeight(&stored); err != nil {
+		return QueueWeight{}, err
+	}
+
+	q.mu.Lock()
+	q.stored[queue] = stored
+	q.mu.Unlock()
+
+	result, _ := q.Get(queue)
+	return result, nil
+}
+
+// Reset removes the stored weight of a queue, returning it to its configured default
+func (q *QueueWeights) Reset(queue string) (QueueWeight, error) {
+	if _, ok := q.defaults[queue]; !ok {
+		return QueueWeight{}, ErrQueueNotFound
+	}
+	if _, err := q.postgresRepo.DeleteQueueWeight(queue); err != nil {
+		return QueueWeight{}, err
+	}
+
+	q.mu.Lock()
+	delete(q.stored, queue)
+	q.mu.Unlock()
+
+	result, _ := q.Get(queue)
+	return result, nil
+}
+
+// validateQueueWeight checks that a weight is within 0-100
+func validateQueueWeight(weight int) error {
+	if weight < 0 || weight > MaxQueueWeight {
+		return fmt.Errorf("%w: %d is outside 0-%d", ErrInvalidQueueWeight, weight, MaxQueueWeight)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// z-score of the 90th percentile of the standard normal distribution
+	p90ZScore = 1.2816
+	// Days of daily sales history used to estimate demand variability
+	demandHistoryDays = 28
+)
+
+// RestockParams controls the restock recommendation list
+type RestockParams struct {
+	Limit      int
+	WindowDays int
+}
+
+// RestockRecommendation describes a product predicted to stock out within the forecast horizon
+type RestockRecommendation struct {
+	ProductName         string    `json:"product_name"`
+	Region              string    `json:"region"`
+	Seller              string    `json:"seller"`
+	ForecastAt          time.Time `json:"forecast_at"`
+	StockLevel          float64   `json:"stock_level"`
+	PredictedSales      float64   `json:"predicted_sales"`
+	P90Demand           float64   `json:"p90_demand"`
+	DaysUntilStockout   float64   `json:"days_until_stockout"`
+	SuggestedReorderQty int       `json:"suggested_reorder_qty"`
+	HorizonDays         int       `json:"horizon_days"`
+	DemandHistoryDays   int       `json:"demand_history_days"`
+	ObservedHistoryDays int       `json:"observed_history_days"`
+}
+
+// ErrInvalidMarkdownRequest is returned when a markdown request cannot be evaluated
+var ErrInvalidMarkdownRequest = errors.New("invalid markdown request")
+
+// MarkdownRequest describes the markdown search to perform
+type MarkdownRequest struct {
+	// Products to evaluate; when empty, overstocked products with recent forecasts are used
+	Products []SimulationProduct `json:"products,omitempty" binding:"dive"`
+	// ClearBy is the date by which stock should be reduced to TargetStock
+	ClearBy     time.Time `json:"clear_by" binding:"required"`
+	TargetStock float64   `json:"target_stock"`
+	MaxDiscount float64   `json:"max_discount,omitempty"`
+	Step        float64   `json:"step,omitempty"`
+}
+
+// MarkdownRecommendation describes the smallest markdown projected to clear a product's stock
+type MarkdownRecommendation struct {
+	ProductName  string  `json:"product_name"`
+	Region       string  `json:"region"`
+	Seller       string  `json:"seller"`
+	StockLevel   float64 `json:"stock_level"`
+	TargetStock  float64 `json:"target_stock"`
+	DaysToClear  int     `json:"days_to_clear"`
+	CurrentPrice float64 `json:"current_price"`
+	// Achievable is false when even the maximum discount is not projected to clear the stock
+	Achievable          bool    `json:"achievable"`
+	RecommendedDiscount float64 `json:"recommended_discount"`
+	RecommendedPrice    float64 `json:"recommended_price"`
+	ProjectedSales      float64 `json:"projected_sales"`
+	BaselineSales       float64 `json:"baseline_sales"`
+}
+
+// RecommendationStore provides the stock positions and regional sales that recommendations are
+// made from. PostgresRepository implements it
+type RecommendationStore interface {
+	GetStockPositions(since time.Time, historyDays int) ([]repository.StockPosition, error)
+	HasProductInRegion(productName, region string) (bool, error)
+	GetRegionCategoryStats(category string, regions []string, windowDays int) ([]repository.RegionCategoryStats, error)
+}
+
+// RecommendationService turns forecasts into operational recommendations
+type RecommendationService struct {
+	mlService    *MLPredictionService
+	postgresRepo RecommendationStore
+	logger       *zap.SugaredLogger
+}
+
+// NewRecommendationService creates a new recommendation service
+func NewRecommendationService(mlService *MLPredictionService, postgresRepo RecommendationStore, logger *zap.SugaredLogger) *RecommendationService {
+	return &RecommendationService{
+		mlService:    mlService,
+		postgresRepo: postgresRepo,
+		logger:       logger,
+	}
+}
+
+// Restock lists products whose P90 demand over the forecast horizon exceeds their current stock.
+// P90 demand is the point forecast plus the 90th percentile of the daily sales variability
+// accumulated over the horizon; the suggested reorder quantity covers the shortfall.
+func (s *RecommendationService) Restock(params RestockParams) ([]RestockRecommendation, error) {
+	since := time.Now().AddDate(0, 0, -params.WindowDays)
+	positions, err := s.postgresRepo.GetStockPositions(since, demandHistoryDays)
+	if err != nil {
+		return nil, err
+	}
+
+	var recommendations []RestockRecommendation
+	for _, p := range positions {
+		predicted := math.Max(p.PredictedSales, 0)
+		p90 := predicted + p90ZScore*p.SalesStdDev*math.Sqrt(salesForecastDays)
+		if p90 <= p.StockLevel {
+			continue
+		}
+
+		daysUntilStockout := float64(salesForecastDays)
+		if predicted > 0 {
+			daysUntilStockout = math.Min(p.StockLevel/(predicted/salesForecastDays), salesForecastDays)
+		}
+
+		recommendations = append(recommendations, RestockRecommendation{
+			ProductName:         p.ProductName,
+			Region:              p.Region,
+			Seller:              p.Seller,
+			ForecastAt:          p.ForecastAt,
+			StockLevel:          p.StockLevel,
+			PredictedSales:      p.PredictedSales,
+			P90Demand:           p90,
+			DaysUntilStockout:   daysUntilStockout,
+			SuggestedReorderQty: int(math.Ceil(p90 - p.StockLevel)),
+			HorizonDays:         salesForecastDays,
+			DemandHistoryDays:   demandHistoryDays,
+			ObservedHistoryDays: p.ObservedDays,
+		})
+	}
+
+	// Most urgent first
+	sort.Slice(recommendations, func(i, j int) bool {
+		return recommendations[i].DaysUntilStockout < recommendations[j].DaysUntilStockout
+	})
+
+	if len(recommendations) > params.Limit {
+		recommendations = recommendations[:params.Limit]
+	}
+	return recommendations, nil
+}
+
+// Markdown searches discount levels through the sales model and returns, per overstocked product,
+// the smallest discount projected to sell the stock down to the target by the clear-by date.
+// Products that are not overstocked at their current price are left out.
+func (s *RecommendationService) Markdown(ctx context.Context, request *MarkdownRequest) ([]MarkdownRecommendation, error) {
+	if request.MaxDiscount <= 0 {
+		request.MaxDiscount = 70
+	}
+	if request.Step <= 0 {
+		request.Step = 5
+	}
+	if request.MaxDiscount >= 100 {
+		return nil, fmt.Errorf("%w: max_discount must be below 100", ErrInvalidMarkdownRequest)
+	}
+
+	now := time.Now()
+	daysToClear := int(math.Ceil(request.ClearBy.Sub(now).Hours() / 24))
+	if daysToClear <= 0 {
+		return nil, fmt.Errorf("%w: clear_by must be in the future", ErrInvalidMarkdownRequest)
+	}
+
+	products := request.Products
+	if len(products) == 0 {
+		var err error
+		if products, err = s.overstockedProducts(daysToClear, request.TargetStock); err != nil {
+			return nil, err
+		}
+	}
+
+	var discounts []float64
+	for d := 0.0; d <= request.MaxDiscount+1e-9; d += request.Step {
+		discounts = append(discounts, d)
+	}
+
+	// Build one scenario per product and discount level and predict them in a single pass; the
+	// scenarios share one allocation
+	bases := make([]*PredictionRequest, len(products))
+	block := make([]PredictionRequest, 0, len(products)*len(discounts))
+	scenarios := make([]*PredictionRequest, 0, cap(block))
+	for i, product := range products {
+		resolved, err := s.mlService.resolveFeatures(ctx, &PredictionRequestMinimal{
+			ProductName: product.ProductName,
+			Region:      product.Region,
+			Seller:      product.Seller,
+		})
+		if err != nil {
+			return nil, err
+		}
+		base := resolved.request
+		bases[i] = base
+
+		originalPrice := base.OriginalPrice
+		if originalPrice <= 0 {
+			originalPrice = base.Price
+		}
+		for _, discount := range discounts {
+			block = append(block, *base)
+			scenario := &block[len(block)-1]
+			scenario.OriginalPrice = originalPrice
+			scenario.Price = originalPrice * (1 - discount/100)
+			scenario.DiscountPercentage = discount
+			scenarios = append(scenarios, scenario)
+		}
+	}
+
+	predictions, err := s.mlService.engine.PredictBatch(ctx, scenarios)
+	if err != nil {
+		return nil, err
+	}
+
+	var recommendations []MarkdownRecommendation
+	for i, product := range products {
+		base := bases[i]
+		toSell := base.StockLevel - request.TargetStock
+		projected := func(j int) float64 {
+			daily := math.Max(predictions[i*len(discounts)+j].PredictedSales, 0) / salesForecastDays
+			return daily * float64(daysToClear)
+		}
+
+		// Not overstocked: the current price already clears the stock in time
+		if toSell <= 0 || projected(0) >= toSell {
+			continue
+		}
+
+		rec := MarkdownRecommendation{
+			ProductName:   product.ProductName,
+			Region:        product.Region,
+			Seller:        product.Seller,
+			StockLevel:    base.StockLevel,
+			TargetStock:   request.TargetStock,
+			DaysToClear:   daysToClear,
+			CurrentPrice:  base.Price,
+			BaselineSales: projected(0),
+		}
+		for j, discount := range discounts {
+			scenario := scenarios[i*len(discounts)+j]
+			rec.RecommendedDiscount = discount
+			rec.RecommendedPrice = scenario.Price
+			rec.ProjectedSales = projected(j)
+			if rec.ProjectedSales >= toSell {
+				rec.Achievable = true
+				break
+			}
+		}
+		recommendations = append(recommendations, rec)
+	}
+
+	return recommendations, nil
+}
+
+// overstockedProducts returns products with recent forecasts whose forecasted demand until the
+// clear-by date does not cover their stock above the target
+func (s *RecommendationService) overstockedProducts(daysToClear int, targetStock float64) ([]SimulationProduct, error) {
+	positions, err := s.postgresRepo.GetStockPositions(time.Now().AddDate(0, 0, -7), demandHistoryDays)
+	if err != nil {
+		return nil, err
+	}
+
+	var products []SimulationProduct
+	for _, p := range positions {
+		demand := math.Max(p.PredictedSales, 0) / salesForecastDays * float64(daysToClear)
+		if p.StockLevel-targetStock > demand {
+			products = append(products, SimulationProduct{
+				ProductName: p.ProductName,
+				Region:      p.Region,
+				Seller:      p.Seller,
+			})
+		}
+	}
+	return products, nil
+}
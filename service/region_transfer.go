@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+const (
+	// Days of processed data, up to its latest date, behind the regional scaling factors
+	regionTransferWindowDays = 90
+	// Category rows each region needs for its average to be trusted
+	minRegionTransferRows = 30
+)
+
+var (
+	// ErrInvalidRegionTransfer is returned when a region transfer request fails validation
+	ErrInvalidRegionTransfer = errors.New("invalid region transfer request")
+	// ErrProductInRegion is returned when the product is already sold in the target region
+	ErrProductInRegion = errors.New("product already sold in target region")
+	// ErrNoRegionTransferBasis is returned when the product or its category lacks the data a
+	// transfer is estimated from
+	ErrNoRegionTransferBasis = errors.New("insufficient data for region transfer")
+)
+
+// RegionTransferRequest asks for the demand of a product in a region it is not sold in yet
+type RegionTransferRequest struct {
+	ProductName  string `json:"product_name" binding:"required"`
+	Seller       string `json:"seller" binding:"required"`
+	SourceRegion string `json:"source_region" binding:"required"`
+	TargetRegion string `json:"target_region" binding:"required"`
+}
+
+// RegionTransferEstimate is the estimated demand of a product in a new region
+type RegionTransferEstimate struct {
+	ProductName  string `json:"product_name"`
+	Seller       string `json:"seller"`
+	Category     string `json:"category"`
+	SourceRegion string `json:"source_region"`
+	TargetRegion string `json:"target_region"`
+	// SalesFactor is the average daily sales of the category in the target region divided by
+	// that in the source region, over the last WindowDays days of processed data
+	SalesFactor        float64 `json:"sales_factor"`
+	WindowDays         int     `json:"window_days"`
+	SourceCategoryRows int64   `json:"source_category_rows"`
+	TargetCategoryRows int64   `json:"target_category_rows"`
+	// Source predictions are those of the product where it is sold today
+	SourcePredictedPrice float64 `json:"source_predicted_price"`
+	SourcePredictedSales float64 `json:"source_predicted_sales"`
+	// Predicted price and sales in the target region, over the HorizonDays horizon of the models
+	PredictedPrice float64 `json:"predicted_price"`
+	PredictedSales float64 `json:"predicted_sales"`
+	HorizonDays    int     `json:"horizon_days"`
+	// Features are the transferred features the target predictions were made from
+	Features *PredictionRequest `json:"features"`
+}
+
+// RegionTransfer estimates the demand of a product in a region it is not sold in. The product's
+// features in the source region are moved to the target region with their sales history scaled by
+// how much more or less the product's category sells per product there, and both feature sets are
+// run through the models
+func (s *RecommendationService) RegionTransfer(ctx context.Context, request *RegionTransferRequest) (*RegionTransferEstimate, error) {
+	if request.SourceRegion == request.TargetRegion {
+		return nil, fmt.Errorf("%w: source_region and target_region must differ", ErrInvalidRegionTransfer)
+	}
+	inTarget, err := s.postgresRepo.HasProductInRegion(request.ProductName, request.TargetRegion)
+	if err != nil {
+		return nil, err
+	}
+	if inTarget {
+		return nil, fmt.Errorf("%w: %s already has processed data in %s, use the prediction endpoints",
+			ErrProductInRegion, request.ProductName, request.TargetRegion)
+	}
+
+	resolved, err := s.mlService.resolveFeatures(ctx, &PredictionRequestMinimal{
+		ProductName: request.ProductName,
+		Region:      request.SourceRegion,
+		Seller:      request.Seller,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resolved.historyDate == nil {
+		return nil, fmt.Errorf("%w: %s has no processed data in %s for seller %s",
+			ErrNoRegionTransferBasis, request.ProductName, request.SourceRegion, request.Seller)
+	}
+	source := resolved.request
+
+	factor, stats, err := s.regionSalesFactor(source.Category, request.SourceRegion, request.TargetRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	target := *source
+	target.Region = request.TargetRegion
+	target.SalesQuantityLag1 *= factor
+	target.SalesQuantityLag3 *= factor
+	target.SalesQuantityLag7 *= factor
+	target.SalesQuantityRollingMean3 *= factor
+	target.SalesQuantityRollingMean7 *= factor
+
+	predictions, err := s.mlService.engine.PredictBatch(ctx, []*PredictionRequest{source, &target})
+	if err != nil {
+		return nil, err
+	}
+
+	return &RegionTransferEstimate{
+		ProductName:          request.ProductName,
+		Seller:               request.Seller,
+		Category:             source.Category,
+		SourceRegion:         request.SourceRegion,
+		TargetRegion:         request.TargetRegion,
+		SalesFactor:          factor,
+		WindowDays:           regionTransferWindowDays,
+		SourceCategoryRows:   stats[request.SourceRegion].Rows,
+		TargetCategoryRows:   stats[request.TargetRegion].Rows,
+		SourcePredictedPrice: predictions[0].PredictedPrice,
+		SourcePredictedSales: predictions[0].PredictedSales,
+		PredictedPrice:       predictions[1].PredictedPrice,
+		PredictedSales:       predictions[1].PredictedSales,
+		HorizonDays:          salesForecastDays,
+		Features:             &target,
+	}, nil
+}
+
+// regionSalesFactor returns the ratio of the category's average daily sales in the target region
+// to that in the source region, with the stats of both regions by name
+func (s *RecommendationService) regionSalesFactor(category, sourceRegion, targetRegion string) (float64, map[string]repository.RegionCategoryStats, error) {
+	rows, err := s.postgresRepo.GetRegionCategoryStats(category, []string{sourceRegion, targetRegion}, regionTransferWindowDays)
+	if err != nil {
+		return 0, nil, err
+	}
+	stats := make(map[string]repository.RegionCategoryStats, len(rows))
+	for _, row := range rows {
+		stats[row.Region] = row
+	}
+
+	for _, region := range []string{sourceRegion, targetRegion} {
+		if stats[region].Rows < minRegionTransferRows {
+			return 0, nil, fmt.Errorf("%w: category %s has %d rows in %s over the last %d days, at least %d are needed",
+				ErrNoRegionTransferBasis, category, stats[region].Rows, region, regionTransferWindowDays, minRegionTransferRows)
+		}
+	}
+	if stats[sourceRegion].AvgSales <= 0 {
+		return 0, nil, fmt.Errorf("%w: category %s has no sales in %s over the last %d days",
+			ErrNoRegionTransferBasis, category, sourceRegion, regionTransferWindowDays)
+	}
+	return stats[targetRegion].AvgSales / stats[sourceRegion].AvgSales, stats, nil
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/httpclient"
+)
+
+// RemoteInferenceEngine serves predictions from an external model server.
+// It speaks the MLflow scoring protocol: records are posted to /invocations and
+// the server answers with one {predicted_price, predicted_sales} object per record.
+type RemoteInferenceEngine struct {
+	endpoint string
+	token    string
+	client   *httpclient.Client
+}
+
+// NewRemoteInferenceEngine creates an inference engine that calls the model server at endpoint
+// through client, which bounds and retries the calls. token is sent as a bearer token when not empty.
+func NewRemoteInferenceEngine(endpoint, token string, client *httpclient.Client) *RemoteInferenceEngine {
+	return &RemoteInferenceEngine{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		token:    token,
+		client:   client,
+	}
+}
+
+// Predict sends a single request to the model server
+func (e *RemoteInferenceEngine) Predict(ctx context.Context, request *PredictionRequest) (*PredictionResult, error) {
+	results, err := e.PredictBatch(ctx, []*PredictionRequest{request})
+	if err != nil {
+		return nil, err
+	}
+	return &results[0], nil
+}
+
+// PredictBatch sends all requests to the model server in one call
+func (e *RemoteInferenceEngine) PredictBatch(ctx context.Context, requests []*PredictionRequest) ([]PredictionResult, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	records, err := dataframeRecords(requests)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling prediction request: %v", err)
+	}
+	body, err := json.Marshal(map[string]any{"dataframe_records": records})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling prediction request: %v", err)
+	}
+
+	var response struct {
+		Predictions []PredictionResult `json:"predictions"`
+	}
+	if err := e.do(ctx, http.MethodPost, "/invocations", body, &response); err != nil {
+		return nil, fmt.Errorf("error making prediction: %w", err)
+	}
+	if len(response.Predictions) != len(requests) {
+		return nil, fmt.Errorf("model server returned %d results for %d requests", len(response.Predictions), len(requests))
+	}
+
+	return response.Predictions, nil
+}
+
+// dataframeRecords returns the records to score. A model server sees flat columns, so the features
+// of external providers are moved out of the nested external object into the record itself
+func dataframeRecords(requests []*PredictionRequest) (any, error) {
+	flatten := false
+	for _, request := range requests {
+		if len(request.External) > 0 {
+			flatten = true
+			break
+		}
+	}
+	if !flatten {
+		return requests, nil
+	}
+
+	records := make([]map[string]any, 0, len(requests))
+	for _, request := range requests {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return nil, err
+		}
+		var record map[string]any
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, err
+		}
+		delete(record, "external")
+		for name, value := range request.External {
+			record[name] = value
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Explain is not part of the scoring protocol
+func (e *RemoteInferenceEngine) Explain(ctx context.Context, request *PredictionRequest) (*PredictionExplanation, error) {
+	return nil, ErrExplainNotSupported
+}
+
+// Load does nothing: model deployment is owned by the model server
+func (e *RemoteInferenceEngine) Load(ctx context.Context) error {
+	return nil
+}
+
+// Health pings the model server
+func (e *RemoteInferenceEngine) Health(ctx context.Context) error {
+	return e.do(ctx, http.MethodGet, "/ping", nil, nil)
+}
+
+// do sends a request to the model server and decodes the JSON response into out when it is not nil
+func (e *RemoteInferenceEngine) do(ctx context.Context, method, path string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, e.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating model server request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if e.token != "" {
+		req.Header.Set("Authorization", "Bearer "+e.token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("model server request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("model server returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error parsing model server response: %v", err)
+	}
+	return nil
+}
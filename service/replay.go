@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// Number of recorded predictions a replay runs by default and at most
+const (
+	defaultReplayLimit = 100
+	maxReplayLimit     = 1000
+)
+
+// ErrInvalidReplayRequest is returned when a replay request fails validation
+var ErrInvalidReplayRequest = errors.New("invalid replay request")
+
+// ReplayRequest selects the recorded predictions to replay and what to replay them against: a model
+// version, run by the serving engine, or another engine backend running the installed models
+type ReplayRequest struct {
+	// Limit is the number of latest predictions replayed, default 100
+	Limit        int    `json:"limit"`
+	ModelVersion string `json:"model_version,omitempty"`
+	Engine       string `json:"engine,omitempty"`
+	// Tolerance is the largest absolute difference of price and sales that still matches
+	Tolerance float64 `json:"tolerance"`
+}
+
+// ReplayItem compares a recorded prediction with its replay
+type ReplayItem struct {
+	PredictionID int64            `json:"prediction_id"`
+	RecordedAt   time.Time        `json:"recorded_at"`
+	ProductName  string           `json:"product_name"`
+	Region       string           `json:"region"`
+	Seller       string           `json:"seller"`
+	Recorded     PredictionOutput `json:"recorded"`
+	Replayed     PredictionOutput `json:"replayed"`
+	// PriceDiff and SalesDiff are the replayed values minus the recorded ones
+	PriceDiff float64 `json:"price_diff"`
+	SalesDiff float64 `json:"sales_diff"`
+	Matches   bool    `json:"matches"`
+}
+
+// ReplayReport sums up the output deltas of a replay. The replayed predictions are those the
+// installed version made, so that the deltas come from the target alone
+type ReplayReport struct {
+	ModelVersion string `json:"model_version,omitempty"`
+	Engine       string `json:"engine,omitempty"`
+	// BaselineVersion is the installed version whose recorded predictions were replayed
+	BaselineVersion   string       `json:"baseline_version,omitempty"`
+	Tolerance         float64      `json:"tolerance"`
+	Replayed          int          `json:"replayed"`
+	Matches           int          `json:"matches"`
+	Mismatches        int          `json:"mismatches"`
+	MeanAbsPriceDiff  float64      `json:"mean_abs_price_diff"`
+	MeanAbsSalesDiff  float64      `json:"mean_abs_sales_diff"`
+	MaxAbsPriceDiff   float64      `json:"max_abs_price_diff"`
+	MaxAbsSalesDiff   float64      `json:"max_abs_sales_diff"`
+	DurationMs        int64        `json:"duration_ms"`
+	Items             []ReplayItem `json:"items"`
+	UnreadableEntries int          `json:"unreadable_entries,omitempty"`
+}
+
+// Replayer replays recorded prediction requests against another model version or inference engine,
+// to validate a version or an engine backend on real traffic before cutting over to it
+type Replayer struct {
+	mlService *MLPredictionService
+	// engines are the engine backends a replay can target, by INFERENCE_ENGINE name
+	engines map[string]InferenceEngine
+}
+
+// NewReplayer creates a replayer over the given engine backends
+func NewReplayer(mlService *MLPredictionService, engines map[string]InferenceEngine) *Replayer {
+	return &Replayer{
+		mlService: mlService,
+		engines:   engines,
+	}
+}
+
+// Engines returns the names of the engine backends a replay can target
+func (r *Replayer) Engines() []string {
+	names := make([]string, 0, len(r.engines))
+	for name := range r.engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate checks the request and fills in the default limit
+func (r *Replayer) validate(request *ReplayRequest) error {
+	if (request.ModelVersion == "") == (request.Engine == "") {
+		return fmt.Errorf("%w: set either model_version or engine", ErrInvalidReplayRequest)
+	}
+	if request.Engine != "" && r.engines[request.Engine] == nil {
+		return fmt.Errorf("%w: unknown engine %q, expected one of %v", ErrInvalidReplayRequest, request.Engine, r.Engines())
+	}
+	if request.Limit == 0 {
+		request.Limit = defaultReplayLimit
+	}
+	if request.Limit < 0 || request.Limit > maxReplayLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidReplayRequest, maxReplayLimit)
+	}
+	if request.Tolerance < 0 {
+		return fmt.Errorf("%w: tolerance must be non-negative", ErrInvalidReplayRequest)
+	}
+	return nil
+}
+
+// Replay runs the latest recorded predictions of the installed version through the target in one
+// batch and reports how far its outputs are from the recorded ones. Replays are not recorded in
+// the prediction log
+func (r *Replayer) Replay(ctx context.Context, request *ReplayRequest) (*ReplayReport, error) {
+	if err := r.validate(request); err != nil {
+		return nil, err
+	}
+	s := r.mlService
+	started := time.Now()
+
+	baselineVersion := s.ActiveModelVersion()
+	entries, err := s.postgresRepo.ListRecentPredictionLogs(request.Limit, baselineVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReplayReport{
+		ModelVersion:    request.ModelVersion,
+		Engine:          request.Engine,
+		BaselineVersion: baselineVersion,
+		Tolerance:       request.Tolerance,
+		Items:           []ReplayItem{},
+	}
+	replayed := make([]repository.PredictionLogEntry, 0, len(entries))
+	requests := make([]*PredictionRequest, 0, len(entries))
+	for _, entry := range entries {
+		var features PredictionRequest
+		if err := json.Unmarshal(entry.Features, &features); err != nil {
+			s.logger.Warnw("Skipping unreadable recorded features", "error", err, "prediction_id", entry.ID)
+			report.UnreadableEntries++
+			continue
+		}
+		replayed = append(replayed, entry)
+		requests = append(requests, &features)
+	}
+
+	results, err := r.predict(ctx, request, baselineVersion, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, entry := range replayed {
+		item := ReplayItem{
+			PredictionID: entry.ID,
+			RecordedAt:   entry.CreatedAt,
+			ProductName:  entry.ProductName,
+			Region:       entry.Region,
+			Seller:       entry.Seller,
+			Recorded:     PredictionOutput{Price: entry.PredictedPrice, Sales: entry.PredictedSales},
+			Replayed:     PredictionOutput{Price: results[i].PredictedPrice, Sales: results[i].PredictedSales},
+			PriceDiff:    results[i].PredictedPrice - entry.PredictedPrice,
+			SalesDiff:    results[i].PredictedSales - entry.PredictedSales,
+		}
+		priceDiff, salesDiff := math.Abs(item.PriceDiff), math.Abs(item.SalesDiff)
+		item.Matches = priceDiff <= request.Tolerance && salesDiff <= request.Tolerance
+		if item.Matches {
+			report.Matches++
+		} else {
+			report.Mismatches++
+		}
+		report.MeanAbsPriceDiff += priceDiff
+		report.MeanAbsSalesDiff += salesDiff
+		report.MaxAbsPriceDiff = max(report.MaxAbsPriceDiff, priceDiff)
+		report.MaxAbsSalesDiff = max(report.MaxAbsSalesDiff, salesDiff)
+		report.Items = append(report.Items, item)
+	}
+	report.Replayed = len(report.Items)
+	if report.Replayed > 0 {
+		report.MeanAbsPriceDiff /= float64(report.Replayed)
+		report.MeanAbsSalesDiff /= float64(report.Replayed)
+	}
+	report.DurationMs = time.Since(started).Milliseconds()
+
+	s.logger.Infow("Replayed recorded predictions", "model_version", request.ModelVersion, "engine", request.Engine,
+		"baseline_version", baselineVersion, "replayed", report.Replayed, "mismatches", report.Mismatches,
+		"max_abs_price_diff", report.MaxAbsPriceDiff, "max_abs_sales_diff", report.MaxAbsSalesDiff)
+	return report, nil
+}
+
+// predict runs the requests through the target of the replay
+func (r *Replayer) predict(ctx context.Context, request *ReplayRequest, baselineVersion string, requests []*PredictionRequest) ([]PredictionResult, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	// Replays yield the prediction processes to interactive traffic
+	ctx = WithInferencePriority(ctx, PriorityBatch)
+
+	var results []PredictionResult
+	var err error
+	switch {
+	case request.Engine != "":
+		results, err = r.engines[request.Engine].PredictBatch(ctx, requests)
+	case request.ModelVersion == baselineVersion:
+		results, err = r.mlService.engine.PredictBatch(ctx, requests)
+	default:
+		predictor, stagingDir, stageErr := r.mlService.stageVersion(request.ModelVersion)
+		if stageErr != nil {
+			return nil, stageErr
+		}
+		defer r.mlService.fileRepo.RemoveStagingDir(stagingDir)
+		results, err = predictor.PredictBatchWithModels(ctx, requests, stagingDir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error replaying predictions: %w", err)
+	}
+	if len(results) != len(requests) {
+		return nil, fmt.Errorf("replay returned %d results for %d requests", len(results), len(requests))
+	}
+	return results, nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/evaluation"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// salesForecastDays is the number of days the sales model's target covers
+const salesForecastDays = 7
+
+// Top-mover metrics
+const (
+	TopMoverMetricSales = "sales"
+	TopMoverMetricPrice = "price"
+)
+
+// TopMoversParams controls the top-movers report
+type TopMoversParams struct {
+	Metric     string
+	Limit      int
+	Threshold  float64
+	WindowDays int
+}
+
+// TopMover describes a product whose forecast deviates from its recent history
+type TopMover struct {
+	ProductName       string    `json:"product_name"`
+	Region            string    `json:"region"`
+	Seller            string    `json:"seller"`
+	ForecastAt        time.Time `json:"forecast_at"`
+	PredictedPrice    float64   `json:"predicted_price"`
+	PriceRollingMean7 float64   `json:"price_rolling_mean_7"`
+	PriceChange       float64   `json:"price_change"`
+	PredictedSales    float64   `json:"predicted_sales"`
+	SalesBaseline     float64   `json:"sales_baseline"`
+	SalesChange       float64   `json:"sales_change"`
+}
+
+// ReportStore provides the forecasts, history and data coverage that reports are built from.
+// PostgresRepository implements it
+type ReportStore interface {
+	GetLatestForecastsWithHistory(since time.Time) ([]repository.ForecastVersusHistory, error)
+	ListDataCoverage(filter repository.DataCoverageFilter, limit, offset int) ([]repository.DataCoverage, int, error)
+}
+
+// ReportService builds analytical reports from stored forecasts and history
+type ReportService struct {
+	postgresRepo ReportStore
+	forecasts    *ForecastService
+	fileRepo     *repository.FileRepository
+	metrics      evaluation.MetricSet
+	logger       *zap.SugaredLogger
+}
+
+// NewReportService creates a new report service
+func NewReportService(postgresRepo ReportStore, forecasts *ForecastService, fileRepo *repository.FileRepository, metrics evaluation.MetricSet, logger *zap.SugaredLogger) *ReportService {
+	return &ReportService{
+		postgresRepo: postgresRepo,
+		forecasts:    forecasts,
+		fileRepo:     fileRepo,
+		metrics:      metrics,
+		logger:       logger,
+	}
+}
+
+// TopMovers returns the products whose latest forecast changes the most relative to their
+// 7-day rolling mean. Changes are relative (0.25 = +25%); the sales baseline is the daily
+// rolling mean scaled to the sales model's 7-day target.
+func (s *ReportService) TopMovers(params TopMoversParams) ([]TopMover, error) {
+	since := time.Now().AddDate(0, 0, -params.WindowDays)
+	forecasts, err := s.postgresRepo.GetLatestForecastsWithHistory(since)
+	if err != nil {
+		return nil, err
+	}
+
+	movers := make([]TopMover, 0, len(forecasts))
+	for _, f := range forecasts {
+		salesBaseline := f.SalesRollingMean7 * salesForecastDays
+		mover := TopMover{
+			ProductName:       f.ProductName,
+			Region:            f.Region,
+			Seller:            f.Seller,
+			ForecastAt:        f.ForecastAt,
+			PredictedPrice:    f.PredictedPrice,
+			PriceRollingMean7: f.PriceRollingMean7,
+			PriceChange:       relativeChange(f.PredictedPrice, f.PriceRollingMean7),
+			PredictedSales:    f.PredictedSales,
+			SalesBaseline:     salesBaseline,
+			SalesChange:       relativeChange(f.PredictedSales, salesBaseline),
+		}
+
+		if math.Abs(moverChange(mover, params.Metric)) >= params.Threshold {
+			movers = append(movers, mover)
+		}
+	}
+
+	sort.Slice(movers, func(i, j int) bool {
+		return math.Abs(moverChange(movers[i], params.Metric)) > math.Abs(moverChange(movers[j], params.Metric))
+	})
+
+	if len(movers) > params.Limit {
+		movers = movers[:params.Limit]
+	}
+	return movers, nil
+}
+
+// DataCoverageFilter narrows the data coverage report; empty fields match everything
+type DataCoverageFilter struct {
+	ProductName string
+	Region      string
+	Seller      string
+}
+
+// DataCoverage describes how completely the daily history of a product, region and seller is
+// filled between its first and last observation
+type DataCoverage struct {
+	ProductName  string    `json:"product_name"`
+	Region       string    `json:"region"`
+	Seller       string    `json:"seller"`
+	FirstDate    time.Time `json:"first_date"`
+	LastDate     time.Time `json:"last_date"`
+	Observations int64     `json:"observations"`
+	MissingDays  int64     `json:"missing_days"`
+	// GapPercentage is the share of days between the first and last date without data, 0-100
+	GapPercentage float64 `json:"gap_percentage"`
+}
+
+// DataCoverage returns a page of the history coverage of every product, region and seller matching
+// the filter, the least complete first, and the total number of matching keys
+func (s *ReportService) DataCoverage(filter DataCoverageFilter, limit, offset int) ([]DataCoverage, int, error) {
+	rows, total, err := s.postgresRepo.ListDataCoverage(repository.DataCoverageFilter(filter), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	coverage := make([]DataCoverage, 0, len(rows))
+	for _, row := range rows {
+		coverage = append(coverage, DataCoverage(row))
+	}
+	return coverage, total, nil
+}
+
+// moverChange returns the change of the mover for the requested metric
+func moverChange(mover TopMover, metric string) float64 {
+	if metric == TopMoverMetricPrice {
+		return mover.PriceChange
+	}
+	return mover.SalesChange
+}
+
+// relativeChange returns (value - baseline) / baseline, or 0 when the baseline is zero
+func relativeChange(value, baseline float64) float64 {
+	if baseline == 0 {
+		return 0
+	}
+	return (value - baseline) / baseline
+}
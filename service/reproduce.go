@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Where the models of a reproduction came from
+const (
+	ReproducedWithInstalledModels = "installed"
+	ReproducedWithArtifactStore   = "artifact_store"
+)
+
+// Errors returned when reproducing a prediction
+var (
+	ErrPredictionNotFound      = errors.New("prediction not found")
+	ErrModelVersionUnavailable = errors.New("model version of the prediction is not available")
+)
+
+// PredictionOutput is the output of the models for a feature vector
+type PredictionOutput struct {
+	Price float64 `json:"price"`
+	Sales float64 `json:"sales"`
+}
+
+// PredictionReproduction compares a recorded prediction with the output of the same models on the
+// same feature vector now. A mismatch means the models are not deterministic, or the artifacts of
+// the version changed after the prediction was made
+type PredictionReproduction struct {
+	PredictionID int64     `json:"prediction_id"`
+	ModelVersion string    `json:"model_version"`
+	RecordedAt   time.Time `json:"recorded_at"`
+	// ModelSource is where the models of the version were loaded from: installed or artifact_store
+	ModelSource string           `json:"model_source"`
+	Recorded    PredictionOutput `json:"recorded"`
+	Reproduced  PredictionOutput `json:"reproduced"`
+	// PriceDiff and SalesDiff are the reproduced values minus the recorded ones
+	PriceDiff float64 `json:"price_diff"`
+	SalesDiff float64 `json:"sales_diff"`
+	Tolerance float64 `json:"tolerance"`
+	Matches   bool    `json:"matches"`
+}
+
+// ReproducePrediction runs the models of the version that made a recorded prediction on its
+// recorded feature vector and compares the outputs. The installed models are used when they are
+// that version; otherwise its artifacts are downloaded from the artifact store, which needs an
+// engine able to run staged models. The outputs match when neither differs by more than tolerance.
+// The reproduction is not recorded in the prediction log
+func (s *MLPredictionService) ReproducePrediction(ctx context.Context, id int64, tolerance float64) (*PredictionReproduction, error) {
+	entry, err := s.postgresRepo.GetPredictionLog(id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, ErrPredictionNotFound
+	}
+	if entry.ModelVersion == "" {
+		return nil, fmt.Errorf("%w: it was recorded without a model version", ErrModelVersionUnavailable)
+	}
+
+	var request PredictionRequest
+	if err := json.Unmarshal(entry.Features, &request); err != nil {
+		return nil, fmt.Errorf("error parsing recorded features: %v", err)
+	}
+
+	var result *PredictionResult
+	source := ReproducedWithInstalledModels
+	if entry.ModelVersion == s.ActiveModelVersion() {
+		result, err = s.engine.Predict(ctx, &request)
+	} else {
+		source = ReproducedWithArtifactStore
+		result, err = s.predictWithVersion(ctx, &request, entry.ModelVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reproduction := &PredictionReproduction{
+		PredictionID: entry.ID,
+		ModelVersion: entry.ModelVersion,
+		RecordedAt:   entry.CreatedAt,
+		ModelSource:  source,
+		Recorded:     PredictionOutput{Price: entry.PredictedPrice, Sales: entry.PredictedSales},
+		Reproduced:   PredictionOutput{Price: result.PredictedPrice, Sales: result.PredictedSales},
+		PriceDiff:    result.PredictedPrice - entry.PredictedPrice,
+		SalesDiff:    result.PredictedSales - entry.PredictedSales,
+		Tolerance:    tolerance,
+	}
+	reproduction.Matches = math.Abs(reproduction.PriceDiff) <= tolerance && math.Abs(reproduction.SalesDiff) <= tolerance
+	if !reproduction.Matches {
+		s.logger.Warnw("Prediction reproduction does not match", "prediction_id", id, "model_version", entry.ModelVersion,
+			"model_source", source, "price_diff", reproduction.PriceDiff, "sales_diff", reproduction.SalesDiff)
+	}
+	return reproduction, nil
+}
+
+// predictWithVersion runs a model version other than the installed one, downloaded from the
+// artifact store into a staging directory
+func (s *MLPredictionService) predictWithVersion(ctx context.Context, request *PredictionRequest, version string) (*PredictionResult, error) {
+	predictor, stagingDir, err := s.stageVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	defer s.fileRepo.RemoveStagingDir(stagingDir)
+	return predictor.PredictWithModels(ctx, request, stagingDir)
+}
+
+// stageVersion downloads the artifacts of a model version from the artifact store into a staging
+// directory, which the caller removes, and returns the engine able to run them
+func (s *MLPredictionService) stageVersion(version string) (StagedModelPredictor, string, error) {
+	predictor, ok := s.engine.(StagedModelPredictor)
+	if s.artifactStore == nil || !ok {
+		return nil, "", fmt.Errorf("%w: version %s is not installed and the artifact store or the inference engine cannot provide it",
+			ErrModelVersionUnavailable, version)
+	}
+
+	stagingDir, err := s.fileRepo.CreateStagingDir()
+	if err != nil {
+		return nil, "", err
+	}
+	artifacts, err := downloadModelArtifacts(s.artifactStore, s.fileRepo, version, stagingDir)
+	if err == nil {
+		err = s.fileRepo.VerifyStagedArtifacts(stagingDir, artifacts)
+	}
+	if err != nil {
+		s.fileRepo.RemoveStagingDir(stagingDir)
+		return nil, "", fmt.Errorf("%w: %v", ErrModelVersionUnavailable, err)
+	}
+	return predictor, stagingDir, nil
+}
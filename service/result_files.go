@@ -0,0 +1,115 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// Kinds of job output kept in the result store
+const (
+	ResultKindSimulation = "simulations"
+	ResultKindBatch      = "batches"
+)
+
+// Errors returned when a result download link is refused
+var (
+	ErrInvalidResultLink = errors.New("result link signature is invalid")
+	ErrResultLinkExpired = errors.New("result link has expired")
+	ErrResultNotFound    = repository.ErrResultNotFound
+)
+
+// ResultLink is a short-lived download link of a job's results file
+type ResultLink struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ResultFiles keeps large job outputs as files in the result store and hands out presigned links to
+// them, so that clients download results from any replica without the status endpoints carrying them.
+// A link carries its expiry time and the hex HMAC-SHA256 of the file key and the expiry, keyed with
+// the link secret, so it can't be altered or used for another file
+type ResultFiles struct {
+	store         repository.ResultStore
+	secret        []byte
+	ttl           time.Duration
+	publicBaseURL string
+	now           func() time.Time
+}
+
+// NewResultFiles creates the result file service; store may be nil to disable result files
+func NewResultFiles(store repository.ResultStore, secret []byte, ttl time.Duration, publicBaseURL string) *ResultFiles {
+	return &ResultFiles{
+		store:         store,
+		secret:        secret,
+		ttl:           ttl,
+		publicBaseURL: publicBaseURL,
+		now:           time.Now,
+	}
+}
+
+// Enabled reports whether job outputs are kept as result files
+func (f *ResultFiles) Enabled() bool {
+	return f.store != nil
+}
+
+// Save stores the JSON output of a job and returns its key
+func (f *ResultFiles) Save(kind string, id int64, data []byte) (string, error) {
+	key := fmt.Sprintf("%s/%d.json", kind, id)
+	if err := f.store.Put(key, data); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Link returns a fresh presigned download link of the file with the given key
+func (f *ResultFiles) Link(key string) *ResultLink {
+	expiresAt := f.now().Add(f.ttl).Truncate(time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", hex.EncodeToString(f.signature(key, expires)))
+	return &ResultLink{
+		URL:       fmt.Sprintf("%s/api/v1/results/%s?%s", f.publicBaseURL, key, query.Encode()),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// Open verifies a download link and returns the contents of its file
+func (f *ResultFiles) Open(key, expires, signature string) ([]byte, error) {
+	if !f.Enabled() {
+		return nil, ErrResultNotFound
+	}
+
+	given, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(given, f.signature(key, expires)) {
+		return nil, ErrInvalidResultLink
+	}
+
+	seconds, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidResultLink
+	}
+	if f.now().After(time.Unix(seconds, 0)) {
+		return nil, ErrResultLinkExpired
+	}
+
+	return f.store.Get(key)
+}
+
+// signature returns the HMAC of a link to key that expires at the given Unix time
+func (f *ResultFiles) signature(key, expires string) []byte {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write([]byte(key))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(expires))
+	return mac.Sum(nil)
+}
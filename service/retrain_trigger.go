@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetrainThresholds controls how much newly ingested data triggers a retraining.
+// A zero threshold is disabled; retraining starts once any enabled threshold is crossed.
+type RetrainThresholds struct {
+	// MinNewRows is the number of processed_data rows ingested since the last training
+	MinNewRows int64
+	// MinNewRowsPercent is the same number as a percentage of the last trained dataset
+	MinNewRowsPercent float64
+}
+
+// Enabled reports whether any threshold is set
+func (t RetrainThresholds) Enabled() bool {
+	return t.MinNewRows > 0 || t.MinNewRowsPercent > 0
+}
+
+// crossed reports whether newRows ingested on top of a dataset of trainedRows crosses a threshold
+func (t RetrainThresholds) crossed(newRows, trainedRows int64) bool {
+	if newRows <= 0 {
+		return false
+	}
+	if t.MinNewRows > 0 && newRows >= t.MinNewRows {
+		return true
+	}
+	return t.MinNewRowsPercent > 0 && trainedRows > 0 &&
+		float64(newRows)*100/float64(trainedRows) >= t.MinNewRowsPercent
+}
+
+// RetrainStore provides the data volumes RetrainTrigger compares. PostgresRepository implements it
+type RetrainStore interface {
+	CountProcessedRows() (int64, error)
+	GetLastTrainedDatasetRows() (int64, bool, error)
+}
+
+// RetrainTrigger compares the processed data volume with the one of the last successful training
+// run and retrains the models once enough new rows have been ingested. It runs as the
+// retrain_trigger job, which keeps checks from overlapping.
+type RetrainTrigger struct {
+	mlService    *MLPredictionService
+	postgresRepo RetrainStore
+	thresholds   RetrainThresholds
+	timeout      time.Duration
+	logger       *zap.SugaredLogger
+}
+
+// NewRetrainTrigger creates a new retrain trigger
+func NewRetrainTrigger(mlService *MLPredictionService, postgresRepo RetrainStore, thresholds RetrainThresholds, timeout time.Duration, logger *zap.SugaredLogger) *RetrainTrigger {
+	return &RetrainTrigger{
+		mlService:    mlService,
+		postgresRepo: postgresRepo,
+		thresholds:   thresholds,
+		timeout:      timeout,
+		logger:       logger,
+	}
+}
+
+// Check retrains the models if the rows ingested since the last training cross a threshold
+func (t *RetrainTrigger) Check(ctx context.Context) error {
+	trainedRows, trained, err := t.postgresRepo.GetLastTrainedDatasetRows()
+	if err != nil {
+		return err
+	}
+	if !trained {
+		// The initial training is started at startup when no models exist
+		return nil
+	}
+
+	currentRows, err := t.postgresRepo.CountProcessedRows()
+	if err != nil {
+		return err
+	}
+
+	newRows := currentRows - trainedRows
+	if !t.thresholds.crossed(newRows, trainedRows) {
+		return nil
+	}
+
+	t.logger.Infow("Ingested data crossed the retrain threshold, retraining models",
+		"new_rows", newRows, "trained_rows", trainedRows)
+
+	trainCtx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	result, err := t.mlService.TrainModels(trainCtx)
+	if err != nil {
+		return err
+	}
+	t.logger.Infow("Triggered retraining completed", "version", result.Version)
+	return nil
+}
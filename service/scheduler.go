@@ -0,0 +1,405 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/cron"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// Scheduled job names
+const (
+	JobRetrain          = "retrain"
+	JobReconciliation   = "reconciliation"
+	JobRetrainTrigger   = "retrain_trigger"
+	JobSellerStats      = "seller_stats"
+	JobBacktest         = "backtest"
+	JobUsageRollup      = "usage_rollup"
+	JobStandbyPromotion = "standby_promotion"
+)
+
+// Job run statuses
+const (
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// What started a job run
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+var (
+	// ErrJobNotFound is returned for a job name that is not registered
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobRunning is returned when a job is started while its previous run has not finished
+	ErrJobRunning = errors.New("job is already running")
+
+	// errJobRunningElsewhere is returned when another replica holds the lock of a job
+	errJobRunningElsewhere = fmt.Errorf("%w on another replica", ErrJobRunning)
+)
+
+// JobFunc performs the work of a scheduled job
+type JobFunc func(ctx context.Context) error
+
+// JobRun describes one execution of a scheduled job
+type JobRun struct {
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	TriggeredBy string     `json:"triggered_by"`
+}
+
+// JobStatus describes a scheduled job and its last run
+type JobStatus struct {
+	Name     string     `json:"name"`
+	Schedule string     `json:"schedule"`
+	Enabled  bool       `json:"enabled"`
+	Running  bool       `json:"running"`
+	NextRun  *time.Time `json:"next_run,omitempty"`
+	LastRun  *JobRun    `json:"last_run,omitempty"`
+}
+
+// JobExecution is a recorded run of a background job from the job history
+type JobExecution struct {
+	ID          int64           `json:"id"`
+	JobType     string          `json:"job_type"`
+	Params      json.RawMessage `json:"params,omitempty"`
+	StartedAt   time.Time       `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	DurationMs  *int64          `json:"duration_ms,omitempty"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	TriggeredBy string          `json:"triggered_by"`
+}
+
+// JobFilter narrows the job history; empty fields match everything
+type JobFilter struct {
+	JobType     string
+	Status      string
+	TriggeredBy string
+	From        time.Time
+	To          time.Time
+}
+
+// scheduledJob is a registered job and its run state
+type scheduledJob struct {
+	name     string
+	spec     string
+	schedule *cron.Schedule
+	enabled  bool
+	params   []byte
+	fn       JobFunc
+	next     time.Time
+	running  bool
+	lastRun  *JobRun
+}
+
+// JobExecutionStore holds the job history. PostgresRepository implements it
+type JobExecutionStore interface {
+	CreateJobExecution(execution *repository.JobExecution) (int64, error)
+	FinishJobExecution(id int64, status string, errMsg string, finishedAt time.Time) error
+	ListJobExecutions(filter repository.JobExecutionFilter, limit, offset int) ([]repository.JobExecution, int, error)
+	ClaimScheduledJob(name string, scheduledAt time.Time, replica string) (bool, error)
+	TryLockJob(name string) (unlock func(), locked bool, err error)
+}
+
+// Scheduler runs named background jobs on cron schedules. A job never overlaps with its own
+// previous run, on this replica or on any other: every replica running the scheduler fires the same
+// schedules, only the first to claim a scheduled run in the database runs it, and a run also holds
+// a database lock of its job, which manual runs take as well. No job starts while the replica is
+// in lame-duck mode. Every run is recorded in the job history.
+type Scheduler struct {
+	postgresRepo JobExecutionStore
+	lifecycle    *Lifecycle
+	logger       *zap.SugaredLogger
+
+	mu   sync.Mutex
+	jobs []*scheduledJob
+	// ctx is passed to every job, set by Start so that jobs are cancelled with the scheduler or at
+	// the end of the shutdown grace period
+	ctx    context.Context
+	wakeup chan struct{}
+}
+
+// NewScheduler creates a scheduler without jobs
+func NewScheduler(postgresRepo JobExecutionStore, lifecycle *Lifecycle, logger *zap.SugaredLogger) *Scheduler {
+	return &Scheduler{
+		postgresRepo: postgresRepo,
+		lifecycle:    lifecycle,
+		logger:       logger,
+		ctx:          lifecycle.Context(),
+		wakeup:       make(chan struct{}, 1),
+	}
+}
+
+// Register adds a job running fn on the cron expression spec. params describes how the job is
+// configured and is recorded with every run. Disabled jobs are listed and can be run manually
+// but are never scheduled.
+func (s *Scheduler) Register(name, spec string, enabled bool, params any, fn JobFunc) error {
+	schedule, err := cron.Parse(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for job %s: %v", name, err)
+	}
+	var paramsJSON []byte
+	if params != nil {
+		if paramsJSON, err = json.Marshal(params); err != nil {
+			return fmt.Errorf("error marshaling params of job %s: %v", name, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.name == name {
+			return fmt.Errorf("job %s is already registered", name)
+		}
+	}
+	job := &scheduledJob{name: name, spec: spec, schedule: schedule, enabled: enabled, params: paramsJSON, fn: fn}
+	if enabled {
+		job.next = schedule.Next(time.Now())
+	}
+	s.jobs = append(s.jobs, job)
+
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start runs due jobs until the context is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	for {
+		// Without enabled jobs only a registration or cancellation wakes the loop
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if next := s.nextRun(); !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			fire = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-s.wakeup:
+		case <-fire:
+			s.runDue()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// nextRun returns the earliest next run of the enabled jobs, zero if there is none
+func (s *Scheduler) nextRun() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, job := range s.jobs {
+		if !job.next.IsZero() && (next.IsZero() || job.next.Before(next)) {
+			next = job.next
+		}
+	}
+	return next
+}
+
+// runDue starts every job whose next run has come and schedules its following run
+func (s *Scheduler) runDue() {
+	now := time.Now()
+
+	s.mu.Lock()
+	var due []*scheduledJob
+	var slots []time.Time
+	for _, job := range s.jobs {
+		if !job.next.IsZero() && !job.next.After(now) {
+			due = append(due, job)
+			slots = append(slots, job.next)
+			job.next = job.schedule.Next(now)
+		}
+	}
+	s.mu.Unlock()
+
+	for i, job := range due {
+		claimed, err := s.postgresRepo.ClaimScheduledJob(job.name, slots[i], replicaName())
+		if err != nil {
+			s.logger.Warnw("Skipped scheduled job", "job", job.name, "reason", err)
+			continue
+		}
+		if !claimed {
+			s.logger.Debugw("Skipped scheduled job claimed by another replica", "job", job.name, "scheduled_at", slots[i])
+			continue
+		}
+		if err := s.start(job, TriggerSchedule); errors.Is(err, errJobRunningElsewhere) {
+			s.logger.Debugw("Skipped scheduled job run by another replica", "job", job.name)
+		} else if err != nil {
+			s.logger.Warnw("Skipped scheduled job", "job", job.name, "reason", err)
+		}
+	}
+}
+
+// RunNow starts a job immediately, whether or not it is enabled
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	var found *scheduledJob
+	for _, job := range s.jobs {
+		if job.name == name {
+			found = job
+		}
+	}
+	s.mu.Unlock()
+
+	if found == nil {
+		return ErrJobNotFound
+	}
+	return s.start(found, TriggerManual)
+}
+
+// start runs a job in the background unless it is already running, here or on another replica,
+// or the replica is draining
+func (s *Scheduler) start(job *scheduledJob, triggeredBy string) error {
+	unlock, locked, err := s.postgresRepo.TryLockJob(job.name)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errJobRunningElsewhere
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job.running {
+		unlock()
+		return ErrJobRunning
+	}
+	done, err := s.lifecycle.BeginJob()
+	if err != nil {
+		unlock()
+		return err
+	}
+
+	run := &JobRun{StartedAt: time.Now(), Status: JobStatusRunning, TriggeredBy: triggeredBy}
+	job.running = true
+	job.lastRun = run
+	ctx := s.ctx
+
+	go func() {
+		defer done()
+		defer unlock()
+		s.logger.Infow("Job started", "job", job.name, "triggered_by", triggeredBy)
+
+		// History failures are logged and never keep the job from running
+		executionID, recordErr := s.postgresRepo.CreateJobExecution(&repository.JobExecution{
+			JobType:     job.name,
+			Params:      job.params,
+			StartedAt:   run.StartedAt,
+			Status:      JobStatusRunning,
+			TriggeredBy: triggeredBy,
+		})
+		if recordErr != nil {
+			s.logger.Errorw("Failed to record job start", "error", recordErr, "job", job.name)
+		}
+
+		err := job.fn(ctx)
+		s.finish(job, run, err)
+
+		if recordErr == nil {
+			if err := s.postgresRepo.FinishJobExecution(executionID, run.Status, run.Error, *run.FinishedAt); err != nil {
+				s.logger.Errorw("Failed to record job outcome", "error", err, "job", job.name)
+			}
+		}
+	}()
+	return nil
+}
+
+// finish records the outcome of a job run in its in-memory state
+func (s *Scheduler) finish(job *scheduledJob, run *JobRun, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	run.Status = JobStatusSucceeded
+	if err != nil {
+		run.Status = JobStatusFailed
+		run.Error = err.Error()
+		s.logger.Errorw("Job failed", "job", job.name, "error", err, "duration", finishedAt.Sub(run.StartedAt))
+	} else {
+		s.logger.Infow("Job completed", "job", job.name, "duration", finishedAt.Sub(run.StartedAt))
+	}
+	job.running = false
+}
+
+// Jobs returns the status of every registered job in registration order
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		status := JobStatus{
+			Name:     job.name,
+			Schedule: job.spec,
+			Enabled:  job.enabled,
+			Running:  job.running,
+		}
+		if !job.next.IsZero() {
+			next := job.next
+			status.NextRun = &next
+		}
+		if job.lastRun != nil {
+			lastRun := *job.lastRun
+			status.LastRun = &lastRun
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// History returns a page of recorded job runs matching the filter, newest first,
+// and the total number of matching runs
+func (s *Scheduler) History(filter JobFilter, limit, offset int) ([]JobExecution, int, error) {
+	rows, total, err := s.postgresRepo.ListJobExecutions(repository.JobExecutionFilter(filter), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	executions := make([]JobExecution, 0, len(rows))
+	for _, row := range rows {
+		execution := JobExecution{
+			ID:          row.ID,
+			JobType:     row.JobType,
+			Params:      json.RawMessage(row.Params),
+			StartedAt:   row.StartedAt,
+			FinishedAt:  row.FinishedAt,
+			Status:      row.Status,
+			Error:       row.Error,
+			TriggeredBy: row.TriggeredBy,
+		}
+		if row.FinishedAt != nil {
+			durationMs := row.FinishedAt.Sub(row.StartedAt).Milliseconds()
+			execution.DurationMs = &durationMs
+		}
+		executions = append(executions, execution)
+	}
+	return executions, total, nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// SellerStatsStore holds the seller_stats table. PostgresRepository implements it
+type SellerStatsStore interface {
+	RefreshSellerStats(windowDays int) (int64, error)
+	AllSellerStats() ([]repository.SellerStats, error)
+}
+
+// SellerStatsRefresher recomputes the seller_stats table from processed data. It runs as the
+// seller_stats job; predictions read the table during feature resolution and training through the
+// seller stats file passed to the script.
+type SellerStatsRefresher struct {
+	postgresRepo SellerStatsStore
+	windowDays   int
+	logger       *zap.SugaredLogger
+}
+
+// NewSellerStatsRefresher creates a refresher aggregating the windowDays latest days of data
+func NewSellerStatsRefresher(postgresRepo SellerStatsStore, windowDays int, logger *zap.SugaredLogger) *SellerStatsRefresher {
+	return &SellerStatsRefresher{
+		postgresRepo: postgresRepo,
+		windowDays:   windowDays,
+		logger:       logger,
+	}
+}
+
+// Refresh replaces the stats of every seller
+func (r *SellerStatsRefresher) Refresh(ctx context.Context) error {
+	sellers, err := r.postgresRepo.RefreshSellerStats(r.windowDays)
+	if err != nil {
+		return err
+	}
+	r.logger.Infow("Seller stats refreshed", "sellers", sellers, "window_days", r.windowDays)
+	return nil
+}
+
+// sellerStatsRecord is the stats of a seller as the training script reads them
+type sellerStatsRecord struct {
+	Seller           string   `json:"seller"`
+	AvgDeliveryDays  float64  `json:"avg_delivery_days"`
+	CancellationRate *float64 `json:"cancellation_rate"`
+	RatingTrend      float64  `json:"rating_trend"`
+}
+
+// writeSellerStatsFile writes the stats of every seller to a file in the run directory of the
+// training script, which derives the seller features of the training rows from it
+func writeSellerStatsFile(postgresRepo PredictionStore, runDir string) (string, error) {
+	rows, err := postgresRepo.AllSellerStats()
+	if err != nil {
+		return "", err
+	}
+	records := make([]sellerStatsRecord, 0, len(rows))
+	for _, row := range rows {
+		stats := featureSellerStats(&row)
+		records = append(records, sellerStatsRecord{
+			Seller:           row.Seller,
+			AvgDeliveryDays:  stats.AvgDeliveryDays,
+			CancellationRate: stats.CancellationRate,
+			RatingTrend:      stats.RatingTrend,
+		})
+	}
+
+	path := filepath.Join(runDir, "seller_stats.json")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("error creating seller stats file: %v", err)
+	}
+	if err := json.NewEncoder(file).Encode(records); err != nil {
+		file.Close()
+		return "", fmt.Errorf("error writing seller stats file: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("error writing seller stats file: %v", err)
+	}
+	return path, nil
+}
+
+// featureSellerStats converts stored seller stats to the input of features.ApplySellerStats; nil
+// stays nil
+func featureSellerStats(row *repository.SellerStats) *features.SellerStats {
+	if row == nil {
+		return nil
+	}
+	stats := &features.SellerStats{
+		AvgDeliveryDays: row.AvgDeliveryDays,
+		RatingTrend:     row.RatingTrend,
+	}
+	if row.CancellationRate.Valid {
+		rate := row.CancellationRate.Float64
+		stats.CancellationRate = &rate
+	}
+	return stats
+}
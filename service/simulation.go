@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// Simulation statuses
+const (
+	SimulationStatusPending   = "pending"
+	SimulationStatusRunning   = "running"
+	SimulationStatusCompleted = "completed"
+	SimulationStatusFailed    = "failed"
+)
+
+// ErrTooManyScenarios is returned when a simulation request expands into more scenarios than allowed
+var ErrTooManyScenarios = errors.New("simulation exceeds the maximum number of scenarios")
+
+// SimulationProduct identifies a product included in a simulation
+type SimulationProduct struct {
+	ProductName string `json:"product_name" binding:"required"`
+	Region      string `json:"region" binding:"required"`
+	Seller      string `json:"seller" binding:"required"`
+}
+
+// SimulationRequest describes a price × discount × stock sweep over a forecast horizon
+type SimulationRequest struct {
+	Products []SimulationProduct `json:"products" binding:"required,min=1,dive"`
+	// PriceMultipliers are applied to each product's current price (1.0 keeps the current price)
+	PriceMultipliers    []float64 `json:"price_multipliers" binding:"required,min=1"`
+	DiscountPercentages []float64 `json:"discount_percentages,omitempty"`
+	// StockLevels are absolute stock levels; the product's current stock is used when empty
+	StockLevels []float64  `json:"stock_levels,omitempty"`
+	HorizonDays int        `json:"horizon_days,omitempty"`
+	StartDate   *time.Time `json:"start_date,omitempty"`
+}
+
+// Simulation represents the state of a simulation job
+type Simulation struct {
+	ID            int64      `json:"id"`
+	Status        string     `json:"status"`
+	ScenarioCount int        `json:"scenario_count"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+	// ResultsLink is a short-lived download link of the results file, when result files are enabled
+	ResultsLink *ResultLink `json:"results_link,omitempty"`
+}
+
+// SimulationResultRow represents a single simulated scenario and its prediction
+type SimulationResultRow struct {
+	ProductName        string    `json:"product_name"`
+	Region             string    `json:"region"`
+	Seller             string    `json:"seller"`
+	Date               time.Time `json:"date"`
+	Price              float64   `json:"price"`
+	DiscountPercentage float64   `json:"discount_percentage"`
+	StockLevel         float64   `json:"stock_level"`
+	PredictedPrice     float64   `json:"predicted_price"`
+	PredictedSales     float64   `json:"predicted_sales"`
+}
+
+// SimulationStore holds scenario simulations and their results. PostgresRepository implements it
+type SimulationStore interface {
+	CreateSimulation(request []byte, scenarioCount int) (int64, error)
+	GetSimulation(id int64) (*repository.Simulation, error)
+	UpdateSimulationStatus(id int64, status string, errMsg string) error
+	SaveSimulationResults(id int64, rows []repository.SimulationResultRow) error
+	SetSimulationResultsKey(id int64, key string) error
+	GetSimulationResults(id int64) ([]repository.SimulationResultRow, error)
+}
+
+// SimulationService runs scenario simulations through the prediction model in bulk
+type SimulationService struct {
+	mlService    *MLPredictionService
+	postgresRepo SimulationStore
+	results      *ResultFiles
+	workers      *WorkerPool
+	maxScenarios int
+	timeout      time.Duration
+	lifecycle    *Lifecycle
+	logger       *zap.SugaredLogger
+}
+
+// NewSimulationService creates a new simulation service
+func NewSimulationService(mlService *MLPredictionService, postgresRepo SimulationStore, results *ResultFiles, workers *WorkerPool, maxScenarios int, timeout time.Duration, lifecycle *Lifecycle, logger *zap.SugaredLogger) *SimulationService {
+	return &SimulationService{
+		mlService:    mlService,
+		postgresRepo: postgresRepo,
+		results:      results,
+		workers:      workers,
+		maxScenarios: maxScenarios,
+		timeout:      timeout,
+		lifecycle:    lifecycle,
+		logger:       logger,
+	}
+}
+
+// StartSimulation validates and stores a simulation, then runs it in the background
+func (s *SimulationService) StartSimulation(request *SimulationRequest) (*Simulation, error) {
+	if len(request.DiscountPercentages) == 0 {
+		request.DiscountPercentages = []float64{0}
+	}
+	if request.HorizonDays <= 0 {
+		request.HorizonDays = 1
+	}
+	if request.StartDate == nil {
+		now := time.Now()
+		request.StartDate = &now
+	}
+
+	stockVariants := len(request.StockLevels)
+	if stockVariants == 0 {
+		stockVariants = 1
+	}
+	scenarioCount := len(request.Products) * len(request.PriceMultipliers) *
+		len(request.DiscountPercentages) * stockVariants * request.HorizonDays
+	if scenarioCount > s.maxScenarios {
+		return nil, fmt.Errorf("%w: %d requested, %d allowed", ErrTooManyScenarios, scenarioCount, s.maxScenarios)
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling simulation request: %v", err)
+	}
+
+	done, err := s.lifecycle.BeginJob()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.postgresRepo.CreateSimulation(requestJSON, scenarioCount)
+	if err != nil {
+		done()
+		return nil, err
+	}
+
+	go func() {
+		defer done()
+		s.run(id, request)
+	}()
+
+	return s.GetSimulation(id)
+}
+
+// GetSimulation returns a simulation by ID, or nil if it does not exist
+func (s *SimulationService) GetSimulation(id int64) (*Simulation, error) {
+	sim, err := s.postgresRepo.GetSimulation(id)
+	if err != nil || sim == nil {
+		return nil, err
+	}
+
+	simulation := &Simulation{
+		ID:            sim.ID,
+		Status:        sim.Status,
+		ScenarioCount: sim.ScenarioCount,
+		Error:         sim.Error,
+		CreatedAt:     sim.CreatedAt,
+		CompletedAt:   sim.CompletedAt,
+	}
+	if sim.ResultsKey != "" && s.results.Enabled() {
+		simulation.ResultsLink = s.results.Link(sim.ResultsKey)
+	}
+	return simulation, nil
+}
+
+// GetSimulationResults returns the result matrix of a simulation
+func (s *SimulationService) GetSimulationResults(id int64) ([]SimulationResultRow, error) {
+	rows, err := s.postgresRepo.GetSimulationResults(id)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SimulationResultRow, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, SimulationResultRow(row))
+	}
+	return results, nil
+}
+
+// run executes a stored simulation and records its outcome
+func (s *SimulationService) run(id int64, request *SimulationRequest) {
+	// Simulations run at batch priority so that interactive predictions are served first
+	ctx, cancel := context.WithTimeout(WithInferencePriority(s.lifecycle.Context(), PriorityBatch), s.timeout)
+	defer cancel()
+
+	if err := s.postgresRepo.UpdateSimulationStatus(id, SimulationStatusRunning, ""); err != nil {
+		s.logger.Errorw("Failed to mark simulation as running", "error", err, "simulation_id", id)
+	}
+
+	started := time.Now()
+	rows, err := s.simulate(ctx, request)
+	if err == nil {
+		err = s.postgresRepo.SaveSimulationResults(id, rows)
+	}
+
+	if err != nil {
+		s.logger.Errorw("Simulation failed", "error", err, "simulation_id", id)
+		if err := s.postgresRepo.UpdateSimulationStatus(id, SimulationStatusFailed, err.Error()); err != nil {
+			s.logger.Errorw("Failed to mark simulation as failed", "error", err, "simulation_id", id)
+		}
+		return
+	}
+
+	s.saveResultsFile(id, rows)
+	if err := s.postgresRepo.UpdateSimulationStatus(id, SimulationStatusCompleted, ""); err != nil {
+		s.logger.Errorw("Failed to mark simulation as completed", "error", err, "simulation_id", id)
+	}
+	s.logger.Infow("Simulation completed", "simulation_id", id, "scenarios", len(rows), "duration", time.Since(started))
+}
+
+// saveResultsFile keeps the results of a simulation as a file for link downloads. The results are
+// still served from the database when this fails, so a failure is only logged
+func (s *SimulationService) saveResultsFile(id int64, rows []repository.SimulationResultRow) {
+	if !s.results.Enabled() {
+		return
+	}
+
+	results := make([]SimulationResultRow, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, SimulationResultRow(row))
+	}
+	data, err := json.Marshal(results)
+	var key string
+	if err == nil {
+		key, err = s.results.Save(ResultKindSimulation, id, data)
+	}
+	if err == nil {
+		err = s.postgresRepo.SetSimulationResultsKey(id, key)
+	}
+	if err != nil {
+		s.logger.Warnw("Failed to store simulation results file", "error", err, "simulation_id", id)
+	}
+}
+
+// simulate expands the request into scenarios and predicts all of them in one model pass
+func (s *SimulationService) simulate(ctx context.Context, request *SimulationRequest) ([]repository.SimulationResultRow, error) {
+	var scenarios []*PredictionRequest
+	var rows []repository.SimulationResultRow
+
+	for _, product := range request.Products {
+		resolved, err := s.mlService.resolveFeatures(ctx, &PredictionRequestMinimal{
+			ProductName:    product.ProductName,
+			Region:         product.Region,
+			Seller:         product.Seller,
+			PredictionDate: request.StartDate,
+		})
+		if err != nil {
+			return nil, err
+		}
+		scenarios, rows = appendSimulationScenarios(scenarios, rows, request, product, resolved.request)
+	}
+
+	if len(scenarios) == 0 {
+		return rows, nil
+	}
+
+	// The scenarios are split into one model pass per worker
+	workers := s.workers.Workers(WorkloadSimulation)
+	chunkSize := (len(scenarios) + workers - 1) / workers
+	chunks := (len(scenarios) + chunkSize - 1) / chunkSize
+	err := s.workers.Run(ctx, WorkloadSimulation, chunks, func(ctx context.Context, chunk int) error {
+		start := chunk * chunkSize
+		end := min(start+chunkSize, len(scenarios))
+		predictions, err := s.mlService.engine.PredictBatch(ctx, scenarios[start:end])
+		if err != nil {
+			return err
+		}
+		for i := range predictions {
+			rows[start+i].PredictedPrice = predictions[i].PredictedPrice
+			rows[start+i].PredictedSales = predictions[i].PredictedSales
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// appendSimulationScenarios appends the scenarios of a product and their result rows. Simulations
+// expand to many thousands of scenarios, so those of a product share one allocation
+func appendSimulationScenarios(scenarios []*PredictionRequest, rows []repository.SimulationResultRow, request *SimulationRequest, product SimulationProduct, base *PredictionRequest) ([]*PredictionRequest, []repository.SimulationResultRow) {
+	stockLevels := request.StockLevels
+	if len(stockLevels) == 0 {
+		stockLevels = []float64{base.StockLevel}
+	}
+
+	count := request.HorizonDays * len(request.PriceMultipliers) * len(request.DiscountPercentages) * len(stockLevels)
+	block := make([]PredictionRequest, 0, count)
+	scenarios = slices.Grow(scenarios, count)
+	rows = slices.Grow(rows, count)
+
+	for day := 1; day <= request.HorizonDays; day++ {
+		date := request.StartDate.AddDate(0, 0, day)
+		for _, multiplier := range request.PriceMultipliers {
+			for _, discount := range request.DiscountPercentages {
+				for _, stock := range stockLevels {
+					block = append(block, *base)
+					scenario := &block[len(block)-1]
+					scenario.OriginalPrice = base.Price * multiplier
+					scenario.Price = scenario.OriginalPrice * (1 - discount/100)
+					scenario.DiscountPercentage = discount
+					scenario.StockLevel = stock
+					features.ApplyCalendar(scenario, date)
+
+					scenarios = append(scenarios, scenario)
+					rows = append(rows, repository.SimulationResultRow{
+						ProductName:        product.ProductName,
+						Region:             product.Region,
+						Seller:             product.Seller,
+						Date:               date,
+						Price:              scenario.Price,
+						DiscountPercentage: discount,
+						StockLevel:         stock,
+					})
+				}
+			}
+		}
+	}
+	return scenarios, rows
+}
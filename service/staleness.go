@@ -0,0 +1,32 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStaleHistory is returned in strict mode when the latest history for a key is too old
+var ErrStaleHistory = errors.New("historical data is stale")
+
+// StalenessPolicy decides how old the latest history row may be before features built from it
+// are flagged, or rejected when Strict is set
+type StalenessPolicy struct {
+	// MaxAgeDays is the allowed age of the latest history row, 0 disables the check
+	MaxAgeDays int
+	Strict     bool
+}
+
+// check returns a warning if history from historyDate is too old for a prediction on predictionDate
+func (p StalenessPolicy) check(historyDate, predictionDate time.Time) string {
+	if p.MaxAgeDays <= 0 {
+		return ""
+	}
+
+	ageDays := int(predictionDate.Sub(historyDate).Hours() / 24)
+	if ageDays <= p.MaxAgeDays {
+		return ""
+	}
+	return fmt.Sprintf("latest history is from %s, %d days before the prediction date (max %d)",
+		historyDate.Format("2006-01-02"), ageDays, p.MaxAgeDays)
+}
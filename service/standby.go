@@ -0,0 +1,457 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// Limits of shadow predictions. Live predictions mirrored while maxShadowInFlight shadow
+// predictions are running are not shadowed, so a slow standby version never queues up work
+const (
+	maxShadowInFlight    = 4
+	shadowPredictTimeout = 30 * time.Second
+)
+
+// ErrNoStandbyModel is returned when there is no standby model version
+var ErrNoStandbyModel = errors.New("no standby model version")
+
+// ShadowPolicy says how much live traffic is mirrored to the standby model version and what its
+// shadow predictions must look like before it is promoted
+type ShadowPolicy struct {
+	// Percent of the live predictions mirrored; 0 installs new models directly
+	Percent              float64
+	MinSamples           int
+	MaxErrorPercent      float64
+	MaxDivergencePercent float64
+}
+
+// Enabled reports whether newly trained models wait in the standby slot before being promoted
+func (p ShadowPolicy) Enabled() bool {
+	return p.Percent > 0
+}
+
+// ShadowStats describes the shadow predictions of a standby version. Divergence is the mean absolute
+// difference from the predictions of the active version, in percent of their mean absolute value
+type ShadowStats struct {
+	Samples                int64      `json:"samples"`
+	Errors                 int64      `json:"errors"`
+	ErrorPercent           float64    `json:"error_percent"`
+	PriceDivergencePercent float64    `json:"price_divergence_percent"`
+	SalesDivergencePercent float64    `json:"sales_divergence_percent"`
+	MeanDurationMs         float64    `json:"mean_duration_ms"`
+	FirstAt                *time.Time `json:"first_at,omitempty"`
+	LastAt                 *time.Time `json:"last_at,omitempty"`
+}
+
+// StandbyStatus describes the standby slot
+type StandbyStatus struct {
+	Enabled       bool    `json:"enabled"`
+	ShadowPercent float64 `json:"shadow_percent"`
+	ActiveVersion string  `json:"active_version,omitempty"`
+	// Version is the standby version in the registry, empty when there is none
+	Version string `json:"version,omitempty"`
+	// Loaded tells whether this replica holds the models of the standby version and mirrors to them
+	Loaded bool         `json:"loaded"`
+	Shadow *ShadowStats `json:"shadow,omitempty"`
+	// Ready is set once the version has enough shadow predictions to be judged; Blocked lists the
+	// checks they fail, so a ready version with nothing blocked is promoted by the next job run
+	Ready   bool     `json:"ready"`
+	Blocked []string `json:"blocked,omitempty"`
+}
+
+// StandbyStore holds the standby version of the registry and its shadow predictions.
+// PostgresRepository implements it
+type StandbyStore interface {
+	GetStandbyModelVersion() (*repository.ModelVersion, error)
+	PromoteStandbyModelVersion(version string) (bool, error)
+	RejectStandbyModelVersion(version string, reasons []string) (bool, error)
+	SaveShadowPrediction(p *repository.ShadowPrediction) error
+	SummarizeShadowPredictions(version string) (*repository.ShadowSummary, error)
+}
+
+// StandbyModel is the warm standby slot of a blue/green model pair. A newly trained version is
+// loaded next to the active one and shadow-tested on a share of the live predictions, whose outputs
+// are recorded but never returned, and it is only promoted once its shadow predictions look sane
+type StandbyModel struct {
+	fileRepo      *repository.FileRepository
+	postgresRepo  StandbyStore
+	artifactStore repository.ArtifactStore
+	engine        InferenceEngine
+	modelCheck    *ModelCheck
+	policy        ShadowPolicy
+	lifecycle     *Lifecycle
+	events        *EventLog
+	golden        *GoldenSet
+	logger        *zap.SugaredLogger
+
+	// mu guards the slot. A shadow prediction still running when its version leaves the slot may
+	// fail, which is recorded against a version that is no longer evaluated
+	mu       sync.Mutex
+	version  string
+	dir      string
+	inFlight chan struct{}
+}
+
+// NewStandbyModel creates the standby slot. artifactStore may be nil, in which case only the
+// replica that trained a version holds its models
+func NewStandbyModel(fileRepo *repository.FileRepository, postgresRepo StandbyStore, artifactStore repository.ArtifactStore, engine InferenceEngine, modelCheck *ModelCheck, policy ShadowPolicy, lifecycle *Lifecycle, events *EventLog, golden *GoldenSet, logger *zap.SugaredLogger) *StandbyModel {
+	return &StandbyModel{
+		fileRepo:      fileRepo,
+		postgresRepo:  postgresRepo,
+		artifactStore: artifactStore,
+		engine:        engine,
+		modelCheck:    modelCheck,
+		policy:        policy,
+		lifecycle:     lifecycle,
+		events:        events,
+		golden:        golden,
+		logger:        logger,
+		inFlight:      make(chan struct{}, maxShadowInFlight),
+	}
+}
+
+// Enabled reports whether newly trained models go to the standby slot. Shadow predictions need an
+// inference engine able to run models other than the installed ones
+func (m *StandbyModel) Enabled() bool {
+	if m == nil || !m.policy.Enabled() {
+		return false
+	}
+	_, ok := m.engine.(StagedModelPredictor)
+	return ok
+}
+
+// Adopt loads the artifacts of a newly trained version, staged in stagingDir, into the slot. The
+// artifacts are moved out of stagingDir
+func (m *StandbyModel) Adopt(version, stagingDir string, artifacts []string) error {
+	dir, err := m.fileRepo.CreateStagingDir()
+	if err != nil {
+		return err
+	}
+	if err := m.fileRepo.MoveStagedArtifacts(stagingDir, dir, artifacts); err != nil {
+		m.fileRepo.RemoveStagingDir(dir)
+		return err
+	}
+	m.load(version, dir)
+	return nil
+}
+
+// Sync brings the slot in line with the standby version in the registry, downloading its models
+// from the artifact store when they are not loaded yet
+func (m *StandbyModel) Sync() error {
+	if m == nil {
+		return nil
+	}
+	standby, err := m.postgresRepo.GetStandbyModelVersion()
+	if err != nil {
+		return err
+	}
+	if standby == nil {
+		m.load("", "")
+		return nil
+	}
+	if standby.Version == m.Version() || m.artifactStore == nil {
+		return nil
+	}
+
+	dir, err := m.fileRepo.CreateStagingDir()
+	if err != nil {
+		return err
+	}
+	artifacts, err := downloadModelArtifacts(m.artifactStore, m.fileRepo, standby.Version, dir)
+	if err == nil {
+		err = m.fileRepo.VerifyStagedArtifacts(dir, artifacts)
+	}
+	if err != nil {
+		m.fileRepo.RemoveStagingDir(dir)
+		return fmt.Errorf("failed to load standby model version %s: %w", standby.Version, err)
+	}
+	m.load(standby.Version, dir)
+	return nil
+}
+
+// load swaps the models in the slot, removing the previous ones; an empty version empties it
+func (m *StandbyModel) load(version, dir string) {
+	m.mu.Lock()
+	previousVersion, previousDir := m.version, m.dir
+	m.version, m.dir = version, dir
+	m.mu.Unlock()
+
+	if previousDir != "" && previousDir != dir {
+		if err := m.fileRepo.RemoveStagingDir(previousDir); err != nil {
+			m.logger.Warnw("Failed to remove standby models", "error", err, "version", previousVersion)
+		}
+	}
+	if version != previousVersion && version != "" {
+		m.logger.Infow("Standby model version loaded", "version", version, "shadow_percent", m.policy.Percent)
+	}
+}
+
+// Version returns the version whose models the slot holds, or "" when it is empty
+func (m *StandbyModel) Version() string {
+	if m == nil {
+		return ""
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.version
+}
+
+// Mirror shadows a live prediction of the active version with the standby one, for a sampled share
+// of the predictions. The shadow prediction runs in the background and only its outcome is
+// recorded; it never changes the result the caller gets
+func (m *StandbyModel) Mirror(request *PredictionRequest, result *PredictionResult, activeVersion string) {
+	if m == nil || m.policy.Percent <= 0 || m.Version() == "" {
+		return
+	}
+	if rand.Float64()*100 >= m.policy.Percent {
+		return
+	}
+	predictor, ok := m.engine.(StagedModelPredictor)
+	if !ok {
+		return
+	}
+	select {
+	case m.inFlight <- struct{}{}:
+	default:
+		return
+	}
+
+	// The request may be reused by the caller once the prediction is returned
+	mirrored := *request
+	active := *result
+	go func() {
+		defer func() { <-m.inFlight }()
+		m.shadow(predictor, &mirrored, &active, activeVersion)
+	}()
+}
+
+// shadow runs a mirrored prediction on the standby models and records it
+func (m *StandbyModel) shadow(predictor StagedModelPredictor, request *PredictionRequest, active *PredictionResult, activeVersion string) {
+	m.mu.Lock()
+	version, dir := m.version, m.dir
+	m.mu.Unlock()
+	if version == "" {
+		return
+	}
+
+	// Shadow predictions yield the prediction processes to the live traffic they mirror
+	ctx, cancel := context.WithTimeout(WithInferencePriority(m.lifecycle.Context(), PriorityBatch), shadowPredictTimeout)
+	started := time.Now()
+	result, err := predictor.PredictWithModels(ctx, request, dir)
+	duration := time.Since(started)
+	cancel()
+
+	prediction := &repository.ShadowPrediction{
+		ModelVersion:  version,
+		ActiveVersion: activeVersion,
+		PredictionID:  active.PredictionID,
+		ActivePrice:   active.PredictedPrice,
+		ActiveSales:   active.PredictedSales,
+		DurationMs:    duration.Milliseconds(),
+		CreatedAt:     started,
+	}
+	if err != nil {
+		prediction.Error = err.Error()
+		m.logger.Warnw("Shadow prediction failed", "error", err, "version", version, "product", request.ProductName)
+	} else {
+		prediction.ShadowPrice = &result.PredictedPrice
+		prediction.ShadowSales = &result.PredictedSales
+		m.logger.Debugw("Shadow prediction", "version", version, "active_version", activeVersion,
+			"active_price", active.PredictedPrice, "shadow_price", result.PredictedPrice,
+			"active_sales", active.PredictedSales, "shadow_sales", result.PredictedSales)
+	}
+	if err := m.postgresRepo.SaveShadowPrediction(prediction); err != nil {
+		m.logger.Errorw("Failed to record shadow prediction", "error", err, "version", version)
+	}
+}
+
+// Status describes the standby version in the registry and how its shadow predictions compare with
+// the promotion thresholds
+func (m *StandbyModel) Status() (*StandbyStatus, error) {
+	status := &StandbyStatus{
+		Enabled:       m.Enabled(),
+		ShadowPercent: m.policy.Percent,
+		ActiveVersion: m.fileRepo.ReadModelVersion(),
+	}
+
+	standby, err := m.postgresRepo.GetStandbyModelVersion()
+	if err != nil {
+		return nil, err
+	}
+	if standby == nil {
+		return status, nil
+	}
+	status.Version = standby.Version
+	status.Loaded = standby.Version == m.Version()
+
+	summary, err := m.postgresRepo.SummarizeShadowPredictions(standby.Version)
+	if err != nil {
+		return nil, err
+	}
+	stats := shadowStats(summary)
+	status.Shadow = stats
+	status.Ready = stats.Samples >= int64(m.policy.MinSamples)
+	status.Blocked = m.policy.check(stats)
+	return status, nil
+}
+
+// shadowStats turns the aggregates of the shadow predictions into percentages
+func shadowStats(summary *repository.ShadowSummary) *ShadowStats {
+	stats := &ShadowStats{
+		Samples:                summary.Samples,
+		Errors:                 summary.Errors,
+		PriceDivergencePercent: divergencePercent(summary.PriceDiffMean, summary.ActivePriceMean),
+		SalesDivergencePercent: divergencePercent(summary.SalesDiffMean, summary.ActiveSalesMean),
+		MeanDurationMs:         summary.DurationMsMean,
+		FirstAt:                summary.FirstAt,
+		LastAt:                 summary.LastAt,
+	}
+	if summary.Samples > 0 {
+		stats.ErrorPercent = float64(summary.Errors) / float64(summary.Samples) * 100
+	}
+	return stats
+}
+
+// divergencePercent is the mean absolute difference in percent of the mean absolute value it is
+// measured against. Any difference from outputs that are all zero counts as a full divergence
+func divergencePercent(diffMean, mean float64) float64 {
+	if mean == 0 {
+		if diffMean == 0 {
+			return 0
+		}
+		return 100
+	}
+	return diffMean / mean * 100
+}
+
+// check returns the thresholds the shadow predictions exceed
+func (p ShadowPolicy) check(stats *ShadowStats) []string {
+	var blocked []string
+	if stats.ErrorPercent > p.MaxErrorPercent {
+		blocked = append(blocked, fmt.Sprintf("%.2f%% of shadow predictions failed, more than %g%%", stats.ErrorPercent, p.MaxErrorPercent))
+	}
+	if stats.PriceDivergencePercent > p.MaxDivergencePercent {
+		blocked = append(blocked, fmt.Sprintf("price predictions diverge by %.2f%%, more than %g%%", stats.PriceDivergencePercent, p.MaxDivergencePercent))
+	}
+	if stats.SalesDivergencePercent > p.MaxDivergencePercent {
+		blocked = append(blocked, fmt.Sprintf("sales predictions diverge by %.2f%%, more than %g%%", stats.SalesDivergencePercent, p.MaxDivergencePercent))
+	}
+	return blocked
+}
+
+// Evaluate judges the standby version once it has enough shadow predictions: it is promoted when
+// they pass every check and rejected otherwise. It is the standby_promotion job
+func (m *StandbyModel) Evaluate(ctx context.Context) error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	if status.Version == "" {
+		return nil
+	}
+	if !status.Ready {
+		m.logger.Infow("Standby model version is waiting for shadow predictions", "version", status.Version,
+			"samples", status.Shadow.Samples, "min_samples", m.policy.MinSamples)
+		return nil
+	}
+	if len(status.Blocked) > 0 {
+		return m.reject(status, status.Blocked)
+	}
+	_, err = m.promote(ctx, status)
+	return err
+}
+
+// Promote makes the standby version the active one whatever its shadow predictions look like
+func (m *StandbyModel) Promote(ctx context.Context) (*StandbyStatus, error) {
+	status, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	if status.Version == "" {
+		return nil, ErrNoStandbyModel
+	}
+	return m.promote(ctx, status)
+}
+
+// Discard takes the standby version out of the slot without promoting it
+func (m *StandbyModel) Discard() (*StandbyStatus, error) {
+	status, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	if status.Version == "" {
+		return nil, ErrNoStandbyModel
+	}
+	if err := m.reject(status, []string{"discarded from the standby slot"}); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// promote activates the standby version in the registry and installs its models on this replica
+// when it holds them; the other replicas pick it up with their model synchronizer
+func (m *StandbyModel) promote(ctx context.Context, status *StandbyStatus) (*StandbyStatus, error) {
+	promoted, err := m.postgresRepo.PromoteStandbyModelVersion(status.Version)
+	if err != nil {
+		return nil, err
+	}
+	if !promoted {
+		return nil, ErrNoStandbyModel
+	}
+	m.events.Record(EventModelPromoted, status.Version, ModelPromotedDetails{
+		PreviousVersion: status.ActiveVersion,
+		Shadow:          status.Shadow,
+	})
+	m.logger.Infow("Standby model version promoted", "version", status.Version, "previous_version", status.ActiveVersion)
+
+	m.mu.Lock()
+	dir := ""
+	if m.version == status.Version {
+		dir = m.dir
+	}
+	m.version, m.dir = "", ""
+	m.mu.Unlock()
+	if dir == "" {
+		return status, nil
+	}
+
+	if err := installModelArtifacts(m.fileRepo, m.modelCheck, dir); err != nil {
+		return nil, fmt.Errorf("error installing promoted models: %w", err)
+	}
+	if err := m.fileRepo.WriteModelVersion(status.Version); err != nil {
+		return nil, err
+	}
+	if err := m.engine.Load(ctx); err != nil {
+		return nil, fmt.Errorf("error loading promoted models: %w", err)
+	}
+	m.golden.VerifyLoaded(ctx)
+	return status, nil
+}
+
+// reject takes the standby version out of the registry's standby slot and this replica's
+func (m *StandbyModel) reject(status *StandbyStatus, reasons []string) error {
+	rejected, err := m.postgresRepo.RejectStandbyModelVersion(status.Version, reasons)
+	if err != nil {
+		return err
+	}
+	if !rejected {
+		return ErrNoStandbyModel
+	}
+	m.events.Record(EventModelStandbyRejected, status.Version, ModelStandbyRejectedDetails{
+		Reasons: reasons,
+		Shadow:  status.Shadow,
+	})
+	m.logger.Warnw("Standby model version rejected", "version", status.Version, "reasons", reasons)
+
+	if m.Version() == status.Version {
+		m.load("", "")
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/features"
+	"github.com/graduate-work-mirea/data-processor-service/internal/metrics"
+)
+
+// Service status values
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+)
+
+// dependencyCheckTimeout bounds each dependency check so that /status stays responsive
+const dependencyCheckTimeout = 2 * time.Second
+
+// CheckConsumerLag is the dependency check failing while consumed RabbitMQ queues are too far behind
+const CheckConsumerLag = "rabbitmq_consumer_lag"
+
+// readinessDependencies are the dependency checks that must pass before a replica receives traffic:
+// the inference engine has its models loaded, the database is reachable and, when a threshold is
+// configured, the consumers keep up with their queues
+var readinessDependencies = []string{"inference_engine", "postgres", CheckConsumerLag}
+
+// DependencyCheck reports an error when a dependency is unavailable
+type DependencyCheck func(ctx context.Context) error
+
+// DependencyStatus is the outcome of a dependency check
+type DependencyStatus struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// ModelStatus describes the models served by this replica
+type ModelStatus struct {
+	Trained bool `json:"trained"`
+	// Problems found when validating the installed artifacts, such as a checksum mismatch
+	Problems []string `json:"problems,omitempty"`
+	// LocalVersion is the version installed in the model directory
+	LocalVersion string `json:"local_version,omitempty"`
+	// RegistryVersion is the version marked active in the model registry
+	RegistryVersion string `json:"registry_version,omitempty"`
+	// LagMode is how the installed models count the days of lag features
+	LagMode features.LagMode `json:"lag_mode,omitempty"`
+	// Interpolation is how the installed models fill days missing from the history
+	Interpolation features.Interpolation `json:"interpolation,omitempty"`
+	// Targets are the targets the installed models predict
+	Targets []string `json:"targets,omitempty"`
+	// TrainingWindow is the window of training rows the installed models learned from
+	TrainingWindow string `json:"training_window,omitempty"`
+	Engine         string `json:"engine"`
+}
+
+// ServiceStatus is the status document returned by GET /api/v1/status
+type ServiceStatus struct {
+	Status string `json:"status"`
+	// ModelsTrained is kept for clients of the original status endpoint
+	ModelsTrained bool                        `json:"models_trained"`
+	StartedAt     time.Time                   `json:"started_at"`
+	UptimeSeconds float64                     `json:"uptime_seconds"`
+	Models        ModelStatus                 `json:"models"`
+	LastTraining  *TrainingRun                `json:"last_training,omitempty"`
+	Routes        []metrics.RouteStats        `json:"routes"`
+	Dependencies  map[string]DependencyStatus `json:"dependencies"`
+	Lifecycle     LifecycleState              `json:"lifecycle"`
+	// Disk is the latest disk usage of the service directories
+	Disk *DiskReport `json:"disk,omitempty"`
+}
+
+// StatusService assembles the service status document
+type StatusService struct {
+	mlService   *MLPredictionService
+	httpMetrics *metrics.HTTPMetrics
+	engineName  string
+	checks      map[string]DependencyCheck
+	disk        *DiskMonitor
+	lifecycle   *Lifecycle
+	startedAt   time.Time
+}
+
+// NewStatusService creates a new status service.
+// checks maps dependency names, such as "postgres", to their health checks.
+func NewStatusService(mlService *MLPredictionService, httpMetrics *metrics.HTTPMetrics, engineName string, checks map[string]DependencyCheck, disk *DiskMonitor, lifecycle *Lifecycle) *StatusService {
+	return &StatusService{
+		mlService:   mlService,
+		httpMetrics: httpMetrics,
+		engineName:  engineName,
+		checks:      checks,
+		disk:        disk,
+		lifecycle:   lifecycle,
+		startedAt:   time.Now(),
+	}
+}
+
+// Status returns the current status of the service. The status is degraded when any dependency
+// check fails or no models are trained.
+func (s *StatusService) Status(ctx context.Context) *ServiceStatus {
+	modelCheck := s.mlService.CheckModels()
+	status := &ServiceStatus{
+		Status:        StatusOK,
+		ModelsTrained: modelCheck.Valid,
+		StartedAt:     s.startedAt,
+		UptimeSeconds: time.Since(s.startedAt).Seconds(),
+		Models: ModelStatus{
+			LocalVersion: s.mlService.ActiveModelVersion(),
+			Engine:       s.engineName,
+		},
+		Routes:       s.httpMetrics.Routes(),
+		Dependencies: s.checkDependencies(ctx),
+		Lifecycle:    s.lifecycle.State(),
+		Disk:         s.disk.Last(),
+	}
+	status.Models.Trained = status.ModelsTrained
+	status.Models.Problems = modelCheck.Problems
+	status.Models.LagMode = modelCheck.LagMode
+	status.Models.Interpolation = modelCheck.Interpolation
+	status.Models.Targets = modelCheck.Targets
+	status.Models.TrainingWindow = modelCheck.TrainingWindow
+	if status.Routes == nil {
+		status.Routes = []metrics.RouteStats{}
+	}
+
+	if active, err := s.mlService.postgresRepo.GetActiveModelVersion(); err == nil && active != nil {
+		status.Models.RegistryVersion = active.Version
+	}
+
+	if runs, _, err := s.mlService.ListTrainingRuns(1, 0); err == nil && len(runs) > 0 {
+		last := runs[0]
+		// The Python output is available from the training history
+		last.PythonOutput = ""
+		status.LastTraining = &last
+	}
+
+	if !status.ModelsTrained {
+		status.Status = StatusDegraded
+	}
+	for _, dependency := range status.Dependencies {
+		if dependency.Status != StatusOK {
+			status.Status = StatusDegraded
+		}
+	}
+	return status
+}
+
+// Readiness returns the reasons the replica cannot serve predictions yet, or nil when it is ready
+func (s *StatusService) Readiness(ctx context.Context) []string {
+	var reasons []string
+	if state := s.lifecycle.State(); state.LameDuck {
+		reasons = append(reasons, fmt.Sprintf("lame_duck: draining since %s", state.LameDuckSince.Format(time.RFC3339)))
+	}
+	for _, name := range readinessDependencies {
+		check, ok := s.checks[name]
+		if !ok {
+			continue
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+		err := check(checkCtx)
+		cancel()
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	return reasons
+}
+
+// checkDependencies runs all dependency checks concurrently
+func (s *StatusService) checkDependencies(ctx context.Context) map[string]DependencyStatus {
+	names := make([]string, 0, len(s.checks))
+	for name := range s.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]DependencyStatus, len(names))
+	done := make(chan struct{})
+	for i, name := range names {
+		go func(i int, check DependencyCheck) {
+			defer func() { done <- struct{}{} }()
+
+			checkCtx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+			defer cancel()
+
+			started := time.Now()
+			err := check(checkCtx)
+			results[i] = DependencyStatus{
+				Status:    StatusOK,
+				LatencyMs: float64(time.Since(started).Microseconds()) / 1000,
+			}
+			if err != nil {
+				results[i].Status = "unavailable"
+				results[i].Error = err.Error()
+			}
+		}(i, s.checks[name])
+	}
+	for range names {
+		<-done
+	}
+
+	dependencies := make(map[string]DependencyStatus, len(names))
+	for i, name := range names {
+		dependencies[name] = results[i]
+	}
+	return dependencies
+}
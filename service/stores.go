@@ -0,0 +1,69 @@
+package service
+
+import (
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+// PredictionStore is the database of MLPredictionService: the history it resolves features from,
+// the catalog and promotions the models read, and the records of its predictions, forecasts,
+// training runs and model versions. PostgresRepository implements it
+type PredictionStore interface {
+	// History and reference data
+	CountProcessedRows() (int64, error)
+	GetHistoryRange(productName, region, seller string) (*repository.HistoryRange, error)
+	GetLastObservation(productName, region, seller string, date time.Time) (*repository.LastObservation, error)
+	GetProductHistoricalData(productName, region, seller string, date time.Time, lags repository.LagDates) (*repository.ProductHistoricalData, error)
+	GetProductSeries(productName, region, seller string, from, to time.Time) ([]repository.SeriesPoint, error)
+	GetCategoryBaseline(category, region string, date time.Time, windowDays int) (*repository.CategoryBaseline, error)
+	GetSegmentVolumes(since time.Time) ([]repository.SegmentVolume, error)
+	GetProduct(productName string) (*repository.Product, error)
+	GetSellerStats(seller string) (*repository.SellerStats, error)
+	AllSellerStats() ([]repository.SellerStats, error)
+	PromotionsFor(productName, category string, from, to time.Time) ([]repository.Promotion, error)
+	AllPromotions() ([]repository.Promotion, error)
+
+	// Predictions and forecasts
+	SavePredictionLog(entry *repository.PredictionLogEntry) (int64, error)
+	GetPredictionLog(id int64) (*repository.PredictionLogEntry, error)
+	ListRecentPredictionLogs(limit int, modelVersion string) ([]repository.PredictionLogEntry, error)
+	SaveForecast(forecast *repository.Forecast) (int64, error)
+
+	// Training runs and model versions
+	SaveTrainingRun(run *repository.TrainingRun) (int64, error)
+	ListTrainingRuns(limit, offset int) ([]repository.TrainingRun, int, error)
+	GetTrainingRunLearningCurve(id int64) ([]byte, bool, error)
+	RegisterModelVersion(v *repository.ModelVersion) error
+	GetActiveModelVersion() (*repository.ModelVersion, error)
+	ListModelVersions(from, to time.Time) ([]repository.ModelVersion, error)
+	ListModelVersionPage(limit, offset int) ([]repository.ModelVersion, int, error)
+}
+
+// The stores of the components are declared next to them
+var (
+	_ PredictionStore        = (*repository.PostgresRepository)(nil)
+	_ ModelSyncStore         = (*repository.PostgresRepository)(nil)
+	_ FeatureFlagStore       = (*repository.PostgresRepository)(nil)
+	_ TrainingJobStore       = (*repository.PostgresRepository)(nil)
+	_ OutboxStore            = (*repository.PostgresRepository)(nil)
+	_ RecommendationStore    = (*repository.PostgresRepository)(nil)
+	_ ForecastRecomputeStore = (*repository.PostgresRepository)(nil)
+	_ ReportStore            = (*repository.PostgresRepository)(nil)
+	_ ForecastStore          = (*repository.PostgresRepository)(nil)
+	_ ForecastActualsStore   = (*repository.PostgresRepository)(nil)
+	_ ProductStore           = (*repository.PostgresRepository)(nil)
+	_ RetrainStore           = (*repository.PostgresRepository)(nil)
+	_ SimulationStore        = (*repository.PostgresRepository)(nil)
+	_ BatchPredictionStore   = (*repository.PostgresRepository)(nil)
+	_ PromotionStore         = (*repository.PostgresRepository)(nil)
+	_ APIUsageStore          = (*repository.PostgresRepository)(nil)
+	_ SellerStatsStore       = (*repository.PostgresRepository)(nil)
+	_ GoldenOutputStore      = (*repository.PostgresRepository)(nil)
+	_ BacktestStore          = (*repository.PostgresRepository)(nil)
+	_ AuditStore             = (*repository.PostgresRepository)(nil)
+	_ EventStore             = (*repository.PostgresRepository)(nil)
+	_ JobExecutionStore      = (*repository.PostgresRepository)(nil)
+	_ QueueWeightStore       = (*repository.PostgresRepository)(nil)
+	_ StandbyStore           = (*repository.PostgresRepository)(nil)
+)
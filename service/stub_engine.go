@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// StubInferenceEngine answers predictions without running a model. It isolates the cost of the
+// service itself (HTTP handling, feature resolution, prediction logging) in load tests: a
+// benchmark run against it is compared with one against a real engine to see what the model adds
+type StubInferenceEngine struct {
+	latency time.Duration
+}
+
+// NewStubInferenceEngine creates a stub engine that takes latency to answer each call
+func NewStubInferenceEngine(latency time.Duration) *StubInferenceEngine {
+	return &StubInferenceEngine{latency: latency}
+}
+
+// Predict echoes the request: the current price and the last day's sales
+func (e *StubInferenceEngine) Predict(ctx context.Context, request *PredictionRequest) (*PredictionResult, error) {
+	if err := e.wait(ctx); err != nil {
+		return nil, err
+	}
+	return stubPrediction(request), nil
+}
+
+// PredictBatch answers all requests after a single delay, like one model call would
+func (e *StubInferenceEngine) PredictBatch(ctx context.Context, requests []*PredictionRequest) ([]PredictionResult, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	if err := e.wait(ctx); err != nil {
+		return nil, err
+	}
+
+	results := make([]PredictionResult, len(requests))
+	for i, request := range requests {
+		results[i] = *stubPrediction(request)
+	}
+	return results, nil
+}
+
+// Explain is not supported, the stub has no features to attribute to
+func (e *StubInferenceEngine) Explain(ctx context.Context, request *PredictionRequest) (*PredictionExplanation, error) {
+	return nil, ErrExplainNotSupported
+}
+
+// Load does nothing, the stub serves no models
+func (e *StubInferenceEngine) Load(ctx context.Context) error {
+	return nil
+}
+
+// Health always succeeds
+func (e *StubInferenceEngine) Health(ctx context.Context) error {
+	return nil
+}
+
+// wait simulates the model latency
+func (e *StubInferenceEngine) wait(ctx context.Context) error {
+	if e.latency <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(e.latency)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func stubPrediction(request *PredictionRequest) *PredictionResult {
+	return &PredictionResult{
+		PredictedPrice: request.Price,
+		PredictedSales: request.SalesQuantityLag1,
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/internal/evaluation"
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+)
+
+const (
+	defaultTimeSeriesDays = 90
+	maxTimeSeriesDays     = 366
+	// timeSeriesBandLevel is the coverage of the confidence bands, timeSeriesBandZ its normal quantile
+	timeSeriesBandLevel = 0.95
+	timeSeriesBandZ     = 1.96
+	// minBandForecasts is the number of forecasts with actuals needed before bands are drawn
+	minBandForecasts = 3
+)
+
+// ErrInvalidTimeSeriesRequest is returned when a time series request fails validation
+var ErrInvalidTimeSeriesRequest = errors.New("invalid time series request")
+
+// TimeSeriesPoint is a day of a product's chart. Price and sales are the day's history; the
+// forecast fields are those of the latest forecast made on the day, whose sales cover the
+// following horizon. Missing values are null, so that every day of the range has a point
+type TimeSeriesPoint struct {
+	Date               time.Time `json:"date"`
+	Price              *float64  `json:"price"`
+	Sales              *float64  `json:"sales"`
+	ForecastPrice      *float64  `json:"forecast_price"`
+	ForecastPriceLower *float64  `json:"forecast_price_lower"`
+	ForecastPriceUpper *float64  `json:"forecast_price_upper"`
+	ForecastSales      *float64  `json:"forecast_sales"`
+	ForecastSalesLower *float64  `json:"forecast_sales_lower"`
+	ForecastSalesUpper *float64  `json:"forecast_sales_upper"`
+	ModelVersion       string    `json:"model_version,omitempty"`
+}
+
+// TimeSeries is the history of a product, region and seller merged with its stored forecasts
+type TimeSeries struct {
+	ProductName string    `json:"product_name"`
+	Region      string    `json:"region"`
+	Seller      string    `json:"seller"`
+	Category    string    `json:"category,omitempty"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	HorizonDays int       `json:"horizon_days"`
+	// BandLevel is the coverage of the confidence bands, BandForecasts the number of forecasts with
+	// actuals their width was estimated from. Bands are null with fewer than minBandForecasts
+	BandLevel     float64           `json:"band_level"`
+	BandForecasts int64             `json:"band_forecasts"`
+	Points        []TimeSeriesPoint `json:"points"`
+
+	// priceErrors and salesErrors accumulate the errors of the forecasts with actuals
+	priceErrors evaluation.Accumulator
+	salesErrors evaluation.Accumulator
+}
+
+// TimeSeries returns one point per day of [from, to] with the actual price and sales of the key
+// and its latest stored forecasts. Zero dates default to the last defaultTimeSeriesDays days.
+//
+// The bands are predicted ± 1.96 RMSE of the forecasts in the range whose actuals are known,
+// assuming normally distributed errors, and never go below zero
+func (s *ForecastService) TimeSeries(productName, region, seller string, from, to time.Time) (*TimeSeries, error) {
+	from, to, err := timeSeriesRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.postgresRepo.GetProductSeries(productName, region, seller, from, to)
+	if err != nil {
+		return nil, err
+	}
+	forecasts, err := s.postgresRepo.GetLatestForecasts(productName, region, seller, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	series := newTimeSeries(from, to, history, forecasts)
+	series.ProductName, series.Region, series.Seller = productName, region, seller
+	return series, nil
+}
+
+// CategoryTimeSeries is TimeSeries over all the products, regions and sellers of a category: the
+// daily mean price and total sales, and the sum of their latest forecasts
+func (s *ForecastService) CategoryTimeSeries(category string, from, to time.Time) (*TimeSeries, error) {
+	from, to, err := timeSeriesRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.postgresRepo.GetCategorySeries(category, from, to)
+	if err != nil {
+		return nil, err
+	}
+	forecasts, err := s.postgresRepo.GetCategoryForecasts(category, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	series := newTimeSeries(from, to, history, forecasts)
+	series.Category = category
+	return series, nil
+}
+
+// timeSeriesRange applies the defaults of a time series range and validates it
+func timeSeriesRange(from, to time.Time) (time.Time, time.Time, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	to = calendarDay(to)
+	if from.IsZero() {
+		from = to.AddDate(0, 0, 1-defaultTimeSeriesDays)
+	}
+	from = calendarDay(from)
+	if to.Before(from) {
+		return from, to, fmt.Errorf("%w: to must not be before from", ErrInvalidTimeSeriesRequest)
+	}
+	if days := int(to.Sub(from).Hours()/24) + 1; days > maxTimeSeriesDays {
+		return from, to, fmt.Errorf("%w: the range may cover at most %d days", ErrInvalidTimeSeriesRequest, maxTimeSeriesDays)
+	}
+	return from, to, nil
+}
+
+// newTimeSeries merges history and forecasts into one point per day of [from, to]
+func newTimeSeries(from, to time.Time, history []repository.SeriesPoint, forecasts []repository.Forecast) *TimeSeries {
+	series := &TimeSeries{
+		From:        from,
+		To:          to,
+		HorizonDays: salesForecastDays,
+		BandLevel:   timeSeriesBandLevel,
+		Points:      make([]TimeSeriesPoint, int(to.Sub(from).Hours()/24)+1),
+	}
+	for i := range series.Points {
+		series.Points[i].Date = from.AddDate(0, 0, i)
+	}
+
+	for _, row := range history {
+		if point := series.point(row.Date); point != nil {
+			point.Price = nullFloatPointer(row.Price)
+			point.Sales = nullFloatPointer(row.Sales)
+		}
+	}
+
+	series.priceErrors, series.salesErrors = forecastErrors(forecasts)
+	series.BandForecasts = series.salesErrors.Count()
+	for i := range forecasts {
+		f := &forecasts[i]
+		point := series.point(f.ForecastDate)
+		if point == nil {
+			continue
+		}
+		point.ForecastPrice, point.ForecastSales = &f.PredictedPrice, &f.PredictedSales
+		point.ForecastPriceLower, point.ForecastPriceUpper = confidenceBand(f.PredictedPrice, &series.priceErrors)
+		point.ForecastSalesLower, point.ForecastSalesUpper = confidenceBand(f.PredictedSales, &series.salesErrors)
+		point.ModelVersion = f.ModelVersion
+	}
+	return series
+}
+
+// forecastErrors accumulates the price and sales errors of the forecasts whose actuals are known
+func forecastErrors(forecasts []repository.Forecast) (price, sales evaluation.Accumulator) {
+	for i := range forecasts {
+		f := &forecasts[i]
+		if f.ActualSales != nil {
+			sales.Add(*f.ActualSales, f.PredictedSales)
+		}
+		if f.ActualPrice != nil {
+			price.Add(*f.ActualPrice, f.PredictedPrice)
+		}
+	}
+	return price, sales
+}
+
+// point returns the point of a date, or nil when the date is outside the series
+func (t *TimeSeries) point(date time.Time) *TimeSeriesPoint {
+	i := int(calendarDay(date).Sub(t.From).Hours() / 24)
+	if i < 0 || i >= len(t.Points) {
+		return nil
+	}
+	return &t.Points[i]
+}
+
+// confidenceBand returns the bounds of the band around predicted from the errors accumulated in
+// errs, or nils when too few errors are known
+func confidenceBand(predicted float64, errs *evaluation.Accumulator) (*float64, *float64) {
+	rmse, ok := errs.Metric(evaluation.RMSE)
+	if !ok || errs.Count() < minBandForecasts {
+		return nil, nil
+	}
+	lower := math.Max(0, predicted-timeSeriesBandZ*rmse)
+	upper := predicted + timeSeriesBandZ*rmse
+	return &lower, &upper
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/graduate-work-mirea/data-processor-service/repository"
+	"go.uber.org/zap"
+)
+
+// Training job statuses; a job ends succeeded or failed like a training run
+const (
+	TrainingJobQueued  = "queued"
+	TrainingJobRunning = "running"
+)
+
+// Stages a running training job goes through
+const (
+	TrainingStagePreparing  = "preparing"
+	TrainingStageTraining   = "training"
+	TrainingStageInstalling = "installing"
+)
+
+// trainingJobHeartbeat is how often a worker records that a training job is still running, and
+// trainingJobStaleAfter how long a job may go without a heartbeat before another worker takes it
+// over
+const (
+	trainingJobHeartbeat  = 30 * time.Second
+	trainingJobStaleAfter = 4 * trainingJobHeartbeat
+)
+
+// TrainingJob is the state of an asynchronous training request
+type TrainingJob struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"`
+	// Stage is how far a running job got: preparing, training or installing
+	Stage       string          `json:"stage,omitempty"`
+	Sample      *TrainingSample `json:"sample,omitempty"`
+	RequestedBy string          `json:"requested_by,omitempty"`
+	// Replica is the worker running the job, and Attempts how many times a worker started it;
+	// more than one means it was interrupted and taken over
+	Replica  string          `json:"replica,omitempty"`
+	Attempts int             `json:"attempts"`
+	Result   *TrainingResult `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	// PythonOutput is the end of the training script's output when it printed no metrics
+	PythonOutput string     `json:"python_output,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	HeartbeatAt  *time.Time `json:"heartbeat_at,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// trainingJobResult is the stored result of a job, the training result together with the script
+// output of a run that printed no metrics
+type trainingJobResult struct {
+	*TrainingResult
+	PythonOutput string `json:"python_output,omitempty"`
+}
+
+// TrainingJobStore is the queue of training jobs shared by the replicas. PostgresRepository
+// implements it
+type TrainingJobStore interface {
+	CreateTrainingJob(sample []byte, requestedBy string) (int64, error)
+	GetTrainingJob(id int64) (*repository.TrainingJob, error)
+	ClaimTrainingJob(replica string, staleAfter time.Duration, maxAttempts int) (*repository.TrainingJob, error)
+	UpdateTrainingJobStage(id int64, replica string, attempts int, stage string) error
+	FinishTrainingJob(id int64, replica string, attempts int, status string, result []byte, errMsg string) error
+}
+
+// TrainingJobs queues training requests in the database and runs them on the workers, so that
+// a request returns at once and the job outlives the replica that accepted it. A worker records a
+// heartbeat while it trains; the job of a worker that stopped sending them is run again by another
+type TrainingJobs struct {
+	mlService    *MLPredictionService
+	postgresRepo TrainingJobStore
+	timeout      time.Duration
+	pollInterval time.Duration
+	maxAttempts  int
+	lifecycle    *Lifecycle
+	logger       *zap.SugaredLogger
+}
+
+// NewTrainingJobs creates the training job queue. Jobs are given timeout to train, and a job
+// interrupted maxAttempts times fails
+func NewTrainingJobs(mlService *MLPredictionService, postgresRepo TrainingJobStore, timeout, pollInterval time.Duration, maxAttempts int, lifecycle *Lifecycle, logger *zap.SugaredLogger) *TrainingJobs {
+	return &TrainingJobs{
+		mlService:    mlService,
+		postgresRepo: postgresRepo,
+		timeout:      timeout,
+		pollInterval: pollInterval,
+		maxAttempts:  maxAttempts,
+		lifecycle:    lifecycle,
+		logger:       logger,
+	}
+}
+
+// Submit queues a training job, on a sample of the training rows when sample is set
+func (j *TrainingJobs) Submit(sample *TrainingSample, requestedBy string) (*TrainingJob, error) {
+	var sampleJSON []byte
+	if sample != nil {
+		if err := sample.validate(); err != nil {
+			return nil, err
+		}
+		sampleJSON, _ = json.Marshal(sample)
+	}
+
+	id, err := j.postgresRepo.CreateTrainingJob(sampleJSON, requestedBy)
+	if err != nil {
+		return nil, err
+	}
+	return j.Get(id)
+}
+
+// Get returns a training job by ID, or nil if it does not exist
+func (j *TrainingJobs) Get(id int64) (*TrainingJob, error) {
+	stored, err := j.postgresRepo.GetTrainingJob(id)
+	if err != nil || stored == nil {
+		return nil, err
+	}
+	return newTrainingJob(stored)
+}
+
+// newTrainingJob converts a stored training job
+func newTrainingJob(stored *repository.TrainingJob) (*TrainingJob, error) {
+	job := &TrainingJob{
+		ID:          stored.ID,
+		Status:      stored.Status,
+		Stage:       stored.Stage,
+		RequestedBy: stored.RequestedBy,
+		Replica:     stored.Replica,
+		Attempts:    stored.Attempts,
+		Error:       stored.Error,
+		CreatedAt:   stored.CreatedAt,
+		StartedAt:   stored.StartedAt,
+		HeartbeatAt: stored.HeartbeatAt,
+		FinishedAt:  stored.FinishedAt,
+	}
+	if len(stored.Sample) > 0 {
+		if err := json.Unmarshal(stored.Sample, &job.Sample); err != nil {
+			return nil, fmt.Errorf("error parsing training job sample: %v", err)
+		}
+	}
+	if len(stored.Result) > 0 {
+		var result trainingJobResult
+		if err := json.Unmarshal(stored.Result, &result); err != nil {
+			return nil, fmt.Errorf("error parsing training job result: %v", err)
+		}
+		job.Result, job.PythonOutput = result.TrainingResult, result.PythonOutput
+	}
+	return job, nil
+}
+
+// Run claims and runs queued training jobs one at a time until ctx is cancelled. A replica in
+// lame-duck mode claims no new jobs
+func (j *TrainingJobs) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// A job that just finished may have been followed by others, which are run without waiting
+		for j.runNext() {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext runs the next claimable job, reporting whether there was one
+func (j *TrainingJobs) runNext() bool {
+	done, err := j.lifecycle.BeginJob()
+	if err != nil {
+		return false
+	}
+	defer done()
+
+	stored, err := j.postgresRepo.ClaimTrainingJob(replicaName(), trainingJobStaleAfter, j.maxAttempts)
+	if err != nil {
+		j.logger.Errorw("Failed to claim training job", "error", err)
+		return false
+	}
+	if stored == nil {
+		return false
+	}
+	job, err := newTrainingJob(stored)
+	if err != nil {
+		j.finish(&TrainingJob{ID: stored.ID, Replica: stored.Replica, Attempts: stored.Attempts}, TrainingStatusFailed, nil, err.Error())
+		return true
+	}
+
+	j.run(job)
+	return true
+}
+
+// run trains the models of a claimed job and records its outcome. A job cut short by the
+// shutdown of the replica is queued again for another worker, and one whose claim was lost to
+// another worker is abandoned
+func (j *TrainingJobs) run(job *TrainingJob) {
+	j.logger.Infow("Training job started", "job_id", job.ID, "attempt", job.Attempts, "sample", job.Sample != nil)
+	started := time.Now()
+
+	ctx, cancel := context.WithTimeout(j.lifecycle.Context(), j.timeout)
+	defer cancel()
+	ctx, lose := context.WithCancelCause(ctx)
+	defer lose(nil)
+	ctx = withTrainingStage(ctx, func(stage string) {
+		if err := j.postgresRepo.UpdateTrainingJobStage(job.ID, job.Replica, job.Attempts, stage); err != nil {
+			j.logger.Warnw("Failed to record training job stage", "error", err, "job_id", job.ID, "stage", stage)
+			if errors.Is(err, repository.ErrTrainingJobClaimLost) {
+				lose(err)
+			}
+		}
+	})
+
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+	go j.heartbeat(job, lose, heartbeatDone)
+
+	var result *TrainingResult
+	var err error
+	if job.Sample != nil {
+		result, err = j.mlService.TrainModelsOnSample(ctx, *job.Sample)
+	} else {
+		result, err = j.mlService.TrainModels(ctx)
+	}
+
+	switch {
+	case errors.Is(context.Cause(ctx), repository.ErrTrainingJobClaimLost):
+		j.logger.Warnw("Training job was taken over by another worker, abandoning it", "job_id", job.ID, "attempt", job.Attempts)
+	case err == nil:
+		j.finish(job, TrainingStatusSucceeded, &trainingJobResult{TrainingResult: result}, "")
+		j.logger.Infow("Training job completed", "job_id", job.ID, "version", result.Version,
+			"promoted", result.Promoted, "duration", time.Since(started))
+	case j.lifecycle.Context().Err() != nil:
+		j.logger.Warnw("Training job interrupted by shutdown, queueing it for another worker", "job_id", job.ID)
+		j.finish(job, TrainingJobQueued, nil, "")
+	default:
+		var outputErr *TrainingOutputError
+		var stored *trainingJobResult
+		message := err.Error()
+		if errors.As(err, &outputErr) {
+			stored = &trainingJobResult{PythonOutput: truncateOutput(outputErr.Output, j.mlService.trainingLogMaxBytes)}
+			message = "training did not complete successfully"
+		}
+		j.finish(job, TrainingStatusFailed, stored, truncateOutput(message, j.mlService.trainingLogMaxBytes))
+		j.logger.Warnw("Training job failed", "job_id", job.ID, "error", err)
+	}
+}
+
+// heartbeat records that a job is still running until done is closed, and cancels its training
+// with lose once another worker took the job over
+func (j *TrainingJobs) heartbeat(job *TrainingJob, lose context.CancelCauseFunc, done <-chan struct{}) {
+	ticker := time.NewTicker(trainingJobHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := j.postgresRepo.UpdateTrainingJobStage(job.ID, job.Replica, job.Attempts, ""); err != nil {
+				j.logger.Warnw("Failed to record training job heartbeat", "error", err, "job_id", job.ID)
+				if errors.Is(err, repository.ErrTrainingJobClaimLost) {
+					lose(err)
+					return
+				}
+			}
+		}
+	}
+}
+
+// finish stores the outcome of a job; a failure is only logged, the job is then taken over once
+// its heartbeat is stale. The outcome of a job another worker took over meanwhile is dropped
+func (j *TrainingJobs) finish(job *TrainingJob, status string, result *trainingJobResult, errMsg string) {
+	var data []byte
+	if result != nil {
+		data, _ = json.Marshal(result)
+	}
+	err := j.postgresRepo.FinishTrainingJob(job.ID, job.Replica, job.Attempts, status, data, errMsg)
+	if errors.Is(err, repository.ErrTrainingJobClaimLost) {
+		j.logger.Warnw("Training job was taken over by another worker, dropping its outcome", "job_id", job.ID,
+			"attempt", job.Attempts, "status", status)
+		return
+	}
+	if err != nil {
+		j.logger.Errorw("Failed to record training job outcome", "error", err, "job_id", job.ID, "status", status)
+	}
+}
+
+type trainingStageKey struct{}
+
+// withTrainingStage reports the stages of the training run with ctx to report
+func withTrainingStage(ctx context.Context, report func(stage string)) context.Context {
+	return context.WithValue(ctx, trainingStageKey{}, report)
+}
+
+// reportTrainingStage reports the stage a training run reached to the reporter of ctx, if any
+func reportTrainingStage(ctx context.Context, stage string) {
+	if report, ok := ctx.Value(trainingStageKey{}).(func(stage string)); ok {
+		report(stage)
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+)
+
+// progressEvent is the "event" value of the NDJSON progress lines emitted by the training script
+const progressEvent = "progress"
+
+// TrainingProgress represents the evaluation metrics of one boosting iteration
+type TrainingProgress struct {
+	Model     string  `json:"model"`
+	Iteration int     `json:"iteration"`
+	TrainRMSE float64 `json:"train_rmse"`
+	ValidRMSE float64 `json:"valid_rmse"`
+}
+
+// ParseTrainingProgressLine parses a single line of training output,
+// reporting whether it was an NDJSON progress record
+func ParseTrainingProgressLine(line string) (*TrainingProgress, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") || !strings.Contains(line, `"event"`) {
+		return nil, false
+	}
+
+	var record struct {
+		Event string `json:"event"`
+		TrainingProgress
+	}
+	if err := json.Unmarshal([]byte(line), &record); err != nil || record.Event != progressEvent {
+		return nil, false
+	}
+
+	return &record.TrainingProgress, true
+}
+
+// parseTrainingProgress extracts all progress records from the training output, in order
+func parseTrainingProgress(output string) []TrainingProgress {
+	var progress []TrainingProgress
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if record, ok := ParseTrainingProgressLine(scanner.Text()); ok {
+			progress = append(progress, *record)
+		}
+	}
+
+	return progress
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TrainingQuota is a soft limit on the size of the training data, so that a dataset that kept
+// growing does not exhaust the memory or disk of a training run. Past it the script downsamples
+// the rows of the training window within every category, keeping their proportions, instead of
+// failing; the run reports what it dropped. Zero limits are off
+type TrainingQuota struct {
+	MaxRows int
+	// MaxBytes limits the size of the training data file; the script converts it to rows with the
+	// average size of a row
+	MaxBytes int
+}
+
+// TrainingDownsampleInfo is the downsampling a training run applied to stay within its quota, as
+// reported by the script
+type TrainingDownsampleInfo struct {
+	MaxRows  int `json:"max_rows,omitempty"`
+	MaxBytes int `json:"max_bytes,omitempty"`
+	// Fraction is the share of the rows of every category that was kept
+	Fraction    float64 `json:"fraction"`
+	Rows        int     `json:"rows"`
+	DroppedRows int     `json:"dropped_rows"`
+	// StratifiedBy is the column whose values kept their proportions, absent when the training data
+	// has no category column and the rows were sampled at random
+	StratifiedBy string `json:"stratified_by,omitempty"`
+}
+
+// scriptArgs returns the training script arguments setting the quota
+func (q TrainingQuota) scriptArgs() []string {
+	var args []string
+	if q.MaxRows > 0 {
+		args = append(args, "--max-rows", strconv.Itoa(q.MaxRows))
+	}
+	if q.MaxBytes > 0 {
+		args = append(args, "--max-bytes", strconv.Itoa(q.MaxBytes))
+	}
+	return args
+}
+
+// String describes the quota, e.g. "1000000 rows, 536870912 bytes", or "none"
+func (q TrainingQuota) String() string {
+	var limits []string
+	if q.MaxRows > 0 {
+		limits = append(limits, strconv.Itoa(q.MaxRows)+" rows")
+	}
+	if q.MaxBytes > 0 {
+		limits = append(limits, strconv.Itoa(q.MaxBytes)+" bytes")
+	}
+	if len(limits) == 0 {
+		return "none"
+	}
+	return strings.Join(limits, ", ")
+}
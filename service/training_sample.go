@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrInvalidTrainingSample is returned when a fast-train request fails validation
+var ErrInvalidTrainingSample = errors.New("invalid training sample")
+
+// ErrSampledModel is returned when artifacts trained on a sample are about to be installed
+var ErrSampledModel = errors.New("model was trained on a sample of the training data")
+
+// TrainingSample selects part of the training rows for a fast experimental run: a random Percent
+// of them, or those of the last Days days. Models trained on a sample are registered inactive and
+// are never installed
+type TrainingSample struct {
+	Percent float64 `json:"percent,omitempty"`
+	Days    int     `json:"days,omitempty"`
+}
+
+// TrainingSampleInfo is the sample a training run applied, as reported by the script
+type TrainingSampleInfo struct {
+	Percent float64 `json:"percent,omitempty"`
+	Days    int     `json:"days,omitempty"`
+	Rows    int     `json:"rows"`
+	// DroppedRows are the rows of the training window left out of the sample
+	DroppedRows int `json:"dropped_rows"`
+}
+
+// validate checks that exactly one of Percent and Days is set and within range
+func (s TrainingSample) validate() error {
+	if (s.Percent != 0) == (s.Days != 0) {
+		return fmt.Errorf("%w: set either percent or days", ErrInvalidTrainingSample)
+	}
+	if s.Percent < 0 || s.Percent >= 100 {
+		return fmt.Errorf("%w: percent must be above 0 and below 100", ErrInvalidTrainingSample)
+	}
+	if s.Days < 0 {
+		return fmt.Errorf("%w: days must be positive", ErrInvalidTrainingSample)
+	}
+	return nil
+}
+
+// scriptArgs returns the training script arguments selecting the sample
+func (s TrainingSample) scriptArgs() []string {
+	if s.Days > 0 {
+		return []string{"--sample-days", strconv.Itoa(s.Days)}
+	}
+	return []string{"--sample-percent", strconv.FormatFloat(s.Percent, 'f', -1, 64)}
+}
+
+// String describes the sample, e.g. "10% of the rows"
+func (s TrainingSample) String() string {
+	if s.Days > 0 {
+		return "the last " + strconv.Itoa(s.Days) + " days"
+	}
+	return strconv.FormatFloat(s.Percent, 'f', -1, 64) + "% of the rows"
+}
@@ -0,0 +1,49 @@
+package service
+
+import "strconv"
+
+// Training window modes
+const (
+	// TrainingWindowExpanding trains on every row of the training data
+	TrainingWindowExpanding = "expanding"
+	// TrainingWindowSliding trains on the rows of the last Days days of the training data
+	TrainingWindowSliding = "sliding"
+)
+
+// TrainingWindow decides which rows of the training data new models learn from. A sliding window
+// leaves out history that no longer describes demand, such as a period of unusual sales. It only
+// applies to training: the script stamps it into feature_info.json with the models
+type TrainingWindow struct {
+	Mode string
+	// Days is the length of a sliding window, counted back from the latest date of the training data
+	Days int
+}
+
+// TrainingWindowInfo is the window a training run applied, as reported by the script
+type TrainingWindowInfo struct {
+	Mode string `json:"mode"`
+	Days int    `json:"days,omitempty"`
+	// From and To are the first and last dates of the rows trained on, in YYYY-MM-DD format,
+	// absent when the training data has no date column
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	Rows int    `json:"rows"`
+	// DroppedRows are the rows before the window
+	DroppedRows int `json:"dropped_rows"`
+}
+
+// scriptArgs returns the training script arguments selecting the window
+func (w TrainingWindow) scriptArgs() []string {
+	if w.Mode != TrainingWindowSliding {
+		return nil
+	}
+	return []string{"--window", TrainingWindowSliding, "--window-days", strconv.Itoa(w.Days)}
+}
+
+// String describes the window, e.g. "sliding 365d"
+func (w TrainingWindow) String() string {
+	if w.Mode != TrainingWindowSliding {
+		return TrainingWindowExpanding
+	}
+	return TrainingWindowSliding + " " + strconv.Itoa(w.Days) + "d"
+}
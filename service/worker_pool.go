@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"sync"
+)
+
+// Catalog-wide jobs that run their tasks on the worker pool
+const (
+	WorkloadSimulation     = "simulation"
+	WorkloadBatch          = "batch"
+	WorkloadReconciliation = "reconciliation"
+	WorkloadBacktest       = "backtest"
+)
+
+// WorkerPool bounds the parallelism of catalog-wide jobs. Every task takes a slot of the shared pool,
+// so all jobs together never run more tasks at once than the pool size, and a job can be limited
+// further by its own override. Keeping the pool below the Python concurrency limit leaves prediction
+// processes free for interactive requests while big jobs run. With the worker_pool feature flag off,
+// every job runs one task at a time
+type WorkerPool struct {
+	slots     chan struct{}
+	overrides map[string]int
+	flags     *FeatureFlags
+}
+
+// NewWorkerPool creates a worker pool of the given size. overrides caps the tasks of individual jobs;
+// jobs without an override, or with an override of 0, may use the whole pool
+func NewWorkerPool(size int, overrides map[string]int, flags *FeatureFlags) *WorkerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &WorkerPool{
+		slots:     make(chan struct{}, size),
+		overrides: overrides,
+		flags:     flags,
+	}
+}
+
+// Workers returns the number of tasks of the given job that may run at once
+func (p *WorkerPool) Workers(job string) int {
+	if !p.flags.Enabled(FlagWorkerPool, "") {
+		return 1
+	}
+	if override := p.overrides[job]; override > 0 && override < cap(p.slots) {
+		return override
+	}
+	return cap(p.slots)
+}
+
+// Run calls fn for every index in [0, n) with at most Workers(job) calls in flight. The first error
+// cancels the context of the other calls and is returned
+func (p *WorkerPool) Run(parent context.Context, job string, n int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(p.Workers(job), n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				select {
+				case p.slots <- struct{}{}:
+				case <-ctx.Done():
+					fail(ctx.Err())
+					continue
+				}
+				err := fn(ctx, i)
+				<-p.slots
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr == nil {
+		return parent.Err()
+	}
+	return firstErr
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// lameDuckSignals put the service into lame-duck mode; use the admin API where SIGUSR1 does not exist
+var lameDuckSignals []os.Signal
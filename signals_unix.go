@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lameDuckSignals put the service into lame-duck mode
+var lameDuckSignals = []os.Signal{syscall.SIGUSR1}